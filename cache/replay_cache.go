@@ -0,0 +1,43 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// ReplayCache remembers single-use identifiers, such as the jti of a JWT,
+// until they expire, so that a second use can be detected.
+type ReplayCache struct {
+	mu      sync.Mutex
+	entries map[string]time.Time
+	nextGC  time.Time
+}
+
+func NewReplayCache() *ReplayCache {
+	return &ReplayCache{
+		entries: make(map[string]time.Time),
+	}
+}
+
+// Use records the identifier until it expires. It returns false if the
+// identifier was already recorded and has not expired yet.
+func (c *ReplayCache) Use(id string, expiresAt time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.After(c.nextGC) {
+		for key, expiry := range c.entries {
+			if now.After(expiry) {
+				delete(c.entries, key)
+			}
+		}
+		c.nextGC = now.Add(time.Minute)
+	}
+
+	if expiry, ok := c.entries[id]; ok && now.Before(expiry) {
+		return false
+	}
+	c.entries[id] = expiresAt
+	return true
+}
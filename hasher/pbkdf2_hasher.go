@@ -25,7 +25,6 @@ func NewPBKDF2Hasher(iterations int, secret []byte) *PBKDF2Hasher {
 func (h *PBKDF2Hasher) GenerateFromPassword(password string) (string, error) {
 	key := pbkdf2.Key([]byte(password), []byte(h.secret), h.iterations, sha256.Size, sha256.New)
 	stringPass := fmt.Sprintf("%s$%d$%x$%x", h.alg, h.iterations, h.secret, key)
-	fmt.Println(stringPass)
 	return stringPass, nil
 }
 
@@ -0,0 +1,34 @@
+package hasher
+
+import "time"
+
+// Operations reported by TimedHasher
+const (
+	OPERATION_GENERATE string = "generate"
+	OPERATION_COMPARE  string = "compare"
+)
+
+// TimedHasher reports how long the hasher it wraps takes to hash passwords
+// and to compare them with their hashes.
+type TimedHasher struct {
+	hasher  Hasher
+	observe func(operation string, duration time.Duration)
+}
+
+// NewTimedHasher creates a hasher reporting the duration of every operation
+// of h to observe.
+func NewTimedHasher(h Hasher, observe func(operation string, duration time.Duration)) *TimedHasher {
+	return &TimedHasher{hasher: h, observe: observe}
+}
+
+func (h *TimedHasher) GenerateFromPassword(password string) (string, error) {
+	start := time.Now()
+	defer func() { h.observe(OPERATION_GENERATE, time.Since(start)) }()
+	return h.hasher.GenerateFromPassword(password)
+}
+
+func (h *TimedHasher) CompareHashAndPassword(hashedPassword, password string) error {
+	start := time.Now()
+	defer func() { h.observe(OPERATION_COMPARE, time.Since(start)) }()
+	return h.hasher.CompareHashAndPassword(hashedPassword, password)
+}
@@ -1,54 +1,233 @@
 package logger
 
 import (
-	"log"
-	"net/http"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
+// Level is the severity of a log entry. Entries below the level of a logger
+// are discarded.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelFatal
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+	LevelFatal: "fatal",
+}
+
+var levelColors = map[Level]string{
+	LevelDebug: "\033[44m",
+	LevelInfo:  "\033[42m",
+	LevelWarn:  "\033[43m",
+	LevelError: "\033[41m",
+	LevelFatal: "\033[41m",
+}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel returns the level with the given name: debug, info, warn or
+// error.
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", name)
+}
+
+// Format is the way log entries are written.
+type Format string
+
+const (
+	// FormatJSON writes every entry as a JSON object on its own line, for log
+	// collectors.
+	FormatJSON Format = "json"
+	// FormatConsole writes every entry as a colored line of text, for humans.
+	FormatConsole Format = "console"
+)
+
+// ParseFormat returns the format with the given name: json or console.
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(strings.ToLower(name)); format {
+	case FormatJSON, FormatConsole:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown log format %q", name)
+}
+
+type field struct {
+	key   string
+	value interface{}
+}
+
+// output is the destination shared by a logger and the loggers derived from
+// it, so that their entries are not interleaved.
+type output struct {
+	mu     sync.Mutex
+	writer io.Writer
+}
+
+// Logger writes leveled, structured log entries. Fields are attached with
+// WithField, which returns a child logger writing them along with every entry;
+// the values of fields whose keys name secrets, such as passwords and tokens,
+// are redacted.
 type Logger struct {
-	*log.Logger
+	out    *output
+	level  Level
+	format Format
+	fields []field
+}
+
+// New creates a logger writing the entries of the level and above to w in
+// the format.
+func New(w io.Writer, level Level, format Format) *Logger {
+	return &Logger{
+		out:    &output{writer: w},
+		level:  level,
+		format: format,
+	}
 }
 
+// NewLogger creates a logger writing info entries and above to the standard
+// error in the console format.
 func NewLogger() *Logger {
-	return &Logger{log.New(log.Writer(), "", 0)}
+	return New(os.Stderr, LevelInfo, FormatConsole)
+}
+
+// WithField returns a child logger writing the field along with every entry,
+// in place of any field with the same key.
+func (l *Logger) WithField(key string, value interface{}) *Logger {
+	child := *l
+	child.fields = make([]field, 0, len(l.fields)+1)
+	for _, f := range l.fields {
+		if f.key != key {
+			child.fields = append(child.fields, f)
+		}
+	}
+	child.fields = append(child.fields, field{key: key, value: value})
+	return &child
+}
+
+// WithError returns a child logger writing the error along with every entry.
+func (l *Logger) WithError(err error) *Logger {
+	return l.WithField("error", err)
 }
 
-func (l *Logger) RequestLoggerMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		log.Printf("\033[44m %s \033[0m | PATH: \033[33m\"%s\"\033[0m | TIME: %v",
-			r.Method, r.URL.Path, start.Format("2006-01-02 15:04:05"),
-		)
-		next.ServeHTTP(w, r)
-	})
+// Enabled returns true if the logger writes entries of the level.
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
 }
 
-func (l *Logger) WithField(key string, value interface{}) {
-	l.Printf("\033[42m INFO \033[0m | %s: \033[33m\"%s\"\033[0m",
-		strings.ToUpper(key), value,
-	)
+func (l *Logger) Debug(msg string) {
+	l.log(LevelDebug, msg)
 }
 
-func (l *Logger) Debug(funcName string, object interface{}) {
-	l.Printf("\033[42m DEBUG \033[0m | FUNC: \033[33m\"%s\"\033[0m | OBJECT: \033[32m %v \033[0m",
-		funcName, object,
-	)
+func (l *Logger) Info(msg string) {
+	l.log(LevelInfo, msg)
 }
 
-func (l *Logger) Info(status int, path string, start time.Time) {
-	l.Printf("\033[42m %d \033[0m | PATH: \033[33m\"%s\"\033[0m | DURATION: \033[42m %v \033[0m",
-		status, path, time.Since(start),
-	)
+func (l *Logger) Warn(msg string) {
+	l.log(LevelWarn, msg)
 }
 
-func (l *Logger) Error(status int, path string, err error) {
-	l.Printf("\033[42m %d \033[0m | PATH: \033[33m\"%s\"\033[0m | ERROR: \033[31m %v \033[0m",
-		status, path, err,
-	)
+func (l *Logger) Error(msg string) {
+	l.log(LevelError, msg)
 }
 
+// Fatal writes the error and exits.
 func (l *Logger) Fatal(err error) {
-	l.Fatalf("\033[41m FATAL \033[0m | ERROR: \033[31m %v \033[0m", err)
+	l.WithError(err).log(LevelFatal, "fatal error")
+	os.Exit(1)
+}
+
+func (l *Logger) log(level Level, msg string) {
+	if !l.Enabled(level) {
+		return
+	}
+	now := time.Now()
+	var line []byte
+	if l.format == FormatJSON {
+		line = l.jsonEntry(now, level, msg)
+	} else {
+		line = l.consoleEntry(now, level, msg)
+	}
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	l.out.writer.Write(line)
+}
+
+func (l *Logger) jsonEntry(now time.Time, level Level, msg string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(`{"time":`)
+	buf.Write(encode(now.Format(time.RFC3339Nano)))
+	buf.WriteString(`,"level":`)
+	buf.Write(encode(level.String()))
+	buf.WriteString(`,"msg":`)
+	buf.Write(encode(msg))
+	for _, f := range l.fields {
+		buf.WriteByte(',')
+		buf.Write(encode(f.key))
+		buf.WriteByte(':')
+		buf.Write(encode(redact(f.key, f.value)))
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+func (l *Logger) consoleEntry(now time.Time, level Level, msg string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(now.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(&buf, " %s %-5s \033[0m %s", levelColors[level], strings.ToUpper(level.String()), msg)
+	for _, f := range l.fields {
+		fmt.Fprintf(&buf, " \033[33m%s\033[0m=", f.key)
+		value := redact(f.key, f.value)
+		if text, ok := value.(string); ok {
+			if strings.ContainsAny(text, " \"=") || text == "" {
+				text = strconv.Quote(text)
+			}
+			buf.WriteString(text)
+		} else {
+			buf.Write(encode(value))
+		}
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+// encode returns the JSON encoding of the value, or of the error preventing
+// it.
+func encode(value interface{}) []byte {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(value)
+	if err != nil {
+		return encode(fmt.Sprintf("!%v", err))
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
 }
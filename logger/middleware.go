@@ -0,0 +1,123 @@
+package logger
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// REQUEST_ID_HEADER is the header identifying requests, set on the response by
+// a middleware running before RequestLoggerMiddleware.
+const REQUEST_ID_HEADER = "X-Request-ID"
+
+type contextKey struct{}
+
+// NewContext returns a copy of the context carrying the logger.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger carried by the context, or nil if there is
+// none.
+func FromContext(ctx context.Context) *Logger {
+	l, _ := ctx.Value(contextKey{}).(*Logger)
+	return l
+}
+
+// RequestLoggerMiddleware is a middleware that gives every request a child
+// logger carrying its id, and the ids of its trace and span when it is traced,
+// available with FromContext, and writes an entry once the request was
+// handled, with its route, status, duration and the size of the response.
+// Requests failing with a server error are logged as errors, and requests
+// rejected with a client error as warnings.
+func (l *Logger) RequestLoggerMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		requestLogger := l.WithField("request_id", w.Header().Get(REQUEST_ID_HEADER))
+		if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.IsValid() {
+			requestLogger = requestLogger.
+				WithField("trace_id", spanContext.TraceID().String()).
+				WithField("span_id", spanContext.SpanID().String())
+		}
+		recorder := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(NewContext(r.Context(), requestLogger)))
+
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		entry := requestLogger.
+			WithField("method", r.Method).
+			WithField("path", r.URL.Path)
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				entry = entry.WithField("route", template)
+			}
+		}
+		entry = entry.
+			WithField("status", recorder.status).
+			WithField("duration_ms", float64(time.Since(start).Microseconds())/1000).
+			WithField("bytes", recorder.bytes)
+		if recorder.err != nil {
+			entry = entry.WithError(recorder.err)
+		}
+		switch {
+		case recorder.status >= http.StatusInternalServerError:
+			entry.Error("request failed")
+		case recorder.status >= http.StatusBadRequest:
+			entry.Warn("request rejected")
+		default:
+			entry.Info("request handled")
+		}
+	})
+}
+
+// RecordError attaches the error a request failed with to the entry written
+// for it by RequestLoggerMiddleware, given the response writer the
+// middleware passed on.
+func RecordError(w http.ResponseWriter, err error) {
+	for {
+		switch writer := w.(type) {
+		case *responseRecorder:
+			writer.err = err
+			return
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = writer.Unwrap()
+		default:
+			return
+		}
+	}
+}
+
+// responseRecorder records the status and size of a response, and the error
+// it reports.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+	err    error
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(data)
+	r.bytes += n
+	return n, err
+}
+
+// Unwrap returns the response writer the recorder wraps, so that
+// http.ResponseController reaches it.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
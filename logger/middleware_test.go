@@ -0,0 +1,181 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// entries decodes the JSON entries written to buf.
+func entries(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var decoded []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		err := json.Unmarshal([]byte(line), &entry)
+		if err != nil {
+			t.Fatalf("invalid entry %q: %v", line, err)
+		}
+		decoded = append(decoded, entry)
+	}
+	return decoded
+}
+
+// setRequestID stands for the middleware identifying requests, which runs
+// before RequestLoggerMiddleware.
+func setRequestID(id string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(REQUEST_ID_HEADER, id)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// unwrappingWriter wraps a response writer like the middlewares running
+// after RequestLoggerMiddleware may.
+type unwrappingWriter struct {
+	http.ResponseWriter
+}
+
+func (w unwrappingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func TestRequestLoggerMiddleware(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		status  float64
+		bytes   float64
+		level   string
+		msg     string
+		err     string
+	}{
+		{"handled", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("hello"))
+		}, 200, 5, "info", "request handled", ""},
+		{"no content", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}, 204, 0, "info", "request handled", ""},
+		{"rejected", func(w http.ResponseWriter, r *http.Request) {
+			RecordError(w, errors.New("invalid_client"))
+			w.WriteHeader(http.StatusUnauthorized)
+			w.WriteHeader(http.StatusInternalServerError)
+		}, 401, 0, "warn", "request rejected", "invalid_client"},
+		{"failed", func(w http.ResponseWriter, r *http.Request) {
+			RecordError(unwrappingWriter{w}, errors.New("connection refused"))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		}, 500, 15, "error", "request failed", "connection refused"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l := New(&buf, LevelDebug, FormatJSON)
+			router := mux.NewRouter()
+			router.Use(setRequestID("request"), l.RequestLoggerMiddleware)
+			router.Handle("/users/{id}", tt.handler)
+
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/42", nil))
+
+			logged := entries(t, &buf)
+			if len(logged) != 1 {
+				t.Fatalf("entries = %v", logged)
+			}
+			entry := logged[0]
+			for key, want := range map[string]interface{}{
+				"level":      tt.level,
+				"msg":        tt.msg,
+				"request_id": "request",
+				"method":     "GET",
+				"path":       "/users/42",
+				"route":      "/users/{id}",
+				"status":     tt.status,
+				"bytes":      tt.bytes,
+			} {
+				if entry[key] != want {
+					t.Errorf("%s = %v, want %v", key, entry[key], want)
+				}
+			}
+			if _, ok := entry["duration_ms"].(float64); !ok {
+				t.Errorf("duration_ms = %v", entry["duration_ms"])
+			}
+			if tt.err == "" && entry["error"] != nil || tt.err != "" && entry["error"] != tt.err {
+				t.Errorf("error = %v, want %q", entry["error"], tt.err)
+			}
+		})
+	}
+}
+
+func TestRequestLoggerMiddlewarePropagatesRequestID(t *testing.T) {
+	traceId, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanId, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceId,
+		SpanID:     spanId,
+		TraceFlags: trace.FlagsSampled,
+	})
+	tests := []struct {
+		name   string
+		traced bool
+	}{
+		{"untraced", false},
+		{"traced", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l := New(&buf, LevelInfo, FormatJSON).WithField("component", "server")
+			handler := setRequestID("request")(l.RequestLoggerMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requestLogger := FromContext(r.Context())
+				if requestLogger == nil {
+					t.Fatal("the request carries no logger")
+				}
+				requestLogger.WithField("user", "alice").Info("user authenticated")
+			})))
+			r := httptest.NewRequest(http.MethodPost, "/token", nil)
+			if tt.traced {
+				r = r.WithContext(trace.ContextWithSpanContext(r.Context(), spanContext))
+			}
+
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			logged := entries(t, &buf)
+			if len(logged) != 2 {
+				t.Fatalf("entries = %v", logged)
+			}
+			// Both the entry written by the handler and the one written once
+			// the request was handled identify it, and keep the fields of the
+			// logger.
+			for _, entry := range logged {
+				if entry["request_id"] != "request" || entry["component"] != "server" {
+					t.Errorf("entry %v does not identify the request", entry)
+				}
+				if tt.traced {
+					if entry["trace_id"] != traceId.String() || entry["span_id"] != spanId.String() {
+						t.Errorf("trace_id = %v, span_id = %v", entry["trace_id"], entry["span_id"])
+					}
+				} else if _, ok := entry["trace_id"]; ok {
+					t.Errorf("trace_id = %v, want none", entry["trace_id"])
+				}
+			}
+			if logged[0]["user"] != "alice" || logged[1]["user"] != nil {
+				t.Errorf("the fields of the handler leaked: %v", logged)
+			}
+		})
+	}
+}
+
+func TestFromContextWithoutLogger(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if l := FromContext(r.Context()); l != nil {
+		t.Errorf("FromContext = %v, want nil", l)
+	}
+}
@@ -0,0 +1,93 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// REDACTED replaces the values of secrets in log entries.
+const REDACTED = "[REDACTED]"
+
+// sensitiveKeys are the keys, lowercased and without separators, whose values
+// are secrets.
+var sensitiveKeys = map[string]bool{
+	"authorization":   true,
+	"cookie":          true,
+	"setcookie":       true,
+	"code":            true,
+	"codeverifier":    true,
+	"devicecode":      true,
+	"usercode":        true,
+	"assertion":       true,
+	"clientassertion": true,
+	"samlresponse":    true,
+	"privatekey":      true,
+	"dpop":            true,
+}
+
+// sensitiveSuffixes are the endings of keys whose values are secrets, such as
+// client_secret or refresh_token.
+var sensitiveSuffixes = []string{"password", "secret", "token"}
+
+// isSensitive returns true if the key names a secret.
+func isSensitive(key string) bool {
+	key = strings.NewReplacer("_", "", "-", "", " ", "").Replace(strings.ToLower(key))
+	if sensitiveKeys[key] {
+		return true
+	}
+	for _, suffix := range sensitiveSuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// redact returns the value of the field with the given key in a form that can
+// be encoded as JSON, with secrets redacted: the whole value if the key names
+// a secret, or else the values of the keys naming secrets in its JSON
+// encoding.
+func redact(key string, value interface{}) interface{} {
+	if isSensitive(key) {
+		return REDACTED
+	}
+	switch v := value.(type) {
+	case nil, string, bool, int, int32, int64, uint, uint32, uint64, float32, float64:
+		return v
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	var decoded interface{}
+	err = json.Unmarshal(data, &decoded)
+	if err != nil {
+		return string(data)
+	}
+	return redactNested(decoded)
+}
+
+// redactNested redacts the values of the keys naming secrets in a decoded
+// JSON value.
+func redactNested(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range v {
+			if isSensitive(key) {
+				v[key] = REDACTED
+			} else {
+				v[key] = redactNested(nested)
+			}
+		}
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = redactNested(nested)
+		}
+	}
+	return value
+}
@@ -0,0 +1,118 @@
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIsSensitive(t *testing.T) {
+	for _, key := range []string{
+		"password", "new_password", "client_secret", "refresh_token", "access-token", "id token",
+		"Authorization", "Set-Cookie", "code", "code_verifier", "device_code", "user_code",
+		"client_assertion", "assertion", "SAMLResponse", "private_key", "DPoP",
+	} {
+		if !isSensitive(key) {
+			t.Errorf("%q is not sensitive", key)
+		}
+	}
+	for _, key := range []string{
+		"username", "client_id", "token_type", "code_challenge_method", "request_id", "status", "",
+	} {
+		if isSensitive(key) {
+			t.Errorf("%q is sensitive", key)
+		}
+	}
+}
+
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type stringer struct{}
+
+func (stringer) String() string {
+	return "text"
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		value interface{}
+		want  interface{}
+	}{
+		{"secret", "client_secret", "s3cr3t", REDACTED},
+		{"secret structure", "refresh_token", credentials{"alice", "s3cr3t"}, REDACTED},
+		{"plain value", "username", "alice", "alice"},
+		{"number", "status", 200, 200},
+		{"nil", "error", nil, nil},
+		{"error", "error", errors.New("invalid_grant"), "invalid_grant"},
+		{"stringer", "value", stringer{}, "text"},
+		{
+			"structure",
+			"user",
+			credentials{"alice", "s3cr3t"},
+			map[string]interface{}{"username": "alice", "password": REDACTED},
+		},
+		{
+			"nested map",
+			"form",
+			map[string]interface{}{
+				"grant_type": "authorization_code",
+				"code":       "abc",
+				"clients":    []interface{}{map[string]string{"client_id": "app", "client_secret": "s3cr3t"}},
+			},
+			map[string]interface{}{
+				"grant_type": "authorization_code",
+				"code":       REDACTED,
+				"clients":    []interface{}{map[string]interface{}{"client_id": "app", "client_secret": REDACTED}},
+			},
+		},
+		{"headers", "headers", map[string][]string{"Authorization": {"Bearer abc"}, "Accept": {"*/*"}},
+			map[string]interface{}{"Authorization": REDACTED, "Accept": []interface{}{"*/*"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := redact(tt.key, tt.value)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("redact = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactValueNotEncodable(t *testing.T) {
+	// The value is written as text rather than failing the whole entry.
+	if got, ok := redact("channel", make(chan int)).(string); !ok || got == "" {
+		t.Errorf("redact = %#v, want the value as text", got)
+	}
+}
+
+func TestEntriesAreRedacted(t *testing.T) {
+	for _, format := range []Format{FormatJSON, FormatConsole} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			New(&buf, LevelInfo, format).
+				WithField("username", "alice").
+				WithField("password", "s3cr3t").
+				WithField("request", map[string]string{"refresh_token": "r3fr3sh", "scope": "openid"}).
+				Info("token issued")
+
+			entry := buf.String()
+			for _, secret := range []string{"s3cr3t", "r3fr3sh"} {
+				if strings.Contains(entry, secret) {
+					t.Errorf("the entry holds %q: %s", secret, entry)
+				}
+			}
+			for _, want := range []string{"alice", "openid", REDACTED} {
+				if !strings.Contains(entry, want) {
+					t.Errorf("the entry does not hold %q: %s", want, entry)
+				}
+			}
+		})
+	}
+}
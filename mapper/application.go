@@ -16,6 +16,9 @@ func ApplicationsToApplicationDtos(apps []*models.Application) []*models.Applica
 }
 
 func ApplicationToApplicationDto(app *models.Application) *models.ApplicationDto {
+	if app == nil {
+		return nil
+	}
 	return &models.ApplicationDto{
 		ID:      app.ID.String(),
 		AppName: app.AppName,
@@ -0,0 +1,39 @@
+package mapper
+
+import (
+	"auth-server/models"
+	"encoding/json"
+	"time"
+)
+
+func AuditEventToAuditEventDto(event *models.AuditEvent) *models.AuditEventDto {
+	dto := &models.AuditEventDto{
+		ID:           event.ID,
+		Created:      event.CreatedAt.Format(time.RFC3339Nano),
+		Actor:        event.Actor,
+		Action:       event.Action,
+		Target:       event.Target,
+		IPAddress:    event.IPAddress,
+		UserAgent:    event.UserAgent,
+		Outcome:      event.Outcome,
+		Reason:       event.Reason,
+		RequestID:    event.RequestID,
+		PreviousHash: event.PreviousHash,
+		Hash:         event.Hash,
+	}
+	if event.Before != "" {
+		dto.Before = json.RawMessage(event.Before)
+	}
+	if event.After != "" {
+		dto.After = json.RawMessage(event.After)
+	}
+	return dto
+}
+
+func AuditEventsToAuditEventDtos(events []*models.AuditEvent) []*models.AuditEventDto {
+	dtos := make([]*models.AuditEventDto, 0)
+	for _, event := range events {
+		dtos = append(dtos, AuditEventToAuditEventDto(event))
+	}
+	return dtos
+}
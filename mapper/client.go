@@ -14,8 +14,69 @@ func ClientsToClientDtos(clients []*models.Client) []*models.ClientDto {
 
 func ClientToClientDto(client *models.Client) *models.ClientDto {
 	return &models.ClientDto{
-		ID:          client.ID.String(),
-		ClientName:  client.ClientName,
-		RedirectURI: client.RedirectURI,
+		ID:                      client.ID.String(),
+		ClientName:              client.ClientName,
+		ClientType:              client.ClientType,
+		Enabled:                 !client.Disabled,
+		FirstParty:              client.FirstParty,
+		RedirectURIs:            client.RedirectURIs,
+		PostLogoutRedirectURIs:  client.PostLogoutRedirectURIs,
+		BackchannelLogoutURI:    client.BackchannelLogoutURI,
+		FrontchannelLogoutURI:   client.FrontchannelLogoutURI,
+		LogoutSessionRequired:   client.LogoutSessionRequired,
+		AllowedOrigins:          client.AllowedOrigins,
+		GrantTypes:              client.GrantTypes,
+		ResponseTypes:           client.ResponseTypes,
+		Scope:                   client.Scope,
+		Contacts:                client.Contacts,
+		ClientURI:               client.ClientURI,
+		LogoURI:                 client.LogoURI,
+		AccessTokenLifetime:     client.AccessTokenLifetime,
+		RefreshTokenLifetime:    client.RefreshTokenLifetime,
+		TokenEndpointAuthMethod: client.TokenEndpointAuthMethod,
+		JwksURI:                 client.JwksURI,
+		Jwks:                    client.Jwks,
+		TlsClientAuthSubjectDN:  client.TlsClientAuthSubjectDN,
+		TlsClientAuthSanDNS:     client.TlsClientAuthSanDNS,
+		TlsClientAuthSanURI:     client.TlsClientAuthSanURI,
+		TlsClientAuthSanIP:      client.TlsClientAuthSanIP,
+		TlsClientAuthSanEmail:   client.TlsClientAuthSanEmail,
+		CertificateBoundTokens:  client.CertificateBoundTokens,
+	}
+}
+
+func ClientToClientMetadata(client *models.Client) *models.ClientMetadata {
+	return &models.ClientMetadata{
+		RedirectURIs:              client.RedirectURIs,
+		PostLogoutRedirectURIs:    client.PostLogoutRedirectURIs,
+		BackchannelLogoutURI:      client.BackchannelLogoutURI,
+		BackchannelLogoutSession:  client.BackchannelLogoutURI != "" && client.LogoutSessionRequired,
+		FrontchannelLogoutURI:     client.FrontchannelLogoutURI,
+		FrontchannelLogoutSession: client.FrontchannelLogoutURI != "" && client.LogoutSessionRequired,
+		TokenEndpointAuthMethod:   client.TokenEndpointAuthMethod,
+		GrantTypes:                client.GrantTypes,
+		ResponseTypes:             client.ResponseTypes,
+		ClientName:                client.ClientName,
+		ClientURI:                 client.ClientURI,
+		LogoURI:                   client.LogoURI,
+		Scope:                     client.Scope,
+		Contacts:                  client.Contacts,
+		JwksURI:                   client.JwksURI,
+		Jwks:                      client.Jwks,
+		TlsClientAuthSubjectDN:    client.TlsClientAuthSubjectDN,
+		TlsClientAuthSanDNS:       client.TlsClientAuthSanDNS,
+		TlsClientAuthSanURI:       client.TlsClientAuthSanURI,
+		TlsClientAuthSanIP:        client.TlsClientAuthSanIP,
+		TlsClientAuthSanEmail:     client.TlsClientAuthSanEmail,
+		CertificateBoundTokens:    client.CertificateBoundTokens,
+	}
+}
+
+func ClientToClientRegistrationResponse(client *models.Client, registrationClientURI string) *models.ClientRegistrationResponse {
+	return &models.ClientRegistrationResponse{
+		ClientID:              client.ID.String(),
+		ClientIDIssuedAt:      client.CreatedAt.Unix(),
+		RegistrationClientURI: registrationClientURI,
+		ClientMetadata:        *ClientToClientMetadata(client),
 	}
 }
@@ -0,0 +1,29 @@
+package mapper
+
+import (
+	"auth-server/models"
+	"time"
+)
+
+func ClientSecretsToClientSecretDtos(secrets []*models.ClientSecret) []*models.ClientSecretDto {
+	var dtos []*models.ClientSecretDto
+	for _, secret := range secrets {
+		dtos = append(dtos, ClientSecretToClientSecretDto(secret))
+	}
+	return dtos
+}
+
+func ClientSecretToClientSecretDto(secret *models.ClientSecret) *models.ClientSecretDto {
+	dto := &models.ClientSecretDto{
+		ID:        secret.ID.String(),
+		Active:    secret.IsActive(),
+		CreatedAt: secret.CreatedAt.Format(time.RFC3339),
+	}
+	if secret.ExpiresAt != nil {
+		dto.ExpiresAt = secret.ExpiresAt.Format(time.RFC3339)
+	}
+	if secret.RevokedAt != nil {
+		dto.RevokedAt = secret.RevokedAt.Format(time.RFC3339)
+	}
+	return dto
+}
@@ -0,0 +1,27 @@
+package mapper
+
+import (
+	"auth-server/models"
+	"time"
+)
+
+func ConsentToConsentDto(consent *models.Consent) *models.ConsentDto {
+	dto := &models.ConsentDto{
+		ID:      consent.ID.String(),
+		Scopes:  consent.Scope,
+		Created: consent.CreatedAt.Format(time.RFC3339),
+		Updated: consent.UpdatedAt.Format(time.RFC3339),
+	}
+	if consent.Client != nil {
+		dto.Client = ClientToClientDto(consent.Client)
+	}
+	return dto
+}
+
+func ConsentsToConsentDtos(consents []*models.Consent) []*models.ConsentDto {
+	dtos := make([]*models.ConsentDto, 0)
+	for _, consent := range consents {
+		dtos = append(dtos, ConsentToConsentDto(consent))
+	}
+	return dtos
+}
@@ -0,0 +1,20 @@
+package mapper
+
+import (
+	"auth-server/models"
+	"time"
+)
+
+func DeviceCodeToDeviceVerificationDto(deviceCode *models.DeviceCode) *models.DeviceVerificationDto {
+	dto := &models.DeviceVerificationDto{
+		UserCode:    models.FormatUserCode(deviceCode.UserCode),
+		Application: ApplicationToApplicationDto(deviceCode.Application),
+		Scope:       deviceCode.Scope,
+		Status:      deviceCode.Status,
+		ExpiresAt:   deviceCode.ExpiresAt.Format(time.RFC3339),
+	}
+	if deviceCode.Client != nil {
+		dto.Client = ClientToClientDto(deviceCode.Client)
+	}
+	return dto
+}
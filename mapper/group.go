@@ -0,0 +1,24 @@
+package mapper
+
+import "auth-server/models"
+
+func GroupToGroupDto(group *models.Group) *models.GroupDto {
+	dto := &models.GroupDto{
+		ID:        group.ID.String(),
+		Name:      group.Name,
+		Subgroups: GroupsToGroupDtos(group.Subgroups),
+		Roles:     RolesToRoleDtos(group.Roles),
+	}
+	if group.ParentID != nil {
+		dto.ParentID = group.ParentID.String()
+	}
+	return dto
+}
+
+func GroupsToGroupDtos(groups []*models.Group) []*models.GroupDto {
+	groupDtos := make([]*models.GroupDto, 0)
+	for _, group := range groups {
+		groupDtos = append(groupDtos, GroupToGroupDto(group))
+	}
+	return groupDtos
+}
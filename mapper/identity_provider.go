@@ -0,0 +1,76 @@
+package mapper
+
+import (
+	"auth-server/models"
+	"time"
+)
+
+func IdentityProviderToIdentityProviderDto(provider *models.IdentityProvider) *models.IdentityProviderDto {
+	dto := &models.IdentityProviderDto{
+		ID:           provider.ID.String(),
+		Name:         provider.Name,
+		Type:         provider.Type,
+		Disabled:     provider.Disabled,
+		Issuer:       provider.Issuer,
+		ClientID:     provider.ClientID,
+		Scopes:       provider.Scopes,
+		MetadataURL:  provider.MetadataURL,
+		EmailClaim:   provider.EmailClaim,
+		LinkByEmail:  provider.LinkByEmail,
+		RoleMappings: make([]*models.RoleMappingDto, 0),
+		Created:      provider.CreatedAt.Format(time.RFC3339),
+		Updated:      provider.UpdatedAt.Format(time.RFC3339),
+
+		LDAPURL:            provider.LDAPURL,
+		LDAPStartTLS:       provider.LDAPStartTLS,
+		LDAPRootCAs:        provider.LDAPRootCAs,
+		LDAPBindDN:         provider.LDAPBindDN,
+		LDAPUserDNTemplate: provider.LDAPUserDNTemplate,
+		LDAPBaseDN:         provider.LDAPBaseDN,
+		LDAPUserFilter:     provider.LDAPUserFilter,
+		LDAPGroupBaseDN:    provider.LDAPGroupBaseDN,
+		LDAPGroupFilter:    provider.LDAPGroupFilter,
+	}
+	for _, mapping := range provider.RoleMappings {
+		mappingDto := &models.RoleMappingDto{
+			ID:    mapping.ID.String(),
+			Claim: mapping.Claim,
+			Value: mapping.Value,
+		}
+		if mapping.Role != nil {
+			mappingDto.Role = RoleToRoleDto(mapping.Role)
+		}
+		dto.RoleMappings = append(dto.RoleMappings, mappingDto)
+	}
+	return dto
+}
+
+func IdentityProvidersToIdentityProviderDtos(providers []*models.IdentityProvider) []*models.IdentityProviderDto {
+	dtos := make([]*models.IdentityProviderDto, 0)
+	for _, provider := range providers {
+		dtos = append(dtos, IdentityProviderToIdentityProviderDto(provider))
+	}
+	return dtos
+}
+
+func ExternalIdentityToExternalIdentityDto(identity *models.ExternalIdentity) *models.ExternalIdentityDto {
+	dto := &models.ExternalIdentityDto{
+		ID:        identity.ID.String(),
+		Subject:   identity.Subject,
+		Email:     identity.Email,
+		Created:   identity.CreatedAt.Format(time.RFC3339),
+		LastLogin: identity.LastLoginAt.Format(time.RFC3339),
+	}
+	if identity.IdentityProvider != nil {
+		dto.IdentityProvider = identity.IdentityProvider.Name
+	}
+	return dto
+}
+
+func ExternalIdentitiesToExternalIdentityDtos(identities []*models.ExternalIdentity) []*models.ExternalIdentityDto {
+	dtos := make([]*models.ExternalIdentityDto, 0)
+	for _, identity := range identities {
+		dtos = append(dtos, ExternalIdentityToExternalIdentityDto(identity))
+	}
+	return dtos
+}
@@ -12,8 +12,8 @@ func PermissionsToPermissionDtos(permissions []*models.Permission) []*models.Per
 
 func PermissionToPermissionDto(permission *models.Permission) *models.PermissionDto {
 	return &models.PermissionDto{
-		ID:   permission.ID,
-		Name: permission.Name,
-		Role: RoleToRoleDto(permission.Role),
+		ID:    permission.ID,
+		Name:  permission.Name,
+		Roles: RolesToRoleDtos(permission.Roles),
 	}
 }
@@ -0,0 +1,24 @@
+package mapper
+
+import "auth-server/models"
+
+func PolicyToPolicyDto(policy *models.Policy) *models.PolicyDto {
+	return &models.PolicyDto{
+		ID:          policy.ID.String(),
+		Name:        policy.Name,
+		Description: policy.Description,
+		Application: ApplicationToApplicationDto(policy.Application),
+		Effect:      policy.Effect,
+		Resource:    policy.Resource,
+		Action:      policy.Action,
+		Conditions:  policy.Conditions,
+	}
+}
+
+func PoliciesToPolicyDtos(policies []*models.Policy) []*models.PolicyDto {
+	policyDtos := make([]*models.PolicyDto, 0)
+	for _, policy := range policies {
+		policyDtos = append(policyDtos, PolicyToPolicyDto(policy))
+	}
+	return policyDtos
+}
@@ -13,6 +13,7 @@ func RoleToRoleDto(role *models.Role) *models.RoleDto {
 		ID:          role.ID.String(),
 		Name:        role.Name,
 		Application: ApplicationToApplicationDto(role.Application),
+		Composites:  RolesToRoleDtos(role.Composites),
 	}
 }
 
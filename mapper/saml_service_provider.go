@@ -0,0 +1,33 @@
+package mapper
+
+import (
+	"auth-server/models"
+	"time"
+)
+
+func SAMLServiceProviderToSAMLServiceProviderDto(provider *models.SAMLServiceProvider) *models.SAMLServiceProviderDto {
+	dto := &models.SAMLServiceProviderDto{
+		ID:                provider.ID.String(),
+		Name:              provider.Name,
+		EntityID:          provider.EntityID,
+		Disabled:          provider.Disabled,
+		MetadataURL:       provider.MetadataURL,
+		NameIDFormat:      provider.NameIDFormat,
+		Application:       ApplicationToApplicationDto(provider.Application),
+		AttributeMappings: provider.AttributeMappings,
+		Created:           provider.CreatedAt.Format(time.RFC3339),
+		Updated:           provider.UpdatedAt.Format(time.RFC3339),
+	}
+	if dto.AttributeMappings == nil {
+		dto.AttributeMappings = make([]*models.SAMLAttributeMapping, 0)
+	}
+	return dto
+}
+
+func SAMLServiceProvidersToSAMLServiceProviderDtos(providers []*models.SAMLServiceProvider) []*models.SAMLServiceProviderDto {
+	dtos := make([]*models.SAMLServiceProviderDto, 0)
+	for _, provider := range providers {
+		dtos = append(dtos, SAMLServiceProviderToSAMLServiceProviderDto(provider))
+	}
+	return dtos
+}
@@ -0,0 +1,84 @@
+package mapper
+
+import (
+	"auth-server/models"
+	"time"
+)
+
+// UserToSCIMUser returns the SCIM representation of the user, along with its
+// roles and groups. baseURI is the URI of the SCIM endpoints, resource
+// locations are relative to.
+func UserToSCIMUser(user *models.User, baseURI string) *models.SCIMUser {
+	active := user.Enabled
+	resource := &models.SCIMUser{
+		Schemas:  []string{models.SCIM_SCHEMA_USER},
+		ID:       user.ID.String(),
+		UserName: user.Username,
+		Active:   &active,
+		Meta: &models.SCIMMeta{
+			ResourceType: "User",
+			Created:      user.CreatedAt.Format(time.RFC3339),
+			LastModified: user.UpdatedAt.Format(time.RFC3339),
+			Location:     baseURI + "/Users/" + user.ID.String(),
+		},
+	}
+	if user.Email != "" {
+		resource.Emails = []*models.SCIMMultiValue{{Value: user.Email, Primary: true}}
+	}
+	for _, group := range user.Groups {
+		resource.Groups = append(resource.Groups, &models.SCIMMultiValue{
+			Value:   group.ID.String(),
+			Display: group.Name,
+			Type:    "direct",
+			Ref:     baseURI + "/Groups/" + group.ID.String(),
+		})
+	}
+	for _, role := range user.Roles {
+		resource.Roles = append(resource.Roles, &models.SCIMMultiValue{
+			Value:   role.ID.String(),
+			Display: role.Name,
+		})
+	}
+	return resource
+}
+
+func UsersToSCIMUsers(users []*models.User, baseURI string) []*models.SCIMUser {
+	resources := make([]*models.SCIMUser, 0)
+	for _, user := range users {
+		resources = append(resources, UserToSCIMUser(user, baseURI))
+	}
+	return resources
+}
+
+// GroupToSCIMGroup returns the SCIM representation of the group, along with
+// its members.
+func GroupToSCIMGroup(group *models.Group, baseURI string) *models.SCIMGroup {
+	resource := &models.SCIMGroup{
+		Schemas:     []string{models.SCIM_SCHEMA_GROUP},
+		ID:          group.ID.String(),
+		DisplayName: group.Name,
+		Meta: &models.SCIMMeta{
+			ResourceType: "Group",
+			Created:      group.CreatedAt.Format(time.RFC3339),
+			LastModified: group.UpdatedAt.Format(time.RFC3339),
+			Location:     baseURI + "/Groups/" + group.ID.String(),
+		},
+	}
+	for _, member := range group.Members {
+		resource.Members = append(resource.Members, &models.SCIMMultiValue{
+			Value:   member.ID.String(),
+			Display: member.Username,
+			Type:    "User",
+			Ref:     baseURI + "/Users/" + member.ID.String(),
+		})
+	}
+	return resource
+}
+
+func GroupsToSCIMGroups(groups []*models.Group, baseURI string) []*models.SCIMGroup {
+	resources := make([]*models.SCIMGroup, 0)
+	for _, group := range groups {
+		resources = append(resources, GroupToSCIMGroup(group, baseURI))
+	}
+	return resources
+}
@@ -0,0 +1,27 @@
+package mapper
+
+import (
+	"auth-server/models"
+	"time"
+)
+
+func SessionToSessionDto(session *models.Session) *models.SessionDto {
+	return &models.SessionDto{
+		ID:          session.ID.String(),
+		IPAddress:   session.IPAddress,
+		UserAgent:   session.UserAgent,
+		AuthMethods: session.AuthMethods,
+		AuthTime:    session.AuthTime.Format(time.RFC3339),
+		Created:     session.CreatedAt.Format(time.RFC3339),
+		LastSeen:    session.LastSeenAt.Format(time.RFC3339),
+		ExpiresAt:   session.ExpiresAt.Format(time.RFC3339),
+	}
+}
+
+func SessionsToSessionDtos(sessions []*models.Session) []*models.SessionDto {
+	dtos := make([]*models.SessionDto, 0)
+	for _, session := range sessions {
+		dtos = append(dtos, SessionToSessionDto(session))
+	}
+	return dtos
+}
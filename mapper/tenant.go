@@ -0,0 +1,26 @@
+package mapper
+
+import (
+	"auth-server/models"
+	"time"
+)
+
+func TenantToTenantDto(tenant *models.Tenant) *models.TenantDto {
+	return &models.TenantDto{
+		ID:          tenant.ID.String(),
+		Name:        tenant.Name,
+		DisplayName: tenant.DisplayName,
+		Host:        tenant.Host,
+		Disabled:    tenant.Disabled,
+		Created:     tenant.CreatedAt.Format(time.RFC3339),
+		Updated:     tenant.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+func TenantsToTenantDtos(tenants []*models.Tenant) []*models.TenantDto {
+	dtos := make([]*models.TenantDto, 0)
+	for _, tenant := range tenants {
+		dtos = append(dtos, TenantToTenantDto(tenant))
+	}
+	return dtos
+}
@@ -0,0 +1,22 @@
+package mapper
+
+import (
+	"auth-server/models"
+	"strings"
+)
+
+func PayloadToIntrospectionResponse(payload *models.Payload, tokenType string) *models.IntrospectionResponse {
+	return &models.IntrospectionResponse{
+		Active:    true,
+		Scope:     strings.Join(payload.Scope, " "),
+		TokenType: tokenType,
+		Exp:       payload.Exp,
+		Iat:       payload.Iat,
+		Sub:       payload.Sub,
+		Aud:       payload.Aud,
+		Iss:       payload.Iss,
+		Jti:       payload.Jti,
+		Act:       payload.Act,
+		Cnf:       payload.Cnf,
+	}
+}
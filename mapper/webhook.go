@@ -0,0 +1,79 @@
+package mapper
+
+import (
+	"auth-server/models"
+	"encoding/json"
+	"time"
+)
+
+func WebhookToWebhookDto(webhook *models.Webhook) *models.WebhookDto {
+	dto := &models.WebhookDto{
+		ID:       webhook.ID.String(),
+		Name:     webhook.Name,
+		URL:      webhook.URL,
+		Events:   webhook.Events,
+		Disabled: webhook.Disabled,
+		Created:  webhook.CreatedAt.Format(time.RFC3339),
+		Updated:  webhook.UpdatedAt.Format(time.RFC3339),
+	}
+	if dto.Events == nil {
+		dto.Events = make([]string, 0)
+	}
+	return dto
+}
+
+func WebhooksToWebhookDtos(webhooks []*models.Webhook) []*models.WebhookDto {
+	dtos := make([]*models.WebhookDto, 0)
+	for _, webhook := range webhooks {
+		dtos = append(dtos, WebhookToWebhookDto(webhook))
+	}
+	return dtos
+}
+
+func WebhookDeliveryToWebhookDeliveryDto(delivery *models.WebhookDelivery) *models.WebhookDeliveryDto {
+	dto := &models.WebhookDeliveryDto{
+		ID:             delivery.ID,
+		EventID:        delivery.EventID,
+		EventType:      delivery.EventType,
+		Status:         delivery.Status,
+		Attempts:       delivery.Attempts,
+		ResponseStatus: delivery.ResponseStatus,
+		LastError:      delivery.LastError,
+		Created:        delivery.CreatedAt.Format(time.RFC3339),
+		Payload:        json.RawMessage(delivery.Payload),
+	}
+	if delivery.LastAttemptAt != nil {
+		dto.LastAttempt = delivery.LastAttemptAt.Format(time.RFC3339)
+	}
+	if delivery.Status == models.WEBHOOK_DELIVERY_PENDING {
+		dto.NextAttempt = delivery.NextAttemptAt.Format(time.RFC3339)
+	}
+	return dto
+}
+
+func WebhookDeliveriesToWebhookDeliveryDtos(deliveries []*models.WebhookDelivery) []*models.WebhookDeliveryDto {
+	dtos := make([]*models.WebhookDeliveryDto, 0)
+	for _, delivery := range deliveries {
+		dtos = append(dtos, WebhookDeliveryToWebhookDeliveryDto(delivery))
+	}
+	return dtos
+}
+
+func RoleToRoleEvent(role *models.Role) *models.RoleEvent {
+	return &models.RoleEvent{
+		Role:        RoleToRoleDto(role),
+		Permissions: PermissionsToPermissionDtos(role.Permissions),
+	}
+}
+
+func PayloadToTokenEvent(payload *models.Payload, clientId string, grantType string) *models.TokenEvent {
+	return &models.TokenEvent{
+		ClientID:  clientId,
+		GrantType: grantType,
+		Subject:   payload.Sub,
+		Audience:  payload.Aud,
+		Scope:     payload.Scope,
+		TokenID:   payload.Jti,
+		ExpiresAt: payload.Exp,
+	}
+}
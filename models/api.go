@@ -1,5 +1,7 @@
 package models
 
+import "encoding/json"
+
 type SignupRequest struct {
 	Email    string `json:"email"`
 	Username string `json:"username"`
@@ -29,18 +31,48 @@ type RoleDto struct {
 	ID          string          `json:"id"`
 	Name        string          `json:"name"`
 	Application *ApplicationDto `json:"application"`
+	Composites  []*RoleDto      `json:"composites,omitempty"`
+}
+
+type RoleCompositesRequest struct {
+	Roles []string `json:"roles"`
+}
+
+type RolePermissionsRequest struct {
+	Permissions []uint `json:"permissions"`
 }
 
 type PermissionRequest struct {
-	ID     uint   `json:"id"`
-	Name   string `json:"name"`
-	RoleID string `json:"role_id"`
+	ID      uint     `json:"id"`
+	Name    string   `json:"name"`
+	RoleIDs []string `json:"role_ids"`
 }
 
 type PermissionDto struct {
-	ID   uint     `json:"id"`
-	Name string   `json:"name"`
-	Role *RoleDto `json:"role"`
+	ID    uint       `json:"id"`
+	Name  string     `json:"name"`
+	Roles []*RoleDto `json:"roles,omitempty"`
+}
+
+type GroupRequest struct {
+	Name     string `json:"name"`
+	ParentID string `json:"parent_id"`
+}
+
+type GroupDto struct {
+	ID        string      `json:"id"`
+	Name      string      `json:"name"`
+	ParentID  string      `json:"parent_id,omitempty"`
+	Subgroups []*GroupDto `json:"subgroups,omitempty"`
+	Roles     []*RoleDto  `json:"roles,omitempty"`
+}
+
+type GroupMembersRequest struct {
+	Users []string `json:"users"`
+}
+
+type GroupRolesRequest struct {
+	Roles []string `json:"roles"`
 }
 
 type ApplicationRequest struct {
@@ -53,29 +85,435 @@ type ApplicationDto struct {
 }
 
 type ClientDto struct {
-	ID          string `json:"id"`
-	ClientName  string `json:"name"`
-	RedirectURI string `json:"redirect_uri"`
+	ID                      string         `json:"id"`
+	ClientName              string         `json:"name"`
+	ClientType              string         `json:"client_type"`
+	Enabled                 bool           `json:"enabled"`
+	FirstParty              bool           `json:"first_party"`
+	RedirectURIs            []string       `json:"redirect_uris"`
+	PostLogoutRedirectURIs  []string       `json:"post_logout_redirect_uris"`
+	BackchannelLogoutURI    string         `json:"backchannel_logout_uri,omitempty"`
+	FrontchannelLogoutURI   string         `json:"frontchannel_logout_uri,omitempty"`
+	LogoutSessionRequired   bool           `json:"logout_session_required"`
+	AllowedOrigins          []string       `json:"allowed_origins"`
+	GrantTypes              []string       `json:"grant_types"`
+	ResponseTypes           []string       `json:"response_types"`
+	Scope                   string         `json:"scope,omitempty"`
+	Contacts                []string       `json:"contacts,omitempty"`
+	ClientURI               string         `json:"client_uri,omitempty"`
+	LogoURI                 string         `json:"logo_uri,omitempty"`
+	AccessTokenLifetime     int            `json:"access_token_lifetime"`
+	RefreshTokenLifetime    int            `json:"refresh_token_lifetime"`
+	TokenEndpointAuthMethod string         `json:"token_endpoint_auth_method"`
+	JwksURI                 string         `json:"jwks_uri,omitempty"`
+	Jwks                    *JSONWebKeySet `json:"jwks,omitempty"`
+
+	TlsClientAuthSubjectDN string `json:"tls_client_auth_subject_dn,omitempty"`
+	TlsClientAuthSanDNS    string `json:"tls_client_auth_san_dns,omitempty"`
+	TlsClientAuthSanURI    string `json:"tls_client_auth_san_uri,omitempty"`
+	TlsClientAuthSanIP     string `json:"tls_client_auth_san_ip,omitempty"`
+	TlsClientAuthSanEmail  string `json:"tls_client_auth_san_email,omitempty"`
+	CertificateBoundTokens bool   `json:"tls_client_certificate_bound_access_tokens"`
+}
+
+// ClientRequest is the body of requests creating or replacing a client. The
+// client type defaults to public for clients that do not authenticate, and to
+// confidential otherwise. New clients are enabled unless Enabled is false, and
+// replaced clients stay enabled or disabled unless Enabled is set.
+type ClientRequest struct {
+	ClientName              string         `json:"name"`
+	ClientType              string         `json:"client_type"`
+	Enabled                 *bool          `json:"enabled"`
+	FirstParty              bool           `json:"first_party"`
+	RedirectURIs            []string       `json:"redirect_uris"`
+	PostLogoutRedirectURIs  []string       `json:"post_logout_redirect_uris"`
+	BackchannelLogoutURI    string         `json:"backchannel_logout_uri"`
+	FrontchannelLogoutURI   string         `json:"frontchannel_logout_uri"`
+	LogoutSessionRequired   bool           `json:"logout_session_required"`
+	AllowedOrigins          []string       `json:"allowed_origins"`
+	GrantTypes              []string       `json:"grant_types"`
+	ResponseTypes           []string       `json:"response_types"`
+	Scope                   string         `json:"scope"`
+	Contacts                []string       `json:"contacts"`
+	ClientURI               string         `json:"client_uri"`
+	LogoURI                 string         `json:"logo_uri"`
+	AccessTokenLifetime     int            `json:"access_token_lifetime"`
+	RefreshTokenLifetime    int            `json:"refresh_token_lifetime"`
+	TokenEndpointAuthMethod string         `json:"token_endpoint_auth_method"`
+	JwksURI                 string         `json:"jwks_uri"`
+	Jwks                    *JSONWebKeySet `json:"jwks"`
+
+	TlsClientAuthSubjectDN string `json:"tls_client_auth_subject_dn"`
+	TlsClientAuthSanDNS    string `json:"tls_client_auth_san_dns"`
+	TlsClientAuthSanURI    string `json:"tls_client_auth_san_uri"`
+	TlsClientAuthSanIP     string `json:"tls_client_auth_san_ip"`
+	TlsClientAuthSanEmail  string `json:"tls_client_auth_san_email"`
+	CertificateBoundTokens bool   `json:"tls_client_certificate_bound_access_tokens"`
+}
+
+// ClientSecretRequest is the body of requests generating a client secret.
+// ExpiresIn is the lifetime of the new secret in seconds, zero meaning it
+// never expires. GracePeriod is how long, in seconds, the client's other
+// secrets remain valid, defaulting to a week.
+type ClientSecretRequest struct {
+	ExpiresIn   int  `json:"expires_in"`
+	GracePeriod *int `json:"grace_period"`
+}
+
+// ClientSecretDto describes a client secret. The secret itself is only
+// returned once, when it is generated.
+type ClientSecretDto struct {
+	ID        string `json:"id"`
+	Secret    string `json:"secret,omitempty"`
+	Active    bool   `json:"active"`
+	CreatedAt string `json:"created_at"`
+	ExpiresAt string `json:"expires_at,omitempty"`
+	RevokedAt string `json:"revoked_at,omitempty"`
+}
+
+// ClientMetadata holds the client metadata defined by RFC 7591, section 2,
+// along with the mutual-TLS metadata defined by RFC 8705, section 2 and the
+// logout metadata defined by OpenID Connect RP-Initiated, Front-Channel and
+// Back-Channel Logout. Either of the session_required parameters sets
+// LogoutSessionRequired on the client.
+type ClientMetadata struct {
+	RedirectURIs              []string       `json:"redirect_uris"`
+	PostLogoutRedirectURIs    []string       `json:"post_logout_redirect_uris,omitempty"`
+	BackchannelLogoutURI      string         `json:"backchannel_logout_uri,omitempty"`
+	BackchannelLogoutSession  bool           `json:"backchannel_logout_session_required,omitempty"`
+	FrontchannelLogoutURI     string         `json:"frontchannel_logout_uri,omitempty"`
+	FrontchannelLogoutSession bool           `json:"frontchannel_logout_session_required,omitempty"`
+	TokenEndpointAuthMethod   string         `json:"token_endpoint_auth_method"`
+	GrantTypes                []string       `json:"grant_types"`
+	ResponseTypes             []string       `json:"response_types"`
+	ClientName                string         `json:"client_name,omitempty"`
+	ClientURI                 string         `json:"client_uri,omitempty"`
+	LogoURI                   string         `json:"logo_uri,omitempty"`
+	Scope                     string         `json:"scope,omitempty"`
+	Contacts                  []string       `json:"contacts,omitempty"`
+	JwksURI                   string         `json:"jwks_uri,omitempty"`
+	Jwks                      *JSONWebKeySet `json:"jwks,omitempty"`
+
+	TlsClientAuthSubjectDN string `json:"tls_client_auth_subject_dn,omitempty"`
+	TlsClientAuthSanDNS    string `json:"tls_client_auth_san_dns,omitempty"`
+	TlsClientAuthSanURI    string `json:"tls_client_auth_san_uri,omitempty"`
+	TlsClientAuthSanIP     string `json:"tls_client_auth_san_ip,omitempty"`
+	TlsClientAuthSanEmail  string `json:"tls_client_auth_san_email,omitempty"`
+	CertificateBoundTokens bool   `json:"tls_client_certificate_bound_access_tokens,omitempty"`
+}
+
+// ClientRegistrationRequest is the body of registration and client update
+// requests. Update requests must carry the id of the client being updated.
+type ClientRegistrationRequest struct {
+	ClientID string `json:"client_id,omitempty"`
+	ClientMetadata
+}
+
+// ClientRegistrationResponse describes a registered client, see RFC 7591,
+// section 3.2.1 and RFC 7592, section 3. The registration access token and
+// client secret are only returned when they are issued.
+type ClientRegistrationResponse struct {
+	ClientID                string `json:"client_id"`
+	ClientIDIssuedAt        int64  `json:"client_id_issued_at"`
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+	RegistrationClientURI   string `json:"registration_client_uri"`
+	ClientSecret            string `json:"client_secret,omitempty"`
+	ClientSecretExpiresAt   *int64 `json:"client_secret_expires_at,omitempty"`
+	ClientMetadata
 }
 
 type TokenRequest struct {
-	GrantType string `json:"grant_type"`
-	ClientId  string `json:"client_id"`
-	Aud       string `json:"aud"`
-	Scope     string `json:"scope"`
+	GrantType  string `json:"grant_type"`
+	ClientId   string `json:"client_id"`
+	Aud        string `json:"aud"`
+	Scope      string `json:"scope"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	DeviceCode string `json:"device_code"`
+
+	// Authorization code and refresh token grant parameters, see RFC 6749,
+	// sections 4.1.3 and 6, and RFC 7636, section 4.5.
+	Code         string `json:"code"`
+	RedirectURI  string `json:"redirect_uri"`
+	CodeVerifier string `json:"code_verifier"`
+	RefreshToken string `json:"refresh_token"`
+
+	// Token exchange parameters, see RFC 8693, section 2.1.
+	Audience           string `json:"audience"`
+	SubjectToken       string `json:"subject_token"`
+	SubjectTokenType   string `json:"subject_token_type"`
+	ActorToken         string `json:"actor_token"`
+	ActorTokenType     string `json:"actor_token_type"`
+	RequestedTokenType string `json:"requested_token_type"`
+
+	// Client authentication with a JWT assertion, see RFC 7523, section 2.2.
+	ClientAssertionType string `json:"client_assertion_type"`
+	ClientAssertion     string `json:"client_assertion"`
+
+	// Client authentication with a secret in the request body, see RFC 6749, section 2.3.1.
+	ClientSecret string `json:"client_secret"`
 }
 
 type TokenResponse struct {
-	AccessToken string `json:"access_token"`
-	TokenType   string `json:"token_type"`
+	AccessToken     string `json:"access_token"`
+	TokenType       string `json:"token_type"`
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+	RefreshToken    string `json:"refresh_token,omitempty"`
+}
+
+type ClientAudiencesRequest struct {
+	Applications []string `json:"applications"`
+}
+
+// OAuthErrorResponse is the error response format defined by RFC 6749, section 5.2.
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+type DeviceAuthorizationRequest struct {
+	ClientId string `json:"client_id"`
+	Aud      string `json:"aud"`
+	Scope    string `json:"scope"`
+
+	// Confidential clients authenticate as they do at the token endpoint,
+	// see RFC 8628, section 3.1.
+	ClientAssertionType string `json:"client_assertion_type"`
+	ClientAssertion     string `json:"client_assertion"`
+	ClientSecret        string `json:"client_secret"`
+}
+
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+type DeviceVerificationRequest struct {
+	UserCode string `json:"user_code"`
+	Approve  bool   `json:"approve"`
+}
+
+type DeviceVerificationDto struct {
+	UserCode    string          `json:"user_code"`
+	Client      *ClientDto      `json:"client"`
+	Application *ApplicationDto `json:"application"`
+	Scope       string          `json:"scope"`
+	Status      string          `json:"status"`
+	ExpiresAt   string          `json:"expires_at"`
+}
+
+// AuthorizeRequest is an authorization request sent to the authorization
+// endpoint, see RFC 6749, section 4.1.1, and RFC 7636, section 4.3. Aud is
+// the application the requested token is for. Prompt is a space-separated
+// list of the prompt values defined by OpenID Connect Core, section 3.1.2.1,
+// and MaxAge the maximum time in seconds since the user last logged in.
+type AuthorizeRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientId            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	Aud                 string `json:"aud"`
+	Prompt              string `json:"prompt"`
+	MaxAge              *int   `json:"max_age"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+}
+
+// AuthorizeDecisionRequest carries the user's answer to a consent prompt,
+// along with the authorization request it is about and the challenge issued
+// with the prompt.
+type AuthorizeDecisionRequest struct {
+	AuthorizeRequest
+	Approve   bool   `json:"approve"`
+	Challenge string `json:"challenge"`
+}
+
+// ConsentPromptDto describes the client and scopes a user is asked to consent
+// to. Scopes holds every requested scope, and NewScopes the ones the user has
+// not consented to yet. The answer to the prompt must carry the Challenge back.
+type ConsentPromptDto struct {
+	Client      *ClientDto      `json:"client"`
+	Application *ApplicationDto `json:"application"`
+	Scopes      []string        `json:"scopes"`
+	NewScopes   []string        `json:"new_scopes"`
+	Challenge   string          `json:"challenge"`
+}
+
+// LogoutRequest is a logout request sent to the end session endpoint, see
+// OpenID Connect RP-Initiated Logout, section 2, without its id_token_hint.
+type LogoutRequest struct {
+	ClientId              string `json:"client_id"`
+	PostLogoutRedirectURI string `json:"post_logout_redirect_uri"`
+	State                 string `json:"state"`
+}
+
+// LogoutPromptDto asks the user to confirm they want to log out, when the
+// request does not show it comes from a client they logged in to. The
+// confirmation must be posted with the logout request and the Challenge.
+type LogoutPromptDto struct {
+	Client    *ClientDto `json:"client,omitempty"`
+	Challenge string     `json:"challenge"`
+}
+
+type ConsentDto struct {
+	ID      string     `json:"id"`
+	Client  *ClientDto `json:"client"`
+	Scopes  []string   `json:"scopes"`
+	Created string     `json:"created_at"`
+	Updated string     `json:"updated_at"`
+}
+
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type SessionDto struct {
+	ID          string   `json:"id"`
+	IPAddress   string   `json:"ip_address"`
+	UserAgent   string   `json:"user_agent"`
+	AuthMethods []string `json:"auth_methods"`
+	AuthTime    string   `json:"auth_time"`
+	Created     string   `json:"created_at"`
+	LastSeen    string   `json:"last_seen_at"`
+	ExpiresAt   string   `json:"expires_at"`
+}
+
+type IdentityProviderRequest struct {
+	Name         string                `json:"name"`
+	Type         string                `json:"type"`
+	Disabled     bool                  `json:"disabled"`
+	Issuer       string                `json:"issuer"`
+	ClientID     string                `json:"client_id"`
+	ClientSecret string                `json:"client_secret"`
+	Scopes       []string              `json:"scopes"`
+	MetadataURL  string                `json:"metadata_url"`
+	Metadata     string                `json:"metadata"`
+	EmailClaim   string                `json:"email_claim"`
+	LinkByEmail  bool                  `json:"link_by_email"`
+	RoleMappings []*RoleMappingRequest `json:"role_mappings"`
+
+	LDAPURL            string `json:"ldap_url"`
+	LDAPStartTLS       bool   `json:"ldap_start_tls"`
+	LDAPRootCAs        string `json:"ldap_root_cas"`
+	LDAPBindDN         string `json:"ldap_bind_dn"`
+	LDAPBindPassword   string `json:"ldap_bind_password"`
+	LDAPUserDNTemplate string `json:"ldap_user_dn_template"`
+	LDAPBaseDN         string `json:"ldap_base_dn"`
+	LDAPUserFilter     string `json:"ldap_user_filter"`
+	LDAPGroupBaseDN    string `json:"ldap_group_base_dn"`
+	LDAPGroupFilter    string `json:"ldap_group_filter"`
+}
+
+type RoleMappingRequest struct {
+	Claim  string `json:"claim"`
+	Value  string `json:"value"`
+	RoleId string `json:"role_id"`
+}
+
+type IdentityProviderDto struct {
+	ID           string            `json:"id"`
+	Name         string            `json:"name"`
+	Type         string            `json:"type"`
+	Disabled     bool              `json:"disabled"`
+	Issuer       string            `json:"issuer,omitempty"`
+	ClientID     string            `json:"client_id,omitempty"`
+	Scopes       []string          `json:"scopes,omitempty"`
+	MetadataURL  string            `json:"metadata_url,omitempty"`
+	EmailClaim   string            `json:"email_claim,omitempty"`
+	LinkByEmail  bool              `json:"link_by_email"`
+	RoleMappings []*RoleMappingDto `json:"role_mappings"`
+	Created      string            `json:"created_at"`
+	Updated      string            `json:"updated_at"`
+
+	LDAPURL            string `json:"ldap_url,omitempty"`
+	LDAPStartTLS       bool   `json:"ldap_start_tls,omitempty"`
+	LDAPRootCAs        string `json:"ldap_root_cas,omitempty"`
+	LDAPBindDN         string `json:"ldap_bind_dn,omitempty"`
+	LDAPUserDNTemplate string `json:"ldap_user_dn_template,omitempty"`
+	LDAPBaseDN         string `json:"ldap_base_dn,omitempty"`
+	LDAPUserFilter     string `json:"ldap_user_filter,omitempty"`
+	LDAPGroupBaseDN    string `json:"ldap_group_base_dn,omitempty"`
+	LDAPGroupFilter    string `json:"ldap_group_filter,omitempty"`
+}
+
+type RoleMappingDto struct {
+	ID    string   `json:"id"`
+	Claim string   `json:"claim"`
+	Value string   `json:"value"`
+	Role  *RoleDto `json:"role"`
+}
+
+// FederationProviderDto is the public view of an identity provider, listed
+// for login pages to offer.
+type FederationProviderDto struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	LoginURI string `json:"login_uri"`
+}
+
+type ExternalIdentityDto struct {
+	ID               string `json:"id"`
+	IdentityProvider string `json:"identity_provider"`
+	Subject          string `json:"subject"`
+	Email            string `json:"email"`
+	Created          string `json:"created_at"`
+	LastLogin        string `json:"last_login_at"`
+}
+
+type SAMLServiceProviderRequest struct {
+	Name              string                  `json:"name"`
+	Disabled          bool                    `json:"disabled"`
+	MetadataURL       string                  `json:"metadata_url"`
+	Metadata          string                  `json:"metadata"`
+	NameIDFormat      string                  `json:"name_id_format"`
+	ApplicationId     string                  `json:"application_id"`
+	AttributeMappings []*SAMLAttributeMapping `json:"attribute_mappings"`
+}
+
+type SAMLServiceProviderDto struct {
+	ID                string                  `json:"id"`
+	Name              string                  `json:"name"`
+	EntityID          string                  `json:"entity_id"`
+	Disabled          bool                    `json:"disabled"`
+	MetadataURL       string                  `json:"metadata_url,omitempty"`
+	NameIDFormat      string                  `json:"name_id_format"`
+	Application       *ApplicationDto         `json:"application"`
+	AttributeMappings []*SAMLAttributeMapping `json:"attribute_mappings"`
+	Created           string                  `json:"created_at"`
+	Updated           string                  `json:"updated_at"`
 }
 
 type IntrospectionRequest struct {
-	OpaqueToken string `json:"opaque_token"`
+	Token string `json:"token"`
+	// DPoP, Htm and Htu optionally carry the DPoP proof a resource server
+	// received with the token, along with the method and URI of that request,
+	// for the introspection endpoint to verify.
+	DPoP string `json:"dpop,omitempty"`
+	Htm  string `json:"htm,omitempty"`
+	Htu  string `json:"htu,omitempty"`
 }
 
+// IntrospectionResponse is the response of the introspection endpoint,
+// described in RFC 7662, section 2.2.
 type IntrospectionResponse struct {
-	Active bool `json:"active"`
+	Active    bool          `json:"active"`
+	Scope     string        `json:"scope,omitempty"`
+	TokenType string        `json:"token_type,omitempty"`
+	Exp       int64         `json:"exp,omitempty"`
+	Iat       int64         `json:"iat,omitempty"`
+	Sub       string        `json:"sub,omitempty"`
+	Aud       string        `json:"aud,omitempty"`
+	Iss       string        `json:"iss,omitempty"`
+	Jti       string        `json:"jti,omitempty"`
+	Act       *Actor        `json:"act,omitempty"`
+	Cnf       *Confirmation `json:"cnf,omitempty"`
 }
 
 type TokenInfoRequest struct {
@@ -86,6 +524,154 @@ type TokenInfoResponse struct {
 	Active bool `json:"active"`
 }
 
+type PolicyRequest struct {
+	Name          string           `json:"name"`
+	Description   string           `json:"description"`
+	ApplicationId string           `json:"application_id"`
+	Effect        string           `json:"effect"`
+	Resource      string           `json:"resource"`
+	Action        string           `json:"action"`
+	Conditions    PolicyConditions `json:"conditions"`
+}
+
+type PolicyDto struct {
+	ID          string           `json:"id"`
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Application *ApplicationDto  `json:"application"`
+	Effect      string           `json:"effect"`
+	Resource    string           `json:"resource"`
+	Action      string           `json:"action"`
+	Conditions  PolicyConditions `json:"conditions"`
+}
+
+type AuthorizationSubjectRequest struct {
+	Token  string `json:"token"`
+	UserId string `json:"user_id"`
+}
+
+type AuthorizationRequest struct {
+	Subject       AuthorizationSubjectRequest `json:"subject"`
+	ApplicationId string                      `json:"application_id"`
+	Resource      string                      `json:"resource"`
+	Action        string                      `json:"action"`
+	Context       map[string]interface{}      `json:"context"`
+}
+
+// AuthorizationRule describes the rule an authorization decision was based on.
+// Type is either "policy", "permission", "account" or "default".
+type AuthorizationRule struct {
+	Type string `json:"type"`
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+}
+
+// AuthorizationDecision is the outcome of an authorization request. Reason
+// explains decisions that were not based on the rules of the application.
+type AuthorizationDecision struct {
+	Decision string             `json:"decision"`
+	Allowed  bool               `json:"allowed"`
+	Rule     *AuthorizationRule `json:"rule"`
+	Reason   string             `json:"reason,omitempty"`
+}
+
 type ErrorResponse struct {
 	Messages []string `json:"message"`
 }
+
+type TenantRequest struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	Host        string `json:"host"`
+	Disabled    bool   `json:"disabled"`
+}
+
+type TenantDto struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	Host        string `json:"host,omitempty"`
+	Disabled    bool   `json:"disabled"`
+	Created     string `json:"created_at"`
+	Updated     string `json:"updated_at"`
+}
+
+type AuditEventDto struct {
+	ID           uint            `json:"id"`
+	Created      string          `json:"created_at"`
+	Actor        string          `json:"actor"`
+	Action       string          `json:"action"`
+	Target       string          `json:"target"`
+	IPAddress    string          `json:"ip_address"`
+	UserAgent    string          `json:"user_agent"`
+	Outcome      string          `json:"outcome"`
+	Reason       string          `json:"reason,omitempty"`
+	RequestID    string          `json:"request_id"`
+	Before       json.RawMessage `json:"before,omitempty"`
+	After        json.RawMessage `json:"after,omitempty"`
+	PreviousHash string          `json:"previous_hash,omitempty"`
+	Hash         string          `json:"hash,omitempty"`
+}
+
+// AuditEventPage is a page of the audit events matching a query, along with
+// the number of events matching it.
+type AuditEventPage struct {
+	Total  int64            `json:"total"`
+	Offset int              `json:"offset"`
+	Limit  int              `json:"limit"`
+	Events []*AuditEventDto `json:"events"`
+}
+
+// AuditVerification is the result of checking the hash chain of the audit
+// events. When the chain is broken, BrokenAt is the id of the first event
+// that does not match it.
+type AuditVerification struct {
+	Valid    bool   `json:"valid"`
+	Checked  int    `json:"checked"`
+	Chained  int    `json:"chained"`
+	BrokenAt uint   `json:"broken_at,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+type WebhookRequest struct {
+	Name     string   `json:"name"`
+	URL      string   `json:"url"`
+	Events   []string `json:"events"`
+	Secret   string   `json:"secret"`
+	Disabled bool     `json:"disabled"`
+}
+
+// WebhookDto is a webhook. Its secret is only returned when it is created.
+type WebhookDto struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	URL      string   `json:"url"`
+	Events   []string `json:"events"`
+	Secret   string   `json:"secret,omitempty"`
+	Disabled bool     `json:"disabled"`
+	Created  string   `json:"created_at"`
+	Updated  string   `json:"updated_at"`
+}
+
+type WebhookDeliveryDto struct {
+	ID             uint            `json:"id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	Created        string          `json:"created_at"`
+	LastAttempt    string          `json:"last_attempt_at,omitempty"`
+	NextAttempt    string          `json:"next_attempt_at,omitempty"`
+	Payload        json.RawMessage `json:"payload"`
+}
+
+// WebhookDeliveryPage is a page of the deliveries of a webhook, along with
+// the number of deliveries it has.
+type WebhookDeliveryPage struct {
+	Total      int64                 `json:"total"`
+	Offset     int                   `json:"offset"`
+	Limit      int                   `json:"limit"`
+	Deliveries []*WebhookDeliveryDto `json:"deliveries"`
+}
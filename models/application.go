@@ -2,11 +2,14 @@ package models
 
 import (
 	"encoding/json"
+
+	"github.com/google/uuid"
 )
 
 type Application struct {
 	BaseUUIDEntity
-	AppName string `json:"name" gorm:"unique"`
+	TenantID uuid.UUID `json:"tenant_id" gorm:"type:uuid;uniqueIndex:idx_applications_tenant_name"`
+	AppName  string    `json:"name" gorm:"uniqueIndex:idx_applications_tenant_name"`
 }
 
 func (a Application) ToJSON() ([]byte, error) {
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Audit event outcomes
+const (
+	AUDIT_OUTCOME_SUCCESS string = "success"
+	AUDIT_OUTCOME_FAILURE string = "failure"
+)
+
+// Audit event actions
+const (
+	AUDIT_ACTION_LOGIN                            string = "login"
+	AUDIT_ACTION_LOGOUT                           string = "logout"
+	AUDIT_ACTION_TOKEN_ISSUE                      string = "token.issue"
+	AUDIT_ACTION_USER_CREATE                      string = "user.create"
+	AUDIT_ACTION_USER_UPDATE                      string = "user.update"
+	AUDIT_ACTION_USER_DELETE                      string = "user.delete"
+	AUDIT_ACTION_USER_ROLES_ASSIGN                string = "user.roles.assign"
+	AUDIT_ACTION_USER_ROLES_ADD                   string = "user.roles.add"
+	AUDIT_ACTION_USER_IDENTITY_UNLINK             string = "user.identity.unlink"
+	AUDIT_ACTION_SESSION_TERMINATE                string = "session.terminate"
+	AUDIT_ACTION_USER_SESSIONS_TERMINATE          string = "user.sessions.terminate"
+	AUDIT_ACTION_ROLE_CREATE                      string = "role.create"
+	AUDIT_ACTION_ROLE_COMPOSITES_UPDATE           string = "role.composites.update"
+	AUDIT_ACTION_ROLE_PERMISSIONS_UPDATE          string = "role.permissions.update"
+	AUDIT_ACTION_PERMISSION_CREATE                string = "permission.create"
+	AUDIT_ACTION_APPLICATION_CREATE               string = "application.create"
+	AUDIT_ACTION_GROUP_CREATE                     string = "group.create"
+	AUDIT_ACTION_GROUP_UPDATE                     string = "group.update"
+	AUDIT_ACTION_GROUP_DELETE                     string = "group.delete"
+	AUDIT_ACTION_GROUP_MEMBERS_UPDATE             string = "group.members.update"
+	AUDIT_ACTION_GROUP_ROLES_UPDATE               string = "group.roles.update"
+	AUDIT_ACTION_CLIENT_CREATE                    string = "client.create"
+	AUDIT_ACTION_CLIENT_UPDATE                    string = "client.update"
+	AUDIT_ACTION_CLIENT_DELETE                    string = "client.delete"
+	AUDIT_ACTION_CLIENT_EXCHANGE_AUDIENCES_UPDATE string = "client.exchange_audiences.update"
+	AUDIT_ACTION_CLIENT_SECRET_CREATE             string = "client.secret.create"
+	AUDIT_ACTION_CLIENT_SECRET_REVOKE             string = "client.secret.revoke"
+	AUDIT_ACTION_POLICY_CREATE                    string = "policy.create"
+	AUDIT_ACTION_POLICY_DELETE                    string = "policy.delete"
+	AUDIT_ACTION_IDENTITY_PROVIDER_CREATE         string = "identity_provider.create"
+	AUDIT_ACTION_IDENTITY_PROVIDER_UPDATE         string = "identity_provider.update"
+	AUDIT_ACTION_IDENTITY_PROVIDER_DELETE         string = "identity_provider.delete"
+	AUDIT_ACTION_SAML_ASSERTION_ISSUE             string = "saml_assertion.issue"
+	AUDIT_ACTION_SAML_SP_CREATE                   string = "saml_service_provider.create"
+	AUDIT_ACTION_SAML_SP_UPDATE                   string = "saml_service_provider.update"
+	AUDIT_ACTION_SAML_SP_DELETE                   string = "saml_service_provider.delete"
+	AUDIT_ACTION_TENANT_CREATE                    string = "tenant.create"
+	AUDIT_ACTION_TENANT_UPDATE                    string = "tenant.update"
+	AUDIT_ACTION_TENANT_DELETE                    string = "tenant.delete"
+	AUDIT_ACTION_WEBHOOK_CREATE                   string = "webhook.create"
+	AUDIT_ACTION_WEBHOOK_UPDATE                   string = "webhook.update"
+	AUDIT_ACTION_WEBHOOK_DELETE                   string = "webhook.delete"
+)
+
+// AuditEvent records a security-relevant action: who performed it, on what,
+// from where and as part of which request, whether it succeeded, and the
+// state of its target before and after it, as JSON documents.
+//
+// Events are only ever appended. When hash chaining is enabled, each event
+// holds the hash of the previous event of its realm, and its own hash covers
+// that hash along with its content, so that altering, removing or reordering
+// events breaks the chain.
+type AuditEvent struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt    time.Time `json:"created_at" gorm:"index"`
+	TenantID     uuid.UUID `json:"tenant_id" gorm:"type:uuid;index"`
+	Actor        string    `json:"actor" gorm:"index"`
+	Action       string    `json:"action" gorm:"index"`
+	Target       string    `json:"target" gorm:"index"`
+	IPAddress    string    `json:"ip_address"`
+	UserAgent    string    `json:"user_agent"`
+	Outcome      string    `json:"outcome"`
+	Reason       string    `json:"reason"`
+	RequestID    string    `json:"request_id" gorm:"index"`
+	Before       string    `json:"before" gorm:"type:text"`
+	After        string    `json:"after" gorm:"type:text"`
+	PreviousHash string    `json:"previous_hash"`
+	Hash         string    `json:"hash"`
+}
+
+// ComputeHash returns the hex-encoded SHA-256 digest of the event's content
+// and previous hash. The id of the event and its realm are left out, as they
+// are only known once the event is stored.
+func (e *AuditEvent) ComputeHash() string {
+	content, _ := json.Marshal([]string{
+		e.PreviousHash,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+		e.Actor,
+		e.Action,
+		e.Target,
+		e.IPAddress,
+		e.UserAgent,
+		e.Outcome,
+		e.Reason,
+		e.RequestID,
+		e.Before,
+		e.After,
+	})
+	digest := sha256.Sum256(content)
+	return hex.EncodeToString(digest[:])
+}
+
+// AuditFilter selects audit events. Blank fields match any event.
+type AuditFilter struct {
+	Actor     string
+	Action    string
+	Target    string
+	Outcome   string
+	RequestID string
+	Since     time.Time
+	Until     time.Time
+}
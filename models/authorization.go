@@ -0,0 +1,57 @@
+package models
+
+// AuthorizationAttributes are the attributes of an authorization request that
+// policies are evaluated against, keyed by attribute name.
+type AuthorizationAttributes map[string]interface{}
+
+// AuthorizationSubject is the resolved subject of an authorization request.
+// Type is either "user" or "client". Inactive is set for users whose account
+// is not active, who are denied everything.
+type AuthorizationSubject struct {
+	ID            string
+	Type          string
+	Inactive      bool
+	ApplicationID string
+	Username      string
+	Email         string
+	Scope         []string
+	Roles         []string
+	Permissions   []string
+}
+
+// NewAuthorizationAttributes collects the attributes of a request made by the
+// subject to perform the action on the resource.
+func NewAuthorizationAttributes(subject *AuthorizationSubject, resource string, action string, context map[string]interface{}) AuthorizationAttributes {
+	attributes := AuthorizationAttributes{
+		"subject.id":          subject.ID,
+		"subject.type":        subject.Type,
+		"subject.application": subject.ApplicationID,
+		"subject.roles":       subject.Roles,
+		"subject.permissions": subject.Permissions,
+		"resource":            resource,
+		"action":              action,
+	}
+	if subject.Username != "" {
+		attributes["subject.username"] = subject.Username
+	}
+	if subject.Email != "" {
+		attributes["subject.email"] = subject.Email
+	}
+	if subject.Scope != nil {
+		attributes["subject.scope"] = subject.Scope
+	}
+	for key, value := range context {
+		attributes["context."+key] = value
+	}
+	return attributes
+}
+
+func (a AuthorizationAttributes) Resource() string {
+	resource, _ := a["resource"].(string)
+	return resource
+}
+
+func (a AuthorizationAttributes) Action() string {
+	action, _ := a["action"].(string)
+	return action
+}
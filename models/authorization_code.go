@@ -0,0 +1,88 @@
+package models
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PKCE code challenge methods, see RFC 7636, section 4.2
+const (
+	CODE_CHALLENGE_METHOD_PLAIN string = "plain"
+	CODE_CHALLENGE_METHOD_S256  string = "S256"
+)
+
+// AuthorizationCode is issued to a client once the user authorized its request
+// at the authorization endpoint, and exchanged for tokens at the token
+// endpoint, as described in RFC 6749, section 4.1. The code can only be
+// redeemed by the client it was issued to, with the same redirect URI and,
+// when the request carried a PKCE code challenge, with the matching code
+// verifier. SessionID is the login session the user authorized the request
+// in, and AuthTime when they last logged in before authorizing it. Only the
+// SHA-256 digest of the code is stored.
+type AuthorizationCode struct {
+	BaseUUIDEntity
+	CodeHash            string    `json:"-" gorm:"unique"`
+	ClientID            uuid.UUID `json:"client_id" gorm:"type:uuid;index"`
+	ApplicationID       uuid.UUID `json:"application_id" gorm:"type:uuid"`
+	UserID              uuid.UUID `json:"user_id" gorm:"type:uuid"`
+	RedirectURI         string    `json:"redirect_uri"`
+	Scope               string    `json:"scope"`
+	CodeChallenge       string    `json:"-"`
+	CodeChallengeMethod string    `json:"-"`
+	SessionID           uuid.UUID `json:"session_id" gorm:"type:uuid"`
+	AuthTime            time.Time `json:"auth_time"`
+	ExpiresAt           time.Time `json:"expires_at"`
+}
+
+// NewAuthorizationCode creates an authorization code the user issued to the
+// client for the application, and returns it along with the code itself.
+func NewAuthorizationCode(clientId uuid.UUID, applicationId uuid.UUID, userId uuid.UUID, redirectURI string, scope string, lifetime time.Duration) (*AuthorizationCode, string, error) {
+	code, err := randomString(32)
+	if err != nil {
+		return nil, "", err
+	}
+	return &AuthorizationCode{
+		BaseUUIDEntity: BaseUUIDEntity{
+			ID: uuid.New(),
+		},
+		CodeHash:      HashAuthorizationCode(code),
+		ClientID:      clientId,
+		ApplicationID: applicationId,
+		UserID:        userId,
+		RedirectURI:   redirectURI,
+		Scope:         scope,
+		ExpiresAt:     time.Now().Add(lifetime),
+	}, code, nil
+}
+
+// HashAuthorizationCode returns the digest an authorization code is stored as.
+func HashAuthorizationCode(code string) string {
+	digest := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(digest[:])
+}
+
+// IsExpired returns true if the authorization code can no longer be redeemed.
+func (a *AuthorizationCode) IsExpired() bool {
+	return time.Now().After(a.ExpiresAt)
+}
+
+// VerifyCodeVerifier checks the code verifier sent to the token endpoint
+// against the code challenge of the authorization request, as described in
+// RFC 7636, section 4.6. Codes issued without a challenge must be redeemed
+// without a verifier.
+func (a *AuthorizationCode) VerifyCodeVerifier(verifier string) bool {
+	if a.CodeChallenge == "" {
+		return verifier == ""
+	}
+	challenge := verifier
+	if a.CodeChallengeMethod == CODE_CHALLENGE_METHOD_S256 {
+		digest := sha256.Sum256([]byte(verifier))
+		challenge = base64.RawURLEncoding.EncodeToString(digest[:])
+	}
+	return verifier != "" && subtle.ConstantTimeCompare([]byte(challenge), []byte(a.CodeChallenge)) == 1
+}
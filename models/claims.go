@@ -0,0 +1,52 @@
+package models
+
+// ClaimsConfig controls how authorization data is embedded in issued tokens.
+// RolesClaim and PermissionsClaim are the claim names used for the lists,
+// MaxEntries is the combined number of entries allowed before the lists are
+// replaced by a reference to SourceEndpoint, following the distributed claims
+// format from OpenID Connect Core, section 5.6.2.
+type ClaimsConfig struct {
+	RolesClaim       string
+	PermissionsClaim string
+	MaxEntries       int
+	SourceEndpoint   string
+}
+
+// AuthorizationClaims holds the role and permission names a subject holds
+// within a single application.
+type AuthorizationClaims struct {
+	Roles       []string
+	Permissions []string
+}
+
+// authorizationClaimsSource is the name of the claim source used when the
+// authorization claims are too large to be embedded in the token.
+const authorizationClaimsSource = "authz"
+
+// ToMap returns the claims keyed by the configured claim names.
+func (c *AuthorizationClaims) ToMap(config *ClaimsConfig) map[string][]string {
+	return map[string][]string{
+		config.RolesClaim:       c.Roles,
+		config.PermissionsClaim: c.Permissions,
+	}
+}
+
+// AddAuthorizationClaims adds the roles and permissions to the payload using
+// the configured claim names. When the lists hold more than MaxEntries items
+// they are left out, and the payload references SourceEndpoint instead.
+func (p *Payload) AddAuthorizationClaims(claims *AuthorizationClaims, config *ClaimsConfig) {
+	if config.MaxEntries > 0 && len(claims.Roles)+len(claims.Permissions) > config.MaxEntries {
+		p.SetClaim("_claim_names", map[string]string{
+			config.RolesClaim:       authorizationClaimsSource,
+			config.PermissionsClaim: authorizationClaimsSource,
+		})
+		p.SetClaim("_claim_sources", map[string]interface{}{
+			authorizationClaimsSource: map[string]string{
+				"endpoint": config.SourceEndpoint,
+			},
+		})
+		return
+	}
+	p.SetClaim(config.RolesClaim, claims.Roles)
+	p.SetClaim(config.PermissionsClaim, claims.Permissions)
+}
@@ -1,15 +1,173 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Client types, see RFC 6749, section 2.1
+const (
+	CLIENT_TYPE_CONFIDENTIAL string = "confidential"
+	CLIENT_TYPE_PUBLIC       string = "public"
+)
+
+// Default token lifetimes, used unless the client overrides them
+const (
+	DEFAULT_ACCESS_TOKEN_LIFETIME  time.Duration = time.Hour
+	DEFAULT_REFRESH_TOKEN_LIFETIME time.Duration = 30 * 24 * time.Hour
+)
+
+// Client authentication methods at the token endpoint
+const (
+	CLIENT_AUTH_NONE                        string = "none"
+	CLIENT_AUTH_CLIENT_SECRET_BASIC         string = "client_secret_basic"
+	CLIENT_AUTH_CLIENT_SECRET_POST          string = "client_secret_post"
+	CLIENT_AUTH_PRIVATE_KEY_JWT             string = "private_key_jwt"
+	CLIENT_AUTH_TLS_CLIENT_AUTH             string = "tls_client_auth"
+	CLIENT_AUTH_SELF_SIGNED_TLS_CLIENT_AUTH string = "self_signed_tls_client_auth"
+)
+
+// Grant types clients may register, see RFC 7591, section 2
+const (
+	GRANT_TYPE_AUTHORIZATION_CODE string = "authorization_code"
+	GRANT_TYPE_REFRESH_TOKEN      string = "refresh_token"
+	GRANT_TYPE_CLIENT_CREDENTIALS string = "client_credentials"
+	GRANT_TYPE_PASSWORD           string = "password"
+	GRANT_TYPE_DEVICE_CODE        string = "urn:ietf:params:oauth:grant-type:device_code"
+	GRANT_TYPE_TOKEN_EXCHANGE     string = "urn:ietf:params:oauth:grant-type:token-exchange"
+)
+
+// Response types clients may register
+const (
+	RESPONSE_TYPE_CODE string = "code"
+)
+
+// Scopes granting access to the server's own APIs. Only administrators may
+// register clients with them.
+const (
+	SCOPE_SCIM  string = "scim"
+	SCOPE_ADMIN string = "admin"
 )
 
+// IsReservedScope returns true if only administrators may register clients
+// with the scope.
+func IsReservedScope(scope string) bool {
+	return scope == SCOPE_SCIM || scope == SCOPE_ADMIN
+}
+
+// Client is an application requesting tokens. Clients authenticating with
+// client_secret_basic or client_secret_post hold one or more Secrets. Clients
+// authenticating with private_key_jwt or self_signed_tls_client_auth register
+// their public keys or certificates either inline, in Jwks, or as a JwksURI
+// the keys are fetched from. Clients authenticating with tls_client_auth
+// register the expected subject of their certificate in exactly one of the
+// TlsClientAuth fields, as described in RFC 8705, section 2.1.2.
+//
+// Public clients cannot keep credentials confidential and do not authenticate.
+// Disabled clients cannot obtain tokens, and clients can only use the grant
+// types they registered. First-party clients are operated by the server's
+// owner, and users are not asked to consent to their requests. Token
+// lifetimes are in seconds; zero means the server default.
+//
+// Clients are notified when users log out of a session they took part in,
+// either with a logout token sent to their BackchannelLogoutURI, or by the
+// browser loading their FrontchannelLogoutURI, as described in OpenID Connect
+// Back-Channel Logout and Front-Channel Logout. LogoutSessionRequired is set
+// by clients that need the session id to be sent along.
+//
+// Clients registered dynamically can manage their own registration with the
+// registration access token they were issued, of which only a hash is kept.
 type Client struct {
 	BaseUUIDEntity
-	ClientName  string `json:"name" gorm:"unique"`
-	RedirectURI string `json:"redirect_uri"`
+	TenantID                uuid.UUID      `json:"tenant_id" gorm:"type:uuid;uniqueIndex:idx_clients_tenant_name"`
+	ClientName              string         `json:"name" gorm:"uniqueIndex:idx_clients_tenant_name"`
+	ClientType              string         `json:"client_type"`
+	Disabled                bool           `json:"disabled"`
+	FirstParty              bool           `json:"first_party"`
+	RedirectURIs            StringList     `json:"redirect_uris" gorm:"type:jsonb"`
+	PostLogoutRedirectURIs  StringList     `json:"post_logout_redirect_uris" gorm:"type:jsonb"`
+	BackchannelLogoutURI    string         `json:"backchannel_logout_uri"`
+	FrontchannelLogoutURI   string         `json:"frontchannel_logout_uri"`
+	LogoutSessionRequired   bool           `json:"logout_session_required"`
+	AllowedOrigins          StringList     `json:"allowed_origins" gorm:"type:jsonb"`
+	GrantTypes              StringList     `json:"grant_types" gorm:"type:jsonb"`
+	ResponseTypes           StringList     `json:"response_types" gorm:"type:jsonb"`
+	Scope                   string         `json:"scope"`
+	Contacts                StringList     `json:"contacts" gorm:"type:jsonb"`
+	ClientURI               string         `json:"client_uri"`
+	LogoURI                 string         `json:"logo_uri"`
+	AccessTokenLifetime     int            `json:"access_token_lifetime"`
+	RefreshTokenLifetime    int            `json:"refresh_token_lifetime"`
+	ExchangeAudiences       []*Application `json:"exchange_audiences" gorm:"many2many:client_exchange_audiences;"`
+	TokenEndpointAuthMethod string         `json:"token_endpoint_auth_method" gorm:"default:none"`
+	JwksURI                 string         `json:"jwks_uri"`
+	Jwks                    *JSONWebKeySet `json:"jwks" gorm:"type:jsonb"`
+
+	TlsClientAuthSubjectDN string `json:"tls_client_auth_subject_dn"`
+	TlsClientAuthSanDNS    string `json:"tls_client_auth_san_dns"`
+	TlsClientAuthSanURI    string `json:"tls_client_auth_san_uri"`
+	TlsClientAuthSanIP     string `json:"tls_client_auth_san_ip"`
+	TlsClientAuthSanEmail  string `json:"tls_client_auth_san_email"`
+	CertificateBoundTokens bool   `json:"tls_client_certificate_bound_access_tokens"`
+
+	Secrets                     []*ClientSecret `json:"-" gorm:"foreignKey:ClientID"`
+	RegistrationAccessTokenHash string          `json:"-"`
 }
 
 func (c Client) ToJSON() ([]byte, error) {
 	return json.Marshal(c)
 }
+
+// CanExchangeTo returns true if the client may exchange tokens for tokens
+// whose audience is the application with the given id.
+func (c *Client) CanExchangeTo(applicationId string) bool {
+	for _, app := range c.ExchangeAudiences {
+		if app.ID.String() == applicationId {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPublic returns true if the client is a public client.
+func (c *Client) IsPublic() bool {
+	return c.ClientType == CLIENT_TYPE_PUBLIC
+}
+
+// AccessTokenTTL returns the lifetime of the access tokens issued to the client.
+func (c *Client) AccessTokenTTL() time.Duration {
+	if c.AccessTokenLifetime > 0 {
+		return time.Duration(c.AccessTokenLifetime) * time.Second
+	}
+	return DEFAULT_ACCESS_TOKEN_LIFETIME
+}
+
+// RefreshTokenTTL returns the lifetime of the refresh tokens issued to the client.
+func (c *Client) RefreshTokenTTL() time.Duration {
+	if c.RefreshTokenLifetime > 0 {
+		return time.Duration(c.RefreshTokenLifetime) * time.Second
+	}
+	return DEFAULT_REFRESH_TOKEN_LIFETIME
+}
+
+// HashRegistrationAccessToken returns the hex-encoded SHA-256 digest of a
+// registration access token, which is what gets persisted.
+func HashRegistrationAccessToken(token string) string {
+	digest := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(digest[:])
+}
+
+// NewRegistrationAccessToken returns a new random registration access token.
+func NewRegistrationAccessToken() (string, error) {
+	return randomString(32)
+}
+
+// UsesClientSecret returns true if the client authenticates with a secret.
+func (c *Client) UsesClientSecret() bool {
+	return c.TokenEndpointAuthMethod == CLIENT_AUTH_CLIENT_SECRET_BASIC ||
+		c.TokenEndpointAuthMethod == CLIENT_AUTH_CLIENT_SECRET_POST
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ClientSecret is a secret a confidential client authenticates with, using
+// client_secret_basic or client_secret_post. Only a hash of the secret is
+// kept. A client can hold several active secrets at once, so that a new
+// secret can be rolled out while the previous one is still accepted.
+type ClientSecret struct {
+	BaseUUIDEntity
+	ClientID   uuid.UUID  `json:"client_id" gorm:"type:uuid;index"`
+	SecretHash string     `json:"-"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// IsActive returns true if the secret has been neither revoked nor expired.
+func (s *ClientSecret) IsActive() bool {
+	now := time.Now()
+	return s.RevokedAt == nil && (s.ExpiresAt == nil || now.Before(*s.ExpiresAt))
+}
+
+// NewClientSecretValue returns a new random client secret.
+func NewClientSecretValue() (string, error) {
+	return randomString(32)
+}
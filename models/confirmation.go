@@ -0,0 +1,30 @@
+package models
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+)
+
+// Confirmation is the cnf claim of a sender-constrained token, binding the
+// token to a key the client must prove possession of (RFC 7800).
+// X5tS256 binds the token to a TLS client certificate, see RFC 8705, section 3.1.
+// Jkt binds the token to a DPoP key, see RFC 9449, section 6.1.
+type Confirmation struct {
+	X5tS256 string `json:"x5t#S256,omitempty"`
+	Jkt     string `json:"jkt,omitempty"`
+}
+
+// CertificateThumbprint returns the base64url-encoded SHA-256 digest of the
+// DER encoding of the certificate.
+func CertificateThumbprint(cert *x509.Certificate) string {
+	digest := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
+
+// AccessTokenHash returns the base64url-encoded SHA-256 digest of the access
+// token, used as the ath claim of DPoP proofs.
+func AccessTokenHash(token string) string {
+	digest := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
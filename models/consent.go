@@ -0,0 +1,47 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// Consent records the scopes a user allowed a client to access on their
+// behalf. Users are only asked to consent to the scopes a client requests
+// that are not recorded yet. There is at most one consent per user and client.
+type Consent struct {
+	BaseUUIDEntity
+	TenantID uuid.UUID  `json:"tenant_id" gorm:"type:uuid;index"`
+	UserID   uuid.UUID  `json:"user_id" gorm:"type:uuid;uniqueIndex:idx_consents_user_client"`
+	ClientID uuid.UUID  `json:"client_id" gorm:"type:uuid;uniqueIndex:idx_consents_user_client"`
+	Client   *Client    `json:"client"`
+	Scope    StringList `json:"scope" gorm:"type:jsonb"`
+}
+
+// NewConsent creates an empty consent of the user to the client.
+func NewConsent(userId uuid.UUID, clientId uuid.UUID) *Consent {
+	return &Consent{
+		BaseUUIDEntity: BaseUUIDEntity{
+			ID: uuid.New(),
+		},
+		UserID:   userId,
+		ClientID: clientId,
+		Scope:    StringList{},
+	}
+}
+
+// MissingScopes returns the scopes the user has not consented to yet.
+func (c *Consent) MissingScopes(scopes []string) []string {
+	var missing []string
+	for _, scope := range scopes {
+		if !c.Scope.Contains(scope) {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// Grant adds the scopes to the ones the user consented to.
+func (c *Consent) Grant(scopes []string) {
+	for _, scope := range c.MissingScopes(scopes) {
+		c.Scope = append(c.Scope, scope)
+	}
+}
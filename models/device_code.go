@@ -0,0 +1,123 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Device code statuses
+const (
+	DEVICE_CODE_PENDING  string = "pending"
+	DEVICE_CODE_APPROVED string = "approved"
+	DEVICE_CODE_DENIED   string = "denied"
+)
+
+// userCodeAlphabet holds the characters user codes are made of. It has no
+// vowels, to avoid forming words, and no characters easily mistaken for
+// each other, as recommended by RFC 8628, section 6.1.
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+const userCodeLength = 8
+
+// DeviceCode is a pending device authorization request, as described in
+// RFC 8628. The device polls the token endpoint with the device code while
+// the user approves the request by entering the user code. Only the SHA-256
+// digest of the device code is stored.
+type DeviceCode struct {
+	BaseUUIDEntity
+	TenantID       uuid.UUID `json:"tenant_id" gorm:"type:uuid;index"`
+	DeviceCodeHash string    `json:"-" gorm:"unique"`
+	UserCode       string    `json:"user_code" gorm:"unique"`
+	ClientID       uuid.UUID
+	Client         *Client `json:"client"`
+	ApplicationID  uuid.UUID
+	Application    *Application `json:"application"`
+	Scope          string       `json:"scope"`
+	Status         string       `json:"status"`
+	UserID         *uuid.UUID   `json:"user_id" gorm:"type:uuid"`
+	Interval       int          `json:"interval"`
+	LastPolledAt   *time.Time   `json:"last_polled_at"`
+	ExpiresAt      time.Time    `json:"expires_at"`
+}
+
+// NewDeviceCode creates a pending device authorization request for the client
+// to access the application, and returns it along with its device code.
+func NewDeviceCode(clientId uuid.UUID, applicationId uuid.UUID, scope string, lifetime time.Duration, interval int) (*DeviceCode, string, error) {
+	deviceCode, err := randomString(32)
+	if err != nil {
+		return nil, "", err
+	}
+	userCode, err := newUserCode()
+	if err != nil {
+		return nil, "", err
+	}
+	return &DeviceCode{
+		BaseUUIDEntity: BaseUUIDEntity{
+			ID: uuid.New(),
+		},
+		DeviceCodeHash: HashDeviceCode(deviceCode),
+		UserCode:       userCode,
+		ClientID:       clientId,
+		ApplicationID:  applicationId,
+		Scope:          scope,
+		Status:         DEVICE_CODE_PENDING,
+		Interval:       interval,
+		ExpiresAt:      time.Now().Add(lifetime),
+	}, deviceCode, nil
+}
+
+// HashDeviceCode returns the digest a device code is stored as.
+func HashDeviceCode(deviceCode string) string {
+	digest := sha256.Sum256([]byte(deviceCode))
+	return hex.EncodeToString(digest[:])
+}
+
+// NormalizeUserCode removes the separators and spaces users may type along
+// with a user code, and converts it to upper case.
+func NormalizeUserCode(userCode string) string {
+	replacer := strings.NewReplacer("-", "", " ", "")
+	return strings.ToUpper(replacer.Replace(userCode))
+}
+
+// FormatUserCode splits a user code in two halves for readability.
+func FormatUserCode(userCode string) string {
+	if len(userCode) != userCodeLength {
+		return userCode
+	}
+	return userCode[:userCodeLength/2] + "-" + userCode[userCodeLength/2:]
+}
+
+// IsExpired returns true if the device code can no longer be used.
+func (d *DeviceCode) IsExpired() bool {
+	return time.Now().After(d.ExpiresAt)
+}
+
+func newUserCode() (string, error) {
+	var builder strings.Builder
+	alphabetSize := big.NewInt(int64(len(userCodeAlphabet)))
+	for i := 0; i < userCodeLength; i++ {
+		n, err := rand.Int(rand.Reader, alphabetSize)
+		if err != nil {
+			return "", err
+		}
+		builder.WriteByte(userCodeAlphabet[n.Int64()])
+	}
+	return builder.String(), nil
+}
+
+// randomString returns n random bytes encoded as base64url.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
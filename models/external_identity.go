@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ExternalIdentity links a user to their account at an upstream identity
+// provider, identified by the subject the provider asserts for them.
+type ExternalIdentity struct {
+	BaseUUIDEntity
+	IdentityProviderID uuid.UUID         `json:"identity_provider_id" gorm:"type:uuid;uniqueIndex:idx_external_identities_provider_subject"`
+	IdentityProvider   *IdentityProvider `json:"-"`
+	Subject            string            `json:"subject" gorm:"uniqueIndex:idx_external_identities_provider_subject"`
+	UserID             uuid.UUID         `json:"user_id" gorm:"type:uuid;index"`
+	User               *User             `json:"-"`
+	Email              string            `json:"email"`
+	LastLoginAt        time.Time         `json:"last_login_at"`
+}
+
+// ExternalProfile is what an upstream identity provider asserted about the
+// user who logged in with it. Attributes holds every claim, or SAML attribute,
+// as a list of strings, for role mappings to match against.
+type ExternalProfile struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+	Attributes    map[string][]string
+}
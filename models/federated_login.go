@@ -0,0 +1,74 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FederatedLogin tracks a login started at an upstream identity provider,
+// until the user comes back with its response. The state sent to the provider,
+// as the OpenID Connect state or the SAML RelayState, identifies the login;
+// only its SHA-256 digest is stored. Nonce and CodeVerifier bind the ID token
+// and authorization code of an OpenID Connect provider to the login, and
+// RequestID the response of a SAML identity provider. ReturnTo is where the
+// user is sent once logged in.
+type FederatedLogin struct {
+	BaseUUIDEntity
+	StateHash          string    `json:"-" gorm:"unique"`
+	IdentityProviderID uuid.UUID `json:"identity_provider_id" gorm:"type:uuid;index"`
+	Nonce              string    `json:"-"`
+	CodeVerifier       string    `json:"-"`
+	RequestID          string    `json:"-"`
+	ReturnTo           string    `json:"return_to"`
+	ExpiresAt          time.Time `json:"expires_at"`
+}
+
+// NewFederatedLogin starts a login at the identity provider, and returns it
+// along with its state.
+func NewFederatedLogin(provider *IdentityProvider, returnTo string, lifetime time.Duration) (*FederatedLogin, string, error) {
+	state, err := randomString(32)
+	if err != nil {
+		return nil, "", err
+	}
+	nonce, err := randomString(32)
+	if err != nil {
+		return nil, "", err
+	}
+	verifier, err := randomString(32)
+	if err != nil {
+		return nil, "", err
+	}
+	return &FederatedLogin{
+		BaseUUIDEntity: BaseUUIDEntity{
+			ID: uuid.New(),
+		},
+		StateHash:          HashFederationState(state),
+		IdentityProviderID: provider.ID,
+		Nonce:              nonce,
+		CodeVerifier:       verifier,
+		ReturnTo:           returnTo,
+		ExpiresAt:          time.Now().Add(lifetime),
+	}, state, nil
+}
+
+// HashFederationState returns the digest the state of a login is stored as.
+func HashFederationState(state string) string {
+	digest := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(digest[:])
+}
+
+// IsExpired returns true if the user took too long to log in upstream.
+func (l *FederatedLogin) IsExpired() bool {
+	return time.Now().After(l.ExpiresAt)
+}
+
+// CodeChallenge returns the S256 PKCE code challenge of the login's code
+// verifier, see RFC 7636, section 4.2.
+func (l *FederatedLogin) CodeChallenge() string {
+	digest := sha256.Sum256([]byte(l.CodeVerifier))
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
@@ -0,0 +1,15 @@
+package models
+
+import "github.com/google/uuid"
+
+// Group is a set of users sharing the same roles. Groups can be nested: the
+// members of a group also hold the roles assigned to its ancestors.
+type Group struct {
+	BaseUUIDEntity
+	TenantID  uuid.UUID  `json:"tenant_id" gorm:"type:uuid;index"`
+	Name      string     `json:"name"`
+	ParentID  *uuid.UUID `json:"parent_id" gorm:"type:uuid;index"`
+	Subgroups []*Group   `json:"subgroups" gorm:"foreignKey:ParentID"`
+	Members   []*User    `json:"members" gorm:"many2many:user_groups;"`
+	Roles     []*Role    `json:"roles" gorm:"many2many:group_roles;"`
+}
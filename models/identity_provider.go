@@ -0,0 +1,155 @@
+package models
+
+import (
+	"crypto/x509"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Identity provider types
+const (
+	IDENTITY_PROVIDER_TYPE_OIDC string = "oidc"
+	IDENTITY_PROVIDER_TYPE_SAML string = "saml"
+	IDENTITY_PROVIDER_TYPE_LDAP string = "ldap"
+)
+
+// LDAP directory defaults
+const (
+	DEFAULT_LDAP_USER_FILTER     string = "(uid=%s)"
+	DEFAULT_LDAP_EMAIL_ATTRIBUTE string = "mail"
+	LDAP_GROUPS_ATTRIBUTE        string = "groups"
+)
+
+// IdentityProvider is an upstream OpenID Connect provider, SAML 2.0 identity
+// provider or LDAP directory users can log in with. The server acts as a
+// relying party, or as a service provider, of the upstream provider.
+//
+// OpenID Connect providers are configured with their issuer, from which their
+// metadata is discovered, and the credentials of the client registered for the
+// server. SAML identity providers are configured with their metadata, either
+// inline or fetched from MetadataURL.
+//
+// LDAP directories check the passwords users log in with at the login and
+// token endpoints, in place of the server. Users are either bound to directly,
+// with the DN LDAPUserDNTemplate yields for their username, or first searched
+// for under LDAPBaseDN with LDAPUserFilter, binding as LDAPBindDN if set. The
+// connection is secured with TLS for ldaps URLs, or with StartTLS when
+// LDAPStartTLS is set. The groups of the user are read from their memberOf
+// attribute, or searched for under LDAPGroupBaseDN with LDAPGroupFilter, and
+// exposed to role mappings as the "groups" claim.
+//
+// Users logging in for the first time are provisioned just in time. When
+// LinkByEmail is set, they are linked to the existing user with the same
+// email instead, provided the provider verified it. The roles of the role
+// mappings whose rule matches the user's claims are granted on every login,
+// and the others revoked.
+type IdentityProvider struct {
+	BaseUUIDEntity
+	TenantID     uuid.UUID      `json:"tenant_id" gorm:"type:uuid;uniqueIndex:idx_identity_providers_tenant_name"`
+	Name         string         `json:"name" gorm:"uniqueIndex:idx_identity_providers_tenant_name"`
+	Type         string         `json:"type"`
+	Disabled     bool           `json:"disabled"`
+	Issuer       string         `json:"issuer"`
+	ClientID     string         `json:"client_id"`
+	ClientSecret string         `json:"-"`
+	Scopes       StringList     `json:"scopes" gorm:"type:text"`
+	MetadataURL  string         `json:"metadata_url"`
+	Metadata     string         `json:"metadata" gorm:"type:text"`
+	EmailClaim   string         `json:"email_claim"`
+	LinkByEmail  bool           `json:"link_by_email"`
+	RoleMappings []*RoleMapping `json:"role_mappings" gorm:"foreignKey:IdentityProviderID"`
+
+	LDAPURL            string `json:"ldap_url"`
+	LDAPStartTLS       bool   `json:"ldap_start_tls"`
+	LDAPRootCAs        string `json:"ldap_root_cas" gorm:"type:text"`
+	LDAPBindDN         string `json:"ldap_bind_dn"`
+	LDAPBindPassword   string `json:"-"`
+	LDAPUserDNTemplate string `json:"ldap_user_dn_template"`
+	LDAPBaseDN         string `json:"ldap_base_dn"`
+	LDAPUserFilter     string `json:"ldap_user_filter"`
+	LDAPGroupBaseDN    string `json:"ldap_group_base_dn"`
+	LDAPGroupFilter    string `json:"ldap_group_filter"`
+}
+
+// RoleMapping grants a role to the users of an identity provider whose claim,
+// or SAML attribute, holds the given value.
+type RoleMapping struct {
+	BaseUUIDEntity
+	IdentityProviderID uuid.UUID `json:"identity_provider_id" gorm:"type:uuid;index"`
+	Claim              string    `json:"claim"`
+	Value              string    `json:"value"`
+	RoleID             uuid.UUID `json:"role_id" gorm:"type:uuid"`
+	Role               *Role     `json:"role"`
+}
+
+// Validate checks that the identity provider holds the configuration its type
+// requires.
+func (p *IdentityProvider) Validate() error {
+	if p.Name == "" {
+		return errors.New("identity provider name cannot be blank")
+	}
+	switch p.Type {
+	case IDENTITY_PROVIDER_TYPE_OIDC:
+		issuer, err := url.Parse(p.Issuer)
+		if err != nil || !issuer.IsAbs() || issuer.Host == "" {
+			return errors.New("issuer must be an absolute URL")
+		}
+		if p.ClientID == "" {
+			return errors.New("client_id cannot be blank")
+		}
+	case IDENTITY_PROVIDER_TYPE_SAML:
+		if p.Metadata == "" && p.MetadataURL == "" {
+			return errors.New("either metadata or metadata_url is required")
+		}
+		if p.MetadataURL != "" {
+			metadataURL, err := url.Parse(p.MetadataURL)
+			if err != nil || !metadataURL.IsAbs() || metadataURL.Host == "" {
+				return errors.New("metadata_url must be an absolute URL")
+			}
+		}
+	case IDENTITY_PROVIDER_TYPE_LDAP:
+		ldapURL, err := url.Parse(p.LDAPURL)
+		if err != nil || (ldapURL.Scheme != "ldap" && ldapURL.Scheme != "ldaps") || ldapURL.Host == "" {
+			return errors.New("ldap_url must be an ldap or ldaps URL")
+		}
+		if ldapURL.Scheme == "ldaps" && p.LDAPStartTLS {
+			return errors.New("ldap_start_tls cannot be used with an ldaps URL")
+		}
+		if p.LDAPUserDNTemplate == "" && p.LDAPBaseDN == "" {
+			return errors.New("either ldap_user_dn_template or ldap_base_dn is required")
+		}
+		if p.LDAPUserDNTemplate != "" && strings.Count(p.LDAPUserDNTemplate, "%s") != 1 {
+			return errors.New("ldap_user_dn_template must hold %s once, where the username goes")
+		}
+		if p.LDAPUserFilter != "" && strings.Count(p.LDAPUserFilter, "%s") != 1 {
+			return errors.New("ldap_user_filter must hold %s once, where the username goes")
+		}
+		if p.LDAPGroupFilter != "" && (p.LDAPGroupBaseDN == "" || strings.Count(p.LDAPGroupFilter, "%s") != 1) {
+			return errors.New("ldap_group_filter requires ldap_group_base_dn, and must hold %s once, where the user's DN goes")
+		}
+		if p.LDAPRootCAs != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(p.LDAPRootCAs)) {
+			return errors.New("ldap_root_cas must hold PEM encoded certificates")
+		}
+	default:
+		return errors.New("type must be one of oidc, saml or ldap")
+	}
+	for _, mapping := range p.RoleMappings {
+		if mapping.Claim == "" || mapping.Value == "" {
+			return errors.New("role mappings require a claim and a value")
+		}
+	}
+	return nil
+}
+
+// Matches returns true if the profile holds the value in the mapped claim.
+func (m *RoleMapping) Matches(profile *ExternalProfile) bool {
+	for _, value := range profile.Attributes[m.Claim] {
+		if value == m.Value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+package models
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// SignedToken is a JWT signed by a third party with an asymmetric key, such
+// as a client assertion. Unlike Jwt, its claims are kept as decoded JSON.
+type SignedToken struct {
+	Header    map[string]interface{}
+	Claims    map[string]interface{}
+	signature []byte
+	message   string
+}
+
+// ParseSignedToken decodes a compact serialized JWT without verifying it.
+func ParseSignedToken(token string) (*SignedToken, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var parsed SignedToken
+	err := decodeSegment(parts[0], &parsed.Header)
+	if err != nil {
+		return nil, err
+	}
+	err = decodeSegment(parts[1], &parsed.Claims)
+	if err != nil {
+		return nil, err
+	}
+	parsed.signature, err = base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	parsed.message = parts[0] + "." + parts[1]
+	return &parsed, nil
+}
+
+// Alg returns the algorithm the token claims to be signed with.
+func (t *SignedToken) Alg() string {
+	return t.HeaderString("alg")
+}
+
+// HeaderString returns the string header parameter with the given name.
+func (t *SignedToken) HeaderString(name string) string {
+	value, _ := t.Header[name].(string)
+	return value
+}
+
+// HeaderKey returns the public key carried in the jwk header parameter.
+// Keys containing private members are rejected.
+func (t *SignedToken) HeaderKey() (*JSONWebKey, error) {
+	raw, ok := t.Header["jwk"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("missing jwk header")
+	}
+	if _, ok := raw["d"]; ok {
+		return nil, errors.New("jwk header must not contain a private key")
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var key JSONWebKey
+	err = json.Unmarshal(data, &key)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// ClaimString returns the string claim with the given name.
+func (t *SignedToken) ClaimString(name string) string {
+	value, _ := t.Claims[name].(string)
+	return value
+}
+
+// ClaimTime returns the numeric date claim with the given name, and false
+// if the claim is missing.
+func (t *SignedToken) ClaimTime(name string) (int64, bool) {
+	value, ok := t.Claims[name].(float64)
+	return int64(value), ok
+}
+
+// Audiences returns the aud claim, which may be a single string or a list.
+func (t *SignedToken) Audiences() []string {
+	switch aud := t.Claims["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		var audiences []string
+		for _, value := range aud {
+			if s, ok := value.(string); ok {
+				audiences = append(audiences, s)
+			}
+		}
+		return audiences
+	}
+	return nil
+}
+
+// Verify checks the signature of the token against the public key.
+func (t *SignedToken) Verify(key crypto.PublicKey) error {
+	return VerifySignature(t.Alg(), []byte(t.message), t.signature, key)
+}
+
+// VerifySignature checks a JWS signature produced with one of the RS, PS and
+// ES algorithms from RFC 7518. Symmetric and "none" algorithms are rejected.
+func VerifySignature(alg string, message []byte, signature []byte, key crypto.PublicKey) error {
+	hash, err := hashForAlgorithm(alg)
+	if err != nil {
+		return err
+	}
+	hasher := hash.New()
+	hasher.Write(message)
+	digest := hasher.Sum(nil)
+
+	switch alg[:2] {
+	case "RS", "PS":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("algorithm requires an RSA key")
+		}
+		if alg[:2] == "RS" {
+			return rsa.VerifyPKCS1v15(rsaKey, hash, digest, signature)
+		}
+		return rsa.VerifyPSS(rsaKey, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	default:
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.New("algorithm requires an elliptic curve key")
+		}
+		size := (ecKey.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid signature length")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(ecKey, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+}
+
+func hashForAlgorithm(alg string) (crypto.Hash, error) {
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		return crypto.SHA256, nil
+	case "RS384", "PS384", "ES384":
+		return crypto.SHA384, nil
+	case "RS512", "PS512", "ES512":
+		return crypto.SHA512, nil
+	default:
+		return 0, fmt.Errorf("unsupported signature algorithm %q", alg)
+	}
+}
+
+func decodeSegment(segment string, target interface{}) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(decoded, target)
+}
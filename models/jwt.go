@@ -1,12 +1,12 @@
 package models
 
 import (
+	"bytes"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
-	"log"
 	"os"
 	"strings"
 	"time"
@@ -55,24 +55,49 @@ type Header struct {
 // exp (expiration time): Time after which the JWT expires
 // iat (issued at time): Time at which the JWT was issued
 // jti (JWT ID): Unique identifier; can be used to prevent the JWT from being replayed (allows a token to be used only once)
+// act (actor): Party acting on behalf of the subject, in tokens obtained through token exchange (RFC 8693)
+// cnf (confirmation): Key the token is bound to, in sender-constrained tokens (RFC 7800)
+//
+// Claims whose names are only known at runtime (e.g. configurable role claims)
+// are kept in Extra and serialized alongside the registered claims.
 type Payload struct {
-	Iss   string   `json:"iss"`
-	Sub   string   `json:"sub"`
-	Aud   string   `json:"aud"`
-	Exp   int64    `json:"exp"`
-	Iat   int64    `json:"iat"`
-	Jti   string   `json:"jti"`
-	Scope []string `json:"scope"`
+	Iss   string                 `json:"iss"`
+	Sub   string                 `json:"sub"`
+	Aud   string                 `json:"aud"`
+	Exp   int64                  `json:"exp"`
+	Iat   int64                  `json:"iat"`
+	Jti   string                 `json:"jti"`
+	Scope []string               `json:"scope,omitempty"`
+	Act   *Actor                 `json:"act,omitempty"`
+	Cnf   *Confirmation          `json:"cnf,omitempty"`
+	Extra map[string]interface{} `json:"-"`
+}
+
+// Actor identifies the party a token was delegated to. When a delegated token
+// is exchanged again, the previous actor is nested in the new one, as
+// described in RFC 8693, section 4.1.
+type Actor struct {
+	Sub string `json:"sub"`
+	Act *Actor `json:"act,omitempty"`
 }
 
 // NewJwt is a function that creates a new Jwt.
 func NewJwt(payload *Payload, typ string) (*Jwt, error) {
+	return NewJwtWithKey(payload, typ, nil)
+}
+
+// NewJwtWithKey creates a new Jwt signed with the key, or with the server's
+// secret if the key is nil.
+func NewJwtWithKey(payload *Payload, typ string, key []byte) (*Jwt, error) {
 	var jwt Jwt
 	alg := os.Getenv("AUTH_SERVER_JWT_ALG")
 	jwt.Header = newHeader(alg, typ)
 	jwt.Payload = payload
 	jwt.makeMessage()
-	err := jwt.makeSignature(alg)
+	if key == nil {
+		key = []byte(os.Getenv("AUTH_SERVER_JWT_SECRET"))
+	}
+	err := jwt.makeSignature(alg, key)
 	if err != nil {
 		return nil, err
 	}
@@ -103,20 +128,18 @@ func (j *Jwt) makeMessage() error {
 	return nil
 }
 
-func (j *Jwt) makeSignature(alg string) error {
+func (j *Jwt) makeSignature(alg string, key []byte) error {
 	switch alg {
 	case "HS256":
-		j.makeHS256Signature()
+		j.makeHS256Signature(key)
 	default:
 		return errors.New("invalid algorithm")
 	}
 	return nil
 }
 
-func (j *Jwt) makeHS256Signature() {
-	secret := os.Getenv("AUTH_SERVER_JWT_SECRET")
-	log.Printf("secret: %s", secret)
-	hasher := hmac.New(sha256.New, []byte(secret))
+func (j *Jwt) makeHS256Signature(secret []byte) {
+	hasher := hmac.New(sha256.New, secret)
 	hasher.Write([]byte(j.message))
 	signature := hasher.Sum(nil)
 	j.Signature = base64.RawURLEncoding.EncodeToString(signature)
@@ -152,13 +175,13 @@ func (h *Header) ToJSON() ([]byte, error) {
 }
 
 // NewPayload is a function that creates a new Payload.
-func NewPayload(sub string, aud string, exp int, scope string) *Payload {
+func NewPayload(sub string, aud string, lifetime time.Duration, scope string) *Payload {
 	jti := uuid.New().String()
 	return &Payload{
 		Iss:   os.Getenv("AUTH_SERVER_JWT_ISS"),
 		Sub:   sub,
 		Aud:   aud,
-		Exp:   time.Now().Add(time.Hour * time.Duration(exp)).Unix(),
+		Exp:   time.Now().Add(lifetime).Unix(),
 		Iat:   time.Now().Unix(),
 		Jti:   jti,
 		Scope: strings.Split(scope, " "),
@@ -169,3 +192,68 @@ func NewPayload(sub string, aud string, exp int, scope string) *Payload {
 func (p *Payload) ToJSON() ([]byte, error) {
 	return json.Marshal(p)
 }
+
+// SetClaim sets an additional claim on the payload. Registered claims
+// cannot be overridden this way.
+func (p *Payload) SetClaim(name string, value interface{}) {
+	if p.Extra == nil {
+		p.Extra = make(map[string]interface{})
+	}
+	p.Extra[name] = value
+}
+
+// Claim returns the additional claim with the given name, if present.
+func (p *Payload) Claim(name string) (interface{}, bool) {
+	value, ok := p.Extra[name]
+	return value, ok
+}
+
+// payloadClaims is used to (un)marshal the registered claims of a Payload
+// without recursing into its MarshalJSON and UnmarshalJSON methods.
+type payloadClaims Payload
+
+// MarshalJSON merges the additional claims with the registered ones.
+// Keys are emitted in sorted order so that the encoding is deterministic.
+func (p *Payload) MarshalJSON() ([]byte, error) {
+	registered, err := json.Marshal((*payloadClaims)(p))
+	if err != nil {
+		return nil, err
+	}
+	claims := make(map[string]interface{})
+	decoder := json.NewDecoder(bytes.NewReader(registered))
+	decoder.UseNumber()
+	if err := decoder.Decode(&claims); err != nil {
+		return nil, err
+	}
+	for name, value := range p.Extra {
+		if _, ok := claims[name]; ok {
+			continue
+		}
+		claims[name] = value
+	}
+	return json.Marshal(claims)
+}
+
+// UnmarshalJSON decodes the registered claims into their fields and keeps
+// every other claim in Extra.
+func (p *Payload) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*payloadClaims)(p)); err != nil {
+		return err
+	}
+	claims := make(map[string]interface{})
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&claims); err != nil {
+		return err
+	}
+	for _, name := range registeredClaims {
+		delete(claims, name)
+	}
+	p.Extra = nil
+	if len(claims) > 0 {
+		p.Extra = claims
+	}
+	return nil
+}
+
+var registeredClaims = []string{"iss", "sub", "aud", "exp", "iat", "jti", "scope", "act", "cnf"}
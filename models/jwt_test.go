@@ -0,0 +1,102 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestPayloadJSONRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		extra     map[string]interface{}
+		wantExtra map[string]interface{}
+	}{
+		{"no additional claims", nil, nil},
+		{
+			"additional claims",
+			map[string]interface{}{"roles": []string{"admin"}, "client_id": "client"},
+			map[string]interface{}{"roles": []interface{}{"admin"}, "client_id": "client"},
+		},
+		{
+			"numbers are kept exact",
+			map[string]interface{}{"auth_time": int64(1700000000123)},
+			map[string]interface{}{"auth_time": json.Number("1700000000123")},
+		},
+		{
+			"registered claims cannot be overridden",
+			map[string]interface{}{"sub": "intruder", "exp": 0, "roles": []string{}},
+			map[string]interface{}{"roles": []interface{}{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := &Payload{
+				Iss:   "https://auth.example.com",
+				Sub:   "subject",
+				Aud:   "audience",
+				Exp:   1700000600,
+				Iat:   1700000000,
+				Jti:   "id",
+				Scope: []string{"openid"},
+				Extra: tt.extra,
+			}
+			data, err := json.Marshal(payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var decoded Payload
+			err = json.Unmarshal(data, &decoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if decoded.Sub != "subject" || decoded.Exp != 1700000600 || decoded.Aud != "audience" {
+				t.Errorf("registered claims = %+v", decoded)
+			}
+			if !reflect.DeepEqual(decoded.Scope, []string{"openid"}) {
+				t.Errorf("scope = %v", decoded.Scope)
+			}
+			if !reflect.DeepEqual(decoded.Extra, tt.wantExtra) {
+				t.Errorf("extra = %#v, want %#v", decoded.Extra, tt.wantExtra)
+			}
+		})
+	}
+}
+
+func TestAddAuthorizationClaims(t *testing.T) {
+	config := &ClaimsConfig{
+		RolesClaim:       "roles",
+		PermissionsClaim: "permissions",
+		MaxEntries:       3,
+		SourceEndpoint:   "https://auth.example.com/oauth2/userclaims/",
+	}
+	tests := []struct {
+		name        string
+		claims      *AuthorizationClaims
+		distributed bool
+	}{
+		{"embedded", &AuthorizationClaims{Roles: []string{"editor"}, Permissions: []string{"read", "write"}}, false},
+		{"too many entries", &AuthorizationClaims{Roles: []string{"editor", "viewer"}, Permissions: []string{"read", "write"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := &Payload{Sub: "subject"}
+			payload.AddAuthorizationClaims(tt.claims, config)
+
+			_, hasRoles := payload.Claim("roles")
+			_, hasNames := payload.Claim("_claim_names")
+			if hasRoles == tt.distributed || hasNames != tt.distributed {
+				t.Fatalf("claims = %v", payload.Extra)
+			}
+			if !tt.distributed {
+				return
+			}
+			sources, _ := payload.Claim("_claim_sources")
+			want := map[string]interface{}{"authz": map[string]string{"endpoint": config.SourceEndpoint}}
+			if !reflect.DeepEqual(sources, want) {
+				t.Errorf("_claim_sources = %v, want %v", sources, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LOGOUT_TOKEN_TYPE is the typ header of logout tokens, see OpenID Connect
+// Back-Channel Logout, section 2.4.
+const LOGOUT_TOKEN_TYPE = "logout+jwt"
+
+// backChannelLogoutEvent identifies logout tokens in their events claim.
+const backChannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+// NewLogoutToken creates the payload of a logout token telling the client
+// that the session of the user ended, as described in OpenID Connect
+// Back-Channel Logout, section 2.4. The session id is only included when
+// sid is not blank.
+func NewLogoutToken(sub string, sid string, clientId string, lifetime time.Duration) *Payload {
+	now := time.Now()
+	payload := &Payload{
+		Iss: os.Getenv("AUTH_SERVER_JWT_ISS"),
+		Sub: sub,
+		Aud: clientId,
+		Exp: now.Add(lifetime).Unix(),
+		Iat: now.Unix(),
+		Jti: uuid.New().String(),
+	}
+	payload.SetClaim("events", map[string]interface{}{
+		backChannelLogoutEvent: map[string]interface{}{},
+	})
+	if sid != "" {
+		payload.SetClaim("sid", sid)
+	}
+	return payload
+}
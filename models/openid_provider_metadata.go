@@ -0,0 +1,13 @@
+package models
+
+// OpenIDProviderMetadata is the part of an OpenID Connect provider's
+// configuration, published at its discovery endpoint, that relying parties
+// need. See OpenID Connect Discovery 1.0, section 3.
+type OpenIDProviderMetadata struct {
+	Issuer                           string   `json:"issuer"`
+	AuthorizationEndpoint            string   `json:"authorization_endpoint"`
+	TokenEndpoint                    string   `json:"token_endpoint"`
+	UserinfoEndpoint                 string   `json:"userinfo_endpoint,omitempty"`
+	JwksURI                          string   `json:"jwks_uri"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported,omitempty"`
+}
@@ -7,7 +7,7 @@ import (
 
 type Permission struct {
 	gorm.Model
-	Name   string `json:"name"`
-	RoleID uuid.UUID
-	Role   *Role `json:"role"`
+	TenantID uuid.UUID `json:"tenant_id" gorm:"type:uuid;index"`
+	Name     string    `json:"name"`
+	Roles    []*Role   `json:"roles" gorm:"many2many:role_permissions;"`
 }
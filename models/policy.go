@@ -0,0 +1,253 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Policy effects
+const (
+	POLICY_EFFECT_ALLOW string = "allow"
+	POLICY_EFFECT_DENY  string = "deny"
+)
+
+// Policy is an attribute-based authorization rule of an application. A policy
+// applies to a request when the requested resource matches Resource, the
+// requested action matches Action, and every condition holds. Resource is a
+// path.Match pattern, and Action is either an action name or "*".
+type Policy struct {
+	BaseUUIDEntity
+	TenantID      uuid.UUID `json:"tenant_id" gorm:"type:uuid;index"`
+	Name          string    `json:"name"`
+	Description   string    `json:"description"`
+	ApplicationID uuid.UUID
+	Application   *Application     `json:"application"`
+	Effect        string           `json:"effect"`
+	Resource      string           `json:"resource"`
+	Action        string           `json:"action"`
+	Conditions    PolicyConditions `json:"conditions" gorm:"type:jsonb"`
+}
+
+// PolicyCondition compares the value of an attribute of the request with
+// either a literal Value or the value of another attribute, named by
+// ValueFrom. Attributes are named "subject.<field>", "context.<key>",
+// "resource" and "action".
+//
+// Supported operators are eq, ne, in, not_in, contains, starts_with,
+// gt, gte, lt, lte and exists. Values of different types are never equal, so
+// the string "1" does not equal the number 1.
+type PolicyCondition struct {
+	Attribute string      `json:"attribute"`
+	Operator  string      `json:"operator"`
+	Value     interface{} `json:"value,omitempty"`
+	ValueFrom string      `json:"value_from,omitempty"`
+}
+
+// PolicyConditions is stored as a JSON document.
+type PolicyConditions []*PolicyCondition
+
+// Value implements driver.Valuer.
+func (c PolicyConditions) Value() (driver.Value, error) {
+	if c == nil {
+		return "[]", nil
+	}
+	value, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(value), nil
+}
+
+// Scan implements sql.Scanner.
+func (c *PolicyConditions) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(value, c)
+	case string:
+		return json.Unmarshal([]byte(value), c)
+	default:
+		return fmt.Errorf("cannot scan %T into PolicyConditions", src)
+	}
+}
+
+// Validate checks that the policy can be evaluated.
+func (p *Policy) Validate() error {
+	if p.Effect != POLICY_EFFECT_ALLOW && p.Effect != POLICY_EFFECT_DENY {
+		return errors.New("policy effect must be either allow or deny")
+	}
+	if _, err := path.Match(p.Resource, ""); err != nil {
+		return err
+	}
+	if p.Action == "" {
+		return errors.New("policy action cannot be blank")
+	}
+	for _, condition := range p.Conditions {
+		if _, ok := conditionOperators[condition.Operator]; !ok {
+			return fmt.Errorf("unknown condition operator %q", condition.Operator)
+		}
+	}
+	return nil
+}
+
+// Matches returns true if the policy applies to the request described by the attributes.
+func (p *Policy) Matches(attributes AuthorizationAttributes) bool {
+	if !MatchesResource(p.Resource, attributes.Resource()) || !MatchesAction(p.Action, attributes.Action()) {
+		return false
+	}
+	for _, condition := range p.Conditions {
+		if !condition.Evaluate(attributes) {
+			return false
+		}
+	}
+	return true
+}
+
+// Evaluate returns true if the condition holds for the attributes. Conditions
+// on missing attributes never hold, except for negated ones.
+func (c *PolicyCondition) Evaluate(attributes AuthorizationAttributes) bool {
+	operator, ok := conditionOperators[c.Operator]
+	if !ok {
+		return false
+	}
+	expected := c.Value
+	if c.ValueFrom != "" {
+		expected, ok = attributes[c.ValueFrom]
+		if !ok {
+			return false
+		}
+	}
+	actual, ok := attributes[c.Attribute]
+	if !ok {
+		return c.Operator == "ne" || c.Operator == "not_in"
+	}
+	return operator(actual, expected)
+}
+
+var conditionOperators = map[string]func(actual, expected interface{}) bool{
+	"eq": func(actual, expected interface{}) bool {
+		return equalValues(actual, expected)
+	},
+	"ne": func(actual, expected interface{}) bool {
+		return !equalValues(actual, expected)
+	},
+	"in": func(actual, expected interface{}) bool {
+		return containsValue(expected, actual)
+	},
+	"not_in": func(actual, expected interface{}) bool {
+		return !containsValue(expected, actual)
+	},
+	"contains": func(actual, expected interface{}) bool {
+		if s, ok := actual.(string); ok {
+			return strings.Contains(s, fmt.Sprint(expected))
+		}
+		return containsValue(actual, expected)
+	},
+	"starts_with": func(actual, expected interface{}) bool {
+		return strings.HasPrefix(fmt.Sprint(actual), fmt.Sprint(expected))
+	},
+	"gt": func(actual, expected interface{}) bool {
+		return compareNumbers(actual, expected, func(a, b float64) bool { return a > b })
+	},
+	"gte": func(actual, expected interface{}) bool {
+		return compareNumbers(actual, expected, func(a, b float64) bool { return a >= b })
+	},
+	"lt": func(actual, expected interface{}) bool {
+		return compareNumbers(actual, expected, func(a, b float64) bool { return a < b })
+	},
+	"lte": func(actual, expected interface{}) bool {
+		return compareNumbers(actual, expected, func(a, b float64) bool { return a <= b })
+	},
+	"exists": func(actual, expected interface{}) bool {
+		return true
+	},
+}
+
+// equalValues returns true if the values have the same type and are equal.
+// JSON numbers are the exception: they are equal when they hold the same
+// number, however they were decoded.
+func equalValues(a, b interface{}) bool {
+	x, aIsNumber := jsonNumber(a)
+	y, bIsNumber := jsonNumber(b)
+	if aIsNumber || bIsNumber {
+		return aIsNumber && bIsNumber && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// jsonNumber returns the value of a number decoded from JSON, either as a
+// float64 or as a json.Number.
+func jsonNumber(value interface{}) (float64, bool) {
+	switch number := value.(type) {
+	case float64:
+		return number, true
+	case json.Number:
+		f, err := number.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// containsValue returns true if list is a list holding value.
+func containsValue(list interface{}, value interface{}) bool {
+	switch items := list.(type) {
+	case []string:
+		for _, item := range items {
+			if equalValues(item, value) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range items {
+			if equalValues(item, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func compareNumbers(a, b interface{}, compare func(a, b float64) bool) bool {
+	x, err := strconv.ParseFloat(fmt.Sprint(a), 64)
+	if err != nil {
+		return false
+	}
+	y, err := strconv.ParseFloat(fmt.Sprint(b), 64)
+	if err != nil {
+		return false
+	}
+	return compare(x, y)
+}
+
+// MatchesResource returns true if the resource matches the path.Match pattern.
+func MatchesResource(pattern string, resource string) bool {
+	matched, err := path.Match(pattern, resource)
+	return err == nil && matched
+}
+
+// MatchesAction returns true if the action is the expected one, or if any
+// action is expected.
+func MatchesAction(expected string, action string) bool {
+	return expected == "*" || expected == action
+}
+
+// PermissionGrants returns true if the permission named name grants the
+// action on the resource. Permissions are named "<resource>:<action>", where
+// resource is a path.Match pattern and action an action name or "*".
+func PermissionGrants(name string, resource string, action string) bool {
+	i := strings.LastIndex(name, ":")
+	if i < 0 {
+		return false
+	}
+	return MatchesResource(name[:i], resource) && MatchesAction(name[i+1:], action)
+}
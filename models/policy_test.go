@@ -0,0 +1,46 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPolicyConditionEvaluate(t *testing.T) {
+	attributes := AuthorizationAttributes{
+		"subject.id":    "42",
+		"subject.roles": []string{"editor", "viewer"},
+		"context.level": float64(3),
+		"context.count": json.Number("10"),
+		"context.owner": "42",
+		"context.flag":  true,
+	}
+	tests := []struct {
+		name      string
+		condition PolicyCondition
+		want      bool
+	}{
+		{"equal strings", PolicyCondition{Attribute: "subject.id", Operator: "eq", Value: "42"}, true},
+		{"string and number", PolicyCondition{Attribute: "subject.id", Operator: "eq", Value: float64(42)}, false},
+		{"number and string", PolicyCondition{Attribute: "context.level", Operator: "eq", Value: "3"}, false},
+		{"equal numbers", PolicyCondition{Attribute: "context.level", Operator: "eq", Value: float64(3)}, true},
+		{"number decoded as json.Number", PolicyCondition{Attribute: "context.count", Operator: "eq", Value: float64(10)}, true},
+		{"boolean and string", PolicyCondition{Attribute: "context.flag", Operator: "eq", Value: "true"}, false},
+		{"equal booleans", PolicyCondition{Attribute: "context.flag", Operator: "eq", Value: true}, true},
+		{"different types are not equal", PolicyCondition{Attribute: "subject.id", Operator: "ne", Value: float64(42)}, true},
+		{"attribute from another one", PolicyCondition{Attribute: "context.owner", Operator: "eq", ValueFrom: "subject.id"}, true},
+		{"missing attribute", PolicyCondition{Attribute: "context.missing", Operator: "eq", Value: "42"}, false},
+		{"missing attribute negated", PolicyCondition{Attribute: "context.missing", Operator: "ne", Value: "42"}, true},
+		{"in a list", PolicyCondition{Attribute: "context.level", Operator: "in", Value: []interface{}{float64(1), float64(3)}}, true},
+		{"string in a list of numbers", PolicyCondition{Attribute: "subject.id", Operator: "in", Value: []interface{}{float64(42)}}, false},
+		{"list containing", PolicyCondition{Attribute: "subject.roles", Operator: "contains", Value: "editor"}, true},
+		{"greater than", PolicyCondition{Attribute: "context.count", Operator: "gt", Value: float64(3)}, true},
+		{"unknown operator", PolicyCondition{Attribute: "subject.id", Operator: "like", Value: "42"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.condition.Evaluate(attributes); got != tt.want {
+				t.Errorf("Evaluate() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RefreshToken lets a client obtain new access tokens on behalf of a user
+// without involving them again, as described in RFC 6749, section 6. Refresh
+// tokens are rotated: each one can only be used once, and is replaced by a
+// new one with the same scope. Only the SHA-256 digest of the token is stored.
+type RefreshToken struct {
+	BaseUUIDEntity
+	TenantID      uuid.UUID  `json:"tenant_id" gorm:"type:uuid;index"`
+	TokenHash     string     `json:"-" gorm:"unique"`
+	ClientID      uuid.UUID  `json:"client_id" gorm:"type:uuid;index"`
+	ApplicationID uuid.UUID  `json:"application_id" gorm:"type:uuid"`
+	UserID        uuid.UUID  `json:"user_id" gorm:"type:uuid;index"`
+	Scope         string     `json:"scope"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	RevokedAt     *time.Time `json:"revoked_at"`
+}
+
+// NewRefreshToken creates a refresh token issued to the client on behalf of
+// the user, and returns it along with the token itself.
+func NewRefreshToken(clientId uuid.UUID, applicationId uuid.UUID, userId uuid.UUID, scope string, lifetime time.Duration) (*RefreshToken, string, error) {
+	token, err := randomString(32)
+	if err != nil {
+		return nil, "", err
+	}
+	return &RefreshToken{
+		BaseUUIDEntity: BaseUUIDEntity{
+			ID: uuid.New(),
+		},
+		TokenHash:     HashRefreshToken(token),
+		ClientID:      clientId,
+		ApplicationID: applicationId,
+		UserID:        userId,
+		Scope:         scope,
+		ExpiresAt:     time.Now().Add(lifetime),
+	}, token, nil
+}
+
+// HashRefreshToken returns the digest a refresh token is stored as.
+func HashRefreshToken(token string) string {
+	digest := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(digest[:])
+}
+
+// IsActive returns true if the refresh token has been neither revoked nor expired.
+func (t *RefreshToken) IsActive() bool {
+	return t.RevokedAt == nil && time.Now().Before(t.ExpiresAt)
+}
@@ -2,9 +2,31 @@ package models
 
 import "github.com/google/uuid"
 
+// Role is a named set of permissions within an application. A composite role
+// includes other roles, granting every permission they grant.
 type Role struct {
 	BaseUUIDEntity
-	Name          string `json:"name"`
+	TenantID      uuid.UUID `json:"tenant_id" gorm:"type:uuid;index"`
+	Name          string    `json:"name"`
 	ApplicationID uuid.UUID
-	Application   *Application `json:"application"`
+	Application   *Application  `json:"application"`
+	Composites    []*Role       `json:"composites" gorm:"many2many:role_composites;joinForeignKey:RoleID;joinReferences:CompositeID"`
+	Permissions   []*Permission `json:"permissions" gorm:"many2many:role_permissions;"`
+}
+
+// CollectPermissions returns the permissions granted by the given roles,
+// without duplicates.
+func CollectPermissions(roles []*Role) []*Permission {
+	permissions := make([]*Permission, 0)
+	seen := make(map[uint]bool)
+	for _, role := range roles {
+		for _, permission := range role.Permissions {
+			if seen[permission.ID] {
+				continue
+			}
+			seen[permission.ID] = true
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions
 }
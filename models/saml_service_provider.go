@@ -0,0 +1,147 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/google/uuid"
+)
+
+// Name identifier formats of the assertions issued to service providers
+const (
+	SAML_NAMEID_FORMAT_PERSISTENT  string = "persistent"
+	SAML_NAMEID_FORMAT_TRANSIENT   string = "transient"
+	SAML_NAMEID_FORMAT_EMAIL       string = "email"
+	SAML_NAMEID_FORMAT_UNSPECIFIED string = "unspecified"
+)
+
+// Sources of the attributes of the assertions issued to service providers
+const (
+	SAML_ATTRIBUTE_SOURCE_ID          string = "id"
+	SAML_ATTRIBUTE_SOURCE_USERNAME    string = "username"
+	SAML_ATTRIBUTE_SOURCE_EMAIL       string = "email"
+	SAML_ATTRIBUTE_SOURCE_ROLES       string = "roles"
+	SAML_ATTRIBUTE_SOURCE_PERMISSIONS string = "permissions"
+	SAML_ATTRIBUTE_SOURCE_GROUPS      string = "groups"
+)
+
+// SAMLServiceProvider is a SAML 2.0 service provider users can log in to with
+// the server acting as their identity provider. It is registered by importing
+// its metadata, either inline or fetched from MetadataURL once, and is
+// identified by the entity id the metadata declares.
+//
+// The subject of the assertions issued to the service provider is named after
+// NameIDFormat: persistent names are the user's id, email names their email,
+// and unspecified names their username. Transient names are random, and
+// differ on every login. The attributes of the assertions are described by
+// AttributeMappings. When ApplicationID is set, the roles and permissions
+// attributes only hold the ones of that application.
+type SAMLServiceProvider struct {
+	BaseUUIDEntity
+	TenantID          uuid.UUID             `json:"tenant_id" gorm:"type:uuid;uniqueIndex:idx_saml_service_providers_tenant_name;uniqueIndex:idx_saml_service_providers_tenant_entity_id"`
+	Name              string                `json:"name" gorm:"uniqueIndex:idx_saml_service_providers_tenant_name"`
+	EntityID          string                `json:"entity_id" gorm:"uniqueIndex:idx_saml_service_providers_tenant_entity_id"`
+	Disabled          bool                  `json:"disabled"`
+	MetadataURL       string                `json:"metadata_url"`
+	Metadata          string                `json:"metadata" gorm:"type:text"`
+	NameIDFormat      string                `json:"name_id_format"`
+	ApplicationID     *uuid.UUID            `json:"application_id" gorm:"type:uuid"`
+	Application       *Application          `json:"application"`
+	AttributeMappings SAMLAttributeMappings `json:"attribute_mappings" gorm:"type:text"`
+}
+
+// SAMLAttributeMapping releases a property of the user to the service
+// provider as an attribute with the given name.
+type SAMLAttributeMapping struct {
+	Name         string `json:"name"`
+	FriendlyName string `json:"friendly_name,omitempty"`
+	Source       string `json:"source"`
+}
+
+// SAMLAttributeMappings is stored as a JSON document.
+type SAMLAttributeMappings []*SAMLAttributeMapping
+
+// DefaultSAMLAttributeMappings are the attributes released to service
+// providers registered without attribute mappings.
+func DefaultSAMLAttributeMappings() SAMLAttributeMappings {
+	return SAMLAttributeMappings{
+		{Name: "urn:oid:0.9.2342.19200300.100.1.1", FriendlyName: "uid", Source: SAML_ATTRIBUTE_SOURCE_USERNAME},
+		{Name: "urn:oid:0.9.2342.19200300.100.1.3", FriendlyName: "mail", Source: SAML_ATTRIBUTE_SOURCE_EMAIL},
+		{Name: "roles", Source: SAML_ATTRIBUTE_SOURCE_ROLES},
+	}
+}
+
+// Value implements driver.Valuer.
+func (m SAMLAttributeMappings) Value() (driver.Value, error) {
+	if m == nil {
+		return "[]", nil
+	}
+	value, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(value), nil
+}
+
+// Scan implements sql.Scanner.
+func (m *SAMLAttributeMappings) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(value, m)
+	case string:
+		return json.Unmarshal([]byte(value), m)
+	default:
+		return fmt.Errorf("cannot scan %T into SAMLAttributeMappings", src)
+	}
+}
+
+// Validate checks that the service provider holds the configuration assertions
+// are built from.
+func (p *SAMLServiceProvider) Validate() error {
+	if p.Name == "" {
+		return errors.New("service provider name cannot be blank")
+	}
+	if p.Metadata == "" && p.MetadataURL == "" {
+		return errors.New("either metadata or metadata_url is required")
+	}
+	if p.MetadataURL != "" {
+		metadataURL, err := url.Parse(p.MetadataURL)
+		if err != nil || !metadataURL.IsAbs() || metadataURL.Host == "" {
+			return errors.New("metadata_url must be an absolute URL")
+		}
+	}
+	switch p.NameIDFormat {
+	case SAML_NAMEID_FORMAT_PERSISTENT, SAML_NAMEID_FORMAT_TRANSIENT, SAML_NAMEID_FORMAT_EMAIL, SAML_NAMEID_FORMAT_UNSPECIFIED:
+	default:
+		return errors.New("name_id_format must be one of persistent, transient, email or unspecified")
+	}
+	names := make(map[string]bool)
+	for _, mapping := range p.AttributeMappings {
+		if mapping.Name == "" {
+			return errors.New("attribute mappings require a name")
+		}
+		if names[mapping.Name] {
+			return fmt.Errorf("attribute %q is mapped more than once", mapping.Name)
+		}
+		names[mapping.Name] = true
+		switch mapping.Source {
+		case SAML_ATTRIBUTE_SOURCE_ID, SAML_ATTRIBUTE_SOURCE_USERNAME, SAML_ATTRIBUTE_SOURCE_EMAIL,
+			SAML_ATTRIBUTE_SOURCE_ROLES, SAML_ATTRIBUTE_SOURCE_PERMISSIONS, SAML_ATTRIBUTE_SOURCE_GROUPS:
+		default:
+			return fmt.Errorf("unknown attribute source %q", mapping.Source)
+		}
+	}
+	return nil
+}
+
+// NewSAMLTransientNameID returns a random name for the subject of an
+// assertion, which service providers cannot correlate across logins.
+func NewSAMLTransientNameID() (string, error) {
+	return randomString(32)
+}
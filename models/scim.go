@@ -0,0 +1,175 @@
+package models
+
+import (
+	"encoding/json"
+)
+
+// SCIM schema URIs, see RFC 7643 and RFC 7644
+const (
+	SCIM_SCHEMA_USER                    string = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SCIM_SCHEMA_GROUP                   string = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SCIM_SCHEMA_SERVICE_PROVIDER_CONFIG string = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SCIM_SCHEMA_RESOURCE_TYPE           string = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+	SCIM_SCHEMA_SCHEMA                  string = "urn:ietf:params:scim:schemas:core:2.0:Schema"
+	SCIM_MESSAGE_LIST_RESPONSE          string = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SCIM_MESSAGE_PATCH_OP               string = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SCIM_MESSAGE_ERROR                  string = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// SCIM PATCH operations, see RFC 7644, section 3.5.2
+const (
+	SCIM_PATCH_OP_ADD     string = "add"
+	SCIM_PATCH_OP_REMOVE  string = "remove"
+	SCIM_PATCH_OP_REPLACE string = "replace"
+)
+
+// SCIMMeta holds the metadata of a SCIM resource.
+type SCIMMeta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Location     string `json:"location,omitempty"`
+}
+
+// SCIMMultiValue is an entry of a multi-valued SCIM attribute, such as the
+// emails, roles or groups of a user, or the members of a group.
+type SCIMMultiValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// SCIMUser is the representation of a user as a SCIM resource. Users are
+// identified by their id, and named by their userName. Their first email is
+// their primary one. Groups are read-only: group membership is managed
+// through the members of groups. Roles hold the ids of the roles assigned to
+// the user directly. Password is write-only.
+type SCIMUser struct {
+	Schemas  []string          `json:"schemas"`
+	ID       string            `json:"id,omitempty"`
+	UserName string            `json:"userName"`
+	Password string            `json:"password,omitempty"`
+	Active   *bool             `json:"active,omitempty"`
+	Emails   []*SCIMMultiValue `json:"emails,omitempty"`
+	Groups   []*SCIMMultiValue `json:"groups,omitempty"`
+	Roles    []*SCIMMultiValue `json:"roles,omitempty"`
+	Meta     *SCIMMeta         `json:"meta,omitempty"`
+}
+
+// SCIMGroup is the representation of a group as a SCIM resource. Members are
+// users, identified by their id.
+type SCIMGroup struct {
+	Schemas     []string          `json:"schemas"`
+	ID          string            `json:"id,omitempty"`
+	DisplayName string            `json:"displayName"`
+	Members     []*SCIMMultiValue `json:"members,omitempty"`
+	Meta        *SCIMMeta         `json:"meta,omitempty"`
+}
+
+// SCIMListResponse is a page of the resources matching a query, see RFC 7644,
+// section 3.4.2. StartIndex is 1-based.
+type SCIMListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int64       `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+// SCIMPatchRequest is the body of a PATCH request, see RFC 7644, section 3.5.2.
+type SCIMPatchRequest struct {
+	Schemas    []string              `json:"schemas"`
+	Operations []*SCIMPatchOperation `json:"Operations"`
+}
+
+// SCIMPatchOperation is an operation of a PATCH request. Path is empty when
+// Value holds the attributes to modify.
+type SCIMPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// SCIMErrorResponse is the body of SCIM error responses, see RFC 7644,
+// section 3.12. The status is a string holding the HTTP status code.
+type SCIMErrorResponse struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// SCIMServiceProviderConfig describes the SCIM features the server supports,
+// see RFC 7643, section 5.
+type SCIMServiceProviderConfig struct {
+	Schemas               []string                    `json:"schemas"`
+	DocumentationURI      string                      `json:"documentationUri,omitempty"`
+	Patch                 SCIMSupported               `json:"patch"`
+	Bulk                  SCIMBulkSupport             `json:"bulk"`
+	Filter                SCIMFilterSupport           `json:"filter"`
+	ChangePassword        SCIMSupported               `json:"changePassword"`
+	Sort                  SCIMSupported               `json:"sort"`
+	ETag                  SCIMSupported               `json:"etag"`
+	AuthenticationSchemes []*SCIMAuthenticationScheme `json:"authenticationSchemes"`
+	Meta                  *SCIMMeta                   `json:"meta,omitempty"`
+}
+
+type SCIMSupported struct {
+	Supported bool `json:"supported"`
+}
+
+type SCIMBulkSupport struct {
+	Supported      bool `json:"supported"`
+	MaxOperations  int  `json:"maxOperations"`
+	MaxPayloadSize int  `json:"maxPayloadSize"`
+}
+
+type SCIMFilterSupport struct {
+	Supported  bool `json:"supported"`
+	MaxResults int  `json:"maxResults"`
+}
+
+type SCIMAuthenticationScheme struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Primary     bool   `json:"primary,omitempty"`
+}
+
+// SCIMResourceType describes an endpoint serving a type of resource, see
+// RFC 7643, section 6.
+type SCIMResourceType struct {
+	Schemas     []string  `json:"schemas"`
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Endpoint    string    `json:"endpoint"`
+	Description string    `json:"description,omitempty"`
+	Schema      string    `json:"schema"`
+	Meta        *SCIMMeta `json:"meta,omitempty"`
+}
+
+// SCIMSchema describes the attributes of a type of resource, see RFC 7643,
+// section 7.
+type SCIMSchema struct {
+	Schemas     []string               `json:"schemas"`
+	ID          string                 `json:"id"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Attributes  []*SCIMSchemaAttribute `json:"attributes"`
+	Meta        *SCIMMeta              `json:"meta,omitempty"`
+}
+
+type SCIMSchemaAttribute struct {
+	Name          string                 `json:"name"`
+	Type          string                 `json:"type"`
+	MultiValued   bool                   `json:"multiValued"`
+	Description   string                 `json:"description,omitempty"`
+	Required      bool                   `json:"required"`
+	CaseExact     bool                   `json:"caseExact"`
+	Mutability    string                 `json:"mutability"`
+	Returned      string                 `json:"returned"`
+	Uniqueness    string                 `json:"uniqueness"`
+	SubAttributes []*SCIMSchemaAttribute `json:"subAttributes,omitempty"`
+}
@@ -0,0 +1,168 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SCIM filter operators, see RFC 7644, section 3.4.2.2
+const (
+	SCIM_FILTER_EQ string = "eq"
+	SCIM_FILTER_NE string = "ne"
+	SCIM_FILTER_CO string = "co"
+	SCIM_FILTER_SW string = "sw"
+	SCIM_FILTER_EW string = "ew"
+	SCIM_FILTER_PR string = "pr"
+	SCIM_FILTER_GT string = "gt"
+	SCIM_FILTER_GE string = "ge"
+	SCIM_FILTER_LT string = "lt"
+	SCIM_FILTER_LE string = "le"
+)
+
+var scimFilterOperators = map[string]bool{
+	SCIM_FILTER_EQ: true, SCIM_FILTER_NE: true, SCIM_FILTER_CO: true, SCIM_FILTER_SW: true, SCIM_FILTER_EW: true,
+	SCIM_FILTER_PR: true, SCIM_FILTER_GT: true, SCIM_FILTER_GE: true, SCIM_FILTER_LT: true, SCIM_FILTER_LE: true,
+}
+
+// SCIMComparison compares an attribute of a resource with a value, such as
+// `userName eq "bjensen"`. Attribute names are case-insensitive, and are kept
+// lowercased. Value is a string, a bool, a float64 or nil, and is nil for the
+// pr operator.
+type SCIMComparison struct {
+	Attribute string
+	Operator  string
+	Value     interface{}
+}
+
+// SCIMFilter is a filter of SCIM resources, in disjunctive normal form: a
+// resource matches the filter if it matches every comparison of any of its
+// terms. An empty filter matches every resource.
+type SCIMFilter [][]*SCIMComparison
+
+type scimFilterToken struct {
+	text   string
+	quoted bool
+}
+
+// ParseSCIMFilter parses a filter made of comparisons joined by "and" and
+// "or", "and" taking precedence. Grouping with parentheses, negation and
+// value paths such as `emails[type eq "work"]` are not supported.
+func ParseSCIMFilter(filter string) (SCIMFilter, error) {
+	tokens, err := tokenizeSCIMFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	result := SCIMFilter{{}}
+	for i := 0; i < len(tokens); {
+		if len(tokens)-i < 2 || tokens[i].quoted {
+			return nil, errors.New("expected an attribute and an operator")
+		}
+		comparison := &SCIMComparison{
+			Attribute: strings.ToLower(tokens[i].text),
+			Operator:  strings.ToLower(tokens[i+1].text),
+		}
+		if !scimFilterOperators[comparison.Operator] {
+			return nil, fmt.Errorf("unknown operator %q", tokens[i+1].text)
+		}
+		i += 2
+		if comparison.Operator != SCIM_FILTER_PR {
+			if i == len(tokens) {
+				return nil, fmt.Errorf("operator %q requires a value", comparison.Operator)
+			}
+			comparison.Value, err = scimFilterValue(tokens[i])
+			if err != nil {
+				return nil, err
+			}
+			i++
+		}
+		term := result[len(result)-1]
+		result[len(result)-1] = append(term, comparison)
+
+		if i == len(tokens) {
+			break
+		}
+		switch strings.ToLower(tokens[i].text) {
+		case "and":
+		case "or":
+			result = append(result, []*SCIMComparison{})
+		default:
+			return nil, fmt.Errorf("expected \"and\" or \"or\", not %q", tokens[i].text)
+		}
+		i++
+		if i == len(tokens) {
+			return nil, errors.New("the filter ends with a logical operator")
+		}
+	}
+	return result, nil
+}
+
+// tokenizeSCIMFilter splits the filter into words and quoted strings.
+func tokenizeSCIMFilter(filter string) ([]scimFilterToken, error) {
+	var tokens []scimFilterToken
+	for i := 0; i < len(filter); {
+		switch c := filter[i]; {
+		case c == ' ':
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(filter) && filter[end] != '"' {
+				if filter[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(filter) {
+				return nil, errors.New("unterminated string")
+			}
+			var value string
+			err := json.Unmarshal([]byte(filter[i:end+1]), &value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid string %s", filter[i:end+1])
+			}
+			tokens = append(tokens, scimFilterToken{text: value, quoted: true})
+			i = end + 1
+		case c == '(' || c == ')' || c == '[' || c == ']':
+			return nil, errors.New("grouping and value paths are not supported")
+		default:
+			end := strings.IndexAny(filter[i:], " \"()[]")
+			if end < 0 {
+				end = len(filter) - i
+			}
+			word := filter[i : i+end]
+			if strings.EqualFold(word, "not") {
+				return nil, errors.New("negation is not supported")
+			}
+			tokens = append(tokens, scimFilterToken{text: word})
+			i += end
+		}
+	}
+	return tokens, nil
+}
+
+// scimFilterValue returns the value of a comparison: a string, true, false,
+// null or a number.
+func scimFilterValue(token scimFilterToken) (interface{}, error) {
+	if token.quoted {
+		return token.text, nil
+	}
+	switch token.text {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	number, err := strconv.ParseFloat(token.text, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q", token.text)
+	}
+	return number, nil
+}
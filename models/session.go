@@ -0,0 +1,75 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Authentication methods, using the values of RFC 8176 where one applies.
+// Users logging in through an upstream identity provider are authenticated
+// with the "fed" method.
+const (
+	AUTH_METHOD_PASSWORD  string = "pwd"
+	AUTH_METHOD_FEDERATED string = "fed"
+)
+
+// Session is a user's login session in a browser, identified by the session
+// cookie the browser holds. Only the SHA-256 digest of the cookie value is
+// stored. AuthTime is when the user last entered their credentials, and
+// AuthMethods how they did. ClientIDs lists the clients the user authorized
+// during the session, which are notified when it ends. Sessions end after a
+// period of inactivity, and at ExpiresAt at the latest.
+type Session struct {
+	BaseUUIDEntity
+	TenantID    uuid.UUID  `json:"tenant_id" gorm:"type:uuid;index"`
+	TokenHash   string     `json:"-" gorm:"unique"`
+	UserID      uuid.UUID  `json:"user_id" gorm:"type:uuid;index"`
+	User        *User      `json:"user"`
+	IPAddress   string     `json:"ip_address"`
+	UserAgent   string     `json:"user_agent"`
+	AuthMethods StringList `json:"auth_methods" gorm:"type:jsonb"`
+	AuthTime    time.Time  `json:"auth_time"`
+	ClientIDs   StringList `json:"client_ids" gorm:"type:jsonb"`
+	LastSeenAt  time.Time  `json:"last_seen_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+}
+
+// NewSession creates a session of the user who just authenticated with the
+// given methods, and returns it along with the value of its cookie.
+func NewSession(userId uuid.UUID, ipAddress string, userAgent string, authMethods []string, lifetime time.Duration) (*Session, string, error) {
+	token, err := randomString(32)
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now()
+	return &Session{
+		BaseUUIDEntity: BaseUUIDEntity{
+			ID: uuid.New(),
+		},
+		TokenHash:   HashSessionToken(token),
+		UserID:      userId,
+		IPAddress:   ipAddress,
+		UserAgent:   userAgent,
+		AuthMethods: authMethods,
+		AuthTime:    now,
+		ClientIDs:   StringList{},
+		LastSeenAt:  now,
+		ExpiresAt:   now.Add(lifetime),
+	}, token, nil
+}
+
+// HashSessionToken returns the digest the value of a session cookie is stored as.
+func HashSessionToken(token string) string {
+	digest := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(digest[:])
+}
+
+// IsActive returns true if the session has neither expired nor been idle for
+// longer than idleTimeout.
+func (s *Session) IsActive(idleTimeout time.Duration) bool {
+	now := time.Now()
+	return now.Before(s.ExpiresAt) && now.Before(s.LastSeenAt.Add(idleTimeout))
+}
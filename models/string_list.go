@@ -0,0 +1,47 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// StringList is a list of strings stored as a JSON array.
+type StringList []string
+
+// Value implements driver.Valuer.
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	value, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return string(value), nil
+}
+
+// Scan implements sql.Scanner.
+func (l *StringList) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(value, l)
+	case string:
+		return json.Unmarshal([]byte(value), l)
+	default:
+		return fmt.Errorf("cannot scan %T into StringList", src)
+	}
+}
+
+// Contains returns true if the list holds the value.
+func (l StringList) Contains(value string) bool {
+	for _, v := range l {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"errors"
+	"strings"
+)
+
+// DEFAULT_TENANT_NAME is the name of the realm requests belong to unless they
+// are addressed to another one. Data created before realms existed is moved
+// into it.
+const DEFAULT_TENANT_NAME string = "default"
+
+// Tenant is an isolated realm of users, clients, applications, roles, groups,
+// policies and identity providers. Usernames, emails, client names,
+// application names and provider names only need to be unique within a realm,
+// and the entities of a realm cannot be seen from another one.
+//
+// Requests are addressed to a realm either with the /realms/{name} path
+// prefix, or by being sent to the realm's Host. Tokens issued in a realm
+// carry its own issuer, and are signed with its own SigningSecret, so that
+// they are only accepted by that realm. The default realm signs tokens with
+// the server's secret. Disabled realms are not served.
+type Tenant struct {
+	BaseUUIDEntity
+	Name          string `json:"name" gorm:"unique"`
+	DisplayName   string `json:"display_name"`
+	Host          string `json:"host" gorm:"index"`
+	Disabled      bool   `json:"disabled"`
+	SigningSecret string `json:"-"`
+}
+
+// IsDefault returns true if the tenant is the default realm.
+func (t *Tenant) IsDefault() bool {
+	return t.Name == DEFAULT_TENANT_NAME
+}
+
+// Validate checks that the name of the tenant can be used in paths, and that
+// its host is a bare host name.
+func (t *Tenant) Validate() error {
+	if t.Name == "" {
+		return errors.New("name cannot be blank")
+	}
+	if len(t.Name) > 63 {
+		return errors.New("name cannot be longer than 63 characters")
+	}
+	for i, c := range t.Name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && (c != '-' || i == 0) {
+			return errors.New("name must only contain lowercase letters, digits and dashes, and start with a letter or digit")
+		}
+	}
+	if t.Host != "" && (strings.ContainsAny(t.Host, "/?#@ ") || t.Host != strings.ToLower(t.Host)) {
+		return errors.New("host must be a lowercase host name, without scheme or path")
+	}
+	return nil
+}
+
+// NewTenantSigningSecret returns a new random secret to sign the tokens of a
+// realm with.
+func NewTenantSigningSecret() (string, error) {
+	return randomString(32)
+}
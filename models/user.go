@@ -6,14 +6,16 @@ import (
 
 type User struct {
 	BaseUUIDEntity
-	Email                 string  `json:"email" gorm:"unique"`
-	Username              string  `json:"username" gorm:"unique"`
-	Password              string  `json:"password"`
-	Enabled               bool    `json:"enabled"`
-	AccountNonLocked      bool    `json:"account_non_locked"`
-	AccountNonExpired     bool    `json:"account_non_expired"`
-	CredentialsNonExpired bool    `json:"credentials_non_expired"`
-	Roles                 []*Role `json:"roles" gorm:"many2many:user_roles;"`
+	TenantID              uuid.UUID `json:"tenant_id" gorm:"type:uuid;uniqueIndex:idx_users_tenant_email;uniqueIndex:idx_users_tenant_username"`
+	Email                 string    `json:"email" gorm:"uniqueIndex:idx_users_tenant_email"`
+	Username              string    `json:"username" gorm:"uniqueIndex:idx_users_tenant_username"`
+	Password              string    `json:"password"`
+	Enabled               bool      `json:"enabled"`
+	AccountNonLocked      bool      `json:"account_non_locked"`
+	AccountNonExpired     bool      `json:"account_non_expired"`
+	CredentialsNonExpired bool      `json:"credentials_non_expired"`
+	Roles                 []*Role   `json:"roles" gorm:"many2many:user_roles;"`
+	Groups                []*Group  `json:"groups" gorm:"many2many:user_groups;"`
 }
 
 // NewUser creates a new user from a SignupRequest.
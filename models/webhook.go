@@ -0,0 +1,162 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Webhook event types
+const (
+	WEBHOOK_EVENT_USER_CREATED       string = "user.created"
+	WEBHOOK_EVENT_USER_UPDATED       string = "user.updated"
+	WEBHOOK_EVENT_USER_DISABLED      string = "user.disabled"
+	WEBHOOK_EVENT_USER_DELETED       string = "user.deleted"
+	WEBHOOK_EVENT_USER_ROLES_CHANGED string = "user.roles_changed"
+	WEBHOOK_EVENT_ROLE_CREATED       string = "role.created"
+	WEBHOOK_EVENT_ROLE_UPDATED       string = "role.updated"
+	WEBHOOK_EVENT_TOKEN_ISSUED       string = "token.issued"
+)
+
+// WebhookEventTypes lists the event types webhooks can subscribe to.
+var WebhookEventTypes = StringList{
+	WEBHOOK_EVENT_USER_CREATED,
+	WEBHOOK_EVENT_USER_UPDATED,
+	WEBHOOK_EVENT_USER_DISABLED,
+	WEBHOOK_EVENT_USER_DELETED,
+	WEBHOOK_EVENT_USER_ROLES_CHANGED,
+	WEBHOOK_EVENT_ROLE_CREATED,
+	WEBHOOK_EVENT_ROLE_UPDATED,
+	WEBHOOK_EVENT_TOKEN_ISSUED,
+}
+
+// Headers of the requests sent to webhooks
+const (
+	WEBHOOK_HEADER_EVENT_ID  string = "X-Webhook-Id"
+	WEBHOOK_HEADER_EVENT     string = "X-Webhook-Event"
+	WEBHOOK_HEADER_TIMESTAMP string = "X-Webhook-Timestamp"
+	WEBHOOK_HEADER_SIGNATURE string = "X-Webhook-Signature"
+)
+
+// Webhook delivery statuses
+const (
+	WEBHOOK_DELIVERY_PENDING   string = "pending"
+	WEBHOOK_DELIVERY_DELIVERED string = "delivered"
+	WEBHOOK_DELIVERY_FAILED    string = "failed"
+)
+
+// Webhook is a subscription of a downstream system to the identity events of
+// a realm. Events are posted as JSON to the URL, signed with the Secret so
+// that the receiver can check they were sent by the server. Disabled webhooks
+// are not sent new events.
+type Webhook struct {
+	BaseUUIDEntity
+	TenantID uuid.UUID  `json:"tenant_id" gorm:"type:uuid;index"`
+	Name     string     `json:"name"`
+	URL      string     `json:"url"`
+	Events   StringList `json:"events" gorm:"type:jsonb"`
+	Secret   string     `json:"-"`
+	Disabled bool       `json:"disabled"`
+}
+
+// Subscribes returns true if the webhook is sent events of the given type.
+func (w *Webhook) Subscribes(eventType string) bool {
+	return !w.Disabled && w.Events.Contains(eventType)
+}
+
+// Validate checks that the webhook has a name, an absolute HTTP URL, and
+// subscribes to known event types only.
+func (w *Webhook) Validate() error {
+	if w.Name == "" {
+		return errors.New("name cannot be blank")
+	}
+	target, err := url.Parse(w.URL)
+	if err != nil || (target.Scheme != "https" && target.Scheme != "http") || target.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	if len(w.Events) == 0 {
+		return errors.New("events cannot be empty")
+	}
+	for _, eventType := range w.Events {
+		if !WebhookEventTypes.Contains(eventType) {
+			return fmt.Errorf("unknown event type %q", eventType)
+		}
+	}
+	return nil
+}
+
+// Sign returns the signature of a payload sent at the given time: the
+// hex-encoded HMAC-SHA256 of the Unix timestamp, a dot and the payload, keyed
+// with the webhook's secret. Covering the timestamp lets receivers reject
+// replayed deliveries.
+func (w *Webhook) Sign(timestamp time.Time, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(w.Secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewWebhookSecret returns a new random secret to sign the events sent to a
+// webhook with.
+func NewWebhookSecret() (string, error) {
+	return randomString(32)
+}
+
+// WebhookEvent is the body of the requests sent to webhooks.
+type WebhookEvent struct {
+	ID      string      `json:"id"`
+	Type    string      `json:"type"`
+	Realm   string      `json:"realm"`
+	Created string      `json:"created_at"`
+	Data    interface{} `json:"data"`
+}
+
+// RoleEvent is the data of role events.
+type RoleEvent struct {
+	Role        *RoleDto         `json:"role"`
+	Permissions []*PermissionDto `json:"permissions"`
+}
+
+// TokenEvent is the data of token.issued events. The token itself is left
+// out.
+type TokenEvent struct {
+	ClientID  string   `json:"client_id"`
+	GrantType string   `json:"grant_type"`
+	Subject   string   `json:"sub"`
+	Audience  string   `json:"aud"`
+	Scope     []string `json:"scope,omitempty"`
+	TokenID   string   `json:"jti"`
+	ExpiresAt int64    `json:"exp"`
+}
+
+// WebhookDelivery is the delivery of an event to a webhook, kept as an outbox:
+// deliveries are stored as soon as the event occurs and sent in the
+// background, so that they outlive restarts of the server and outages of the
+// receiver. Failed attempts are retried with exponential backoff until the
+// delivery succeeds or runs out of attempts, and the outcome of the last
+// attempt is kept as the webhook's delivery log.
+type WebhookDelivery struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	TenantID       uuid.UUID  `json:"tenant_id" gorm:"type:uuid;index"`
+	WebhookID      uuid.UUID  `json:"webhook_id" gorm:"type:uuid;index"`
+	Webhook        *Webhook   `json:"-"`
+	EventID        string     `json:"event_id" gorm:"index"`
+	EventType      string     `json:"event_type"`
+	Payload        string     `json:"payload" gorm:"type:text"`
+	Status         string     `json:"status" gorm:"index"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at" gorm:"index"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at"`
+	ResponseStatus int        `json:"response_status"`
+	LastError      string     `json:"last_error"`
+}
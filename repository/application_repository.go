@@ -4,6 +4,7 @@ import (
 	"auth-server/models"
 	"context"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
@@ -17,6 +18,14 @@ func NewApplicationRepository(db *gorm.DB) *ApplicationRepository {
 	}
 }
 
+// WithTenant returns a copy of the repository that only sees the applications of
+// the tenant, and assigns the applications it creates to it.
+func (p *ApplicationRepository) WithTenant(tenantId uuid.UUID) *ApplicationRepository {
+	return &ApplicationRepository{
+		db: bindTenant(p.db, tenantId),
+	}
+}
+
 func (p *ApplicationRepository) FindAll(ctx context.Context) ([]*models.Application, error) {
 	var applications []*models.Application
 	err := p.db.WithContext(ctx).Find(&applications).Error
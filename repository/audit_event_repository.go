@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"auth-server/models"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// auditChainLock is the key of the advisory lock serializing the events
+// appended to hash chains.
+const auditChainLock = 7236083
+
+// ErrAuditEventImmutable is returned when attempting to modify or delete an
+// audit event.
+var ErrAuditEventImmutable = errors.New("audit events cannot be modified or deleted")
+
+type AuditEventRepository struct {
+	db *gorm.DB
+}
+
+func NewAuditEventRepository(db *gorm.DB) *AuditEventRepository {
+	return &AuditEventRepository{
+		db: db,
+	}
+}
+
+// WithTenant returns a copy of the repository that only sees the audit events
+// of the tenant, and assigns the events it appends to it.
+func (p *AuditEventRepository) WithTenant(tenantId uuid.UUID) *AuditEventRepository {
+	return &AuditEventRepository{
+		db: bindTenant(p.db, tenantId),
+	}
+}
+
+func (p *AuditEventRepository) FindAll(ctx context.Context) ([]*models.AuditEvent, error) {
+	var events []*models.AuditEvent
+	err := p.db.WithContext(ctx).Order("id").Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (p *AuditEventRepository) FindById(ctx context.Context, id string) (*models.AuditEvent, error) {
+	var event models.AuditEvent
+	err := p.db.WithContext(ctx).Where("id = ?", id).First(&event).Error
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// FindByFilter returns a page of the events matching the filter, most recent
+// first, along with the number of events matching it.
+func (p *AuditEventRepository) FindByFilter(ctx context.Context, filter *models.AuditFilter, offset int, limit int) ([]*models.AuditEvent, int64, error) {
+	query := p.db.WithContext(ctx).Model(&models.AuditEvent{})
+	for column, value := range map[string]string{
+		"actor":      filter.Actor,
+		"action":     filter.Action,
+		"target":     filter.Target,
+		"outcome":    filter.Outcome,
+		"request_id": filter.RequestID,
+	} {
+		if value != "" {
+			query = query.Where(column+" = ?", value)
+		}
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until)
+	}
+	var total int64
+	err := query.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	var events []*models.AuditEvent
+	err = query.Order("id DESC").Offset(offset).Limit(limit).Find(&events).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+// FindAfter returns up to limit events following the event with the given id,
+// in the order they were appended.
+func (p *AuditEventRepository) FindAfter(ctx context.Context, id uint, limit int) ([]*models.AuditEvent, error) {
+	var events []*models.AuditEvent
+	err := p.db.WithContext(ctx).Where("id > ?", id).Order("id").Limit(limit).Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Save appends a new event. Events that were already stored cannot be saved
+// again.
+func (p *AuditEventRepository) Save(ctx context.Context, entity interface{}) (*models.AuditEvent, error) {
+	event := entity.(*models.AuditEvent)
+	if event.ID != 0 {
+		return nil, ErrAuditEventImmutable
+	}
+	err := p.db.WithContext(ctx).Create(event).Error
+	if err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// Append appends the event to the hash chain of its realm: it is stored along
+// with the hash of the last event, and its own hash. Appends are serialized,
+// so that events are chained in the order they are stored.
+func (p *AuditEventRepository) Append(ctx context.Context, event *models.AuditEvent) (*models.AuditEvent, error) {
+	if event.ID != 0 {
+		return nil, ErrAuditEventImmutable
+	}
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec("SELECT pg_advisory_xact_lock(?)", auditChainLock).Error
+		if err != nil {
+			return err
+		}
+		var last models.AuditEvent
+		err = tx.Order("id DESC").Limit(1).Find(&last).Error
+		if err != nil {
+			return err
+		}
+		// Timestamps are stored with microsecond precision, and must hash
+		// the same once read back.
+		event.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+		event.PreviousHash = last.Hash
+		event.Hash = event.ComputeHash()
+		return tx.Create(event).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+func (p *AuditEventRepository) Delete(ctx context.Context, id string) error {
+	return ErrAuditEventImmutable
+}
+
+// MigrateAppendOnly installs a trigger rejecting the modification and
+// deletion of audit events, so that they cannot be altered by other means
+// than the server's own API either, short of dropping the trigger.
+func (p *AuditEventRepository) MigrateAppendOnly(ctx context.Context) error {
+	return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit events cannot be modified or deleted';
+END;
+$$ LANGUAGE plpgsql`).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Exec("DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events").Error
+		if err != nil {
+			return err
+		}
+		return tx.Exec("CREATE TRIGGER audit_events_append_only BEFORE UPDATE OR DELETE ON audit_events " +
+			"FOR EACH ROW EXECUTE FUNCTION audit_events_append_only()").Error
+	})
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"auth-server/models"
+	"auth-server/repository/repositorytest"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppendAuditEvent(t *testing.T) {
+	tests := []struct {
+		name         string
+		last         *models.AuditEvent
+		previousHash string
+	}{
+		{"first event", nil, ""},
+		{"following event", &models.AuditEvent{ID: 41, Action: "user.create", Hash: "last"}, "last"},
+		{"following an unchained event", &models.AuditEvent{ID: 41, Action: "user.create"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := repositorytest.New(t)
+			if tt.last != nil {
+				fake.Return(`SELECT * FROM "audit_events" ORDER BY id DESC LIMIT 1`, tt.last)
+			}
+			event := &models.AuditEvent{
+				CreatedAt: time.Now().Add(-time.Hour),
+				Actor:     "alice",
+				Action:    "user.update",
+				Target:    "bob",
+				Outcome:   "success",
+				Before:    `{"enabled":true}`,
+				After:     `{"enabled":false}`,
+			}
+
+			before := time.Now()
+			appended, err := NewAuditEventRepository(db).Append(context.Background(), event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if appended.CreatedAt.Before(before.Truncate(time.Microsecond)) || appended.CreatedAt.Nanosecond()%1000 != 0 {
+				t.Errorf("created at = %v, want the time of the append in microseconds", appended.CreatedAt)
+			}
+			if appended.PreviousHash != tt.previousHash {
+				t.Errorf("previous hash = %q, want %q", appended.PreviousHash, tt.previousHash)
+			}
+			if appended.Hash == "" || appended.Hash != appended.ComputeHash() {
+				t.Errorf("hash = %q, want %q", appended.Hash, appended.ComputeHash())
+			}
+
+			statements := fake.Statements()
+			if len(statements) != 3 {
+				t.Fatalf("statements = %q", statements)
+			}
+			// The lock is taken before reading the last event, so that
+			// concurrent appends cannot both chain to it.
+			for i, want := range []string{
+				"SELECT pg_advisory_xact_lock(7236083)",
+				`SELECT * FROM "audit_events" ORDER BY id DESC LIMIT 1`,
+				`INSERT INTO "audit_events"`,
+			} {
+				if !strings.Contains(statements[i], want) {
+					t.Errorf("statement %d = %q, want it to contain %q", i, statements[i], want)
+				}
+			}
+			if !strings.Contains(statements[2], "'"+tt.previousHash+"','"+appended.Hash+"'") {
+				t.Errorf("the hashes are not stored: %s", statements[2])
+			}
+		})
+	}
+}
+
+func TestAuditEventsAreImmutable(t *testing.T) {
+	db, fake := repositorytest.New(t)
+	repo := NewAuditEventRepository(db)
+	stored := &models.AuditEvent{ID: 1, Action: "user.create"}
+
+	_, err := repo.Append(context.Background(), stored)
+	if !errors.Is(err, ErrAuditEventImmutable) {
+		t.Errorf("append error = %v, want %v", err, ErrAuditEventImmutable)
+	}
+	_, err = repo.Save(context.Background(), stored)
+	if !errors.Is(err, ErrAuditEventImmutable) {
+		t.Errorf("save error = %v, want %v", err, ErrAuditEventImmutable)
+	}
+	err = repo.Delete(context.Background(), "1")
+	if !errors.Is(err, ErrAuditEventImmutable) {
+		t.Errorf("delete error = %v, want %v", err, ErrAuditEventImmutable)
+	}
+	if statements := fake.Statements(); len(statements) != 0 {
+		t.Errorf("statements = %q", statements)
+	}
+}
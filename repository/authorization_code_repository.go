@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"auth-server/models"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type AuthorizationCodeRepository struct {
+	db *gorm.DB
+}
+
+func NewAuthorizationCodeRepository(db *gorm.DB) *AuthorizationCodeRepository {
+	return &AuthorizationCodeRepository{
+		db: db,
+	}
+}
+
+func (p *AuthorizationCodeRepository) FindAll(ctx context.Context) ([]*models.AuthorizationCode, error) {
+	var codes []*models.AuthorizationCode
+	err := p.db.WithContext(ctx).Find(&codes).Error
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (p *AuthorizationCodeRepository) FindById(ctx context.Context, id string) (*models.AuthorizationCode, error) {
+	return p.findOne(ctx, "id = ?", id)
+}
+
+// FindByCode returns the authorization code with the given value, or nil if
+// there is none.
+func (p *AuthorizationCodeRepository) FindByCode(ctx context.Context, code string) (*models.AuthorizationCode, error) {
+	return p.findOne(ctx, "code_hash = ?", models.HashAuthorizationCode(code))
+}
+
+func (p *AuthorizationCodeRepository) findOne(ctx context.Context, query string, args ...interface{}) (*models.AuthorizationCode, error) {
+	var code models.AuthorizationCode
+	err := p.db.WithContext(ctx).Where(query, args...).First(&code).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+func (p *AuthorizationCodeRepository) Save(ctx context.Context, entity interface{}) (*models.AuthorizationCode, error) {
+	code := entity.(*models.AuthorizationCode)
+	err := p.db.WithContext(ctx).Save(code).Error
+	if err != nil {
+		return nil, err
+	}
+	return code, nil
+}
+
+func (p *AuthorizationCodeRepository) Delete(ctx context.Context, id string) error {
+	err := p.db.WithContext(ctx).Where("id = ?", id).Delete(&models.AuthorizationCode{}).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Consume deletes the authorization code with the given id, and returns false
+// if it had already been deleted, e.g. by a concurrent request.
+func (p *AuthorizationCodeRepository) Consume(ctx context.Context, id string) (bool, error) {
+	result := p.db.WithContext(ctx).Where("id = ?", id).Delete(&models.AuthorizationCode{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// DeleteExpired removes the authorization codes that expired before the given time.
+func (p *AuthorizationCodeRepository) DeleteExpired(ctx context.Context, before time.Time) error {
+	return p.db.WithContext(ctx).Where("expires_at < ?", before).Delete(&models.AuthorizationCode{}).Error
+}
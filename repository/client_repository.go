@@ -3,8 +3,10 @@ package repository
 import (
 	"auth-server/models"
 	"context"
-	"log"
+	"encoding/json"
+	"errors"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
@@ -18,6 +20,14 @@ func NewClientRepository(db *gorm.DB) *ClientRepository {
 	}
 }
 
+// WithTenant returns a copy of the repository that only sees the clients of
+// the tenant, and assigns the clients it creates to it.
+func (p *ClientRepository) WithTenant(tenantId uuid.UUID) *ClientRepository {
+	return &ClientRepository{
+		db: bindTenant(p.db, tenantId),
+	}
+}
+
 func (p *ClientRepository) FindAll(ctx context.Context) ([]*models.Client, error) {
 	var clients []*models.Client
 	err := p.db.WithContext(ctx).Find(&clients).Error
@@ -29,14 +39,42 @@ func (p *ClientRepository) FindAll(ctx context.Context) ([]*models.Client, error
 
 func (p *ClientRepository) FindById(ctx context.Context, id string) (*models.Client, error) {
 	var client models.Client
-	err := p.db.WithContext(ctx).Where("id = ?", id).First(&client).Error
-	log.Println(err)
+	err := p.db.WithContext(ctx).Preload("ExchangeAudiences").Where("id = ?", id).First(&client).Error
 	if err != nil {
 		return nil, err
 	}
 	return &client, nil
 }
 
+// FindByName returns the client with the given name, or nil if there is none.
+func (p *ClientRepository) FindByName(ctx context.Context, name string) (*models.Client, error) {
+	var client models.Client
+	err := p.db.WithContext(ctx).Where("client_name = ?", name).First(&client).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// HasAllowedOrigin returns true if any enabled client allows the CORS origin.
+func (p *ClientRepository) HasAllowedOrigin(ctx context.Context, origin string) (bool, error) {
+	value, err := json.Marshal([]string{origin})
+	if err != nil {
+		return false, err
+	}
+	var count int64
+	err = p.db.WithContext(ctx).Model(&models.Client{}).
+		Where("allowed_origins @> ?::jsonb AND disabled = ?", string(value), false).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
 func (p *ClientRepository) Save(ctx context.Context, entity interface{}) (*models.Client, error) {
 	client := entity.(*models.Client)
 	err := p.db.WithContext(ctx).Save(client).Error
@@ -47,10 +85,111 @@ func (p *ClientRepository) Save(ctx context.Context, entity interface{}) (*model
 	return client, nil
 }
 
-func (p *ClientRepository) Delete(ctx context.Context, id string) error {
-	err := p.db.WithContext(ctx).Where("id = ?", id).Delete(&models.Client{}).Error
+func (p *ClientRepository) AddExchangeAudiences(ctx context.Context, client *models.Client, apps []*models.Application) error {
+	err := p.db.WithContext(ctx).Model(client).Association("ExchangeAudiences").Append(apps)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p *ClientRepository) AssignExchangeAudiences(ctx context.Context, client *models.Client, apps []*models.Application) error {
+	err := p.db.WithContext(ctx).Model(client).Association("ExchangeAudiences").Replace(apps)
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+// MigrateClientDefaults sets the type and grant types of clients created
+// before clients had them. Clients that do not authenticate become public
+// clients, and clients keep access to the grant types the token endpoint
+// supported so far.
+func (p *ClientRepository) MigrateClientDefaults(ctx context.Context) error {
+	return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(
+			"UPDATE clients SET client_type = CASE WHEN token_endpoint_auth_method = ? THEN ? ELSE ? END "+
+				"WHERE client_type IS NULL OR client_type = ''",
+			models.CLIENT_AUTH_NONE, models.CLIENT_TYPE_PUBLIC, models.CLIENT_TYPE_CONFIDENTIAL,
+		).Error
+		if err != nil {
+			return err
+		}
+		publicGrantTypes, err := json.Marshal([]string{
+			models.GRANT_TYPE_PASSWORD, models.GRANT_TYPE_DEVICE_CODE, models.GRANT_TYPE_TOKEN_EXCHANGE,
+		})
+		if err != nil {
+			return err
+		}
+		confidentialGrantTypes, err := json.Marshal([]string{
+			models.GRANT_TYPE_CLIENT_CREDENTIALS, models.GRANT_TYPE_PASSWORD, models.GRANT_TYPE_DEVICE_CODE, models.GRANT_TYPE_TOKEN_EXCHANGE,
+		})
+		if err != nil {
+			return err
+		}
+		return tx.Exec(
+			"UPDATE clients SET grant_types = CASE WHEN client_type = ? THEN ?::jsonb ELSE ?::jsonb END "+
+				"WHERE grant_types IS NULL",
+			models.CLIENT_TYPE_PUBLIC, string(publicGrantTypes), string(confidentialGrantTypes),
+		).Error
+	})
+}
+
+// MigrateLegacyRedirectURIs moves the single redirect URI clients used to
+// have, stored in the clients.redirect_uri column, into their list of
+// redirect URIs, and drops the column afterwards.
+func (p *ClientRepository) MigrateLegacyRedirectURIs(ctx context.Context) error {
+	migrator := p.db.WithContext(ctx).Migrator()
+	if !migrator.HasColumn(&models.Client{}, "redirect_uri") {
+		return nil
+	}
+	return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(
+			"UPDATE clients SET redirect_uris = jsonb_build_array(redirect_uri) " +
+				"WHERE redirect_uri IS NOT NULL AND redirect_uri <> '' " +
+				"AND (redirect_uris IS NULL OR redirect_uris = '[]'::jsonb)",
+		).Error
+		if err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&models.Client{}, "redirect_uri")
+	})
+}
+
+// Delete deletes the client along with its exchange audiences, pending
+// device and authorization codes, secrets, refresh tokens and the consents
+// users gave it.
+func (p *ClientRepository) Delete(ctx context.Context, id string) error {
+	return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		client := &models.Client{}
+		err := tx.Where("id = ?", id).First(client).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(client).Association("ExchangeAudiences").Clear()
+		if err != nil {
+			return err
+		}
+		err = tx.Where("client_id = ?", id).Delete(&models.DeviceCode{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("client_id = ?", id).Delete(&models.ClientSecret{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("client_id = ?", id).Delete(&models.AuthorizationCode{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("client_id = ?", id).Delete(&models.RefreshToken{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("client_id = ?", id).Delete(&models.Consent{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(client).Error
+	})
+}
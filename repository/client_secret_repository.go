@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"auth-server/models"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ClientSecretRepository struct {
+	db *gorm.DB
+}
+
+func NewClientSecretRepository(db *gorm.DB) *ClientSecretRepository {
+	return &ClientSecretRepository{
+		db: db,
+	}
+}
+
+func (p *ClientSecretRepository) FindAll(ctx context.Context) ([]*models.ClientSecret, error) {
+	var secrets []*models.ClientSecret
+	err := p.db.WithContext(ctx).Find(&secrets).Error
+	if err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
+
+func (p *ClientSecretRepository) FindById(ctx context.Context, id string) (*models.ClientSecret, error) {
+	var secret models.ClientSecret
+	err := p.db.WithContext(ctx).Where("id = ?", id).First(&secret).Error
+	if err != nil {
+		return nil, err
+	}
+	return &secret, nil
+}
+
+// FindByClientId returns the secrets of the client, newest first.
+func (p *ClientSecretRepository) FindByClientId(ctx context.Context, clientId string) ([]*models.ClientSecret, error) {
+	var secrets []*models.ClientSecret
+	err := p.db.WithContext(ctx).Where("client_id = ?", clientId).Order("created_at DESC").Find(&secrets).Error
+	if err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
+
+// FindActiveByClientId returns the secrets of the client that have been
+// neither revoked nor expired, newest first.
+func (p *ClientSecretRepository) FindActiveByClientId(ctx context.Context, clientId string) ([]*models.ClientSecret, error) {
+	var secrets []*models.ClientSecret
+	err := p.db.WithContext(ctx).
+		Where("client_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", clientId, time.Now()).
+		Order("created_at DESC").
+		Find(&secrets).Error
+	if err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
+
+func (p *ClientSecretRepository) Save(ctx context.Context, entity interface{}) (*models.ClientSecret, error) {
+	secret := entity.(*models.ClientSecret)
+	err := p.db.WithContext(ctx).Save(secret).Error
+	if err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// Rotate saves a new secret for a client, and makes the client's other active
+// secrets expire at expireOthersAt, unless they already expire sooner.
+func (p *ClientSecretRepository) Rotate(ctx context.Context, secret *models.ClientSecret, expireOthersAt time.Time) error {
+	return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.ClientSecret{}).
+			Where("client_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", secret.ClientID, expireOthersAt).
+			Update("expires_at", expireOthersAt).Error
+		if err != nil {
+			return err
+		}
+		return tx.Save(secret).Error
+	})
+}
+
+func (p *ClientSecretRepository) Delete(ctx context.Context, id string) error {
+	err := p.db.WithContext(ctx).Where("id = ?", id).Delete(&models.ClientSecret{}).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
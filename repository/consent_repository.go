@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"auth-server/models"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type ConsentRepository struct {
+	db *gorm.DB
+}
+
+func NewConsentRepository(db *gorm.DB) *ConsentRepository {
+	return &ConsentRepository{
+		db: db,
+	}
+}
+
+// WithTenant returns a copy of the repository that only sees the consents of
+// the tenant, and assigns the consents it creates to it.
+func (p *ConsentRepository) WithTenant(tenantId uuid.UUID) *ConsentRepository {
+	return &ConsentRepository{
+		db: bindTenant(p.db, tenantId),
+	}
+}
+
+func (p *ConsentRepository) FindAll(ctx context.Context) ([]*models.Consent, error) {
+	var consents []*models.Consent
+	err := p.db.WithContext(ctx).Preload("Client").Find(&consents).Error
+	if err != nil {
+		return nil, err
+	}
+	return consents, nil
+}
+
+func (p *ConsentRepository) FindById(ctx context.Context, id string) (*models.Consent, error) {
+	var consent models.Consent
+	err := p.db.WithContext(ctx).Preload("Client").Where("id = ?", id).First(&consent).Error
+	if err != nil {
+		return nil, err
+	}
+	return &consent, nil
+}
+
+// FindByUserId returns the consents the user gave, most recently updated first.
+func (p *ConsentRepository) FindByUserId(ctx context.Context, userId string) ([]*models.Consent, error) {
+	var consents []*models.Consent
+	err := p.db.WithContext(ctx).Preload("Client").Where("user_id = ?", userId).Order("updated_at DESC").Find(&consents).Error
+	if err != nil {
+		return nil, err
+	}
+	return consents, nil
+}
+
+// FindByUserAndClient returns the consent the user gave to the client, or nil
+// if there is none.
+func (p *ConsentRepository) FindByUserAndClient(ctx context.Context, userId string, clientId string) (*models.Consent, error) {
+	var consent models.Consent
+	err := p.db.WithContext(ctx).Where("user_id = ? AND client_id = ?", userId, clientId).First(&consent).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &consent, nil
+}
+
+func (p *ConsentRepository) Save(ctx context.Context, entity interface{}) (*models.Consent, error) {
+	consent := entity.(*models.Consent)
+	err := p.db.WithContext(ctx).Omit("Client").Save(consent).Error
+	if err != nil {
+		return nil, err
+	}
+	return consent, nil
+}
+
+// Delete deletes the consent and revokes the refresh tokens the client was
+// issued on behalf of the user, so that the client loses access at once.
+func (p *ConsentRepository) Delete(ctx context.Context, id string) error {
+	return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		consent := &models.Consent{}
+		err := tx.Where("id = ?", id).First(consent).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND client_id = ? AND revoked_at IS NULL", consent.UserID, consent.ClientID).
+			Update("revoked_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(consent).Error
+	})
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"auth-server/models"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type DeviceCodeRepository struct {
+	db *gorm.DB
+}
+
+func NewDeviceCodeRepository(db *gorm.DB) *DeviceCodeRepository {
+	return &DeviceCodeRepository{
+		db: db,
+	}
+}
+
+// WithTenant returns a copy of the repository that only sees the device codes
+// of the tenant, and assigns the device codes it creates to it.
+func (p *DeviceCodeRepository) WithTenant(tenantId uuid.UUID) *DeviceCodeRepository {
+	return &DeviceCodeRepository{
+		db: bindTenant(p.db, tenantId),
+	}
+}
+
+func (p *DeviceCodeRepository) FindAll(ctx context.Context) ([]*models.DeviceCode, error) {
+	var deviceCodes []*models.DeviceCode
+	err := p.db.WithContext(ctx).Preload("Client").Preload("Application").Find(&deviceCodes).Error
+	if err != nil {
+		return nil, err
+	}
+	return deviceCodes, nil
+}
+
+func (p *DeviceCodeRepository) FindById(ctx context.Context, id string) (*models.DeviceCode, error) {
+	return p.findOne(ctx, "id = ?", id)
+}
+
+// FindByDeviceCode returns the device authorization request with the given
+// device code, or nil if there is none.
+func (p *DeviceCodeRepository) FindByDeviceCode(ctx context.Context, deviceCode string) (*models.DeviceCode, error) {
+	return p.findOne(ctx, "device_code_hash = ?", models.HashDeviceCode(deviceCode))
+}
+
+// FindByUserCode returns the device authorization request with the given
+// user code, or nil if there is none.
+func (p *DeviceCodeRepository) FindByUserCode(ctx context.Context, userCode string) (*models.DeviceCode, error) {
+	return p.findOne(ctx, "user_code = ?", models.NormalizeUserCode(userCode))
+}
+
+func (p *DeviceCodeRepository) findOne(ctx context.Context, query string, args ...interface{}) (*models.DeviceCode, error) {
+	var deviceCode models.DeviceCode
+	err := p.db.WithContext(ctx).Preload("Client").Preload("Application").Where(query, args...).First(&deviceCode).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	return &deviceCode, nil
+}
+
+func (p *DeviceCodeRepository) Save(ctx context.Context, entity interface{}) (*models.DeviceCode, error) {
+	deviceCode := entity.(*models.DeviceCode)
+	err := p.db.WithContext(ctx).Omit("Client", "Application").Save(deviceCode).Error
+	if err != nil {
+		return nil, err
+	}
+	return deviceCode, nil
+}
+
+func (p *DeviceCodeRepository) Delete(ctx context.Context, id string) error {
+	err := p.db.WithContext(ctx).Where("id = ?", id).Delete(&models.DeviceCode{}).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Consume deletes the device authorization request with the given id, and
+// returns false if it had already been deleted, e.g. by a concurrent request.
+func (p *DeviceCodeRepository) Consume(ctx context.Context, id string) (bool, error) {
+	result := p.db.WithContext(ctx).Where("id = ?", id).Delete(&models.DeviceCode{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// DeleteExpired removes the device authorization requests that expired before the given time.
+func (p *DeviceCodeRepository) DeleteExpired(ctx context.Context, before time.Time) error {
+	return p.db.WithContext(ctx).Where("expires_at < ?", before).Delete(&models.DeviceCode{}).Error
+}
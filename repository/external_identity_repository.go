@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"auth-server/models"
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+type ExternalIdentityRepository struct {
+	db *gorm.DB
+}
+
+func NewExternalIdentityRepository(db *gorm.DB) *ExternalIdentityRepository {
+	return &ExternalIdentityRepository{
+		db: db,
+	}
+}
+
+func (p *ExternalIdentityRepository) FindAll(ctx context.Context) ([]*models.ExternalIdentity, error) {
+	var identities []*models.ExternalIdentity
+	err := p.db.WithContext(ctx).Preload("IdentityProvider").Find(&identities).Error
+	if err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+func (p *ExternalIdentityRepository) FindById(ctx context.Context, id string) (*models.ExternalIdentity, error) {
+	var identity models.ExternalIdentity
+	err := p.db.WithContext(ctx).Preload("IdentityProvider").Where("id = ?", id).First(&identity).Error
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// FindByProviderAndSubject returns the identity the provider asserts with the
+// subject, along with its user, or nil if no user is linked to it yet.
+func (p *ExternalIdentityRepository) FindByProviderAndSubject(ctx context.Context, providerId string, subject string) (*models.ExternalIdentity, error) {
+	var identity models.ExternalIdentity
+	err := p.db.WithContext(ctx).Preload("User").
+		Where("identity_provider_id = ? AND subject = ?", providerId, subject).
+		First(&identity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// FindByUserId returns the external identities linked to the user.
+func (p *ExternalIdentityRepository) FindByUserId(ctx context.Context, userId string) ([]*models.ExternalIdentity, error) {
+	var identities []*models.ExternalIdentity
+	err := p.db.WithContext(ctx).Preload("IdentityProvider").Where("user_id = ?", userId).Order("created_at").Find(&identities).Error
+	if err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+func (p *ExternalIdentityRepository) Save(ctx context.Context, entity interface{}) (*models.ExternalIdentity, error) {
+	identity := entity.(*models.ExternalIdentity)
+	err := p.db.WithContext(ctx).Omit("User", "IdentityProvider").Save(identity).Error
+	if err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+func (p *ExternalIdentityRepository) Delete(ctx context.Context, id string) error {
+	err := p.db.WithContext(ctx).Where("id = ?", id).Delete(&models.ExternalIdentity{}).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
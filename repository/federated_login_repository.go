@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"auth-server/models"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type FederatedLoginRepository struct {
+	db *gorm.DB
+}
+
+func NewFederatedLoginRepository(db *gorm.DB) *FederatedLoginRepository {
+	return &FederatedLoginRepository{
+		db: db,
+	}
+}
+
+func (p *FederatedLoginRepository) FindAll(ctx context.Context) ([]*models.FederatedLogin, error) {
+	var logins []*models.FederatedLogin
+	err := p.db.WithContext(ctx).Find(&logins).Error
+	if err != nil {
+		return nil, err
+	}
+	return logins, nil
+}
+
+func (p *FederatedLoginRepository) FindById(ctx context.Context, id string) (*models.FederatedLogin, error) {
+	return p.findOne(ctx, "id = ?", id)
+}
+
+// FindByState returns the login with the given state, or nil if there is none.
+func (p *FederatedLoginRepository) FindByState(ctx context.Context, state string) (*models.FederatedLogin, error) {
+	return p.findOne(ctx, "state_hash = ?", models.HashFederationState(state))
+}
+
+func (p *FederatedLoginRepository) findOne(ctx context.Context, query string, args ...interface{}) (*models.FederatedLogin, error) {
+	var login models.FederatedLogin
+	err := p.db.WithContext(ctx).Where(query, args...).First(&login).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &login, nil
+}
+
+func (p *FederatedLoginRepository) Save(ctx context.Context, entity interface{}) (*models.FederatedLogin, error) {
+	login := entity.(*models.FederatedLogin)
+	err := p.db.WithContext(ctx).Save(login).Error
+	if err != nil {
+		return nil, err
+	}
+	return login, nil
+}
+
+func (p *FederatedLoginRepository) Delete(ctx context.Context, id string) error {
+	err := p.db.WithContext(ctx).Where("id = ?", id).Delete(&models.FederatedLogin{}).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Consume deletes the login with the given id, and returns false if it had
+// already been deleted, e.g. by a concurrent request.
+func (p *FederatedLoginRepository) Consume(ctx context.Context, id string) (bool, error) {
+	result := p.db.WithContext(ctx).Where("id = ?", id).Delete(&models.FederatedLogin{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// DeleteExpired removes the logins that expired before the given time.
+func (p *FederatedLoginRepository) DeleteExpired(ctx context.Context, before time.Time) error {
+	return p.db.WithContext(ctx).Where("expires_at < ?", before).Delete(&models.FederatedLogin{}).Error
+}
@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"auth-server/models"
+	"context"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type GroupRepository struct {
+	db *gorm.DB
+}
+
+func NewGroupRepository(db *gorm.DB) *GroupRepository {
+	return &GroupRepository{
+		db: db,
+	}
+}
+
+// WithTenant returns a copy of the repository that only sees the groups of
+// the tenant, and assigns the groups it creates to it.
+func (p *GroupRepository) WithTenant(tenantId uuid.UUID) *GroupRepository {
+	return &GroupRepository{
+		db: bindTenant(p.db, tenantId),
+	}
+}
+
+func (p *GroupRepository) FindAll(ctx context.Context) ([]*models.Group, error) {
+	var groups []*models.Group
+	err := p.db.WithContext(ctx).Preload("Roles.Application").Find(&groups).Error
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// FindByFilter returns a page of the groups matching the SCIM filter, ordered
+// by name, along with their members and the number of groups matching it.
+func (p *GroupRepository) FindByFilter(ctx context.Context, filter models.SCIMFilter, offset int, limit int) ([]*models.Group, int64, error) {
+	query, err := applySCIMFilter(p.db.WithContext(ctx).Model(&models.Group{}), filter, scimGroupColumns)
+	if err != nil {
+		return nil, 0, err
+	}
+	var total int64
+	err = query.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	var groups []*models.Group
+	err = query.Preload("Members").Order("name").Order("id").Offset(offset).Limit(limit).Find(&groups).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return groups, total, nil
+}
+
+func (p *GroupRepository) FindById(ctx context.Context, id string) (*models.Group, error) {
+	var group models.Group
+	err := p.db.WithContext(ctx).Preload("Roles.Application").Preload("Subgroups").Preload("Members.Roles.Application").Where("id = ?", id).First(&group).Error
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// FindByParentAndName returns the group with the given name among the
+// children of parentId, or among the top-level groups if parentId is nil.
+// It returns nil if there is no such group.
+func (p *GroupRepository) FindByParentAndName(ctx context.Context, parentId *uuid.UUID, name string) (*models.Group, error) {
+	var groups []*models.Group
+	query := p.db.WithContext(ctx).Where("name = ?", name)
+	if parentId == nil {
+		query = query.Where("parent_id IS NULL")
+	} else {
+		query = query.Where("parent_id = ?", parentId)
+	}
+	err := query.Limit(1).Find(&groups).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return nil, nil
+	}
+	return groups[0], nil
+}
+
+func (p *GroupRepository) Save(ctx context.Context, entity interface{}) (*models.Group, error) {
+	group := entity.(*models.Group)
+	err := p.db.WithContext(ctx).Omit("Subgroups", "Members", "Roles").Save(group).Error
+	if err != nil {
+		return nil, err
+	}
+	return p.FindById(ctx, group.ID.String())
+}
+
+func (p *GroupRepository) AddMembers(ctx context.Context, group *models.Group, users []*models.User) error {
+	err := p.db.WithContext(ctx).Model(group).Association("Members").Append(users)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p *GroupRepository) AssignMembers(ctx context.Context, group *models.Group, users []*models.User) error {
+	err := p.db.WithContext(ctx).Model(group).Association("Members").Replace(users)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// RemoveMembers removes the users from the members of the group.
+func (p *GroupRepository) RemoveMembers(ctx context.Context, group *models.Group, users []*models.User) error {
+	return p.db.WithContext(ctx).Model(group).Association("Members").Delete(users)
+}
+
+func (p *GroupRepository) AddRoles(ctx context.Context, group *models.Group, roles []*models.Role) error {
+	err := p.db.WithContext(ctx).Model(group).Association("Roles").Append(roles)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p *GroupRepository) AssignRoles(ctx context.Context, group *models.Group, roles []*models.Role) error {
+	err := p.db.WithContext(ctx).Model(group).Association("Roles").Replace(roles)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Delete removes the group along with its memberships and role assignments.
+// Its subgroups are moved up to the group's parent.
+func (p *GroupRepository) Delete(ctx context.Context, id string) error {
+	return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var group models.Group
+		err := tx.Where("id = ?", id).First(&group).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&models.Group{}).Where("parent_id = ?", group.ID).Update("parent_id", group.ParentID).Error
+		if err != nil {
+			return err
+		}
+		return tx.Select("Members", "Roles").Delete(&group).Error
+	})
+}
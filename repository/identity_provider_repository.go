@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"auth-server/models"
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type IdentityProviderRepository struct {
+	db *gorm.DB
+}
+
+func NewIdentityProviderRepository(db *gorm.DB) *IdentityProviderRepository {
+	return &IdentityProviderRepository{
+		db: db,
+	}
+}
+
+// WithTenant returns a copy of the repository that only sees the identity
+// providers of the tenant, and assigns the identity providers it creates to
+// it.
+func (p *IdentityProviderRepository) WithTenant(tenantId uuid.UUID) *IdentityProviderRepository {
+	return &IdentityProviderRepository{
+		db: bindTenant(p.db, tenantId),
+	}
+}
+
+func (p *IdentityProviderRepository) FindAll(ctx context.Context) ([]*models.IdentityProvider, error) {
+	var providers []*models.IdentityProvider
+	err := p.db.WithContext(ctx).Preload("RoleMappings.Role.Application").Order("name").Find(&providers).Error
+	if err != nil {
+		return nil, err
+	}
+	return providers, nil
+}
+
+// FindEnabled returns the identity providers users can log in with, ordered by name.
+func (p *IdentityProviderRepository) FindEnabled(ctx context.Context) ([]*models.IdentityProvider, error) {
+	var providers []*models.IdentityProvider
+	err := p.db.WithContext(ctx).Where("disabled = ?", false).Order("name").Find(&providers).Error
+	if err != nil {
+		return nil, err
+	}
+	return providers, nil
+}
+
+// FindEnabledByType returns the enabled identity providers of the given type,
+// along with their role mappings, ordered by name.
+func (p *IdentityProviderRepository) FindEnabledByType(ctx context.Context, providerType string) ([]*models.IdentityProvider, error) {
+	var providers []*models.IdentityProvider
+	err := p.db.WithContext(ctx).Preload("RoleMappings.Role.Application").Where("disabled = ? AND type = ?", false, providerType).Order("name").Find(&providers).Error
+	if err != nil {
+		return nil, err
+	}
+	return providers, nil
+}
+
+func (p *IdentityProviderRepository) FindById(ctx context.Context, id string) (*models.IdentityProvider, error) {
+	var provider models.IdentityProvider
+	err := p.db.WithContext(ctx).Preload("RoleMappings.Role.Application").Where("id = ?", id).First(&provider).Error
+	if err != nil {
+		return nil, err
+	}
+	return &provider, nil
+}
+
+// FindByName returns the identity provider with the given name, or nil if
+// there is none.
+func (p *IdentityProviderRepository) FindByName(ctx context.Context, name string) (*models.IdentityProvider, error) {
+	var provider models.IdentityProvider
+	err := p.db.WithContext(ctx).Where("name = ?", name).First(&provider).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &provider, nil
+}
+
+// Save saves the identity provider and replaces its role mappings.
+func (p *IdentityProviderRepository) Save(ctx context.Context, entity interface{}) (*models.IdentityProvider, error) {
+	provider := entity.(*models.IdentityProvider)
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Omit("RoleMappings").Save(provider).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("identity_provider_id = ?", provider.ID).Delete(&models.RoleMapping{}).Error
+		if err != nil {
+			return err
+		}
+		for _, mapping := range provider.RoleMappings {
+			mapping.IdentityProviderID = provider.ID
+			err = tx.Omit("Role").Create(mapping).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p.FindById(ctx, provider.ID.String())
+}
+
+// Delete deletes the identity provider along with its role mappings, the
+// logins in progress and the external identities linked to it. The users
+// themselves are kept.
+func (p *IdentityProviderRepository) Delete(ctx context.Context, id string) error {
+	return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("identity_provider_id = ?", id).Delete(&models.RoleMapping{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("identity_provider_id = ?", id).Delete(&models.FederatedLogin{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("identity_provider_id = ?", id).Delete(&models.ExternalIdentity{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).Delete(&models.IdentityProvider{}).Error
+	})
+}
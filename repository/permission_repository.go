@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
@@ -18,9 +19,17 @@ func NewPermissionRepository(db *gorm.DB) *PermissionRepository {
 	}
 }
 
+// WithTenant returns a copy of the repository that only sees the permissions
+// of the tenant, and assigns the permissions it creates to it.
+func (p *PermissionRepository) WithTenant(tenantId uuid.UUID) *PermissionRepository {
+	return &PermissionRepository{
+		db: bindTenant(p.db, tenantId),
+	}
+}
+
 func (p *PermissionRepository) FindAll(ctx context.Context) ([]*models.Permission, error) {
 	var permissions []*models.Permission
-	err := p.db.WithContext(ctx).Preload("Role.Application").Preload("Role").Find(&permissions).Error
+	err := p.db.WithContext(ctx).Preload("Roles.Application").Preload("Roles").Find(&permissions).Error
 	if err != nil {
 		return nil, err
 	}
@@ -28,12 +37,17 @@ func (p *PermissionRepository) FindAll(ctx context.Context) ([]*models.Permissio
 }
 
 func (p *PermissionRepository) FindById(ctx context.Context, id string) (*models.Permission, error) {
-	return nil, errors.New("not implemented")
+	var permission models.Permission
+	err := p.db.WithContext(ctx).Preload("Roles.Application").Preload("Roles").Where("id = ?", id).First(&permission).Error
+	if err != nil {
+		return nil, err
+	}
+	return &permission, nil
 }
 
 func (p *PermissionRepository) FindByName(ctx context.Context, name string) (*models.Permission, error) {
 	var permission models.Permission
-	err := p.db.WithContext(ctx).Preload("Role.Application").Preload("Role").Where("name = ?", name).First(&permission).Error
+	err := p.db.WithContext(ctx).Preload("Roles.Application").Preload("Roles").Where("name = ?", name).First(&permission).Error
 	if err != nil {
 		return nil, err
 	}
@@ -47,10 +61,31 @@ func (p *PermissionRepository) Save(ctx context.Context, entity interface{}) (*m
 		return nil, err
 	}
 	var savedPermission models.Permission
-	p.db.WithContext(ctx).Preload("Role.Application").Preload("Role").Where("id = ?", permission.ID).First(&savedPermission)
+	p.db.WithContext(ctx).Preload("Roles.Application").Preload("Roles").Where("id = ?", permission.ID).First(&savedPermission)
 	return &savedPermission, nil
 }
 
 func (p *PermissionRepository) Delete(ctx context.Context, id string) error {
 	return errors.New("not implemented")
 }
+
+// MigrateLegacyRoles moves the role a permission used to belong to, stored in
+// the permissions.role_id column, into the role_permissions join table, and
+// drops the column afterwards.
+func (p *PermissionRepository) MigrateLegacyRoles(ctx context.Context) error {
+	migrator := p.db.WithContext(ctx).Migrator()
+	if !migrator.HasColumn(&models.Permission{}, "role_id") {
+		return nil
+	}
+	return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(
+			"INSERT INTO role_permissions (role_id, permission_id) " +
+				"SELECT role_id, id FROM permissions WHERE role_id IS NOT NULL " +
+				"ON CONFLICT DO NOTHING",
+		).Error
+		if err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&models.Permission{}, "role_id")
+	})
+}
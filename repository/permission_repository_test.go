@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"auth-server/repository/repositorytest"
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+)
+
+func TestMigrateLegacyRoles(t *testing.T) {
+	tests := []struct {
+		name       string
+		hasColumn  bool
+		statements []string
+	}{
+		{"legacy column", true, []string{"INSERT INTO role_permissions", `DROP COLUMN "role_id"`}},
+		{"already migrated", false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := repositorytest.New(t)
+			count := int64(0)
+			if tt.hasColumn {
+				count = 1
+			}
+			fake.ReturnColumns("INFORMATION_SCHEMA.columns", []string{"count"}, []driver.Value{count})
+
+			err := NewPermissionRepository(db).MigrateLegacyRoles(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var changes []string
+			for _, statement := range fake.Statements() {
+				if !strings.Contains(statement, "INFORMATION_SCHEMA") {
+					changes = append(changes, statement)
+				}
+			}
+			if len(changes) != len(tt.statements) {
+				t.Fatalf("statements = %q", changes)
+			}
+			for i, want := range tt.statements {
+				if !strings.Contains(changes[i], want) {
+					t.Errorf("statement %d = %q, want it to contain %q", i, changes[i], want)
+				}
+			}
+			if tt.hasColumn && !strings.Contains(changes[0], "SELECT role_id, id FROM permissions WHERE role_id IS NOT NULL") {
+				t.Errorf("roles are not copied from the legacy column: %s", changes[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"auth-server/models"
+	"context"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type PolicyRepository struct {
+	db *gorm.DB
+}
+
+func NewPolicyRepository(db *gorm.DB) *PolicyRepository {
+	return &PolicyRepository{
+		db: db,
+	}
+}
+
+// WithTenant returns a copy of the repository that only sees the policies of
+// the tenant, and assigns the policies it creates to it.
+func (p *PolicyRepository) WithTenant(tenantId uuid.UUID) *PolicyRepository {
+	return &PolicyRepository{
+		db: bindTenant(p.db, tenantId),
+	}
+}
+
+func (p *PolicyRepository) FindAll(ctx context.Context) ([]*models.Policy, error) {
+	var policies []*models.Policy
+	err := p.db.WithContext(ctx).Preload("Application").Order("name").Find(&policies).Error
+	if err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+func (p *PolicyRepository) FindById(ctx context.Context, id string) (*models.Policy, error) {
+	var policy models.Policy
+	err := p.db.WithContext(ctx).Preload("Application").Where("id = ?", id).First(&policy).Error
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// FindByApplicationId returns the policies of the application, ordered by name.
+func (p *PolicyRepository) FindByApplicationId(ctx context.Context, applicationId string) ([]*models.Policy, error) {
+	var policies []*models.Policy
+	err := p.db.WithContext(ctx).Where("application_id = ?", applicationId).Order("name").Find(&policies).Error
+	if err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+func (p *PolicyRepository) Save(ctx context.Context, entity interface{}) (*models.Policy, error) {
+	policy := entity.(*models.Policy)
+	err := p.db.WithContext(ctx).Save(policy).Error
+	if err != nil {
+		return nil, err
+	}
+	return p.FindById(ctx, policy.ID.String())
+}
+
+func (p *PolicyRepository) Delete(ctx context.Context, id string) error {
+	err := p.db.WithContext(ctx).Where("id = ?", id).Delete(&models.Policy{}).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"auth-server/models"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type RefreshTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewRefreshTokenRepository(db *gorm.DB) *RefreshTokenRepository {
+	return &RefreshTokenRepository{
+		db: db,
+	}
+}
+
+// WithTenant returns a copy of the repository that only sees the refresh
+// tokens of the tenant, and assigns the refresh tokens it creates to it.
+func (p *RefreshTokenRepository) WithTenant(tenantId uuid.UUID) *RefreshTokenRepository {
+	return &RefreshTokenRepository{
+		db: bindTenant(p.db, tenantId),
+	}
+}
+
+func (p *RefreshTokenRepository) FindAll(ctx context.Context) ([]*models.RefreshToken, error) {
+	var tokens []*models.RefreshToken
+	err := p.db.WithContext(ctx).Find(&tokens).Error
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (p *RefreshTokenRepository) FindById(ctx context.Context, id string) (*models.RefreshToken, error) {
+	return p.findOne(ctx, "id = ?", id)
+}
+
+// FindByToken returns the refresh token with the given value, or nil if there
+// is none.
+func (p *RefreshTokenRepository) FindByToken(ctx context.Context, token string) (*models.RefreshToken, error) {
+	return p.findOne(ctx, "token_hash = ?", models.HashRefreshToken(token))
+}
+
+func (p *RefreshTokenRepository) findOne(ctx context.Context, query string, args ...interface{}) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := p.db.WithContext(ctx).Where(query, args...).First(&token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (p *RefreshTokenRepository) Save(ctx context.Context, entity interface{}) (*models.RefreshToken, error) {
+	token := entity.(*models.RefreshToken)
+	err := p.db.WithContext(ctx).Save(token).Error
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// Rotate revokes the refresh token being used and saves the one replacing it.
+// It returns false, saving nothing, if the token had already been revoked,
+// e.g. by a concurrent request.
+func (p *RefreshTokenRepository) Rotate(ctx context.Context, used *models.RefreshToken, replacement *models.RefreshToken) (bool, error) {
+	rotated := false
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", used.ID).
+			Update("revoked_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return nil
+		}
+		rotated = true
+		return tx.Save(replacement).Error
+	})
+	if err != nil {
+		return false, err
+	}
+	return rotated, nil
+}
+
+// RevokeByUserAndClient revokes the refresh tokens issued to the client on
+// behalf of the user.
+func (p *RefreshTokenRepository) RevokeByUserAndClient(ctx context.Context, userId string, clientId string) error {
+	return p.db.WithContext(ctx).Model(&models.RefreshToken{}).
+		Where("user_id = ? AND client_id = ? AND revoked_at IS NULL", userId, clientId).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (p *RefreshTokenRepository) Delete(ctx context.Context, id string) error {
+	err := p.db.WithContext(ctx).Where("id = ?", id).Delete(&models.RefreshToken{}).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
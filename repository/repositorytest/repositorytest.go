@@ -0,0 +1,247 @@
+// Package repositorytest provides a database answering the statements of the
+// repositories with canned rows, so that the code built on them can be tested
+// without a Postgres server.
+package repositorytest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+// DB is a fake database. Queries return the rows of the first stub whose
+// match is contained in their SQL, with the values of its parameters inlined,
+// or no rows. Other statements report that they changed a single row unless a
+// stub says otherwise.
+type DB struct {
+	mu         sync.Mutex
+	stubs      []*stub
+	statements []string
+}
+
+type stub struct {
+	match        string
+	columns      []string
+	rows         [][]driver.Value
+	rowsAffected int64
+	err          error
+	once         bool
+}
+
+// New returns a gorm handle on a new fake database, along with the database.
+func New(t testing.TB) (*gorm.DB, *DB) {
+	t.Helper()
+	fake := &DB{}
+	conn := sql.OpenDB(connector{fake})
+	t.Cleanup(func() { conn.Close() })
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{
+		Logger:                 logger.Discard,
+		SkipDefaultTransaction: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, fake
+}
+
+// Return makes the queries whose SQL contains match return a row for each
+// entity, which must all be pointers to the same model.
+func (db *DB) Return(match string, entities ...interface{}) {
+	db.add(newEntityStub(match, entities))
+}
+
+// ReturnOnce is like Return, but only answers the first query matching it,
+// so that the following ones can see the rows changed.
+func (db *DB) ReturnOnce(match string, entities ...interface{}) {
+	s := newEntityStub(match, entities)
+	s.once = true
+	db.add(s)
+}
+
+func newEntityStub(match string, entities []interface{}) *stub {
+	s := &stub{match: match, rowsAffected: int64(len(entities))}
+	for i, entity := range entities {
+		modelSchema, err := schema.Parse(entity, &sync.Map{}, schema.NamingStrategy{})
+		if err != nil {
+			panic(err)
+		}
+		if i == 0 {
+			s.columns = modelSchema.DBNames
+		}
+		row := make([]driver.Value, 0, len(modelSchema.DBNames))
+		for _, name := range modelSchema.DBNames {
+			value, _ := modelSchema.FieldsByDBName[name].ValueOf(context.Background(), reflect.ValueOf(entity))
+			converted, err := driver.DefaultParameterConverter.ConvertValue(value)
+			if err != nil {
+				panic(err)
+			}
+			row = append(row, converted)
+		}
+		s.rows = append(s.rows, row)
+	}
+	return s
+}
+
+// ReturnColumns makes the queries whose SQL contains match return the rows,
+// holding the values of the columns in order.
+func (db *DB) ReturnColumns(match string, columns []string, rows ...[]driver.Value) {
+	db.add(&stub{match: match, columns: columns, rows: rows, rowsAffected: int64(len(rows))})
+}
+
+// Affect makes the statements whose SQL contains match report that they
+// changed n rows.
+func (db *DB) Affect(match string, n int64) {
+	db.add(&stub{match: match, rowsAffected: n})
+}
+
+// Fail makes the statements whose SQL contains match fail with the error.
+func (db *DB) Fail(match string, err error) {
+	db.add(&stub{match: match, err: err})
+}
+
+// Statements returns the SQL of the statements run so far, in order, with
+// the values of their parameters inlined.
+func (db *DB) Statements() []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]string(nil), db.statements...)
+}
+
+func (db *DB) add(s *stub) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.stubs = append(db.stubs, s)
+}
+
+// placeholder matches the parameters of Postgres statements.
+var placeholder = regexp.MustCompile(`\$(\d+)`)
+
+// run records the statement, and returns the stub answering it, if any.
+func (db *DB) run(query string, args []driver.NamedValue) *stub {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	query = logger.ExplainSQL(query, placeholder, `'`, values...)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.statements = append(db.statements, query)
+	for i, s := range db.stubs {
+		if strings.Contains(query, s.match) {
+			if s.once {
+				db.stubs = append(db.stubs[:i], db.stubs[i+1:]...)
+			}
+			return s
+		}
+	}
+	return nil
+}
+
+type connector struct {
+	db *DB
+}
+
+func (c connector) Connect(context.Context) (driver.Conn, error) {
+	return conn{c.db}, nil
+}
+
+func (c connector) Driver() driver.Driver {
+	return fakeDriver{}
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("repositorytest: connections are opened by the connector")
+}
+
+type conn struct {
+	db *DB
+}
+
+func (c conn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("repositorytest: prepared statements are not supported")
+}
+
+func (c conn) Close() error {
+	return nil
+}
+
+func (c conn) Begin() (driver.Tx, error) {
+	return tx{}, nil
+}
+
+func (c conn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return tx{}, nil
+}
+
+func (c conn) CheckNamedValue(*driver.NamedValue) error {
+	return nil
+}
+
+func (c conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	s := c.db.run(query, args)
+	if s == nil {
+		return &rows{}, nil
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &rows{columns: s.columns, values: s.rows}, nil
+}
+
+func (c conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	s := c.db.run(query, args)
+	if s == nil {
+		return driver.RowsAffected(1), nil
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	return driver.RowsAffected(s.rowsAffected), nil
+}
+
+type tx struct{}
+
+func (tx) Commit() error {
+	return nil
+}
+
+func (tx) Rollback() error {
+	return nil
+}
+
+type rows struct {
+	columns []string
+	values  [][]driver.Value
+	next    int
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.next >= len(r.values) {
+		return io.EOF
+	}
+	copy(dest, r.values[r.next])
+	r.next++
+	return nil
+}
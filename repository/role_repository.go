@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
@@ -18,9 +19,17 @@ func NewRoleRepository(db *gorm.DB) *RoleRepository {
 	}
 }
 
+// WithTenant returns a copy of the repository that only sees the roles of
+// the tenant, and assigns the roles it creates to it.
+func (p *RoleRepository) WithTenant(tenantId uuid.UUID) *RoleRepository {
+	return &RoleRepository{
+		db: bindTenant(p.db, tenantId),
+	}
+}
+
 func (p *RoleRepository) FindAll(ctx context.Context) ([]*models.Role, error) {
 	var roles []*models.Role
-	err := p.db.WithContext(ctx).Preload("Application").Find(&roles).Error
+	err := p.db.WithContext(ctx).Preload("Application").Preload("Composites.Application").Find(&roles).Error
 	if err != nil {
 		return nil, err
 	}
@@ -29,13 +38,27 @@ func (p *RoleRepository) FindAll(ctx context.Context) ([]*models.Role, error) {
 
 func (p *RoleRepository) FindById(ctx context.Context, id string) (*models.Role, error) {
 	var role models.Role
-	err := p.db.WithContext(ctx).Preload("Application").Where("id = ?", id).First(&role).Error
+	err := p.db.WithContext(ctx).Preload("Application").Preload("Composites.Application").Preload("Permissions").Where("id = ?", id).First(&role).Error
 	if err != nil {
 		return nil, err
 	}
 	return &role, nil
 }
 
+// FindByIds returns the roles with the given ids, along with their direct
+// composites and permissions.
+func (p *RoleRepository) FindByIds(ctx context.Context, ids []uuid.UUID) ([]*models.Role, error) {
+	var roles []*models.Role
+	if len(ids) == 0 {
+		return roles, nil
+	}
+	err := p.db.WithContext(ctx).Preload("Application").Preload("Composites").Preload("Permissions").Where("id IN ?", ids).Find(&roles).Error
+	if err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
 func (p *RoleRepository) FindByName(ctx context.Context, name string) (*models.Role, error) {
 	var role models.Role
 	err := p.db.WithContext(ctx).Preload("Application").Where("name = ?", name).First(&role).Error
@@ -56,6 +79,38 @@ func (p *RoleRepository) Save(ctx context.Context, entity interface{}) (*models.
 	return &savedRole, nil
 }
 
+func (p *RoleRepository) AddComposites(ctx context.Context, role *models.Role, composites []*models.Role) error {
+	err := p.db.WithContext(ctx).Model(role).Association("Composites").Append(composites)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p *RoleRepository) AssignComposites(ctx context.Context, role *models.Role, composites []*models.Role) error {
+	err := p.db.WithContext(ctx).Model(role).Association("Composites").Replace(composites)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p *RoleRepository) AddPermissions(ctx context.Context, role *models.Role, permissions []*models.Permission) error {
+	err := p.db.WithContext(ctx).Model(role).Association("Permissions").Append(permissions)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p *RoleRepository) AssignPermissions(ctx context.Context, role *models.Role, permissions []*models.Permission) error {
+	err := p.db.WithContext(ctx).Model(role).Association("Permissions").Replace(permissions)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (p *RoleRepository) Delete(ctx context.Context, id string) error {
 	return errors.New("not implemented")
 }
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"auth-server/models"
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type SAMLServiceProviderRepository struct {
+	db *gorm.DB
+}
+
+func NewSAMLServiceProviderRepository(db *gorm.DB) *SAMLServiceProviderRepository {
+	return &SAMLServiceProviderRepository{
+		db: db,
+	}
+}
+
+// WithTenant returns a copy of the repository that only sees the SAML service
+// providers of the tenant, and assigns the SAML service providers it creates
+// to it.
+func (p *SAMLServiceProviderRepository) WithTenant(tenantId uuid.UUID) *SAMLServiceProviderRepository {
+	return &SAMLServiceProviderRepository{
+		db: bindTenant(p.db, tenantId),
+	}
+}
+
+func (p *SAMLServiceProviderRepository) FindAll(ctx context.Context) ([]*models.SAMLServiceProvider, error) {
+	var providers []*models.SAMLServiceProvider
+	err := p.db.WithContext(ctx).Preload("Application").Order("name").Find(&providers).Error
+	if err != nil {
+		return nil, err
+	}
+	return providers, nil
+}
+
+func (p *SAMLServiceProviderRepository) FindById(ctx context.Context, id string) (*models.SAMLServiceProvider, error) {
+	var provider models.SAMLServiceProvider
+	err := p.db.WithContext(ctx).Preload("Application").Where("id = ?", id).First(&provider).Error
+	if err != nil {
+		return nil, err
+	}
+	return &provider, nil
+}
+
+// FindByEntityId returns the service provider with the given entity id, or
+// nil if there is none.
+func (p *SAMLServiceProviderRepository) FindByEntityId(ctx context.Context, entityId string) (*models.SAMLServiceProvider, error) {
+	var provider models.SAMLServiceProvider
+	err := p.db.WithContext(ctx).Preload("Application").Where("entity_id = ?", entityId).First(&provider).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &provider, nil
+}
+
+// FindByName returns the service provider with the given name, or nil if
+// there is none.
+func (p *SAMLServiceProviderRepository) FindByName(ctx context.Context, name string) (*models.SAMLServiceProvider, error) {
+	var provider models.SAMLServiceProvider
+	err := p.db.WithContext(ctx).Where("name = ?", name).First(&provider).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &provider, nil
+}
+
+func (p *SAMLServiceProviderRepository) Save(ctx context.Context, entity interface{}) (*models.SAMLServiceProvider, error) {
+	provider := entity.(*models.SAMLServiceProvider)
+	err := p.db.WithContext(ctx).Omit("Application").Save(provider).Error
+	if err != nil {
+		return nil, err
+	}
+	return p.FindById(ctx, provider.ID.String())
+}
+
+func (p *SAMLServiceProviderRepository) Delete(ctx context.Context, id string) error {
+	return p.db.WithContext(ctx).Where("id = ?", id).Delete(&models.SAMLServiceProvider{}).Error
+}
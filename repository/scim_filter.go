@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"auth-server/models"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ErrUnsupportedFilter is returned when a SCIM filter compares attributes that
+// cannot be filtered on, or compares them with values of the wrong type.
+var ErrUnsupportedFilter = errors.New("unsupported filter")
+
+// scimColumn describes the column a SCIM attribute is stored in. Strings are
+// compared case-insensitively unless caseExact is set.
+type scimColumn struct {
+	expression string
+	boolean    bool
+	caseExact  bool
+}
+
+// scimUserColumns maps the filterable attributes of SCIM users to columns.
+var scimUserColumns = map[string]scimColumn{
+	"id":           {expression: "CAST(id AS TEXT)", caseExact: true},
+	"username":     {expression: "username"},
+	"emails":       {expression: "email"},
+	"emails.value": {expression: "email"},
+	"active":       {expression: "enabled", boolean: true},
+}
+
+// scimGroupColumns maps the filterable attributes of SCIM groups to columns.
+var scimGroupColumns = map[string]scimColumn{
+	"id":          {expression: "CAST(id AS TEXT)", caseExact: true},
+	"displayname": {expression: "name"},
+}
+
+var scimComparisonOperators = map[string]string{
+	models.SCIM_FILTER_EQ: "=",
+	models.SCIM_FILTER_NE: "<>",
+	models.SCIM_FILTER_GT: ">",
+	models.SCIM_FILTER_GE: ">=",
+	models.SCIM_FILTER_LT: "<",
+	models.SCIM_FILTER_LE: "<=",
+}
+
+// applySCIMFilter restricts the query to the rows matching the filter. The
+// returned query can be reused, e.g. to both count and fetch the rows.
+func applySCIMFilter(db *gorm.DB, filter models.SCIMFilter, columns map[string]scimColumn) (*gorm.DB, error) {
+	if len(filter) == 0 {
+		return db.Session(&gorm.Session{}), nil
+	}
+	var terms []string
+	var args []interface{}
+	for _, term := range filter {
+		var conditions []string
+		for _, comparison := range term {
+			condition, conditionArgs, err := scimCondition(comparison, columns)
+			if err != nil {
+				return nil, err
+			}
+			conditions = append(conditions, condition)
+			args = append(args, conditionArgs...)
+		}
+		terms = append(terms, "("+strings.Join(conditions, " AND ")+")")
+	}
+	return db.Where("("+strings.Join(terms, " OR ")+")", args...).Session(&gorm.Session{}), nil
+}
+
+// scimCondition translates the comparison into an SQL condition.
+func scimCondition(comparison *models.SCIMComparison, columns map[string]scimColumn) (string, []interface{}, error) {
+	column, ok := columns[comparison.Attribute]
+	if !ok {
+		return "", nil, fmt.Errorf("%w: attribute %q cannot be filtered on", ErrUnsupportedFilter, comparison.Attribute)
+	}
+	if comparison.Operator == models.SCIM_FILTER_PR {
+		if column.boolean {
+			return column.expression + " IS NOT NULL", nil, nil
+		}
+		return column.expression + " IS NOT NULL AND " + column.expression + " <> ''", nil, nil
+	}
+
+	if column.boolean {
+		value, ok := comparison.Value.(bool)
+		if !ok {
+			return "", nil, fmt.Errorf("%w: attribute %q holds a boolean", ErrUnsupportedFilter, comparison.Attribute)
+		}
+		operator := scimComparisonOperators[comparison.Operator]
+		if comparison.Operator != models.SCIM_FILTER_EQ && comparison.Operator != models.SCIM_FILTER_NE {
+			return "", nil, fmt.Errorf("%w: operator %q does not apply to booleans", ErrUnsupportedFilter, comparison.Operator)
+		}
+		return column.expression + " " + operator + " ?", []interface{}{value}, nil
+	}
+
+	value, ok := comparison.Value.(string)
+	if !ok {
+		return "", nil, fmt.Errorf("%w: attribute %q holds a string", ErrUnsupportedFilter, comparison.Attribute)
+	}
+	expression := column.expression
+	placeholder := "?"
+	if !column.caseExact {
+		expression = "LOWER(" + expression + ")"
+		placeholder = "LOWER(?)"
+	}
+	if operator, ok := scimComparisonOperators[comparison.Operator]; ok {
+		return expression + " " + operator + " " + placeholder, []interface{}{value}, nil
+	}
+	pattern := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+	switch comparison.Operator {
+	case models.SCIM_FILTER_CO:
+		pattern = "%" + pattern + "%"
+	case models.SCIM_FILTER_SW:
+		pattern = pattern + "%"
+	case models.SCIM_FILTER_EW:
+		pattern = "%" + pattern
+	}
+	return expression + " LIKE " + placeholder, []interface{}{pattern}, nil
+}
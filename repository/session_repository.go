@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"auth-server/models"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type SessionRepository struct {
+	db *gorm.DB
+}
+
+func NewSessionRepository(db *gorm.DB) *SessionRepository {
+	return &SessionRepository{
+		db: db,
+	}
+}
+
+// WithTenant returns a copy of the repository that only sees the sessions of
+// the tenant, and assigns the sessions it creates to it.
+func (p *SessionRepository) WithTenant(tenantId uuid.UUID) *SessionRepository {
+	return &SessionRepository{
+		db: bindTenant(p.db, tenantId),
+	}
+}
+
+func (p *SessionRepository) FindAll(ctx context.Context) ([]*models.Session, error) {
+	var sessions []*models.Session
+	err := p.db.WithContext(ctx).Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (p *SessionRepository) FindById(ctx context.Context, id string) (*models.Session, error) {
+	return p.findOne(ctx, "id = ?", id)
+}
+
+// FindByToken returns the session whose cookie holds the given value, along
+// with its user, or nil if there is none.
+func (p *SessionRepository) FindByToken(ctx context.Context, token string) (*models.Session, error) {
+	return p.findOne(ctx, "token_hash = ?", models.HashSessionToken(token))
+}
+
+func (p *SessionRepository) findOne(ctx context.Context, query string, args ...interface{}) (*models.Session, error) {
+	var session models.Session
+	err := p.db.WithContext(ctx).Preload("User").Where(query, args...).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// FindByUserId returns the sessions of the user that have not expired, most
+// recently used first.
+func (p *SessionRepository) FindByUserId(ctx context.Context, userId string) ([]*models.Session, error) {
+	var sessions []*models.Session
+	err := p.db.WithContext(ctx).
+		Where("user_id = ? AND expires_at > ?", userId, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (p *SessionRepository) Save(ctx context.Context, entity interface{}) (*models.Session, error) {
+	session := entity.(*models.Session)
+	err := p.db.WithContext(ctx).Omit("User").Save(session).Error
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Touch records that the session was used at the given time.
+func (p *SessionRepository) Touch(ctx context.Context, id string, at time.Time) error {
+	return p.db.WithContext(ctx).Model(&models.Session{}).Where("id = ?", id).Update("last_seen_at", at).Error
+}
+
+func (p *SessionRepository) Delete(ctx context.Context, id string) error {
+	err := p.db.WithContext(ctx).Where("id = ?", id).Delete(&models.Session{}).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeleteByUserId deletes every session of the user.
+func (p *SessionRepository) DeleteByUserId(ctx context.Context, userId string) error {
+	return p.db.WithContext(ctx).Where("user_id = ?", userId).Delete(&models.Session{}).Error
+}
+
+// DeleteExpired removes the sessions that expired, or have been idle since
+// before idleSince.
+func (p *SessionRepository) DeleteExpired(ctx context.Context, idleSince time.Time) error {
+	return p.db.WithContext(ctx).
+		Where("expires_at < ? OR last_seen_at < ?", time.Now(), idleSince).
+		Delete(&models.Session{}).Error
+}
@@ -0,0 +1,253 @@
+package repository
+
+import (
+	"auth-server/models"
+	"context"
+	"errors"
+	"reflect"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// tenantSettingKey is the gorm setting holding the id of the tenant a
+// database handle is bound to.
+const tenantSettingKey = "auth-server:tenant_id"
+
+// tenantScopedTables are the tables whose rows belong to a tenant, along with
+// the unique constraints they had before uniqueness was scoped per tenant.
+var tenantScopedTables = map[string][]string{
+	"users":                  {"users_email_key", "users_username_key", "idx_users_email", "idx_users_username"},
+	"clients":                {"clients_client_name_key", "idx_clients_client_name"},
+	"applications":           {"applications_app_name_key", "idx_applications_app_name"},
+	"roles":                  {},
+	"permissions":            {},
+	"groups":                 {},
+	"policies":               {},
+	"identity_providers":     {"identity_providers_name_key", "idx_identity_providers_name"},
+	"saml_service_providers": {"saml_service_providers_name_key", "saml_service_providers_entity_id_key", "idx_saml_service_providers_name", "idx_saml_service_providers_entity_id"},
+	"sessions":               {},
+	"consents":               {},
+	"refresh_tokens":         {},
+	"device_codes":           {},
+}
+
+type TenantRepository struct {
+	db *gorm.DB
+}
+
+func NewTenantRepository(db *gorm.DB) *TenantRepository {
+	return &TenantRepository{
+		db: db,
+	}
+}
+
+// RegisterTenantCallbacks scopes the statements of database handles bound to
+// a tenant with bindTenant: queries, updates and deletions of the models
+// holding a TenantID only see the rows of the tenant, and created rows are
+// assigned to it. Handles that are not bound to a tenant see every row.
+func RegisterTenantCallbacks(db *gorm.DB) error {
+	err := db.Callback().Create().Before("gorm:create").Register("tenant:assign", assignTenant)
+	if err != nil {
+		return err
+	}
+	err = db.Callback().Query().Before("gorm:query").Register("tenant:scope", scopeTenant)
+	if err != nil {
+		return err
+	}
+	err = db.Callback().Row().Before("gorm:row").Register("tenant:scope", scopeTenant)
+	if err != nil {
+		return err
+	}
+	err = db.Callback().Update().Before("gorm:update").Register("tenant:assign", assignTenant)
+	if err != nil {
+		return err
+	}
+	err = db.Callback().Update().Before("gorm:update").Register("tenant:scope", scopeTenant)
+	if err != nil {
+		return err
+	}
+	return db.Callback().Delete().Before("gorm:delete").Register("tenant:scope", scopeTenant)
+}
+
+// bindTenant returns a handle on the database whose statements are scoped to
+// the tenant.
+func bindTenant(db *gorm.DB, tenantId uuid.UUID) *gorm.DB {
+	return db.Set(tenantSettingKey, tenantId).Session(&gorm.Session{})
+}
+
+// boundTenant returns the tenant the statement is scoped to, if any, provided
+// its model belongs to tenants.
+func boundTenant(db *gorm.DB) (uuid.UUID, bool) {
+	if db.Statement.Schema == nil || db.Statement.Schema.LookUpField("TenantID") == nil {
+		return uuid.Nil, false
+	}
+	value, ok := db.Get(tenantSettingKey)
+	if !ok {
+		return uuid.Nil, false
+	}
+	return value.(uuid.UUID), true
+}
+
+func scopeTenant(db *gorm.DB) {
+	tenantId, ok := boundTenant(db)
+	if !ok {
+		return
+	}
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: "tenant_id"}, Value: tenantId},
+	}})
+}
+
+func assignTenant(db *gorm.DB) {
+	tenantId, ok := boundTenant(db)
+	if !ok {
+		return
+	}
+	field := db.Statement.Schema.LookUpField("TenantID")
+	assign := func(value reflect.Value) {
+		if _, zero := field.ValueOf(db.Statement.Context, value); zero {
+			db.AddError(field.Set(db.Statement.Context, value, tenantId))
+		}
+	}
+	switch db.Statement.ReflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < db.Statement.ReflectValue.Len(); i++ {
+			assign(reflect.Indirect(db.Statement.ReflectValue.Index(i)))
+		}
+	case reflect.Struct:
+		assign(db.Statement.ReflectValue)
+	}
+}
+
+func (p *TenantRepository) FindAll(ctx context.Context) ([]*models.Tenant, error) {
+	var tenants []*models.Tenant
+	err := p.db.WithContext(ctx).Order("name").Find(&tenants).Error
+	if err != nil {
+		return nil, err
+	}
+	return tenants, nil
+}
+
+func (p *TenantRepository) FindById(ctx context.Context, id string) (*models.Tenant, error) {
+	var tenant models.Tenant
+	err := p.db.WithContext(ctx).Where("id = ?", id).First(&tenant).Error
+	if err != nil {
+		return nil, err
+	}
+	return &tenant, nil
+}
+
+// FindByName returns the tenant with the given name, or nil if there is none.
+func (p *TenantRepository) FindByName(ctx context.Context, name string) (*models.Tenant, error) {
+	var tenant models.Tenant
+	err := p.db.WithContext(ctx).Where("name = ?", name).First(&tenant).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tenant, nil
+}
+
+// FindByHost returns the tenant served at the given host, or nil if there is
+// none.
+func (p *TenantRepository) FindByHost(ctx context.Context, host string) (*models.Tenant, error) {
+	var tenant models.Tenant
+	err := p.db.WithContext(ctx).Where("host = ?", host).First(&tenant).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tenant, nil
+}
+
+// IsEmpty returns true if no user, client, application, role, permission,
+// group, identity provider, SAML service provider or webhook belongs to the
+// tenant.
+func (p *TenantRepository) IsEmpty(ctx context.Context, id string) (bool, error) {
+	for _, model := range []interface{}{
+		&models.User{},
+		&models.Client{},
+		&models.Application{},
+		&models.Role{},
+		&models.Permission{},
+		&models.Group{},
+		&models.IdentityProvider{},
+		&models.SAMLServiceProvider{},
+		&models.Webhook{},
+	} {
+		var count int64
+		err := p.db.WithContext(ctx).Model(model).Where("tenant_id = ?", id).Count(&count).Error
+		if err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (p *TenantRepository) Save(ctx context.Context, entity interface{}) (*models.Tenant, error) {
+	tenant := entity.(*models.Tenant)
+	err := p.db.WithContext(ctx).Save(tenant).Error
+	if err != nil {
+		return nil, err
+	}
+	return tenant, nil
+}
+
+func (p *TenantRepository) Delete(ctx context.Context, id string) error {
+	return p.db.WithContext(ctx).Where("id = ?", id).Delete(&models.Tenant{}).Error
+}
+
+// MigrateDefaultTenant creates the default tenant if it does not exist yet,
+// moves the entities created before tenants existed into it, and drops the
+// unique constraints those had across all tenants. It returns the default
+// tenant.
+func (p *TenantRepository) MigrateDefaultTenant(ctx context.Context) (*models.Tenant, error) {
+	tenant, err := p.FindByName(ctx, models.DEFAULT_TENANT_NAME)
+	if err != nil {
+		return nil, err
+	}
+	if tenant == nil {
+		tenant, err = p.Save(ctx, &models.Tenant{
+			BaseUUIDEntity: models.BaseUUIDEntity{
+				ID: uuid.New(),
+			},
+			Name:        models.DEFAULT_TENANT_NAME,
+			DisplayName: "Default",
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for table, constraints := range tenantScopedTables {
+			err := tx.Exec("UPDATE "+table+" SET tenant_id = ? WHERE tenant_id IS NULL", tenant.ID).Error
+			if err != nil {
+				return err
+			}
+			for _, constraint := range constraints {
+				err = tx.Exec("ALTER TABLE " + table + " DROP CONSTRAINT IF EXISTS " + constraint).Error
+				if err != nil {
+					return err
+				}
+				err = tx.Exec("DROP INDEX IF EXISTS " + constraint).Error
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tenant, nil
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const tracingSpanKey = "tracing:span"
+
+var tracer = otel.Tracer("auth-server/repository")
+
+// TracingPlugin is a GORM plugin tracing every statement as a span of the
+// trace carried by the context it was made with. Statements made outside of
+// a traced operation, such as by background jobs, are not traced, so that
+// they do not start traces of their own.
+type TracingPlugin struct{}
+
+// NewTracingPlugin creates a new instance of TracingPlugin.
+func NewTracingPlugin() *TracingPlugin {
+	return &TracingPlugin{}
+}
+
+func (p *TracingPlugin) Name() string {
+	return "tracing"
+}
+
+func (p *TracingPlugin) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	processors := []struct {
+		operation string
+		before    func(string, func(*gorm.DB)) error
+		after     func(string, func(*gorm.DB)) error
+	}{
+		{"create", callbacks.Create().Before("gorm:create").Register, callbacks.Create().After("gorm:create").Register},
+		{"query", callbacks.Query().Before("gorm:query").Register, callbacks.Query().After("gorm:query").Register},
+		{"update", callbacks.Update().Before("gorm:update").Register, callbacks.Update().After("gorm:update").Register},
+		{"delete", callbacks.Delete().Before("gorm:delete").Register, callbacks.Delete().After("gorm:delete").Register},
+		{"row", callbacks.Row().Before("gorm:row").Register, callbacks.Row().After("gorm:row").Register},
+		{"raw", callbacks.Raw().Before("gorm:raw").Register, callbacks.Raw().After("gorm:raw").Register},
+	}
+	for _, processor := range processors {
+		err := processor.before("tracing:start", startStatementSpan(processor.operation))
+		if err != nil {
+			return err
+		}
+		err = processor.after("tracing:end", endStatementSpan(processor.operation))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startStatementSpan returns the callback starting the span of a statement of
+// the operation, provided its context is traced.
+func startStatementSpan(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx := db.Statement.Context
+		if !trace.SpanContextFromContext(ctx).IsValid() {
+			return
+		}
+		ctx, span := tracer.Start(ctx, "gorm."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperation(operation)),
+		)
+		db.Statement.Context = ctx
+		db.InstanceSet(tracingSpanKey, span)
+	}
+}
+
+// endStatementSpan returns the callback ending the span of a statement of the
+// operation, if it was traced, with the table and SQL it ran. Bound values are
+// left out of the SQL, so that secrets are not exported. Missing records are
+// not errors, since repositories expect them.
+func endStatementSpan(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		value, ok := db.InstanceGet(tracingSpanKey)
+		if !ok {
+			return
+		}
+		span := value.(trace.Span)
+		defer span.End()
+		if table := db.Statement.Table; table != "" {
+			span.SetName("gorm." + operation + " " + table)
+			span.SetAttributes(semconv.DBSQLTable(table))
+		}
+		span.SetAttributes(
+			semconv.DBStatement(db.Statement.SQL.String()),
+			attribute.Int64("db.rows_affected", db.Statement.RowsAffected),
+		)
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+			span.RecordError(db.Error)
+			span.SetStatus(codes.Error, db.Error.Error())
+		}
+	}
+}
@@ -3,8 +3,10 @@ package repository
 import (
 	"auth-server/models"
 	"context"
+	"database/sql"
 	"errors"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
@@ -18,6 +20,14 @@ func NewUserRepository(db *gorm.DB) *UserRepository {
 	}
 }
 
+// WithTenant returns a copy of the repository that only sees the users of
+// the tenant, and assigns the users it creates to it.
+func (p *UserRepository) WithTenant(tenantId uuid.UUID) *UserRepository {
+	return &UserRepository{
+		db: bindTenant(p.db, tenantId),
+	}
+}
+
 func (p *UserRepository) FindAll(ctx context.Context) ([]*models.User, error) {
 	var users []*models.User
 	err := p.db.WithContext(ctx).Preload("Roles.Application").Preload("Roles").Find(&users).Error
@@ -27,6 +37,26 @@ func (p *UserRepository) FindAll(ctx context.Context) ([]*models.User, error) {
 	return users, nil
 }
 
+// FindByFilter returns a page of the users matching the SCIM filter, ordered
+// by username, along with the number of users matching it.
+func (p *UserRepository) FindByFilter(ctx context.Context, filter models.SCIMFilter, offset int, limit int) ([]*models.User, int64, error) {
+	query, err := applySCIMFilter(p.db.WithContext(ctx).Model(&models.User{}), filter, scimUserColumns)
+	if err != nil {
+		return nil, 0, err
+	}
+	var total int64
+	err = query.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	var users []*models.User
+	err = query.Preload("Roles.Application").Preload("Groups").Order("username").Offset(offset).Limit(limit).Find(&users).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
 func (p *UserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
 	var user models.User
 	err := p.db.WithContext(ctx).Preload("Roles.Application").Preload("Roles").Where("email = ?", email).First(&user).Error
@@ -96,12 +126,38 @@ func (p *UserRepository) AssignRolesToUser(ctx context.Context, user *models.Use
 	return nil
 }
 
+// RemoveRolesFromUser revokes the roles assigned to the user directly.
+func (p *UserRepository) RemoveRolesFromUser(ctx context.Context, user *models.User, roles []*models.Role) error {
+	return p.db.WithContext(ctx).Model(user).Association("Roles").Delete(roles)
+}
+
+// Delete deletes the user along with their role assignments, group
+// memberships, sessions, consents, tokens and external identities.
 func (p *UserRepository) Delete(ctx context.Context, id string) error {
-	err := p.db.WithContext(ctx).Where("id = ?", id).Delete(&models.User{}).Error
-	if err != nil {
-		return err
-	}
-	return nil
+	return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec("DELETE FROM user_roles WHERE user_id = ?", id).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Exec("DELETE FROM user_groups WHERE user_id = ?", id).Error
+		if err != nil {
+			return err
+		}
+		for _, model := range []interface{}{
+			&models.Session{},
+			&models.Consent{},
+			&models.RefreshToken{},
+			&models.AuthorizationCode{},
+			&models.DeviceCode{},
+			&models.ExternalIdentity{},
+		} {
+			err = tx.Where("user_id = ?", id).Delete(model).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Where("id = ?", id).Delete(&models.User{}).Error
+	})
 }
 
 func (p *UserRepository) GetUserRoles(ctx context.Context, user *models.User) ([]*models.Role, error) {
@@ -112,3 +168,40 @@ func (p *UserRepository) GetUserRoles(ctx context.Context, user *models.User) ([
 	}
 	return roles, nil
 }
+
+// userGroupRolesQuery selects the ids of the roles assigned to the groups a
+// user belongs to, or to any of their ancestors.
+const userGroupRolesQuery = `
+WITH RECURSIVE user_group_tree AS (
+	SELECT g.id, g.parent_id FROM groups g
+	JOIN user_groups ug ON ug.group_id = g.id
+	WHERE ug.user_id = @user
+	UNION
+	SELECT g.id, g.parent_id FROM groups g
+	JOIN user_group_tree t ON g.id = t.parent_id
+)
+SELECT gr.role_id FROM group_roles gr
+JOIN user_group_tree t ON gr.group_id = t.id`
+
+// GetEffectiveRoles returns the roles assigned to the user directly, along with
+// the roles assigned to the groups the user belongs to and their ancestors.
+func (p *UserRepository) GetEffectiveRoles(ctx context.Context, user *models.User) ([]*models.Role, error) {
+	var roles []*models.Role
+	err := p.db.WithContext(ctx).Preload("Application").
+		Where("id IN (SELECT role_id FROM user_roles WHERE user_id = @user)", sql.Named("user", user.ID)).
+		Or("id IN ("+userGroupRolesQuery+")", sql.Named("user", user.ID)).
+		Find(&roles).Error
+	if err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (p *UserRepository) GetUserGroups(ctx context.Context, user *models.User) ([]*models.Group, error) {
+	var groups []*models.Group
+	err := p.db.WithContext(ctx).Model(user).Association("Groups").Find(&groups)
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
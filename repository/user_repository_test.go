@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"auth-server/models"
+	"auth-server/repository/repositorytest"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestGetEffectiveRoles(t *testing.T) {
+	db, fake := repositorytest.New(t)
+	app := &models.Application{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, AppName: "app"}
+	user := &models.User{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, Username: "alice"}
+	direct := &models.Role{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, Name: "direct", ApplicationID: app.ID}
+	inherited := &models.Role{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, Name: "inherited", ApplicationID: app.ID}
+	fake.Return(`FROM "roles"`, direct, inherited)
+	fake.Return(`FROM "applications"`, app)
+
+	roles, err := NewUserRepository(db).GetEffectiveRoles(context.Background(), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, role := range roles {
+		names = append(names, role.Name)
+		if role.Application == nil || role.Application.ID != app.ID {
+			t.Errorf("the application of %s was not loaded", role.Name)
+		}
+	}
+	if !reflect.DeepEqual(names, []string{"direct", "inherited"}) {
+		t.Errorf("roles = %v", names)
+	}
+
+	statements := fake.Statements()
+	if len(statements) != 2 {
+		t.Fatalf("statements = %q", statements)
+	}
+	query := strings.Join(strings.Fields(statements[0]), " ")
+	userId := "'" + user.ID.String() + "'"
+	for _, want := range []string{
+		// Roles assigned to the user directly.
+		"id IN (SELECT role_id FROM user_roles WHERE user_id = " + userId + ")",
+		// The groups the user belongs to.
+		"JOIN user_groups ug ON ug.group_id = g.id WHERE ug.user_id = " + userId,
+		// Walked up to their ancestors, each group once.
+		"UNION SELECT g.id, g.parent_id FROM groups g JOIN user_group_tree t ON g.id = t.parent_id",
+		// And the roles of every group in the tree.
+		"SELECT gr.role_id FROM group_roles gr JOIN user_group_tree t ON gr.group_id = t.id",
+	} {
+		if !strings.Contains(query, want) {
+			t.Errorf("query does not contain %q: %s", want, query)
+		}
+	}
+	if strings.Contains(query, "UNION ALL") {
+		t.Errorf("query could walk group cycles forever: %s", query)
+	}
+}
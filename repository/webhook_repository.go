@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"auth-server/models"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type WebhookRepository struct {
+	db *gorm.DB
+}
+
+func NewWebhookRepository(db *gorm.DB) *WebhookRepository {
+	return &WebhookRepository{
+		db: db,
+	}
+}
+
+// WithTenant returns a copy of the repository that only sees the webhooks of
+// the tenant, and assigns the webhooks it creates to it.
+func (p *WebhookRepository) WithTenant(tenantId uuid.UUID) *WebhookRepository {
+	return &WebhookRepository{
+		db: bindTenant(p.db, tenantId),
+	}
+}
+
+func (p *WebhookRepository) FindAll(ctx context.Context) ([]*models.Webhook, error) {
+	var webhooks []*models.Webhook
+	err := p.db.WithContext(ctx).Order("name").Find(&webhooks).Error
+	if err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (p *WebhookRepository) FindById(ctx context.Context, id string) (*models.Webhook, error) {
+	var webhook models.Webhook
+	err := p.db.WithContext(ctx).Where("id = ?", id).First(&webhook).Error
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// FindSubscribed returns the enabled webhooks subscribed to the event type.
+func (p *WebhookRepository) FindSubscribed(ctx context.Context, eventType string) ([]*models.Webhook, error) {
+	events, err := json.Marshal([]string{eventType})
+	if err != nil {
+		return nil, err
+	}
+	var webhooks []*models.Webhook
+	err = p.db.WithContext(ctx).Where("disabled = ? AND events @> ?::jsonb", false, string(events)).Find(&webhooks).Error
+	if err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (p *WebhookRepository) Save(ctx context.Context, entity interface{}) (*models.Webhook, error) {
+	webhook := entity.(*models.Webhook)
+	err := p.db.WithContext(ctx).Save(webhook).Error
+	if err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+// Delete deletes the webhook along with its deliveries, including those that
+// are still pending.
+func (p *WebhookRepository) Delete(ctx context.Context, id string) error {
+	return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("webhook_id = ?", id).Delete(&models.WebhookDelivery{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).Delete(&models.Webhook{}).Error
+	})
+}
+
+type WebhookDeliveryRepository struct {
+	db *gorm.DB
+}
+
+func NewWebhookDeliveryRepository(db *gorm.DB) *WebhookDeliveryRepository {
+	return &WebhookDeliveryRepository{
+		db: db,
+	}
+}
+
+// WithTenant returns a copy of the repository that only sees the deliveries
+// of the tenant, and assigns the deliveries it creates to it.
+func (p *WebhookDeliveryRepository) WithTenant(tenantId uuid.UUID) *WebhookDeliveryRepository {
+	return &WebhookDeliveryRepository{
+		db: bindTenant(p.db, tenantId),
+	}
+}
+
+func (p *WebhookDeliveryRepository) FindAll(ctx context.Context) ([]*models.WebhookDelivery, error) {
+	var deliveries []*models.WebhookDelivery
+	err := p.db.WithContext(ctx).Order("id").Find(&deliveries).Error
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (p *WebhookDeliveryRepository) FindById(ctx context.Context, id string) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	err := p.db.WithContext(ctx).Preload("Webhook").Where("id = ?", id).First(&delivery).Error
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// FindByWebhook returns a page of the deliveries of the webhook, most recent
+// first, along with the number of deliveries it has.
+func (p *WebhookDeliveryRepository) FindByWebhook(ctx context.Context, webhookId uuid.UUID, offset int, limit int) ([]*models.WebhookDelivery, int64, error) {
+	query := p.db.WithContext(ctx).Model(&models.WebhookDelivery{}).Where("webhook_id = ?", webhookId)
+	var total int64
+	err := query.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	var deliveries []*models.WebhookDelivery
+	err = query.Order("id DESC").Offset(offset).Limit(limit).Find(&deliveries).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return deliveries, total, nil
+}
+
+// ClaimDue returns up to limit pending deliveries whose next attempt is due,
+// along with their webhooks, and postpones their next attempt by the lease,
+// so that other instances of the server do not attempt them concurrently.
+// Deliveries whose attempt is not recorded before the lease expires are
+// claimed again.
+func (p *WebhookDeliveryRepository) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.WebhookDelivery, error) {
+	var ids []uint
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.WebhookDelivery{}).
+			Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", models.WEBHOOK_DELIVERY_PENDING, now).
+			Order("next_attempt_at").Limit(limit).Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+		return tx.Model(&models.WebhookDelivery{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(lease)).Error
+	})
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	var deliveries []*models.WebhookDelivery
+	err = p.db.WithContext(ctx).Preload("Webhook").Where("id IN ?", ids).Order("id").Find(&deliveries).Error
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (p *WebhookDeliveryRepository) Save(ctx context.Context, entity interface{}) (*models.WebhookDelivery, error) {
+	delivery := entity.(*models.WebhookDelivery)
+	err := p.db.WithContext(ctx).Omit("Webhook").Save(delivery).Error
+	if err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+func (p *WebhookDeliveryRepository) Delete(ctx context.Context, id string) error {
+	return p.db.WithContext(ctx).Where("id = ?", id).Delete(&models.WebhookDelivery{}).Error
+}
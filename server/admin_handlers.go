@@ -6,7 +6,10 @@ import (
 	"auth-server/repository"
 	"auth-server/services"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -16,9 +19,8 @@ import (
 // it creates a new user, expecting it as a SignupRequest.
 // When called via GET, it retrieves all users.
 func (s *Server) HandleUser(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
 	repo := s.userRepository.(*repository.UserRepository)
-	service := services.NewUserService(repo)
+	service := services.NewUserService(repo).WithEvents(s.webhookDispatcher())
 	var response []byte
 
 	switch r.Method {
@@ -48,6 +50,7 @@ func (s *Server) HandleUser(w http.ResponseWriter, r *http.Request) {
 		}
 		signupRequest.Password = password
 		result, err := service.CreateUser(&signupRequest)
+		s.audit(r, models.AUDIT_ACTION_USER_CREATE, signupRequest.Username, err, nil, result)
 		if err != nil {
 			s.HandleError(w, http.StatusConflict, ADMIN_USER_ROUTE, err)
 			return
@@ -63,12 +66,10 @@ func (s *Server) HandleUser(w http.ResponseWriter, r *http.Request) {
 	status := s.getStatusCode(r.Method)
 	w.WriteHeader(status)
 	w.Write(response)
-	s.logger.Info(status, ADMIN_USER_ROUTE, start)
 }
 
 // HandleUserDetails retrieves user details by username.
 func (s *Server) HandleUserDetails(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
 	vars := mux.Vars(r)
 	repo := s.userRepository.(*repository.UserRepository)
 	service := services.NewUserService(repo)
@@ -96,13 +97,11 @@ func (s *Server) HandleUserDetails(w http.ResponseWriter, r *http.Request) {
 	status := s.getStatusCode(r.Method)
 	w.WriteHeader(status)
 	w.Write(response)
-	s.logger.Info(status, ADMIN_USER_DETAILS_ROUTE, start)
 }
 
 func (s *Server) HandleRole(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
 	repo := s.roleRepository.(*repository.RoleRepository)
-	service := services.NewRoleService(repo)
+	service := services.NewRoleService(repo).WithEvents(s.webhookDispatcher())
 	var response []byte
 
 	switch r.Method {
@@ -136,6 +135,7 @@ func (s *Server) HandleRole(w http.ResponseWriter, r *http.Request) {
 		}
 
 		result, err := service.CreateRole(&data, app)
+		s.audit(r, models.AUDIT_ACTION_ROLE_CREATE, data.Name, err, nil, result)
 		if err != nil {
 			s.HandleError(w, http.StatusConflict, ADMIN_ROLE_ROUTE, err)
 			return
@@ -151,11 +151,9 @@ func (s *Server) HandleRole(w http.ResponseWriter, r *http.Request) {
 	status := s.getStatusCode(r.Method)
 	w.WriteHeader(status)
 	w.Write(response)
-	s.logger.Info(status, ADMIN_ROLE_ROUTE, start)
 }
 
 func (s *Server) HandlePermission(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
 	repo := s.permissionRepository.(*repository.PermissionRepository)
 	service := services.NewPermissionService(repo)
 	var response []byte
@@ -181,7 +179,21 @@ func (s *Server) HandlePermission(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		result, err := service.CreatePermission(&permissionRequest)
+		roleRepo := s.roleRepository.(*repository.RoleRepository)
+		roleService := services.NewRoleService(roleRepo)
+
+		var roles []*models.Role
+		for _, roleId := range permissionRequest.RoleIDs {
+			role, err := roleService.GetRoleById(roleId)
+			if err != nil {
+				s.HandleError(w, http.StatusNotFound, ADMIN_PERMISSION_ROUTE, err)
+				return
+			}
+			roles = append(roles, role)
+		}
+
+		result, err := service.CreatePermission(&permissionRequest, roles)
+		s.audit(r, models.AUDIT_ACTION_PERMISSION_CREATE, permissionRequest.Name, err, nil, result)
 		if err != nil {
 			s.HandleError(w, http.StatusConflict, ADMIN_PERMISSION_ROUTE, err)
 			return
@@ -198,11 +210,9 @@ func (s *Server) HandlePermission(w http.ResponseWriter, r *http.Request) {
 	status := s.getStatusCode(r.Method)
 	w.WriteHeader(status)
 	w.Write(response)
-	s.logger.Info(status, ADMIN_PERMISSION_ROUTE, start)
 }
 
 func (s *Server) HandleClient(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
 	repo := s.clientRepository.(*repository.ClientRepository)
 	service := services.NewClientService(repo)
 	var response []byte
@@ -220,7 +230,7 @@ func (s *Server) HandleClient(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	case http.MethodPost:
-		var clientRequest models.ClientDto
+		var clientRequest models.ClientRequest
 		decoder := json.NewDecoder(r.Body)
 		err := decoder.Decode(&clientRequest)
 		if err != nil {
@@ -229,8 +239,9 @@ func (s *Server) HandleClient(w http.ResponseWriter, r *http.Request) {
 		}
 
 		client, err := service.CreateClient(&clientRequest)
+		s.audit(r, models.AUDIT_ACTION_CLIENT_CREATE, clientRequest.ClientName, err, nil, client)
 		if err != nil {
-			s.HandleError(w, http.StatusConflict, ADMIN_CLIENT_ROUTE, err)
+			s.HandleError(w, clientErrorStatus(err), ADMIN_CLIENT_ROUTE, err)
 			return
 		}
 
@@ -245,11 +256,79 @@ func (s *Server) HandleClient(w http.ResponseWriter, r *http.Request) {
 	status := s.getStatusCode(r.Method)
 	w.WriteHeader(status)
 	w.Write(response)
-	s.logger.Info(status, ADMIN_CLIENT_ROUTE, start)
+}
+
+// HandleClientDetails handles the retrieval, update and deletion of a client.
+// When called via PUT, it replaces all of the client's settings, which is how
+// clients are enabled and disabled.
+func (s *Server) HandleClientDetails(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	repo := s.clientRepository.(*repository.ClientRepository)
+	service := services.NewClientService(repo)
+	var response []byte
+
+	client, err := service.GetClientById(vars["id"])
+	if err != nil {
+		s.HandleError(w, http.StatusNotFound, ADMIN_CLIENT_DETAILS_ROUTE, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		response, err = json.Marshal(mapper.ClientToClientDto(client))
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_CLIENT_DETAILS_ROUTE, err)
+			return
+		}
+	case http.MethodPut:
+		var clientRequest models.ClientRequest
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&clientRequest)
+		if err != nil {
+			s.HandleError(w, http.StatusBadRequest, ADMIN_CLIENT_DETAILS_ROUTE, err)
+			return
+		}
+
+		before := mapper.ClientToClientDto(client)
+		result, err := service.UpdateClient(client, &clientRequest)
+		s.audit(r, models.AUDIT_ACTION_CLIENT_UPDATE, client.ID.String(), err, before, result)
+		if err != nil {
+			s.HandleError(w, clientErrorStatus(err), ADMIN_CLIENT_DETAILS_ROUTE, err)
+			return
+		}
+		response, err = json.Marshal(result)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_CLIENT_DETAILS_ROUTE, err)
+			return
+		}
+	case http.MethodDelete:
+		err := service.DeleteClient(client)
+		s.audit(r, models.AUDIT_ACTION_CLIENT_DELETE, client.ID.String(), err, mapper.ClientToClientDto(client), nil)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_CLIENT_DETAILS_ROUTE, err)
+			return
+		}
+		status := s.getStatusCode(r.Method)
+		w.WriteHeader(status)
+		return
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// clientErrorStatus returns 400 for invalid client settings, and 409 for
+// other errors saving a client, such as a duplicate name.
+func clientErrorStatus(err error) int {
+	if errors.Is(err, services.ErrInvalidClientMetadata) || errors.Is(err, services.ErrInvalidRedirectURI) {
+		return http.StatusBadRequest
+	}
+	return http.StatusConflict
 }
 
 func (s *Server) HandleApplication(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
 	repo := s.applicationRepository.(*repository.ApplicationRepository)
 	service := services.NewApplicationService(repo)
 	var response []byte
@@ -276,6 +355,7 @@ func (s *Server) HandleApplication(w http.ResponseWriter, r *http.Request) {
 		}
 
 		app, err := service.CreateApplication(&models.ApplicationDto{AppName: applicationRequest.AppName})
+		s.audit(r, models.AUDIT_ACTION_APPLICATION_CREATE, applicationRequest.AppName, err, nil, app)
 		if err != nil {
 			s.HandleError(w, http.StatusConflict, ADMIN_APPLICATION_ROUTE, err)
 			return
@@ -292,18 +372,17 @@ func (s *Server) HandleApplication(w http.ResponseWriter, r *http.Request) {
 	status := s.getStatusCode(r.Method)
 	w.WriteHeader(status)
 	w.Write(response)
-	s.logger.Info(status, ADMIN_APPLICATION_ROUTE, start)
 }
 
 // HandleUserRoles handles user roles retrieval and assignment. This handler works with
-// GET, POST, and PATCH methods. When called via GET, it retrieves all roles assigned to a user.
+// GET, POST, and PATCH methods. When called via GET, it retrieves all roles of a user, whether
+// assigned directly or through the groups the user belongs to.
 // When called via POST, it assigns roles to a user. When called via PATCH, it updates the roles
 // assigned to a user.
 func (s *Server) HandleUserRoles(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
 	vars := mux.Vars(r)
 	repo := s.userRepository.(*repository.UserRepository)
-	service := services.NewUserService(repo)
+	service := services.NewUserService(repo).WithEvents(s.webhookDispatcher())
 	var response []byte
 
 	user, err := service.GetByUsername(vars["username"])
@@ -360,7 +439,6 @@ func (s *Server) HandleUserRoles(w http.ResponseWriter, r *http.Request) {
 	status := s.getStatusCode(r.Method)
 	w.WriteHeader(status)
 	w.Write(response)
-	s.logger.Info(status, ADMIN_APPLICATION_ROUTE, start)
 }
 
 func (s *Server) handleRoleAssignment(r *http.Request, user *models.User, service *services.UserService) ([]*models.RoleDto, error) {
@@ -388,10 +466,13 @@ func (s *Server) handleRoleAssignment(r *http.Request, user *models.User, servic
 		roleEntities = append(roleEntities, entity)
 	}
 
+	before := mapper.RolesToRoleDtos(user.Roles)
 	result, err := service.AssignRolesToUser(user, roleEntities)
 	if err != nil {
+		s.audit(r, models.AUDIT_ACTION_USER_ROLES_ASSIGN, user.Username, err, before, nil)
 		return nil, err
 	}
+	s.audit(r, models.AUDIT_ACTION_USER_ROLES_ASSIGN, user.Username, nil, before, result.Roles)
 
 	return result.Roles, nil
 }
@@ -421,10 +502,762 @@ func (s *Server) handleRoleUpdate(r *http.Request, user *models.User, service *s
 		roleEntities = append(roleEntities, entity)
 	}
 
+	before := mapper.RolesToRoleDtos(user.Roles)
 	result, err := service.AddRolesToUser(user, roleEntities)
 	if err != nil {
+		s.audit(r, models.AUDIT_ACTION_USER_ROLES_ADD, user.Username, err, before, nil)
 		return nil, err
 	}
+	s.audit(r, models.AUDIT_ACTION_USER_ROLES_ADD, user.Username, nil, before, result.Roles)
 
 	return result.Roles, nil
 }
+
+// HandleRoleComposites handles the retrieval and assignment of the roles included
+// by a composite role. When called via GET, it retrieves the included roles.
+// When called via POST, it replaces them. When called via PATCH, it adds to them.
+// Assignments that would make a role include itself are rejected.
+func (s *Server) HandleRoleComposites(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	repo := s.roleRepository.(*repository.RoleRepository)
+	service := services.NewRoleService(repo).WithEvents(s.webhookDispatcher())
+	var response []byte
+
+	role, err := service.GetRoleById(vars["id"])
+	if err != nil {
+		s.HandleError(w, http.StatusNotFound, ADMIN_ROLE_COMPOSITES_ROUTE, err)
+		return
+	}
+
+	var result []*models.RoleDto
+	switch r.Method {
+	case http.MethodGet:
+		result = mapper.RolesToRoleDtos(role.Composites)
+
+	case http.MethodPost, http.MethodPatch:
+		var compositesRequest models.RoleCompositesRequest
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&compositesRequest)
+		if err != nil {
+			s.HandleError(w, http.StatusBadRequest, ADMIN_ROLE_COMPOSITES_ROUTE, err)
+			return
+		}
+
+		var composites []*models.Role
+		for _, compositeId := range compositesRequest.Roles {
+			composite, err := service.GetRoleById(compositeId)
+			if err != nil {
+				s.HandleError(w, http.StatusNotFound, ADMIN_ROLE_COMPOSITES_ROUTE, err)
+				return
+			}
+			composites = append(composites, composite)
+		}
+
+		before := mapper.RolesToRoleDtos(role.Composites)
+		var updated *models.RoleDto
+		if r.Method == http.MethodPost {
+			updated, err = service.AssignCompositesToRole(role, composites)
+		} else {
+			updated, err = service.AddCompositesToRole(role, composites)
+		}
+		if err != nil {
+			s.audit(r, models.AUDIT_ACTION_ROLE_COMPOSITES_UPDATE, role.ID.String(), err, before, nil)
+			s.HandleError(w, http.StatusConflict, ADMIN_ROLE_COMPOSITES_ROUTE, err)
+			return
+		}
+		result = updated.Composites
+		s.audit(r, models.AUDIT_ACTION_ROLE_COMPOSITES_UPDATE, role.ID.String(), nil, before, result)
+	}
+
+	response, err = json.Marshal(result)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, ADMIN_ROLE_COMPOSITES_ROUTE, err)
+		return
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// HandleRolePermissions handles the retrieval and assignment of the permissions
+// granted directly by a role. When called via GET, it retrieves the permissions.
+// When called via POST, it replaces them. When called via PATCH, it adds to them.
+func (s *Server) HandleRolePermissions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	repo := s.roleRepository.(*repository.RoleRepository)
+	service := services.NewRoleService(repo).WithEvents(s.webhookDispatcher())
+	var response []byte
+
+	role, err := service.GetRoleById(vars["id"])
+	if err != nil {
+		s.HandleError(w, http.StatusNotFound, ADMIN_ROLE_PERMISSIONS_ROUTE, err)
+		return
+	}
+
+	var result []*models.PermissionDto
+	switch r.Method {
+	case http.MethodGet:
+		result = mapper.PermissionsToPermissionDtos(role.Permissions)
+
+	case http.MethodPost, http.MethodPatch:
+		var permissionsRequest models.RolePermissionsRequest
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&permissionsRequest)
+		if err != nil {
+			s.HandleError(w, http.StatusBadRequest, ADMIN_ROLE_PERMISSIONS_ROUTE, err)
+			return
+		}
+
+		permissionRepo := s.permissionRepository.(*repository.PermissionRepository)
+		permissionService := services.NewPermissionService(permissionRepo)
+
+		var permissions []*models.Permission
+		for _, permissionId := range permissionsRequest.Permissions {
+			permission, err := permissionService.GetPermissionById(strconv.FormatUint(uint64(permissionId), 10))
+			if err != nil {
+				s.HandleError(w, http.StatusNotFound, ADMIN_ROLE_PERMISSIONS_ROUTE, err)
+				return
+			}
+			permissions = append(permissions, permission)
+		}
+
+		before := mapper.PermissionsToPermissionDtos(role.Permissions)
+		if r.Method == http.MethodPost {
+			result, err = service.AssignPermissionsToRole(role, permissions)
+		} else {
+			result, err = service.AddPermissionsToRole(role, permissions)
+		}
+		s.audit(r, models.AUDIT_ACTION_ROLE_PERMISSIONS_UPDATE, role.ID.String(), err, before, result)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_ROLE_PERMISSIONS_ROUTE, err)
+			return
+		}
+	}
+
+	response, err = json.Marshal(result)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, ADMIN_ROLE_PERMISSIONS_ROUTE, err)
+		return
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// HandleUserEffectivePermissions retrieves every permission a user holds in the
+// application given by the application_id query parameter, whether granted by
+// the roles assigned to the user or their groups, or inherited through
+// composite roles.
+func (s *Server) HandleUserEffectivePermissions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	repo := s.userRepository.(*repository.UserRepository)
+	service := services.NewUserService(repo)
+	var response []byte
+
+	applicationId := r.URL.Query().Get("application_id")
+	if applicationId == "" {
+		s.HandleError(w, http.StatusBadRequest, ADMIN_USER_EFFECTIVE_PERMISSIONS_ROUTE, errors.New("missing application_id query parameter"))
+		return
+	}
+
+	user, err := service.GetByUsername(vars["username"])
+	if user == nil && err == nil {
+		s.HandleError(w, http.StatusNotFound, ADMIN_USER_EFFECTIVE_PERMISSIONS_ROUTE, errors.New("user not found"))
+		return
+	}
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, ADMIN_USER_EFFECTIVE_PERMISSIONS_ROUTE, err)
+		return
+	}
+
+	roles, err := service.GetEffectiveRoles(user)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, ADMIN_USER_EFFECTIVE_PERMISSIONS_ROUTE, err)
+		return
+	}
+
+	roleRepo := s.roleRepository.(*repository.RoleRepository)
+	roleService := services.NewRoleService(roleRepo)
+
+	result, err := roleService.GetEffectivePermissions(roles, applicationId)
+	if err != nil {
+		s.HandleError(w, http.StatusBadRequest, ADMIN_USER_EFFECTIVE_PERMISSIONS_ROUTE, err)
+		return
+	}
+
+	response, err = json.Marshal(result)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, ADMIN_USER_EFFECTIVE_PERMISSIONS_ROUTE, err)
+		return
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// HandleGroup handles group creation and retrieval. When called via POST,
+// it creates a new group, nested under the group given by parent_id if any.
+// When called via GET, it retrieves all groups.
+func (s *Server) HandleGroup(w http.ResponseWriter, r *http.Request) {
+	repo := s.groupRepository.(*repository.GroupRepository)
+	service := services.NewGroupService(repo)
+	var response []byte
+
+	switch r.Method {
+	case http.MethodGet:
+		result, err := service.GetAll()
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_GROUP_ROUTE, err)
+			return
+		}
+		response, err = json.Marshal(result)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_GROUP_ROUTE, err)
+			return
+		}
+	case http.MethodPost:
+		var groupRequest models.GroupRequest
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&groupRequest)
+		if err != nil {
+			s.HandleError(w, http.StatusBadRequest, ADMIN_GROUP_ROUTE, err)
+			return
+		}
+		if groupRequest.Name == "" {
+			s.HandleError(w, http.StatusBadRequest, ADMIN_GROUP_ROUTE, errors.New("group name cannot be blank"))
+			return
+		}
+
+		var parent *models.Group
+		if groupRequest.ParentID != "" {
+			parent, err = service.GetGroupById(groupRequest.ParentID)
+			if err != nil {
+				s.HandleError(w, http.StatusNotFound, ADMIN_GROUP_ROUTE, err)
+				return
+			}
+		}
+
+		result, err := service.CreateGroup(&groupRequest, parent)
+		s.audit(r, models.AUDIT_ACTION_GROUP_CREATE, groupRequest.Name, err, nil, result)
+		if err != nil {
+			s.HandleError(w, http.StatusConflict, ADMIN_GROUP_ROUTE, err)
+			return
+		}
+		response, err = json.Marshal(result)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_GROUP_ROUTE, err)
+			return
+		}
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// HandleGroupDetails handles the retrieval, update and deletion of a group.
+// When called via PUT, it replaces the group's name and parent; a group cannot
+// be moved under itself or any of its descendants. When called via DELETE,
+// the group's subgroups are moved up to its parent.
+func (s *Server) HandleGroupDetails(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	repo := s.groupRepository.(*repository.GroupRepository)
+	service := services.NewGroupService(repo)
+	var response []byte
+
+	group, err := service.GetGroupById(vars["id"])
+	if err != nil {
+		s.HandleError(w, http.StatusNotFound, ADMIN_GROUP_DETAILS_ROUTE, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		response, err = json.Marshal(mapper.GroupToGroupDto(group))
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_GROUP_DETAILS_ROUTE, err)
+			return
+		}
+	case http.MethodPut:
+		var groupRequest models.GroupRequest
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&groupRequest)
+		if err != nil {
+			s.HandleError(w, http.StatusBadRequest, ADMIN_GROUP_DETAILS_ROUTE, err)
+			return
+		}
+		if groupRequest.Name == "" {
+			s.HandleError(w, http.StatusBadRequest, ADMIN_GROUP_DETAILS_ROUTE, errors.New("group name cannot be blank"))
+			return
+		}
+
+		var parent *models.Group
+		if groupRequest.ParentID != "" {
+			parent, err = service.GetGroupById(groupRequest.ParentID)
+			if err != nil {
+				s.HandleError(w, http.StatusNotFound, ADMIN_GROUP_DETAILS_ROUTE, err)
+				return
+			}
+		}
+
+		before := mapper.GroupToGroupDto(group)
+		result, err := service.UpdateGroup(group, &groupRequest, parent)
+		s.audit(r, models.AUDIT_ACTION_GROUP_UPDATE, group.ID.String(), err, before, result)
+		if err != nil {
+			s.HandleError(w, http.StatusConflict, ADMIN_GROUP_DETAILS_ROUTE, err)
+			return
+		}
+		response, err = json.Marshal(result)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_GROUP_DETAILS_ROUTE, err)
+			return
+		}
+	case http.MethodDelete:
+		err := service.DeleteGroup(group)
+		s.audit(r, models.AUDIT_ACTION_GROUP_DELETE, group.ID.String(), err, mapper.GroupToGroupDto(group), nil)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_GROUP_DETAILS_ROUTE, err)
+			return
+		}
+		status := s.getStatusCode(r.Method)
+		w.WriteHeader(status)
+		return
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// HandleGroupMembers handles group membership retrieval and assignment. When called
+// via GET, it retrieves the members of a group. When called via POST, it replaces them.
+// When called via PATCH, it adds users to the group.
+func (s *Server) HandleGroupMembers(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	repo := s.groupRepository.(*repository.GroupRepository)
+	service := services.NewGroupService(repo)
+	var response []byte
+
+	group, err := service.GetGroupById(vars["id"])
+	if err != nil {
+		s.HandleError(w, http.StatusNotFound, ADMIN_GROUP_MEMBERS_ROUTE, err)
+		return
+	}
+
+	var result []*models.UserDto
+	switch r.Method {
+	case http.MethodGet:
+		result = mapper.UsersToUserDtos(group.Members)
+
+	case http.MethodPost, http.MethodPatch:
+		var membersRequest models.GroupMembersRequest
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&membersRequest)
+		if err != nil {
+			s.HandleError(w, http.StatusBadRequest, ADMIN_GROUP_MEMBERS_ROUTE, err)
+			return
+		}
+
+		userRepo := s.userRepository.(*repository.UserRepository)
+		userService := services.NewUserService(userRepo)
+
+		var users []*models.User
+		for _, userId := range membersRequest.Users {
+			user, err := userService.GetById(userId)
+			if user == nil && err == nil {
+				s.HandleError(w, http.StatusNotFound, ADMIN_GROUP_MEMBERS_ROUTE, errors.New("user not found"))
+				return
+			}
+			if err != nil {
+				s.HandleError(w, http.StatusInternalServerError, ADMIN_GROUP_MEMBERS_ROUTE, err)
+				return
+			}
+			users = append(users, user)
+		}
+
+		before := mapper.UsersToUserDtos(group.Members)
+		if r.Method == http.MethodPost {
+			result, err = service.AssignMembersToGroup(group, users)
+		} else {
+			result, err = service.AddMembersToGroup(group, users)
+		}
+		s.audit(r, models.AUDIT_ACTION_GROUP_MEMBERS_UPDATE, group.ID.String(), err, before, result)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_GROUP_MEMBERS_ROUTE, err)
+			return
+		}
+	}
+
+	response, err = json.Marshal(result)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, ADMIN_GROUP_MEMBERS_ROUTE, err)
+		return
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// HandleGroupRoles handles group roles retrieval and assignment. When called via GET,
+// it retrieves the roles assigned to a group. When called via POST, it replaces them.
+// When called via PATCH, it adds roles to the group. Members of the group and of its
+// subgroups hold these roles.
+func (s *Server) HandleGroupRoles(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	repo := s.groupRepository.(*repository.GroupRepository)
+	service := services.NewGroupService(repo)
+	var response []byte
+
+	group, err := service.GetGroupById(vars["id"])
+	if err != nil {
+		s.HandleError(w, http.StatusNotFound, ADMIN_GROUP_ROLES_ROUTE, err)
+		return
+	}
+
+	var result []*models.RoleDto
+	switch r.Method {
+	case http.MethodGet:
+		result = mapper.RolesToRoleDtos(group.Roles)
+
+	case http.MethodPost, http.MethodPatch:
+		var rolesRequest models.GroupRolesRequest
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&rolesRequest)
+		if err != nil {
+			s.HandleError(w, http.StatusBadRequest, ADMIN_GROUP_ROLES_ROUTE, err)
+			return
+		}
+
+		roleRepo := s.roleRepository.(*repository.RoleRepository)
+		roleService := services.NewRoleService(roleRepo)
+
+		var roles []*models.Role
+		for _, roleId := range rolesRequest.Roles {
+			role, err := roleService.GetRoleById(roleId)
+			if err != nil {
+				s.HandleError(w, http.StatusNotFound, ADMIN_GROUP_ROLES_ROUTE, err)
+				return
+			}
+			roles = append(roles, role)
+		}
+
+		before := mapper.RolesToRoleDtos(group.Roles)
+		if r.Method == http.MethodPost {
+			result, err = service.AssignRolesToGroup(group, roles)
+		} else {
+			result, err = service.AddRolesToGroup(group, roles)
+		}
+		s.audit(r, models.AUDIT_ACTION_GROUP_ROLES_UPDATE, group.ID.String(), err, before, result)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_GROUP_ROLES_ROUTE, err)
+			return
+		}
+	}
+
+	response, err = json.Marshal(result)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, ADMIN_GROUP_ROLES_ROUTE, err)
+		return
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// HandleUserGroups retrieves the groups a user is a direct member of.
+func (s *Server) HandleUserGroups(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	repo := s.userRepository.(*repository.UserRepository)
+	service := services.NewUserService(repo)
+	var response []byte
+
+	user, err := service.GetByUsername(vars["username"])
+	if user == nil && err == nil {
+		s.HandleError(w, http.StatusNotFound, ADMIN_USER_GROUPS_ROUTE, errors.New("user not found"))
+		return
+	}
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, ADMIN_USER_GROUPS_ROUTE, err)
+		return
+	}
+
+	result, err := service.GetUserGroups(user)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, ADMIN_USER_GROUPS_ROUTE, err)
+		return
+	}
+	response, err = json.Marshal(result)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, ADMIN_USER_GROUPS_ROUTE, err)
+		return
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// HandlePolicy handles the creation and retrieval of attribute-based authorization
+// policies. When called via POST, it creates a new policy for an application.
+// When called via GET, it retrieves all policies.
+func (s *Server) HandlePolicy(w http.ResponseWriter, r *http.Request) {
+	repo := s.policyRepository.(*repository.PolicyRepository)
+	service := services.NewPolicyService(repo)
+	var response []byte
+
+	switch r.Method {
+	case http.MethodGet:
+		result, err := service.GetAll()
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_POLICY_ROUTE, err)
+			return
+		}
+		response, err = json.Marshal(result)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_POLICY_ROUTE, err)
+			return
+		}
+	case http.MethodPost:
+		var policyRequest models.PolicyRequest
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&policyRequest)
+		if err != nil {
+			s.HandleError(w, http.StatusBadRequest, ADMIN_POLICY_ROUTE, err)
+			return
+		}
+
+		appRepo := s.applicationRepository.(*repository.ApplicationRepository)
+		appService := services.NewApplicationService(appRepo)
+
+		app, err := appService.GetById(policyRequest.ApplicationId)
+		if err != nil {
+			s.HandleError(w, http.StatusNotFound, ADMIN_POLICY_ROUTE, err)
+			return
+		}
+
+		result, err := service.CreatePolicy(&policyRequest, app)
+		s.audit(r, models.AUDIT_ACTION_POLICY_CREATE, policyRequest.Name, err, nil, result)
+		if err != nil {
+			s.HandleError(w, http.StatusBadRequest, ADMIN_POLICY_ROUTE, err)
+			return
+		}
+		response, err = json.Marshal(result)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_POLICY_ROUTE, err)
+			return
+		}
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// HandlePolicyDetails handles the retrieval and deletion of a policy.
+func (s *Server) HandlePolicyDetails(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	repo := s.policyRepository.(*repository.PolicyRepository)
+	service := services.NewPolicyService(repo)
+	var response []byte
+
+	policy, err := service.GetPolicyById(vars["id"])
+	if err != nil {
+		s.HandleError(w, http.StatusNotFound, ADMIN_POLICY_DETAILS_ROUTE, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		response, err = json.Marshal(mapper.PolicyToPolicyDto(policy))
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_POLICY_DETAILS_ROUTE, err)
+			return
+		}
+	case http.MethodDelete:
+		err := service.DeletePolicy(policy)
+		s.audit(r, models.AUDIT_ACTION_POLICY_DELETE, policy.ID.String(), err, mapper.PolicyToPolicyDto(policy), nil)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_POLICY_DETAILS_ROUTE, err)
+			return
+		}
+		status := s.getStatusCode(r.Method)
+		w.WriteHeader(status)
+		return
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// HandleClientExchangeAudiences handles the retrieval and assignment of the applications
+// a client may request tokens for through token exchange. When called via GET, it retrieves
+// the applications. When called via POST, it replaces them. When called via PATCH, it adds to them.
+func (s *Server) HandleClientExchangeAudiences(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	repo := s.clientRepository.(*repository.ClientRepository)
+	service := services.NewClientService(repo)
+	var response []byte
+
+	client, err := service.GetClientById(vars["id"])
+	if err != nil {
+		s.HandleError(w, http.StatusNotFound, ADMIN_CLIENT_EXCHANGE_AUDIENCES_ROUTE, err)
+		return
+	}
+
+	var result []*models.ApplicationDto
+	switch r.Method {
+	case http.MethodGet:
+		result = mapper.ApplicationsToApplicationDtos(client.ExchangeAudiences)
+
+	case http.MethodPost, http.MethodPatch:
+		var audiencesRequest models.ClientAudiencesRequest
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&audiencesRequest)
+		if err != nil {
+			s.HandleError(w, http.StatusBadRequest, ADMIN_CLIENT_EXCHANGE_AUDIENCES_ROUTE, err)
+			return
+		}
+
+		appRepo := s.applicationRepository.(*repository.ApplicationRepository)
+		appService := services.NewApplicationService(appRepo)
+
+		var apps []*models.Application
+		for _, appId := range audiencesRequest.Applications {
+			app, err := appService.GetApplicationById(appId)
+			if err != nil {
+				s.HandleError(w, http.StatusNotFound, ADMIN_CLIENT_EXCHANGE_AUDIENCES_ROUTE, err)
+				return
+			}
+			apps = append(apps, app)
+		}
+
+		before := mapper.ApplicationsToApplicationDtos(client.ExchangeAudiences)
+		if r.Method == http.MethodPost {
+			result, err = service.AssignExchangeAudiences(client, apps)
+		} else {
+			result, err = service.AddExchangeAudiences(client, apps)
+		}
+		s.audit(r, models.AUDIT_ACTION_CLIENT_EXCHANGE_AUDIENCES_UPDATE, client.ID.String(), err, before, result)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_CLIENT_EXCHANGE_AUDIENCES_ROUTE, err)
+			return
+		}
+	}
+
+	response, err = json.Marshal(result)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, ADMIN_CLIENT_EXCHANGE_AUDIENCES_ROUTE, err)
+		return
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// HandleClientSecrets handles the retrieval and generation of a client's secrets.
+// When called via GET, it retrieves the secrets, without their values. When called
+// via POST, it generates a new secret, whose value is only returned in this response.
+// The client's other secrets remain valid during the requested grace period.
+func (s *Server) HandleClientSecrets(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	repo := s.clientRepository.(*repository.ClientRepository)
+	service := services.NewClientService(repo)
+	secretService := s.clientSecretService()
+	var response []byte
+
+	client, err := service.GetClientById(vars["id"])
+	if err != nil {
+		s.HandleError(w, http.StatusNotFound, ADMIN_CLIENT_SECRETS_ROUTE, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		result, err := secretService.GetSecrets(client)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_CLIENT_SECRETS_ROUTE, err)
+			return
+		}
+		response, err = json.Marshal(result)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_CLIENT_SECRETS_ROUTE, err)
+			return
+		}
+	case http.MethodPost:
+		var secretRequest models.ClientSecretRequest
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&secretRequest)
+		if err != nil && !errors.Is(err, io.EOF) {
+			s.HandleError(w, http.StatusBadRequest, ADMIN_CLIENT_SECRETS_ROUTE, err)
+			return
+		}
+
+		gracePeriod := CLIENT_SECRET_GRACE_PERIOD
+		if secretRequest.GracePeriod != nil {
+			gracePeriod = time.Duration(*secretRequest.GracePeriod) * time.Second
+		}
+		lifetime := time.Duration(secretRequest.ExpiresIn) * time.Second
+		result, err := secretService.CreateSecret(client, lifetime, gracePeriod)
+		if err != nil {
+			s.audit(r, models.AUDIT_ACTION_CLIENT_SECRET_CREATE, client.ID.String(), err, nil, nil)
+			s.HandleError(w, http.StatusBadRequest, ADMIN_CLIENT_SECRETS_ROUTE, err)
+			return
+		}
+		// The value of the secret is left out of the audit log.
+		created := *result
+		created.Secret = ""
+		s.audit(r, models.AUDIT_ACTION_CLIENT_SECRET_CREATE, client.ID.String(), nil, nil, created)
+		response, err = json.Marshal(result)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_CLIENT_SECRETS_ROUTE, err)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// HandleClientSecretDetails revokes one of a client's secrets before it expires.
+func (s *Server) HandleClientSecretDetails(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	repo := s.clientRepository.(*repository.ClientRepository)
+	service := services.NewClientService(repo)
+
+	client, err := service.GetClientById(vars["id"])
+	if err != nil {
+		s.HandleError(w, http.StatusNotFound, ADMIN_CLIENT_SECRET_DETAILS_ROUTE, err)
+		return
+	}
+	result, err := s.clientSecretService().RevokeSecret(client, vars["secretId"])
+	s.audit(r, models.AUDIT_ACTION_CLIENT_SECRET_REVOKE, client.ID.String(), err, nil, result)
+	if err != nil {
+
+		s.HandleError(w, http.StatusNotFound, ADMIN_CLIENT_SECRET_DETAILS_ROUTE, err)
+		return
+	}
+
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"auth-server/models"
+	"auth-server/repository"
+	"auth-server/services"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HandleAudit lists the audit events of the realm, most recent first. Events
+// can be filtered with the actor, action, target, outcome and request_id
+// query parameters, and by time with the since and until parameters, as
+// RFC 3339 timestamps. Pages are selected with the offset and limit
+// parameters.
+func (s *Server) HandleAudit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := &models.AuditFilter{
+		Actor:     query.Get("actor"),
+		Action:    query.Get("action"),
+		Target:    query.Get("target"),
+		Outcome:   query.Get("outcome"),
+		RequestID: query.Get("request_id"),
+	}
+	var err error
+	if since := query.Get("since"); since != "" {
+		filter.Since, err = time.Parse(time.RFC3339, since)
+		if err != nil {
+			s.HandleError(w, http.StatusBadRequest, ADMIN_AUDIT_ROUTE, fmt.Errorf("invalid since: %w", err))
+			return
+		}
+	}
+	if until := query.Get("until"); until != "" {
+		filter.Until, err = time.Parse(time.RFC3339, until)
+		if err != nil {
+			s.HandleError(w, http.StatusBadRequest, ADMIN_AUDIT_ROUTE, fmt.Errorf("invalid until: %w", err))
+			return
+		}
+	}
+	offset, limit, err := pagination(r, AUDIT_DEFAULT_PAGE_SIZE, AUDIT_MAX_PAGE_SIZE)
+	if err != nil {
+		s.HandleError(w, http.StatusBadRequest, ADMIN_AUDIT_ROUTE, err)
+		return
+	}
+
+	result, err := s.auditService().Search(filter, offset, limit)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, ADMIN_AUDIT_ROUTE, err)
+		return
+	}
+	response, err := json.Marshal(result)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, ADMIN_AUDIT_ROUTE, err)
+		return
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// HandleAuditVerification checks the hash chain of the audit events of the
+// realm, reporting the first event that breaks it, if any.
+func (s *Server) HandleAuditVerification(w http.ResponseWriter, r *http.Request) {
+	result, err := s.auditService().Verify()
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, ADMIN_AUDIT_VERIFY_ROUTE, err)
+		return
+	}
+	response, err := json.Marshal(result)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, ADMIN_AUDIT_VERIFY_ROUTE, err)
+		return
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// pagination reads the offset and limit query parameters, defaulting to the
+// first defaultSize items, and capping the limit at maxSize.
+func pagination(r *http.Request, defaultSize int, maxSize int) (int, int, error) {
+	offset, limit := 0, defaultSize
+	var err error
+	if value := r.URL.Query().Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("offset must be a non-negative integer")
+		}
+	}
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return 0, 0, errors.New("limit must be a positive integer")
+		}
+	}
+	if limit > maxSize {
+		limit = maxSize
+	}
+	return offset, limit, nil
+}
+
+// audit records an event performed by the actor authenticated with the
+// request, on the target. The event succeeded unless cause is not nil. The
+// state of the target before and after the event is recorded as JSON, unless
+// it is nil.
+func (s *Server) audit(r *http.Request, action string, target string, cause error, before interface{}, after interface{}) {
+	actor := ""
+	if payload := tokenPayload(r); payload != nil {
+		actor = payload.Sub
+	}
+	s.auditAs(r, actor, action, target, cause, before, after)
+}
+
+// auditAs records an event performed by the actor, for events performed by
+// parties authenticating along with the request itself, such as users
+// logging in or clients requesting tokens. Failing to record an event is
+// logged, but does not fail the request.
+func (s *Server) auditAs(r *http.Request, actor string, action string, target string, cause error, before interface{}, after interface{}) {
+	event := &models.AuditEvent{
+		Actor:     actor,
+		Action:    action,
+		Target:    target,
+		IPAddress: clientIP(r),
+		UserAgent: r.UserAgent(),
+		Outcome:   models.AUDIT_OUTCOME_SUCCESS,
+		RequestID: requestID(r),
+		Before:    auditState(before),
+		After:     auditState(after),
+	}
+	if cause != nil {
+		event.Outcome = models.AUDIT_OUTCOME_FAILURE
+		event.Reason = cause.Error()
+	}
+	err := s.auditService().Record(event)
+	if err != nil {
+		s.requestLogger(r).WithError(err).Error("recording audit event")
+	}
+}
+
+// auditState returns the JSON encoding of the state of an audit target, or a
+// blank string if there is none.
+func auditState(state interface{}) string {
+	if state == nil {
+		return ""
+	}
+	value, err := json.Marshal(state)
+	if err != nil || string(value) == "null" {
+		return ""
+	}
+	return string(value)
+}
+
+func (s *Server) auditService() *services.AuditService {
+	return services.NewAuditService(s.auditEventRepository.(*repository.AuditEventRepository), s.config.AuditHashChain)
+}
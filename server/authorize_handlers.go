@@ -0,0 +1,431 @@
+package server
+
+import (
+	"auth-server/logger"
+	"auth-server/mapper"
+	"auth-server/models"
+	"auth-server/repository"
+	"auth-server/services"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HandleAuthorize is the authorization endpoint of the authorization code
+// grant described in RFC 6749, section 4.1. The user is identified by their
+// login session. When called via GET, the user is redirected back to the
+// client with an authorization code, unless they must first consent to the
+// client's request, in which case the consent prompt is returned. When called
+// via POST, it records the user's answer to the prompt and redirects them back
+// to the client. The answer must be sent as JSON, along with the challenge
+// returned with the prompt, so that it cannot be forged by another site.
+//
+// Users must log in again when they have no session, when the request carries
+// prompt=login, or when they logged in longer ago than its max_age; the login
+// page sends the request again without prompt=login once they did. Users are
+// asked for consent when a third-party client requests scopes they have not
+// consented to yet, or when the request carries prompt=consent. Requests with
+// prompt=none fail instead of prompting the user.
+func (s *Server) HandleAuthorize(w http.ResponseWriter, r *http.Request) {
+	var authorizeRequest models.AuthorizeRequest
+	var decisionRequest *models.AuthorizeDecisionRequest
+	if r.Method == http.MethodPost {
+		if !isJSONRequest(r) {
+			s.HandleOAuthError(w, AUTHORIZE_ROUTE, newOAuthError(http.StatusUnsupportedMediaType, "invalid_request", "the decision must be sent as "+APPLICATION_JSON))
+			return
+		}
+		decisionRequest = &models.AuthorizeDecisionRequest{}
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(decisionRequest)
+		if err != nil {
+			s.HandleOAuthError(w, AUTHORIZE_ROUTE, newOAuthError(http.StatusBadRequest, "invalid_request", err.Error()))
+			return
+		}
+		authorizeRequest = decisionRequest.AuthorizeRequest
+	} else {
+		authorizeRequest = authorizeRequestFromQuery(r.URL.Query())
+	}
+
+	// Errors are only reported to the client once its redirect URI is known
+	// to be valid, and to the user otherwise.
+	client, redirectURI, err := s.authorizeRequestClient(&authorizeRequest)
+	var oauthErr *oauthError
+	if errors.As(err, &oauthErr) {
+		s.HandleOAuthError(w, AUTHORIZE_ROUTE, oauthErr)
+		return
+	}
+	if err != nil {
+		s.HandleError(w, errorStatus(err), AUTHORIZE_ROUTE, err)
+		return
+	}
+	app, err := s.checkAuthorizeRequest(client, &authorizeRequest)
+	if errors.As(err, &oauthErr) {
+		s.redirectAuthorizeError(w, r, redirectURI, &authorizeRequest, oauthErr)
+		return
+	}
+	if err != nil {
+		s.HandleError(w, errorStatus(err), AUTHORIZE_ROUTE, err)
+		return
+	}
+
+	session, err := s.currentSession(r)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, AUTHORIZE_ROUTE, err)
+		return
+	}
+	if requiresLogin(session, &authorizeRequest) {
+		if hasPrompt(authorizeRequest.Prompt, PROMPT_NONE) {
+			s.redirectAuthorizeError(w, r, redirectURI, &authorizeRequest, newOAuthError(http.StatusFound, "login_required", "the user must log in"))
+			return
+		}
+		s.HandleOAuthError(w, AUTHORIZE_ROUTE, newOAuthError(http.StatusUnauthorized, "login_required", "the user must log in"))
+		return
+	}
+	user := session.User
+	if !user.Enabled || !user.AccountNonLocked || !user.AccountNonExpired {
+		s.redirectAuthorizeError(w, r, redirectURI, &authorizeRequest, newOAuthError(http.StatusFound, "access_denied", "user account is not active"))
+		return
+	}
+
+	consentService := s.consentService()
+	scopes := strings.Fields(authorizeRequest.Scope)
+	if decisionRequest != nil {
+		err = s.consentChallengeService().Redeem(decisionRequest.Challenge, session, client, &authorizeRequest)
+		if errors.Is(err, services.ErrInvalidConsentChallenge) {
+			s.HandleOAuthError(w, AUTHORIZE_ROUTE, newOAuthError(http.StatusForbidden, "invalid_request", err.Error()))
+			return
+		}
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, AUTHORIZE_ROUTE, err)
+			return
+		}
+		if !decisionRequest.Approve {
+			s.redirectAuthorizeError(w, r, redirectURI, &authorizeRequest, newOAuthError(http.StatusFound, "access_denied", "the user denied the request"))
+			return
+		}
+		if !client.FirstParty {
+			err = consentService.Grant(user, client, scopes)
+			if err != nil {
+				s.HandleError(w, http.StatusInternalServerError, AUTHORIZE_ROUTE, err)
+				return
+			}
+		}
+	} else {
+		required, newScopes, err := consentService.ConsentPrompt(user, client, scopes, hasPrompt(authorizeRequest.Prompt, PROMPT_CONSENT))
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, AUTHORIZE_ROUTE, err)
+			return
+		}
+		if required {
+			if hasPrompt(authorizeRequest.Prompt, PROMPT_NONE) {
+				s.redirectAuthorizeError(w, r, redirectURI, &authorizeRequest, newOAuthError(http.StatusFound, "consent_required", "the user must consent to the request"))
+				return
+			}
+			challenge, err := s.consentChallengeService().Issue(session, client, &authorizeRequest)
+			if err != nil {
+				s.HandleError(w, http.StatusInternalServerError, AUTHORIZE_ROUTE, err)
+				return
+			}
+			s.writeConsentPrompt(w, client, app, scopes, newScopes, challenge)
+			return
+		}
+	}
+
+	code, err := s.authorizationCodeService().CreateCode(client, app, session, &authorizeRequest, AUTHORIZATION_CODE_LIFETIME)
+	if err == nil {
+		err = s.sessionService().AddClient(session, client)
+	}
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, AUTHORIZE_ROUTE, err)
+		return
+	}
+	status := redirectStatus(r.Method)
+	http.Redirect(w, r, authorizationResponseURI(redirectURI, &authorizeRequest, url.Values{"code": {code}}), status)
+}
+
+// authorizeRequestFromQuery reads an authorization request from the query
+// parameters of the request URI. An invalid max_age is read as a negative one.
+func authorizeRequestFromQuery(query url.Values) models.AuthorizeRequest {
+	var maxAge *int
+	if value := query.Get("max_age"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil {
+			seconds = -1
+		}
+		maxAge = &seconds
+	}
+	return models.AuthorizeRequest{
+		ResponseType:        query.Get("response_type"),
+		ClientId:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		Scope:               query.Get("scope"),
+		State:               query.Get("state"),
+		Aud:                 query.Get("aud"),
+		Prompt:              query.Get("prompt"),
+		MaxAge:              maxAge,
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+	}
+}
+
+// authorizeRequestClient returns the client making the authorization request,
+// along with the redirect URI the user is sent back to. The redirect URI must
+// be one the client registered, and may only be left out of the request when
+// the client registered a single one.
+func (s *Server) authorizeRequestClient(authorizeRequest *models.AuthorizeRequest) (*models.Client, string, error) {
+	if authorizeRequest.ClientId == "" {
+		return nil, "", newOAuthError(http.StatusBadRequest, "invalid_request", "missing client_id")
+	}
+	client, err := s.clientRepository.FindById(context.Background(), authorizeRequest.ClientId)
+	if err != nil {
+		return nil, "", newOAuthError(http.StatusBadRequest, "invalid_request", "unknown client")
+	}
+	if client.Disabled {
+		return nil, "", newOAuthError(http.StatusBadRequest, "invalid_request", "the client is disabled")
+	}
+	redirectURI := authorizeRequest.RedirectURI
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if redirectURI == "" || !client.RedirectURIs.Contains(redirectURI) {
+		return nil, "", newOAuthError(http.StatusBadRequest, "invalid_request", "invalid redirect_uri")
+	}
+	return client, redirectURI, nil
+}
+
+// checkAuthorizeRequest checks that the client may make the authorization
+// request, and returns the application the requested token is for. Public
+// clients must protect their requests with PKCE, as described in RFC 7636.
+func (s *Server) checkAuthorizeRequest(client *models.Client, authorizeRequest *models.AuthorizeRequest) (*models.Application, error) {
+	if authorizeRequest.ResponseType != models.RESPONSE_TYPE_CODE {
+		return nil, newOAuthError(http.StatusFound, "unsupported_response_type", "")
+	}
+	if !client.ResponseTypes.Contains(models.RESPONSE_TYPE_CODE) || !client.GrantTypes.Contains(models.GRANT_TYPE_AUTHORIZATION_CODE) {
+		return nil, newOAuthError(http.StatusFound, "unauthorized_client", "the client may not use the authorization code grant")
+	}
+	if hasPrompt(authorizeRequest.Prompt, PROMPT_NONE) && len(strings.Fields(authorizeRequest.Prompt)) > 1 {
+		return nil, newOAuthError(http.StatusFound, "invalid_request", "prompt=none cannot be combined with other values")
+	}
+
+	if authorizeRequest.MaxAge != nil && *authorizeRequest.MaxAge < 0 {
+		return nil, newOAuthError(http.StatusFound, "invalid_request", "invalid max_age")
+	}
+
+	if authorizeRequest.CodeChallenge == "" {
+		if authorizeRequest.CodeChallengeMethod != "" {
+			return nil, newOAuthError(http.StatusFound, "invalid_request", "missing code_challenge")
+		}
+		if client.IsPublic() {
+			return nil, newOAuthError(http.StatusFound, "invalid_request", "public clients must send a code_challenge")
+		}
+	} else {
+		if authorizeRequest.CodeChallengeMethod == "" {
+			authorizeRequest.CodeChallengeMethod = models.CODE_CHALLENGE_METHOD_PLAIN
+		}
+		if authorizeRequest.CodeChallengeMethod != models.CODE_CHALLENGE_METHOD_PLAIN &&
+			authorizeRequest.CodeChallengeMethod != models.CODE_CHALLENGE_METHOD_S256 {
+			return nil, newOAuthError(http.StatusFound, "invalid_request", "unsupported code_challenge_method")
+		}
+		if len(authorizeRequest.CodeChallenge) < 43 || len(authorizeRequest.CodeChallenge) > 128 {
+			return nil, newOAuthError(http.StatusFound, "invalid_request", "invalid code_challenge")
+		}
+	}
+
+	if authorizeRequest.Aud == "" {
+		return nil, newOAuthError(http.StatusFound, "invalid_request", "missing aud")
+	}
+	app, err := s.applicationRepository.FindById(context.Background(), authorizeRequest.Aud)
+	if err != nil {
+		return nil, newOAuthError(http.StatusFound, "invalid_request", "unknown aud")
+	}
+	return app, nil
+}
+
+// requiresLogin returns true if the user must log in before authorizing the
+// request, because they have no session, the request asks them to log in
+// again, or they logged in too long ago.
+func requiresLogin(session *models.Session, authorizeRequest *models.AuthorizeRequest) bool {
+	if session == nil || hasPrompt(authorizeRequest.Prompt, PROMPT_LOGIN) {
+		return true
+	}
+	if authorizeRequest.MaxAge != nil {
+		return time.Since(session.AuthTime) > time.Duration(*authorizeRequest.MaxAge)*time.Second
+	}
+	return false
+}
+
+// redirectAuthorizeError sends the user back to the client with the error, as
+// described in RFC 6749, section 4.1.2.1.
+func (s *Server) redirectAuthorizeError(w http.ResponseWriter, r *http.Request, redirectURI string, authorizeRequest *models.AuthorizeRequest, cause *oauthError) {
+	params := url.Values{"error": {cause.code}}
+	if cause.description != "" {
+		params.Set("error_description", cause.description)
+	}
+	status := redirectStatus(r.Method)
+	http.Redirect(w, r, authorizationResponseURI(redirectURI, authorizeRequest, params), status)
+	logger.RecordError(w, cause)
+}
+
+// authorizationResponseURI adds the parameters of the authorization response,
+// and the state of the request if any, to the query of the redirect URI.
+func authorizationResponseURI(redirectURI string, authorizeRequest *models.AuthorizeRequest, params url.Values) string {
+	location, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+	query := location.Query()
+	for name, values := range params {
+		query[name] = values
+	}
+	if authorizeRequest.State != "" {
+		query.Set("state", authorizeRequest.State)
+	}
+	location.RawQuery = query.Encode()
+	return location.String()
+}
+
+// redirectStatus returns the status redirecting the user after a request made
+// with the method: responses to POST requests must not be replayed as POST.
+func redirectStatus(method string) int {
+	if method == http.MethodPost {
+		return http.StatusSeeOther
+	}
+	return http.StatusFound
+}
+
+// hasPrompt returns true if the space-separated prompt parameter holds the value.
+func hasPrompt(prompt string, value string) bool {
+	for _, p := range strings.Fields(prompt) {
+		if p == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) writeConsentPrompt(w http.ResponseWriter, client *models.Client, app *models.Application, scopes []string, newScopes []string, challenge string) {
+	prompt := models.ConsentPromptDto{
+		Client:      mapper.ClientToClientDto(client),
+		Application: mapper.ApplicationToApplicationDto(app),
+		Scopes:      scopes,
+		NewScopes:   newScopes,
+		Challenge:   challenge,
+	}
+	response, err := json.Marshal(prompt)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, AUTHORIZE_ROUTE, err)
+		return
+	}
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// authorizationCodeGrant redeems an authorization code issued at the
+// authorization endpoint, and builds the payload of a token issued on behalf
+// of the user who authorized the request. Clients allowed to use the refresh
+// token grant are issued a refresh token along with it.
+func (s *Server) authorizationCodeGrant(client *models.Client, tokenRequest *models.TokenRequest) (*models.Payload, string, error) {
+	if tokenRequest.Code == "" {
+		return nil, "", newOAuthError(http.StatusBadRequest, "invalid_request", "missing code")
+	}
+	authorizationCode, err := s.authorizationCodeService().Redeem(tokenRequest.Code, client.ID.String(), tokenRequest.RedirectURI, tokenRequest.CodeVerifier)
+	if errors.Is(err, services.ErrInvalidAuthorizationCode) {
+		return nil, "", newOAuthError(http.StatusBadRequest, "invalid_grant", err.Error())
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	user, err := s.activeUser(authorizationCode.UserID.String())
+	if err != nil {
+		return nil, "", err
+	}
+	payload := models.NewPayload(user.ID.String(), authorizationCode.ApplicationID.String(), client.AccessTokenTTL(), authorizationCode.Scope)
+	payload.SetClaim("client_id", client.ID.String())
+	payload.SetClaim("sid", authorizationCode.SessionID.String())
+	payload.SetClaim("auth_time", authorizationCode.AuthTime.Unix())
+	if err := s.addUserClaims(payload, user); err != nil {
+		return nil, "", err
+	}
+	if !client.GrantTypes.Contains(models.GRANT_TYPE_REFRESH_TOKEN) {
+		return payload, "", nil
+	}
+	refreshToken, err := s.refreshTokenService().IssueToken(client, authorizationCode.ApplicationID, user.ID, authorizationCode.Scope)
+	if err != nil {
+		return nil, "", err
+	}
+	return payload, refreshToken, nil
+}
+
+// refreshTokenGrant redeems a refresh token, as described in RFC 6749,
+// section 6, and builds the payload of a new token with the same or a
+// narrower scope. The refresh token is replaced by a new one.
+func (s *Server) refreshTokenGrant(client *models.Client, tokenRequest *models.TokenRequest) (*models.Payload, string, error) {
+	if tokenRequest.RefreshToken == "" {
+		return nil, "", newOAuthError(http.StatusBadRequest, "invalid_request", "missing refresh_token")
+	}
+	used, refreshToken, err := s.refreshTokenService().Rotate(tokenRequest.RefreshToken, client, tokenRequest.Scope)
+	switch {
+	case errors.Is(err, services.ErrInvalidRefreshToken):
+		return nil, "", newOAuthError(http.StatusBadRequest, "invalid_grant", err.Error())
+	case errors.Is(err, services.ErrInvalidScope):
+		return nil, "", newOAuthError(http.StatusBadRequest, "invalid_scope", err.Error())
+	case err != nil:
+		return nil, "", err
+	}
+
+	user, err := s.activeUser(used.UserID.String())
+	if err != nil {
+		return nil, "", err
+	}
+	scope := tokenRequest.Scope
+	if scope == "" {
+		scope = used.Scope
+	}
+	payload := models.NewPayload(user.ID.String(), used.ApplicationID.String(), client.AccessTokenTTL(), scope)
+	payload.SetClaim("client_id", client.ID.String())
+	if err := s.addUserClaims(payload, user); err != nil {
+		return nil, "", err
+	}
+	return payload, refreshToken, nil
+}
+
+// activeUser returns the user tokens are issued on behalf of, provided their
+// account is still active.
+func (s *Server) activeUser(userId string) (*models.User, error) {
+	repo := s.userRepository.(*repository.UserRepository)
+	user, err := repo.FindById(context.Background(), userId)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !user.Enabled || !user.AccountNonLocked || !user.AccountNonExpired {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_grant", "user account is not active")
+	}
+	return user, nil
+}
+
+func (s *Server) authorizationCodeService() *services.AuthorizationCodeService {
+	repo := s.authorizationCodeRepository.(*repository.AuthorizationCodeRepository)
+	return services.NewAuthorizationCodeService(repo)
+}
+
+func (s *Server) refreshTokenService() *services.RefreshTokenService {
+	repo := s.refreshTokenRepository.(*repository.RefreshTokenRepository)
+	return services.NewRefreshTokenService(repo)
+}
+
+func (s *Server) consentService() *services.ConsentService {
+	repo := s.consentRepository.(*repository.ConsentRepository)
+	return services.NewConsentService(repo)
+}
+
+func (s *Server) consentChallengeService() *services.ConsentChallengeService {
+	return services.NewConsentChallengeService(s.consentReplayCache, s.config.Secret)
+}
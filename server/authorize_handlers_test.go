@@ -0,0 +1,103 @@
+package server
+
+import (
+	"auth-server/models"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleAuthorizeDecisionRequiresJSON(t *testing.T) {
+	s := newTestServer(t)
+	s.clientRepository = fakeRepository[models.Client]{}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		accepted    bool
+	}{
+		{"json", APPLICATION_JSON, `{"client_id":"client","approve":true}`, true},
+		{"json with charset", APPLICATION_JSON + "; charset=utf-8", `{"client_id":"client","approve":true}`, true},
+		{"missing content type", "", `{"client_id":"client","approve":true}`, false},
+		{"form", "application/x-www-form-urlencoded", "client_id=client&approve=true", false},
+		{"multipart form", "multipart/form-data; boundary=boundary", "--boundary--", false},
+		{"plain text", "text/plain", `{"client_id":"client","approve":true}`, false},
+		{"malformed content type", "application/json;;", `{"client_id":"client","approve":true}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/authorize", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set(CONTENT_TYPE, tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			s.HandleAuthorize(w, r)
+			if tt.accepted && w.Code == http.StatusUnsupportedMediaType {
+				t.Fatalf("status = %d, want the decision to be accepted", w.Code)
+			}
+			if !tt.accepted && w.Code != http.StatusUnsupportedMediaType {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusUnsupportedMediaType)
+			}
+		})
+	}
+}
+
+func TestRequiresLogin(t *testing.T) {
+	seconds := func(n int) *int { return &n }
+	session := &models.Session{AuthTime: time.Now().Add(-10 * time.Minute)}
+
+	tests := []struct {
+		name    string
+		session *models.Session
+		prompt  string
+		maxAge  *int
+		want    bool
+	}{
+		{"no session", nil, "", nil, true},
+		{"session", session, "", nil, false},
+		{"prompt=login", session, PROMPT_LOGIN, nil, true},
+		{"prompt=login among other prompts", session, PROMPT_CONSENT + " " + PROMPT_LOGIN, nil, true},
+		{"prompt=consent", session, PROMPT_CONSENT, nil, false},
+		{"logged in within max_age", session, "", seconds(3600), false},
+		{"logged in before max_age", session, "", seconds(300), true},
+		{"max_age=0", session, "", seconds(0), true},
+		{"prompt=login within max_age", session, PROMPT_LOGIN, seconds(3600), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := requiresLogin(tt.session, &models.AuthorizeRequest{Prompt: tt.prompt, MaxAge: tt.maxAge})
+			if got != tt.want {
+				t.Errorf("requiresLogin = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizeRequestFromQueryMaxAge(t *testing.T) {
+	seconds := func(n int) *int { return &n }
+	tests := []struct {
+		value string
+		want  *int
+	}{
+		{"", nil},
+		{"0", seconds(0)},
+		{"600", seconds(600)},
+		{"ten", seconds(-1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			query := url.Values{}
+			if tt.value != "" {
+				query.Set("max_age", tt.value)
+			}
+			got := authorizeRequestFromQuery(query).MaxAge
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("max_age = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
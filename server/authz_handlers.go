@@ -0,0 +1,116 @@
+package server
+
+import (
+	"auth-server/models"
+	"auth-server/repository"
+	"auth-server/services"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// HandleDecide evaluates whether a subject may perform an action on a resource,
+// so resource servers don't have to interpret scopes and roles themselves.
+// The subject is given either as an access token, whose audience is the
+// application the decision is made for, or as a user id along with an
+// application id. The response holds the decision and the rule it was based on.
+func (s *Server) HandleDecide(w http.ResponseWriter, r *http.Request) {
+	var authzRequest models.AuthorizationRequest
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&authzRequest)
+	if err != nil {
+		s.HandleError(w, http.StatusBadRequest, AUTHZ_DECIDE_ROUTE, err)
+		return
+	}
+	if authzRequest.Resource == "" || authzRequest.Action == "" {
+		s.HandleError(w, http.StatusBadRequest, AUTHZ_DECIDE_ROUTE, errors.New("resource and action are required"))
+		return
+	}
+
+	subject, err := s.resolveAuthorizationSubject(&authzRequest)
+	if err != nil {
+		s.HandleError(w, errorStatus(err), AUTHZ_DECIDE_ROUTE, err)
+		return
+	}
+
+	repo := s.policyRepository.(*repository.PolicyRepository)
+	service := services.NewPolicyService(repo)
+
+	result, err := service.Decide(subject, authzRequest.Resource, authzRequest.Action, authzRequest.Context)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, AUTHZ_DECIDE_ROUTE, err)
+		return
+	}
+	response, err := json.Marshal(result)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, AUTHZ_DECIDE_ROUTE, err)
+		return
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// resolveAuthorizationSubject identifies the subject of an authorization
+// request and loads the roles and permissions it holds in the application
+// the decision is made for. Users whose account is not active are marked as
+// inactive, without their roles and permissions, so that they are denied.
+func (s *Server) resolveAuthorizationSubject(authzRequest *models.AuthorizationRequest) (*models.AuthorizationSubject, error) {
+	subjectRequest := authzRequest.Subject
+	if (subjectRequest.Token == "") == (subjectRequest.UserId == "") {
+		return nil, newStatusError(http.StatusBadRequest, errors.New("exactly one of subject token or user_id is required"))
+	}
+
+	subject := &models.AuthorizationSubject{
+		ID:            subjectRequest.UserId,
+		ApplicationID: authzRequest.ApplicationId,
+		Roles:         make([]string, 0),
+		Permissions:   make([]string, 0),
+	}
+	if subjectRequest.Token != "" {
+		payload, err := s.ValidateToken(subjectRequest.Token)
+		if err != nil {
+			return nil, newStatusError(http.StatusUnauthorized, err)
+		}
+		if subject.ApplicationID != "" && subject.ApplicationID != payload.Aud {
+			return nil, newStatusError(http.StatusBadRequest, errors.New("application_id does not match the token audience"))
+		}
+		subject.ID = payload.Sub
+		subject.ApplicationID = payload.Aud
+		subject.Scope = payload.Scope
+	}
+	if subject.ApplicationID == "" {
+		return nil, newStatusError(http.StatusBadRequest, errors.New("missing application_id"))
+	}
+
+	user, err := s.userRepository.FindById(context.Background(), subject.ID)
+	if err != nil {
+		return nil, newStatusError(http.StatusInternalServerError, err)
+	}
+	if user == nil {
+		if subjectRequest.Token == "" {
+			return nil, newStatusError(http.StatusNotFound, errors.New("user not found"))
+		}
+		// Tokens not issued to a user were issued to a client on its own behalf.
+		subject.Type = "client"
+		return subject, nil
+	}
+	subject.Type = "user"
+	subject.Username = user.Username
+	subject.Email = user.Email
+	// Inactive users keep their roles, but must not be granted anything.
+	if !user.Enabled || !user.AccountNonLocked || !user.AccountNonExpired {
+		subject.Inactive = true
+		return subject, nil
+	}
+
+	claims, err := s.claimsService().GetAuthorizationClaims(user, subject.ApplicationID)
+	if err != nil {
+		return nil, newStatusError(http.StatusBadRequest, err)
+	}
+	subject.Roles = claims.Roles
+	subject.Permissions = claims.Permissions
+	return subject, nil
+}
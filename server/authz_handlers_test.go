@@ -0,0 +1,128 @@
+package server
+
+import (
+	"auth-server/models"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestResolveAuthorizationSubject(t *testing.T) {
+	s := newTestServer(t)
+	user := newTestUser("alice")
+	s.userRepository = fakeRepository[models.User]{user.ID.String(): user}
+	tokenOf := func(user *models.User) string {
+		return newTestToken(t, s, func(p *models.Payload) {
+			p.Sub = user.ID.String()
+			p.Aud = "application"
+		})
+	}
+
+	tests := []struct {
+		name    string
+		request models.AuthorizationRequest
+		status  int
+	}{
+		{"no subject", models.AuthorizationRequest{ApplicationId: "application"}, http.StatusBadRequest},
+		{"token and user id", models.AuthorizationRequest{
+			ApplicationId: "application",
+			Subject:       models.AuthorizationSubjectRequest{Token: tokenOf(user), UserId: user.ID.String()},
+		}, http.StatusBadRequest},
+		{"user id without application", models.AuthorizationRequest{
+			Subject: models.AuthorizationSubjectRequest{UserId: user.ID.String()},
+		}, http.StatusBadRequest},
+		{"invalid token", models.AuthorizationRequest{
+			Subject: models.AuthorizationSubjectRequest{Token: "garbage"},
+		}, http.StatusUnauthorized},
+		{"application other than the token audience", models.AuthorizationRequest{
+			ApplicationId: "other",
+			Subject:       models.AuthorizationSubjectRequest{Token: tokenOf(user)},
+		}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject, err := s.resolveAuthorizationSubject(&tt.request)
+			if err == nil {
+				t.Fatalf("resolved subject %+v, want status %d", subject, tt.status)
+			}
+			if status := errorStatus(err); status != tt.status {
+				t.Fatalf("status = %d, want %d: %v", status, tt.status, err)
+			}
+		})
+	}
+}
+
+func TestHandleDecideDeniesInactiveUsers(t *testing.T) {
+	app := &models.Application{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, AppName: "app"}
+	allowAll := &models.Policy{
+		BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()},
+		Name:           "allow-all",
+		ApplicationID:  app.ID,
+		Effect:         models.POLICY_EFFECT_ALLOW,
+		Resource:       "documents/*",
+		Action:         "*",
+	}
+
+	tests := []struct {
+		name      string
+		user      func(*models.User)
+		withToken bool
+		allowed   bool
+	}{
+		{"active user", nil, false, true},
+		{"disabled user", func(u *models.User) { u.Enabled = false }, false, false},
+		{"locked user", func(u *models.User) { u.AccountNonLocked = false }, false, false},
+		{"expired account", func(u *models.User) { u.AccountNonExpired = false }, false, false},
+		{"token of a locked user", func(u *models.User) { u.AccountNonLocked = false }, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, db := newDatabaseTestServer(t)
+			user := newTestUser("alice")
+			if tt.user != nil {
+				tt.user(user)
+			}
+			db.Return(`FROM "users"`, user)
+			db.Return(`FROM "policies"`, allowAll)
+			request := models.AuthorizationRequest{
+				ApplicationId: app.ID.String(),
+				Subject:       models.AuthorizationSubjectRequest{UserId: user.ID.String()},
+				Resource:      "documents/1",
+				Action:        "read",
+			}
+			if tt.withToken {
+				request.ApplicationId = ""
+				request.Subject = models.AuthorizationSubjectRequest{Token: newTestToken(t, s, func(p *models.Payload) {
+					p.Sub = user.ID.String()
+					p.Aud = app.ID.String()
+				})}
+			}
+			body, _ := json.Marshal(request)
+			r := httptest.NewRequest(http.MethodPost, AUTHZ_DECIDE_ROUTE, bytes.NewReader(body))
+			w := httptest.NewRecorder()
+			s.HandleDecide(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			var decision models.AuthorizationDecision
+			err := json.Unmarshal(w.Body.Bytes(), &decision)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decision.Allowed != tt.allowed {
+				t.Fatalf("decision = %+v, rule = %+v", decision, decision.Rule)
+			}
+			if tt.allowed {
+				return
+			}
+			if decision.Decision != models.POLICY_EFFECT_DENY || decision.Rule.Type != "account" || decision.Reason == "" {
+				t.Errorf("decision = %+v, rule = %+v", decision, decision.Rule)
+			}
+		})
+	}
+}
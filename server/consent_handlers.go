@@ -0,0 +1,58 @@
+package server
+
+import (
+	"auth-server/services"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleUserConsents lists the consents the authenticated user gave to clients.
+func (s *Server) HandleUserConsents(w http.ResponseWriter, r *http.Request) {
+	user, err := s.authenticatedUser(w, r)
+	if err != nil {
+		s.HandleError(w, errorStatus(err), USER_CONSENTS_ROUTE, err)
+		return
+	}
+
+	result, err := s.consentService().GetConsents(user)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, USER_CONSENTS_ROUTE, err)
+		return
+	}
+	response, err := json.Marshal(result)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, USER_CONSENTS_ROUTE, err)
+		return
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// HandleUserConsentDetails lets the authenticated user revoke one of their
+// consents, along with the refresh tokens the client holds on their behalf.
+func (s *Server) HandleUserConsentDetails(w http.ResponseWriter, r *http.Request) {
+	user, err := s.authenticatedUser(w, r)
+	if err != nil {
+		s.HandleError(w, errorStatus(err), USER_CONSENT_DETAILS_ROUTE, err)
+		return
+	}
+
+	err = s.consentService().RevokeConsent(user, mux.Vars(r)["id"])
+	if errors.Is(err, services.ErrConsentNotFound) {
+		s.HandleError(w, http.StatusNotFound, USER_CONSENT_DETAILS_ROUTE, err)
+		return
+	}
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, USER_CONSENT_DETAILS_ROUTE, err)
+		return
+	}
+
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+}
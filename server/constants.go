@@ -1,14 +1,148 @@
 package server
 
+import (
+	"auth-server/models"
+	"time"
+)
+
 // Server constants
 const (
 	CONTENT_TYPE     string = "Content-Type"
 	X_REQUESTED_WITH string = "X-Requested-With"
 	AUTHORIZATION    string = "Authorization"
+	WWW_AUTHENTICATE string = "WWW-Authenticate"
+	ORIGIN           string = "Origin"
+	DPOP_NONCE       string = "DPoP-Nonce"
+	X_REQUEST_ID     string = "X-Request-ID"
 )
 
 // Headers constants
 const (
 	APPLICATION_JSON string = "application/json"
 	BEARER           string = "Bearer"
+	DPOP             string = "DPoP"
+)
+
+// Claims constants
+const (
+	DEFAULT_ROLES_CLAIM       string = "roles"
+	DEFAULT_PERMISSIONS_CLAIM string = "permissions"
+	DEFAULT_MAX_CLAIM_ENTRIES int    = 100
+)
+
+// Grant type constants
+const (
+	GRANT_TYPE_AUTHORIZATION_CODE string = models.GRANT_TYPE_AUTHORIZATION_CODE
+	GRANT_TYPE_REFRESH_TOKEN      string = models.GRANT_TYPE_REFRESH_TOKEN
+	GRANT_TYPE_CLIENT_CREDENTIALS string = models.GRANT_TYPE_CLIENT_CREDENTIALS
+	GRANT_TYPE_PASSWORD           string = models.GRANT_TYPE_PASSWORD
+	GRANT_TYPE_DEVICE_CODE        string = models.GRANT_TYPE_DEVICE_CODE
+	GRANT_TYPE_TOKEN_EXCHANGE     string = models.GRANT_TYPE_TOKEN_EXCHANGE
+)
+
+// Token type identifiers, see RFC 8693, section 3
+const (
+	TOKEN_TYPE_ACCESS_TOKEN string = "urn:ietf:params:oauth:token-type:access_token"
+	TOKEN_TYPE_JWT          string = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// Client authentication constants
+const (
+	JWKS_CACHE_TTL             time.Duration = 5 * time.Minute
+	CLIENT_SECRET_GRACE_PERIOD time.Duration = 7 * 24 * time.Hour
+)
+
+// CORS constants
+const (
+	ORIGIN_CACHE_TTL time.Duration = time.Minute
+)
+
+// Device authorization constants
+const (
+	DEVICE_CODE_LIFETIME time.Duration = 10 * time.Minute
+	DEVICE_CODE_INTERVAL int           = 5
+)
+
+// Authorization endpoint constants
+const (
+	AUTHORIZATION_CODE_LIFETIME time.Duration = 5 * time.Minute
+)
+
+// Prompt values, see OpenID Connect Core, section 3.1.2.1
+const (
+	PROMPT_NONE    string = "none"
+	PROMPT_LOGIN   string = "login"
+	PROMPT_CONSENT string = "consent"
+)
+
+// Session constants
+const (
+	SESSION_COOKIE               string        = "auth_session"
+	DEFAULT_SESSION_IDLE_TIMEOUT time.Duration = 30 * time.Minute
+	DEFAULT_SESSION_MAX_AGE      time.Duration = 12 * time.Hour
+)
+
+// Logout constants
+const (
+	LOGOUT_TOKEN_LIFETIME       time.Duration = 2 * time.Minute
+	BACKCHANNEL_LOGOUT_TIMEOUT  time.Duration = 5 * time.Second
+	BACKCHANNEL_LOGOUT_BACKOFF  time.Duration = time.Second
+	BACKCHANNEL_LOGOUT_ATTEMPTS int           = 4
+)
+
+// Federation constants
+const (
+	FEDERATED_LOGIN_LIFETIME   time.Duration = 10 * time.Minute
+	FEDERATION_HTTP_TIMEOUT    time.Duration = 10 * time.Second
+	FEDERATION_METADATA_TTL    time.Duration = time.Hour
+	SAML_METADATA_CONTENT_TYPE string        = "application/samlmetadata+xml"
+	LDAP_TIMEOUT               time.Duration = 10 * time.Second
+)
+
+// SCIM constants
+const (
+	SCIM_SCOPE             string = models.SCOPE_SCIM
+	SCIM_CONTENT_TYPE      string = "application/scim+json"
+	SCIM_DEFAULT_PAGE_SIZE int    = 100
+	SCIM_MAX_PAGE_SIZE     int    = 1000
+)
+
+// Tenant constants
+const (
+	REALM_PATH_PREFIX string        = "/realms/"
+	TENANT_CACHE_TTL  time.Duration = time.Minute
+	ADMIN_SCOPE       string        = models.SCOPE_ADMIN
+)
+
+// Audit constants
+const (
+	AUDIT_DEFAULT_PAGE_SIZE int = 100
+	AUDIT_MAX_PAGE_SIZE     int = 1000
+)
+
+// Metrics constants
+const (
+	METRICS_NAMESPACE     string = "auth_server"
+	METRICS_DATABASE_NAME string = "auth_server"
+	METRICS_OTHER_CLIENT  string = "other"
+)
+
+// Tracing constants
+const (
+	TRACING_SERVICE_NAME  string = "auth-server"
+	TRACE_EXPORTER_OTLP   string = "otlp"
+	TRACE_EXPORTER_STDOUT string = "stdout"
+)
+
+// Webhook constants
+const (
+	WEBHOOK_HTTP_TIMEOUT      time.Duration = 10 * time.Second
+	WEBHOOK_POLL_INTERVAL     time.Duration = 5 * time.Second
+	WEBHOOK_DELIVERY_BATCH    int           = 50
+	WEBHOOK_DELIVERY_LEASE    time.Duration = time.Minute
+	WEBHOOK_DELIVERY_ATTEMPTS int           = 10
+	WEBHOOK_RETRY_BACKOFF     time.Duration = 30 * time.Second
+	WEBHOOK_MAX_RETRY_BACKOFF time.Duration = 2 * time.Hour
+	WEBHOOK_DEFAULT_PAGE_SIZE int           = 100
+	WEBHOOK_MAX_PAGE_SIZE     int           = 1000
 )
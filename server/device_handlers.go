@@ -0,0 +1,209 @@
+package server
+
+import (
+	"auth-server/mapper"
+	"auth-server/models"
+	"auth-server/repository"
+	"auth-server/services"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// HandleDeviceAuthorization starts the device authorization grant described in
+// RFC 8628 for clients that cannot perform a browser redirect, such as CLIs
+// and kiosk devices. It returns a device code the client polls the token
+// endpoint with, and a user code the user enters at the verification URI.
+// Confidential clients must authenticate, as they do at the token endpoint.
+func (s *Server) HandleDeviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	var deviceRequest models.DeviceAuthorizationRequest
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&deviceRequest)
+	if err != nil {
+		s.HandleOAuthError(w, DEVICE_AUTHORIZATION_ROUTE, newOAuthError(http.StatusBadRequest, "invalid_request", err.Error()))
+		return
+	}
+
+	client, err := s.authenticateClient(r, &models.TokenRequest{
+		ClientId:            deviceRequest.ClientId,
+		ClientAssertionType: deviceRequest.ClientAssertionType,
+		ClientAssertion:     deviceRequest.ClientAssertion,
+		ClientSecret:        deviceRequest.ClientSecret,
+	})
+	if err == nil {
+		err = s.authorizeClient(r, client, GRANT_TYPE_DEVICE_CODE)
+	}
+	var app *models.Application
+	if err == nil {
+		app, err = s.applicationRepository.FindById(r.Context(), deviceRequest.Aud)
+		if err != nil {
+			err = newOAuthError(http.StatusBadRequest, "invalid_request", "unknown application")
+		}
+	}
+	var oauthErr *oauthError
+	if errors.As(err, &oauthErr) {
+		s.HandleOAuthError(w, DEVICE_AUTHORIZATION_ROUTE, oauthErr)
+		return
+	}
+	if err != nil {
+		s.HandleError(w, errorStatus(err), DEVICE_AUTHORIZATION_ROUTE, err)
+		return
+	}
+
+	repo := s.deviceCodeRepository.(*repository.DeviceCodeRepository)
+	service := services.NewDeviceAuthorizationService(repo)
+
+	deviceCode, code, err := service.CreateDeviceCode(client, app, deviceRequest.Scope, DEVICE_CODE_LIFETIME, DEVICE_CODE_INTERVAL)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, DEVICE_AUTHORIZATION_ROUTE, err)
+		return
+	}
+
+	userCode := models.FormatUserCode(deviceCode.UserCode)
+	verificationURI := s.config.Issuer + DEVICE_VERIFICATION_ROUTE
+	deviceResponse := models.DeviceAuthorizationResponse{
+		DeviceCode:              code,
+		UserCode:                userCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + url.QueryEscape(userCode),
+		ExpiresIn:               int64(DEVICE_CODE_LIFETIME.Seconds()),
+		Interval:                deviceCode.Interval,
+	}
+	response, err := json.Marshal(deviceResponse)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, DEVICE_AUTHORIZATION_ROUTE, err)
+		return
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// HandleDeviceVerification lets a logged-in user review and approve or deny a
+// pending device authorization request, identified by its user code. The user
+// is authenticated with a bearer token issued to them, and their account must
+// be active. When called via GET, it retrieves the request given by the
+// user_code query parameter. When called via POST, it approves or denies it.
+func (s *Server) HandleDeviceVerification(w http.ResponseWriter, r *http.Request) {
+	user, err := s.authenticatedUser(w, r)
+	if err != nil {
+		s.HandleError(w, errorStatus(err), DEVICE_VERIFICATION_ROUTE, err)
+		return
+	}
+	if !user.Enabled || !user.AccountNonLocked || !user.AccountNonExpired {
+		s.HandleError(w, http.StatusForbidden, DEVICE_VERIFICATION_ROUTE, errors.New("user account is not active"))
+		return
+	}
+
+	repo := s.deviceCodeRepository.(*repository.DeviceCodeRepository)
+	service := services.NewDeviceAuthorizationService(repo)
+
+	userCode := r.URL.Query().Get("user_code")
+	var verificationRequest models.DeviceVerificationRequest
+	if r.Method == http.MethodPost {
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&verificationRequest)
+		if err != nil {
+			s.HandleError(w, http.StatusBadRequest, DEVICE_VERIFICATION_ROUTE, err)
+			return
+		}
+		userCode = verificationRequest.UserCode
+	}
+
+	deviceCode, err := service.GetPendingByUserCode(userCode)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, DEVICE_VERIFICATION_ROUTE, err)
+		return
+	}
+	if deviceCode == nil {
+		s.HandleError(w, http.StatusNotFound, DEVICE_VERIFICATION_ROUTE, errors.New("invalid or expired user code"))
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		if verificationRequest.Approve {
+			deviceCode, err = service.Approve(deviceCode, user)
+			if err == nil && deviceCode.Client != nil && !deviceCode.Client.FirstParty {
+				err = s.consentService().Grant(user, deviceCode.Client, strings.Fields(deviceCode.Scope))
+			}
+		} else {
+			deviceCode, err = service.Deny(deviceCode, user)
+		}
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, DEVICE_VERIFICATION_ROUTE, err)
+			return
+		}
+	}
+
+	response, err := json.Marshal(mapper.DeviceCodeToDeviceVerificationDto(deviceCode))
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, DEVICE_VERIFICATION_ROUTE, err)
+		return
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// deviceCodeGrant builds the payload of a token issued to a device once the
+// user approved its authorization request. While the request is pending, the
+// device is told to keep polling, or to slow down if it polls too frequently.
+func (s *Server) deviceCodeGrant(client *models.Client, tokenRequest *models.TokenRequest) (*models.Payload, error) {
+	if tokenRequest.DeviceCode == "" {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "missing device_code")
+	}
+
+	repo := s.deviceCodeRepository.(*repository.DeviceCodeRepository)
+	service := services.NewDeviceAuthorizationService(repo)
+
+	deviceCode, err := service.Poll(tokenRequest.DeviceCode, tokenRequest.ClientId)
+	switch {
+	case errors.Is(err, services.ErrAuthorizationPending):
+		return nil, newOAuthError(http.StatusBadRequest, "authorization_pending", err.Error())
+	case errors.Is(err, services.ErrSlowDown):
+		return nil, newOAuthError(http.StatusBadRequest, "slow_down", err.Error())
+	case errors.Is(err, services.ErrAccessDenied):
+		return nil, newOAuthError(http.StatusBadRequest, "access_denied", err.Error())
+	case errors.Is(err, services.ErrExpiredToken):
+		return nil, newOAuthError(http.StatusBadRequest, "expired_token", err.Error())
+	case errors.Is(err, services.ErrInvalidDeviceCode):
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_grant", err.Error())
+	case err != nil:
+		return nil, err
+	}
+
+	user, err := s.activeUser(deviceCode.UserID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	payload := models.NewPayload(user.ID.String(), deviceCode.ApplicationID.String(), client.AccessTokenTTL(), deviceCode.Scope)
+	payload.SetClaim("client_id", client.ID.String())
+	if err := s.addUserClaims(payload, user); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// authenticatedUser returns the user the access token of the request was issued to.
+func (s *Server) authenticatedUser(w http.ResponseWriter, r *http.Request) (*models.User, error) {
+	payload, err := s.authenticateToken(w, r)
+	if err != nil {
+		return nil, newStatusError(http.StatusUnauthorized, err)
+	}
+	repo := s.userRepository.(*repository.UserRepository)
+	user, err := repo.FindById(context.Background(), payload.Sub)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, newStatusError(http.StatusForbidden, errors.New("token was not issued to a user"))
+	}
+	return user, nil
+}
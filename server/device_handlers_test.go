@@ -0,0 +1,181 @@
+package server
+
+import (
+	"auth-server/models"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestHandleDeviceAuthorizationAuthenticatesClients(t *testing.T) {
+	s := newTestServer(t)
+	newClient := func(authMethod string, grantTypes ...string) *models.Client {
+		clientType := models.CLIENT_TYPE_CONFIDENTIAL
+		if authMethod == models.CLIENT_AUTH_NONE {
+			clientType = models.CLIENT_TYPE_PUBLIC
+		}
+		return &models.Client{
+			BaseUUIDEntity:          models.BaseUUIDEntity{ID: uuid.New()},
+			ClientType:              clientType,
+			TokenEndpointAuthMethod: authMethod,
+			GrantTypes:              grantTypes,
+		}
+	}
+	basic := newClient(models.CLIENT_AUTH_CLIENT_SECRET_BASIC, GRANT_TYPE_DEVICE_CODE)
+	post := newClient(models.CLIENT_AUTH_CLIENT_SECRET_POST, GRANT_TYPE_DEVICE_CODE)
+	keyJwt := newClient(models.CLIENT_AUTH_PRIVATE_KEY_JWT, GRANT_TYPE_DEVICE_CODE)
+	public := newClient(models.CLIENT_AUTH_NONE, GRANT_TYPE_DEVICE_CODE)
+	noDevice := newClient(models.CLIENT_AUTH_NONE, models.GRANT_TYPE_AUTHORIZATION_CODE)
+	disabled := newClient(models.CLIENT_AUTH_NONE, GRANT_TYPE_DEVICE_CODE)
+	disabled.Disabled = true
+	s.clientRepository = fakeRepository[models.Client]{}
+	for _, client := range []*models.Client{basic, post, keyJwt, public, noDevice, disabled} {
+		s.clientRepository.(fakeRepository[models.Client])[client.ID.String()] = client
+	}
+	s.applicationRepository = fakeRepository[models.Application]{}
+
+	tests := []struct {
+		name    string
+		request models.DeviceAuthorizationRequest
+		basic   bool
+		status  int
+		code    string
+	}{
+		{"confidential client without secret", models.DeviceAuthorizationRequest{ClientId: basic.ID.String()}, false, http.StatusUnauthorized, "invalid_client"},
+		{"client_secret_post client without secret", models.DeviceAuthorizationRequest{ClientId: post.ID.String()}, false, http.StatusUnauthorized, "invalid_client"},
+		{"private_key_jwt client without assertion", models.DeviceAuthorizationRequest{ClientId: keyJwt.ID.String()}, false, http.StatusUnauthorized, "invalid_client"},
+		{"unknown client", models.DeviceAuthorizationRequest{ClientId: uuid.NewString()}, false, http.StatusUnauthorized, "invalid_client"},
+		{"two authentication methods", models.DeviceAuthorizationRequest{ClientId: basic.ID.String(), ClientSecret: "secret"}, true, http.StatusBadRequest, "invalid_request"},
+		{"disabled client", models.DeviceAuthorizationRequest{ClientId: disabled.ID.String()}, false, http.StatusUnauthorized, "invalid_client"},
+		{"client without the device grant", models.DeviceAuthorizationRequest{ClientId: noDevice.ID.String()}, false, http.StatusBadRequest, "unauthorized_client"},
+		{"public client with unknown application", models.DeviceAuthorizationRequest{ClientId: public.ID.String(), Aud: uuid.NewString()}, false, http.StatusBadRequest, "invalid_request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := json.Marshal(tt.request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest(http.MethodPost, "/oauth2/device_authorization", bytes.NewReader(body))
+			if tt.basic {
+				r.SetBasicAuth(tt.request.ClientId, "secret")
+			}
+			w := httptest.NewRecorder()
+			s.HandleDeviceAuthorization(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			var response models.OAuthErrorResponse
+			err = json.Unmarshal(w.Body.Bytes(), &response)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.Error != tt.code {
+				t.Errorf("error = %q, want %q", response.Error, tt.code)
+			}
+		})
+	}
+}
+
+func TestDeviceCodeGrant(t *testing.T) {
+	client := &models.Client{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, ClientName: "tv"}
+	app := &models.Application{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, AppName: "app"}
+
+	tests := []struct {
+		name string
+		user func(*models.User)
+		code string
+	}{
+		{"active user", nil, ""},
+		{"disabled user", func(u *models.User) { u.Enabled = false }, "invalid_grant"},
+		{"locked user", func(u *models.User) { u.AccountNonLocked = false }, "invalid_grant"},
+		{"expired account", func(u *models.User) { u.AccountNonExpired = false }, "invalid_grant"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, db := newDatabaseTestServer(t)
+			s.config.Claims = &models.ClaimsConfig{RolesClaim: "roles", PermissionsClaim: "permissions"}
+			user := newTestUser("alice")
+			if tt.user != nil {
+				tt.user(user)
+			}
+			db.Return(`FROM "device_codes"`, &models.DeviceCode{
+				BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()},
+				ClientID:       client.ID,
+				ApplicationID:  app.ID,
+				Status:         models.DEVICE_CODE_APPROVED,
+				UserID:         &user.ID,
+				ExpiresAt:      time.Now().Add(time.Minute),
+			})
+			db.Return(`FROM "users"`, user)
+
+			payload, err := s.deviceCodeGrant(client, &models.TokenRequest{
+				GrantType:  GRANT_TYPE_DEVICE_CODE,
+				ClientId:   client.ID.String(),
+				DeviceCode: "device-code",
+			})
+
+			if tt.code != "" {
+				oauthErr, ok := err.(*oauthError)
+				if !ok || oauthErr.code != tt.code {
+					t.Fatalf("err = %v, want %s", err, tt.code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if payload.Sub != user.ID.String() || payload.Aud != app.ID.String() {
+				t.Errorf("sub = %s, aud = %s", payload.Sub, payload.Aud)
+			}
+			if clientId, _ := payload.Claim("client_id"); clientId != client.ID.String() {
+				t.Errorf("client_id = %v", clientId)
+			}
+		})
+	}
+}
+
+func TestHandleDeviceVerificationRequiresActiveUser(t *testing.T) {
+	tests := []struct {
+		name   string
+		user   func(*models.User)
+		status int
+	}{
+		{"active user", nil, http.StatusOK},
+		{"disabled user", func(u *models.User) { u.Enabled = false }, http.StatusForbidden},
+		{"locked user", func(u *models.User) { u.AccountNonLocked = false }, http.StatusForbidden},
+		{"expired account", func(u *models.User) { u.AccountNonExpired = false }, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, db := newDatabaseTestServer(t)
+			user := newTestUser("alice")
+			if tt.user != nil {
+				tt.user(user)
+			}
+			db.Return(`FROM "users"`, user)
+			db.Return(`FROM "device_codes"`, &models.DeviceCode{
+				BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()},
+				UserCode:       "BCDFGHJK",
+				Status:         models.DEVICE_CODE_PENDING,
+				ExpiresAt:      time.Now().Add(time.Minute),
+			})
+			token := newTestToken(t, s, func(p *models.Payload) { p.Sub = user.ID.String() })
+
+			r := httptest.NewRequest(http.MethodGet, "/oauth2/device/?user_code=BCDF-GHJK", nil)
+			r.Header.Set(AUTHORIZATION, BEARER+" "+token)
+			w := httptest.NewRecorder()
+			s.HandleDeviceVerification(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"auth-server/models"
+	"auth-server/services"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var errDPoPBoundToken = errors.New("tokens bound to a DPoP key must be sent with the DPoP scheme")
+
+func (s *Server) dpopService() *services.DPoPService {
+	return services.NewDPoPService(s.dpopReplayCache, s.config.Secret, s.config.DPoPRequireNonce)
+}
+
+// authenticateToken validates the access token sent with the request. Tokens
+// bound to a DPoP key must be sent with the DPoP scheme, along with a proof
+// signed by that key, as described in RFC 9449, section 7.
+func (s *Server) authenticateToken(w http.ResponseWriter, r *http.Request) (*models.Payload, error) {
+	scheme, token, err := authorizationCredentials(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(scheme, BEARER) && !strings.EqualFold(scheme, DPOP) {
+		return nil, errors.New("invalid token type")
+	}
+	payload, err := s.ValidateToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(scheme, BEARER) {
+		if isDPoPBound(payload) {
+			return nil, errDPoPBoundToken
+		}
+		return payload, nil
+	}
+	if err := s.verifyResourceRequestProof(w, r, token, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// verifyTokenRequestProof verifies the DPoP proof sent to the token endpoint,
+// if any, and returns the thumbprint of the key the token must be bound to.
+// When nonces are required, a fresh one is sent with every response.
+func (s *Server) verifyTokenRequestProof(w http.ResponseWriter, r *http.Request) (string, error) {
+	service := s.dpopService()
+	if service.RequiresNonce() {
+		w.Header().Set(DPOP_NONCE, service.NewNonce())
+	}
+	proof, err := dpopProof(r)
+	if err != nil {
+		return "", newOAuthError(http.StatusBadRequest, "invalid_dpop_proof", err.Error())
+	}
+	if proof == "" {
+		return "", nil
+	}
+	jkt, err := service.VerifyProof(proof, r.Method, s.requestURI(r), "")
+	if errors.Is(err, services.ErrUseDPoPNonce) {
+		return "", newOAuthError(http.StatusBadRequest, "use_dpop_nonce", err.Error())
+	}
+	if err != nil {
+		return "", newOAuthError(http.StatusBadRequest, "invalid_dpop_proof", err.Error())
+	}
+	return jkt, nil
+}
+
+// verifyResourceRequestProof verifies the DPoP proof sent with a DPoP-bound
+// token to one of the server's protected endpoints. Failures are reported in
+// the WWW-Authenticate header, as described in RFC 9449, section 7.1.
+func (s *Server) verifyResourceRequestProof(w http.ResponseWriter, r *http.Request, token string, payload *models.Payload) error {
+	if !isDPoPBound(payload) {
+		w.Header().Set(WWW_AUTHENTICATE, DPOP+` error="invalid_token"`)
+		return errors.New("the token is not bound to a DPoP key")
+	}
+	service := s.dpopService()
+	proof, err := dpopProof(r)
+	if err == nil && proof == "" {
+		err = errors.New("missing DPoP proof")
+	}
+	if err == nil {
+		err = verifyProofKey(service, proof, r.Method, s.requestURI(r), token, payload)
+	}
+	if errors.Is(err, services.ErrUseDPoPNonce) {
+		w.Header().Set(DPOP_NONCE, service.NewNonce())
+		w.Header().Set(WWW_AUTHENTICATE, DPOP+` error="use_dpop_nonce"`)
+		return err
+	}
+	if err != nil {
+		w.Header().Set(WWW_AUTHENTICATE, DPOP+` error="invalid_dpop_proof"`)
+		return err
+	}
+	return nil
+}
+
+// verifyIntrospectedProof verifies the DPoP proof a resource server passed to
+// the introspection endpoint, if any. The server's nonces are not required,
+// since the proof was sent to the resource server.
+func (s *Server) verifyIntrospectedProof(request *models.IntrospectionRequest, payload *models.Payload) error {
+	if request.DPoP == "" {
+		return nil
+	}
+	if !isDPoPBound(payload) {
+		return errors.New("the token is not bound to a DPoP key")
+	}
+	service := services.NewDPoPService(s.dpopReplayCache, s.config.Secret, false)
+	return verifyProofKey(service, request.DPoP, request.Htm, request.Htu, request.Token, payload)
+}
+
+// verifyProofKey verifies the proof and checks it is signed with the key the
+// token is bound to.
+func verifyProofKey(service *services.DPoPService, proof string, method string, uri string, token string, payload *models.Payload) error {
+	jkt, err := service.VerifyProof(proof, method, uri, token)
+	if err != nil {
+		return err
+	}
+	if jkt != payload.Cnf.Jkt {
+		return errors.New("the DPoP proof is not signed with the key the token is bound to")
+	}
+	return nil
+}
+
+// requestURI returns the URI the request was sent to, as clients see it.
+func (s *Server) requestURI(r *http.Request) string {
+	return s.baseURL(r) + strings.TrimPrefix(r.URL.Path, s.pathPrefix)
+}
+
+// dpopProof returns the DPoP proof sent with the request, if any.
+func dpopProof(r *http.Request) (string, error) {
+	proofs := r.Header.Values(DPOP)
+	if len(proofs) > 1 {
+		return "", errors.New("only one DPoP proof may be sent")
+	}
+	if len(proofs) == 0 {
+		return "", nil
+	}
+	return proofs[0], nil
+}
+
+func isDPoPBound(payload *models.Payload) bool {
+	return payload.Cnf != nil && payload.Cnf.Jkt != ""
+}
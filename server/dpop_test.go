@@ -0,0 +1,203 @@
+package server
+
+import (
+	"auth-server/cache"
+	"auth-server/models"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// dpopTestKey is a client key signing DPoP proofs.
+type dpopTestKey struct {
+	key *ecdsa.PrivateKey
+	jwk map[string]string
+	jkt string
+}
+
+func newDPoPTestKey(t *testing.T) *dpopTestKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coordinate := func(value []byte) string {
+		padded := make([]byte, 32)
+		copy(padded[32-len(value):], value)
+		return base64.RawURLEncoding.EncodeToString(padded)
+	}
+	jwk := map[string]string{"kty": "EC", "crv": "P-256", "x": coordinate(key.X.Bytes()), "y": coordinate(key.Y.Bytes())}
+	jkt, err := (&models.JSONWebKey{Kty: "EC", Crv: "P-256", X: jwk["x"], Y: jwk["y"]}).Thumbprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &dpopTestKey{key: key, jwk: jwk, jkt: jkt}
+}
+
+// proof returns a fresh proof for a request to the server's path, along with
+// the given additional claims.
+func (k *dpopTestKey) proof(t *testing.T, method string, path string, claims map[string]interface{}) string {
+	t.Helper()
+	body := map[string]interface{}{"jti": uuid.NewString(), "htm": method, "htu": testIssuer + path, "iat": time.Now().Unix()}
+	for name, value := range claims {
+		body[name] = value
+	}
+	encode := func(value interface{}) string {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(encoded)
+	}
+	message := encode(map[string]interface{}{"typ": "dpop+jwt", "alg": "ES256", "jwk": k.jwk}) + "." + encode(body)
+	digest := sha256.Sum256([]byte(message))
+	r, s, err := ecdsa.Sign(rand.Reader, k.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return message + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestAuthenticateTokenWithDPoP(t *testing.T) {
+	s := newTestServer(t)
+	s.dpopReplayCache = cache.NewReplayCache()
+	key := newDPoPTestKey(t)
+	otherKey := newDPoPTestKey(t)
+	bound := newTestToken(t, s, func(p *models.Payload) { p.Cnf = &models.Confirmation{Jkt: key.jkt} })
+	unbound := newTestToken(t, s)
+	ath := func(token string) map[string]interface{} {
+		return map[string]interface{}{"ath": models.AccessTokenHash(token)}
+	}
+
+	tests := []struct {
+		name          string
+		scheme        string
+		token         string
+		proofs        func() []string
+		requireNonce  bool
+		wantChallenge string
+		wantErr       bool
+	}{
+		{"bound token with a proof", DPOP, bound, func() []string { return []string{key.proof(t, "GET", "/userinfo", ath(bound))} }, false, "", false},
+		{"bound token sent as a bearer token", BEARER, bound, nil, false, "", true},
+		{"unbound bearer token", BEARER, unbound, nil, false, "", false},
+		{"unbound token sent with the DPoP scheme", DPOP, unbound, func() []string { return []string{key.proof(t, "GET", "/userinfo", ath(unbound))} }, false, `DPoP error="invalid_token"`, true},
+		{"missing proof", DPOP, bound, nil, false, `DPoP error="invalid_dpop_proof"`, true},
+		{"two proofs", DPOP, bound, func() []string {
+			return []string{key.proof(t, "GET", "/userinfo", ath(bound)), key.proof(t, "GET", "/userinfo", ath(bound))}
+		}, false, `DPoP error="invalid_dpop_proof"`, true},
+		{"proof signed by another key", DPOP, bound, func() []string { return []string{otherKey.proof(t, "GET", "/userinfo", ath(bound))} }, false, `DPoP error="invalid_dpop_proof"`, true},
+		{"proof for another token", DPOP, bound, func() []string { return []string{key.proof(t, "GET", "/userinfo", ath(unbound))} }, false, `DPoP error="invalid_dpop_proof"`, true},
+		{"proof for another method", DPOP, bound, func() []string { return []string{key.proof(t, "POST", "/userinfo", ath(bound))} }, false, `DPoP error="invalid_dpop_proof"`, true},
+		{"proof for another endpoint", DPOP, bound, func() []string { return []string{key.proof(t, "GET", "/oauth2/introspect", ath(bound))} }, false, `DPoP error="invalid_dpop_proof"`, true},
+		{"proof without a nonce", DPOP, bound, func() []string { return []string{key.proof(t, "GET", "/userinfo", ath(bound))} }, true, `DPoP error="use_dpop_nonce"`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.config.DPoPRequireNonce = tt.requireNonce
+			r := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+			r.Header.Set(AUTHORIZATION, tt.scheme+" "+tt.token)
+			if tt.proofs != nil {
+				for _, proof := range tt.proofs() {
+					r.Header.Add(DPOP, proof)
+				}
+			}
+			w := httptest.NewRecorder()
+
+			payload, err := s.authenticateToken(w, r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && payload.Sub != "subject" {
+				t.Errorf("subject = %q", payload.Sub)
+			}
+			if got := w.Header().Get(WWW_AUTHENTICATE); got != tt.wantChallenge {
+				t.Errorf("WWW-Authenticate = %q, want %q", got, tt.wantChallenge)
+			}
+			if hasNonce := w.Header().Get(DPOP_NONCE) != ""; hasNonce != tt.requireNonce {
+				t.Errorf("DPoP-Nonce sent = %v, want %v", hasNonce, tt.requireNonce)
+			}
+		})
+	}
+}
+
+func TestVerifyTokenRequestProof(t *testing.T) {
+	s := newTestServer(t)
+	s.dpopReplayCache = cache.NewReplayCache()
+	key := newDPoPTestKey(t)
+	replayed := key.proof(t, "POST", "/oauth2/token", nil)
+	_, err := s.verifyTokenRequestProof(httptest.NewRecorder(), newDPoPTokenRequest(replayed))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		proofs       []string
+		requireNonce bool
+		wantJkt      string
+		wantCode     string
+	}{
+		{"no proof", nil, false, "", ""},
+		{"valid proof", []string{key.proof(t, "POST", "/oauth2/token", nil)}, false, key.jkt, ""},
+		{"replayed proof", []string{replayed}, false, "", "invalid_dpop_proof"},
+		{"two proofs", []string{key.proof(t, "POST", "/oauth2/token", nil), key.proof(t, "POST", "/oauth2/token", nil)}, false, "", "invalid_dpop_proof"},
+		{"proof for another endpoint", []string{key.proof(t, "POST", "/oauth2/revoke", nil)}, false, "", "invalid_dpop_proof"},
+		{"proof without a nonce", []string{key.proof(t, "POST", "/oauth2/token", nil)}, true, "", "use_dpop_nonce"},
+		{"proof with a forged nonce", []string{key.proof(t, "POST", "/oauth2/token", map[string]interface{}{"nonce": "forged"})}, true, "", "use_dpop_nonce"},
+		{"no proof when nonces are required", nil, true, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.config.DPoPRequireNonce = tt.requireNonce
+			w := httptest.NewRecorder()
+
+			jkt, err := s.verifyTokenRequestProof(w, newDPoPTokenRequest(tt.proofs...))
+			if tt.wantCode != "" {
+				oauthErr, ok := err.(*oauthError)
+				if !ok || oauthErr.code != tt.wantCode {
+					t.Fatalf("error = %v, want %s", err, tt.wantCode)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if jkt != tt.wantJkt {
+				t.Errorf("jkt = %q, want %q", jkt, tt.wantJkt)
+			}
+			nonce := w.Header().Get(DPOP_NONCE)
+			if (nonce != "") != tt.requireNonce {
+				t.Fatalf("DPoP-Nonce = %q", nonce)
+			}
+			if nonce == "" {
+				return
+			}
+			// The nonce sent back lets the client retry.
+			retry := key.proof(t, "POST", "/oauth2/token", map[string]interface{}{"nonce": nonce})
+			jkt, err = s.verifyTokenRequestProof(httptest.NewRecorder(), newDPoPTokenRequest(retry))
+			if err != nil || jkt != key.jkt {
+				t.Errorf("retry with the nonce = %q, %v", jkt, err)
+			}
+		})
+	}
+}
+
+func newDPoPTokenRequest(proofs ...string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/oauth2/token", strings.NewReader("grant_type=client_credentials"))
+	for _, proof := range proofs {
+		r.Header.Add(DPOP, proof)
+	}
+	return r
+}
@@ -1,9 +1,11 @@
 package server
 
 import (
+	"auth-server/logger"
 	"auth-server/models"
 	"encoding/json"
 	"net/http"
+	"strconv"
 )
 
 // HandleError handles errors by returning an error response with the
@@ -18,5 +20,46 @@ func (s *Server) HandleError(w http.ResponseWriter, statusCode int, route string
 	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
 	w.WriteHeader(statusCode)
 	w.Write(response)
-	s.logger.Error(statusCode, route, cause)
+	logger.RecordError(w, cause)
+}
+
+// HandleOAuthError returns an error response in the format defined by
+// RFC 6749, section 5.2, which OAuth 2.0 clients expect from the token
+// and device authorization endpoints.
+func (s *Server) HandleOAuthError(w http.ResponseWriter, route string, cause *oauthError) {
+	errorResponse := models.OAuthErrorResponse{
+		Error:            cause.code,
+		ErrorDescription: cause.description,
+	}
+	response, err := json.Marshal(errorResponse)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, route, err)
+		return
+	}
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(cause.status)
+	w.Write(response)
+	logger.RecordError(w, cause)
+}
+
+// HandleSCIMError returns an error response in the format defined by
+// RFC 7644, section 3.12, which SCIM clients expect from the provisioning
+// endpoints.
+func (s *Server) HandleSCIMError(w http.ResponseWriter, statusCode int, scimType string, route string, cause error) {
+	errorResponse := models.SCIMErrorResponse{
+		Schemas:  []string{models.SCIM_MESSAGE_ERROR},
+		Status:   strconv.Itoa(statusCode),
+		ScimType: scimType,
+		Detail:   cause.Error(),
+	}
+	response, err := json.Marshal(errorResponse)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, route, err)
+		return
+	}
+	w.Header().Set(CONTENT_TYPE, SCIM_CONTENT_TYPE)
+	w.WriteHeader(statusCode)
+	w.Write(response)
+	logger.RecordError(w, cause)
 }
@@ -0,0 +1,445 @@
+package server
+
+import (
+	"auth-server/mapper"
+	"auth-server/models"
+	"auth-server/repository"
+	"auth-server/services"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/crewjam/saml"
+	"github.com/gorilla/mux"
+)
+
+// HandleFederationProviders lists the upstream identity providers users can
+// log in with, for login pages to offer them.
+func (s *Server) HandleFederationProviders(w http.ResponseWriter, r *http.Request) {
+	providers, err := s.federationService().GetProviders()
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, FEDERATION_ROUTE, err)
+		return
+	}
+	result := make([]*models.FederationProviderDto, 0)
+	for _, provider := range providers {
+		result = append(result, &models.FederationProviderDto{
+			ID:       provider.ID.String(),
+			Name:     provider.Name,
+			Type:     provider.Type,
+			LoginURI: s.federationURI(provider, "login"),
+		})
+	}
+	response, err := json.Marshal(result)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, FEDERATION_ROUTE, err)
+		return
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// HandleFederatedLogin sends the user to log in at an upstream identity
+// provider. Once logged in, the user is sent back to return_to, which must be
+// a path on this server, such as the authorization endpoint they came from.
+func (s *Server) HandleFederatedLogin(w http.ResponseWriter, r *http.Request) {
+	service := s.federationService()
+	provider, err := service.GetProvider(mux.Vars(r)["id"])
+	if err != nil {
+		s.HandleError(w, http.StatusNotFound, FEDERATED_LOGIN_ROUTE, err)
+		return
+	}
+	returnTo := r.URL.Query().Get("return_to")
+	if returnTo != "" && !isLocalPath(returnTo) {
+		s.HandleError(w, http.StatusBadRequest, FEDERATED_LOGIN_ROUTE, errors.New("return_to must be a path on this server"))
+		return
+	}
+
+	login, state, err := service.StartLogin(provider, returnTo, FEDERATED_LOGIN_LIFETIME)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, FEDERATED_LOGIN_ROUTE, err)
+		return
+	}
+	var location string
+	switch provider.Type {
+	case models.IDENTITY_PROVIDER_TYPE_OIDC:
+		location, err = s.oidcFederationService().AuthenticationRequestURI(provider, login, state, s.federationURI(provider, "callback"))
+	case models.IDENTITY_PROVIDER_TYPE_SAML:
+		var sp *saml.ServiceProvider
+		sp, err = s.samlServiceProvider(provider)
+		if err == nil {
+			location, err = s.samlFederationService().AuthenticationRequestURI(sp, login, state)
+		}
+	}
+	if err != nil {
+		s.HandleError(w, http.StatusBadGateway, FEDERATED_LOGIN_ROUTE, err)
+		return
+	}
+	err = service.SaveLogin(login)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, FEDERATED_LOGIN_ROUTE, err)
+		return
+	}
+
+	http.Redirect(w, r, location, http.StatusFound)
+}
+
+// HandleFederationCallback completes a login at an upstream OpenID Connect
+// provider, which sends the user back here with an authorization code.
+func (s *Server) HandleFederationCallback(w http.ResponseWriter, r *http.Request) {
+	service := s.federationService()
+	provider, err := service.GetProvider(mux.Vars(r)["id"])
+	if err != nil || provider.Type != models.IDENTITY_PROVIDER_TYPE_OIDC {
+		s.HandleError(w, http.StatusNotFound, FEDERATION_CALLBACK_ROUTE, services.ErrIdentityProviderNotFound)
+		return
+	}
+	query := r.URL.Query()
+	login, err := service.FinishLogin(provider, query.Get("state"))
+	if err != nil {
+		s.HandleError(w, federationErrorStatus(err), FEDERATION_CALLBACK_ROUTE, err)
+		return
+	}
+	if code := query.Get("error"); code != "" {
+		s.HandleError(w, http.StatusUnauthorized, FEDERATION_CALLBACK_ROUTE, errors.New(strings.TrimSpace(code+" "+query.Get("error_description"))))
+		return
+	}
+	profile, err := s.oidcFederationService().Exchange(provider, login, query.Get("code"), s.federationURI(provider, "callback"))
+	if err != nil {
+		s.HandleError(w, http.StatusUnauthorized, FEDERATION_CALLBACK_ROUTE, err)
+		return
+	}
+	s.completeFederatedLogin(w, r, provider, login, profile, FEDERATION_CALLBACK_ROUTE)
+}
+
+// HandleSAMLAssertionConsumer completes a login at an upstream SAML identity
+// provider, which posts its response here with the HTTP-POST binding.
+func (s *Server) HandleSAMLAssertionConsumer(w http.ResponseWriter, r *http.Request) {
+	service := s.federationService()
+	provider, err := service.GetProvider(mux.Vars(r)["id"])
+	if err != nil || provider.Type != models.IDENTITY_PROVIDER_TYPE_SAML {
+		s.HandleError(w, http.StatusNotFound, SAML_ACS_ROUTE, services.ErrIdentityProviderNotFound)
+		return
+	}
+	err = r.ParseForm()
+	if err != nil {
+		s.HandleError(w, http.StatusBadRequest, SAML_ACS_ROUTE, err)
+		return
+	}
+	login, err := service.FinishLogin(provider, r.PostForm.Get("RelayState"))
+	if err != nil {
+		s.HandleError(w, federationErrorStatus(err), SAML_ACS_ROUTE, err)
+		return
+	}
+	sp, err := s.samlServiceProvider(provider)
+	if err != nil {
+		s.HandleError(w, http.StatusBadGateway, SAML_ACS_ROUTE, err)
+		return
+	}
+	profile, err := s.samlFederationService().ParseResponse(provider, sp, login, r)
+	if err != nil {
+		s.HandleError(w, http.StatusUnauthorized, SAML_ACS_ROUTE, err)
+		return
+	}
+	s.completeFederatedLogin(w, r, provider, login, profile, SAML_ACS_ROUTE)
+}
+
+// HandleSAMLServiceProviderMetadata returns the metadata of the service
+// provider the server acts as towards an upstream SAML identity provider, for
+// the identity provider to import.
+func (s *Server) HandleSAMLServiceProviderMetadata(w http.ResponseWriter, r *http.Request) {
+	provider, err := s.federationService().GetProvider(mux.Vars(r)["id"])
+	if err != nil || provider.Type != models.IDENTITY_PROVIDER_TYPE_SAML {
+		s.HandleError(w, http.StatusNotFound, SAML_METADATA_ROUTE, services.ErrIdentityProviderNotFound)
+		return
+	}
+	sp, err := s.samlServiceProvider(provider)
+	if err != nil {
+		s.HandleError(w, http.StatusBadGateway, SAML_METADATA_ROUTE, err)
+		return
+	}
+	response, err := xml.MarshalIndent(sp.Metadata(), "", "  ")
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, SAML_METADATA_ROUTE, err)
+		return
+	}
+
+	w.Header().Set(CONTENT_TYPE, SAML_METADATA_CONTENT_TYPE)
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// completeFederatedLogin logs in the user the identity provider authenticated,
+// starting a login session in their browser as HandleLogin does, and sends
+// them back to where the login started. Logins started without return_to are
+// answered with the session.
+func (s *Server) completeFederatedLogin(w http.ResponseWriter, r *http.Request, provider *models.IdentityProvider, login *models.FederatedLogin, profile *models.ExternalProfile, route string) {
+	user, err := s.federationService().ResolveUser(provider, profile)
+	if err != nil {
+		s.auditAs(r, profile.Subject, models.AUDIT_ACTION_LOGIN, profile.Username, err, nil, nil)
+		s.metrics.recordLogin(models.AUTH_METHOD_FEDERATED, err)
+		s.HandleError(w, federationErrorStatus(err), route, err)
+		return
+	}
+
+	service := s.sessionService()
+	if previous, err := s.currentSession(r); err == nil && previous != nil {
+		_, err = service.TerminateSession(previous.ID.String())
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, route, err)
+			return
+		}
+		s.notifyLogout(previous)
+	}
+	session, token, err := service.CreateSession(user, clientIP(r), r.UserAgent(), []string{models.AUTH_METHOD_FEDERATED})
+	s.auditAs(r, user.ID.String(), models.AUDIT_ACTION_LOGIN, user.ID.String(), err, nil, nil)
+	s.metrics.recordLogin(models.AUTH_METHOD_FEDERATED, err)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, route, err)
+		return
+	}
+	s.setSessionCookie(w, token, session.ExpiresAt)
+
+	if login.ReturnTo != "" {
+		http.Redirect(w, r, login.ReturnTo, http.StatusSeeOther)
+		return
+	}
+	response, err := json.Marshal(mapper.SessionToSessionDto(session))
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, route, err)
+		return
+	}
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// HandleIdentityProvider handles the creation and retrieval of upstream
+// identity providers. When called via POST, it creates a new identity
+// provider. When called via GET, it retrieves all identity providers.
+func (s *Server) HandleIdentityProvider(w http.ResponseWriter, r *http.Request) {
+	service := s.identityProviderService()
+	var response []byte
+
+	switch r.Method {
+	case http.MethodGet:
+		result, err := service.GetAll()
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_IDENTITY_PROVIDER_ROUTE, err)
+			return
+		}
+		response, err = json.Marshal(result)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_IDENTITY_PROVIDER_ROUTE, err)
+			return
+		}
+	case http.MethodPost:
+		var providerRequest models.IdentityProviderRequest
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&providerRequest)
+		if err != nil {
+			s.HandleError(w, http.StatusBadRequest, ADMIN_IDENTITY_PROVIDER_ROUTE, err)
+			return
+		}
+		result, err := service.CreateIdentityProvider(&providerRequest)
+		s.audit(r, models.AUDIT_ACTION_IDENTITY_PROVIDER_CREATE, providerRequest.Name, err, nil, result)
+		if errors.Is(err, services.ErrInvalidIdentityProvider) {
+			s.HandleError(w, http.StatusBadRequest, ADMIN_IDENTITY_PROVIDER_ROUTE, err)
+			return
+		}
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_IDENTITY_PROVIDER_ROUTE, err)
+			return
+		}
+		response, err = json.Marshal(result)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_IDENTITY_PROVIDER_ROUTE, err)
+			return
+		}
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// HandleIdentityProviderDetails handles the retrieval, update and deletion of
+// an upstream identity provider. Deleting it unlinks its users, who are kept.
+func (s *Server) HandleIdentityProviderDetails(w http.ResponseWriter, r *http.Request) {
+	service := s.identityProviderService()
+	var response []byte
+
+	provider, err := service.GetIdentityProviderById(mux.Vars(r)["id"])
+	if err != nil {
+		s.HandleError(w, http.StatusNotFound, ADMIN_IDENTITY_PROVIDER_DETAILS_ROUTE, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		response, err = json.Marshal(mapper.IdentityProviderToIdentityProviderDto(provider))
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_IDENTITY_PROVIDER_DETAILS_ROUTE, err)
+			return
+		}
+	case http.MethodPut:
+		var providerRequest models.IdentityProviderRequest
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&providerRequest)
+		if err != nil {
+			s.HandleError(w, http.StatusBadRequest, ADMIN_IDENTITY_PROVIDER_DETAILS_ROUTE, err)
+			return
+		}
+		before := mapper.IdentityProviderToIdentityProviderDto(provider)
+		result, err := service.UpdateIdentityProvider(provider, &providerRequest)
+		s.audit(r, models.AUDIT_ACTION_IDENTITY_PROVIDER_UPDATE, provider.ID.String(), err, before, result)
+		if errors.Is(err, services.ErrInvalidIdentityProvider) {
+			s.HandleError(w, http.StatusBadRequest, ADMIN_IDENTITY_PROVIDER_DETAILS_ROUTE, err)
+			return
+		}
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_IDENTITY_PROVIDER_DETAILS_ROUTE, err)
+			return
+		}
+		response, err = json.Marshal(result)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_IDENTITY_PROVIDER_DETAILS_ROUTE, err)
+			return
+		}
+	case http.MethodDelete:
+		err := service.DeleteIdentityProvider(provider)
+		s.audit(r, models.AUDIT_ACTION_IDENTITY_PROVIDER_DELETE, provider.ID.String(), err, mapper.IdentityProviderToIdentityProviderDto(provider), nil)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_IDENTITY_PROVIDER_DETAILS_ROUTE, err)
+			return
+		}
+		status := s.getStatusCode(r.Method)
+		w.WriteHeader(status)
+		return
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// HandleAdminUserIdentities lists the external identities linked to a user.
+func (s *Server) HandleAdminUserIdentities(w http.ResponseWriter, r *http.Request) {
+	user, err := s.adminUser(mux.Vars(r)["username"])
+	if err != nil {
+		s.HandleError(w, errorStatus(err), ADMIN_USER_IDENTITIES_ROUTE, err)
+		return
+	}
+	result, err := s.federationService().GetUserIdentities(user)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, ADMIN_USER_IDENTITIES_ROUTE, err)
+		return
+	}
+	response, err := json.Marshal(result)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, ADMIN_USER_IDENTITIES_ROUTE, err)
+		return
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// HandleAdminUserIdentityDetails unlinks an external identity from a user. The
+// user is provisioned again, or linked by email, on their next login with the
+// identity provider.
+func (s *Server) HandleAdminUserIdentityDetails(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	user, err := s.adminUser(vars["username"])
+	if err != nil {
+		s.HandleError(w, errorStatus(err), ADMIN_USER_IDENTITY_DETAILS_ROUTE, err)
+		return
+	}
+	err = s.federationService().UnlinkUserIdentity(user, vars["id"])
+	s.audit(r, models.AUDIT_ACTION_USER_IDENTITY_UNLINK, user.Username, err, nil, nil)
+	if errors.Is(err, services.ErrExternalIdentityNotFound) {
+
+		s.HandleError(w, http.StatusNotFound, ADMIN_USER_IDENTITY_DETAILS_ROUTE, err)
+		return
+	}
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, ADMIN_USER_IDENTITY_DETAILS_ROUTE, err)
+		return
+	}
+
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+}
+
+// adminUser returns the user with the given username, or a 404 status error.
+func (s *Server) adminUser(username string) (*models.User, error) {
+	repo := s.userRepository.(*repository.UserRepository)
+	user, err := services.NewUserService(repo).GetByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, newStatusError(http.StatusNotFound, errors.New("user not found"))
+	}
+	return user, nil
+}
+
+// federationURI returns the URI of one of the federation endpoints of the
+// identity provider, such as its callback.
+func (s *Server) federationURI(provider *models.IdentityProvider, endpoint string) string {
+	return s.config.Issuer + "/oauth2/federation/" + provider.ID.String() + "/" + endpoint
+}
+
+// samlServiceProvider returns the service provider the server acts as towards
+// the SAML identity provider.
+func (s *Server) samlServiceProvider(provider *models.IdentityProvider) (*saml.ServiceProvider, error) {
+	return s.samlFederationService().ServiceProvider(provider, s.federationURI(provider, "metadata"), s.federationURI(provider, "acs"))
+}
+
+// federationErrorStatus returns 401 for logins the identity provider's
+// response does not allow, and 500 otherwise.
+func federationErrorStatus(err error) int {
+	if errors.Is(err, services.ErrFederatedLoginFailed) {
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
+
+// isLocalPath returns true if the URI is an absolute path on this server.
+// Scheme-relative URIs such as "//example.com" are rejected.
+func isLocalPath(uri string) bool {
+	return strings.HasPrefix(uri, "/") && !strings.HasPrefix(uri, "//") && !strings.HasPrefix(uri, "/\\")
+}
+
+func (s *Server) federationService() *services.FederationService {
+	return services.NewFederationService(
+		s.identityProviderRepository.(*repository.IdentityProviderRepository),
+		s.externalIdentityRepository.(*repository.ExternalIdentityRepository),
+		s.federatedLoginRepository.(*repository.FederatedLoginRepository),
+		s.userRepository.(*repository.UserRepository),
+	)
+}
+
+func (s *Server) identityProviderService() *services.IdentityProviderService {
+	return services.NewIdentityProviderService(
+		s.identityProviderRepository.(*repository.IdentityProviderRepository),
+		s.roleRepository.(*repository.RoleRepository),
+	)
+}
+
+func (s *Server) oidcFederationService() *services.OIDCFederationService {
+	return services.NewOIDCFederationService(&http.Client{Timeout: FEDERATION_HTTP_TIMEOUT}, s.openIDProviderCache, s.keySetCache)
+}
+
+func (s *Server) samlFederationService() *services.SAMLFederationService {
+	return services.NewSAMLFederationService(&http.Client{Timeout: FEDERATION_HTTP_TIMEOUT}, s.samlMetadataCache, s.samlKey, s.samlCertificate)
+}
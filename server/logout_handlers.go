@@ -0,0 +1,252 @@
+package server
+
+import (
+	"auth-server/mapper"
+	"auth-server/models"
+	"auth-server/services"
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+)
+
+// frontChannelLogoutPage loads the front-channel logout URI of every client
+// that took part in the session in hidden iframes, then sends the user to the
+// post-logout redirect URI, if any.
+var frontChannelLogoutPage = template.Must(template.New("logout").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Logged out</title>
+{{if .RedirectURI}}<meta http-equiv="refresh" content="2;url={{.RedirectURI}}">{{end}}
+</head>
+<body>
+<p>You have been logged out.</p>
+{{range .FrontChannelURIs}}<iframe src="{{.}}" style="display:none"></iframe>
+{{end}}</body>
+</html>
+`))
+
+// HandleLogout ends the user's login session, as described in OpenID Connect
+// RP-Initiated Logout. Clients send the user here with an id_token_hint, which
+// may have expired, holding a token they were issued for the user, or with
+// their client_id. The user is sent back to the post_logout_redirect_uri when
+// the client registered it.
+//
+// Requests without a valid id_token_hint could be made by any site, so the
+// user is asked to confirm them: the logout prompt is returned, and the
+// session only ends once the same request is posted along with the challenge
+// returned with the prompt.
+//
+// The clients that took part in the session are notified: those registered
+// for back-channel logout are sent a logout token, and those registered for
+// front-channel logout are loaded in the user's browser.
+func (s *Server) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		s.HandleOAuthError(w, LOGOUT_ROUTE, newOAuthError(http.StatusBadRequest, "invalid_request", err.Error()))
+		return
+	}
+	logoutRequest := models.LogoutRequest{
+		ClientId:              r.Form.Get("client_id"),
+		PostLogoutRedirectURI: r.Form.Get("post_logout_redirect_uri"),
+		State:                 r.Form.Get("state"),
+	}
+	clientId := logoutRequest.ClientId
+	redirectURI := logoutRequest.PostLogoutRedirectURI
+
+	session, err := s.currentSession(r)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, LOGOUT_ROUTE, err)
+		return
+	}
+	confirmed := false
+	if idTokenHint := r.Form.Get("id_token_hint"); idTokenHint != "" {
+		hint, err := s.verifyTokenSignature(idTokenHint)
+		if err != nil {
+			s.HandleOAuthError(w, LOGOUT_ROUTE, newOAuthError(http.StatusBadRequest, "invalid_request", "invalid id_token_hint"))
+			return
+		}
+		hintClientId, _ := hint.Claim("client_id")
+		if hintClientId, ok := hintClientId.(string); ok && hintClientId != "" {
+			if clientId != "" && clientId != hintClientId {
+				s.HandleOAuthError(w, LOGOUT_ROUTE, newOAuthError(http.StatusBadRequest, "invalid_request", "client_id does not match the id_token_hint"))
+				return
+			}
+			clientId = hintClientId
+		}
+		// The browser may hold the session of another user than the one the
+		// client asks to log out, in which case it is left alone.
+		if session != nil && session.UserID.String() != hint.Sub {
+			session = nil
+		}
+		confirmed = true
+	}
+
+	var client *models.Client
+	if clientId != "" {
+		client, err = s.clientRepository.FindById(context.Background(), clientId)
+		if err != nil {
+			s.HandleOAuthError(w, LOGOUT_ROUTE, newOAuthError(http.StatusBadRequest, "invalid_request", "unknown client"))
+			return
+		}
+	}
+	if redirectURI != "" && (client == nil || !client.PostLogoutRedirectURIs.Contains(redirectURI)) {
+		s.HandleOAuthError(w, LOGOUT_ROUTE, newOAuthError(http.StatusBadRequest, "invalid_request", "invalid post_logout_redirect_uri"))
+		return
+	}
+	if session != nil && !confirmed {
+		challenge := r.Form.Get("challenge")
+		if r.Method != http.MethodPost || challenge == "" {
+			s.writeLogoutPrompt(w, session, client, &logoutRequest)
+			return
+		}
+		err = s.logoutChallengeService().Redeem(challenge, session, &logoutRequest)
+		if errors.Is(err, services.ErrInvalidLogoutChallenge) {
+			s.HandleOAuthError(w, LOGOUT_ROUTE, newOAuthError(http.StatusForbidden, "invalid_request", err.Error()))
+			return
+		}
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, LOGOUT_ROUTE, err)
+			return
+		}
+	}
+
+	var frontChannelURIs []string
+	if session != nil {
+		_, err = s.sessionService().TerminateSession(session.ID.String())
+		s.auditAs(r, session.UserID.String(), models.AUDIT_ACTION_LOGOUT, session.ID.String(), err, nil, nil)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, LOGOUT_ROUTE, err)
+			return
+		}
+		frontChannelURIs = s.notifyLogout(session)
+	}
+	s.clearSessionCookie(w)
+
+	location := ""
+	if redirectURI != "" {
+		location = logoutRedirectURI(redirectURI, logoutRequest.State)
+	}
+	if len(frontChannelURIs) > 0 {
+		w.Header().Set(CONTENT_TYPE, "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		err = frontChannelLogoutPage.Execute(w, struct {
+			RedirectURI      string
+			FrontChannelURIs []string
+		}{location, frontChannelURIs})
+		if err != nil {
+			s.requestLogger(r).WithError(err).Error("rendering the front-channel logout page")
+		}
+		return
+	}
+	if location != "" {
+		status := redirectStatus(r.Method)
+		http.Redirect(w, r, location, status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeLogoutPrompt asks the user of the session to confirm the logout request,
+// with a challenge the confirmation must carry back.
+func (s *Server) writeLogoutPrompt(w http.ResponseWriter, session *models.Session, client *models.Client, request *models.LogoutRequest) {
+	challenge, err := s.logoutChallengeService().Issue(session, request)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, LOGOUT_ROUTE, err)
+		return
+	}
+	prompt := models.LogoutPromptDto{Challenge: challenge}
+	if client != nil {
+		prompt.Client = mapper.ClientToClientDto(client)
+	}
+	response, err := json.Marshal(prompt)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, LOGOUT_ROUTE, err)
+		return
+	}
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+func (s *Server) logoutChallengeService() *services.LogoutChallengeService {
+	return services.NewLogoutChallengeService(s.logoutReplayCache, s.config.Secret)
+}
+
+// logoutRedirectURI adds the state of the logout request, if any, to the
+// post-logout redirect URI.
+func logoutRedirectURI(redirectURI string, state string) string {
+	if state == "" {
+		return redirectURI
+	}
+	location, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+	query := location.Query()
+	query.Set("state", state)
+	location.RawQuery = query.Encode()
+	return location.String()
+}
+
+// notifyLogout tells the clients that took part in the session that it ended.
+// Logout tokens are sent in the background to the clients registered for
+// back-channel logout, and the front-channel logout URIs of the other clients
+// are returned, for the user's browser to load.
+func (s *Server) notifyLogout(session *models.Session) []string {
+	service := services.NewBackChannelLogoutService(
+		&http.Client{Timeout: BACKCHANNEL_LOGOUT_TIMEOUT}, BACKCHANNEL_LOGOUT_ATTEMPTS, BACKCHANNEL_LOGOUT_BACKOFF,
+	)
+	var frontChannelURIs []string
+	for _, clientId := range session.ClientIDs {
+		client, err := s.clientRepository.FindById(context.Background(), clientId)
+		if err != nil {
+			continue
+		}
+		sid := ""
+		if client.LogoutSessionRequired {
+			sid = session.ID.String()
+		}
+		if client.BackchannelLogoutURI != "" {
+			payload := models.NewLogoutToken(session.UserID.String(), sid, client.ID.String(), LOGOUT_TOKEN_LIFETIME)
+			jwt, err := s.newJwt(payload, models.LOGOUT_TOKEN_TYPE)
+			if err != nil {
+				s.logger.WithError(err).Error("signing logout token")
+				continue
+			}
+			logoutToken, _ := jwt.Token()
+			go func(uri string) {
+				if err := service.Deliver(uri, logoutToken); err != nil {
+					s.logger.WithError(err).WithField("uri", uri).Warn("delivering back-channel logout")
+				}
+			}(client.BackchannelLogoutURI)
+		}
+		if client.FrontchannelLogoutURI != "" {
+			frontChannelURIs = append(frontChannelURIs, frontChannelLogoutURI(client.FrontchannelLogoutURI, s.config.Issuer, sid))
+		}
+	}
+	return frontChannelURIs
+}
+
+// frontChannelLogoutURI adds the issuer and session id to the front-channel
+// logout URI of a client that needs them, see OpenID Connect Front-Channel
+// Logout, section 2.
+func frontChannelLogoutURI(uri string, issuer string, sid string) string {
+	if sid == "" {
+		return uri
+	}
+	location, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	query := location.Query()
+	query.Set("iss", issuer)
+	query.Set("sid", sid)
+	location.RawQuery = query.Encode()
+	return location.String()
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"auth-server/cache"
+	"auth-server/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestHandleLogout(t *testing.T) {
+	user := newTestUser("alice")
+	client := &models.Client{
+		BaseUUIDEntity:         models.BaseUUIDEntity{ID: uuid.New()},
+		ClientName:             "app",
+		PostLogoutRedirectURIs: models.StringList{"https://app.example.com/logged-out"},
+	}
+
+	// prompt asks for the logout prompt of the query, and returns its challenge.
+	prompt := func(t *testing.T, s *Server, query url.Values) string {
+		w := httptest.NewRecorder()
+		s.HandleLogout(w, newLogoutRequest(http.MethodGet, query))
+		if w.Code != http.StatusOK {
+			t.Fatalf("prompt status = %d: %s", w.Code, w.Body)
+		}
+		var logoutPrompt models.LogoutPromptDto
+		err := json.Unmarshal(w.Body.Bytes(), &logoutPrompt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return logoutPrompt.Challenge
+	}
+	confirm := func(query url.Values, challenge string) *http.Request {
+		form := url.Values{"challenge": {challenge}}
+		for key, values := range query {
+			form[key] = values
+		}
+		return newLogoutRequest(http.MethodPost, form)
+	}
+	hintOf := func(t *testing.T, s *Server, sub string) url.Values {
+		return url.Values{"id_token_hint": {newTestToken(t, s, func(p *models.Payload) {
+			p.Sub = sub
+			p.Exp = time.Now().Add(-time.Hour).Unix()
+		})}}
+	}
+	withClient := url.Values{
+		"client_id":                {client.ID.String()},
+		"post_logout_redirect_uri": {"https://app.example.com/logged-out"},
+		"state":                    {"xyz"},
+	}
+
+	tests := []struct {
+		name       string
+		noSession  bool
+		request    func(t *testing.T, s *Server) *http.Request
+		status     int
+		terminated bool
+	}{
+		{"no id_token_hint", false, func(t *testing.T, s *Server) *http.Request {
+			return newLogoutRequest(http.MethodGet, nil)
+		}, http.StatusOK, false},
+		{"client_id without id_token_hint", false, func(t *testing.T, s *Server) *http.Request {
+			return newLogoutRequest(http.MethodGet, withClient)
+		}, http.StatusOK, false},
+		{"post without challenge", false, func(t *testing.T, s *Server) *http.Request {
+			return newLogoutRequest(http.MethodPost, nil)
+		}, http.StatusOK, false},
+		{"confirmed", false, func(t *testing.T, s *Server) *http.Request {
+			return confirm(nil, prompt(t, s, nil))
+		}, http.StatusNoContent, true},
+		{"confirmed with a redirect", false, func(t *testing.T, s *Server) *http.Request {
+			return confirm(withClient, prompt(t, s, withClient))
+		}, http.StatusSeeOther, true},
+		{"confirmed with the challenge of another request", false, func(t *testing.T, s *Server) *http.Request {
+			return confirm(withClient, prompt(t, s, nil))
+		}, http.StatusForbidden, false},
+		{"forged challenge", false, func(t *testing.T, s *Server) *http.Request {
+			return confirm(nil, "forged")
+		}, http.StatusForbidden, false},
+		{"challenge sent with GET", false, func(t *testing.T, s *Server) *http.Request {
+			return newLogoutRequest(http.MethodGet, url.Values{"challenge": {prompt(t, s, nil)}})
+		}, http.StatusOK, false},
+		{"replayed challenge", false, func(t *testing.T, s *Server) *http.Request {
+			challenge := prompt(t, s, nil)
+			s.HandleLogout(httptest.NewRecorder(), confirm(nil, challenge))
+			return confirm(nil, challenge)
+		}, http.StatusForbidden, true},
+		{"expired id_token_hint of the user", false, func(t *testing.T, s *Server) *http.Request {
+			return newLogoutRequest(http.MethodGet, hintOf(t, s, user.ID.String()))
+		}, http.StatusNoContent, true},
+		{"id_token_hint of another user", false, func(t *testing.T, s *Server) *http.Request {
+			return newLogoutRequest(http.MethodGet, hintOf(t, s, uuid.NewString()))
+		}, http.StatusNoContent, false},
+		{"invalid id_token_hint", false, func(t *testing.T, s *Server) *http.Request {
+			return newLogoutRequest(http.MethodGet, url.Values{"id_token_hint": {"invalid"}})
+		}, http.StatusBadRequest, false},
+		{"no session", true, func(t *testing.T, s *Server) *http.Request {
+			return newLogoutRequest(http.MethodGet, nil)
+		}, http.StatusNoContent, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, db := newDatabaseTestServer(t)
+			s.config.SessionIdleTimeout = time.Hour
+			s.logoutReplayCache = cache.NewReplayCache()
+			if !tt.noSession {
+				session := &models.Session{
+					BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()},
+					UserID:         user.ID,
+					LastSeenAt:     time.Now(),
+					ExpiresAt:      time.Now().Add(time.Hour),
+				}
+				db.Return(`FROM "sessions"`, session)
+			}
+			db.Return(`FROM "users"`, user)
+			db.Return(`FROM "clients"`, client)
+			r := tt.request(t, s)
+			w := httptest.NewRecorder()
+			s.HandleLogout(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			terminated := false
+			for _, statement := range db.Statements() {
+				terminated = terminated || strings.HasPrefix(statement, `DELETE FROM "sessions"`)
+			}
+			if terminated != tt.terminated {
+				t.Errorf("terminated = %t, want %t", terminated, tt.terminated)
+			}
+		})
+	}
+}
+
+// newLogoutRequest returns a logout request of the browser holding a session
+// cookie, sending the parameters in the query or in a form.
+func newLogoutRequest(method string, params url.Values) *http.Request {
+	var r *http.Request
+	if method == http.MethodGet {
+		r = httptest.NewRequest(method, LOGOUT_ROUTE+"?"+params.Encode(), nil)
+	} else {
+		r = httptest.NewRequest(method, LOGOUT_ROUTE, strings.NewReader(params.Encode()))
+		r.Header.Set(CONTENT_TYPE, "application/x-www-form-urlencoded")
+	}
+	r.AddCookie(&http.Cookie{Name: SESSION_COOKIE, Value: "session"})
+	return r
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"auth-server/models"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// passwordHashBuckets are the buckets of the password hashing histogram, in
+// seconds, around the time a PBKDF2 hash with a few hundred thousand
+// iterations takes.
+var passwordHashBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+// serverMetrics are the Prometheus metrics of the server, shared by all
+// realms. They are kept in a registry of their own rather than the global
+// one, so that every server exposes its metrics only.
+type serverMetrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	tokensIssued    *prometheus.CounterVec
+	logins          *prometheus.CounterVec
+	passwordHashing *prometheus.HistogramVec
+}
+
+// newServerMetrics registers the metrics of the server, along with the Go
+// runtime and process metrics and the statistics of the database pool.
+func newServerMetrics(db *sql.DB) *serverMetrics {
+	m := &serverMetrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests handled, by route, method and status.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to handle HTTP requests, by route and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		tokensIssued: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "tokens_issued_total",
+			Help:      "Number of tokens issued, by grant type and client; clients registered dynamically are counted as \"other\".",
+		}, []string{"grant_type", "client_id"}),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "logins_total",
+			Help:      "Number of user logins, by authentication method and outcome.",
+		}, []string{"method", "outcome"}),
+		passwordHashing: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: METRICS_NAMESPACE,
+			Name:      "password_hash_duration_seconds",
+			Help:      "Time taken to hash passwords and to compare them with their hashes.",
+			Buckets:   passwordHashBuckets,
+		}, []string{"operation"}),
+	}
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.tokensIssued,
+		m.logins,
+		m.passwordHashing,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewDBStatsCollector(db, METRICS_DATABASE_NAME),
+	)
+	return m
+}
+
+// handler returns the handler exposing the metrics to Prometheus.
+func (m *serverMetrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// observePasswordHashing records how long a password hashing operation took.
+func (m *serverMetrics) observePasswordHashing(operation string, duration time.Duration) {
+	m.passwordHashing.WithLabelValues(operation).Observe(duration.Seconds())
+}
+
+// recordLogin counts a login with the authentication method, which failed
+// unless err is nil.
+func (m *serverMetrics) recordLogin(method string, err error) {
+	outcome := models.AUDIT_OUTCOME_SUCCESS
+	if err != nil {
+		outcome = models.AUDIT_OUTCOME_FAILURE
+	}
+	m.logins.WithLabelValues(method, outcome).Inc()
+}
+
+// recordTokenIssued counts a token issued to the client with the grant type.
+func (m *serverMetrics) recordTokenIssued(grantType string, client *models.Client) {
+	m.tokensIssued.WithLabelValues(grantType, clientLabel(client)).Inc()
+}
+
+// clientLabel returns the client_id label of the metrics of the client. Only
+// first-party clients and clients created by administrators are labelled with
+// their id; anyone can register clients dynamically, so they are counted
+// together, lest they grow the metrics without bound.
+func clientLabel(client *models.Client) string {
+	if client == nil || (!client.FirstParty && client.RegistrationAccessTokenHash != "") {
+		return METRICS_OTHER_CLIENT
+	}
+	return client.ID.String()
+}
+
+// MetricsMiddleware is a middleware that counts requests and records how
+// long they took, labelled with the template of the route they matched, so
+// that requests for different users or clients are counted together.
+func (s *Server) MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		captured := httpsnoop.CaptureMetrics(next, w, r)
+		route := routeTemplate(r)
+		s.metrics.requests.WithLabelValues(route, r.Method, strconv.Itoa(captured.Code)).Inc()
+		s.metrics.requestDuration.WithLabelValues(route, r.Method).Observe(captured.Duration.Seconds())
+	})
+}
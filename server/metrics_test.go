@@ -0,0 +1,165 @@
+package server
+
+import (
+	"auth-server/hasher"
+	"auth-server/models"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// newTestMetrics returns the metrics of a server whose database is never
+// connected to.
+func newTestMetrics(t *testing.T) *serverMetrics {
+	db, err := sql.Open("pgx", "postgres://localhost/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return newServerMetrics(db)
+}
+
+func TestMetricsMiddlewareLabelsRouteTemplates(t *testing.T) {
+	s := newTestServer(t)
+	s.metrics = newTestMetrics(t)
+	router := mux.NewRouter()
+	router.Use(s.MetricsMiddleware)
+	router.HandleFunc(ADMIN_USER_DETAILS_ROUTE, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	router.HandleFunc(TOKEN_ROUTE, func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, path := range []string{"/admin/user/1/", "/admin/user/2/", TOKEN_ROUTE} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	expected := `
+		# HELP auth_server_http_requests_total Number of HTTP requests handled, by route, method and status.
+		# TYPE auth_server_http_requests_total counter
+		auth_server_http_requests_total{method="GET",route="` + ADMIN_USER_DETAILS_ROUTE + `",status="404"} 2
+		auth_server_http_requests_total{method="GET",route="` + TOKEN_ROUTE + `",status="200"} 1
+	`
+	err := testutil.GatherAndCompare(s.metrics.registry, strings.NewReader(expected), "auth_server_http_requests_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.CollectAndCount(s.metrics.requestDuration); n != 2 {
+		t.Fatalf("request durations recorded for %d routes, want 2", n)
+	}
+}
+
+func TestRecordLogin(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		err     error
+		outcome string
+	}{
+		{"password login", models.AUTH_METHOD_PASSWORD, nil, models.AUDIT_OUTCOME_SUCCESS},
+		{"failed password login", models.AUTH_METHOD_PASSWORD, errors.New("invalid username or password"), models.AUDIT_OUTCOME_FAILURE},
+		{"federated login", models.AUTH_METHOD_FEDERATED, nil, models.AUDIT_OUTCOME_SUCCESS},
+		{"failed federated login", models.AUTH_METHOD_FEDERATED, errors.New("federated login failed"), models.AUDIT_OUTCOME_FAILURE},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMetrics(t)
+			m.recordLogin(tt.method, tt.err)
+			m.recordLogin(tt.method, tt.err)
+			if n := testutil.ToFloat64(m.logins.WithLabelValues(tt.method, tt.outcome)); n != 2 {
+				t.Fatalf("%s logins with outcome %s = %v, want 2", tt.method, tt.outcome, n)
+			}
+			if n := testutil.CollectAndCount(m.logins); n != 1 {
+				t.Fatalf("logins recorded under %d label sets, want 1", n)
+			}
+		})
+	}
+}
+
+func TestRecordTokenIssued(t *testing.T) {
+	m := newTestMetrics(t)
+	admin := &models.Client{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}}
+	for i := 0; i < 3; i++ {
+		registered := &models.Client{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, RegistrationAccessTokenHash: "hash"}
+		m.recordTokenIssued(models.GRANT_TYPE_AUTHORIZATION_CODE, registered)
+	}
+	m.recordTokenIssued(models.GRANT_TYPE_AUTHORIZATION_CODE, admin)
+
+	if n := testutil.ToFloat64(m.tokensIssued.WithLabelValues(models.GRANT_TYPE_AUTHORIZATION_CODE, METRICS_OTHER_CLIENT)); n != 3 {
+		t.Fatalf("tokens issued to other clients = %v, want 3", n)
+	}
+	if n := testutil.ToFloat64(m.tokensIssued.WithLabelValues(models.GRANT_TYPE_AUTHORIZATION_CODE, admin.ID.String())); n != 1 {
+		t.Fatalf("tokens issued to the administered client = %v, want 1", n)
+	}
+	if n := testutil.CollectAndCount(m.tokensIssued); n != 2 {
+		t.Fatalf("tokens issued recorded under %d label sets, want 2", n)
+	}
+}
+
+func TestTimedHasherObservesPasswordHashing(t *testing.T) {
+	m := newTestMetrics(t)
+	h := hasher.NewTimedHasher(hasher.NewPBKDF2Hasher(1, []byte("secret")), m.observePasswordHashing)
+	hash, err := h.GenerateFromPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.CompareHashAndPassword(hash, "password")
+	h.CompareHashAndPassword(hash, "wrong")
+
+	families, err := m.registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]uint64)
+	for _, family := range families {
+		if family.GetName() != "auth_server_password_hash_duration_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "operation" {
+					counts[label.GetValue()] = metric.GetHistogram().GetSampleCount()
+				}
+			}
+		}
+	}
+	tests := []struct {
+		operation string
+		count     uint64
+	}{
+		{hasher.OPERATION_GENERATE, 1},
+		{hasher.OPERATION_COMPARE, 2},
+	}
+	for _, tt := range tests {
+		if counts[tt.operation] != tt.count {
+			t.Errorf("%s observations = %d, want %d", tt.operation, counts[tt.operation], tt.count)
+		}
+	}
+}
+
+func TestClientLabel(t *testing.T) {
+	id := uuid.New()
+	tests := []struct {
+		name   string
+		client *models.Client
+		label  string
+	}{
+		{"created by an administrator", &models.Client{BaseUUIDEntity: models.BaseUUIDEntity{ID: id}}, id.String()},
+		{"first-party", &models.Client{BaseUUIDEntity: models.BaseUUIDEntity{ID: id}, FirstParty: true}, id.String()},
+		{"first-party registered dynamically", &models.Client{BaseUUIDEntity: models.BaseUUIDEntity{ID: id}, FirstParty: true, RegistrationAccessTokenHash: "hash"}, id.String()},
+		{"registered dynamically", &models.Client{BaseUUIDEntity: models.BaseUUIDEntity{ID: id}, RegistrationAccessTokenHash: "hash"}, METRICS_OTHER_CLIENT},
+		{"unknown", nil, METRICS_OTHER_CLIENT},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if label := clientLabel(tt.client); label != tt.label {
+				t.Fatalf("clientLabel() = %q, want %q", label, tt.label)
+			}
+		})
+	}
+}
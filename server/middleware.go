@@ -1,8 +1,15 @@
 package server
 
 import (
+	"auth-server/logger"
+	"auth-server/models"
+	"context"
 	"errors"
 	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 )
 
 // AuthMiddleware is a middleware that checks if the request is authenticated.
@@ -10,25 +17,142 @@ import (
 // If the request is not authenticated, the middleware will return a 401 Unauthorized response.
 //
 // The request is verified via the Authorization header.
-// This header must contain a JWT Bearer token, which is validated with the server itself.
+// This header must contain a JWT Bearer token, which is validated with the server itself,
+// or a DPoP-bound token along with a DPoP proof signed by the key the token is bound to.
 func (s *Server) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		auth := r.Header.Get("Authorization")
-		if auth == "" {
-			s.HandleError(w, http.StatusUnauthorized, "AuthMiddleware", errors.New("missing authorization header"))
+		scheme, token, err := authorizationCredentials(r)
+		if err != nil {
+			s.HandleError(w, http.StatusUnauthorized, "AuthMiddleware", err)
 			return
 		}
-		tokenType := auth[:6]
-		if tokenType != "Bearer" {
+		switch {
+		case strings.EqualFold(scheme, BEARER):
+			payload, err := s.ValidateToken(token)
+			if err == nil && isDPoPBound(payload) {
+				err = errDPoPBoundToken
+			}
+			if err != nil {
+				w.Header().Set(WWW_AUTHENTICATE, BEARER+` error="invalid_token"`)
+				s.HandleError(w, http.StatusUnauthorized, "AuthMiddleware", err)
+				return
+			}
+			r = withTokenPayload(r, payload)
+		case strings.EqualFold(scheme, DPOP):
+			payload, err := s.authenticateToken(w, r)
+			if err != nil {
+				s.HandleError(w, http.StatusUnauthorized, "AuthMiddleware", err)
+				return
+			}
+			r = withTokenPayload(r, payload)
+		default:
 			s.HandleError(w, http.StatusUnauthorized, "AuthMiddleware", errors.New("invalid token type"))
 			return
 		}
-		token := auth[7:]
-		if token == "" {
-			s.HandleError(w, http.StatusUnauthorized, "AuthMiddleware", errors.New("missing bearer token"))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SCIMAuthMiddleware is a middleware that checks if the request comes from a
+// provisioning client. The request must carry an access token granted the
+// SCIM scope to an enabled client registered with that scope, as obtained
+// with the client credentials grant. Failures are reported as SCIM errors.
+func (s *Server) SCIMAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, err := s.authenticateToken(w, r)
+		if err != nil {
+			s.HandleSCIMError(w, http.StatusUnauthorized, "", "SCIMAuthMiddleware", err)
+			return
+		}
+		if !containsString(payload.Scope, SCIM_SCOPE) {
+			s.HandleSCIMError(w, http.StatusForbidden, "", "SCIMAuthMiddleware", errors.New("the token was not granted the "+SCIM_SCOPE+" scope"))
+			return
+		}
+		client, err := s.clientRepository.FindById(context.Background(), payload.Sub)
+		if err != nil || client.Disabled || !containsString(strings.Fields(client.Scope), SCIM_SCOPE) {
+			s.HandleSCIMError(w, http.StatusForbidden, "", "SCIMAuthMiddleware", errors.New("the token was not issued to a provisioning client"))
+			return
+		}
+		next.ServeHTTP(w, withTokenPayload(r, payload))
+	})
+}
+
+// AdminMiddleware is a middleware that checks if the request comes from a
+// client administering the realm. The request must carry an access token
+// granted the admin scope to an enabled client registered with that scope by
+// an administrator, as obtained with the client credentials grant. It must
+// run after AuthMiddleware.
+func (s *Server) AdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload := tokenPayload(r)
+		if payload == nil || !containsString(payload.Scope, ADMIN_SCOPE) {
+			w.Header().Set(WWW_AUTHENTICATE, BEARER+` error="insufficient_scope", scope="`+ADMIN_SCOPE+`"`)
+			s.HandleError(w, http.StatusForbidden, "AdminMiddleware", errors.New("the token was not granted the "+ADMIN_SCOPE+" scope"))
+			return
+		}
+		client, err := s.clientRepository.FindById(r.Context(), payload.Sub)
+		if err != nil || client.Disabled || !containsString(strings.Fields(client.Scope), ADMIN_SCOPE) {
+			s.HandleError(w, http.StatusForbidden, "AdminMiddleware", errors.New("the token was not issued to an administration client"))
 			return
 		}
-		// TODO: Validate the token
 		next.ServeHTTP(w, r)
 	})
 }
+
+// RequestIDMiddleware is a middleware that identifies every request with the
+// id sent in the X-Request-ID header, or with a new one if none was sent, so
+// that its log entries and audit events can be correlated. The id is sent
+// back in the same header.
+func (s *Server) RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(X_REQUEST_ID)
+		if id == "" || len(id) > 128 {
+			id = uuid.New().String()
+		}
+		w.Header().Set(X_REQUEST_ID, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDContextKey{}, id)))
+	})
+}
+
+type requestIDContextKey struct{}
+
+type tokenPayloadContextKey struct{}
+
+// requestID returns the id of the request.
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// withTokenPayload returns a copy of the request carrying the payload of the
+// access token it was authenticated with.
+func withTokenPayload(r *http.Request, payload *models.Payload) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), tokenPayloadContextKey{}, payload))
+}
+
+// requestLogger returns the logger of the request, carrying its id, or the
+// server's logger if the request was not logged.
+func (s *Server) requestLogger(r *http.Request) *logger.Logger {
+	if requestLogger := logger.FromContext(r.Context()); requestLogger != nil {
+		return requestLogger
+	}
+	return s.logger
+}
+
+// tokenPayload returns the payload of the access token the request was
+// authenticated with by a middleware, if any.
+func tokenPayload(r *http.Request) *models.Payload {
+	payload, _ := r.Context().Value(tokenPayloadContextKey{}).(*models.Payload)
+	return payload
+}
+
+// routeTemplate returns the template of the route the request matched, such
+// as "/admin/user/{id}", or an empty string if it matched none.
+func routeTemplate(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return ""
+	}
+	template, _ := route.GetPathTemplate()
+	return template
+}
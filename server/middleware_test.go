@@ -0,0 +1,176 @@
+package server
+
+import (
+	"auth-server/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	s := newTestServer(t)
+	other := newTestServer(t)
+	other.tenant = &models.Tenant{Name: "other", SigningSecret: "other-secret"}
+
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+	}{
+		{"valid token", BEARER + " " + newTestToken(t, s), http.StatusOK},
+		{"missing header", "", http.StatusUnauthorized},
+		{"missing token", BEARER, http.StatusUnauthorized},
+		{"unknown scheme", "Basic " + newTestToken(t, s), http.StatusUnauthorized},
+		{"malformed token", BEARER + " garbage", http.StatusUnauthorized},
+		{"foreign signature", BEARER + " " + newTestToken(t, other), http.StatusUnauthorized},
+		{"token of another realm", BEARER + " " + newTestToken(t, newTestRealm(t, s, "acme")), http.StatusUnauthorized},
+		{"expired token", BEARER + " " + newTestToken(t, s, func(p *models.Payload) {
+			p.Exp = time.Now().Add(-time.Minute).Unix()
+		}), http.StatusUnauthorized},
+		{"DPoP-bound token", BEARER + " " + newTestToken(t, s, func(p *models.Payload) {
+			p.Cnf = &models.Confirmation{Jkt: "thumbprint"}
+		}), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var payload *models.Payload
+			handler := s.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				payload = tokenPayload(r)
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/admin/user/", nil)
+			if tt.authorization != "" {
+				r.Header.Set(AUTHORIZATION, tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status == http.StatusOK && payload == nil {
+				t.Error("the token payload was not passed to the handler")
+			}
+			if tt.status != http.StatusOK && payload != nil {
+				t.Error("the handler was called")
+			}
+			if tt.status == http.StatusUnauthorized && strings.HasPrefix(tt.authorization, BEARER+" ") {
+				if got := w.Header().Get(WWW_AUTHENTICATE); got != BEARER+` error="invalid_token"` {
+					t.Errorf("WWW-Authenticate = %q", got)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareOfRealm(t *testing.T) {
+	s := newTestServer(t)
+	acme := newTestRealm(t, s, "acme")
+	globex := newTestRealm(t, s, "globex")
+
+	tests := []struct {
+		name   string
+		issuer *Server
+		status int
+	}{
+		{"token of the realm", acme, http.StatusOK},
+		{"token of the default realm", s, http.StatusUnauthorized},
+		{"token of another realm", globex, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := acme.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			r := httptest.NewRequest(http.MethodGet, "/realms/acme/admin/user/", nil)
+			r.Header.Set(AUTHORIZATION, BEARER+" "+newTestToken(t, tt.issuer))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestAdminMiddleware(t *testing.T) {
+	s := newTestServer(t)
+	admin := &models.Client{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, Scope: ADMIN_SCOPE}
+	disabled := &models.Client{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, Scope: ADMIN_SCOPE, Disabled: true}
+	regular := &models.Client{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, Scope: "openid profile"}
+	s.clientRepository = fakeRepository[models.Client]{
+		admin.ID.String():    admin,
+		disabled.ID.String(): disabled,
+		regular.ID.String():  regular,
+	}
+
+	tests := []struct {
+		name    string
+		payload *models.Payload
+		status  int
+	}{
+		{"administration client", &models.Payload{Sub: admin.ID.String(), Scope: []string{ADMIN_SCOPE}}, http.StatusOK},
+		{"no token", nil, http.StatusForbidden},
+		{"token without the admin scope", &models.Payload{Sub: admin.ID.String(), Scope: []string{"openid"}}, http.StatusForbidden},
+		{"disabled client", &models.Payload{Sub: disabled.ID.String(), Scope: []string{ADMIN_SCOPE}}, http.StatusForbidden},
+		{"client not registered with the admin scope", &models.Payload{Sub: regular.ID.String(), Scope: []string{ADMIN_SCOPE}}, http.StatusForbidden},
+		{"user token", &models.Payload{Sub: uuid.NewString(), Scope: []string{ADMIN_SCOPE}}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			handler := s.AdminMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/admin/tenant/", nil)
+			if tt.payload != nil {
+				r = withTokenPayload(r, tt.payload)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if called != (tt.status == http.StatusOK) {
+				t.Errorf("handler called = %v", called)
+			}
+		})
+	}
+}
+
+func TestAdminRoutesRequireAdministrationClient(t *testing.T) {
+	s := newTestServer(t)
+	s.metrics = newTestMetrics(t)
+	s.clientRepository = fakeRepository[models.Client]{}
+	router := s.router()
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		options []func(*models.Payload)
+	}{
+		{"grant roles to oneself", http.MethodPost, "/admin/user/alice/roles/", nil},
+		{"list groups", http.MethodGet, "/admin/group/", nil},
+		{"terminate a session", http.MethodDelete, "/admin/session/" + uuid.NewString() + "/", nil},
+		{"list realms", http.MethodGet, "/admin/tenant/", nil},
+		{"user token claiming the admin scope", http.MethodGet, "/admin/user/", []func(*models.Payload){func(p *models.Payload) {
+			p.Scope = []string{ADMIN_SCOPE}
+		}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`[]`))
+			r.Header.Set(AUTHORIZATION, BEARER+" "+newTestToken(t, s, tt.options...))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusForbidden)
+			}
+		})
+	}
+}
@@ -1,66 +1,535 @@
 package server
 
 import (
+	"auth-server/mapper"
 	"auth-server/models"
+	"auth-server/repository"
+	"auth-server/services"
 	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 )
 
 func (s *Server) HandleToken(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
 	decoder := json.NewDecoder(r.Body)
 	var tokenRequest models.TokenRequest
 	err := decoder.Decode(&tokenRequest)
 	if err != nil {
 		s.HandleError(w, http.StatusBadRequest, TOKEN_ROUTE, err)
+		return
 	}
-	if tokenRequest.GrantType == "client_credentials" {
-		ctx := context.Background()
-		clientData, appData, err := s.FetchClientAndApplication(ctx, tokenRequest.ClientId, tokenRequest.Aud)
-		if err != nil {
-			s.HandleError(w, http.StatusInternalServerError, TOKEN_ROUTE, err)
-			return
+
+	var payload *models.Payload
+	var refreshToken string
+	var jkt string
+	client, err := s.authenticateClient(r, &tokenRequest)
+	if err == nil {
+		err = s.authorizeClient(r, client, tokenRequest.GrantType)
+	}
+	if err == nil {
+		jkt, err = s.verifyTokenRequestProof(w, r)
+	}
+	if err == nil {
+		payload, refreshToken, err = s.grant(r.Context(), client, &tokenRequest)
+	}
+	if err == nil {
+		err = s.bindToCertificate(r, client, payload)
+	}
+	if err != nil {
+		s.auditAs(r, tokenRequest.ClientId, models.AUDIT_ACTION_TOKEN_ISSUE, tokenRequest.Username, err, nil, nil)
+	}
+	var oauthErr *oauthError
+	if errors.As(err, &oauthErr) {
+		s.HandleOAuthError(w, TOKEN_ROUTE, oauthErr)
+		return
+	}
+	if err != nil {
+		s.HandleError(w, errorStatus(err), TOKEN_ROUTE, err)
+		return
+	}
+
+	if jkt != "" {
+		if payload.Cnf == nil {
+			payload.Cnf = &models.Confirmation{}
 		}
-		s.logger.WithField("clientData", clientData)
-		s.logger.WithField("appData", appData)
+		payload.Cnf.Jkt = jkt
+	}
+	jwt, err := s.newJwt(payload, "JWT")
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, TOKEN_ROUTE, err)
+		return
+	}
+	var tokenResponse models.TokenResponse
+	jwtToken, err := jwt.Token()
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, TOKEN_ROUTE, err)
+		return
+	}
+	// The token is only reported as issued once it was signed.
+	s.auditAs(r, tokenRequest.ClientId, models.AUDIT_ACTION_TOKEN_ISSUE, payload.Sub, nil, nil, payload)
+	s.metrics.recordTokenIssued(tokenRequest.GrantType, client)
+	s.webhookDispatcher().Publish(models.WEBHOOK_EVENT_TOKEN_ISSUED, mapper.PayloadToTokenEvent(payload, tokenRequest.ClientId, tokenRequest.GrantType))
+	tokenResponse.AccessToken = jwtToken
+	tokenResponse.RefreshToken = refreshToken
+	tokenResponse.TokenType = BEARER
+	if jkt != "" {
+		tokenResponse.TokenType = DPOP
+	}
+	if tokenRequest.GrantType == GRANT_TYPE_TOKEN_EXCHANGE {
+		tokenResponse.IssuedTokenType = TOKEN_TYPE_ACCESS_TOKEN
+	}
+	response, err := json.Marshal(tokenResponse)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, TOKEN_ROUTE, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
 
-		// if !clientData.HasAllowedScopes(tokenRequest.Scope, appData.AppName) {
-		// 	s.HandleError(w, http.StatusUnauthorized, TOKEN_ROUTE, errors.New("client does not have the requested scopes"))
-		// 	return
-		// }
+// grant builds the payload of the token requested with the grant type of the
+// request, and returns it along with the refresh token issued with it, if any.
+func (s *Server) grant(ctx context.Context, client *models.Client, tokenRequest *models.TokenRequest) (*models.Payload, string, error) {
+	var payload *models.Payload
+	var err error
+	switch tokenRequest.GrantType {
+	case GRANT_TYPE_AUTHORIZATION_CODE:
+		return s.authorizationCodeGrant(client, tokenRequest)
+	case GRANT_TYPE_REFRESH_TOKEN:
+		return s.refreshTokenGrant(client, tokenRequest)
+	case GRANT_TYPE_CLIENT_CREDENTIALS:
+		payload, err = s.clientCredentialsGrant(ctx, client, tokenRequest)
+	case GRANT_TYPE_PASSWORD:
+		payload, err = s.passwordGrant(ctx, client, tokenRequest)
+	case GRANT_TYPE_DEVICE_CODE:
+		payload, err = s.deviceCodeGrant(client, tokenRequest)
+	case GRANT_TYPE_TOKEN_EXCHANGE:
+		payload, err = s.tokenExchangeGrant(ctx, client, tokenRequest)
+	default:
+		err = newOAuthError(http.StatusBadRequest, "unsupported_grant_type", "")
+	}
+	return payload, "", err
+}
 
-		payload := models.NewPayload(clientData.ID.String(), appData.ID.String(), 1, tokenRequest.Scope)
-		jwt, err := models.NewJwt(payload, "JWT")
-		if err != nil {
-			s.HandleError(w, http.StatusInternalServerError, TOKEN_ROUTE, err)
-			return
+// authenticateClient authenticates the client making a token request. Clients
+// presenting a JWT assertion are authenticated with it, and the client_id of
+// the request is set to the subject of the assertion. Clients registered for
+// private_key_jwt authentication must present one, and clients registered for
+// mutual-TLS authentication must present their certificate in the handshake.
+// Clients using a secret send it either with HTTP Basic authentication or in
+// the request body, but never both.
+// It returns the authenticated client, or nil if the request names no client.
+func (s *Server) authenticateClient(r *http.Request, tokenRequest *models.TokenRequest) (*models.Client, error) {
+	ctx := r.Context()
+	basicId, basicSecret, basic := r.BasicAuth()
+	hasAssertion := tokenRequest.ClientAssertionType != "" || tokenRequest.ClientAssertion != ""
+	methods := 0
+	for _, used := range []bool{basic, tokenRequest.ClientSecret != "", hasAssertion} {
+		if used {
+			methods++
+		}
+	}
+	if methods > 1 {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "only one client authentication method may be used")
+	}
+	if basic {
+		clientId, idErr := url.QueryUnescape(basicId)
+		secret, secretErr := url.QueryUnescape(basicSecret)
+		if idErr != nil || secretErr != nil {
+			return nil, newOAuthError(http.StatusUnauthorized, "invalid_client", "malformed client credentials")
 		}
-		var tokenResponse models.TokenResponse
-		jwtToken, err := jwt.Token()
+		return s.authenticateWithSecret(ctx, tokenRequest, clientId, secret, models.CLIENT_AUTH_CLIENT_SECRET_BASIC)
+	}
+	if tokenRequest.ClientSecret != "" {
+		return s.authenticateWithSecret(ctx, tokenRequest, tokenRequest.ClientId, tokenRequest.ClientSecret, models.CLIENT_AUTH_CLIENT_SECRET_POST)
+	}
+
+	if !hasAssertion {
+		if tokenRequest.ClientId == "" {
+			return nil, nil
+		}
+		client, err := s.clientRepository.FindById(ctx, tokenRequest.ClientId)
 		if err != nil {
-			s.HandleError(w, http.StatusInternalServerError, TOKEN_ROUTE, err)
-			return
+			return nil, nil
+		}
+		switch client.TokenEndpointAuthMethod {
+		case models.CLIENT_AUTH_CLIENT_SECRET_BASIC, models.CLIENT_AUTH_CLIENT_SECRET_POST:
+			return nil, newOAuthError(http.StatusUnauthorized, "invalid_client", "the client must authenticate with its secret")
+		case models.CLIENT_AUTH_PRIVATE_KEY_JWT:
+			return nil, newOAuthError(http.StatusUnauthorized, "invalid_client", "the client must authenticate with a client assertion")
+		case models.CLIENT_AUTH_TLS_CLIENT_AUTH, models.CLIENT_AUTH_SELF_SIGNED_TLS_CLIENT_AUTH:
+			client, err = s.clientAuthenticationService().AuthenticateWithCertificate(tokenRequest.ClientId, peerCertificates(r), s.clientCAs)
+			if errors.Is(err, services.ErrInvalidClient) {
+				return nil, newOAuthError(http.StatusUnauthorized, "invalid_client", err.Error())
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		return client, nil
+	}
+
+	client, err := s.clientAuthenticationService().AuthenticateWithAssertion(
+		tokenRequest.ClientId, tokenRequest.ClientAssertionType, tokenRequest.ClientAssertion, s.tokenEndpointAudiences(),
+	)
+	if errors.Is(err, services.ErrInvalidClient) {
+		return nil, newOAuthError(http.StatusUnauthorized, "invalid_client", err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	tokenRequest.ClientId = client.ID.String()
+	return client, nil
+}
+
+// authenticateWithSecret authenticates a client with one of its active secrets,
+// sent with the given authentication method.
+func (s *Server) authenticateWithSecret(ctx context.Context, tokenRequest *models.TokenRequest, clientId string, secret string, method string) (*models.Client, error) {
+	if tokenRequest.ClientId != "" && tokenRequest.ClientId != clientId {
+		return nil, newOAuthError(http.StatusUnauthorized, "invalid_client", "client_id does not match the authenticated client")
+	}
+	client, err := s.clientRepository.FindById(ctx, clientId)
+	if err != nil {
+		return nil, newOAuthError(http.StatusUnauthorized, "invalid_client", "unknown client")
+	}
+	if client.TokenEndpointAuthMethod != method {
+		return nil, newOAuthError(http.StatusUnauthorized, "invalid_client", "the client does not authenticate with "+method)
+	}
+	err = s.clientSecretService().VerifySecret(ctx, client, secret)
+	if errors.Is(err, services.ErrInvalidClient) {
+		return nil, newOAuthError(http.StatusUnauthorized, "invalid_client", err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	tokenRequest.ClientId = client.ID.String()
+	return client, nil
+}
+
+func (s *Server) clientAuthenticationService() *services.ClientAuthenticationService {
+	repo := s.clientRepository.(*repository.ClientRepository)
+	return services.NewClientAuthenticationService(repo, s.assertionReplayCache, s.keySetCache, s.config.AllowFileJwks)
+}
+
+func (s *Server) clientSecretService() *services.ClientSecretService {
+	repo := s.clientSecretRepository.(*repository.ClientSecretRepository)
+	return services.NewClientSecretService(repo, s.hasher)
+}
+
+// authorizeClient checks that the client making a token request is known and
+// enabled, and that it may use the grant type. Browser requests must come from
+// one of the client's allowed origins, if it registered any.
+func (s *Server) authorizeClient(r *http.Request, client *models.Client, grantType string) error {
+	if client == nil {
+		return newOAuthError(http.StatusUnauthorized, "invalid_client", "unknown client")
+	}
+	if client.Disabled {
+		return newOAuthError(http.StatusUnauthorized, "invalid_client", "the client is disabled")
+	}
+	if !client.GrantTypes.Contains(grantType) {
+		return newOAuthError(http.StatusBadRequest, "unauthorized_client", "the client may not use this grant type")
+	}
+	origin := r.Header.Get(ORIGIN)
+	if origin != "" && len(client.AllowedOrigins) > 0 && !client.AllowedOrigins.Contains(origin) {
+		return newOAuthError(http.StatusForbidden, "invalid_request", "the origin is not allowed for this client")
+	}
+	return nil
+}
+
+// bindToCertificate binds the token to the certificate the client presented
+// in the TLS handshake when the client asked for certificate-bound tokens,
+// as described in RFC 8705, section 3.
+func (s *Server) bindToCertificate(r *http.Request, client *models.Client, payload *models.Payload) error {
+	if client == nil || !client.CertificateBoundTokens {
+		return nil
+	}
+	certs := peerCertificates(r)
+	if len(certs) == 0 {
+		return newOAuthError(http.StatusBadRequest, "invalid_request", "certificate-bound tokens require a client certificate")
+	}
+	if payload.Cnf == nil {
+		payload.Cnf = &models.Confirmation{}
+	}
+	payload.Cnf.X5tS256 = models.CertificateThumbprint(certs[0])
+	return nil
+}
+
+// tokenEndpointAudiences returns the values client assertions may use as
+// their audience: the issuer and the token endpoint URL.
+func (s *Server) tokenEndpointAudiences() []string {
+	tokenEndpoint := s.config.Issuer + OAUTH2_TOKEN_ROUTE
+	return []string{
+		s.config.Issuer,
+		s.config.Issuer + "/",
+		tokenEndpoint,
+		strings.TrimSuffix(tokenEndpoint, "/"),
+	}
+}
+
+// clientCredentialsGrant builds the payload of a token issued to a client
+// acting on its own behalf.
+func (s *Server) clientCredentialsGrant(ctx context.Context, client *models.Client, tokenRequest *models.TokenRequest) (*models.Payload, error) {
+	clientData, appData, err := s.FetchClientAndApplication(ctx, tokenRequest.ClientId, tokenRequest.Aud)
+	if err != nil {
+		return nil, newStatusError(http.StatusInternalServerError, err)
+	}
+
+	// if !clientData.HasAllowedScopes(tokenRequest.Scope, appData.AppName) {
+	// 	s.HandleError(w, http.StatusUnauthorized, TOKEN_ROUTE, errors.New("client does not have the requested scopes"))
+	// 	return
+	// }
+
+	return models.NewPayload(clientData.ID.String(), appData.ID.String(), client.AccessTokenTTL(), tokenRequest.Scope), nil
+}
+
+// passwordGrant authenticates the user with the provided credentials and
+// builds the payload of a token issued on their behalf. The payload carries
+// the roles and permissions the user holds in the audience application.
+func (s *Server) passwordGrant(ctx context.Context, client *models.Client, tokenRequest *models.TokenRequest) (*models.Payload, error) {
+	_, appData, err := s.FetchClientAndApplication(ctx, tokenRequest.ClientId, tokenRequest.Aud)
+	if err != nil {
+		return nil, newStatusError(http.StatusInternalServerError, err)
+	}
+
+	user, err := s.authenticateUser(ctx, tokenRequest.Username, tokenRequest.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := models.NewPayload(user.ID.String(), appData.ID.String(), client.AccessTokenTTL(), tokenRequest.Scope)
+	if err := s.addUserClaims(payload, user); err != nil {
+		return nil, newStatusError(http.StatusInternalServerError, err)
+	}
+	return payload, nil
+}
+
+// authenticateUser checks the user's credentials, and that their account is active.
+func (s *Server) authenticateUser(ctx context.Context, username string, password string) (*models.User, error) {
+	verifier, err := s.credentialVerifier()
+	if err != nil {
+		return nil, newStatusError(http.StatusInternalServerError, err)
+	}
+	user, err := verifier.VerifyCredentials(ctx, username, password)
+	if errors.Is(err, services.ErrInvalidCredentials) || errors.Is(err, services.ErrFederatedLoginFailed) {
+		return nil, newStatusError(http.StatusUnauthorized, err)
+	}
+	if errors.Is(err, services.ErrDirectoryUnavailable) {
+		return nil, newStatusError(http.StatusServiceUnavailable, err)
+	}
+	if err != nil {
+		return nil, newStatusError(http.StatusInternalServerError, err)
+	}
+	if !user.Enabled || !user.AccountNonLocked || !user.AccountNonExpired || !user.CredentialsNonExpired {
+		return nil, newStatusError(http.StatusUnauthorized, errors.New("user account is not active"))
+	}
+	return user, nil
+}
+
+// credentialVerifier returns the verifier of the passwords users log in with:
+// the ones stored with users, then those of the enabled LDAP directories.
+func (s *Server) credentialVerifier() (services.CredentialVerifier, error) {
+	users := s.userRepository.(*repository.UserRepository)
+	federation := s.federationService()
+	verifiers := services.ChainCredentialVerifier{services.NewLocalCredentialVerifier(users, s.hasher)}
+	directories, err := federation.GetDirectories()
+	if err != nil {
+		return nil, err
+	}
+	for _, directory := range directories {
+		verifiers = append(verifiers, services.NewLDAPCredentialVerifier(directory, federation, users, LDAP_TIMEOUT))
+	}
+	return verifiers, nil
+}
+
+// tokenExchangeGrant exchanges the subject token for a token the client can use
+// to call the requested audience on behalf of the token's subject, as described
+// in RFC 8693. The new token carries the same or narrower scopes, never outlives
+// the subject token, and records the client, or the subject of the actor token
+// if one is given, in its act claim. Clients may only exchange tokens for the
+// audiences they were allowed to. The subject must still be an active user, or
+// a client, and sender-constrained subject tokens are not exchanged, since the
+// new token would not be bound to the key or certificate they are bound to.
+func (s *Server) tokenExchangeGrant(ctx context.Context, client *models.Client, tokenRequest *models.TokenRequest) (*models.Payload, error) {
+	if tokenRequest.SubjectToken == "" {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "missing subject_token")
+	}
+	if !isExchangeableTokenType(tokenRequest.SubjectTokenType) {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "unsupported subject_token_type")
+	}
+	if tokenRequest.RequestedTokenType != "" && tokenRequest.RequestedTokenType != TOKEN_TYPE_ACCESS_TOKEN {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "unsupported requested_token_type")
+	}
+	audience := tokenRequest.Audience
+	if audience == "" {
+		audience = tokenRequest.Aud
+	}
+	if audience == "" {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "missing audience")
+	}
+
+	clientData, appData, err := s.FetchClientAndApplication(ctx, tokenRequest.ClientId, audience)
+	if err != nil {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", err.Error())
+	}
+	if !clientData.CanExchangeTo(appData.ID.String()) {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_target", "the client may not exchange tokens for this audience")
+	}
+
+	subject, err := s.ValidateToken(tokenRequest.SubjectToken)
+	if err != nil {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "invalid subject_token: "+err.Error())
+	}
+	if subject.Cnf != nil && (subject.Cnf.Jkt != "" || subject.Cnf.X5tS256 != "") {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "sender-constrained subject_token cannot be exchanged")
+	}
+
+	scope := subject.Scope
+	if tokenRequest.Scope != "" {
+		scope = strings.Fields(tokenRequest.Scope)
+		for _, requested := range scope {
+			if !containsString(subject.Scope, requested) {
+				return nil, newOAuthError(http.StatusBadRequest, "invalid_scope", "scope "+requested+" was not granted to the subject_token")
+			}
 		}
-		tokenResponse.AccessToken = jwtToken
-		tokenResponse.TokenType = "Bearer"
-		response, err := json.Marshal(tokenResponse)
+	}
+
+	actor := &models.Actor{Sub: clientData.ID.String(), Act: subject.Act}
+	if tokenRequest.ActorToken != "" {
+		if !isExchangeableTokenType(tokenRequest.ActorTokenType) {
+			return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "unsupported actor_token_type")
+		}
+		actorPayload, err := s.ValidateToken(tokenRequest.ActorToken)
 		if err != nil {
-			s.HandleError(w, http.StatusInternalServerError, TOKEN_ROUTE, err)
-			return
+			return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "invalid actor_token: "+err.Error())
 		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		w.Write(response)
-		s.logger.Info(http.StatusOK, TOKEN_ROUTE, start)
+		actor.Sub = actorPayload.Sub
+	}
+
+	payload := models.NewPayload(subject.Sub, appData.ID.String(), client.AccessTokenTTL(), strings.Join(scope, " "))
+	payload.Act = actor
+	if payload.Exp > subject.Exp {
+		payload.Exp = subject.Exp
+	}
+
+	// Tokens issued to a client for itself have no user behind them.
+	if _, err := s.clientRepository.FindById(ctx, subject.Sub); err == nil {
+		return payload, nil
+	}
+	user, err := s.activeUser(subject.Sub)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.addUserClaims(payload, user); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+func isExchangeableTokenType(tokenType string) bool {
+	return tokenType == TOKEN_TYPE_ACCESS_TOKEN || tokenType == TOKEN_TYPE_JWT
+}
+
+// addUserClaims adds the roles and permissions the user holds in the
+// payload's audience to the payload.
+func (s *Server) addUserClaims(payload *models.Payload, user *models.User) error {
+	claims, err := s.claimsService().GetAuthorizationClaims(user, payload.Aud)
+	if err != nil {
+		return err
 	}
+	payload.AddAuthorizationClaims(claims, s.config.Claims)
+	return nil
+}
+
+func (s *Server) claimsService() *services.ClaimsService {
+	userRepo := s.userRepository.(*repository.UserRepository)
+	roleRepo := s.roleRepository.(*repository.RoleRepository)
+	return services.NewClaimsService(userRepo, roleRepo)
 }
 
+// HandleUserClaims returns the roles and permissions of the user a bearer
+// token was issued to, within the token's audience. It is the claim source
+// referenced by tokens whose authorization claims were too large to embed.
+func (s *Server) HandleUserClaims(w http.ResponseWriter, r *http.Request) {
+	payload, err := s.authenticateToken(w, r)
+	if err != nil {
+		s.HandleError(w, http.StatusUnauthorized, OAUTH2_USER_CLAIMS_ROUTE, err)
+		return
+	}
+
+	repo := s.userRepository.(*repository.UserRepository)
+	user, err := repo.FindById(context.Background(), payload.Sub)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, OAUTH2_USER_CLAIMS_ROUTE, err)
+		return
+	}
+	if user == nil {
+		s.HandleError(w, http.StatusNotFound, OAUTH2_USER_CLAIMS_ROUTE, errors.New("token subject is not a user"))
+		return
+	}
+
+	claims, err := s.claimsService().GetAuthorizationClaims(user, payload.Aud)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, OAUTH2_USER_CLAIMS_ROUTE, err)
+		return
+	}
+	response, err := json.Marshal(claims.ToMap(s.config.Claims))
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, OAUTH2_USER_CLAIMS_ROUTE, err)
+		return
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// HandleIntrospection reports whether a token is active and returns its claims,
+// as described in RFC 7662. Tokens bound to a client certificate or a DPoP key
+// carry its thumbprint in the cnf claim, so resource servers can check the
+// certificate or proof presented by the caller. Resource servers may also pass
+// the DPoP proof they received, in which case the token is only reported as
+// active if the proof is valid for it.
 func (s *Server) HandleIntrospection(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusNotImplemented)
+	decoder := json.NewDecoder(r.Body)
+	var introspectionRequest models.IntrospectionRequest
+	err := decoder.Decode(&introspectionRequest)
+	if err != nil {
+		s.HandleError(w, http.StatusBadRequest, OAUTH2_INTROSPECTION_ROUTE, err)
+		return
+	}
+	if introspectionRequest.Token == "" {
+		s.HandleError(w, http.StatusBadRequest, OAUTH2_INTROSPECTION_ROUTE, errors.New("missing token"))
+		return
+	}
+
+	introspectionResponse := &models.IntrospectionResponse{Active: false}
+	payload, err := s.ValidateToken(introspectionRequest.Token)
+	if err == nil {
+		err = s.verifyIntrospectedProof(&introspectionRequest, payload)
+	}
+	if err == nil {
+		tokenType := BEARER
+		if payload.Cnf != nil && payload.Cnf.Jkt != "" {
+			tokenType = DPOP
+		}
+		introspectionResponse = mapper.PayloadToIntrospectionResponse(payload, tokenType)
+	}
+	response, err := json.Marshal(introspectionResponse)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, OAUTH2_INTROSPECTION_ROUTE, err)
+		return
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
 }
 
 func (s *Server) HandleTokenInfo(w http.ResponseWriter, r *http.Request) {
@@ -68,6 +537,9 @@ func (s *Server) HandleTokenInfo(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) FetchClientAndApplication(ctx context.Context, clientId string, applicationId string) (*models.Client, *models.Application, error) {
+	ctx, span := tracer.Start(ctx, "Server.FetchClientAndApplication")
+	defer span.End()
+
 	client, err := s.clientRepository.FindById(ctx, clientId)
 	if err != nil {
 		return nil, nil, err
@@ -82,12 +554,27 @@ func (s *Server) FetchClientAndApplication(ctx context.Context, clientId string,
 }
 
 func (s *Server) ValidateToken(token string) (*models.Payload, error) {
+	payload, err := s.verifyTokenSignature(token)
+	if err != nil {
+		return nil, err
+	}
+	if payload.Exp < time.Now().Unix() {
+		return nil, errors.New("token expired")
+	}
+	return payload, nil
+}
+
+// verifyTokenSignature checks that the token was issued by the server's
+// realm, and returns its payload regardless of whether it expired.
+func (s *Server) verifyTokenSignature(token string) (*models.Payload, error) {
 	parts := models.SplitToken(token)
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
 	header, err := models.ParseHeader(parts[0])
 	if err != nil {
 		return nil, err
 	}
-	s.logger.WithField("header", header)
 	if header.Alg != os.Getenv("AUTH_SERVER_JWT_ALG") {
 		return nil, errors.New("invalid algorithm")
 	}
@@ -95,11 +582,7 @@ func (s *Server) ValidateToken(token string) (*models.Payload, error) {
 	if err != nil {
 		return nil, err
 	}
-	s.logger.WithField("payload", payload)
-	if payload.Exp < time.Now().Unix() {
-		return nil, errors.New("token expired")
-	}
-	jwt, err := models.NewJwt(payload, "JWT")
+	jwt, err := models.NewJwtWithKey(payload, "JWT", s.signingKey())
 	if err != nil {
 		return nil, err
 	}
@@ -110,6 +593,8 @@ func (s *Server) ValidateToken(token string) (*models.Payload, error) {
 	if !valid {
 		return nil, errors.New("invalid signature")
 	}
+	if !s.issuedByRealm(payload) {
+		return nil, errors.New("the token was not issued by this realm")
+	}
 	return payload, nil
 }
-
@@ -0,0 +1,359 @@
+package server
+
+import (
+	"auth-server/models"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// newTestUser returns an active user whose password is "password".
+func newTestUser(username string) *models.User {
+	return &models.User{
+		BaseUUIDEntity:        models.BaseUUIDEntity{ID: uuid.New()},
+		Username:              username,
+		Email:                 username + "@example.com",
+		Password:              "plain$password",
+		Enabled:               true,
+		AccountNonLocked:      true,
+		AccountNonExpired:     true,
+		CredentialsNonExpired: true,
+	}
+}
+
+func newTestRole(name string, app *models.Application) *models.Role {
+	return &models.Role{
+		BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()},
+		Name:           name,
+		ApplicationID:  app.ID,
+	}
+}
+
+func TestPasswordGrant(t *testing.T) {
+	client := &models.Client{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, ClientName: "cli"}
+	app := &models.Application{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, AppName: "app"}
+
+	tests := []struct {
+		name     string
+		password string
+		user     func(*models.User)
+		status   int
+	}{
+		{"valid credentials", "password", nil, 0},
+		{"wrong password", "wrong", nil, http.StatusUnauthorized},
+		{"unknown user", "password", func(u *models.User) { u.Username = "" }, http.StatusUnauthorized},
+		{"disabled user", "password", func(u *models.User) { u.Enabled = false }, http.StatusUnauthorized},
+		{"locked user", "password", func(u *models.User) { u.AccountNonLocked = false }, http.StatusUnauthorized},
+		{"expired account", "password", func(u *models.User) { u.AccountNonExpired = false }, http.StatusUnauthorized},
+		{"expired credentials", "password", func(u *models.User) { u.CredentialsNonExpired = false }, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, db := newDatabaseTestServer(t)
+			s.config.Claims = &models.ClaimsConfig{RolesClaim: "roles", PermissionsClaim: "permissions"}
+			user := newTestUser("alice")
+			if tt.user != nil {
+				tt.user(user)
+			}
+			db.Return(`FROM "clients"`, client)
+			db.Return(`FROM "applications"`, app)
+			if user.Username != "" {
+				db.Return(`FROM "users"`, user)
+			}
+			db.Return(`FROM "roles"`, newTestRole("editor", app), newTestRole("viewer", app))
+
+			payload, err := s.passwordGrant(context.Background(), client, &models.TokenRequest{
+				GrantType: GRANT_TYPE_PASSWORD,
+				ClientId:  client.ID.String(),
+				Aud:       app.ID.String(),
+				Username:  "alice",
+				Password:  tt.password,
+				Scope:     "openid",
+			})
+
+			if tt.status != 0 {
+				if err == nil || errorStatus(err) != tt.status {
+					t.Fatalf("err = %v, want status %d", err, tt.status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if payload.Sub != user.ID.String() || payload.Aud != app.ID.String() {
+				t.Errorf("sub = %s, aud = %s", payload.Sub, payload.Aud)
+			}
+			roles, _ := payload.Claim("roles")
+			if !reflect.DeepEqual(roles, []string{"editor", "viewer"}) {
+				t.Errorf("roles = %v", roles)
+			}
+		})
+	}
+}
+
+func TestHandleUserClaims(t *testing.T) {
+	app := &models.Application{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, AppName: "app"}
+	user := newTestUser("alice")
+
+	tests := []struct {
+		name   string
+		token  func(s *Server) string
+		status int
+	}{
+		{"token of a user", func(s *Server) string {
+			return newTestToken(t, s, func(p *models.Payload) {
+				p.Sub = user.ID.String()
+				p.Aud = app.ID.String()
+			})
+		}, http.StatusOK},
+		{"token of a client", func(s *Server) string {
+			return newTestToken(t, s, func(p *models.Payload) {
+				p.Sub = uuid.NewString()
+				p.Aud = app.ID.String()
+			})
+		}, http.StatusNotFound},
+		{"invalid token", func(s *Server) string {
+			return "invalid"
+		}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, db := newDatabaseTestServer(t)
+			s.config.Claims = &models.ClaimsConfig{RolesClaim: "roles", PermissionsClaim: "permissions"}
+			db.Return(`FROM "users" WHERE id = '`+user.ID.String()+`'`, user)
+			db.Return(`FROM "applications"`, app)
+			db.Return(`FROM "roles"`, newTestRole("editor", app), newTestRole("viewer", app))
+			token := tt.token(s)
+			r := httptest.NewRequest(http.MethodGet, OAUTH2_USER_CLAIMS_ROUTE, nil)
+			r.Header.Set(AUTHORIZATION, BEARER+" "+token)
+			w := httptest.NewRecorder()
+			s.HandleUserClaims(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var claims map[string][]string
+			err := json.Unmarshal(w.Body.Bytes(), &claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := map[string][]string{"roles": {"editor", "viewer"}, "permissions": {}}
+			if !reflect.DeepEqual(claims, want) {
+				t.Errorf("claims = %v, want %v", claims, want)
+			}
+		})
+	}
+}
+
+func TestDistributedClaimsAreServedByUserClaims(t *testing.T) {
+	s, db := newDatabaseTestServer(t)
+	s.config.Claims = &models.ClaimsConfig{
+		RolesClaim:       "roles",
+		PermissionsClaim: "permissions",
+		MaxEntries:       1,
+		SourceEndpoint:   testIssuer + OAUTH2_USER_CLAIMS_ROUTE,
+	}
+	client := &models.Client{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, ClientName: "cli"}
+	app := &models.Application{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, AppName: "app"}
+	user := newTestUser("alice")
+	db.Return(`FROM "clients"`, client)
+	db.Return(`FROM "applications"`, app)
+	db.Return(`FROM "users"`, user)
+	db.Return(`FROM "roles"`, newTestRole("editor", app), newTestRole("viewer", app))
+
+	payload, err := s.passwordGrant(context.Background(), client, &models.TokenRequest{
+		GrantType: GRANT_TYPE_PASSWORD,
+		ClientId:  client.ID.String(),
+		Aud:       app.ID.String(),
+		Username:  "alice",
+		Password:  "password",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := payload.Claim("roles"); ok {
+		t.Fatalf("roles were embedded: %v", payload.Extra)
+	}
+	sources, _ := payload.Claim("_claim_sources")
+	want := map[string]interface{}{"authz": map[string]string{"endpoint": s.config.Claims.SourceEndpoint}}
+	if !reflect.DeepEqual(sources, want) {
+		t.Fatalf("_claim_sources = %v, want %v", sources, want)
+	}
+
+	jwt, err := s.newJwt(payload, "JWT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _ := jwt.Token()
+	r := httptest.NewRequest(http.MethodGet, OAUTH2_USER_CLAIMS_ROUTE, nil)
+	r.Header.Set(AUTHORIZATION, BEARER+" "+token)
+	w := httptest.NewRecorder()
+	s.HandleUserClaims(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var claims map[string][]string
+	err = json.Unmarshal(w.Body.Bytes(), &claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(claims["roles"], []string{"editor", "viewer"}) {
+		t.Errorf("roles = %v", claims["roles"])
+	}
+}
+
+func TestTokenExchangeGrant(t *testing.T) {
+	client := &models.Client{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, ClientName: "gateway"}
+	app := &models.Application{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, AppName: "backend"}
+
+	tests := []struct {
+		name    string
+		user    func(*models.User)
+		subject func(p *models.Payload, user *models.User)
+		code    string
+	}{
+		{"active user", nil, nil, ""},
+		{"disabled user", func(u *models.User) { u.Enabled = false }, nil, "invalid_grant"},
+		{"locked user", func(u *models.User) { u.AccountNonLocked = false }, nil, "invalid_grant"},
+		{"expired account", func(u *models.User) { u.AccountNonExpired = false }, nil, "invalid_grant"},
+		{"deleted user", nil, func(p *models.Payload, _ *models.User) { p.Sub = uuid.NewString() }, "invalid_grant"},
+		{"client", nil, func(p *models.Payload, _ *models.User) { p.Sub = client.ID.String() }, ""},
+		{"DPoP-bound token", nil, func(p *models.Payload, _ *models.User) {
+			p.Cnf = &models.Confirmation{Jkt: "thumbprint"}
+		}, "invalid_request"},
+		{"certificate-bound token", nil, func(p *models.Payload, _ *models.User) {
+			p.Cnf = &models.Confirmation{X5tS256: "thumbprint"}
+		}, "invalid_request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, db := newDatabaseTestServer(t)
+			s.config.Claims = &models.ClaimsConfig{RolesClaim: "roles", PermissionsClaim: "permissions"}
+			user := newTestUser("alice")
+			if tt.user != nil {
+				tt.user(user)
+			}
+			db.Return(`FROM "clients" WHERE id = '`+client.ID.String()+`'`, client)
+			db.ReturnColumns(`FROM "client_exchange_audiences"`, []string{"client_id", "application_id"},
+				[]driver.Value{client.ID.String(), app.ID.String()})
+			db.Return(`FROM "applications"`, app)
+			db.Return(`FROM "users" WHERE id = '`+user.ID.String()+`'`, user)
+			db.Return(`FROM "roles"`, newTestRole("editor", app))
+			subjectToken := newTestToken(t, s, func(p *models.Payload) {
+				p.Sub = user.ID.String()
+				p.Scope = []string{"openid", "profile"}
+				if tt.subject != nil {
+					tt.subject(p, user)
+				}
+			})
+
+			payload, err := s.tokenExchangeGrant(context.Background(), client, &models.TokenRequest{
+				GrantType:        GRANT_TYPE_TOKEN_EXCHANGE,
+				ClientId:         client.ID.String(),
+				Audience:         app.ID.String(),
+				SubjectToken:     subjectToken,
+				SubjectTokenType: TOKEN_TYPE_ACCESS_TOKEN,
+				Scope:            "openid",
+			})
+
+			if tt.code != "" {
+				oauthErr, ok := err.(*oauthError)
+				if !ok || oauthErr.code != tt.code {
+					t.Fatalf("err = %v, want %s", err, tt.code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if payload.Aud != app.ID.String() || payload.Act == nil || payload.Act.Sub != client.ID.String() {
+				t.Errorf("aud = %s, act = %+v", payload.Aud, payload.Act)
+			}
+			if !reflect.DeepEqual(payload.Scope, []string{"openid"}) {
+				t.Errorf("scope = %v", payload.Scope)
+			}
+			if payload.Cnf != nil {
+				t.Errorf("cnf = %+v", payload.Cnf)
+			}
+			_, hasRoles := payload.Claim("roles")
+			if hasRoles != (tt.subject == nil) {
+				t.Errorf("claims = %v", payload.Extra)
+			}
+		})
+	}
+}
+
+func TestAuthorizeClient(t *testing.T) {
+	tests := []struct {
+		name      string
+		client    *models.Client
+		grantType string
+		code      string
+	}{
+		{"registered grant type", &models.Client{GrantTypes: models.StringList{GRANT_TYPE_CLIENT_CREDENTIALS}}, GRANT_TYPE_CLIENT_CREDENTIALS, ""},
+		{"unknown client", nil, GRANT_TYPE_CLIENT_CREDENTIALS, "invalid_client"},
+		{"disabled client", &models.Client{Disabled: true, GrantTypes: models.StringList{GRANT_TYPE_CLIENT_CREDENTIALS}}, GRANT_TYPE_CLIENT_CREDENTIALS, "invalid_client"},
+		{"grant type not registered", &models.Client{GrantTypes: models.StringList{GRANT_TYPE_AUTHORIZATION_CODE}}, GRANT_TYPE_PASSWORD, "unauthorized_client"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			r := httptest.NewRequest(http.MethodPost, TOKEN_ROUTE, nil)
+
+			err := s.authorizeClient(r, tt.client, tt.grantType)
+			if tt.code == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			oauthErr, ok := err.(*oauthError)
+			if !ok || oauthErr.code != tt.code {
+				t.Fatalf("err = %v, want %s", err, tt.code)
+			}
+		})
+	}
+}
+
+func TestClientCredentialsGrantLifetime(t *testing.T) {
+	app := &models.Application{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, AppName: "app"}
+	tests := []struct {
+		name     string
+		lifetime int
+		want     time.Duration
+	}{
+		{"server default", 0, models.DEFAULT_ACCESS_TOKEN_LIFETIME},
+		{"client lifetime", 300, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, db := newDatabaseTestServer(t)
+			client := &models.Client{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, ClientName: "backend", AccessTokenLifetime: tt.lifetime}
+			db.Return(`FROM "clients"`, client)
+			db.Return(`FROM "applications"`, app)
+
+			payload, err := s.clientCredentialsGrant(context.Background(), client, &models.TokenRequest{
+				GrantType: GRANT_TYPE_CLIENT_CREDENTIALS,
+				ClientId:  client.ID.String(),
+				Aud:       app.ID.String(),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lifetime := time.Duration(payload.Exp-payload.Iat) * time.Second; lifetime != tt.want {
+				t.Errorf("lifetime = %s, want %s", lifetime, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"auth-server/mapper"
+	"auth-server/models"
+	"auth-server/repository"
+	"auth-server/services"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleClientRegistration registers a client dynamically, as described in
+// RFC 7591. Registration requests must carry the initial access token the
+// server was configured with. The response includes a registration access
+// token the client can use to manage its registration at the client
+// configuration endpoint.
+func (s *Server) HandleClientRegistration(w http.ResponseWriter, r *http.Request) {
+	if s.config.RegistrationToken == "" {
+		s.HandleOAuthError(w, CLIENT_REGISTRATION_ROUTE, newOAuthError(http.StatusForbidden, "access_denied", "dynamic client registration is disabled"))
+		return
+	}
+	scheme, token, err := authorizationCredentials(r)
+	if err != nil || !strings.EqualFold(scheme, BEARER) ||
+		subtle.ConstantTimeCompare([]byte(token), []byte(s.config.RegistrationToken)) != 1 {
+		w.Header().Set(WWW_AUTHENTICATE, BEARER+` error="invalid_token"`)
+		s.HandleOAuthError(w, CLIENT_REGISTRATION_ROUTE, newOAuthError(http.StatusUnauthorized, "invalid_token", "invalid initial access token"))
+		return
+	}
+
+	var metadata models.ClientMetadata
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&metadata)
+	if err != nil {
+		s.HandleOAuthError(w, CLIENT_REGISTRATION_ROUTE, newOAuthError(http.StatusBadRequest, "invalid_client_metadata", err.Error()))
+		return
+	}
+
+	service := s.clientRegistrationService()
+	client, registrationToken, err := service.RegisterClient(&metadata)
+	if err != nil {
+		s.auditAs(r, "", models.AUDIT_ACTION_CLIENT_CREATE, metadata.ClientName, err, nil, nil)
+		s.handleRegistrationError(w, CLIENT_REGISTRATION_ROUTE, err)
+		return
+	}
+	s.auditAs(r, client.ID.String(), models.AUDIT_ACTION_CLIENT_CREATE, metadata.ClientName, nil, nil, mapper.ClientToClientDto(client))
+
+	registrationResponse := mapper.ClientToClientRegistrationResponse(client, s.registrationClientURI(r, client))
+	registrationResponse.RegistrationAccessToken = registrationToken
+	if client.UsesClientSecret() {
+		err = s.issueRegistrationSecret(client, registrationResponse)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, CLIENT_REGISTRATION_ROUTE, err)
+			return
+		}
+	}
+	s.writeRegistrationResponse(w, http.StatusCreated, CLIENT_REGISTRATION_ROUTE, registrationResponse)
+}
+
+// HandleClientConfiguration lets a dynamically registered client read, update
+// or delete its registration, as described in RFC 7592. Requests must carry
+// the registration access token issued when the client was registered.
+func (s *Server) HandleClientConfiguration(w http.ResponseWriter, r *http.Request) {
+	service := s.clientRegistrationService()
+
+	scheme, token, err := authorizationCredentials(r)
+	var client *models.Client
+	if err == nil && strings.EqualFold(scheme, BEARER) {
+		client, err = service.AuthenticateRegistration(mux.Vars(r)["id"], token)
+	}
+	if client == nil {
+		w.Header().Set(WWW_AUTHENTICATE, BEARER+` error="invalid_token"`)
+		s.HandleOAuthError(w, CLIENT_CONFIGURATION_ROUTE, newOAuthError(http.StatusUnauthorized, "invalid_token", services.ErrInvalidRegistrationToken.Error()))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		registrationResponse := mapper.ClientToClientRegistrationResponse(client, s.registrationClientURI(r, client))
+		s.writeRegistrationResponse(w, http.StatusOK, CLIENT_CONFIGURATION_ROUTE, registrationResponse)
+	case http.MethodPut:
+		var registrationRequest models.ClientRegistrationRequest
+		decoder := json.NewDecoder(r.Body)
+		err = decoder.Decode(&registrationRequest)
+		if err != nil {
+			s.HandleOAuthError(w, CLIENT_CONFIGURATION_ROUTE, newOAuthError(http.StatusBadRequest, "invalid_client_metadata", err.Error()))
+			return
+		}
+		before := mapper.ClientToClientDto(client)
+		client, err = service.UpdateClient(client, &registrationRequest)
+		if err != nil {
+			s.auditAs(r, before.ID, models.AUDIT_ACTION_CLIENT_UPDATE, before.ID, err, before, nil)
+			s.handleRegistrationError(w, CLIENT_CONFIGURATION_ROUTE, err)
+			return
+		}
+		s.auditAs(r, before.ID, models.AUDIT_ACTION_CLIENT_UPDATE, before.ID, nil, before, mapper.ClientToClientDto(client))
+		registrationResponse := mapper.ClientToClientRegistrationResponse(client, s.registrationClientURI(r, client))
+		if client.UsesClientSecret() {
+			hasSecret, err := s.clientSecretService().HasActiveSecret(client)
+			if err == nil && !hasSecret {
+				err = s.issueRegistrationSecret(client, registrationResponse)
+			}
+			if err != nil {
+				s.HandleError(w, http.StatusInternalServerError, CLIENT_CONFIGURATION_ROUTE, err)
+				return
+			}
+		}
+		s.writeRegistrationResponse(w, http.StatusOK, CLIENT_CONFIGURATION_ROUTE, registrationResponse)
+	case http.MethodDelete:
+		err = service.DeleteClient(client)
+		s.auditAs(r, client.ID.String(), models.AUDIT_ACTION_CLIENT_DELETE, client.ID.String(), err, mapper.ClientToClientDto(client), nil)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, CLIENT_CONFIGURATION_ROUTE, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) clientRegistrationService() *services.ClientRegistrationService {
+	repo := s.clientRepository.(*repository.ClientRepository)
+	return services.NewClientRegistrationService(repo)
+}
+
+// issueRegistrationSecret generates a secret for a client that authenticates
+// with one, and adds it to the registration response as described in RFC 7591,
+// section 3.2.1. A client_secret_expires_at of zero means it does not expire.
+func (s *Server) issueRegistrationSecret(client *models.Client, registrationResponse *models.ClientRegistrationResponse) error {
+	secret, err := s.clientSecretService().CreateSecret(client, 0, 0)
+	if err != nil {
+		return err
+	}
+	var expiresAt int64
+	registrationResponse.ClientSecret = secret.Secret
+	registrationResponse.ClientSecretExpiresAt = &expiresAt
+	return nil
+}
+
+// registrationClientURI returns the URL of the client configuration endpoint
+// of the client.
+func (s *Server) registrationClientURI(r *http.Request, client *models.Client) string {
+	return s.baseURL(r) + strings.Replace(CLIENT_CONFIGURATION_ROUTE, "{id}", client.ID.String(), 1)
+}
+
+// handleRegistrationError reports invalid client metadata with the error
+// codes defined by RFC 7591, section 3.2.2.
+func (s *Server) handleRegistrationError(w http.ResponseWriter, route string, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidRedirectURI):
+		s.HandleOAuthError(w, route, newOAuthError(http.StatusBadRequest, "invalid_redirect_uri", err.Error()))
+	case errors.Is(err, services.ErrInvalidClientMetadata):
+		s.HandleOAuthError(w, route, newOAuthError(http.StatusBadRequest, "invalid_client_metadata", err.Error()))
+	default:
+		s.HandleError(w, http.StatusInternalServerError, route, err)
+	}
+}
+
+func (s *Server) writeRegistrationResponse(w http.ResponseWriter, status int, route string, registrationResponse *models.ClientRegistrationResponse) {
+	response, err := json.Marshal(registrationResponse)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, route, err)
+		return
+	}
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(response)
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"auth-server/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleClientRegistration(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		authMethod string
+		secret     bool
+	}{
+		{"authentication method omitted", `{"redirect_uris": ["https://app.example.com/callback"]}`, models.CLIENT_AUTH_CLIENT_SECRET_BASIC, true},
+		{"secret sent in the body", `{"redirect_uris": ["https://app.example.com/callback"], "token_endpoint_auth_method": "client_secret_post"}`, models.CLIENT_AUTH_CLIENT_SECRET_POST, true},
+		{"public client", `{"redirect_uris": ["https://app.example.com/callback"], "token_endpoint_auth_method": "none"}`, models.CLIENT_AUTH_NONE, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newDatabaseTestServer(t)
+			s.config.RegistrationToken = "initial"
+			r := httptest.NewRequest(http.MethodPost, CLIENT_REGISTRATION_ROUTE, strings.NewReader(tt.body))
+			r.Header.Set(AUTHORIZATION, BEARER+" initial")
+			w := httptest.NewRecorder()
+			s.HandleClientRegistration(w, r)
+
+			if w.Code != http.StatusCreated {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			var response models.ClientRegistrationResponse
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.TokenEndpointAuthMethod != tt.authMethod {
+				t.Errorf("token_endpoint_auth_method = %q, want %q", response.TokenEndpointAuthMethod, tt.authMethod)
+			}
+			if (response.ClientSecret != "") != tt.secret {
+				t.Errorf("client_secret = %q", response.ClientSecret)
+			}
+			if response.RegistrationAccessToken == "" {
+				t.Error("no registration access token was issued")
+			}
+		})
+	}
+}
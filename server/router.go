@@ -9,6 +9,7 @@ import (
 // Route constants
 const (
 	TOKEN_ROUTE              = "/token/"
+	OAUTH2_TOKEN_ROUTE       = "/oauth2/token/"
 	ADMIN_CLIENT_ROUTE       = "/admin/client/"
 	ADMIN_USER_ROUTE         = "/admin/user/"
 	ADMIN_USER_DETAILS_ROUTE = "/admin/user/{username}/"
@@ -16,35 +17,180 @@ const (
 	ADMIN_ROLE_ROUTE         = "/admin/role/"
 	ADMIN_PERMISSION_ROUTE   = "/admin/permission/"
 	ADMIN_APPLICATION_ROUTE  = "/admin/application/"
+	OAUTH2_USER_CLAIMS_ROUTE = "/oauth2/userclaims/"
+
+	ADMIN_USER_EFFECTIVE_PERMISSIONS_ROUTE    = "/admin/user/{username}/effective-permissions/"
+	ADMIN_ROLE_COMPOSITES_ROUTE               = "/admin/role/{id}/composites/"
+	ADMIN_ROLE_PERMISSIONS_ROUTE              = "/admin/role/{id}/permissions/"
+	ADMIN_USER_GROUPS_ROUTE                   = "/admin/user/{username}/groups/"
+	ADMIN_GROUP_ROUTE                         = "/admin/group/"
+	ADMIN_GROUP_DETAILS_ROUTE                 = "/admin/group/{id}/"
+	ADMIN_GROUP_MEMBERS_ROUTE                 = "/admin/group/{id}/members/"
+	ADMIN_GROUP_ROLES_ROUTE                   = "/admin/group/{id}/roles/"
+	ADMIN_POLICY_ROUTE                        = "/admin/policy/"
+	ADMIN_POLICY_DETAILS_ROUTE                = "/admin/policy/{id}/"
+	AUTHZ_DECIDE_ROUTE                        = "/authz/decide"
+	DEVICE_AUTHORIZATION_ROUTE                = "/oauth2/device_authorization"
+	DEVICE_VERIFICATION_ROUTE                 = "/oauth2/device/"
+	ADMIN_CLIENT_EXCHANGE_AUDIENCES_ROUTE     = "/admin/client/{id}/exchange-audiences/"
+	ADMIN_CLIENT_DETAILS_ROUTE                = "/admin/client/{id}/"
+	ADMIN_CLIENT_SECRETS_ROUTE                = "/admin/client/{id}/secrets"
+	ADMIN_CLIENT_SECRET_DETAILS_ROUTE         = "/admin/client/{id}/secrets/{secretId}"
+	OAUTH2_INTROSPECTION_ROUTE                = "/oauth2/introspect"
+	CLIENT_REGISTRATION_ROUTE                 = "/oauth2/register"
+	CLIENT_CONFIGURATION_ROUTE                = "/oauth2/register/{id}"
+	AUTHORIZE_ROUTE                           = "/oauth2/authorize"
+	USER_CONSENTS_ROUTE                       = "/oauth2/consents/"
+	USER_CONSENT_DETAILS_ROUTE                = "/oauth2/consents/{id}/"
+	LOGIN_ROUTE                               = "/oauth2/login"
+	USER_SESSIONS_ROUTE                       = "/oauth2/sessions/"
+	USER_SESSION_DETAILS_ROUTE                = "/oauth2/sessions/{id}/"
+	ADMIN_USER_SESSIONS_ROUTE                 = "/admin/user/{username}/sessions/"
+	ADMIN_SESSION_DETAILS_ROUTE               = "/admin/session/{id}/"
+	LOGOUT_ROUTE                              = "/oauth2/logout"
+	FEDERATION_ROUTE                          = "/oauth2/federation/"
+	FEDERATED_LOGIN_ROUTE                     = "/oauth2/federation/{id}/login"
+	FEDERATION_CALLBACK_ROUTE                 = "/oauth2/federation/{id}/callback"
+	SAML_ACS_ROUTE                            = "/oauth2/federation/{id}/acs"
+	SAML_METADATA_ROUTE                       = "/oauth2/federation/{id}/metadata"
+	ADMIN_IDENTITY_PROVIDER_ROUTE             = "/admin/identity-provider/"
+	ADMIN_IDENTITY_PROVIDER_DETAILS_ROUTE     = "/admin/identity-provider/{id}/"
+	ADMIN_USER_IDENTITIES_ROUTE               = "/admin/user/{username}/identities/"
+	ADMIN_USER_IDENTITY_DETAILS_ROUTE         = "/admin/user/{username}/identities/{id}/"
+	SAML_IDP_METADATA_ROUTE                   = "/saml/metadata"
+	SAML_SSO_ROUTE                            = "/saml/sso"
+	ADMIN_SAML_SERVICE_PROVIDER_ROUTE         = "/admin/saml-service-provider/"
+	ADMIN_SAML_SERVICE_PROVIDER_DETAILS_ROUTE = "/admin/saml-service-provider/{id}/"
+	SCIM_USERS_ROUTE                          = "/scim/v2/Users"
+	SCIM_USER_DETAILS_ROUTE                   = "/scim/v2/Users/{id}"
+	SCIM_GROUPS_ROUTE                         = "/scim/v2/Groups"
+	SCIM_GROUP_DETAILS_ROUTE                  = "/scim/v2/Groups/{id}"
+	SCIM_SERVICE_PROVIDER_CONFIG_ROUTE        = "/scim/v2/ServiceProviderConfig"
+	SCIM_SCHEMAS_ROUTE                        = "/scim/v2/Schemas"
+	SCIM_SCHEMA_DETAILS_ROUTE                 = "/scim/v2/Schemas/{id}"
+	SCIM_RESOURCE_TYPES_ROUTE                 = "/scim/v2/ResourceTypes"
+	SCIM_RESOURCE_TYPE_DETAILS_ROUTE          = "/scim/v2/ResourceTypes/{id}"
+	ADMIN_TENANT_ROUTE                        = "/admin/tenant/"
+	ADMIN_TENANT_DETAILS_ROUTE                = "/admin/tenant/{id}/"
+	ADMIN_AUDIT_ROUTE                         = "/admin/audit/"
+	ADMIN_AUDIT_VERIFY_ROUTE                  = "/admin/audit/verify/"
+	METRICS_ROUTE                             = "/metrics"
+	ADMIN_WEBHOOK_ROUTE                       = "/admin/webhook/"
+	ADMIN_WEBHOOK_DETAILS_ROUTE               = "/admin/webhook/{id}/"
+	ADMIN_WEBHOOK_DELIVERIES_ROUTE            = "/admin/webhook/{id}/deliveries/"
 )
 
+// router returns the routes of the server's realm, under its path prefix.
 func (s *Server) router() http.Handler {
 	// Base Router
-	router := mux.NewRouter()
-	router.StrictSlash(true)
-	router.Use(s.logger.RequestLoggerMiddleware)
+	root := mux.NewRouter()
+	root.StrictSlash(true)
+	root.Use(s.RequestIDMiddleware)
+	root.Use(s.TracingMiddleware)
+	root.Use(s.logger.RequestLoggerMiddleware)
+	root.Use(s.MetricsMiddleware)
+	router := root
+	if s.pathPrefix != "" {
+		router = root.PathPrefix(s.pathPrefix).Subrouter()
+	}
 
 	// Admin Router
 	adminRouter := router.PathPrefix("/admin").Subrouter()
-	adminRouter.Use(s.AuthMiddleware)
+	adminRouter.Use(s.AuthMiddleware, s.AdminMiddleware)
 	adminRouter.HandleFunc("/user/", s.HandleUser).Methods(http.MethodGet, http.MethodPost)
 	adminRouter.HandleFunc("/user/{username}/", s.HandleUserDetails).Methods(http.MethodGet)
 	adminRouter.HandleFunc("/user/{username}/roles/", s.HandleUserRoles).Methods(http.MethodGet, http.MethodPost, http.MethodPatch)
+	adminRouter.HandleFunc("/user/{username}/effective-permissions/", s.HandleUserEffectivePermissions).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/user/{username}/groups/", s.HandleUserGroups).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/user/{username}/sessions/", s.HandleAdminUserSessions).Methods(http.MethodGet, http.MethodDelete)
+	adminRouter.HandleFunc("/user/{username}/identities/", s.HandleAdminUserIdentities).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/user/{username}/identities/{id}/", s.HandleAdminUserIdentityDetails).Methods(http.MethodDelete)
+	adminRouter.HandleFunc("/session/{id}/", s.HandleSessionDetails).Methods(http.MethodDelete)
+	adminRouter.HandleFunc("/group/", s.HandleGroup).Methods(http.MethodGet, http.MethodPost)
+	adminRouter.HandleFunc("/group/{id}/", s.HandleGroupDetails).Methods(http.MethodGet, http.MethodPut, http.MethodDelete)
+	adminRouter.HandleFunc("/group/{id}/members/", s.HandleGroupMembers).Methods(http.MethodGet, http.MethodPost, http.MethodPatch)
+	adminRouter.HandleFunc("/group/{id}/roles/", s.HandleGroupRoles).Methods(http.MethodGet, http.MethodPost, http.MethodPatch)
 	adminRouter.HandleFunc("/role/", s.HandleRole).Methods(http.MethodGet, http.MethodPost)
+	adminRouter.HandleFunc("/role/{id}/composites/", s.HandleRoleComposites).Methods(http.MethodGet, http.MethodPost, http.MethodPatch)
+	adminRouter.HandleFunc("/role/{id}/permissions/", s.HandleRolePermissions).Methods(http.MethodGet, http.MethodPost, http.MethodPatch)
 	adminRouter.HandleFunc("/permission/", s.HandlePermission).Methods(http.MethodGet, http.MethodPost)
 	adminRouter.HandleFunc("/client/", s.HandleClient).Methods(http.MethodGet, http.MethodPost)
+	adminRouter.HandleFunc("/client/{id}/", s.HandleClientDetails).Methods(http.MethodGet, http.MethodPut, http.MethodDelete)
+	adminRouter.HandleFunc("/client/{id}/secrets", s.HandleClientSecrets).Methods(http.MethodGet, http.MethodPost)
+	adminRouter.HandleFunc("/client/{id}/secrets/{secretId}", s.HandleClientSecretDetails).Methods(http.MethodDelete)
+	adminRouter.HandleFunc("/client/{id}/exchange-audiences/", s.HandleClientExchangeAudiences).Methods(http.MethodGet, http.MethodPost, http.MethodPatch)
 	adminRouter.HandleFunc("/application/", s.HandleApplication).Methods(http.MethodGet, http.MethodPost)
+	adminRouter.HandleFunc("/policy/", s.HandlePolicy).Methods(http.MethodGet, http.MethodPost)
+	adminRouter.HandleFunc("/policy/{id}/", s.HandlePolicyDetails).Methods(http.MethodGet, http.MethodDelete)
+	adminRouter.HandleFunc("/identity-provider/", s.HandleIdentityProvider).Methods(http.MethodGet, http.MethodPost)
+	adminRouter.HandleFunc("/identity-provider/{id}/", s.HandleIdentityProviderDetails).Methods(http.MethodGet, http.MethodPut, http.MethodDelete)
+	adminRouter.HandleFunc("/saml-service-provider/", s.HandleSAMLServiceProvider).Methods(http.MethodGet, http.MethodPost)
+	adminRouter.HandleFunc("/saml-service-provider/{id}/", s.HandleSAMLServiceProviderDetails).Methods(http.MethodGet, http.MethodPut, http.MethodDelete)
+	adminRouter.HandleFunc("/audit/", s.HandleAudit).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/audit/verify/", s.HandleAuditVerification).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/webhook/", s.HandleWebhook).Methods(http.MethodGet, http.MethodPost)
+	adminRouter.HandleFunc("/webhook/{id}/", s.HandleWebhookDetails).Methods(http.MethodGet, http.MethodPut, http.MethodDelete)
+	adminRouter.HandleFunc("/webhook/{id}/deliveries/", s.HandleWebhookDeliveries).Methods(http.MethodGet)
+	// Tenants are only managed from the default realm.
+	if s.tenant.IsDefault() {
+		adminRouter.HandleFunc("/tenant/", s.HandleTenant).Methods(http.MethodGet, http.MethodPost)
+		adminRouter.HandleFunc("/tenant/{id}/", s.HandleTenantDetails).Methods(http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+
+	// Authorization Router
+	authzRouter := router.PathPrefix("/authz").Subrouter()
+	authzRouter.Use(s.AuthMiddleware)
+	authzRouter.HandleFunc("/decide", s.HandleDecide).Methods(http.MethodPost)
 
 	// Public Router
 	publicRouter := router.PathPrefix("/public").Subrouter()
 	publicRouter.HandleFunc("/health/", s.healthHandler).Methods("GET")
 
+	// Metrics cover all realms, so they are only exposed by the default realm.
+	if s.tenant.IsDefault() {
+		router.Handle(METRICS_ROUTE, s.metrics.handler()).Methods(http.MethodGet)
+	}
+
 	// OAuth2 Router
-	// oauth2Router := router.PathPrefix("/oauth2").Subrouter()
-	// oauth2Router.HandleFunc(TOKEN_ROUTE, s.HandleToken).Methods("POST")
-	// oauth2Router.HandleFunc("/introspect", s.HandleIntrospection).Methods("POST")
+	oauth2Router := router.PathPrefix("/oauth2").Subrouter()
+	oauth2Router.HandleFunc(TOKEN_ROUTE, s.HandleToken).Methods("POST")
+	oauth2Router.HandleFunc("/userclaims/", s.HandleUserClaims).Methods("GET")
+	oauth2Router.HandleFunc("/device_authorization", s.HandleDeviceAuthorization).Methods(http.MethodPost)
+	oauth2Router.HandleFunc("/device/", s.HandleDeviceVerification).Methods(http.MethodGet, http.MethodPost)
+	oauth2Router.Handle("/introspect", s.AuthMiddleware(http.HandlerFunc(s.HandleIntrospection))).Methods(http.MethodPost)
+	oauth2Router.HandleFunc("/register", s.HandleClientRegistration).Methods(http.MethodPost)
+	oauth2Router.HandleFunc("/register/{id}", s.HandleClientConfiguration).Methods(http.MethodGet, http.MethodPut, http.MethodDelete)
+	oauth2Router.HandleFunc("/authorize", s.HandleAuthorize).Methods(http.MethodGet, http.MethodPost)
+	oauth2Router.HandleFunc("/consents/", s.HandleUserConsents).Methods(http.MethodGet)
+	oauth2Router.HandleFunc("/consents/{id}/", s.HandleUserConsentDetails).Methods(http.MethodDelete)
+	oauth2Router.HandleFunc("/login", s.HandleLogin).Methods(http.MethodPost)
+	oauth2Router.HandleFunc("/logout", s.HandleLogout).Methods(http.MethodGet, http.MethodPost)
+	oauth2Router.HandleFunc("/sessions/", s.HandleUserSessions).Methods(http.MethodGet)
+	oauth2Router.HandleFunc("/sessions/{id}/", s.HandleUserSessionDetails).Methods(http.MethodDelete)
+	oauth2Router.HandleFunc("/federation/", s.HandleFederationProviders).Methods(http.MethodGet)
+	oauth2Router.HandleFunc("/federation/{id}/login", s.HandleFederatedLogin).Methods(http.MethodGet)
+	oauth2Router.HandleFunc("/federation/{id}/callback", s.HandleFederationCallback).Methods(http.MethodGet)
+	oauth2Router.HandleFunc("/federation/{id}/acs", s.HandleSAMLAssertionConsumer).Methods(http.MethodPost)
+	oauth2Router.HandleFunc("/federation/{id}/metadata", s.HandleSAMLServiceProviderMetadata).Methods(http.MethodGet)
 	// oauth2Router.HandleFunc("/tokeninfo", s.HandleTokenInfo).Methods("GET")
 
+	// SAML Identity Provider Router
+	samlRouter := router.PathPrefix("/saml").Subrouter()
+	samlRouter.HandleFunc("/metadata", s.HandleSAMLIdentityProviderMetadata).Methods(http.MethodGet)
+	samlRouter.HandleFunc("/sso", s.HandleSAMLSingleSignOn).Methods(http.MethodGet, http.MethodPost)
+
+	// SCIM Router
+	scimRouter := router.PathPrefix("/scim/v2").Subrouter()
+	scimRouter.HandleFunc("/ServiceProviderConfig", s.HandleSCIMServiceProviderConfig).Methods(http.MethodGet)
+	scimRouter.HandleFunc("/Schemas", s.HandleSCIMSchemas).Methods(http.MethodGet)
+	scimRouter.HandleFunc("/Schemas/{id}", s.HandleSCIMSchemas).Methods(http.MethodGet)
+	scimRouter.HandleFunc("/ResourceTypes", s.HandleSCIMResourceTypes).Methods(http.MethodGet)
+	scimRouter.HandleFunc("/ResourceTypes/{id}", s.HandleSCIMResourceTypes).Methods(http.MethodGet)
+	scimRouter.Handle("/Users", s.SCIMAuthMiddleware(http.HandlerFunc(s.HandleSCIMUsers))).Methods(http.MethodGet, http.MethodPost)
+	scimRouter.Handle("/Users/{id}", s.SCIMAuthMiddleware(http.HandlerFunc(s.HandleSCIMUserDetails))).Methods(http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete)
+	scimRouter.Handle("/Groups", s.SCIMAuthMiddleware(http.HandlerFunc(s.HandleSCIMGroups))).Methods(http.MethodGet, http.MethodPost)
+	scimRouter.Handle("/Groups/{id}", s.SCIMAuthMiddleware(http.HandlerFunc(s.HandleSCIMGroupDetails))).Methods(http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete)
+
 	// Admin-only routes. They require s.AuthMiddleware.
-	return router
+	return root
 }
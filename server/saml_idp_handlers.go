@@ -0,0 +1,258 @@
+package server
+
+import (
+	"auth-server/mapper"
+	"auth-server/models"
+	"auth-server/repository"
+	"auth-server/services"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"html/template"
+	"net/http"
+
+	"github.com/crewjam/saml"
+	"github.com/gorilla/mux"
+)
+
+// samlResponsePage posts the SAML response to the service provider's
+// assertion consumer service, as described by the HTTP-POST binding.
+var samlResponsePage = template.Must(template.New("saml-response").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Logging in</title>
+</head>
+<body onload="document.forms[0].submit()">
+<form method="post" action="{{.URL}}">
+<input type="hidden" name="SAMLResponse" value="{{.SAMLResponse}}">
+{{if .RelayState}}<input type="hidden" name="RelayState" value="{{.RelayState}}">{{end}}
+<noscript><input type="submit" value="Continue"></noscript>
+</form>
+</body>
+</html>
+`))
+
+// HandleSAMLIdentityProviderMetadata returns the metadata of the identity
+// provider the server acts as towards SAML service providers, for them to
+// import. It is only available when a SAML key pair is configured.
+func (s *Server) HandleSAMLIdentityProviderMetadata(w http.ResponseWriter, r *http.Request) {
+	service := s.samlIdentityProviderService()
+	idp, err := s.samlIdentityProvider(service)
+	if err != nil {
+		s.HandleError(w, http.StatusNotFound, SAML_IDP_METADATA_ROUTE, err)
+		return
+	}
+	response, err := xml.MarshalIndent(service.Metadata(idp), "", "  ")
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, SAML_IDP_METADATA_ROUTE, err)
+		return
+	}
+
+	w.Header().Set(CONTENT_TYPE, SAML_METADATA_CONTENT_TYPE)
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// HandleSAMLSingleSignOn answers the authentication requests of registered
+// service providers, received with either the HTTP-Redirect or the HTTP-POST
+// binding. The user must already be logged in, as at the authorization
+// endpoint; service providers forcing authentication require the user to
+// have logged in after the request was issued. The response, carrying a
+// signed assertion about the user, is posted to the service provider's
+// assertion consumer service by the user's browser.
+func (s *Server) HandleSAMLSingleSignOn(w http.ResponseWriter, r *http.Request) {
+	service := s.samlIdentityProviderService()
+	idp, err := s.samlIdentityProvider(service)
+	if err != nil {
+		s.HandleError(w, http.StatusNotFound, SAML_SSO_ROUTE, err)
+		return
+	}
+	req, err := saml.NewIdpAuthnRequest(idp, r)
+	if err != nil {
+		s.HandleError(w, http.StatusBadRequest, SAML_SSO_ROUTE, err)
+		return
+	}
+	err = req.Validate()
+	if err != nil {
+		s.HandleError(w, http.StatusBadRequest, SAML_SSO_ROUTE, err)
+		return
+	}
+	provider, err := service.GetServiceProviderByEntityId(req.ServiceProviderMetadata.EntityID)
+	if err != nil {
+		s.HandleError(w, http.StatusBadRequest, SAML_SSO_ROUTE, err)
+		return
+	}
+
+	session, err := s.currentSession(r)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, SAML_SSO_ROUTE, err)
+		return
+	}
+	forceAuthn := req.Request.ForceAuthn != nil && *req.Request.ForceAuthn
+	if session == nil || (forceAuthn && session.AuthTime.Before(req.Request.IssueInstant)) {
+		s.HandleError(w, http.StatusUnauthorized, SAML_SSO_ROUTE, errors.New("the user must log in"))
+		return
+	}
+	user := session.User
+	if !user.Enabled || !user.AccountNonLocked || !user.AccountNonExpired {
+		s.HandleError(w, http.StatusForbidden, SAML_SSO_ROUTE, errors.New("user account is not active"))
+		return
+	}
+
+	err = service.MakeAssertion(req, provider, user, session)
+	s.auditAs(r, user.ID.String(), models.AUDIT_ACTION_SAML_ASSERTION_ISSUE, provider.EntityID, err, nil, nil)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, SAML_SSO_ROUTE, err)
+		return
+	}
+	form, err := req.PostBinding()
+	if err != nil {
+		s.HandleError(w, http.StatusBadRequest, SAML_SSO_ROUTE, err)
+		return
+	}
+
+	w.Header().Set(CONTENT_TYPE, "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	err = samlResponsePage.Execute(w, form)
+	if err != nil {
+		s.requestLogger(r).WithError(err).Error("rendering the SAML response page")
+	}
+}
+
+// HandleSAMLServiceProvider handles the registration and retrieval of SAML
+// service providers. When called via POST, it registers a service provider
+// by importing its metadata. When called via GET, it retrieves all service
+// providers.
+func (s *Server) HandleSAMLServiceProvider(w http.ResponseWriter, r *http.Request) {
+	service := s.samlServiceProviderService()
+	var response []byte
+
+	switch r.Method {
+	case http.MethodGet:
+		result, err := service.GetAll()
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_SAML_SERVICE_PROVIDER_ROUTE, err)
+			return
+		}
+		response, err = json.Marshal(result)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_SAML_SERVICE_PROVIDER_ROUTE, err)
+			return
+		}
+	case http.MethodPost:
+		var providerRequest models.SAMLServiceProviderRequest
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&providerRequest)
+		if err != nil {
+			s.HandleError(w, http.StatusBadRequest, ADMIN_SAML_SERVICE_PROVIDER_ROUTE, err)
+			return
+		}
+		result, err := service.CreateServiceProvider(&providerRequest)
+		s.audit(r, models.AUDIT_ACTION_SAML_SP_CREATE, providerRequest.Name, err, nil, result)
+		if errors.Is(err, services.ErrInvalidSAMLServiceProvider) {
+			s.HandleError(w, http.StatusBadRequest, ADMIN_SAML_SERVICE_PROVIDER_ROUTE, err)
+			return
+		}
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_SAML_SERVICE_PROVIDER_ROUTE, err)
+			return
+		}
+		response, err = json.Marshal(result)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_SAML_SERVICE_PROVIDER_ROUTE, err)
+			return
+		}
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// HandleSAMLServiceProviderDetails handles the retrieval, update and deletion
+// of a SAML service provider.
+func (s *Server) HandleSAMLServiceProviderDetails(w http.ResponseWriter, r *http.Request) {
+	service := s.samlServiceProviderService()
+	var response []byte
+
+	provider, err := service.GetServiceProviderById(mux.Vars(r)["id"])
+	if err != nil {
+		s.HandleError(w, http.StatusNotFound, ADMIN_SAML_SERVICE_PROVIDER_DETAILS_ROUTE, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		response, err = json.Marshal(mapper.SAMLServiceProviderToSAMLServiceProviderDto(provider))
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_SAML_SERVICE_PROVIDER_DETAILS_ROUTE, err)
+			return
+		}
+	case http.MethodPut:
+		var providerRequest models.SAMLServiceProviderRequest
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&providerRequest)
+		if err != nil {
+			s.HandleError(w, http.StatusBadRequest, ADMIN_SAML_SERVICE_PROVIDER_DETAILS_ROUTE, err)
+			return
+		}
+		before := mapper.SAMLServiceProviderToSAMLServiceProviderDto(provider)
+		result, err := service.UpdateServiceProvider(provider, &providerRequest)
+		s.audit(r, models.AUDIT_ACTION_SAML_SP_UPDATE, provider.ID.String(), err, before, result)
+		if errors.Is(err, services.ErrInvalidSAMLServiceProvider) {
+			s.HandleError(w, http.StatusBadRequest, ADMIN_SAML_SERVICE_PROVIDER_DETAILS_ROUTE, err)
+			return
+		}
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_SAML_SERVICE_PROVIDER_DETAILS_ROUTE, err)
+			return
+		}
+		response, err = json.Marshal(result)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_SAML_SERVICE_PROVIDER_DETAILS_ROUTE, err)
+			return
+		}
+	case http.MethodDelete:
+		err := service.DeleteServiceProvider(provider)
+		s.audit(r, models.AUDIT_ACTION_SAML_SP_DELETE, provider.ID.String(), err, mapper.SAMLServiceProviderToSAMLServiceProviderDto(provider), nil)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_SAML_SERVICE_PROVIDER_DETAILS_ROUTE, err)
+			return
+		}
+		status := s.getStatusCode(r.Method)
+		w.WriteHeader(status)
+		return
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// samlIdentityProvider returns the identity provider the server acts as
+// towards SAML service providers.
+func (s *Server) samlIdentityProvider(service *services.SAMLIdentityProviderService) (*saml.IdentityProvider, error) {
+	return service.IdentityProvider(s.config.Issuer+SAML_IDP_METADATA_ROUTE, s.config.Issuer+SAML_SSO_ROUTE)
+}
+
+func (s *Server) samlIdentityProviderService() *services.SAMLIdentityProviderService {
+	return services.NewSAMLIdentityProviderService(
+		s.samlServiceProviderRepository.(*repository.SAMLServiceProviderRepository),
+		s.userRepository.(*repository.UserRepository),
+		s.roleRepository.(*repository.RoleRepository),
+		s.samlKey,
+		s.samlCertificate,
+	)
+}
+
+func (s *Server) samlServiceProviderService() *services.SAMLServiceProviderService {
+	return services.NewSAMLServiceProviderService(
+		s.samlServiceProviderRepository.(*repository.SAMLServiceProviderRepository),
+		s.applicationRepository.(*repository.ApplicationRepository),
+		&http.Client{Timeout: FEDERATION_HTTP_TIMEOUT},
+	)
+}
@@ -0,0 +1,307 @@
+package server
+
+import (
+	"auth-server/models"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/xml"
+	"html"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const testSPEntityID = "https://sp.example.com/saml/metadata"
+
+// newTestKeyPair returns an RSA key along with a self-signed certificate.
+func newTestKeyPair(t *testing.T, name string) (*rsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, certificate
+}
+
+// newTestServiceProvider returns a service provider relying on the server,
+// along with its registration.
+func newTestServiceProvider(t *testing.T, s *Server) (*saml.ServiceProvider, *models.SAMLServiceProvider) {
+	t.Helper()
+	key, certificate := newTestKeyPair(t, "sp.example.com")
+	idp, err := s.samlIdentityProvider(s.samlIdentityProviderService())
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadataURL, _ := url.Parse(testSPEntityID)
+	acsURL, _ := url.Parse("https://sp.example.com/saml/acs")
+	sp := &saml.ServiceProvider{
+		EntityID:    testSPEntityID,
+		Key:         key,
+		Certificate: certificate,
+		MetadataURL: *metadataURL,
+		AcsURL:      *acsURL,
+		IDPMetadata: s.samlIdentityProviderService().Metadata(idp),
+	}
+	metadata, err := xml.Marshal(sp.Metadata())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sp, &models.SAMLServiceProvider{
+		BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()},
+		Name:           "sp",
+		EntityID:       testSPEntityID,
+		Metadata:       string(metadata),
+		NameIDFormat:   models.SAML_NAMEID_FORMAT_PERSISTENT,
+		AttributeMappings: models.SAMLAttributeMappings{
+			{Name: "uid", Source: models.SAML_ATTRIBUTE_SOURCE_USERNAME},
+			{Name: "mail", Source: models.SAML_ATTRIBUTE_SOURCE_EMAIL},
+		},
+	}
+}
+
+func TestHandleSAMLIdentityProviderMetadata(t *testing.T) {
+	s, _ := newDatabaseTestServer(t)
+
+	w := httptest.NewRecorder()
+	s.HandleSAMLIdentityProviderMetadata(w, httptest.NewRequest(http.MethodGet, SAML_IDP_METADATA_ROUTE, nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status without a key pair = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	s.samlKey, s.samlCertificate = newTestKeyPair(t, "auth.example.com")
+	w = httptest.NewRecorder()
+	s.HandleSAMLIdentityProviderMetadata(w, httptest.NewRequest(http.MethodGet, SAML_IDP_METADATA_ROUTE, nil))
+	if w.Code != http.StatusOK || w.Header().Get(CONTENT_TYPE) != SAML_METADATA_CONTENT_TYPE {
+		t.Fatalf("status = %d, content type = %q", w.Code, w.Header().Get(CONTENT_TYPE))
+	}
+	var metadata saml.EntityDescriptor
+	err := xml.Unmarshal(w.Body.Bytes(), &metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.EntityID != testIssuer+SAML_IDP_METADATA_ROUTE {
+		t.Errorf("entity id = %q", metadata.EntityID)
+	}
+	descriptor := metadata.IDPSSODescriptors[0]
+	if len(descriptor.NameIDFormats) != 4 {
+		t.Errorf("name id formats = %v", descriptor.NameIDFormats)
+	}
+	for _, service := range descriptor.SingleSignOnServices {
+		if service.Location != testIssuer+SAML_SSO_ROUTE {
+			t.Errorf("%s single sign-on service at %q", service.Binding, service.Location)
+		}
+	}
+}
+
+func TestHandleSAMLSingleSignOn(t *testing.T) {
+	forceAuthn := true
+	tests := []struct {
+		name       string
+		noKeyPair  bool
+		forceAuthn bool
+		disabled   bool
+		unknown    bool
+		noSession  bool
+		loggedIn   time.Duration
+		locked     bool
+		malformed  bool
+		status     int
+	}{
+		{name: "logged in user", loggedIn: -time.Hour, status: http.StatusOK},
+		{name: "no key pair", noKeyPair: true, loggedIn: -time.Hour, status: http.StatusNotFound},
+		{name: "malformed request", malformed: true, loggedIn: -time.Hour, status: http.StatusBadRequest},
+		{name: "unknown service provider", unknown: true, loggedIn: -time.Hour, status: http.StatusBadRequest},
+		{name: "disabled service provider", disabled: true, loggedIn: -time.Hour, status: http.StatusBadRequest},
+		{name: "no session", noSession: true, status: http.StatusUnauthorized},
+		{name: "locked user", locked: true, loggedIn: -time.Hour, status: http.StatusForbidden},
+		{name: "forced authentication, logged in before the request", forceAuthn: true, loggedIn: -time.Hour, status: http.StatusUnauthorized},
+		{name: "forced authentication, logged in after the request", forceAuthn: true, loggedIn: time.Second, status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, fake := newDatabaseTestServer(t)
+			s.config.SessionIdleTimeout = time.Hour
+			s.samlKey, s.samlCertificate = newTestKeyPair(t, "auth.example.com")
+			sp, provider := newTestServiceProvider(t, s)
+			if tt.forceAuthn {
+				sp.ForceAuthn = &forceAuthn
+			}
+			provider.Disabled = tt.disabled
+			if !tt.unknown {
+				fake.Return(`FROM "saml_service_providers" WHERE entity_id = '`+testSPEntityID+`'`, provider)
+			}
+			user := newTestUser("alice")
+			user.Email = "alice@example.com"
+			user.AccountNonLocked = !tt.locked
+			fake.Return(`FROM "users" WHERE "users"."id" = '`+user.ID.String()+`'`, user)
+
+			authnRequest, err := sp.MakeAuthenticationRequest(testIssuer+SAML_SSO_ROUTE, saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			redirectURL, err := authnRequest.Redirect("relay", sp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.malformed {
+				redirectURL.RawQuery = "SAMLRequest=malformed"
+			}
+			session := &models.Session{
+				BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()},
+				TokenHash:      models.HashSessionToken("token"),
+				UserID:         user.ID,
+				AuthTime:       authnRequest.IssueInstant.Add(tt.loggedIn),
+				LastSeenAt:     time.Now(),
+				ExpiresAt:      time.Now().Add(time.Hour),
+			}
+			fake.Return(`FROM "sessions" WHERE token_hash = '`+session.TokenHash+`'`, session)
+			if tt.noKeyPair {
+				s.samlKey, s.samlCertificate = nil, nil
+			}
+			r := httptest.NewRequest(http.MethodGet, redirectURL.String(), nil)
+			if !tt.noSession {
+				r.AddCookie(&http.Cookie{Name: SESSION_COOKIE, Value: "token"})
+			}
+			w := httptest.NewRecorder()
+
+			s.HandleSAMLSingleSignOn(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			// The service provider accepts the response posted by the
+			// browser, and learns who the user is.
+			page := w.Body.String()
+			action := regexp.MustCompile(`action="([^"]+)"`).FindStringSubmatch(page)
+			response := regexp.MustCompile(`name="SAMLResponse" value="([^"]+)"`).FindStringSubmatch(page)
+			relayState := regexp.MustCompile(`name="RelayState" value="([^"]+)"`).FindStringSubmatch(page)
+			if action == nil || action[1] != sp.AcsURL.String() || response == nil || relayState == nil || relayState[1] != "relay" {
+				t.Fatalf("response page = %s", page)
+			}
+			form := url.Values{"SAMLResponse": {html.UnescapeString(response[1])}, "RelayState": {relayState[1]}}
+			post := httptest.NewRequest(http.MethodPost, action[1], strings.NewReader(form.Encode()))
+			post.Header.Set(CONTENT_TYPE, "application/x-www-form-urlencoded")
+			err = post.ParseForm()
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertion, err := sp.ParseResponse(post, []string{authnRequest.ID})
+			if err != nil {
+				if invalid, ok := err.(*saml.InvalidResponseError); ok {
+					err = invalid.PrivateErr
+				}
+				t.Fatalf("the service provider rejects the response: %v", err)
+			}
+			if nameID := assertion.Subject.NameID; nameID.Value != user.ID.String() || nameID.Format != string(saml.PersistentNameIDFormat) {
+				t.Errorf("name id = %+v, want the persistent id of the user", nameID)
+			}
+			attributes := map[string]string{}
+			for _, statement := range assertion.AttributeStatements {
+				for _, attribute := range statement.Attributes {
+					attributes[attribute.Name] = attribute.Values[0].Value
+				}
+			}
+			if len(attributes) != 2 || attributes["uid"] != "alice" || attributes["mail"] != "alice@example.com" {
+				t.Errorf("attributes = %v", attributes)
+			}
+		})
+	}
+}
+
+func TestHandleSAMLServiceProvider(t *testing.T) {
+	s, _ := newDatabaseTestServer(t)
+	s.samlKey, s.samlCertificate = newTestKeyPair(t, "auth.example.com")
+	_, provider := newTestServiceProvider(t, s)
+	metadata := jsonString(t, provider.Metadata)
+
+	tests := []struct {
+		name       string
+		method     string
+		id         string
+		body       string
+		status     int
+		statements []string
+	}{
+		{"list", http.MethodGet, "", "", http.StatusOK, []string{`SELECT * FROM "saml_service_providers" ORDER BY name`}},
+		{"create", http.MethodPost, "", `{"name":"other","metadata":` + metadata + `}`, http.StatusCreated, []string{`UPDATE "saml_service_providers" SET`, `"name"='other'`}},
+		{"create with invalid metadata", http.MethodPost, "", `{"name":"other","metadata":"<invalid"}`, http.StatusBadRequest, nil},
+		{"create with an unknown name id format", http.MethodPost, "", `{"name":"other","metadata":` + metadata + `,"name_id_format":"kerberos"}`, http.StatusBadRequest, nil},
+		{"create with a registered entity id", http.MethodPost, "", `{"name":"copy","metadata":` + metadata + `}`, http.StatusBadRequest, nil},
+		{"create with a malformed body", http.MethodPost, "", `{`, http.StatusBadRequest, nil},
+		{"get", http.MethodGet, provider.ID.String(), "", http.StatusOK, nil},
+		{"get unknown", http.MethodGet, uuid.NewString(), "", http.StatusNotFound, nil},
+		{"get with an invalid id", http.MethodGet, "invalid", "", http.StatusNotFound, nil},
+		{"update", http.MethodPut, provider.ID.String(), `{"name":"sp","metadata":` + metadata + `,"disabled":true}`, http.StatusAccepted, []string{`UPDATE "saml_service_providers"`, `"disabled"=true`}},
+		{"delete", http.MethodDelete, provider.ID.String(), "", http.StatusNoContent, []string{`DELETE FROM "saml_service_providers" WHERE id = '` + provider.ID.String() + `'`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, fake := newDatabaseTestServer(t)
+			fake.Return(`FROM "saml_service_providers" WHERE id = '`+provider.ID.String()+`'`, provider)
+			if tt.name == "create with a registered entity id" {
+				fake.Return(`FROM "saml_service_providers" WHERE entity_id = '`+testSPEntityID+`'`, provider)
+			}
+			// Created service providers are read back once saved.
+			if tt.method == http.MethodPost {
+				fake.Return(`FROM "saml_service_providers" WHERE id = '`, &models.SAMLServiceProvider{Name: "other"})
+			}
+			w := httptest.NewRecorder()
+			if tt.id != "" {
+				r := httptest.NewRequest(tt.method, ADMIN_SAML_SERVICE_PROVIDER_ROUTE+tt.id+"/", strings.NewReader(tt.body))
+				s.HandleSAMLServiceProviderDetails(w, mux.SetURLVars(r, map[string]string{"id": tt.id}))
+			} else {
+				s.HandleSAMLServiceProvider(w, httptest.NewRequest(tt.method, ADMIN_SAML_SERVICE_PROVIDER_ROUTE, strings.NewReader(tt.body)))
+			}
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			statements := strings.Join(fake.Statements(), "\n")
+			for _, statement := range tt.statements {
+				if !strings.Contains(statements, statement) {
+					t.Errorf("no statement contains %s:\n%s", statement, statements)
+				}
+			}
+			if tt.status == http.StatusBadRequest && (strings.Contains(statements, `UPDATE "saml_service_providers"`) || strings.Contains(statements, `INTO "saml_service_providers"`)) {
+				t.Errorf("invalid service provider saved:\n%s", statements)
+			}
+		})
+	}
+}
+
+func jsonString(t *testing.T, value string) string {
+	t.Helper()
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(encoded)
+}
@@ -0,0 +1,485 @@
+package server
+
+import (
+	"auth-server/mapper"
+	"auth-server/models"
+	"auth-server/repository"
+	"auth-server/services"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleSCIMUsers handles the provisioning and the search of users. When
+// called via POST, it creates a user from a SCIM user resource. When called
+// via GET, it returns a page of the users matching the filter query
+// parameter, as delimited by the startIndex and count query parameters.
+func (s *Server) HandleSCIMUsers(w http.ResponseWriter, r *http.Request) {
+	service := s.scimService(r)
+	var result interface{}
+
+	switch r.Method {
+	case http.MethodGet:
+		startIndex, count, err := scimPagination(r)
+		if err != nil {
+			s.HandleSCIMError(w, http.StatusBadRequest, "invalidValue", SCIM_USERS_ROUTE, err)
+			return
+		}
+		result, err = service.ListUsers(r.URL.Query().Get("filter"), startIndex, count)
+		if err != nil {
+			s.handleSCIMServiceError(w, SCIM_USERS_ROUTE, err)
+			return
+		}
+	case http.MethodPost:
+		var resource models.SCIMUser
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&resource)
+		if err != nil {
+			s.HandleSCIMError(w, http.StatusBadRequest, "invalidSyntax", SCIM_USERS_ROUTE, err)
+			return
+		}
+		user, err := service.CreateUser(&resource)
+		if err != nil {
+			s.audit(r, models.AUDIT_ACTION_USER_CREATE, resource.UserName, err, nil, nil)
+			s.handleSCIMServiceError(w, SCIM_USERS_ROUTE, err)
+			return
+		}
+		s.audit(r, models.AUDIT_ACTION_USER_CREATE, user.Username, nil, nil, mapper.UserToUserDto(user))
+		created := service.UserResource(user)
+		w.Header().Set("Location", created.Meta.Location)
+		result = created
+	}
+
+	s.writeSCIMResponse(w, r.Method, SCIM_USERS_ROUTE, result)
+}
+
+// HandleSCIMUserDetails handles the retrieval, replacement, modification and
+// deprovisioning of a user. Deactivating or deleting a user ends their
+// sessions.
+func (s *Server) HandleSCIMUserDetails(w http.ResponseWriter, r *http.Request) {
+	service := s.scimService(r)
+
+	user, err := service.GetUser(mux.Vars(r)["id"])
+	if err != nil {
+		s.handleSCIMServiceError(w, SCIM_USER_DETAILS_ROUTE, err)
+		return
+	}
+	wasEnabled := user.Enabled
+	before := mapper.UserToUserDto(user)
+
+	switch r.Method {
+	case http.MethodPut:
+		var resource models.SCIMUser
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&resource)
+		if err != nil {
+			s.HandleSCIMError(w, http.StatusBadRequest, "invalidSyntax", SCIM_USER_DETAILS_ROUTE, err)
+			return
+		}
+		user, err = service.ReplaceUser(user, &resource)
+		if err != nil {
+			s.audit(r, models.AUDIT_ACTION_USER_UPDATE, before.Username, err, before, nil)
+			s.handleSCIMServiceError(w, SCIM_USER_DETAILS_ROUTE, err)
+			return
+		}
+		s.audit(r, models.AUDIT_ACTION_USER_UPDATE, before.Username, nil, before, mapper.UserToUserDto(user))
+	case http.MethodPatch:
+		var patch models.SCIMPatchRequest
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&patch)
+		if err != nil {
+			s.HandleSCIMError(w, http.StatusBadRequest, "invalidSyntax", SCIM_USER_DETAILS_ROUTE, err)
+			return
+		}
+		user, err = service.PatchUser(user, &patch)
+		if err != nil {
+			s.audit(r, models.AUDIT_ACTION_USER_UPDATE, before.Username, err, before, nil)
+			s.handleSCIMServiceError(w, SCIM_USER_DETAILS_ROUTE, err)
+			return
+		}
+		s.audit(r, models.AUDIT_ACTION_USER_UPDATE, before.Username, nil, before, mapper.UserToUserDto(user))
+	case http.MethodDelete:
+		err := s.terminateUserSessions(user)
+		if err != nil {
+			s.HandleSCIMError(w, http.StatusInternalServerError, "", SCIM_USER_DETAILS_ROUTE, err)
+			return
+		}
+		err = service.DeleteUser(user)
+		s.audit(r, models.AUDIT_ACTION_USER_DELETE, before.Username, err, before, nil)
+		if err != nil {
+			s.HandleSCIMError(w, http.StatusInternalServerError, "", SCIM_USER_DETAILS_ROUTE, err)
+			return
+		}
+		s.writeSCIMResponse(w, r.Method, SCIM_USER_DETAILS_ROUTE, nil)
+		return
+	}
+
+	if wasEnabled && !user.Enabled {
+		err = s.terminateUserSessions(user)
+		if err != nil {
+			s.HandleSCIMError(w, http.StatusInternalServerError, "", SCIM_USER_DETAILS_ROUTE, err)
+			return
+		}
+	}
+	s.writeSCIMResponse(w, r.Method, SCIM_USER_DETAILS_ROUTE, service.UserResource(user))
+}
+
+// HandleSCIMGroups handles the provisioning and the search of groups. When
+// called via POST, it creates a top-level group from a SCIM group resource.
+// When called via GET, it returns a page of the groups matching the filter
+// query parameter, as delimited by the startIndex and count query
+// parameters.
+func (s *Server) HandleSCIMGroups(w http.ResponseWriter, r *http.Request) {
+	service := s.scimService(r)
+	var result interface{}
+
+	switch r.Method {
+	case http.MethodGet:
+		startIndex, count, err := scimPagination(r)
+		if err != nil {
+			s.HandleSCIMError(w, http.StatusBadRequest, "invalidValue", SCIM_GROUPS_ROUTE, err)
+			return
+		}
+		result, err = service.ListGroups(r.URL.Query().Get("filter"), startIndex, count)
+		if err != nil {
+			s.handleSCIMServiceError(w, SCIM_GROUPS_ROUTE, err)
+			return
+		}
+	case http.MethodPost:
+		var resource models.SCIMGroup
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&resource)
+		if err != nil {
+			s.HandleSCIMError(w, http.StatusBadRequest, "invalidSyntax", SCIM_GROUPS_ROUTE, err)
+			return
+		}
+		group, err := service.CreateGroup(&resource)
+		if err != nil {
+			s.audit(r, models.AUDIT_ACTION_GROUP_CREATE, resource.DisplayName, err, nil, nil)
+			s.handleSCIMServiceError(w, SCIM_GROUPS_ROUTE, err)
+			return
+		}
+		s.audit(r, models.AUDIT_ACTION_GROUP_CREATE, group.Name, nil, nil, mapper.GroupToGroupDto(group))
+		created := service.GroupResource(group)
+		w.Header().Set("Location", created.Meta.Location)
+		result = created
+	}
+
+	s.writeSCIMResponse(w, r.Method, SCIM_GROUPS_ROUTE, result)
+}
+
+// HandleSCIMGroupDetails handles the retrieval, replacement, modification and
+// deletion of a group.
+func (s *Server) HandleSCIMGroupDetails(w http.ResponseWriter, r *http.Request) {
+	service := s.scimService(r)
+
+	group, err := service.GetGroup(mux.Vars(r)["id"])
+	if err != nil {
+		s.handleSCIMServiceError(w, SCIM_GROUP_DETAILS_ROUTE, err)
+		return
+	}
+	before := mapper.GroupToGroupDto(group)
+
+	switch r.Method {
+	case http.MethodPut:
+		var resource models.SCIMGroup
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&resource)
+		if err != nil {
+			s.HandleSCIMError(w, http.StatusBadRequest, "invalidSyntax", SCIM_GROUP_DETAILS_ROUTE, err)
+			return
+		}
+		group, err = service.ReplaceGroup(group, &resource)
+		if err != nil {
+			s.audit(r, models.AUDIT_ACTION_GROUP_UPDATE, before.ID, err, before, nil)
+			s.handleSCIMServiceError(w, SCIM_GROUP_DETAILS_ROUTE, err)
+			return
+		}
+		s.audit(r, models.AUDIT_ACTION_GROUP_UPDATE, before.ID, nil, before, mapper.GroupToGroupDto(group))
+	case http.MethodPatch:
+		var patch models.SCIMPatchRequest
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&patch)
+		if err != nil {
+			s.HandleSCIMError(w, http.StatusBadRequest, "invalidSyntax", SCIM_GROUP_DETAILS_ROUTE, err)
+			return
+		}
+		group, err = service.PatchGroup(group, &patch)
+		if err != nil {
+			s.audit(r, models.AUDIT_ACTION_GROUP_UPDATE, before.ID, err, before, nil)
+			s.handleSCIMServiceError(w, SCIM_GROUP_DETAILS_ROUTE, err)
+			return
+		}
+		s.audit(r, models.AUDIT_ACTION_GROUP_UPDATE, before.ID, nil, before, mapper.GroupToGroupDto(group))
+	case http.MethodDelete:
+		err := service.DeleteGroup(group)
+		s.audit(r, models.AUDIT_ACTION_GROUP_DELETE, before.ID, err, before, nil)
+		if err != nil {
+			s.HandleSCIMError(w, http.StatusInternalServerError, "", SCIM_GROUP_DETAILS_ROUTE, err)
+			return
+		}
+		s.writeSCIMResponse(w, r.Method, SCIM_GROUP_DETAILS_ROUTE, nil)
+		return
+	}
+
+	s.writeSCIMResponse(w, r.Method, SCIM_GROUP_DETAILS_ROUTE, service.GroupResource(group))
+}
+
+// HandleSCIMServiceProviderConfig returns the SCIM features the server
+// supports.
+func (s *Server) HandleSCIMServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	s.writeSCIMResponse(w, r.Method, SCIM_SERVICE_PROVIDER_CONFIG_ROUTE, scimServiceProviderConfig(s.scimBaseURI(r)))
+}
+
+// HandleSCIMSchemas returns the schemas of the resources the server serves,
+// or the one whose id is given in the path.
+func (s *Server) HandleSCIMSchemas(w http.ResponseWriter, r *http.Request) {
+	schemas := scimSchemas(s.scimBaseURI(r))
+	id, ok := mux.Vars(r)["id"]
+	if !ok {
+		s.writeSCIMResponse(w, r.Method, SCIM_SCHEMAS_ROUTE, scimDiscoveryList(len(schemas), schemas))
+		return
+	}
+	for _, schema := range schemas {
+		if schema.ID == id {
+			s.writeSCIMResponse(w, r.Method, SCIM_SCHEMA_DETAILS_ROUTE, schema)
+			return
+		}
+	}
+	s.HandleSCIMError(w, http.StatusNotFound, "", SCIM_SCHEMA_DETAILS_ROUTE, fmt.Errorf("unknown schema %q", id))
+}
+
+// HandleSCIMResourceTypes returns the types of the resources the server
+// serves, or the one whose id is given in the path.
+func (s *Server) HandleSCIMResourceTypes(w http.ResponseWriter, r *http.Request) {
+	resourceTypes := scimResourceTypes(s.scimBaseURI(r))
+	id, ok := mux.Vars(r)["id"]
+	if !ok {
+		s.writeSCIMResponse(w, r.Method, SCIM_RESOURCE_TYPES_ROUTE, scimDiscoveryList(len(resourceTypes), resourceTypes))
+		return
+	}
+	for _, resourceType := range resourceTypes {
+		if resourceType.ID == id {
+			s.writeSCIMResponse(w, r.Method, SCIM_RESOURCE_TYPE_DETAILS_ROUTE, resourceType)
+			return
+		}
+	}
+	s.HandleSCIMError(w, http.StatusNotFound, "", SCIM_RESOURCE_TYPE_DETAILS_ROUTE, fmt.Errorf("unknown resource type %q", id))
+}
+
+// writeSCIMResponse writes the resource with the status SCIM clients expect
+// for the method: 201 for POST, 204 for DELETE, and 200 otherwise, PUT
+// included.
+func (s *Server) writeSCIMResponse(w http.ResponseWriter, method string, route string, result interface{}) {
+	status := http.StatusOK
+	switch method {
+	case http.MethodPost:
+		status = http.StatusCreated
+	case http.MethodDelete:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	response, err := json.Marshal(result)
+	if err != nil {
+		s.HandleSCIMError(w, http.StatusInternalServerError, "", route, err)
+		return
+	}
+	w.Header().Set(CONTENT_TYPE, SCIM_CONTENT_TYPE)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// handleSCIMServiceError reports an error returned by SCIMService with the
+// status and the error type of RFC 7644, section 3.12.
+func (s *Server) handleSCIMServiceError(w http.ResponseWriter, route string, err error) {
+	switch {
+	case errors.Is(err, services.ErrSCIMResourceNotFound):
+		s.HandleSCIMError(w, http.StatusNotFound, "", route, err)
+	case errors.Is(err, services.ErrSCIMInvalidFilter):
+		s.HandleSCIMError(w, http.StatusBadRequest, "invalidFilter", route, err)
+	case errors.Is(err, services.ErrSCIMInvalidPath):
+		s.HandleSCIMError(w, http.StatusBadRequest, "invalidPath", route, err)
+	case errors.Is(err, services.ErrSCIMInvalidValue):
+		s.HandleSCIMError(w, http.StatusBadRequest, "invalidValue", route, err)
+	case errors.Is(err, services.ErrSCIMMutability):
+		s.HandleSCIMError(w, http.StatusBadRequest, "mutability", route, err)
+	case errors.Is(err, services.ErrSCIMUniqueness):
+		s.HandleSCIMError(w, http.StatusConflict, "uniqueness", route, err)
+	default:
+		s.HandleSCIMError(w, http.StatusInternalServerError, "", route, err)
+	}
+}
+
+// terminateUserSessions ends the sessions of the user, and notifies the
+// clients that took part in them.
+func (s *Server) terminateUserSessions(user *models.User) error {
+	sessions, err := s.sessionService().TerminateSessions(user)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		s.notifyLogout(session)
+	}
+	return nil
+}
+
+// scimPagination returns the 1-based index of the first resource to return
+// and the number of resources to return, as requested with the startIndex
+// and count query parameters. Values out of range are clamped, as described
+// in RFC 7644, section 3.4.2.4.
+func scimPagination(r *http.Request) (int, int, error) {
+	startIndex := 1
+	count := SCIM_DEFAULT_PAGE_SIZE
+	query := r.URL.Query()
+	if value := query.Get("startIndex"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid startIndex %q", value)
+		}
+		if parsed > 1 {
+			startIndex = parsed
+		}
+	}
+	if value := query.Get("count"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid count %q", value)
+		}
+		count = parsed
+	}
+	if count < 0 {
+		count = 0
+	}
+	if count > SCIM_MAX_PAGE_SIZE {
+		count = SCIM_MAX_PAGE_SIZE
+	}
+	return startIndex, count, nil
+}
+
+// scimBaseURI returns the URI of the SCIM endpoints.
+func (s *Server) scimBaseURI(r *http.Request) string {
+	return s.baseURL(r) + "/scim/v2"
+}
+
+func (s *Server) scimService(r *http.Request) *services.SCIMService {
+	return services.NewSCIMService(
+		s.userRepository.(*repository.UserRepository),
+		s.groupRepository.(*repository.GroupRepository),
+		s.roleRepository.(*repository.RoleRepository),
+		s.hasher,
+		s.scimBaseURI(r),
+	).WithEvents(s.webhookDispatcher())
+}
+
+// scimServiceProviderConfig describes the SCIM features the server supports.
+func scimServiceProviderConfig(baseURI string) *models.SCIMServiceProviderConfig {
+	return &models.SCIMServiceProviderConfig{
+		Schemas:        []string{models.SCIM_SCHEMA_SERVICE_PROVIDER_CONFIG},
+		Patch:          models.SCIMSupported{Supported: true},
+		Bulk:           models.SCIMBulkSupport{Supported: false},
+		Filter:         models.SCIMFilterSupport{Supported: true, MaxResults: SCIM_MAX_PAGE_SIZE},
+		ChangePassword: models.SCIMSupported{Supported: true},
+		Sort:           models.SCIMSupported{Supported: false},
+		ETag:           models.SCIMSupported{Supported: false},
+		AuthenticationSchemes: []*models.SCIMAuthenticationScheme{
+			{
+				Type:        "oauthbearertoken",
+				Name:        "OAuth Bearer Token",
+				Description: "Access tokens granted the " + SCIM_SCOPE + " scope with the client credentials grant",
+				Primary:     true,
+			},
+		},
+		Meta: &models.SCIMMeta{
+			ResourceType: "ServiceProviderConfig",
+			Location:     baseURI + "/ServiceProviderConfig",
+		},
+	}
+}
+
+// scimResourceTypes describes the types of the resources the server serves.
+func scimResourceTypes(baseURI string) []*models.SCIMResourceType {
+	return []*models.SCIMResourceType{
+		{
+			Schemas:     []string{models.SCIM_SCHEMA_RESOURCE_TYPE},
+			ID:          "User",
+			Name:        "User",
+			Endpoint:    "/Users",
+			Description: "User Account",
+			Schema:      models.SCIM_SCHEMA_USER,
+			Meta:        &models.SCIMMeta{ResourceType: "ResourceType", Location: baseURI + "/ResourceTypes/User"},
+		},
+		{
+			Schemas:     []string{models.SCIM_SCHEMA_RESOURCE_TYPE},
+			ID:          "Group",
+			Name:        "Group",
+			Endpoint:    "/Groups",
+			Description: "Group",
+			Schema:      models.SCIM_SCHEMA_GROUP,
+			Meta:        &models.SCIMMeta{ResourceType: "ResourceType", Location: baseURI + "/ResourceTypes/Group"},
+		},
+	}
+}
+
+// scimSchemas describes the attributes of the resources the server serves.
+// Only the attributes the server stores are listed.
+func scimSchemas(baseURI string) []*models.SCIMSchema {
+	reference := func(name string, description string, mutability string) *models.SCIMSchemaAttribute {
+		return &models.SCIMSchemaAttribute{
+			Name: name, Type: "complex", MultiValued: true, Description: description,
+			Mutability: mutability, Returned: "default", Uniqueness: "none",
+			SubAttributes: []*models.SCIMSchemaAttribute{
+				{Name: "value", Type: "string", Description: "The id of the resource", Mutability: mutability, Returned: "default", Uniqueness: "none"},
+				{Name: "display", Type: "string", Description: "The name of the resource", Mutability: "readOnly", Returned: "default", Uniqueness: "none"},
+			},
+		}
+	}
+	return []*models.SCIMSchema{
+		{
+			Schemas:     []string{models.SCIM_SCHEMA_SCHEMA},
+			ID:          models.SCIM_SCHEMA_USER,
+			Name:        "User",
+			Description: "User Account",
+			Attributes: []*models.SCIMSchemaAttribute{
+				{Name: "userName", Type: "string", Description: "Unique identifier for the user, used to log in", Required: true, Mutability: "readWrite", Returned: "default", Uniqueness: "server"},
+				{Name: "password", Type: "string", Description: "The password of the user", Mutability: "writeOnly", Returned: "never", Uniqueness: "none"},
+				{Name: "active", Type: "boolean", Description: "Whether the user can log in", Mutability: "readWrite", Returned: "default", Uniqueness: "none"},
+				{
+					Name: "emails", Type: "complex", MultiValued: true, Description: "The email of the user, which must be unique", Required: true,
+					Mutability: "readWrite", Returned: "default", Uniqueness: "none",
+					SubAttributes: []*models.SCIMSchemaAttribute{
+						{Name: "value", Type: "string", Description: "Email address", Mutability: "readWrite", Returned: "default", Uniqueness: "server"},
+						{Name: "primary", Type: "boolean", Description: "Whether this is the email the user is reached at", Mutability: "readWrite", Returned: "default", Uniqueness: "none"},
+					},
+				},
+				reference("groups", "The groups the user is a member of", "readOnly"),
+				reference("roles", "The roles assigned to the user directly", "readWrite"),
+			},
+			Meta: &models.SCIMMeta{ResourceType: "Schema", Location: baseURI + "/Schemas/" + models.SCIM_SCHEMA_USER},
+		},
+		{
+			Schemas:     []string{models.SCIM_SCHEMA_SCHEMA},
+			ID:          models.SCIM_SCHEMA_GROUP,
+			Name:        "Group",
+			Description: "Group",
+			Attributes: []*models.SCIMSchemaAttribute{
+				{Name: "displayName", Type: "string", Description: "The name of the group, unique among its siblings", Required: true, Mutability: "readWrite", Returned: "default", Uniqueness: "none"},
+				reference("members", "The users who are members of the group", "readWrite"),
+			},
+			Meta: &models.SCIMMeta{ResourceType: "Schema", Location: baseURI + "/Schemas/" + models.SCIM_SCHEMA_GROUP},
+		},
+	}
+}
+
+func scimDiscoveryList(total int, resources interface{}) *models.SCIMListResponse {
+	return &models.SCIMListResponse{
+		Schemas:      []string{models.SCIM_MESSAGE_LIST_RESPONSE},
+		TotalResults: int64(total),
+		StartIndex:   1,
+		ItemsPerPage: total,
+		Resources:    resources,
+	}
+}
@@ -0,0 +1,374 @@
+package server
+
+import (
+	"auth-server/models"
+	"auth-server/repository/repositorytest"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// serveSCIM sends the request to the SCIM handler of the path, along with the
+// id of the resource it names, if any.
+func serveSCIM(s *Server, method string, path string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	resource, id, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/scim/v2/"), "/")
+	if id != "" {
+		r = mux.SetURLVars(r, map[string]string{"id": id})
+	}
+	switch {
+	case resource == "Users" && id == "":
+		s.HandleSCIMUsers(w, r)
+	case resource == "Users":
+		s.HandleSCIMUserDetails(w, r)
+	case resource == "Groups" && id == "":
+		s.HandleSCIMGroups(w, r)
+	default:
+		s.HandleSCIMGroupDetails(w, r)
+	}
+	return w
+}
+
+// scimCase is a request to a SCIM endpoint, along with the response and the
+// statements expected.
+type scimCase struct {
+	name       string
+	method     string
+	path       string
+	body       string
+	setup      func(fake *repositorytest.DB)
+	status     int
+	scimType   string
+	statements []string
+}
+
+// run serves the request with a server whose database holds the rows the
+// stub function and the case's setup give it.
+func (tt scimCase) run(t *testing.T, stub func(fake *repositorytest.DB)) (*httptest.ResponseRecorder, string) {
+	t.Helper()
+	s, fake := newDatabaseTestServer(t)
+	if tt.setup != nil {
+		tt.setup(fake)
+	}
+	stub(fake)
+	w := serveSCIM(s, tt.method, tt.path, tt.body)
+	if w.Code != tt.status {
+		t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+	}
+	if got := w.Header().Get(CONTENT_TYPE); w.Code != http.StatusNoContent && got != SCIM_CONTENT_TYPE {
+		t.Errorf("content type = %q", got)
+	}
+	if tt.scimType != "" {
+		var response models.SCIMErrorResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		if err != nil || response.ScimType != tt.scimType || response.Status != strconv.Itoa(tt.status) {
+			t.Errorf("error = %s, want scimType %s", w.Body, tt.scimType)
+		}
+	}
+	statements := strings.Join(fake.Statements(), "\n")
+	for _, statement := range tt.statements {
+		if !strings.Contains(statements, statement) {
+			t.Errorf("no statement contains %s:\n%s", statement, statements)
+		}
+	}
+	return w, statements
+}
+
+func TestHandleSCIMUsers(t *testing.T) {
+	alice := newTestUser("alice")
+	carol := newTestUser("carol")
+
+	tests := []scimCase{
+		{
+			name:   "list",
+			method: http.MethodGet,
+			path:   `/scim/v2/Users?filter=userName+eq+"alice"&startIndex=2&count=1`,
+			setup: func(fake *repositorytest.DB) {
+				fake.ReturnColumns(`SELECT count(*) FROM "users"`, []string{"count"}, []driver.Value{int64(3)})
+				fake.Return(`SELECT * FROM "users" WHERE ((LOWER(username) = LOWER('alice')))`, alice)
+			},
+			status:     http.StatusOK,
+			statements: []string{`WHERE ((LOWER(username) = LOWER('alice'))) ORDER BY username LIMIT 1 OFFSET 1`},
+		},
+		{name: "unsupported filter", method: http.MethodGet, path: `/scim/v2/Users?filter=nickName+eq+"al"`, status: http.StatusBadRequest, scimType: "invalidFilter"},
+		{name: "malformed filter", method: http.MethodGet, path: `/scim/v2/Users?filter=userName+eq`, status: http.StatusBadRequest, scimType: "invalidFilter"},
+		{name: "invalid count", method: http.MethodGet, path: `/scim/v2/Users?count=ten`, status: http.StatusBadRequest, scimType: "invalidValue"},
+		{
+			name:   "create",
+			method: http.MethodPost,
+			path:   "/scim/v2/Users",
+			body:   `{"userName":"carol","password":"secret","emails":[{"value":"carol@example.com"}]}`,
+			setup: func(fake *repositorytest.DB) {
+				// The user is read back once saved.
+				fake.Return(`FROM "users" WHERE id = '`, carol)
+			},
+			status:     http.StatusCreated,
+			statements: []string{`"username"='carol'`, `"password"='plain$secret'`, `"enabled"=true`},
+		},
+		{name: "create with a taken userName", method: http.MethodPost, path: "/scim/v2/Users", body: `{"userName":"alice","emails":[{"value":"other@example.com"}]}`, status: http.StatusConflict, scimType: "uniqueness"},
+		{name: "create with a taken email", method: http.MethodPost, path: "/scim/v2/Users", body: `{"userName":"carol","emails":[{"value":"alice@example.com"}]}`, status: http.StatusConflict, scimType: "uniqueness"},
+		{name: "create without an email", method: http.MethodPost, path: "/scim/v2/Users", body: `{"userName":"carol"}`, status: http.StatusBadRequest, scimType: "invalidValue"},
+		{name: "create with an unknown role", method: http.MethodPost, path: "/scim/v2/Users", body: `{"userName":"carol","emails":[{"value":"carol@example.com"}],"roles":[{"value":"` + uuid.NewString() + `"}]}`, status: http.StatusBadRequest, scimType: "invalidValue"},
+		{name: "create with a malformed body", method: http.MethodPost, path: "/scim/v2/Users", body: `{`, status: http.StatusBadRequest, scimType: "invalidSyntax"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, statements := tt.run(t, func(fake *repositorytest.DB) {
+				fake.Return(`FROM "users" WHERE username = 'alice'`, alice)
+				fake.Return(`FROM "users" WHERE email = 'alice@example.com'`, alice)
+			})
+			if tt.status >= http.StatusBadRequest && strings.Contains(statements, `UPDATE "users"`) {
+				t.Errorf("invalid user saved:\n%s", statements)
+			}
+			switch tt.name {
+			case "list":
+				var page models.SCIMListResponse
+				json.Unmarshal(w.Body.Bytes(), &page)
+				if page.TotalResults != 3 || page.StartIndex != 2 || page.ItemsPerPage != 1 {
+					t.Errorf("page = %s", w.Body)
+				}
+			case "create":
+				location := w.Header().Get("Location")
+				if location != testIssuer+"/scim/v2/Users/"+carol.ID.String() {
+					t.Errorf("Location = %q", location)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleSCIMUserDetails(t *testing.T) {
+	alice := newTestUser("alice")
+	disabled := *alice
+	disabled.Enabled = false
+	staff := &models.Group{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, Name: "staff"}
+	path := "/scim/v2/Users/" + alice.ID.String()
+	// Deactivating a user reads them back disabled.
+	deactivated := func(fake *repositorytest.DB) {
+		fake.ReturnOnce(`FROM "users" WHERE id = '`+alice.ID.String()+`'`, alice)
+		fake.Return(`FROM "users" WHERE id = '`+alice.ID.String()+`'`, &disabled)
+	}
+	endSessions := `DELETE FROM "sessions" WHERE user_id = '` + alice.ID.String() + `'`
+
+	tests := []struct {
+		scimCase
+		active      bool
+		endSessions bool
+	}{
+		{scimCase: scimCase{name: "get", method: http.MethodGet, path: path, status: http.StatusOK}, active: true},
+		{scimCase: scimCase{name: "get unknown", method: http.MethodGet, path: "/scim/v2/Users/" + uuid.NewString(), status: http.StatusNotFound}},
+		{scimCase: scimCase{name: "get with an invalid id", method: http.MethodGet, path: "/scim/v2/Users/alice", status: http.StatusNotFound}},
+		{
+			scimCase: scimCase{
+				name: "replace", method: http.MethodPut, path: path,
+				body:   `{"userName":"alice","emails":[{"value":"alice@example.com"}],"active":false}`,
+				setup:  deactivated,
+				status: http.StatusOK, statements: []string{`"enabled"=false`},
+			},
+			endSessions: true,
+		},
+		{scimCase: scimCase{name: "replace with another id", method: http.MethodPut, path: path, body: `{"id":"` + uuid.NewString() + `","userName":"alice","emails":[{"value":"alice@example.com"}]}`, status: http.StatusBadRequest, scimType: "mutability"}},
+		{scimCase: scimCase{name: "replace with a malformed body", method: http.MethodPut, path: path, body: `[]`, status: http.StatusBadRequest, scimType: "invalidSyntax"}},
+		{
+			scimCase: scimCase{
+				name: "patch active", method: http.MethodPatch, path: path,
+				body:   `{"Operations":[{"op":"Replace","path":"active","value":"False"}]}`,
+				setup:  deactivated,
+				status: http.StatusOK, statements: []string{`"enabled"=false`},
+			},
+			endSessions: true,
+		},
+		{
+			scimCase: scimCase{
+				name: "patch email", method: http.MethodPatch, path: path,
+				body:   `{"Operations":[{"op":"replace","path":"emails[type eq \"work\"].value","value":"alice@example.org"}]}`,
+				status: http.StatusOK, statements: []string{`"email"='alice@example.org'`},
+			},
+			active: true,
+		},
+		{scimCase: scimCase{name: "patch groups", method: http.MethodPatch, path: path, body: `{"Operations":[{"op":"add","path":"groups","value":[{"value":"` + staff.ID.String() + `"}]}]}`, status: http.StatusBadRequest, scimType: "mutability"}},
+		{scimCase: scimCase{name: "patch with an unknown operation", method: http.MethodPatch, path: path, body: `{"Operations":[{"op":"move","path":"active","value":false}]}`, status: http.StatusBadRequest, scimType: "invalidValue"}},
+		{scimCase: scimCase{name: "patch with a malformed path", method: http.MethodPatch, path: path, body: `{"Operations":[{"op":"replace","path":"emails[type eq","value":"x"}]}`, status: http.StatusBadRequest, scimType: "invalidPath"}},
+		{scimCase: scimCase{name: "patch removing the userName", method: http.MethodPatch, path: path, body: `{"Operations":[{"op":"remove","path":"userName"}]}`, status: http.StatusBadRequest, scimType: "invalidValue"}},
+		{
+			scimCase:    scimCase{name: "delete", method: http.MethodDelete, path: path, status: http.StatusNoContent, statements: []string{`DELETE FROM "users" WHERE id = '` + alice.ID.String() + `'`}},
+			endSessions: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, statements := tt.run(t, func(fake *repositorytest.DB) {
+				fake.Return(`FROM "users" WHERE id = '`+alice.ID.String()+`'`, alice)
+				fake.Return(`JOIN "user_groups" ON "user_groups"."group_id" = "groups"."id" AND "user_groups"."user_id" = '`+alice.ID.String()+`'`, staff)
+			})
+			if tt.status >= http.StatusBadRequest && strings.Contains(statements, `UPDATE "users"`) {
+				t.Errorf("invalid user saved:\n%s", statements)
+			}
+			// Users lose their sessions once they cannot log in anymore.
+			if ended := strings.Contains(statements, endSessions); ended != tt.endSessions {
+				t.Errorf("sessions ended = %v, want %v", ended, tt.endSessions)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var user models.SCIMUser
+			json.Unmarshal(w.Body.Bytes(), &user)
+			if user.ID != alice.ID.String() || user.Active == nil || *user.Active != tt.active {
+				t.Errorf("user = %s", w.Body)
+			}
+			if len(user.Groups) != 1 || user.Groups[0].Value != staff.ID.String() {
+				t.Errorf("groups = %s", w.Body)
+			}
+		})
+	}
+}
+
+func TestHandleSCIMGroups(t *testing.T) {
+	alice := newTestUser("alice")
+	staff := &models.Group{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, Name: "staff"}
+
+	tests := []scimCase{
+		{
+			name:   "list",
+			method: http.MethodGet,
+			path:   `/scim/v2/Groups?filter=displayName+sw+"st"`,
+			setup: func(fake *repositorytest.DB) {
+				fake.ReturnColumns(`SELECT count(*) FROM "groups"`, []string{"count"}, []driver.Value{int64(1)})
+				fake.Return(`SELECT * FROM "groups" WHERE`, staff)
+			},
+			status:     http.StatusOK,
+			statements: []string{`LIKE LOWER('st%')`, `ORDER BY name,id LIMIT 100`},
+		},
+		{name: "malformed filter", method: http.MethodGet, path: `/scim/v2/Groups?filter=displayName+eq+"staff`, status: http.StatusBadRequest, scimType: "invalidFilter"},
+		{
+			name:   "create",
+			method: http.MethodPost,
+			path:   "/scim/v2/Groups",
+			body:   `{"displayName":"staff","members":[{"value":"` + alice.ID.String() + `"}]}`,
+			setup: func(fake *repositorytest.DB) {
+				// The group is read back once saved.
+				fake.Return(`FROM "groups" WHERE id = '`, staff)
+			},
+			status:     http.StatusCreated,
+			statements: []string{`"name"='staff',"parent_id"=NULL`, `INSERT INTO "user_groups"`, `'` + alice.ID.String() + `')`},
+		},
+		{name: "create with an unknown member", method: http.MethodPost, path: "/scim/v2/Groups", body: `{"displayName":"staff","members":[{"value":"` + uuid.NewString() + `"}]}`, status: http.StatusBadRequest, scimType: "invalidValue"},
+		{
+			name:   "create with a taken displayName",
+			method: http.MethodPost,
+			path:   "/scim/v2/Groups",
+			body:   `{"displayName":"staff"}`,
+			setup: func(fake *repositorytest.DB) {
+				fake.Return(`FROM "groups" WHERE name = 'staff' AND parent_id IS NULL`, staff)
+			},
+			status:   http.StatusConflict,
+			scimType: "uniqueness",
+		},
+		{name: "create without a displayName", method: http.MethodPost, path: "/scim/v2/Groups", body: `{"members":[]}`, status: http.StatusBadRequest, scimType: "invalidValue"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, statements := tt.run(t, func(fake *repositorytest.DB) {
+				fake.Return(`FROM "users" WHERE id = '`+alice.ID.String()+`'`, alice)
+			})
+			if tt.status >= http.StatusBadRequest && strings.Contains(statements, `UPDATE "groups"`) {
+				t.Errorf("invalid group saved:\n%s", statements)
+			}
+			if tt.name == "create" && w.Header().Get("Location") != testIssuer+"/scim/v2/Groups/"+staff.ID.String() {
+				t.Errorf("Location = %q", w.Header().Get("Location"))
+			}
+		})
+	}
+}
+
+func TestHandleSCIMGroupDetails(t *testing.T) {
+	alice := newTestUser("alice")
+	bob := newTestUser("bob")
+	staff := &models.Group{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, Name: "staff"}
+	path := "/scim/v2/Groups/" + staff.ID.String()
+	// gorm orders the columns of the join table after whichever side of the
+	// relation it parsed first, so the pair is accepted in either order.
+	isMember := func(statements string, user *models.User) bool {
+		return strings.Contains(statements, `('`+staff.ID.String()+`','`+user.ID.String()+`')`) ||
+			strings.Contains(statements, `('`+user.ID.String()+`','`+staff.ID.String()+`')`)
+	}
+	members := map[string][]*models.User{"add a member": {alice, bob}, "replace": {bob}}
+	// The members left out of the group are removed from it.
+	removeOthers := func(user *models.User) string {
+		return `DELETE FROM "user_groups" WHERE "user_groups"."group_id" = '` + staff.ID.String() + `' AND "user_groups"."user_id" <> '` + user.ID.String() + `'`
+	}
+
+	tests := []scimCase{
+		{name: "get", method: http.MethodGet, path: path, status: http.StatusOK},
+		{name: "get unknown", method: http.MethodGet, path: "/scim/v2/Groups/" + uuid.NewString(), status: http.StatusNotFound},
+		{name: "get with an invalid id", method: http.MethodGet, path: "/scim/v2/Groups/staff", status: http.StatusNotFound},
+		{
+			name: "add a member", method: http.MethodPatch, path: path,
+			body:       `{"Operations":[{"op":"add","path":"members","value":[{"value":"` + bob.ID.String() + `"}]}]}`,
+			status:     http.StatusOK,
+			statements: []string{`INSERT INTO "user_groups"`},
+		},
+		{
+			name: "remove a member by filter", method: http.MethodPatch, path: path,
+			body:       `{"Operations":[{"op":"remove","path":"members[value eq \"` + alice.ID.String() + `\"]"}]}`,
+			status:     http.StatusOK,
+			statements: []string{`DELETE FROM "user_groups" WHERE "user_groups"."group_id" = '` + staff.ID.String() + `'`},
+		},
+		{
+			name: "rename without a path", method: http.MethodPatch, path: path,
+			body:       `{"Operations":[{"op":"replace","value":{"displayName":"team"}}]}`,
+			status:     http.StatusOK,
+			statements: []string{`"name"='team'`, removeOthers(alice)},
+		},
+		{name: "remove the displayName", method: http.MethodPatch, path: path, body: `{"Operations":[{"op":"remove","path":"displayName"}]}`, status: http.StatusBadRequest, scimType: "invalidValue"},
+		{name: "patch the id", method: http.MethodPatch, path: path, body: `{"Operations":[{"op":"replace","path":"id","value":"other"}]}`, status: http.StatusBadRequest, scimType: "mutability"},
+		{name: "remove members by another attribute", method: http.MethodPatch, path: path, body: `{"Operations":[{"op":"remove","path":"members[display eq \"alice\"]"}]}`, status: http.StatusBadRequest, scimType: "invalidPath"},
+		{
+			name: "replace", method: http.MethodPut, path: path,
+			body:       `{"displayName":"staff","members":[{"value":"` + bob.ID.String() + `"}]}`,
+			status:     http.StatusOK,
+			statements: []string{`INSERT INTO "user_groups"`, removeOthers(bob)},
+		},
+		{name: "replace with another id", method: http.MethodPut, path: path, body: `{"id":"` + uuid.NewString() + `","displayName":"staff"}`, status: http.StatusBadRequest, scimType: "mutability"},
+		{
+			name: "delete", method: http.MethodDelete, path: path,
+			status:     http.StatusNoContent,
+			statements: []string{`UPDATE "groups" SET "parent_id"=NULL`, `DELETE FROM "groups" WHERE "groups"."id" = '` + staff.ID.String() + `'`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, statements := tt.run(t, func(fake *repositorytest.DB) {
+				fake.Return(`FROM "groups" WHERE id = '`+staff.ID.String()+`'`, staff)
+				fake.ReturnColumns(`FROM "user_groups" WHERE "user_groups"."group_id" = '`+staff.ID.String()+`'`, []string{"group_id", "user_id"}, []driver.Value{staff.ID.String(), alice.ID.String()})
+				fake.Return(`FROM "users" WHERE "users"."id" = '`+alice.ID.String()+`'`, alice)
+				fake.Return(`FROM "users" WHERE id = '`+alice.ID.String()+`'`, alice)
+				fake.Return(`FROM "users" WHERE id = '`+bob.ID.String()+`'`, bob)
+			})
+			if tt.status >= http.StatusBadRequest && strings.Contains(statements, `UPDATE "groups"`) {
+				t.Errorf("invalid group saved:\n%s", statements)
+			}
+			for _, user := range members[tt.name] {
+				if !isMember(statements, user) {
+					t.Errorf("%s not added to the group:\n%s", user.Username, statements)
+				}
+			}
+			if tt.name != "get" {
+				return
+			}
+			var group models.SCIMGroup
+			json.Unmarshal(w.Body.Bytes(), &group)
+			if group.DisplayName != "staff" || len(group.Members) != 1 || group.Members[0].Value != alice.ID.String() {
+				t.Errorf("group = %s", w.Body)
+			}
+		})
+	}
+}
@@ -1,41 +1,100 @@
 package server
 
 import (
+	"auth-server/cache"
 	"auth-server/hasher"
 	"auth-server/logger"
 	"auth-server/models"
 	"auth-server/repository"
 	"context"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/crewjam/saml"
 	"github.com/gorilla/handlers"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
 type ServerConfig struct {
-	Timeout int
-	Addr    string
-	Secret  []byte
+	Timeout            int
+	Addr               string
+	Secret             []byte
+	Issuer             string
+	Claims             *models.ClaimsConfig
+	AllowFileJwks      bool
+	TLSCertFile        string
+	TLSKeyFile         string
+	ClientCAFile       string
+	DPoPRequireNonce   bool
+	RegistrationToken  string
+	AllowedOrigins     []string
+	SessionIdleTimeout time.Duration
+	SessionMaxAge      time.Duration
+	InsecureCookies    bool
+	SAMLCertFile       string
+	SAMLKeyFile        string
+	AuditHashChain     bool
+	LogLevel           logger.Level
+	LogFormat          logger.Format
+	TraceExporter      string
 }
 
 type Server struct {
-	config                *ServerConfig
-	DB                    *gorm.DB
-	clientRepository      repository.Repository[models.Client]
-	applicationRepository repository.Repository[models.Application]
-	userRepository        repository.Repository[models.User]
-	roleRepository        repository.Repository[models.Role]
-	permissionRepository  repository.Repository[models.Permission]
-	logger                *logger.Logger
-	hasher                hasher.Hasher
+	config                        *ServerConfig
+	DB                            *gorm.DB
+	clientRepository              repository.Repository[models.Client]
+	applicationRepository         repository.Repository[models.Application]
+	userRepository                repository.Repository[models.User]
+	roleRepository                repository.Repository[models.Role]
+	permissionRepository          repository.Repository[models.Permission]
+	groupRepository               repository.Repository[models.Group]
+	policyRepository              repository.Repository[models.Policy]
+	deviceCodeRepository          repository.Repository[models.DeviceCode]
+	clientSecretRepository        repository.Repository[models.ClientSecret]
+	consentRepository             repository.Repository[models.Consent]
+	authorizationCodeRepository   repository.Repository[models.AuthorizationCode]
+	refreshTokenRepository        repository.Repository[models.RefreshToken]
+	sessionRepository             repository.Repository[models.Session]
+	identityProviderRepository    repository.Repository[models.IdentityProvider]
+	externalIdentityRepository    repository.Repository[models.ExternalIdentity]
+	federatedLoginRepository      repository.Repository[models.FederatedLogin]
+	samlServiceProviderRepository repository.Repository[models.SAMLServiceProvider]
+	tenantRepository              repository.Repository[models.Tenant]
+	auditEventRepository          repository.Repository[models.AuditEvent]
+	webhookRepository             repository.Repository[models.Webhook]
+	webhookDeliveryRepository     repository.Repository[models.WebhookDelivery]
+	logger                        *logger.Logger
+	metrics                       *serverMetrics
+	tracerProvider                *sdktrace.TracerProvider
+	hasher                        hasher.Hasher
+	assertionReplayCache          *cache.ReplayCache
+	keySetCache                   *cache.Cache[*models.JSONWebKeySet]
+	dpopReplayCache               *cache.ReplayCache
+	consentReplayCache            *cache.ReplayCache
+	logoutReplayCache             *cache.ReplayCache
+	originCache                   *cache.Cache[bool]
+	clientCAs                     *x509.CertPool
+	openIDProviderCache           *cache.Cache[*models.OpenIDProviderMetadata]
+	samlMetadataCache             *cache.Cache[*saml.EntityDescriptor]
+	samlKey                       *rsa.PrivateKey
+	samlCertificate               *x509.Certificate
+	tenantCache                   *cache.Cache[*Server]
+	tenant                        *models.Tenant
+	pathPrefix                    string
+	handler                       http.Handler
 }
 
 func StartServer() error {
@@ -62,13 +121,27 @@ func newServer() (*Server, error) {
 		s.logger.Fatal(err)
 	}
 	fmt.Println(string(banner))
-	s.logger.WithField("Status", "Loading server config...")
+	s.logger.Info("Loading server config...")
 	config, err := s.readServerConfig()
 	if err != nil {
 		s.logger.Fatal(err)
 	}
 	s.config = config
-	s.logger.WithField("Status", "Loading database connection...")
+	s.logger = logger.New(os.Stderr, config.LogLevel, config.LogFormat)
+	otel.SetTextMapPropagator(newPropagator())
+	exporter, err := newSpanExporter(config.TraceExporter)
+	if err != nil {
+		s.logger.Fatal(err)
+	}
+	if exporter != nil {
+		s.logger.WithField("exporter", config.TraceExporter).Info("Enabling tracing...")
+		s.tracerProvider, err = newTracerProvider(exporter)
+		if err != nil {
+			s.logger.Fatal(err)
+		}
+		otel.SetTracerProvider(s.tracerProvider)
+	}
+	s.logger.Info("Loading database connection...")
 	dsn := fmt.Sprintf(
 		"host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=America/Sao_Paulo",
 		os.Getenv("POSTGRES_HOST"),
@@ -81,51 +154,163 @@ func newServer() (*Server, error) {
 	if err != nil {
 		s.logger.Fatal(err)
 	}
-	s.logger.WithField("Status", "Migrating database...")
+	s.logger.Info("Migrating database...")
 	err = db.AutoMigrate(
 		&models.User{},
 		&models.Role{},
 		&models.Permission{},
 		&models.Application{},
 		&models.Client{},
+		&models.Group{},
+		&models.Policy{},
+		&models.DeviceCode{},
+		&models.ClientSecret{},
+		&models.Consent{},
+		&models.AuthorizationCode{},
+		&models.RefreshToken{},
+		&models.Session{},
+		&models.IdentityProvider{},
+		&models.RoleMapping{},
+		&models.ExternalIdentity{},
+		&models.FederatedLogin{},
+		&models.SAMLServiceProvider{},
+		&models.Tenant{},
+		&models.AuditEvent{},
+		&models.Webhook{},
+		&models.WebhookDelivery{},
 	)
 	if err != nil {
 		s.logger.Fatal(err)
 	}
+	err = repository.NewPermissionRepository(db).MigrateLegacyRoles(context.Background())
+	if err != nil {
+		s.logger.Fatal(err)
+	}
+	err = repository.NewClientRepository(db).MigrateLegacyRedirectURIs(context.Background())
+	if err != nil {
+		s.logger.Fatal(err)
+	}
+	err = repository.NewClientRepository(db).MigrateClientDefaults(context.Background())
+	if err != nil {
+		s.logger.Fatal(err)
+	}
+	_, err = repository.NewTenantRepository(db).MigrateDefaultTenant(context.Background())
+	if err != nil {
+		s.logger.Fatal(err)
+	}
+	err = repository.NewAuditEventRepository(db).MigrateAppendOnly(context.Background())
+	if err != nil {
+		s.logger.Fatal(err)
+	}
+	err = repository.RegisterTenantCallbacks(db)
+	if err != nil {
+		s.logger.Fatal(err)
+	}
+	err = db.Use(repository.NewTracingPlugin())
+	if err != nil {
+		s.logger.Fatal(err)
+	}
 	s.DB = db
+	sqlDB, err := db.DB()
+	if err != nil {
+		s.logger.Fatal(err)
+	}
+	s.metrics = newServerMetrics(sqlDB)
 	s.clientRepository = repository.NewClientRepository(db)
 	s.applicationRepository = repository.NewApplicationRepository(db)
 	s.userRepository = repository.NewUserRepository(db)
 	s.roleRepository = repository.NewRoleRepository(db)
 	s.permissionRepository = repository.NewPermissionRepository(db)
-	s.hasher = hasher.NewPBKDF2Hasher(200000, s.config.Secret)
-	s.logger.WithField("Status", "Application is running")
+	s.groupRepository = repository.NewGroupRepository(db)
+	s.policyRepository = repository.NewPolicyRepository(db)
+	s.deviceCodeRepository = repository.NewDeviceCodeRepository(db)
+	s.clientSecretRepository = repository.NewClientSecretRepository(db)
+	s.consentRepository = repository.NewConsentRepository(db)
+	s.authorizationCodeRepository = repository.NewAuthorizationCodeRepository(db)
+	s.refreshTokenRepository = repository.NewRefreshTokenRepository(db)
+	s.sessionRepository = repository.NewSessionRepository(db)
+	s.identityProviderRepository = repository.NewIdentityProviderRepository(db)
+	s.externalIdentityRepository = repository.NewExternalIdentityRepository(db)
+	s.federatedLoginRepository = repository.NewFederatedLoginRepository(db)
+	s.samlServiceProviderRepository = repository.NewSAMLServiceProviderRepository(db)
+	s.tenantRepository = repository.NewTenantRepository(db)
+	s.auditEventRepository = repository.NewAuditEventRepository(db)
+	s.webhookRepository = repository.NewWebhookRepository(db)
+	s.webhookDeliveryRepository = repository.NewWebhookDeliveryRepository(db)
+	s.hasher = hasher.NewTimedHasher(hasher.NewPBKDF2Hasher(200000, s.config.Secret), s.metrics.observePasswordHashing)
+	s.assertionReplayCache = cache.NewReplayCache()
+	s.keySetCache = cache.NewCache[*models.JSONWebKeySet](JWKS_CACHE_TTL)
+	s.dpopReplayCache = cache.NewReplayCache()
+	s.consentReplayCache = cache.NewReplayCache()
+	s.logoutReplayCache = cache.NewReplayCache()
+	s.originCache = cache.NewCache[bool](ORIGIN_CACHE_TTL)
+	s.openIDProviderCache = cache.NewCache[*models.OpenIDProviderMetadata](FEDERATION_METADATA_TTL)
+	s.samlMetadataCache = cache.NewCache[*saml.EntityDescriptor](FEDERATION_METADATA_TTL)
+	s.tenantCache = cache.NewCache[*Server](TENANT_CACHE_TTL)
+	if s.config.ClientCAFile != "" {
+		s.logger.Info("Loading client certificate authorities...")
+		s.clientCAs, err = loadCertPool(s.config.ClientCAFile)
+		if err != nil {
+			s.logger.Fatal(err)
+		}
+	}
+	if s.config.SAMLCertFile != "" && s.config.SAMLKeyFile != "" {
+		s.logger.Info("Loading SAML key pair...")
+		s.samlKey, s.samlCertificate, err = loadRSAKeyPair(s.config.SAMLCertFile, s.config.SAMLKeyFile)
+		if err != nil {
+			s.logger.Fatal(err)
+		}
+	}
+	s.logger.Info("Application is running")
 	return s, nil
 }
 
 func (s *Server) start(stop <-chan struct{}) error {
 	corsObj := handlers.CORS(
-		handlers.AllowedOrigins([]string{"*"}),
+		handlers.AllowedOriginValidator(s.isAllowedOrigin),
 		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
 		handlers.AllowedHeaders([]string{
-			X_REQUESTED_WITH, CONTENT_TYPE, AUTHORIZATION,
+			X_REQUESTED_WITH, CONTENT_TYPE, AUTHORIZATION, DPOP,
 		}),
+		handlers.ExposedHeaders([]string{DPOP_NONCE, WWW_AUTHENTICATE}),
 	)
 	srv := &http.Server{
 		Addr:    s.config.Addr,
-		Handler: corsObj(s.router()),
+		Handler: corsObj(s.tenantRouter()),
+	}
+	useTLS := s.config.TLSCertFile != "" && s.config.TLSKeyFile != ""
+	if useTLS {
+		// Client certificates are requested but not verified during the
+		// handshake, since self-signed certificates are verified against
+		// the keys registered by each client.
+		srv.TLSConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			ClientAuth: tls.RequestClientCert,
+		}
 	}
 	go func() {
-		s.logger.WithField("addr", s.config.Addr)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		s.logger.WithField("addr", s.config.Addr).Info("Listening")
+		var err error
+		if useTLS {
+			err = srv.ListenAndServeTLS(s.config.TLSCertFile, s.config.TLSKeyFile)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			s.logger.Fatal(err)
 		}
 	}()
+	go s.deliverWebhooks(stop)
 	<-stop
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.config.Timeout)*time.Millisecond)
 	defer cancel()
-	s.logger.WithField("timeout", s.config.Timeout)
-	return srv.Shutdown(ctx)
+	s.logger.WithField("timeout_ms", s.config.Timeout).Info("Shutting down")
+	err := srv.Shutdown(ctx)
+	if s.tracerProvider != nil {
+		// Flush the spans of the last requests before exiting
+		err = errors.Join(err, s.tracerProvider.Shutdown(ctx))
+	}
+	return err
 }
 
 func (s *Server) readServerConfig() (*ServerConfig, error) {
@@ -137,9 +322,176 @@ func (s *Server) readServerConfig() (*ServerConfig, error) {
 	if err != nil {
 		s.logger.Fatal(err)
 	}
+	claims, err := s.readClaimsConfig()
+	if err != nil {
+		s.logger.Fatal(err)
+	}
+	sessionIdleTimeout, err := readDuration("AUTH_SERVER_SESSION_IDLE_TIMEOUT", DEFAULT_SESSION_IDLE_TIMEOUT)
+	if err != nil {
+		s.logger.Fatal(err)
+	}
+	sessionMaxAge, err := readDuration("AUTH_SERVER_SESSION_MAX_AGE", DEFAULT_SESSION_MAX_AGE)
+	if err != nil {
+		s.logger.Fatal(err)
+	}
+	logLevel, logFormat, err := readLogConfig()
+	if err != nil {
+		s.logger.Fatal(err)
+	}
 	return &ServerConfig{
-		Addr:    addr,
-		Timeout: int(timeout),
-		Secret:  []byte(os.Getenv("AUTH_SERVER_SECRET")),
+		Addr:               addr,
+		Timeout:            int(timeout),
+		Secret:             []byte(os.Getenv("AUTH_SERVER_SECRET")),
+		Issuer:             strings.TrimSuffix(os.Getenv("AUTH_SERVER_JWT_ISS"), "/"),
+		Claims:             claims,
+		AllowFileJwks:      os.Getenv("AUTH_SERVER_ALLOW_FILE_JWKS") == "true",
+		TLSCertFile:        os.Getenv("AUTH_SERVER_TLS_CERT"),
+		TLSKeyFile:         os.Getenv("AUTH_SERVER_TLS_KEY"),
+		ClientCAFile:       os.Getenv("AUTH_SERVER_TLS_CLIENT_CA"),
+		DPoPRequireNonce:   os.Getenv("AUTH_SERVER_DPOP_REQUIRE_NONCE") == "true",
+		RegistrationToken:  os.Getenv("AUTH_SERVER_REGISTRATION_TOKEN"),
+		AllowedOrigins:     readAllowedOrigins(),
+		SessionIdleTimeout: sessionIdleTimeout,
+		SessionMaxAge:      sessionMaxAge,
+		InsecureCookies:    os.Getenv("AUTH_SERVER_INSECURE_COOKIES") == "true",
+		SAMLCertFile:       os.Getenv("AUTH_SERVER_SAML_CERT"),
+		SAMLKeyFile:        os.Getenv("AUTH_SERVER_SAML_KEY"),
+		AuditHashChain:     os.Getenv("AUTH_SERVER_AUDIT_HASH_CHAIN") == "true",
+		LogLevel:           logLevel,
+		LogFormat:          logFormat,
+		TraceExporter:      os.Getenv("AUTH_SERVER_TRACE_EXPORTER"),
 	}, nil
 }
+
+// readDuration reads a duration such as "30m" from the environment variable,
+// falling back to defaultValue when it is not set.
+func readDuration(name string, defaultValue time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("%s must be positive", name)
+	}
+	return duration, nil
+}
+
+// readLogConfig reads the level and format of the log, from the
+// AUTH_SERVER_LOG_LEVEL and AUTH_SERVER_LOG_FORMAT environment variables.
+// Entries of the info level and above are written in the console format
+// unless they are set.
+func readLogConfig() (logger.Level, logger.Format, error) {
+	level, format := logger.LevelInfo, logger.FormatConsole
+	var err error
+	if value := os.Getenv("AUTH_SERVER_LOG_LEVEL"); value != "" {
+		level, err = logger.ParseLevel(value)
+		if err != nil {
+			return 0, "", fmt.Errorf("invalid AUTH_SERVER_LOG_LEVEL: %w", err)
+		}
+	}
+	if value := os.Getenv("AUTH_SERVER_LOG_FORMAT"); value != "" {
+		format, err = logger.ParseFormat(value)
+		if err != nil {
+			return 0, "", fmt.Errorf("invalid AUTH_SERVER_LOG_FORMAT: %w", err)
+		}
+	}
+	return level, format, nil
+}
+
+// readAllowedOrigins reads the comma-separated CORS origins allowed for all
+// requests. Any origin is allowed unless AUTH_SERVER_CORS_ORIGINS is set.
+func readAllowedOrigins() []string {
+	value := os.Getenv("AUTH_SERVER_CORS_ORIGINS")
+	if value == "" {
+		return []string{"*"}
+	}
+	var origins []string
+	for _, origin := range strings.Split(value, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// isAllowedOrigin returns true if cross-origin requests from the origin are
+// allowed, either by the server configuration or by an enabled client.
+func (s *Server) isAllowedOrigin(origin string) bool {
+	if containsString(s.config.AllowedOrigins, "*") || containsString(s.config.AllowedOrigins, origin) {
+		return true
+	}
+	if allowed, ok := s.originCache.Get(origin); ok {
+		return allowed
+	}
+	repo := s.clientRepository.(*repository.ClientRepository)
+	allowed, err := repo.HasAllowedOrigin(context.Background(), origin)
+	if err != nil {
+		s.logger.WithError(err).WithField("origin", origin).Error("checking allowed origin")
+		return false
+	}
+	s.originCache.Set(origin, allowed)
+	return allowed
+}
+
+// loadCertPool reads the PEM encoded certificates in the file into a pool.
+func loadCertPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+	return pool, nil
+}
+
+// readClaimsConfig reads the names and size limit of the authorization
+// claims embedded in user tokens, falling back to sensible defaults.
+func (s *Server) readClaimsConfig() (*models.ClaimsConfig, error) {
+	config := &models.ClaimsConfig{
+		RolesClaim:       os.Getenv("AUTH_SERVER_ROLES_CLAIM"),
+		PermissionsClaim: os.Getenv("AUTH_SERVER_PERMISSIONS_CLAIM"),
+		MaxEntries:       DEFAULT_MAX_CLAIM_ENTRIES,
+		SourceEndpoint:   strings.TrimSuffix(os.Getenv("AUTH_SERVER_JWT_ISS"), "/") + OAUTH2_USER_CLAIMS_ROUTE,
+	}
+	if config.RolesClaim == "" {
+		config.RolesClaim = DEFAULT_ROLES_CLAIM
+	}
+	if config.PermissionsClaim == "" {
+		config.PermissionsClaim = DEFAULT_PERMISSIONS_CLAIM
+	}
+	if config.RolesClaim == config.PermissionsClaim {
+		return nil, errors.New("roles and permissions claims must have different names")
+	}
+	if maxEntries := os.Getenv("AUTH_SERVER_CLAIMS_MAX_ENTRIES"); maxEntries != "" {
+		value, err := strconv.Atoi(maxEntries)
+		if err != nil {
+			return nil, err
+		}
+		config.MaxEntries = value
+	}
+	return config, nil
+}
+
+// loadRSAKeyPair reads the PEM encoded certificate and RSA private key in
+// the files.
+func loadRSAKeyPair(certFile string, keyFile string) (*rsa.PrivateKey, *x509.Certificate, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, ok := pair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s does not hold an RSA private key", keyFile)
+	}
+	certificate, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, certificate, nil
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"auth-server/logger"
+	"auth-server/models"
+	"auth-server/repository"
+	"auth-server/repository/repositorytest"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+const testIssuer = "https://auth.example.com"
+
+// newTestServer returns a server of the default realm signing its tokens with
+// HS256, without database.
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	t.Setenv("AUTH_SERVER_JWT_ALG", "HS256")
+	t.Setenv("AUTH_SERVER_JWT_SECRET", "test-secret")
+	t.Setenv("AUTH_SERVER_JWT_ISS", testIssuer)
+	return &Server{
+		config: &ServerConfig{
+			Issuer: testIssuer,
+			Secret: []byte("test-secret"),
+			Claims: &models.ClaimsConfig{},
+		},
+		tenant: &models.Tenant{Name: models.DEFAULT_TENANT_NAME},
+		logger: logger.New(io.Discard, logger.LevelError, logger.FormatJSON),
+	}
+}
+
+// newDryRunDB returns a database whose statements are built without being
+// run, since no database is available to the tests.
+func newDryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost user=test dbname=test"}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// newDatabaseTestServer returns a test server whose repositories use a fake
+// database, answering their statements with the rows it is given.
+func newDatabaseTestServer(t *testing.T) (*Server, *repositorytest.DB) {
+	t.Helper()
+	s := newTestServer(t)
+	db, fake := repositorytest.New(t)
+	useDatabase(s, db)
+	s.hasher = plainHasher{}
+	return s, fake
+}
+
+// useDatabase makes the repositories of the server use the database.
+func useDatabase(s *Server, db *gorm.DB) {
+	s.clientRepository = repository.NewClientRepository(db)
+	s.applicationRepository = repository.NewApplicationRepository(db)
+	s.userRepository = repository.NewUserRepository(db)
+	s.roleRepository = repository.NewRoleRepository(db)
+	s.permissionRepository = repository.NewPermissionRepository(db)
+	s.groupRepository = repository.NewGroupRepository(db)
+	s.policyRepository = repository.NewPolicyRepository(db)
+	s.deviceCodeRepository = repository.NewDeviceCodeRepository(db)
+	s.clientSecretRepository = repository.NewClientSecretRepository(db)
+	s.consentRepository = repository.NewConsentRepository(db)
+	s.authorizationCodeRepository = repository.NewAuthorizationCodeRepository(db)
+	s.refreshTokenRepository = repository.NewRefreshTokenRepository(db)
+	s.sessionRepository = repository.NewSessionRepository(db)
+	s.identityProviderRepository = repository.NewIdentityProviderRepository(db)
+	s.externalIdentityRepository = repository.NewExternalIdentityRepository(db)
+	s.federatedLoginRepository = repository.NewFederatedLoginRepository(db)
+	s.samlServiceProviderRepository = repository.NewSAMLServiceProviderRepository(db)
+	s.tenantRepository = repository.NewTenantRepository(db)
+	s.auditEventRepository = repository.NewAuditEventRepository(db)
+	s.webhookRepository = repository.NewWebhookRepository(db)
+	s.webhookDeliveryRepository = repository.NewWebhookDeliveryRepository(db)
+}
+
+// plainHasher stores passwords as they are, to keep tests fast.
+type plainHasher struct{}
+
+func (plainHasher) GenerateFromPassword(password string) (string, error) {
+	return "plain$" + password, nil
+}
+
+func (plainHasher) CompareHashAndPassword(hashedPassword string, password string) error {
+	if hashedPassword != "plain$"+password {
+		return errors.New("passwords do not match")
+	}
+	return nil
+}
+
+// newTestRealm returns the server of another realm served under its path
+// prefix, sharing the server's signing secret.
+func newTestRealm(t *testing.T, s *Server, name string) *Server {
+	t.Helper()
+	config := *s.config
+	config.Issuer = s.config.Issuer + REALM_PATH_PREFIX + name
+	realm := *s
+	realm.config = &config
+	realm.tenant = &models.Tenant{Name: name}
+	realm.pathPrefix = REALM_PATH_PREFIX + name
+	return &realm
+}
+
+// fakeRepository is an in-memory repository of entities, by id.
+type fakeRepository[T any] map[string]*T
+
+func (r fakeRepository[T]) FindAll(ctx context.Context) ([]*T, error) {
+	entities := make([]*T, 0, len(r))
+	for _, entity := range r {
+		entities = append(entities, entity)
+	}
+	return entities, nil
+}
+
+func (r fakeRepository[T]) FindById(ctx context.Context, id string) (*T, error) {
+	entity, ok := r[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return entity, nil
+}
+
+func (r fakeRepository[T]) Save(ctx context.Context, entity interface{}) (*T, error) {
+	return nil, errors.New("not supported")
+}
+
+func (r fakeRepository[T]) Delete(ctx context.Context, id string) error {
+	delete(r, id)
+	return nil
+}
+
+// newTestToken returns a token signed by the server, valid for a minute
+// unless the payload is changed by the options.
+func newTestToken(t *testing.T, s *Server, options ...func(*models.Payload)) string {
+	t.Helper()
+	payload := models.NewPayload("subject", "audience", time.Minute, "")
+	for _, option := range options {
+		option(payload)
+	}
+	jwt, err := s.newJwt(payload, "JWT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jwt.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
@@ -0,0 +1,248 @@
+package server
+
+import (
+	"auth-server/mapper"
+	"auth-server/models"
+	"auth-server/repository"
+	"auth-server/services"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleLogin authenticates a user with their username and password, and
+// starts a login session in their browser. The session cookie lets the user
+// authorize clients at the authorization endpoint without entering their
+// credentials again. Any session the browser held before is terminated.
+func (s *Server) HandleLogin(w http.ResponseWriter, r *http.Request) {
+	var loginRequest models.LoginRequest
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&loginRequest)
+	if err != nil {
+		s.HandleError(w, http.StatusBadRequest, LOGIN_ROUTE, err)
+		return
+	}
+
+	user, err := s.authenticateUser(r.Context(), loginRequest.Username, loginRequest.Password)
+	if err != nil {
+		// The user is not known for sure yet, so that failed logins are
+		// recorded under the username attempted.
+		s.auditAs(r, loginRequest.Username, models.AUDIT_ACTION_LOGIN, loginRequest.Username, err, nil, nil)
+		s.metrics.recordLogin(models.AUTH_METHOD_PASSWORD, err)
+		s.HandleError(w, errorStatus(err), LOGIN_ROUTE, err)
+		return
+	}
+
+	service := s.sessionService()
+	if previous, err := s.currentSession(r); err == nil && previous != nil {
+		_, err = service.TerminateSession(previous.ID.String())
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, LOGIN_ROUTE, err)
+			return
+		}
+		s.notifyLogout(previous)
+	}
+	session, token, err := service.CreateSession(user, clientIP(r), r.UserAgent(), []string{models.AUTH_METHOD_PASSWORD})
+	s.auditAs(r, user.ID.String(), models.AUDIT_ACTION_LOGIN, user.ID.String(), err, nil, nil)
+	s.metrics.recordLogin(models.AUTH_METHOD_PASSWORD, err)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, LOGIN_ROUTE, err)
+		return
+	}
+	response, err := json.Marshal(mapper.SessionToSessionDto(session))
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, LOGIN_ROUTE, err)
+		return
+	}
+
+	s.setSessionCookie(w, token, session.ExpiresAt)
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	w.Header().Set("Cache-Control", "no-store")
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// HandleUserSessions lists the active sessions of the authenticated user.
+func (s *Server) HandleUserSessions(w http.ResponseWriter, r *http.Request) {
+	user, err := s.authenticatedUser(w, r)
+	if err != nil {
+		s.HandleError(w, errorStatus(err), USER_SESSIONS_ROUTE, err)
+		return
+	}
+
+	result, err := s.sessionService().GetSessions(user)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, USER_SESSIONS_ROUTE, err)
+		return
+	}
+	response, err := json.Marshal(result)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, USER_SESSIONS_ROUTE, err)
+		return
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// HandleUserSessionDetails lets the authenticated user terminate one of their
+// sessions, e.g. one left open on another device. The clients that took part
+// in the session are notified through the back channel.
+func (s *Server) HandleUserSessionDetails(w http.ResponseWriter, r *http.Request) {
+	user, err := s.authenticatedUser(w, r)
+	if err != nil {
+		s.HandleError(w, errorStatus(err), USER_SESSION_DETAILS_ROUTE, err)
+		return
+	}
+
+	session, err := s.sessionService().TerminateUserSession(user, mux.Vars(r)["id"])
+	s.auditAs(r, user.ID.String(), models.AUDIT_ACTION_SESSION_TERMINATE, mux.Vars(r)["id"], err, nil, nil)
+	if errors.Is(err, services.ErrSessionNotFound) {
+		s.HandleError(w, http.StatusNotFound, USER_SESSION_DETAILS_ROUTE, err)
+		return
+	}
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, USER_SESSION_DETAILS_ROUTE, err)
+		return
+	}
+	s.notifyLogout(session)
+
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+}
+
+// HandleAdminUserSessions handles the sessions of a user. When called via GET,
+// it lists the user's active sessions. When called via DELETE, it terminates
+// all of them.
+func (s *Server) HandleAdminUserSessions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	repo := s.userRepository.(*repository.UserRepository)
+	userService := services.NewUserService(repo)
+	service := s.sessionService()
+	var response []byte
+
+	user, err := userService.GetByUsername(vars["username"])
+	if user == nil && err == nil {
+		s.HandleError(w, http.StatusNotFound, ADMIN_USER_SESSIONS_ROUTE, errors.New("user not found"))
+		return
+	}
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, ADMIN_USER_SESSIONS_ROUTE, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		result, err := service.GetSessions(user)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_USER_SESSIONS_ROUTE, err)
+			return
+		}
+		response, err = json.Marshal(result)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_USER_SESSIONS_ROUTE, err)
+			return
+		}
+		w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	case http.MethodDelete:
+		sessions, err := service.TerminateSessions(user)
+		s.audit(r, models.AUDIT_ACTION_USER_SESSIONS_TERMINATE, user.Username, err, nil, nil)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_USER_SESSIONS_ROUTE, err)
+			return
+		}
+		for _, session := range sessions {
+			s.notifyLogout(session)
+		}
+	}
+
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// HandleSessionDetails terminates a session, and notifies the clients that took part in it.
+func (s *Server) HandleSessionDetails(w http.ResponseWriter, r *http.Request) {
+	session, err := s.sessionService().TerminateSession(mux.Vars(r)["id"])
+	s.audit(r, models.AUDIT_ACTION_SESSION_TERMINATE, mux.Vars(r)["id"], err, nil, nil)
+	if errors.Is(err, services.ErrSessionNotFound) {
+		s.HandleError(w, http.StatusNotFound, ADMIN_SESSION_DETAILS_ROUTE, err)
+		return
+	}
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, ADMIN_SESSION_DETAILS_ROUTE, err)
+		return
+	}
+	s.notifyLogout(session)
+
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+}
+
+func (s *Server) sessionService() *services.SessionService {
+	repo := s.sessionRepository.(*repository.SessionRepository)
+	return services.NewSessionService(repo, s.config.SessionIdleTimeout, s.config.SessionMaxAge)
+}
+
+// currentSession returns the active session of the browser making the
+// request, or nil if it holds none in the server's realm.
+func (s *Server) currentSession(r *http.Request) (*models.Session, error) {
+	cookie, err := r.Cookie(SESSION_COOKIE)
+	if err != nil || cookie.Value == "" {
+		return nil, nil
+	}
+	session, err := s.sessionService().GetSession(cookie.Value)
+	if err != nil || session == nil {
+		return session, err
+	}
+	if session.User.TenantID != s.tenant.ID {
+		return nil, nil
+	}
+	return session, nil
+}
+
+// setSessionCookie stores the session cookie in the browser. The cookie cannot
+// be read by scripts, and is sent along with top-level navigations from other
+// sites, such as redirects to the authorization endpoint, but not with their
+// other requests.
+func (s *Server) setSessionCookie(w http.ResponseWriter, token string, expiresAt time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SESSION_COOKIE,
+		Value:    token,
+		Path:     s.pathPrefix + "/",
+		Expires:  expiresAt,
+		MaxAge:   int(time.Until(expiresAt).Seconds()),
+		Secure:   !s.config.InsecureCookies,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// clearSessionCookie removes the session cookie from the browser.
+func (s *Server) clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SESSION_COOKIE,
+		Value:    "",
+		Path:     s.pathPrefix + "/",
+		MaxAge:   -1,
+		Secure:   !s.config.InsecureCookies,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// clientIP returns the address of the peer making the request.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
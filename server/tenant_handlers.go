@@ -0,0 +1,300 @@
+package server
+
+import (
+	"auth-server/mapper"
+	"auth-server/models"
+	"auth-server/repository"
+	"auth-server/services"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// tenantRouter dispatches requests to the router of the realm they are
+// addressed to: the realm named by their /realms/{name} path prefix, or else
+// the realm served at the host they were sent to, or else the default realm.
+func (s *Server) tenantRouter() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenantServer, err := s.resolveTenant(r)
+		if err != nil {
+			s.HandleError(w, errorStatus(err), "TenantRouter", err)
+			return
+		}
+		tenantServer.handler.ServeHTTP(w, r)
+	})
+}
+
+// resolveTenant returns the server of the realm the request is addressed to.
+// Servers are cached for a while, so that the realm is not looked up on
+// every request.
+func (s *Server) resolveTenant(r *http.Request) (*Server, error) {
+	ctx := context.Background()
+	repo := s.tenantRepository.(*repository.TenantRepository)
+	var (
+		key    string
+		prefix string
+		tenant *models.Tenant
+		err    error
+	)
+	if name, ok := realmName(r.URL.Path); ok {
+		key = REALM_PATH_PREFIX + name
+		prefix = key
+		if tenantServer, ok := s.tenantCache.Get(key); ok {
+			return tenantServer, nil
+		}
+		tenant, err = repo.FindByName(ctx, name)
+	} else {
+		key = requestHost(r)
+		if tenantServer, ok := s.tenantCache.Get(key); ok {
+			return tenantServer, nil
+		}
+		tenant, err = repo.FindByHost(ctx, key)
+		if err == nil && tenant == nil {
+			tenant, err = repo.FindByName(ctx, models.DEFAULT_TENANT_NAME)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tenant == nil || tenant.Disabled {
+		return nil, newStatusError(http.StatusNotFound, errors.New("realm not found"))
+	}
+	tenantServer := s.forTenant(tenant, prefix)
+	s.tenantCache.Set(key, tenantServer)
+	return tenantServer, nil
+}
+
+// realmName returns the name of the realm the path is prefixed with, if any.
+func realmName(path string) (string, bool) {
+	if !strings.HasPrefix(path, REALM_PATH_PREFIX) {
+		return "", false
+	}
+	name, _, _ := strings.Cut(strings.TrimPrefix(path, REALM_PATH_PREFIX), "/")
+	return name, name != ""
+}
+
+// requestHost returns the host the request was sent to, without its port.
+func requestHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	return strings.ToLower(host)
+}
+
+// forTenant returns a copy of the server serving the realm, either under the
+// path prefix, or at the root path if the prefix is blank. Its repositories
+// only see the entities of the realm, it logs with the realm's name, and it
+// issues tokens with the realm's issuer and signing secret.
+func (s *Server) forTenant(tenant *models.Tenant, prefix string) *Server {
+	config := *s.config
+	config.Issuer = s.tenantIssuer(tenant, prefix)
+	claims := *s.config.Claims
+	claims.SourceEndpoint = config.Issuer + OAUTH2_USER_CLAIMS_ROUTE
+	config.Claims = &claims
+
+	tenantServer := *s
+	tenantServer.config = &config
+	tenantServer.tenant = tenant
+	tenantServer.pathPrefix = prefix
+	tenantServer.logger = s.logger.WithField("realm", tenant.Name)
+	tenantServer.userRepository = s.userRepository.(*repository.UserRepository).WithTenant(tenant.ID)
+	tenantServer.clientRepository = s.clientRepository.(*repository.ClientRepository).WithTenant(tenant.ID)
+	tenantServer.applicationRepository = s.applicationRepository.(*repository.ApplicationRepository).WithTenant(tenant.ID)
+	tenantServer.roleRepository = s.roleRepository.(*repository.RoleRepository).WithTenant(tenant.ID)
+	tenantServer.permissionRepository = s.permissionRepository.(*repository.PermissionRepository).WithTenant(tenant.ID)
+	tenantServer.groupRepository = s.groupRepository.(*repository.GroupRepository).WithTenant(tenant.ID)
+	tenantServer.policyRepository = s.policyRepository.(*repository.PolicyRepository).WithTenant(tenant.ID)
+	tenantServer.sessionRepository = s.sessionRepository.(*repository.SessionRepository).WithTenant(tenant.ID)
+	tenantServer.consentRepository = s.consentRepository.(*repository.ConsentRepository).WithTenant(tenant.ID)
+	tenantServer.refreshTokenRepository = s.refreshTokenRepository.(*repository.RefreshTokenRepository).WithTenant(tenant.ID)
+	tenantServer.deviceCodeRepository = s.deviceCodeRepository.(*repository.DeviceCodeRepository).WithTenant(tenant.ID)
+	tenantServer.identityProviderRepository = s.identityProviderRepository.(*repository.IdentityProviderRepository).WithTenant(tenant.ID)
+	tenantServer.samlServiceProviderRepository = s.samlServiceProviderRepository.(*repository.SAMLServiceProviderRepository).WithTenant(tenant.ID)
+	tenantServer.auditEventRepository = s.auditEventRepository.(*repository.AuditEventRepository).WithTenant(tenant.ID)
+	tenantServer.webhookRepository = s.webhookRepository.(*repository.WebhookRepository).WithTenant(tenant.ID)
+	tenantServer.webhookDeliveryRepository = s.webhookDeliveryRepository.(*repository.WebhookDeliveryRepository).WithTenant(tenant.ID)
+	tenantServer.handler = tenantServer.router()
+	return &tenantServer
+}
+
+// tenantIssuer returns the issuer of the realm: the server's issuer followed
+// by the path prefix, or with its host replaced by the realm's host. It is
+// blank when the server has no issuer configured, so that the URL requests
+// are sent to is used instead.
+func (s *Server) tenantIssuer(tenant *models.Tenant, prefix string) string {
+	if s.config.Issuer == "" {
+		return ""
+	}
+	if prefix != "" {
+		return s.config.Issuer + prefix
+	}
+	if tenant.Host == "" {
+		return s.config.Issuer
+	}
+	issuer, err := url.Parse(s.config.Issuer)
+	if err != nil {
+		return s.config.Issuer
+	}
+	issuer.Host = tenant.Host
+	return issuer.String()
+}
+
+// issuesOwnTokens returns true if the server issues tokens with the issuer of
+// its realm rather than the server's, that is unless the default realm is
+// addressed without path prefix.
+func (s *Server) issuesOwnTokens() bool {
+	return s.tenant != nil && (s.pathPrefix != "" || !s.tenant.IsDefault())
+}
+
+// signingKey returns the key the tokens of the realm are signed with, or nil
+// for the server's secret.
+func (s *Server) signingKey() []byte {
+	if s.tenant == nil || s.tenant.SigningSecret == "" {
+		return nil
+	}
+	return []byte(s.tenant.SigningSecret)
+}
+
+// newJwt signs the payload as the realm, with the realm's issuer.
+func (s *Server) newJwt(payload *models.Payload, typ string) (*models.Jwt, error) {
+	if s.issuesOwnTokens() {
+		payload.Iss = s.config.Issuer
+	}
+	return models.NewJwtWithKey(payload, typ, s.signingKey())
+}
+
+// issuedByRealm returns true if the payload carries the issuer of the realm,
+// so that realms sharing the server's signing secret do not accept each
+// other's tokens.
+func (s *Server) issuedByRealm(payload *models.Payload) bool {
+	return strings.TrimSuffix(payload.Iss, "/") == s.config.Issuer
+}
+
+// HandleTenant handles the creation and retrieval of tenants. When called via
+// POST, it creates a tenant. When called via GET, it retrieves all tenants.
+func (s *Server) HandleTenant(w http.ResponseWriter, r *http.Request) {
+	service := s.tenantService()
+	var response []byte
+
+	switch r.Method {
+	case http.MethodGet:
+		result, err := service.GetAll()
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_TENANT_ROUTE, err)
+			return
+		}
+		response, err = json.Marshal(result)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_TENANT_ROUTE, err)
+			return
+		}
+	case http.MethodPost:
+		var tenantRequest models.TenantRequest
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&tenantRequest)
+		if err != nil {
+			s.HandleError(w, http.StatusBadRequest, ADMIN_TENANT_ROUTE, err)
+			return
+		}
+		result, err := service.CreateTenant(&tenantRequest)
+		s.audit(r, models.AUDIT_ACTION_TENANT_CREATE, tenantRequest.Name, err, nil, result)
+		if err != nil {
+			s.HandleError(w, tenantErrorStatus(err), ADMIN_TENANT_ROUTE, err)
+			return
+		}
+		s.tenantCache.Clear()
+		response, err = json.Marshal(result)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_TENANT_ROUTE, err)
+			return
+		}
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// HandleTenantDetails handles the retrieval, update and deletion of a tenant.
+func (s *Server) HandleTenantDetails(w http.ResponseWriter, r *http.Request) {
+	service := s.tenantService()
+	var response []byte
+
+	tenant, err := service.GetTenantById(mux.Vars(r)["id"])
+	if err != nil {
+		s.HandleError(w, http.StatusNotFound, ADMIN_TENANT_DETAILS_ROUTE, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		response, err = json.Marshal(mapper.TenantToTenantDto(tenant))
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_TENANT_DETAILS_ROUTE, err)
+			return
+		}
+	case http.MethodPut:
+		var tenantRequest models.TenantRequest
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&tenantRequest)
+		if err != nil {
+			s.HandleError(w, http.StatusBadRequest, ADMIN_TENANT_DETAILS_ROUTE, err)
+			return
+		}
+		before := mapper.TenantToTenantDto(tenant)
+		result, err := service.UpdateTenant(tenant, &tenantRequest)
+		s.audit(r, models.AUDIT_ACTION_TENANT_UPDATE, tenant.ID.String(), err, before, result)
+		if err != nil {
+			s.HandleError(w, tenantErrorStatus(err), ADMIN_TENANT_DETAILS_ROUTE, err)
+			return
+		}
+		s.tenantCache.Clear()
+		response, err = json.Marshal(result)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_TENANT_DETAILS_ROUTE, err)
+			return
+		}
+	case http.MethodDelete:
+		err := service.DeleteTenant(tenant)
+		s.audit(r, models.AUDIT_ACTION_TENANT_DELETE, tenant.ID.String(), err, mapper.TenantToTenantDto(tenant), nil)
+		if err != nil {
+
+			s.HandleError(w, tenantErrorStatus(err), ADMIN_TENANT_DETAILS_ROUTE, err)
+			return
+		}
+		s.tenantCache.Clear()
+		status := s.getStatusCode(r.Method)
+		w.WriteHeader(status)
+		return
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// tenantErrorStatus returns 400 for invalid tenant settings, 409 for tenants
+// clashing with others or still in use, and 500 for other errors.
+func tenantErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidTenant):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrTenantConflict):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func (s *Server) tenantService() *services.TenantService {
+	return services.NewTenantService(s.tenantRepository.(*repository.TenantRepository))
+}
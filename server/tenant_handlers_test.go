@@ -0,0 +1,150 @@
+package server
+
+import (
+	"auth-server/models"
+	"auth-server/repository"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm/logger"
+)
+
+// statementRecorder records the SQL of the statements run on a database.
+type statementRecorder struct {
+	logger.Interface
+	statements []string
+}
+
+func (r *statementRecorder) LogMode(logger.LogLevel) logger.Interface {
+	return r
+}
+
+func (r *statementRecorder) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	sql, _ := fc()
+	r.statements = append(r.statements, sql)
+}
+
+// newTenantTestServer returns a test server whose repositories are scoped by
+// the tenant callbacks, and the recorder of their statements.
+func newTenantTestServer(t *testing.T) (*Server, *statementRecorder) {
+	t.Helper()
+	s := newTestServer(t)
+	recorder := &statementRecorder{Interface: logger.Discard}
+	db := newDryRunDB(t)
+	err := repository.RegisterTenantCallbacks(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Logger = recorder
+	useDatabase(s, db)
+	return s, recorder
+}
+
+func TestForTenantScopesRepositories(t *testing.T) {
+	id := uuid.NewString()
+	entityId := uuid.New()
+	base := models.BaseUUIDEntity{ID: entityId}
+
+	tests := []struct {
+		name string
+		run  func(ctx context.Context, s *Server) error
+	}{
+		{"list groups", func(ctx context.Context, s *Server) error {
+			_, err := s.groupRepository.FindAll(ctx)
+			return err
+		}},
+		{"save group", func(ctx context.Context, s *Server) error {
+			_, err := s.groupRepository.Save(ctx, &models.Group{BaseUUIDEntity: base, Name: "staff"})
+			return err
+		}},
+		{"find session", func(ctx context.Context, s *Server) error {
+			_, err := s.sessionRepository.FindById(ctx, id)
+			return err
+		}},
+		{"delete session", func(ctx context.Context, s *Server) error {
+			return s.sessionRepository.Delete(ctx, id)
+		}},
+		{"list policies", func(ctx context.Context, s *Server) error {
+			_, err := s.policyRepository.FindAll(ctx)
+			return err
+		}},
+		{"delete policy", func(ctx context.Context, s *Server) error {
+			return s.policyRepository.Delete(ctx, id)
+		}},
+		{"list permissions", func(ctx context.Context, s *Server) error {
+			_, err := s.permissionRepository.FindAll(ctx)
+			return err
+		}},
+		{"save permission", func(ctx context.Context, s *Server) error {
+			_, err := s.permissionRepository.Save(ctx, &models.Permission{Name: "read"})
+			return err
+		}},
+		{"list identity providers", func(ctx context.Context, s *Server) error {
+			_, err := s.identityProviderRepository.FindAll(ctx)
+			return err
+		}},
+		{"find identity provider", func(ctx context.Context, s *Server) error {
+			_, err := s.identityProviderRepository.FindById(ctx, id)
+			return err
+		}},
+		{"find SAML service provider by entity id", func(ctx context.Context, s *Server) error {
+			_, err := s.samlServiceProviderRepository.(*repository.SAMLServiceProviderRepository).FindByEntityId(ctx, "https://sp.example.com")
+			return err
+		}},
+		{"save SAML service provider", func(ctx context.Context, s *Server) error {
+			_, err := s.samlServiceProviderRepository.Save(ctx, &models.SAMLServiceProvider{BaseUUIDEntity: base, Name: "sp"})
+			return err
+		}},
+		{"list consents", func(ctx context.Context, s *Server) error {
+			_, err := s.consentRepository.FindAll(ctx)
+			return err
+		}},
+		{"find consent", func(ctx context.Context, s *Server) error {
+			_, err := s.consentRepository.FindById(ctx, id)
+			return err
+		}},
+		{"find refresh token", func(ctx context.Context, s *Server) error {
+			_, err := s.refreshTokenRepository.(*repository.RefreshTokenRepository).FindByToken(ctx, "token")
+			return err
+		}},
+		{"save refresh token", func(ctx context.Context, s *Server) error {
+			_, err := s.refreshTokenRepository.Save(ctx, &models.RefreshToken{BaseUUIDEntity: base})
+			return err
+		}},
+		{"find device code by user code", func(ctx context.Context, s *Server) error {
+			_, err := s.deviceCodeRepository.(*repository.DeviceCodeRepository).FindByUserCode(ctx, "ABCD-EFGH")
+			return err
+		}},
+		{"delete device code", func(ctx context.Context, s *Server) error {
+			return s.deviceCodeRepository.Delete(ctx, id)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, recorder := newTenantTestServer(t)
+			realm := &models.Tenant{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, Name: "a"}
+			other := &models.Tenant{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, Name: "b"}
+			s.forTenant(other, REALM_PATH_PREFIX+other.Name)
+			realmServer := s.forTenant(realm, REALM_PATH_PREFIX+realm.Name)
+
+			err := tt.run(context.Background(), realmServer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(recorder.statements) == 0 {
+				t.Fatal("no statement was run")
+			}
+			for _, statement := range recorder.statements {
+				if !strings.Contains(statement, realm.ID.String()) {
+					t.Errorf("statement is not scoped to the realm: %s", statement)
+				}
+				if strings.Contains(statement, other.ID.String()) {
+					t.Errorf("statement is scoped to another realm: %s", statement)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/felixge/httpsnoop"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("auth-server/server")
+
+// newSpanExporter creates the exporter of the spans of the server. Spans are
+// sent with OTLP over HTTP to the collector set with the standard
+// OTEL_EXPORTER_OTLP_* environment variables, or written to the standard
+// output. No exporter is created, and spans are not recorded, unless one is
+// named.
+func newSpanExporter(name string) (sdktrace.SpanExporter, error) {
+	switch name {
+	case "":
+		return nil, nil
+	case TRACE_EXPORTER_OTLP:
+		return otlptracehttp.New(context.Background())
+	case TRACE_EXPORTER_STDOUT:
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("invalid AUTH_SERVER_TRACE_EXPORTER: unknown exporter %q", name)
+	}
+}
+
+// newTracerProvider creates a tracer provider sending the spans of the server
+// to the exporter, such as the in-memory exporter of tracetest. Requests are
+// sampled as their caller sampled them, and always if they start a trace.
+func newTracerProvider(exporter sdktrace.SpanExporter) (*sdktrace.TracerProvider, error) {
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(TRACING_SERVICE_NAME)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.AlwaysSample())),
+	), nil
+}
+
+// newPropagator returns the propagator of the W3C trace context and baggage
+// headers, continuing the traces of callers.
+func newPropagator() propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+}
+
+// TracingMiddleware is a middleware that traces every request in a span of
+// the trace sent in its traceparent header, if any, named after the template
+// of the route it matched. Requests failing with a server error are marked as
+// failed.
+func (s *Server) TracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		route := routeTemplate(r)
+		ctx, span := tracer.Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(r.URL.Path),
+				semconv.UserAgentOriginal(r.UserAgent()),
+			),
+		)
+		defer span.End()
+
+		captured := httpsnoop.CaptureMetrics(next, w, r.WithContext(ctx))
+		span.SetAttributes(semconv.HTTPResponseStatusCode(captured.Code))
+		if captured.Code >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(captured.Code))
+		}
+	})
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"auth-server/hasher"
+	"auth-server/repository"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	testSpanExporter       = tracetest.NewInMemoryExporter()
+	testTracerProvider     *sdktrace.TracerProvider
+	testTracerProviderOnce sync.Once
+)
+
+// recordSpans makes the spans of the server recorded by the in-memory
+// exporter, and returns a function flushing and returning the spans ended
+// since. The tracers of the packages are bound to the first global provider,
+// so it is set once for every test.
+func recordSpans(t *testing.T) func() tracetest.SpanStubs {
+	testTracerProviderOnce.Do(func() {
+		var err error
+		testTracerProvider, err = newTracerProvider(testSpanExporter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		otel.SetTracerProvider(testTracerProvider)
+		otel.SetTextMapPropagator(newPropagator())
+	})
+	testSpanExporter.Reset()
+	return func() tracetest.SpanStubs {
+		err := testTracerProvider.ForceFlush(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return testSpanExporter.GetSpans()
+	}
+}
+
+// newTracedTestServer returns a test server whose repositories build their
+// statements without running them, and the router of its login route.
+func newTracedTestServer(t *testing.T) (*Server, http.Handler) {
+	s := newTestServer(t)
+	db := newDryRunDB(t)
+	err := db.Use(repository.NewTracingPlugin())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.userRepository = repository.NewUserRepository(db)
+	s.identityProviderRepository = repository.NewIdentityProviderRepository(db)
+	s.externalIdentityRepository = repository.NewExternalIdentityRepository(db)
+	s.federatedLoginRepository = repository.NewFederatedLoginRepository(db)
+	s.auditEventRepository = repository.NewAuditEventRepository(db)
+	s.metrics = newTestMetrics(t)
+	s.hasher = hasher.NewPBKDF2Hasher(1, s.config.Secret)
+
+	router := mux.NewRouter()
+	router.Use(s.TracingMiddleware)
+	router.HandleFunc(LOGIN_ROUTE, s.HandleLogin).Methods(http.MethodPost)
+	return s, router
+}
+
+func newLoginRequest() *http.Request {
+	return httptest.NewRequest(http.MethodPost, LOGIN_ROUTE, strings.NewReader(`{"username":"alice","password":"password"}`))
+}
+
+func findSpan(t *testing.T, spans tracetest.SpanStubs, prefix string) tracetest.SpanStub {
+	for _, span := range spans {
+		if strings.HasPrefix(span.Name, prefix) {
+			return span
+		}
+	}
+	t.Fatalf("no span named %s*", prefix)
+	return tracetest.SpanStub{}
+}
+
+func TestTracingSpanChain(t *testing.T) {
+	spans := recordSpans(t)
+	_, router := newTracedTestServer(t)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, newLoginRequest())
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	recorded := spans()
+	request := findSpan(t, recorded, http.MethodPost+" "+LOGIN_ROUTE)
+	verifier := findSpan(t, recorded, "LocalCredentialVerifier.VerifyCredentials")
+	query := findSpan(t, recorded, "gorm.query users")
+	hashing := findSpan(t, recorded, "Hasher.CompareHashAndPassword")
+	tests := []struct {
+		name   string
+		span   tracetest.SpanStub
+		parent tracetest.SpanStub
+	}{
+		{"service span in the request span", verifier, request},
+		{"statement span in the service span", query, verifier},
+		{"hashing span in the service span", hashing, verifier},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.span.SpanContext.TraceID() != request.SpanContext.TraceID() {
+				t.Fatalf("%s is in trace %s, want %s", tt.span.Name, tt.span.SpanContext.TraceID(), request.SpanContext.TraceID())
+			}
+			if tt.span.Parent.SpanID() != tt.parent.SpanContext.SpanID() {
+				t.Fatalf("%s has parent %s, want %s", tt.span.Name, tt.span.Parent.SpanID(), tt.parent.SpanContext.SpanID())
+			}
+		})
+	}
+	if request.SpanKind != trace.SpanKindServer || request.Parent.IsValid() {
+		t.Fatalf("the request span is not a root server span")
+	}
+	if query.SpanKind != trace.SpanKindClient {
+		t.Fatalf("the statement span kind = %s, want client", query.SpanKind)
+	}
+}
+
+func TestTracingContinuesTraceparent(t *testing.T) {
+	const traceId = "4bf92f3577b34da6a3ce929d0e0e4736"
+	const parentId = "00f067aa0ba902b7"
+	tests := []struct {
+		name        string
+		traceparent string
+		recorded    bool
+		continued   bool
+	}{
+		{"sampled caller", "00-" + traceId + "-" + parentId + "-01", true, true},
+		{"unsampled caller", "00-" + traceId + "-" + parentId + "-00", false, false},
+		{"no traceparent", "", true, false},
+		{"malformed traceparent", "00-" + traceId + "-01", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spans := recordSpans(t)
+			_, router := newTracedTestServer(t)
+			r := newLoginRequest()
+			if tt.traceparent != "" {
+				r.Header.Set("traceparent", tt.traceparent)
+			}
+			router.ServeHTTP(httptest.NewRecorder(), r)
+
+			recorded := spans()
+			if !tt.recorded {
+				if len(recorded) != 0 {
+					t.Fatalf("recorded %d spans of an unsampled trace", len(recorded))
+				}
+				return
+			}
+			request := findSpan(t, recorded, http.MethodPost+" "+LOGIN_ROUTE)
+			continued := request.SpanContext.TraceID().String() == traceId
+			if continued != tt.continued {
+				t.Fatalf("trace continued = %v, want %v", continued, tt.continued)
+			}
+			if tt.continued && (request.Parent.SpanID().String() != parentId || !request.Parent.IsRemote()) {
+				t.Fatalf("request span has parent %s, want the remote span %s", request.Parent.SpanID(), parentId)
+			}
+			if !tt.continued && request.Parent.IsValid() {
+				t.Fatalf("request span has parent %s, want none", request.Parent.SpanID())
+			}
+			for _, span := range recorded {
+				if span.SpanContext.TraceID() != request.SpanContext.TraceID() {
+					t.Fatalf("%s is in trace %s, want %s", span.Name, span.SpanContext.TraceID(), request.SpanContext.TraceID())
+				}
+			}
+		})
+	}
+}
@@ -1,6 +1,12 @@
 package server
 
-import "net/http"
+import (
+	"crypto/x509"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+)
 
 // getStatusCode returns the appropriate successful status code
 // for the provided HTTP method.
@@ -18,3 +24,105 @@ func (s *Server) getStatusCode(method string) int {
 		return http.StatusOK
 	}
 }
+
+// statusError wraps an error raised by a request helper together with the
+// status code the handler should respond with.
+type statusError struct {
+	status int
+	err    error
+}
+
+func newStatusError(status int, err error) *statusError {
+	return &statusError{status: status, err: err}
+}
+
+func (e *statusError) Error() string {
+	return e.err.Error()
+}
+
+func (e *statusError) Unwrap() error {
+	return e.err
+}
+
+// errorStatus returns the status code carried by err, or 500 if err
+// is not a statusError.
+func errorStatus(err error) int {
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return statusErr.status
+	}
+	return http.StatusInternalServerError
+}
+
+// oauthError is an error raised while processing an OAuth 2.0 request,
+// reported with one of the error codes defined by the specifications.
+type oauthError struct {
+	status      int
+	code        string
+	description string
+}
+
+func newOAuthError(status int, code string, description string) *oauthError {
+	return &oauthError{status: status, code: code, description: description}
+}
+
+func (e *oauthError) Error() string {
+	if e.description == "" {
+		return e.code
+	}
+	return e.code + ": " + e.description
+}
+
+// peerCertificates returns the certificate chain the client presented in the
+// TLS handshake, if any.
+func peerCertificates(r *http.Request) []*x509.Certificate {
+	if r.TLS == nil {
+		return nil
+	}
+	return r.TLS.PeerCertificates
+}
+
+// authorizationCredentials splits the Authorization header of the request
+// into its scheme and access token.
+func authorizationCredentials(r *http.Request) (string, string, error) {
+	auth := r.Header.Get(AUTHORIZATION)
+	if auth == "" {
+		return "", "", errors.New("missing authorization header")
+	}
+	scheme, token, _ := strings.Cut(auth, " ")
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", "", errors.New("missing access token")
+	}
+	return scheme, token, nil
+}
+
+// baseURL returns the URL clients reach the server's realm at: the issuer if
+// one is configured, or else the scheme and host the request was sent to,
+// followed by the realm's path prefix.
+func (s *Server) baseURL(r *http.Request) string {
+	if s.config.Issuer != "" {
+		return s.config.Issuer
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + s.pathPrefix
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// isJSONRequest returns true if the body of the request is JSON. Browsers
+// cannot send such requests to another site without a CORS preflight.
+func isJSONRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get(CONTENT_TYPE))
+	return err == nil && mediaType == APPLICATION_JSON
+}
@@ -0,0 +1,232 @@
+package server
+
+import (
+	"auth-server/mapper"
+	"auth-server/models"
+	"auth-server/repository"
+	"auth-server/services"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleWebhook handles the creation and retrieval of webhooks. When called
+// via POST, it creates a webhook, returning the secret its events are signed
+// with. When called via GET, it retrieves all webhooks of the realm.
+func (s *Server) HandleWebhook(w http.ResponseWriter, r *http.Request) {
+	service := s.webhookService()
+	var response []byte
+
+	switch r.Method {
+	case http.MethodGet:
+		result, err := service.GetAll()
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_WEBHOOK_ROUTE, err)
+			return
+		}
+		response, err = json.Marshal(result)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_WEBHOOK_ROUTE, err)
+			return
+		}
+	case http.MethodPost:
+		var webhookRequest models.WebhookRequest
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&webhookRequest)
+		if err != nil {
+			s.HandleError(w, http.StatusBadRequest, ADMIN_WEBHOOK_ROUTE, err)
+			return
+		}
+		result, err := service.CreateWebhook(&webhookRequest)
+		var after *models.WebhookDto
+		if result != nil {
+			withoutSecret := *result
+			withoutSecret.Secret = ""
+			after = &withoutSecret
+		}
+		s.audit(r, models.AUDIT_ACTION_WEBHOOK_CREATE, webhookRequest.Name, err, nil, after)
+		if errors.Is(err, services.ErrInvalidWebhook) {
+			s.HandleError(w, http.StatusBadRequest, ADMIN_WEBHOOK_ROUTE, err)
+			return
+		}
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_WEBHOOK_ROUTE, err)
+			return
+		}
+		response, err = json.Marshal(result)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_WEBHOOK_ROUTE, err)
+			return
+		}
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// HandleWebhookDetails handles the retrieval, update and deletion of a
+// webhook.
+func (s *Server) HandleWebhookDetails(w http.ResponseWriter, r *http.Request) {
+	service := s.webhookService()
+	var response []byte
+
+	webhook, err := service.GetWebhookById(mux.Vars(r)["id"])
+	if err != nil {
+		s.HandleError(w, http.StatusNotFound, ADMIN_WEBHOOK_DETAILS_ROUTE, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		response, err = json.Marshal(mapper.WebhookToWebhookDto(webhook))
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_WEBHOOK_DETAILS_ROUTE, err)
+			return
+		}
+	case http.MethodPut:
+		var webhookRequest models.WebhookRequest
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&webhookRequest)
+		if err != nil {
+			s.HandleError(w, http.StatusBadRequest, ADMIN_WEBHOOK_DETAILS_ROUTE, err)
+			return
+		}
+		before := mapper.WebhookToWebhookDto(webhook)
+		result, err := service.UpdateWebhook(webhook, &webhookRequest)
+		s.audit(r, models.AUDIT_ACTION_WEBHOOK_UPDATE, webhook.ID.String(), err, before, result)
+		if errors.Is(err, services.ErrInvalidWebhook) {
+			s.HandleError(w, http.StatusBadRequest, ADMIN_WEBHOOK_DETAILS_ROUTE, err)
+			return
+		}
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_WEBHOOK_DETAILS_ROUTE, err)
+			return
+		}
+		response, err = json.Marshal(result)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_WEBHOOK_DETAILS_ROUTE, err)
+			return
+		}
+	case http.MethodDelete:
+		err := service.DeleteWebhook(webhook)
+		s.audit(r, models.AUDIT_ACTION_WEBHOOK_DELETE, webhook.ID.String(), err, mapper.WebhookToWebhookDto(webhook), nil)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, ADMIN_WEBHOOK_DETAILS_ROUTE, err)
+			return
+		}
+		status := s.getStatusCode(r.Method)
+		w.WriteHeader(status)
+		return
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// HandleWebhookDeliveries lists the deliveries of a webhook, most recent
+// first, with the outcome of their last attempt. Pages are selected with the
+// offset and limit query parameters.
+func (s *Server) HandleWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	service := s.webhookService()
+
+	webhook, err := service.GetWebhookById(mux.Vars(r)["id"])
+	if err != nil {
+		s.HandleError(w, http.StatusNotFound, ADMIN_WEBHOOK_DELIVERIES_ROUTE, err)
+		return
+	}
+	offset, limit, err := pagination(r, WEBHOOK_DEFAULT_PAGE_SIZE, WEBHOOK_MAX_PAGE_SIZE)
+	if err != nil {
+		s.HandleError(w, http.StatusBadRequest, ADMIN_WEBHOOK_DELIVERIES_ROUTE, err)
+		return
+	}
+
+	result, err := service.GetDeliveries(webhook, offset, limit)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, ADMIN_WEBHOOK_DELIVERIES_ROUTE, err)
+		return
+	}
+	response, err := json.Marshal(result)
+	if err != nil {
+		s.HandleError(w, http.StatusInternalServerError, ADMIN_WEBHOOK_DELIVERIES_ROUTE, err)
+		return
+	}
+
+	w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+	status := s.getStatusCode(r.Method)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// deliverWebhooks sends the pending webhook deliveries of all realms every
+// WEBHOOK_POLL_INTERVAL, until stop is closed.
+func (s *Server) deliverWebhooks(stop <-chan struct{}) {
+	service := s.webhookDeliveryService()
+	ticker := time.NewTicker(WEBHOOK_POLL_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			for {
+				attempted, err := service.DeliverDue(WEBHOOK_DELIVERY_BATCH, WEBHOOK_DELIVERY_LEASE)
+				if err != nil {
+					s.logger.WithError(err).Error("delivering webhooks")
+				}
+				if attempted < WEBHOOK_DELIVERY_BATCH {
+					break
+				}
+			}
+		}
+	}
+}
+
+func (s *Server) webhookService() *services.WebhookService {
+	return services.NewWebhookService(
+		s.webhookRepository.(*repository.WebhookRepository),
+		s.webhookDeliveryRepository.(*repository.WebhookDeliveryRepository),
+	)
+}
+
+// webhookDispatcher returns the publisher of the identity events of the
+// realm. Events that cannot be queued are logged.
+func (s *Server) webhookDispatcher() *services.WebhookDispatcher {
+	realm := ""
+	if s.tenant != nil {
+		realm = s.tenant.Name
+	}
+	return services.NewWebhookDispatcher(
+		s.webhookRepository.(*repository.WebhookRepository),
+		s.webhookDeliveryRepository.(*repository.WebhookDeliveryRepository),
+		realm,
+		func(err error) {
+			s.logger.WithError(err).Error("queuing webhook deliveries")
+		},
+	)
+}
+
+// webhookDeliveryService returns the service sending webhook deliveries.
+// Redirects are not followed, so that events are only posted to the URLs
+// webhooks were registered with.
+func (s *Server) webhookDeliveryService() *services.WebhookDeliveryService {
+	client := &http.Client{
+		Timeout: WEBHOOK_HTTP_TIMEOUT,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return services.NewWebhookDeliveryService(
+		s.webhookDeliveryRepository.(*repository.WebhookDeliveryRepository),
+		client,
+		WEBHOOK_DELIVERY_ATTEMPTS,
+		WEBHOOK_RETRY_BACKOFF,
+		WEBHOOK_MAX_RETRY_BACKOFF,
+	)
+}
@@ -46,3 +46,11 @@ func (s *ApplicationService) CreateApplication(app *models.ApplicationDto) (*mod
 	}
 	return mapper.ApplicationToApplicationDto(appModel), nil
 }
+
+func (s *ApplicationService) GetApplicationById(id string) (*models.Application, error) {
+	appId, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.FindById(context.Background(), appId.String())
+}
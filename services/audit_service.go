@@ -0,0 +1,92 @@
+package services
+
+import (
+	"auth-server/mapper"
+	"auth-server/models"
+	"auth-server/repository"
+	"context"
+	"fmt"
+)
+
+// auditVerificationBatch is the number of events read at once while
+// verifying the hash chain.
+const auditVerificationBatch = 500
+
+type AuditService struct {
+	repo    *repository.AuditEventRepository
+	chained bool
+}
+
+// NewAuditService creates a new instance of AuditService. When chained is
+// set, the events recorded are appended to the hash chain of their realm.
+func NewAuditService(repo *repository.AuditEventRepository, chained bool) *AuditService {
+	return &AuditService{repo: repo, chained: chained}
+}
+
+// Record appends the event to the audit log.
+func (s *AuditService) Record(event *models.AuditEvent) error {
+	var err error
+	if s.chained {
+		_, err = s.repo.Append(context.Background(), event)
+	} else {
+		_, err = s.repo.Save(context.Background(), event)
+	}
+	return err
+}
+
+// Search returns a page of the events matching the filter, most recent first.
+func (s *AuditService) Search(filter *models.AuditFilter, offset int, limit int) (*models.AuditEventPage, error) {
+	events, total, err := s.repo.FindByFilter(context.Background(), filter, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &models.AuditEventPage{
+		Total:  total,
+		Offset: offset,
+		Limit:  limit,
+		Events: mapper.AuditEventsToAuditEventDtos(events),
+	}, nil
+}
+
+// Verify walks the audit log in the order events were appended, checking
+// that every chained event holds the hash of the event before it and that
+// its own hash matches its content. Events recorded while chaining was
+// disabled are not checked.
+func (s *AuditService) Verify() (*models.AuditVerification, error) {
+	ctx := context.Background()
+	result := &models.AuditVerification{Valid: true}
+	var lastId uint
+	previousHash := ""
+	for {
+		events, err := s.repo.FindAfter(ctx, lastId, auditVerificationBatch)
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range events {
+			result.Checked++
+			lastId = event.ID
+			if event.Hash == "" {
+				previousHash = ""
+				continue
+			}
+			result.Chained++
+			reason := ""
+			switch {
+			case event.PreviousHash != previousHash:
+				reason = fmt.Sprintf("the event does not follow the event before it, whose hash is %q", previousHash)
+			case event.Hash != event.ComputeHash():
+				reason = "the content of the event does not match its hash"
+			}
+			if reason != "" {
+				result.Valid = false
+				result.BrokenAt = event.ID
+				result.Reason = reason
+				return result, nil
+			}
+			previousHash = event.Hash
+		}
+		if len(events) < auditVerificationBatch {
+			return result, nil
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"auth-server/models"
+	"auth-server/repository"
+	"auth-server/repository/repositorytest"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newAuditChain returns n events numbered from 1, chained like the repository
+// appends them.
+func newAuditChain(n int) []*models.AuditEvent {
+	events := make([]*models.AuditEvent, n)
+	previousHash := ""
+	start := time.Now().UTC().Truncate(time.Microsecond)
+	for i := range events {
+		event := &models.AuditEvent{
+			ID:           uint(i + 1),
+			CreatedAt:    start.Add(time.Duration(i) * time.Second),
+			Actor:        "alice",
+			Action:       models.AUDIT_ACTION_USER_UPDATE,
+			Target:       fmt.Sprintf("user-%d", i),
+			Outcome:      "success",
+			PreviousHash: previousHash,
+		}
+		event.Hash = event.ComputeHash()
+		previousHash = event.Hash
+		events[i] = event
+	}
+	return events
+}
+
+func TestVerifyAuditLog(t *testing.T) {
+	tests := []struct {
+		name     string
+		events   func() []*models.AuditEvent
+		checked  int
+		chained  int
+		brokenAt uint
+		reason   string
+	}{
+		{"empty", func() []*models.AuditEvent { return nil }, 0, 0, 0, ""},
+		{"intact", func() []*models.AuditEvent { return newAuditChain(3) }, 3, 3, 0, ""},
+		{"unchained events", func() []*models.AuditEvent {
+			events := newAuditChain(3)
+			// Chaining was disabled for the second event, and enabled
+			// again from the third one on, which starts a new chain.
+			events[1].PreviousHash, events[1].Hash = "", ""
+			events[2].PreviousHash = ""
+			events[2].Hash = events[2].ComputeHash()
+			return events
+		}, 3, 2, 0, ""},
+		{"altered content", func() []*models.AuditEvent {
+			events := newAuditChain(3)
+			events[1].Outcome = "failure"
+			return events
+		}, 2, 2, 2, "the content of the event does not match its hash"},
+		{"altered hash", func() []*models.AuditEvent {
+			events := newAuditChain(3)
+			events[1].Outcome = "failure"
+			events[1].Hash = events[1].ComputeHash()
+			return events
+		}, 3, 3, 3, "the event does not follow the event before it"},
+		{"removed event", func() []*models.AuditEvent {
+			events := newAuditChain(3)
+			return append(events[:1], events[2:]...)
+		}, 2, 2, 3, "the event does not follow the event before it"},
+		{"reordered events", func() []*models.AuditEvent {
+			events := newAuditChain(3)
+			events[1], events[2] = events[2], events[1]
+			return events
+		}, 2, 2, 3, "the event does not follow the event before it"},
+		{"hash removed from an event", func() []*models.AuditEvent {
+			events := newAuditChain(3)
+			events[1].Hash = ""
+			return events
+		}, 3, 2, 3, "the event does not follow the event before it"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := repositorytest.New(t)
+			events := tt.events()
+			if len(events) > 0 {
+				fake.Return(`FROM "audit_events" WHERE id > 0 ORDER BY id`, toInterfaces(events)...)
+			}
+
+			result, err := NewAuditService(repository.NewAuditEventRepository(db), true).Verify()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Checked != tt.checked || result.Chained != tt.chained {
+				t.Errorf("checked %d events, %d of them chained, want %d and %d", result.Checked, result.Chained, tt.checked, tt.chained)
+			}
+			if result.Valid != (tt.brokenAt == 0) || result.BrokenAt != tt.brokenAt {
+				t.Errorf("valid = %v, broken at %d, want broken at %d", result.Valid, result.BrokenAt, tt.brokenAt)
+			}
+			if !strings.HasPrefix(result.Reason, tt.reason) {
+				t.Errorf("reason = %q, want %q", result.Reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestVerifyAuditLogInBatches(t *testing.T) {
+	db, fake := repositorytest.New(t)
+	events := newAuditChain(auditVerificationBatch + 2)
+	fake.Return(`WHERE id > 0 ORDER BY id LIMIT 500`, toInterfaces(events[:auditVerificationBatch])...)
+	fake.Return(`WHERE id > 500 ORDER BY id LIMIT 500`, toInterfaces(events[auditVerificationBatch:])...)
+
+	result, err := NewAuditService(repository.NewAuditEventRepository(db), true).Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Valid || result.Checked != len(events) {
+		t.Errorf("result = %+v, want the %d events checked", result, len(events))
+	}
+	if statements := fake.Statements(); len(statements) != 2 {
+		t.Errorf("statements = %q", statements)
+	}
+}
+
+func toInterfaces(events []*models.AuditEvent) []interface{} {
+	entities := make([]interface{}, len(events))
+	for i, event := range events {
+		entities[i] = event
+	}
+	return entities
+}
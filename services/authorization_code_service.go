@@ -0,0 +1,75 @@
+package services
+
+import (
+	"auth-server/models"
+	"auth-server/repository"
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrInvalidAuthorizationCode is returned when an authorization code is
+// unknown, expired, already used, or redeemed by another client or with
+// parameters that do not match the authorization request.
+var ErrInvalidAuthorizationCode = errors.New("invalid authorization code")
+
+type AuthorizationCodeService struct {
+	repo *repository.AuthorizationCodeRepository
+}
+
+// NewAuthorizationCodeService creates a new instance of AuthorizationCodeService with the provided AuthorizationCodeRepository.
+func NewAuthorizationCodeService(repo *repository.AuthorizationCodeRepository) *AuthorizationCodeService {
+	return &AuthorizationCodeService{repo: repo}
+}
+
+// CreateCode issues an authorization code to the client once the user logged
+// in with the session authorized its request to access the application. It
+// returns the code, which is not stored in clear.
+func (s *AuthorizationCodeService) CreateCode(client *models.Client, app *models.Application, session *models.Session, request *models.AuthorizeRequest, lifetime time.Duration) (string, error) {
+	ctx := context.Background()
+	err := s.repo.DeleteExpired(ctx, time.Now())
+	if err != nil {
+		return "", err
+	}
+	authorizationCode, code, err := models.NewAuthorizationCode(client.ID, app.ID, session.UserID, request.RedirectURI, request.Scope, lifetime)
+	if err != nil {
+		return "", err
+	}
+	authorizationCode.CodeChallenge = request.CodeChallenge
+	authorizationCode.CodeChallengeMethod = request.CodeChallengeMethod
+	authorizationCode.SessionID = session.ID
+	authorizationCode.AuthTime = session.AuthTime
+	_, err = s.repo.Save(ctx, authorizationCode)
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// Redeem exchanges the authorization code on behalf of the client, as
+// described in RFC 6749, section 4.1.3. The code is consumed as soon as it is
+// found, so that it cannot be redeemed twice, even if the request is invalid.
+func (s *AuthorizationCodeService) Redeem(code string, clientId string, redirectURI string, codeVerifier string) (*models.AuthorizationCode, error) {
+	ctx := context.Background()
+	authorizationCode, err := s.repo.FindByCode(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if authorizationCode == nil || authorizationCode.ClientID.String() != clientId {
+		return nil, ErrInvalidAuthorizationCode
+	}
+	consumed, err := s.repo.Consume(ctx, authorizationCode.ID.String())
+	if err != nil {
+		return nil, err
+	}
+	if !consumed || authorizationCode.IsExpired() {
+		return nil, ErrInvalidAuthorizationCode
+	}
+	if authorizationCode.RedirectURI != redirectURI {
+		return nil, ErrInvalidAuthorizationCode
+	}
+	if !authorizationCode.VerifyCodeVerifier(codeVerifier) {
+		return nil, ErrInvalidAuthorizationCode
+	}
+	return authorizationCode, nil
+}
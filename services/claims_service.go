@@ -0,0 +1,54 @@
+package services
+
+import (
+	"auth-server/models"
+	"auth-server/repository"
+	"context"
+	"sort"
+)
+
+type ClaimsService struct {
+	userRepo *repository.UserRepository
+	roleRepo *repository.RoleRepository
+}
+
+// NewClaimsService creates a new instance of ClaimsService with the provided repositories.
+func NewClaimsService(userRepo *repository.UserRepository, roleRepo *repository.RoleRepository) *ClaimsService {
+	return &ClaimsService{userRepo: userRepo, roleRepo: roleRepo}
+}
+
+// GetAuthorizationClaims returns the names of the roles the user holds in the
+// given application, whether assigned directly or through groups, including
+// the ones inherited through composite roles,
+// along with the names of the permissions those roles grant.
+// Roles belonging to other applications are ignored.
+func (s *ClaimsService) GetAuthorizationClaims(user *models.User, applicationId string) (*models.AuthorizationClaims, error) {
+	roles, err := s.userRepo.GetEffectiveRoles(context.Background(), user)
+	if err != nil {
+		return nil, err
+	}
+	roles, err = NewRoleService(s.roleRepo).GetEffectiveRoles(roles, applicationId)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &models.AuthorizationClaims{
+		Roles:       make([]string, 0),
+		Permissions: make([]string, 0),
+	}
+	for _, role := range roles {
+		claims.Roles = append(claims.Roles, role.Name)
+	}
+	seen := make(map[string]bool)
+	for _, permission := range models.CollectPermissions(roles) {
+		if seen[permission.Name] {
+			continue
+		}
+		seen[permission.Name] = true
+		claims.Permissions = append(claims.Permissions, permission.Name)
+	}
+
+	sort.Strings(claims.Roles)
+	sort.Strings(claims.Permissions)
+	return claims, nil
+}
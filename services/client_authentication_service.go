@@ -0,0 +1,317 @@
+package services
+
+import (
+	"auth-server/cache"
+	"auth-server/models"
+	"auth-server/repository"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// CLIENT_ASSERTION_TYPE_JWT_BEARER is the client_assertion_type of JWT client
+// assertions, defined by RFC 7523, section 2.2.
+const CLIENT_ASSERTION_TYPE_JWT_BEARER = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// ErrInvalidClient is returned when a client cannot be authenticated.
+var ErrInvalidClient = errors.New("client authentication failed")
+
+// assertionLeeway is the clock skew tolerated when checking the time claims
+// of a client assertion.
+const assertionLeeway = time.Minute
+
+// maxAssertionLifetime bounds how long a client assertion may be valid for,
+// so that its jti is only remembered for a short while to prevent replays.
+const maxAssertionLifetime = 5 * time.Minute
+
+type ClientAuthenticationService struct {
+	repo          *repository.ClientRepository
+	replayCache   *cache.ReplayCache
+	keySetCache   *cache.Cache[*models.JSONWebKeySet]
+	allowFileJwks bool
+	httpClient    *http.Client
+}
+
+// NewClientAuthenticationService creates a new instance of ClientAuthenticationService.
+// Assertion ids are remembered in replayCache, and key sets fetched from JWKS URIs
+// in keySetCache. JWKS URIs with the file scheme are only allowed if allowFileJwks is set.
+func NewClientAuthenticationService(repo *repository.ClientRepository, replayCache *cache.ReplayCache, keySetCache *cache.Cache[*models.JSONWebKeySet], allowFileJwks bool) *ClientAuthenticationService {
+	return &ClientAuthenticationService{
+		repo:          repo,
+		replayCache:   replayCache,
+		keySetCache:   keySetCache,
+		allowFileJwks: allowFileJwks,
+		httpClient:    &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// AuthenticateWithAssertion authenticates a client with a signed JWT assertion,
+// as described in RFC 7523, section 3. The assertion must be signed with one of
+// the client's registered keys, be issued by and about the client, be intended
+// for one of the given audiences, be unexpired but short-lived, and not have
+// been used before.
+// If clientId is not blank, it must identify the same client as the assertion.
+func (s *ClientAuthenticationService) AuthenticateWithAssertion(clientId string, assertionType string, assertion string, audiences []string) (*models.Client, error) {
+	if assertionType != CLIENT_ASSERTION_TYPE_JWT_BEARER {
+		return nil, fmt.Errorf("%w: unsupported client_assertion_type", ErrInvalidClient)
+	}
+	token, err := models.ParseSignedToken(assertion)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidClient, err)
+	}
+
+	sub := token.ClaimString("sub")
+	if sub == "" || token.ClaimString("iss") != sub {
+		return nil, fmt.Errorf("%w: the assertion must be issued by its subject", ErrInvalidClient)
+	}
+	if clientId != "" && clientId != sub {
+		return nil, fmt.Errorf("%w: the assertion subject does not match client_id", ErrInvalidClient)
+	}
+	client, err := s.repo.FindById(context.Background(), sub)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unknown client", ErrInvalidClient)
+	}
+	if client.TokenEndpointAuthMethod != models.CLIENT_AUTH_PRIVATE_KEY_JWT {
+		return nil, fmt.Errorf("%w: the client does not authenticate with private_key_jwt", ErrInvalidClient)
+	}
+
+	keySet, err := s.clientKeySet(client)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidClient, err)
+	}
+	if err := verifyWithKeySet(token, keySet); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidClient, err)
+	}
+
+	if !hasAudience(token.Audiences(), audiences) {
+		return nil, fmt.Errorf("%w: the assertion is not intended for this server", ErrInvalidClient)
+	}
+	expiry, err := validateAssertionLifetime(token, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	jti := token.ClaimString("jti")
+	if jti == "" {
+		return nil, fmt.Errorf("%w: the assertion has no jti", ErrInvalidClient)
+	}
+	if !s.replayCache.Use(client.ID.String()+":"+jti, expiry) {
+		return nil, fmt.Errorf("%w: the assertion was already used", ErrInvalidClient)
+	}
+	return client, nil
+}
+
+// validateAssertionLifetime checks the time claims of a client assertion, and
+// returns until when its jti must be remembered. Assertions must expire within
+// maxAssertionLifetime, both from now and from when they were issued.
+func validateAssertionLifetime(token *models.SignedToken, now time.Time) (time.Time, error) {
+	exp, ok := token.ClaimTime("exp")
+	if !ok || now.After(time.Unix(exp, 0).Add(assertionLeeway)) {
+		return time.Time{}, fmt.Errorf("%w: the assertion has expired", ErrInvalidClient)
+	}
+	if time.Unix(exp, 0).After(now.Add(maxAssertionLifetime + assertionLeeway)) {
+		return time.Time{}, fmt.Errorf("%w: the assertion is valid for too long", ErrInvalidClient)
+	}
+	if iat, ok := token.ClaimTime("iat"); ok && exp-iat > int64(maxAssertionLifetime.Seconds()) {
+		return time.Time{}, fmt.Errorf("%w: the assertion is valid for too long", ErrInvalidClient)
+	}
+	if nbf, ok := token.ClaimTime("nbf"); ok && now.Add(assertionLeeway).Before(time.Unix(nbf, 0)) {
+		return time.Time{}, fmt.Errorf("%w: the assertion is not valid yet", ErrInvalidClient)
+	}
+	return time.Unix(exp, 0).Add(assertionLeeway), nil
+}
+
+// AuthenticateWithCertificate authenticates a client with the certificate chain
+// it presented during the TLS handshake, as described in RFC 8705, section 2.
+// Clients using tls_client_auth must present a certificate issued by one of
+// the roots, whose subject matches the one they registered. Clients using
+// self_signed_tls_client_auth must present a certificate whose public key is
+// one of their registered keys.
+func (s *ClientAuthenticationService) AuthenticateWithCertificate(clientId string, chain []*x509.Certificate, roots *x509.CertPool) (*models.Client, error) {
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("%w: no client certificate was presented", ErrInvalidClient)
+	}
+	client, err := s.repo.FindById(context.Background(), clientId)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unknown client", ErrInvalidClient)
+	}
+	cert := chain[0]
+
+	switch client.TokenEndpointAuthMethod {
+	case models.CLIENT_AUTH_TLS_CLIENT_AUTH:
+		if roots == nil {
+			return nil, fmt.Errorf("%w: no trusted client certificate authorities are configured", ErrInvalidClient)
+		}
+		intermediates := x509.NewCertPool()
+		for _, intermediate := range chain[1:] {
+			intermediates.AddCert(intermediate)
+		}
+		_, err := cert.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidClient, err)
+		}
+		if !matchesCertificateSubject(client, cert) {
+			return nil, fmt.Errorf("%w: the certificate subject does not match the registered one", ErrInvalidClient)
+		}
+		return client, nil
+
+	case models.CLIENT_AUTH_SELF_SIGNED_TLS_CLIENT_AUTH:
+		keySet, err := s.clientKeySet(client)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidClient, err)
+		}
+		for _, key := range keySet.Keys {
+			publicKey, err := key.PublicKey()
+			if err != nil {
+				continue
+			}
+			if equalPublicKeys(publicKey, cert.PublicKey) {
+				return client, nil
+			}
+		}
+		return nil, fmt.Errorf("%w: the certificate does not match any registered key", ErrInvalidClient)
+
+	default:
+		return nil, fmt.Errorf("%w: the client does not authenticate with a certificate", ErrInvalidClient)
+	}
+}
+
+// matchesCertificateSubject returns true if the certificate has the subject
+// the client registered.
+func matchesCertificateSubject(client *models.Client, cert *x509.Certificate) bool {
+	switch {
+	case client.TlsClientAuthSubjectDN != "":
+		return cert.Subject.String() == client.TlsClientAuthSubjectDN
+	case client.TlsClientAuthSanDNS != "":
+		for _, name := range cert.DNSNames {
+			if name == client.TlsClientAuthSanDNS {
+				return true
+			}
+		}
+	case client.TlsClientAuthSanURI != "":
+		for _, uri := range cert.URIs {
+			if uri.String() == client.TlsClientAuthSanURI {
+				return true
+			}
+		}
+	case client.TlsClientAuthSanIP != "":
+		ip := net.ParseIP(client.TlsClientAuthSanIP)
+		for _, address := range cert.IPAddresses {
+			if address.Equal(ip) {
+				return true
+			}
+		}
+	case client.TlsClientAuthSanEmail != "":
+		for _, email := range cert.EmailAddresses {
+			if email == client.TlsClientAuthSanEmail {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func equalPublicKeys(a crypto.PublicKey, b crypto.PublicKey) bool {
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(b)
+}
+
+// clientKeySet returns the keys registered by the client, fetching them from
+// its JWKS URI if needed.
+func (s *ClientAuthenticationService) clientKeySet(client *models.Client) (*models.JSONWebKeySet, error) {
+	if client.JwksURI == "" {
+		return client.Jwks, nil
+	}
+	if keySet, ok := s.keySetCache.Get(client.JwksURI); ok {
+		return keySet, nil
+	}
+	keySet, err := s.fetchKeySet(client.JwksURI)
+	if err != nil {
+		return nil, err
+	}
+	s.keySetCache.Set(client.JwksURI, keySet)
+	return keySet, nil
+}
+
+func (s *ClientAuthenticationService) fetchKeySet(jwksURI string) (*models.JSONWebKeySet, error) {
+	uri, err := url.Parse(jwksURI)
+	if err != nil {
+		return nil, err
+	}
+
+	var body []byte
+	switch uri.Scheme {
+	case "file":
+		if !s.allowFileJwks {
+			return nil, errors.New("file jwks_uri are not allowed")
+		}
+		body, err = os.ReadFile(uri.Path)
+		if err != nil {
+			return nil, err
+		}
+	case "http", "https":
+		response, err := s.httpClient.Get(jwksURI)
+		if err != nil {
+			return nil, err
+		}
+		defer response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetching jwks_uri returned status %d", response.StatusCode)
+		}
+		body, err = io.ReadAll(io.LimitReader(response.Body, 1<<20))
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("unsupported jwks_uri scheme")
+	}
+
+	var keySet models.JSONWebKeySet
+	err = json.Unmarshal(body, &keySet)
+	if err != nil {
+		return nil, err
+	}
+	return &keySet, nil
+}
+
+// verifyWithKeySet checks the token signature against the keys of the set
+// matching its kid and algorithm.
+func verifyWithKeySet(token *models.SignedToken, keySet *models.JSONWebKeySet) error {
+	keys := keySet.Find(token.HeaderString("kid"), token.Alg())
+	if len(keys) == 0 {
+		return errors.New("no registered key matches the assertion")
+	}
+	for _, key := range keys {
+		publicKey, err := key.PublicKey()
+		if err != nil {
+			continue
+		}
+		if token.Verify(publicKey) == nil {
+			return nil
+		}
+	}
+	return errors.New("invalid assertion signature")
+}
+
+func hasAudience(audiences []string, expected []string) bool {
+	for _, aud := range audiences {
+		for _, e := range expected {
+			if aud == e {
+				return true
+			}
+		}
+	}
+	return false
+}
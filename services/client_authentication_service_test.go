@@ -0,0 +1,48 @@
+package services
+
+import (
+	"auth-server/models"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidateAssertionLifetime(t *testing.T) {
+	now := time.Now()
+	at := func(offset time.Duration) float64 {
+		return float64(now.Add(offset).Unix())
+	}
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		valid  bool
+	}{
+		{"short-lived", map[string]interface{}{"iat": at(0), "exp": at(2 * time.Minute)}, true},
+		{"short-lived without iat", map[string]interface{}{"exp": at(5 * time.Minute)}, true},
+		{"expired within the leeway", map[string]interface{}{"exp": at(-30 * time.Second)}, true},
+		{"valid from within the leeway", map[string]interface{}{"nbf": at(30 * time.Second), "exp": at(time.Minute)}, true},
+		{"missing exp", map[string]interface{}{"iat": at(0)}, false},
+		{"expired", map[string]interface{}{"exp": at(-2 * time.Minute)}, false},
+		{"not valid yet", map[string]interface{}{"nbf": at(2 * time.Minute), "exp": at(3 * time.Minute)}, false},
+		{"expiring in an hour", map[string]interface{}{"exp": at(time.Hour)}, false},
+		{"expiring in years", map[string]interface{}{"iat": at(0), "exp": at(5 * 365 * 24 * time.Hour)}, false},
+		{"issued for too long", map[string]interface{}{"iat": at(-time.Hour), "exp": at(time.Minute)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expiry, err := validateAssertionLifetime(&models.SignedToken{Claims: tt.claims}, now)
+			if !tt.valid {
+				if !errors.Is(err, ErrInvalidClient) {
+					t.Fatalf("error = %v, want ErrInvalidClient", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if limit := now.Add(maxAssertionLifetime + 2*assertionLeeway); expiry.After(limit) {
+				t.Errorf("the jti is remembered until %v, after %v", expiry, limit)
+			}
+		})
+	}
+}
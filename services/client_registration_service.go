@@ -0,0 +1,158 @@
+package services
+
+import (
+	"auth-server/models"
+	"auth-server/repository"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidRegistrationToken is returned when a registration access token
+// does not grant access to the client configuration.
+var ErrInvalidRegistrationToken = errors.New("invalid registration access token")
+
+type ClientRegistrationService struct {
+	repo *repository.ClientRepository
+}
+
+func NewClientRegistrationService(repo *repository.ClientRepository) *ClientRegistrationService {
+	return &ClientRegistrationService{repo: repo}
+}
+
+// RegisterClient registers a client with the given metadata, as described in
+// RFC 7591, section 3. It returns the client along with its registration
+// access token, which is not stored and cannot be retrieved afterwards.
+func (s *ClientRegistrationService) RegisterClient(metadata *models.ClientMetadata) (*models.Client, string, error) {
+	client := &models.Client{
+		BaseUUIDEntity: models.BaseUUIDEntity{
+			ID: uuid.New(),
+		},
+	}
+	err := s.applyMetadata(client, metadata)
+	if err != nil {
+		return nil, "", err
+	}
+	token, err := models.NewRegistrationAccessToken()
+	if err != nil {
+		return nil, "", err
+	}
+	client.RegistrationAccessTokenHash = models.HashRegistrationAccessToken(token)
+	client, err = s.repo.Save(context.Background(), client)
+	if err != nil {
+		return nil, "", err
+	}
+	return client, token, nil
+}
+
+// AuthenticateRegistration returns the client whose configuration the
+// registration access token grants access to.
+func (s *ClientRegistrationService) AuthenticateRegistration(clientId string, token string) (*models.Client, error) {
+	if _, err := uuid.Parse(clientId); err != nil {
+		return nil, ErrInvalidRegistrationToken
+	}
+	client, err := s.repo.FindById(context.Background(), clientId)
+	if err != nil || client.RegistrationAccessTokenHash == "" {
+		return nil, ErrInvalidRegistrationToken
+	}
+	hash := models.HashRegistrationAccessToken(token)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(client.RegistrationAccessTokenHash)) != 1 {
+		return nil, ErrInvalidRegistrationToken
+	}
+	return client, nil
+}
+
+// UpdateClient replaces the metadata of the client with the metadata of the
+// request, as described in RFC 7592, section 2.2. Metadata omitted from the
+// request is reset to its default value.
+func (s *ClientRegistrationService) UpdateClient(client *models.Client, request *models.ClientRegistrationRequest) (*models.Client, error) {
+	if request.ClientID != client.ID.String() {
+		return nil, fmt.Errorf("%w: client_id does not match the client being updated", ErrInvalidClientMetadata)
+	}
+	err := s.applyMetadata(client, &request.ClientMetadata)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.Save(context.Background(), client)
+}
+
+// DeleteClient deregisters the client, as described in RFC 7592, section 2.3.
+func (s *ClientRegistrationService) DeleteClient(client *models.Client) error {
+	return s.repo.Delete(context.Background(), client.ID.String())
+}
+
+// validateRegisteredScope checks that a client registering itself does not
+// ask for a reserved scope, which would let it use the server's own APIs.
+func validateRegisteredScope(scope string) error {
+	for _, value := range strings.Fields(scope) {
+		if models.IsReservedScope(value) {
+			return fmt.Errorf("%w: the %s scope can only be granted by an administrator", ErrInvalidClientMetadata, value)
+		}
+	}
+	return nil
+}
+
+// applyMetadata sets the metadata of the client, filling in the defaults from
+// RFC 7591, section 2, and validates it. Client names must be unique, so
+// clients registering without a name are named after their id. Clients that
+// omit their authentication method authenticate with a secret sent with HTTP
+// Basic authentication, and clients that do not authenticate are registered
+// as public clients.
+func (s *ClientRegistrationService) applyMetadata(client *models.Client, metadata *models.ClientMetadata) error {
+	client.ClientName = metadata.ClientName
+	client.RedirectURIs = metadata.RedirectURIs
+	client.PostLogoutRedirectURIs = metadata.PostLogoutRedirectURIs
+	client.BackchannelLogoutURI = metadata.BackchannelLogoutURI
+	client.FrontchannelLogoutURI = metadata.FrontchannelLogoutURI
+	client.LogoutSessionRequired = metadata.BackchannelLogoutSession || metadata.FrontchannelLogoutSession
+	client.GrantTypes = metadata.GrantTypes
+	client.ResponseTypes = metadata.ResponseTypes
+	client.Scope = metadata.Scope
+	client.Contacts = metadata.Contacts
+	client.ClientURI = metadata.ClientURI
+	client.LogoURI = metadata.LogoURI
+	client.TokenEndpointAuthMethod = metadata.TokenEndpointAuthMethod
+	client.JwksURI = metadata.JwksURI
+	client.Jwks = metadata.Jwks
+	client.TlsClientAuthSubjectDN = metadata.TlsClientAuthSubjectDN
+	client.TlsClientAuthSanDNS = metadata.TlsClientAuthSanDNS
+	client.TlsClientAuthSanURI = metadata.TlsClientAuthSanURI
+	client.TlsClientAuthSanIP = metadata.TlsClientAuthSanIP
+	client.TlsClientAuthSanEmail = metadata.TlsClientAuthSanEmail
+	client.CertificateBoundTokens = metadata.CertificateBoundTokens
+
+	if client.ClientName == "" {
+		client.ClientName = client.ID.String()
+	}
+	if len(client.GrantTypes) == 0 {
+		client.GrantTypes = models.StringList{models.GRANT_TYPE_AUTHORIZATION_CODE}
+	}
+	if len(client.ResponseTypes) == 0 && client.GrantTypes.Contains(models.GRANT_TYPE_AUTHORIZATION_CODE) {
+		client.ResponseTypes = models.StringList{models.RESPONSE_TYPE_CODE}
+	}
+	if client.TokenEndpointAuthMethod == "" {
+		client.TokenEndpointAuthMethod = models.CLIENT_AUTH_CLIENT_SECRET_BASIC
+	}
+	client.ClientType = defaultClientType(client.TokenEndpointAuthMethod)
+	err := validateClientMetadata(client)
+	if err != nil {
+		return err
+	}
+	err = validateRegisteredScope(client.Scope)
+	if err != nil {
+		return err
+	}
+
+	existing, err := s.repo.FindByName(context.Background(), client.ClientName)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.ID != client.ID {
+		return fmt.Errorf("%w: client_name is already taken", ErrInvalidClientMetadata)
+	}
+	return nil
+}
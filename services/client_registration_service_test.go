@@ -0,0 +1,33 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateRegisteredScope(t *testing.T) {
+	tests := []struct {
+		name  string
+		scope string
+		valid bool
+	}{
+		{"no scope", "", true},
+		{"regular scopes", "openid profile email", true},
+		{"scope containing the reserved one", "scim:read", true},
+		{"provisioning scope", "scim", false},
+		{"provisioning scope among others", "openid scim profile", false},
+		{"provisioning scope with extra spaces", "  scim ", false},
+		{"administration scope", "openid admin", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRegisteredScope(tt.scope)
+			if tt.valid && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidClientMetadata) {
+				t.Fatalf("error = %v, want ErrInvalidClientMetadata", err)
+			}
+		})
+	}
+}
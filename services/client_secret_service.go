@@ -0,0 +1,117 @@
+package services
+
+import (
+	"auth-server/hasher"
+	"auth-server/mapper"
+	"auth-server/models"
+	"auth-server/repository"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ClientSecretService struct {
+	repo   *repository.ClientSecretRepository
+	hasher hasher.Hasher
+}
+
+func NewClientSecretService(repo *repository.ClientSecretRepository, hasher hasher.Hasher) *ClientSecretService {
+	return &ClientSecretService{repo: repo, hasher: hasher}
+}
+
+// GetSecrets returns the secrets of the client, newest first.
+func (s *ClientSecretService) GetSecrets(client *models.Client) ([]*models.ClientSecretDto, error) {
+	secrets, err := s.repo.FindByClientId(context.Background(), client.ID.String())
+	if err != nil {
+		return nil, err
+	}
+	return mapper.ClientSecretsToClientSecretDtos(secrets), nil
+}
+
+// CreateSecret generates a new secret for the client, which expires after
+// lifetime unless lifetime is zero. The client's other secrets remain valid
+// for gracePeriod, so that the new secret can be rolled out without downtime.
+// The returned secret is the only time its value is available.
+func (s *ClientSecretService) CreateSecret(client *models.Client, lifetime time.Duration, gracePeriod time.Duration) (*models.ClientSecretDto, error) {
+	if !client.UsesClientSecret() {
+		return nil, errors.New("the client does not authenticate with a secret")
+	}
+	if lifetime < 0 || gracePeriod < 0 {
+		return nil, errors.New("secret lifetime and grace period cannot be negative")
+	}
+	value, err := models.NewClientSecretValue()
+	if err != nil {
+		return nil, err
+	}
+	hash, err := s.hasher.GenerateFromPassword(value)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	secret := &models.ClientSecret{
+		BaseUUIDEntity: models.BaseUUIDEntity{
+			ID: uuid.New(),
+		},
+		ClientID:   client.ID,
+		SecretHash: hash,
+	}
+	if lifetime > 0 {
+		expiresAt := now.Add(lifetime)
+		secret.ExpiresAt = &expiresAt
+	}
+	err = s.repo.Rotate(context.Background(), secret, now.Add(gracePeriod))
+	if err != nil {
+		return nil, err
+	}
+	dto := mapper.ClientSecretToClientSecretDto(secret)
+	dto.Secret = value
+	return dto, nil
+}
+
+// HasActiveSecret returns true if the client holds a secret it can
+// authenticate with.
+func (s *ClientSecretService) HasActiveSecret(client *models.Client) (bool, error) {
+	secrets, err := s.repo.FindActiveByClientId(context.Background(), client.ID.String())
+	if err != nil {
+		return false, err
+	}
+	return len(secrets) > 0, nil
+}
+
+// RevokeSecret revokes one of the client's secrets before it expires.
+func (s *ClientSecretService) RevokeSecret(client *models.Client, secretId string) (*models.ClientSecretDto, error) {
+	secret, err := s.repo.FindById(context.Background(), secretId)
+	if err != nil || secret.ClientID != client.ID {
+		return nil, fmt.Errorf("secret %s not found", secretId)
+	}
+	if secret.RevokedAt == nil {
+		now := time.Now()
+		secret.RevokedAt = &now
+		secret, err = s.repo.Save(context.Background(), secret)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return mapper.ClientSecretToClientSecretDto(secret), nil
+}
+
+// VerifySecret checks the secret against the client's active secrets. The
+// check is traced as part of the trace carried by ctx.
+func (s *ClientSecretService) VerifySecret(ctx context.Context, client *models.Client, value string) error {
+	ctx, span := startSpan(ctx, "ClientSecretService.VerifySecret")
+	defer span.End()
+	secrets, err := s.repo.FindActiveByClientId(ctx, client.ID.String())
+	if err != nil {
+		return failSpan(span, err)
+	}
+	for _, secret := range secrets {
+		if compareHashAndPassword(ctx, s.hasher, secret.SecretHash, value) == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: invalid client secret", ErrInvalidClient)
+}
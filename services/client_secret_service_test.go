@@ -0,0 +1,161 @@
+package services
+
+import (
+	"auth-server/models"
+	"auth-server/repository"
+	"auth-server/repository/repositorytest"
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	setExpiresAt   = regexp.MustCompile(`"expires_at"='([^']+)'`)
+	expiresAtAfter = regexp.MustCompile(`expires_at > '([^']+)'`)
+)
+
+// sqlTime parses the time a pattern matches in a statement.
+func sqlTime(t *testing.T, pattern *regexp.Regexp, statement string) time.Time {
+	t.Helper()
+	match := pattern.FindStringSubmatch(statement)
+	if match == nil {
+		t.Fatalf("no time matching %s: %s", pattern, statement)
+	}
+	value, err := time.ParseInLocation("2006-01-02 15:04:05.999", match[1], time.Local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func newSecretClient(method string) *models.Client {
+	return &models.Client{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, TokenEndpointAuthMethod: method}
+}
+
+func TestCreateClientSecret(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		lifetime    time.Duration
+		gracePeriod time.Duration
+		valid       bool
+	}{
+		{"no lifetime and no grace period", models.CLIENT_AUTH_CLIENT_SECRET_BASIC, 0, 0, true},
+		{"lifetime and grace period", models.CLIENT_AUTH_CLIENT_SECRET_POST, time.Hour, 10 * time.Minute, true},
+		{"negative lifetime", models.CLIENT_AUTH_CLIENT_SECRET_BASIC, -time.Hour, 0, false},
+		{"negative grace period", models.CLIENT_AUTH_CLIENT_SECRET_BASIC, time.Hour, -time.Minute, false},
+		{"public client", models.CLIENT_AUTH_NONE, time.Hour, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := repositorytest.New(t)
+			service := NewClientSecretService(repository.NewClientSecretRepository(db), plainHasher{})
+			client := newSecretClient(tt.method)
+
+			before := time.Now().Truncate(time.Millisecond)
+			secret, err := service.CreateSecret(client, tt.lifetime, tt.gracePeriod)
+			after := time.Now()
+			if !tt.valid {
+				if err == nil {
+					t.Fatal("secret created")
+				}
+				if statements := fake.Statements(); len(statements) > 0 {
+					t.Errorf("statements were run: %v", statements)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if secret.Secret == "" || !secret.Active {
+				t.Errorf("secret = %+v", secret)
+			}
+			fromNow := func(value time.Time, offset time.Duration) bool {
+				return !value.Before(before.Add(offset)) && !value.After(after.Add(offset))
+			}
+
+			var rotated, saved string
+			for _, statement := range fake.Statements() {
+				if strings.HasPrefix(statement, `UPDATE "client_secrets" SET "expires_at"`) {
+					rotated = statement
+				}
+				if strings.Contains(statement, `"secret_hash"=`) {
+					saved = statement
+				}
+			}
+			// The client's other active secrets expire at the end of the
+			// grace period, unless they already expire sooner.
+			if !strings.Contains(rotated, "client_id = '"+client.ID.String()+"' AND revoked_at IS NULL") {
+				t.Fatalf("other secrets are not expired: %q", rotated)
+			}
+			expireOthersAt := sqlTime(t, setExpiresAt, rotated)
+			if !fromNow(expireOthersAt, tt.gracePeriod) {
+				t.Errorf("other secrets expire at %v, want %v from now", expireOthersAt, tt.gracePeriod)
+			}
+			if !sqlTime(t, expiresAtAfter, rotated).Equal(expireOthersAt) {
+				t.Errorf("secrets expiring before the end of the grace period are extended: %s", rotated)
+			}
+
+			if !strings.Contains(saved, `"secret_hash"='plain$`+secret.Secret+`'`) {
+				t.Fatalf("the hash of the secret is not saved: %q", saved)
+			}
+			if tt.lifetime == 0 {
+				if !strings.Contains(saved, `"expires_at"=NULL`) || secret.ExpiresAt != "" {
+					t.Errorf("secret without a lifetime expires: %s", saved)
+				}
+				return
+			}
+			if expiresAt := sqlTime(t, setExpiresAt, saved); !fromNow(expiresAt, tt.lifetime) || secret.ExpiresAt == "" {
+				t.Errorf("secret expires at %v, want %v from now", expiresAt, tt.lifetime)
+			}
+		})
+	}
+}
+
+func TestVerifyClientSecret(t *testing.T) {
+	client := newSecretClient(models.CLIENT_AUTH_CLIENT_SECRET_BASIC)
+	gracePeriodEnd := time.Now().Add(10 * time.Minute)
+	// The previous secret is still accepted during the grace period of the
+	// current one.
+	current := &models.ClientSecret{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, ClientID: client.ID, SecretHash: "plain$current"}
+	previous := &models.ClientSecret{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, ClientID: client.ID, SecretHash: "plain$previous", ExpiresAt: &gracePeriodEnd}
+
+	tests := []struct {
+		name   string
+		secret string
+		valid  bool
+	}{
+		{"current secret", "current", true},
+		{"previous secret during the grace period", "previous", true},
+		{"unknown secret", "unknown", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := repositorytest.New(t)
+			fake.Return(`FROM "client_secrets" WHERE client_id = '`+client.ID.String()+`'`, current, previous)
+			service := NewClientSecretService(repository.NewClientSecretRepository(db), plainHasher{})
+
+			before := time.Now().Truncate(time.Millisecond)
+			err := service.VerifySecret(context.Background(), client, tt.secret)
+			if tt.valid && err != nil {
+				t.Fatal(err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidClient) {
+				t.Fatalf("error = %v, want ErrInvalidClient", err)
+			}
+			// Secrets whose grace period is over are left out by the query.
+			statements := fake.Statements()
+			if len(statements) != 1 || !strings.Contains(statements[0], "revoked_at IS NULL AND (expires_at IS NULL OR expires_at >") {
+				t.Fatalf("statements = %v", statements)
+			}
+			if checkedAt := sqlTime(t, expiresAtAfter, statements[0]); checkedAt.Before(before) {
+				t.Errorf("secrets are checked against %v, before the request", checkedAt)
+			}
+		})
+	}
+}
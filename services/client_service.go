@@ -5,10 +5,31 @@ import (
 	"auth-server/models"
 	"auth-server/repository"
 	"context"
+	"errors"
+	"fmt"
+	"net/url"
 
 	"github.com/google/uuid"
 )
 
+var (
+	// ErrInvalidRedirectURI is returned when a client registers an invalid redirect URI.
+	ErrInvalidRedirectURI = errors.New("invalid redirect URI")
+	// ErrInvalidClientMetadata is returned when the metadata of a client is invalid
+	// or inconsistent.
+	ErrInvalidClientMetadata = errors.New("invalid client metadata")
+)
+
+// supportedGrantTypes are the grant types clients may register.
+var supportedGrantTypes = models.StringList{
+	models.GRANT_TYPE_AUTHORIZATION_CODE,
+	models.GRANT_TYPE_REFRESH_TOKEN,
+	models.GRANT_TYPE_CLIENT_CREDENTIALS,
+	models.GRANT_TYPE_PASSWORD,
+	models.GRANT_TYPE_DEVICE_CODE,
+	models.GRANT_TYPE_TOKEN_EXCHANGE,
+}
+
 type ClientService struct {
 	repo *repository.ClientRepository
 }
@@ -33,17 +54,306 @@ func (s *ClientService) GetById(id string) (*models.ClientDto, error) {
 	return mapper.ClientToClientDto(client), nil
 }
 
-func (s *ClientService) CreateClient(client *models.ClientDto) (*models.ClientDto, error) {
-	clientModel := &models.Client{
+func (s *ClientService) CreateClient(request *models.ClientRequest) (*models.ClientDto, error) {
+	client := &models.Client{
 		BaseUUIDEntity: models.BaseUUIDEntity{
 			ID: uuid.New(),
 		},
-		ClientName:  client.ClientName,
-		RedirectURI: client.RedirectURI,
 	}
-	clientModel, err := s.repo.Save(context.Background(), clientModel)
+	err := applyClientRequest(client, request)
+	if err != nil {
+		return nil, err
+	}
+	client, err = s.repo.Save(context.Background(), client)
+	if err != nil {
+		return nil, err
+	}
+	return mapper.ClientToClientDto(client), nil
+}
+
+// UpdateClient replaces the settings of the client with the ones in the request.
+func (s *ClientService) UpdateClient(client *models.Client, request *models.ClientRequest) (*models.ClientDto, error) {
+	err := applyClientRequest(client, request)
+	if err != nil {
+		return nil, err
+	}
+	client, err = s.repo.Save(context.Background(), client)
+	if err != nil {
+		return nil, err
+	}
+	return mapper.ClientToClientDto(client), nil
+}
+
+func (s *ClientService) DeleteClient(client *models.Client) error {
+	return s.repo.Delete(context.Background(), client.ID.String())
+}
+
+func (s *ClientService) GetClientById(id string) (*models.Client, error) {
+	clientId, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.FindById(context.Background(), clientId.String())
+}
+
+// AssignExchangeAudiences replaces the applications the client may exchange tokens for.
+func (s *ClientService) AssignExchangeAudiences(client *models.Client, apps []*models.Application) ([]*models.ApplicationDto, error) {
+	err := s.repo.AssignExchangeAudiences(context.Background(), client, apps)
+	if err != nil {
+		return nil, err
+	}
+	return s.getExchangeAudiences(client.ID.String())
+}
+
+// AddExchangeAudiences adds to the applications the client may exchange tokens for.
+func (s *ClientService) AddExchangeAudiences(client *models.Client, apps []*models.Application) ([]*models.ApplicationDto, error) {
+	err := s.repo.AddExchangeAudiences(context.Background(), client, apps)
+	if err != nil {
+		return nil, err
+	}
+	return s.getExchangeAudiences(client.ID.String())
+}
+
+func (s *ClientService) getExchangeAudiences(id string) ([]*models.ApplicationDto, error) {
+	client, err := s.repo.FindById(context.Background(), id)
 	if err != nil {
 		return nil, err
 	}
-	return mapper.ClientToClientDto(clientModel), nil
+	return mapper.ApplicationsToApplicationDtos(client.ExchangeAudiences), nil
+}
+
+// applyClientRequest sets the settings of the client from the request and
+// validates them. The client is only enabled or disabled if the request says so.
+func applyClientRequest(client *models.Client, request *models.ClientRequest) error {
+	client.ClientName = request.ClientName
+	client.ClientType = request.ClientType
+	if request.Enabled != nil {
+		client.Disabled = !*request.Enabled
+	}
+	client.FirstParty = request.FirstParty
+	client.RedirectURIs = request.RedirectURIs
+	client.PostLogoutRedirectURIs = request.PostLogoutRedirectURIs
+	client.BackchannelLogoutURI = request.BackchannelLogoutURI
+	client.FrontchannelLogoutURI = request.FrontchannelLogoutURI
+	client.LogoutSessionRequired = request.LogoutSessionRequired
+	client.AllowedOrigins = request.AllowedOrigins
+	client.GrantTypes = request.GrantTypes
+	client.ResponseTypes = request.ResponseTypes
+	client.Scope = request.Scope
+	client.Contacts = request.Contacts
+	client.ClientURI = request.ClientURI
+	client.LogoURI = request.LogoURI
+	client.AccessTokenLifetime = request.AccessTokenLifetime
+	client.RefreshTokenLifetime = request.RefreshTokenLifetime
+	client.TokenEndpointAuthMethod = request.TokenEndpointAuthMethod
+	client.JwksURI = request.JwksURI
+	client.Jwks = request.Jwks
+	client.TlsClientAuthSubjectDN = request.TlsClientAuthSubjectDN
+	client.TlsClientAuthSanDNS = request.TlsClientAuthSanDNS
+	client.TlsClientAuthSanURI = request.TlsClientAuthSanURI
+	client.TlsClientAuthSanIP = request.TlsClientAuthSanIP
+	client.TlsClientAuthSanEmail = request.TlsClientAuthSanEmail
+	client.CertificateBoundTokens = request.CertificateBoundTokens
+
+	if client.ClientName == "" {
+		return fmt.Errorf("%w: client name cannot be blank", ErrInvalidClientMetadata)
+	}
+	if client.TokenEndpointAuthMethod == "" {
+		client.TokenEndpointAuthMethod = models.CLIENT_AUTH_NONE
+	}
+	if client.ClientType == "" {
+		client.ClientType = defaultClientType(client.TokenEndpointAuthMethod)
+	}
+	return validateClientMetadata(client)
+}
+
+// defaultClientType returns the type of clients using the authentication
+// method: clients that do not authenticate are public.
+func defaultClientType(authMethod string) string {
+	if authMethod == models.CLIENT_AUTH_NONE {
+		return models.CLIENT_TYPE_PUBLIC
+	}
+	return models.CLIENT_TYPE_CONFIDENTIAL
+}
+
+// validateClientMetadata checks that the metadata of a client is consistent, as
+// described in RFC 7591, section 2, and that the client registered the
+// credentials its authentication method requires.
+func validateClientMetadata(client *models.Client) error {
+	switch client.ClientType {
+	case models.CLIENT_TYPE_PUBLIC:
+		if client.TokenEndpointAuthMethod != models.CLIENT_AUTH_NONE {
+			return fmt.Errorf("%w: public clients cannot authenticate", ErrInvalidClientMetadata)
+		}
+		if client.GrantTypes.Contains(models.GRANT_TYPE_CLIENT_CREDENTIALS) {
+			return fmt.Errorf("%w: public clients cannot use the client_credentials grant type", ErrInvalidClientMetadata)
+		}
+	case models.CLIENT_TYPE_CONFIDENTIAL:
+		if client.TokenEndpointAuthMethod == models.CLIENT_AUTH_NONE {
+			return fmt.Errorf("%w: confidential clients must authenticate", ErrInvalidClientMetadata)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported client type %q", ErrInvalidClientMetadata, client.ClientType)
+	}
+	for _, uri := range client.RedirectURIs {
+		if err := validateRedirectURI(uri); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidRedirectURI, err)
+		}
+	}
+	for _, uri := range client.PostLogoutRedirectURIs {
+		if err := validateRedirectURI(uri); err != nil {
+			return fmt.Errorf("%w: invalid post-logout redirect URI: %v", ErrInvalidClientMetadata, err)
+		}
+	}
+	for _, origin := range client.AllowedOrigins {
+		if err := validateOrigin(origin); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidClientMetadata, err)
+		}
+	}
+	if client.AccessTokenLifetime < 0 || client.RefreshTokenLifetime < 0 {
+		return fmt.Errorf("%w: token lifetimes cannot be negative", ErrInvalidClientMetadata)
+	}
+	if len(client.GrantTypes) == 0 {
+		return fmt.Errorf("%w: at least one grant type is required", ErrInvalidClientMetadata)
+	}
+	for _, grantType := range client.GrantTypes {
+		if !supportedGrantTypes.Contains(grantType) {
+			return fmt.Errorf("%w: unsupported grant type %q", ErrInvalidClientMetadata, grantType)
+		}
+	}
+	for _, responseType := range client.ResponseTypes {
+		if responseType != models.RESPONSE_TYPE_CODE {
+			return fmt.Errorf("%w: unsupported response type %q", ErrInvalidClientMetadata, responseType)
+		}
+	}
+	authorizationCode := client.GrantTypes.Contains(models.GRANT_TYPE_AUTHORIZATION_CODE)
+	if authorizationCode != client.ResponseTypes.Contains(models.RESPONSE_TYPE_CODE) {
+		return fmt.Errorf("%w: the authorization_code grant type requires the code response type, and vice versa", ErrInvalidClientMetadata)
+	}
+	if authorizationCode && len(client.RedirectURIs) == 0 {
+		return fmt.Errorf("%w: the authorization_code grant type requires redirect_uris", ErrInvalidRedirectURI)
+	}
+	if !isWebURL(client.ClientURI) {
+		return fmt.Errorf("%w: client_uri must be an absolute HTTP(S) URL", ErrInvalidClientMetadata)
+	}
+	if !isWebURL(client.LogoURI) {
+		return fmt.Errorf("%w: logo_uri must be an absolute HTTP(S) URL", ErrInvalidClientMetadata)
+	}
+	if !isLogoutURL(client.BackchannelLogoutURI) {
+		return fmt.Errorf("%w: backchannel_logout_uri must be an absolute HTTP(S) URL without a fragment", ErrInvalidClientMetadata)
+	}
+	if !isLogoutURL(client.FrontchannelLogoutURI) {
+		return fmt.Errorf("%w: frontchannel_logout_uri must be an absolute HTTP(S) URL without a fragment", ErrInvalidClientMetadata)
+	}
+	if err := validateClientAuthentication(client); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidClientMetadata, err)
+	}
+	return nil
+}
+
+// validateRedirectURI checks that a redirect URI is absolute and has no
+// fragment. Plain HTTP is only allowed for loopback hosts, while private-use
+// schemes are allowed for native applications.
+func validateRedirectURI(value string) error {
+	uri, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if !uri.IsAbs() {
+		return fmt.Errorf("%s is not an absolute URI", value)
+	}
+	if uri.Fragment != "" {
+		return fmt.Errorf("%s must not have a fragment", value)
+	}
+	if uri.Scheme == "http" {
+		host := uri.Hostname()
+		if host != "localhost" && host != "127.0.0.1" && host != "::1" {
+			return fmt.Errorf("%s must use https", value)
+		}
+	}
+	return nil
+}
+
+// validateOrigin checks that an allowed CORS origin is a bare scheme, host
+// and optional port, as sent by browsers in the Origin header.
+func validateOrigin(value string) error {
+	uri, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if (uri.Scheme != "https" && uri.Scheme != "http") || uri.Host == "" ||
+		uri.Path != "" || uri.RawQuery != "" || uri.Fragment != "" || uri.User != nil {
+		return fmt.Errorf("%s is not a valid origin", value)
+	}
+	return nil
+}
+
+// isWebURL returns true if value is blank or an absolute HTTP(S) URL.
+func isWebURL(value string) bool {
+	if value == "" {
+		return true
+	}
+	uri, err := url.Parse(value)
+	return err == nil && (uri.Scheme == "https" || uri.Scheme == "http") && uri.Host != ""
+}
+
+// isLogoutURL returns true if value is blank or an absolute HTTP(S) URL
+// without a fragment, as required of front- and back-channel logout URIs.
+func isLogoutURL(value string) bool {
+	if value == "" {
+		return true
+	}
+	uri, err := url.Parse(value)
+	return err == nil && isWebURL(value) && uri.Fragment == ""
+}
+
+// validateClientAuthentication checks that clients registered the credentials
+// their authentication method requires: public keys, either inline or as a
+// JWKS URI, for private_key_jwt and self_signed_tls_client_auth, and exactly
+// one expected certificate subject for tls_client_auth. Client secrets are
+// generated by the server, so nothing needs to be registered for them.
+func validateClientAuthentication(client *models.Client) error {
+	switch client.TokenEndpointAuthMethod {
+	case models.CLIENT_AUTH_NONE, models.CLIENT_AUTH_CLIENT_SECRET_BASIC, models.CLIENT_AUTH_CLIENT_SECRET_POST:
+		return nil
+	case models.CLIENT_AUTH_TLS_CLIENT_AUTH:
+		subjects := 0
+		for _, subject := range []string{
+			client.TlsClientAuthSubjectDN, client.TlsClientAuthSanDNS, client.TlsClientAuthSanURI,
+			client.TlsClientAuthSanIP, client.TlsClientAuthSanEmail,
+		} {
+			if subject != "" {
+				subjects++
+			}
+		}
+		if subjects != 1 {
+			return errors.New("tls_client_auth clients must register exactly one certificate subject")
+		}
+		return nil
+	case models.CLIENT_AUTH_PRIVATE_KEY_JWT, models.CLIENT_AUTH_SELF_SIGNED_TLS_CLIENT_AUTH:
+		if client.JwksURI != "" && client.Jwks != nil && len(client.Jwks.Keys) > 0 {
+			return errors.New("jwks and jwks_uri cannot both be set")
+		}
+		if client.JwksURI != "" {
+			uri, err := url.Parse(client.JwksURI)
+			if err != nil {
+				return err
+			}
+			if uri.Scheme != "https" && uri.Scheme != "http" && uri.Scheme != "file" {
+				return errors.New("unsupported jwks_uri scheme")
+			}
+			return nil
+		}
+		if client.Jwks == nil || len(client.Jwks.Keys) == 0 {
+			return errors.New("clients authenticating with their keys must register jwks or a jwks_uri")
+		}
+		for _, key := range client.Jwks.Keys {
+			if _, err := key.PublicKey(); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return errors.New("unsupported token_endpoint_auth_method")
+	}
 }
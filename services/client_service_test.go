@@ -0,0 +1,69 @@
+package services
+
+import (
+	"auth-server/models"
+	"errors"
+	"testing"
+)
+
+func TestApplyClientRequest(t *testing.T) {
+	enabled, disabled := true, false
+	tests := []struct {
+		name         string
+		disabled     bool
+		request      func(*models.ClientRequest)
+		wantDisabled bool
+		wantErr      bool
+	}{
+		{"new client", false, nil, false, false},
+		{"enabled left unset keeps a disabled client disabled", true, nil, true, false},
+		{"enabled left unset keeps an enabled client enabled", false, nil, false, false},
+		{"disabling a client", false, func(r *models.ClientRequest) { r.Enabled = &disabled }, true, false},
+		{"enabling a client", true, func(r *models.ClientRequest) { r.Enabled = &enabled }, false, false},
+		{"token lifetimes", false, func(r *models.ClientRequest) {
+			r.AccessTokenLifetime = 300
+			r.RefreshTokenLifetime = 3600
+		}, false, false},
+		{"negative token lifetime", false, func(r *models.ClientRequest) { r.AccessTokenLifetime = -1 }, false, true},
+		{"no grant type", false, func(r *models.ClientRequest) { r.GrantTypes = nil }, false, true},
+		{"unsupported grant type", false, func(r *models.ClientRequest) {
+			r.GrantTypes = models.StringList{"implicit"}
+		}, false, true},
+		{"public client using client credentials", false, func(r *models.ClientRequest) {
+			r.TokenEndpointAuthMethod = models.CLIENT_AUTH_NONE
+		}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &models.Client{Disabled: tt.disabled}
+			request := &models.ClientRequest{
+				ClientName:              "backend",
+				GrantTypes:              models.StringList{models.GRANT_TYPE_CLIENT_CREDENTIALS},
+				TokenEndpointAuthMethod: models.CLIENT_AUTH_CLIENT_SECRET_BASIC,
+			}
+			if tt.request != nil {
+				tt.request(request)
+			}
+
+			err := applyClientRequest(client, request)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidClientMetadata) {
+					t.Fatalf("error = %v, want ErrInvalidClientMetadata", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if client.Disabled != tt.wantDisabled {
+				t.Errorf("disabled = %t, want %t", client.Disabled, tt.wantDisabled)
+			}
+			if client.AccessTokenLifetime != request.AccessTokenLifetime || client.RefreshTokenLifetime != request.RefreshTokenLifetime {
+				t.Errorf("lifetimes = %d, %d", client.AccessTokenLifetime, client.RefreshTokenLifetime)
+			}
+			if client.ClientType != models.CLIENT_TYPE_CONFIDENTIAL {
+				t.Errorf("client type = %s", client.ClientType)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"auth-server/cache"
+	"auth-server/models"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrInvalidConsentChallenge is returned when the answer to a consent prompt
+// does not carry the challenge issued with the prompt, or carries one that
+// expired or was already used.
+var ErrInvalidConsentChallenge = errors.New("invalid consent challenge")
+
+const (
+	// consentChallengeLifetime is how long users have to answer a consent prompt.
+	consentChallengeLifetime = 10 * time.Minute
+	// consentChallengeIdLength is the length of the random id of a challenge.
+	consentChallengeIdLength = 16
+)
+
+type ConsentChallengeService struct {
+	replayCache *cache.ReplayCache
+	secret      []byte
+}
+
+// NewConsentChallengeService creates a new instance of ConsentChallengeService.
+// Challenges are signed with secret, so that any instance sharing it can check
+// them, and the ids of the challenges answered are remembered in replayCache.
+func NewConsentChallengeService(replayCache *cache.ReplayCache, secret []byte) *ConsentChallengeService {
+	return &ConsentChallengeService{
+		replayCache: replayCache,
+		secret:      secret,
+	}
+}
+
+// Issue returns the challenge sent with the consent prompt shown to the user
+// of the session, for the client's authorization request. The answer to the
+// prompt must carry it back.
+func (s *ConsentChallengeService) Issue(session *models.Session, client *models.Client, request *models.AuthorizeRequest) (string, error) {
+	challenge := make([]byte, consentChallengeIdLength+8)
+	_, err := rand.Read(challenge[:consentChallengeIdLength])
+	if err != nil {
+		return "", err
+	}
+	binary.BigEndian.PutUint64(challenge[consentChallengeIdLength:], uint64(time.Now().Unix()))
+	mac, err := s.challengeMac(challenge, session, client, request)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(append(challenge, mac...)), nil
+}
+
+// Redeem checks that the challenge was issued for the same session, client
+// and authorization request, less than consentChallengeLifetime ago, and that
+// it was not redeemed before.
+func (s *ConsentChallengeService) Redeem(challenge string, session *models.Session, client *models.Client, request *models.AuthorizeRequest) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(challenge)
+	if err != nil || len(decoded) != consentChallengeIdLength+8+sha256.Size {
+		return ErrInvalidConsentChallenge
+	}
+	signed := decoded[:consentChallengeIdLength+8]
+	mac, err := s.challengeMac(signed, session, client, request)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(decoded[consentChallengeIdLength+8:], mac) {
+		return ErrInvalidConsentChallenge
+	}
+	issued := time.Unix(int64(binary.BigEndian.Uint64(signed[consentChallengeIdLength:])), 0)
+	expiry := issued.Add(consentChallengeLifetime)
+	if time.Now().After(expiry) {
+		return ErrInvalidConsentChallenge
+	}
+	id := base64.RawURLEncoding.EncodeToString(signed[:consentChallengeIdLength])
+	if !s.replayCache.Use(id, expiry) {
+		return ErrInvalidConsentChallenge
+	}
+	return nil
+}
+
+// challengeMac signs the id and issue time of a challenge along with what it
+// is bound to.
+func (s *ConsentChallengeService) challengeMac(challenge []byte, session *models.Session, client *models.Client, request *models.AuthorizeRequest) ([]byte, error) {
+	encodedRequest, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte("consent-challenge:"))
+	mac.Write(challenge)
+	mac.Write([]byte(session.ID.String()))
+	mac.Write([]byte(client.ID.String()))
+	mac.Write(encodedRequest)
+	return mac.Sum(nil), nil
+}
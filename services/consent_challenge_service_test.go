@@ -0,0 +1,86 @@
+package services
+
+import (
+	"auth-server/cache"
+	"auth-server/models"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestConsentChallengeService(t *testing.T) {
+	service := NewConsentChallengeService(cache.NewReplayCache(), []byte("test-secret"))
+	session := &models.Session{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}}
+	client := &models.Client{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}}
+	request := &models.AuthorizeRequest{ResponseType: "code", ClientId: "client", Scope: "openid profile", State: "state"}
+
+	// issuedAt crafts a challenge issued at the given time, as Issue would have.
+	issuedAt := func(at time.Time) string {
+		challenge := make([]byte, consentChallengeIdLength+8)
+		binary.BigEndian.PutUint64(challenge[consentChallengeIdLength:], uint64(at.Unix()))
+		mac, err := service.challengeMac(challenge, session, client, request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(append(challenge, mac...))
+	}
+	issue := func() string {
+		challenge, err := service.Issue(session, client, request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return challenge
+	}
+	tamper := func(challenge string) string {
+		decoded, err := base64.RawURLEncoding.DecodeString(challenge)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded[len(decoded)-1] ^= 1
+		return base64.RawURLEncoding.EncodeToString(decoded)
+	}
+	otherRequest := *request
+	otherRequest.Scope = "openid profile email"
+
+	tests := []struct {
+		name      string
+		challenge string
+		session   *models.Session
+		client    *models.Client
+		request   *models.AuthorizeRequest
+		valid     bool
+	}{
+		{"issued for the request", issue(), session, client, request, true},
+		{"issued nine minutes ago", issuedAt(time.Now().Add(-9 * time.Minute)), session, client, request, true},
+		{"missing", "", session, client, request, false},
+		{"garbage", "not a challenge", session, client, request, false},
+		{"truncated", issue()[:20], session, client, request, false},
+		{"tampered", tamper(issue()), session, client, request, false},
+		{"expired", issuedAt(time.Now().Add(-11 * time.Minute)), session, client, request, false},
+		{"other session", issue(), &models.Session{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}}, client, request, false},
+		{"other client", issue(), session, &models.Client{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}}, request, false},
+		{"other request", issue(), session, client, &otherRequest, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := service.Redeem(tt.challenge, tt.session, tt.client, tt.request)
+			if !tt.valid {
+				if !errors.Is(err, ErrInvalidConsentChallenge) {
+					t.Fatalf("error = %v, want ErrInvalidConsentChallenge", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			err = service.Redeem(tt.challenge, tt.session, tt.client, tt.request)
+			if !errors.Is(err, ErrInvalidConsentChallenge) {
+				t.Fatalf("second redeem error = %v, want ErrInvalidConsentChallenge", err)
+			}
+		})
+	}
+}
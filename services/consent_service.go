@@ -0,0 +1,77 @@
+package services
+
+import (
+	"auth-server/mapper"
+	"auth-server/models"
+	"auth-server/repository"
+	"context"
+	"errors"
+)
+
+// ErrConsentNotFound is returned when a user revokes a consent they never gave.
+var ErrConsentNotFound = errors.New("consent not found")
+
+type ConsentService struct {
+	repo *repository.ConsentRepository
+}
+
+// NewConsentService creates a new instance of ConsentService with the provided ConsentRepository.
+func NewConsentService(repo *repository.ConsentRepository) *ConsentService {
+	return &ConsentService{repo: repo}
+}
+
+// ConsentPrompt returns whether the user must be asked to consent before the
+// client accesses the scopes on their behalf, along with the scopes they have
+// not consented to yet. First-party clients never need consent. Otherwise the
+// user is asked when they never consented to the client, when some scopes are
+// new, or always if force is set.
+func (s *ConsentService) ConsentPrompt(user *models.User, client *models.Client, scopes []string, force bool) (bool, []string, error) {
+	if client.FirstParty {
+		return false, nil, nil
+	}
+	consent, err := s.repo.FindByUserAndClient(context.Background(), user.ID.String(), client.ID.String())
+	if err != nil {
+		return false, nil, err
+	}
+	if consent == nil {
+		return true, scopes, nil
+	}
+	newScopes := consent.MissingScopes(scopes)
+	return force || len(newScopes) > 0, newScopes, nil
+}
+
+// Grant records that the user consented to the client accessing the scopes,
+// in addition to the ones they consented to before.
+func (s *ConsentService) Grant(user *models.User, client *models.Client, scopes []string) error {
+	ctx := context.Background()
+	consent, err := s.repo.FindByUserAndClient(ctx, user.ID.String(), client.ID.String())
+	if err != nil {
+		return err
+	}
+	if consent == nil {
+		consent = models.NewConsent(user.ID, client.ID)
+	}
+	consent.Grant(scopes)
+	_, err = s.repo.Save(ctx, consent)
+	return err
+}
+
+// GetConsents returns the consents the user gave.
+func (s *ConsentService) GetConsents(user *models.User) ([]*models.ConsentDto, error) {
+	consents, err := s.repo.FindByUserId(context.Background(), user.ID.String())
+	if err != nil {
+		return nil, err
+	}
+	return mapper.ConsentsToConsentDtos(consents), nil
+}
+
+// RevokeConsent deletes one of the user's consents. The refresh tokens the
+// client was issued on behalf of the user are revoked along with it, and the
+// user will be asked to consent again the next time the client needs access.
+func (s *ConsentService) RevokeConsent(user *models.User, consentId string) error {
+	consent, err := s.repo.FindById(context.Background(), consentId)
+	if err != nil || consent.UserID != user.ID {
+		return ErrConsentNotFound
+	}
+	return s.repo.Delete(context.Background(), consent.ID.String())
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"auth-server/hasher"
+	"auth-server/models"
+	"auth-server/repository"
+	"context"
+	"errors"
+)
+
+// ErrInvalidCredentials is returned when a username and password do not
+// match.
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// CredentialVerifier checks the username and password a user logs in with,
+// and returns the user they belong to. It returns ErrInvalidCredentials when
+// they do not match; other errors mean the credentials could not be checked.
+// The check is traced as part of the trace carried by ctx.
+type CredentialVerifier interface {
+	VerifyCredentials(ctx context.Context, username string, password string) (*models.User, error)
+}
+
+// LocalCredentialVerifier checks passwords against the hashes stored with
+// users.
+type LocalCredentialVerifier struct {
+	users  userStore
+	hasher hasher.Hasher
+}
+
+// NewLocalCredentialVerifier creates a new instance of LocalCredentialVerifier.
+func NewLocalCredentialVerifier(users *repository.UserRepository, hasher hasher.Hasher) *LocalCredentialVerifier {
+	return &LocalCredentialVerifier{users: users, hasher: hasher}
+}
+
+func (v *LocalCredentialVerifier) VerifyCredentials(ctx context.Context, username string, password string) (*models.User, error) {
+	ctx, span := startSpan(ctx, "LocalCredentialVerifier.VerifyCredentials")
+	defer span.End()
+	user, err := v.users.FindByUsername(ctx, username)
+	if err != nil {
+		return nil, failSpan(span, err)
+	}
+	if user == nil || compareHashAndPassword(ctx, v.hasher, user.Password, password) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// ChainCredentialVerifier tries its verifiers in turn, and returns the user
+// of the first one the credentials match. When none does, the first error
+// other than ErrInvalidCredentials is returned, if any, so that an
+// unavailable directory is not reported as a wrong password.
+type ChainCredentialVerifier []CredentialVerifier
+
+func (c ChainCredentialVerifier) VerifyCredentials(ctx context.Context, username string, password string) (*models.User, error) {
+	var failure error
+	for _, verifier := range c {
+		user, err := verifier.VerifyCredentials(ctx, username, password)
+		if err == nil {
+			return user, nil
+		}
+		if failure == nil && !errors.Is(err, ErrInvalidCredentials) {
+			failure = err
+		}
+	}
+	if failure != nil {
+		return nil, failure
+	}
+	return nil, ErrInvalidCredentials
+}
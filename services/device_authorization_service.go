@@ -0,0 +1,129 @@
+package services
+
+import (
+	"auth-server/models"
+	"auth-server/repository"
+	"context"
+	"errors"
+	"time"
+)
+
+// Errors returned while polling for a device authorization, named after the
+// error codes of RFC 8628, section 3.5.
+var (
+	ErrAuthorizationPending = errors.New("the authorization request is still pending")
+	ErrSlowDown             = errors.New("polling too frequently")
+	ErrAccessDenied         = errors.New("the authorization request was denied")
+	ErrExpiredToken         = errors.New("the device code has expired")
+	ErrInvalidDeviceCode    = errors.New("invalid device code")
+)
+
+// slowDownIncrement is added to the polling interval of a device that polls
+// too frequently, as required by RFC 8628, section 3.5.
+const slowDownIncrement = 5
+
+type DeviceAuthorizationService struct {
+	repo *repository.DeviceCodeRepository
+}
+
+// NewDeviceAuthorizationService creates a new instance of DeviceAuthorizationService with the provided DeviceCodeRepository.
+func NewDeviceAuthorizationService(repo *repository.DeviceCodeRepository) *DeviceAuthorizationService {
+	return &DeviceAuthorizationService{repo: repo}
+}
+
+// CreateDeviceCode starts a device authorization request of the client to
+// access the application. It returns the request along with its device code,
+// which is not stored in clear.
+func (s *DeviceAuthorizationService) CreateDeviceCode(client *models.Client, app *models.Application, scope string, lifetime time.Duration, interval int) (*models.DeviceCode, string, error) {
+	err := s.repo.DeleteExpired(context.Background(), time.Now())
+	if err != nil {
+		return nil, "", err
+	}
+	deviceCode, code, err := models.NewDeviceCode(client.ID, app.ID, scope, lifetime, interval)
+	if err != nil {
+		return nil, "", err
+	}
+	deviceCode, err = s.repo.Save(context.Background(), deviceCode)
+	if err != nil {
+		return nil, "", err
+	}
+	return deviceCode, code, nil
+}
+
+// GetPendingByUserCode returns the pending, unexpired device authorization
+// request with the given user code, or nil if there is none.
+func (s *DeviceAuthorizationService) GetPendingByUserCode(userCode string) (*models.DeviceCode, error) {
+	deviceCode, err := s.repo.FindByUserCode(context.Background(), userCode)
+	if err != nil {
+		return nil, err
+	}
+	if deviceCode == nil || deviceCode.IsExpired() || deviceCode.Status != models.DEVICE_CODE_PENDING {
+		return nil, nil
+	}
+	return deviceCode, nil
+}
+
+// Approve records that the user approved the device authorization request.
+func (s *DeviceAuthorizationService) Approve(deviceCode *models.DeviceCode, user *models.User) (*models.DeviceCode, error) {
+	deviceCode.Status = models.DEVICE_CODE_APPROVED
+	deviceCode.UserID = &user.ID
+	return s.repo.Save(context.Background(), deviceCode)
+}
+
+// Deny records that the user denied the device authorization request.
+func (s *DeviceAuthorizationService) Deny(deviceCode *models.DeviceCode, user *models.User) (*models.DeviceCode, error) {
+	deviceCode.Status = models.DEVICE_CODE_DENIED
+	deviceCode.UserID = &user.ID
+	return s.repo.Save(context.Background(), deviceCode)
+}
+
+// Poll checks the state of the device authorization request with the given
+// device code on behalf of the client. Once the request was approved, it is
+// returned and consumed, so that a single token is issued for it.
+func (s *DeviceAuthorizationService) Poll(code string, clientId string) (*models.DeviceCode, error) {
+	ctx := context.Background()
+	deviceCode, err := s.repo.FindByDeviceCode(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if deviceCode == nil || deviceCode.ClientID.String() != clientId {
+		return nil, ErrInvalidDeviceCode
+	}
+	if deviceCode.IsExpired() {
+		return nil, ErrExpiredToken
+	}
+
+	switch deviceCode.Status {
+	case models.DEVICE_CODE_APPROVED:
+		consumed, err := s.repo.Consume(ctx, deviceCode.ID.String())
+		if err != nil {
+			return nil, err
+		}
+		if !consumed {
+			return nil, ErrInvalidDeviceCode
+		}
+		return deviceCode, nil
+	case models.DEVICE_CODE_DENIED:
+		err = s.repo.Delete(ctx, deviceCode.ID.String())
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrAccessDenied
+	}
+
+	now := time.Now()
+	tooSoon := deviceCode.LastPolledAt != nil &&
+		now.Sub(*deviceCode.LastPolledAt) < time.Duration(deviceCode.Interval)*time.Second
+	deviceCode.LastPolledAt = &now
+	if tooSoon {
+		deviceCode.Interval += slowDownIncrement
+	}
+	_, err = s.repo.Save(ctx, deviceCode)
+	if err != nil {
+		return nil, err
+	}
+	if tooSoon {
+		return nil, ErrSlowDown
+	}
+	return nil, ErrAuthorizationPending
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"auth-server/cache"
+	"auth-server/models"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DPOP_PROOF_TYPE is the typ header of DPoP proofs, defined by RFC 9449, section 4.2.
+const DPOP_PROOF_TYPE = "dpop+jwt"
+
+var (
+	// ErrInvalidDPoPProof is returned when a DPoP proof is malformed, badly
+	// signed, or does not match the request it was sent with.
+	ErrInvalidDPoPProof = errors.New("invalid DPoP proof")
+	// ErrUseDPoPNonce is returned when a DPoP proof lacks a valid server nonce.
+	ErrUseDPoPNonce = errors.New("a valid DPoP nonce is required")
+)
+
+const (
+	// dpopProofLifetime is how long after its iat a DPoP proof is accepted.
+	dpopProofLifetime = 5 * time.Minute
+	// dpopLeeway is the clock skew tolerated when checking the iat of a proof.
+	dpopLeeway = time.Minute
+	// dpopNonceLifetime is how long a nonce issued by the server is accepted.
+	dpopNonceLifetime = 5 * time.Minute
+)
+
+type DPoPService struct {
+	replayCache  *cache.ReplayCache
+	secret       []byte
+	requireNonce bool
+}
+
+// NewDPoPService creates a new instance of DPoPService. Proof ids are remembered
+// in replayCache. Nonces are signed with secret, so that any instance sharing it
+// can check them, and are only required in proofs if requireNonce is set.
+func NewDPoPService(replayCache *cache.ReplayCache, secret []byte, requireNonce bool) *DPoPService {
+	return &DPoPService{
+		replayCache:  replayCache,
+		secret:       secret,
+		requireNonce: requireNonce,
+	}
+}
+
+// VerifyProof checks a DPoP proof sent with a request to uri using method, as
+// described in RFC 9449, section 4.3, and returns the thumbprint of the key it
+// was signed with. When the proof is sent with an access token, accessToken must
+// be set and the proof must carry its hash.
+func (s *DPoPService) VerifyProof(proof string, method string, uri string, accessToken string) (string, error) {
+	token, err := models.ParseSignedToken(proof)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidDPoPProof, err)
+	}
+	if token.HeaderString("typ") != DPOP_PROOF_TYPE {
+		return "", fmt.Errorf("%w: typ must be %s", ErrInvalidDPoPProof, DPOP_PROOF_TYPE)
+	}
+	key, err := token.HeaderKey()
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidDPoPProof, err)
+	}
+	publicKey, err := key.PublicKey()
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidDPoPProof, err)
+	}
+	if err := token.Verify(publicKey); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidDPoPProof, err)
+	}
+	thumbprint, err := key.Thumbprint()
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidDPoPProof, err)
+	}
+
+	jti := token.ClaimString("jti")
+	if jti == "" {
+		return "", fmt.Errorf("%w: missing jti", ErrInvalidDPoPProof)
+	}
+	if token.ClaimString("htm") != method {
+		return "", fmt.Errorf("%w: htm does not match the request method", ErrInvalidDPoPProof)
+	}
+	if !equalTargetURIs(token.ClaimString("htu"), uri) {
+		return "", fmt.Errorf("%w: htu does not match the request URI", ErrInvalidDPoPProof)
+	}
+	iat, ok := token.ClaimTime("iat")
+	if !ok {
+		return "", fmt.Errorf("%w: missing iat", ErrInvalidDPoPProof)
+	}
+	issuedAt := time.Unix(iat, 0)
+	now := time.Now()
+	if issuedAt.After(now.Add(dpopLeeway)) || now.After(issuedAt.Add(dpopProofLifetime)) {
+		return "", fmt.Errorf("%w: the proof is not recent", ErrInvalidDPoPProof)
+	}
+	if accessToken != "" && token.ClaimString("ath") != models.AccessTokenHash(accessToken) {
+		return "", fmt.Errorf("%w: ath does not match the access token", ErrInvalidDPoPProof)
+	}
+	nonce := token.ClaimString("nonce")
+	if (s.requireNonce || nonce != "") && !s.validNonce(nonce) {
+		return "", ErrUseDPoPNonce
+	}
+
+	if !s.replayCache.Use(thumbprint+":"+jti, issuedAt.Add(dpopProofLifetime+dpopLeeway)) {
+		return "", fmt.Errorf("%w: the proof was already used", ErrInvalidDPoPProof)
+	}
+	return thumbprint, nil
+}
+
+// RequiresNonce returns true if proofs must carry a nonce issued by the server.
+func (s *DPoPService) RequiresNonce() bool {
+	return s.requireNonce
+}
+
+// NewNonce returns a nonce clients can include in their next proofs. Nonces
+// carry the time they were issued at, signed with the service's secret.
+func (s *DPoPService) NewNonce() string {
+	issuedAt := make([]byte, 8)
+	binary.BigEndian.PutUint64(issuedAt, uint64(time.Now().Unix()))
+	return base64.RawURLEncoding.EncodeToString(append(issuedAt, s.nonceMac(issuedAt)...))
+}
+
+func (s *DPoPService) validNonce(nonce string) bool {
+	decoded, err := base64.RawURLEncoding.DecodeString(nonce)
+	if err != nil || len(decoded) != 8+sha256.Size {
+		return false
+	}
+	issuedAt := decoded[:8]
+	if !hmac.Equal(decoded[8:], s.nonceMac(issuedAt)) {
+		return false
+	}
+	issued := time.Unix(int64(binary.BigEndian.Uint64(issuedAt)), 0)
+	return time.Since(issued) < dpopNonceLifetime && issued.Before(time.Now().Add(dpopLeeway))
+}
+
+func (s *DPoPService) nonceMac(issuedAt []byte) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte("dpop-nonce:"))
+	mac.Write(issuedAt)
+	return mac.Sum(nil)
+}
+
+// equalTargetURIs compares the htu claim of a proof with the request URI,
+// ignoring the query and fragment as required by RFC 9449, section 4.3.
+func equalTargetURIs(htu string, uri string) bool {
+	a, err := url.Parse(htu)
+	if err != nil {
+		return false
+	}
+	b, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(a.Scheme, b.Scheme) &&
+		strings.EqualFold(a.Host, b.Host) &&
+		strings.TrimSuffix(a.Path, "/") == strings.TrimSuffix(b.Path, "/")
+}
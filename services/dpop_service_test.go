@@ -0,0 +1,164 @@
+package services
+
+import (
+	"auth-server/cache"
+	"auth-server/models"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+const dpopTestURI = "https://auth.example.com/oauth2/token"
+
+// newDPoPKey returns a P-256 key along with its public JWK.
+func newDPoPKey(t *testing.T) (*ecdsa.PrivateKey, map[string]string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coordinate := func(value []byte) string {
+		padded := make([]byte, 32)
+		copy(padded[32-len(value):], value)
+		return base64.RawURLEncoding.EncodeToString(padded)
+	}
+	return key, map[string]string{"kty": "EC", "crv": "P-256", "x": coordinate(key.X.Bytes()), "y": coordinate(key.Y.Bytes())}
+}
+
+// signDPoPProof returns the claims signed with the key as a DPoP proof
+// carrying the given header parameters.
+func signDPoPProof(t *testing.T, key *ecdsa.PrivateKey, header map[string]interface{}, claims map[string]interface{}) string {
+	t.Helper()
+	encode := func(value interface{}) string {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(encoded)
+	}
+	message := encode(header) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(message))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return message + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestVerifyDPoPProof(t *testing.T) {
+	key, jwk := newDPoPKey(t)
+	otherKey, _ := newDPoPKey(t)
+	thumbprint, err := (&models.JSONWebKey{Kty: "EC", Crv: jwk["crv"], X: jwk["x"], Y: jwk["y"]}).Thumbprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewDPoPService(cache.NewReplayCache(), []byte("test-secret"), false)
+	// expiredNonce crafts a nonce issued longer than dpopNonceLifetime ago.
+	expiredNonce := func() string {
+		issuedAt := make([]byte, 8)
+		binary.BigEndian.PutUint64(issuedAt, uint64(time.Now().Add(-dpopNonceLifetime-time.Second).Unix()))
+		return base64.RawURLEncoding.EncodeToString(append(issuedAt, service.nonceMac(issuedAt)...))
+	}
+
+	tests := []struct {
+		name         string
+		header       func(h map[string]interface{})
+		claims       func(c map[string]interface{})
+		key          *ecdsa.PrivateKey
+		method       string
+		accessToken  string
+		requireNonce bool
+		err          error
+	}{
+		{"valid proof", nil, nil, key, "POST", "", false, nil},
+		{"query of the request URI", nil, func(c map[string]interface{}) { c["htu"] = dpopTestURI + "?x=1" }, key, "POST", "", false, nil},
+		{"other method", nil, func(c map[string]interface{}) { c["htm"] = "GET" }, key, "POST", "", false, ErrInvalidDPoPProof},
+		{"other URI", nil, func(c map[string]interface{}) { c["htu"] = "https://auth.example.com/oauth2/introspect" }, key, "POST", "", false, ErrInvalidDPoPProof},
+		{"other host", nil, func(c map[string]interface{}) { c["htu"] = "https://evil.example.com/oauth2/token" }, key, "POST", "", false, ErrInvalidDPoPProof},
+		{"wrong typ", func(h map[string]interface{}) { h["typ"] = "JWT" }, nil, key, "POST", "", false, ErrInvalidDPoPProof},
+		{"private key in the header", func(h map[string]interface{}) {
+			h["jwk"] = map[string]string{"kty": "EC", "crv": "P-256", "x": jwk["x"], "y": jwk["y"], "d": "secret"}
+		}, nil, key, "POST", "", false, ErrInvalidDPoPProof},
+		{"signed with another key", nil, nil, otherKey, "POST", "", false, ErrInvalidDPoPProof},
+		{"missing jti", nil, func(c map[string]interface{}) { delete(c, "jti") }, key, "POST", "", false, ErrInvalidDPoPProof},
+		{"stale", nil, func(c map[string]interface{}) { c["iat"] = time.Now().Add(-6 * time.Minute).Unix() }, key, "POST", "", false, ErrInvalidDPoPProof},
+		{"issued in the future", nil, func(c map[string]interface{}) { c["iat"] = time.Now().Add(2 * time.Minute).Unix() }, key, "POST", "", false, ErrInvalidDPoPProof},
+		{"hash of the access token", nil, func(c map[string]interface{}) { c["ath"] = models.AccessTokenHash("token") }, key, "GET", "token", false, nil},
+		{"hash of another access token", nil, func(c map[string]interface{}) { c["ath"] = models.AccessTokenHash("other") }, key, "GET", "token", false, ErrInvalidDPoPProof},
+		{"missing access token hash", nil, nil, key, "GET", "token", false, ErrInvalidDPoPProof},
+		{"nonce required", nil, nil, key, "POST", "", true, ErrUseDPoPNonce},
+		{"nonce issued by the server", nil, func(c map[string]interface{}) { c["nonce"] = service.NewNonce() }, key, "POST", "", true, nil},
+		{"forged nonce", nil, func(c map[string]interface{}) { c["nonce"] = "forged" }, key, "POST", "", true, ErrUseDPoPNonce},
+		{"expired nonce", nil, func(c map[string]interface{}) { c["nonce"] = expiredNonce() }, key, "POST", "", true, ErrUseDPoPNonce},
+		{"invalid nonce when none is required", nil, func(c map[string]interface{}) { c["nonce"] = "forged" }, key, "POST", "", false, ErrUseDPoPNonce},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := map[string]interface{}{"typ": DPOP_PROOF_TYPE, "alg": "ES256", "jwk": jwk}
+			claims := map[string]interface{}{
+				"jti": fmt.Sprintf("proof-%d", i),
+				"htm": tt.method,
+				"htu": dpopTestURI,
+				"iat": time.Now().Unix(),
+			}
+			if tt.header != nil {
+				tt.header(header)
+			}
+			if tt.claims != nil {
+				tt.claims(claims)
+			}
+			proof := signDPoPProof(t, tt.key, header, claims)
+			service.requireNonce = tt.requireNonce
+
+			jkt, err := service.VerifyProof(proof, tt.method, dpopTestURI, tt.accessToken)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if jkt != thumbprint {
+				t.Errorf("thumbprint = %s, want %s", jkt, thumbprint)
+			}
+		})
+	}
+}
+
+func TestVerifyDPoPProofReplay(t *testing.T) {
+	key, jwk := newDPoPKey(t)
+	service := NewDPoPService(cache.NewReplayCache(), []byte("test-secret"), false)
+	header := map[string]interface{}{"typ": DPOP_PROOF_TYPE, "alg": "ES256", "jwk": jwk}
+	claims := map[string]interface{}{"jti": "proof", "htm": "POST", "htu": dpopTestURI, "iat": time.Now().Unix()}
+	proof := signDPoPProof(t, key, header, claims)
+
+	_, err := service.VerifyProof(proof, "POST", dpopTestURI, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = service.VerifyProof(proof, "POST", dpopTestURI, "")
+	if !errors.Is(err, ErrInvalidDPoPProof) {
+		t.Fatalf("replayed proof error = %v, want ErrInvalidDPoPProof", err)
+	}
+
+	// The jti of a proof is only unique to the key signing it.
+	otherKey, otherJwk := newDPoPKey(t)
+	header["jwk"] = otherJwk
+	_, err = service.VerifyProof(signDPoPProof(t, otherKey, header, claims), "POST", dpopTestURI, "")
+	if err != nil {
+		t.Fatalf("proof of another key with the same jti: %v", err)
+	}
+}
@@ -0,0 +1,319 @@
+package services
+
+import (
+	"auth-server/mapper"
+	"auth-server/models"
+	"auth-server/repository"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrFederatedLoginFailed is returned when a user cannot be logged in with
+// the response of an upstream identity provider.
+var ErrFederatedLoginFailed = errors.New("federated login failed")
+
+// ErrIdentityProviderNotFound is returned for unknown or disabled identity providers.
+var ErrIdentityProviderNotFound = errors.New("identity provider not found")
+
+// ErrExternalIdentityNotFound is returned when a user has no such external identity.
+var ErrExternalIdentityNotFound = errors.New("external identity not found")
+
+// maxUsernameAttempts bounds the suffixes tried to make the username of a
+// provisioned user unique.
+const maxUsernameAttempts = 10
+
+// federatedLoginStore is the part of FederatedLoginRepository that
+// FederationService uses.
+type federatedLoginStore interface {
+	FindByState(ctx context.Context, state string) (*models.FederatedLogin, error)
+	Save(ctx context.Context, entity interface{}) (*models.FederatedLogin, error)
+	Consume(ctx context.Context, id string) (bool, error)
+	DeleteExpired(ctx context.Context, before time.Time) error
+}
+
+// externalIdentityStore is the part of ExternalIdentityRepository that
+// FederationService uses.
+type externalIdentityStore interface {
+	FindById(ctx context.Context, id string) (*models.ExternalIdentity, error)
+	FindByProviderAndSubject(ctx context.Context, providerId string, subject string) (*models.ExternalIdentity, error)
+	FindByUserId(ctx context.Context, userId string) ([]*models.ExternalIdentity, error)
+	Save(ctx context.Context, entity interface{}) (*models.ExternalIdentity, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// userStore is the part of UserRepository that FederationService and the
+// credential verifiers use.
+type userStore interface {
+	FindById(ctx context.Context, id string) (*models.User, error)
+	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	FindByUsername(ctx context.Context, username string) (*models.User, error)
+	Save(ctx context.Context, entity interface{}) (*models.User, error)
+	AddRolesToUser(ctx context.Context, user *models.User, roles []*models.Role) error
+	RemoveRolesFromUser(ctx context.Context, user *models.User, roles []*models.Role) error
+}
+
+type FederationService struct {
+	providers  *repository.IdentityProviderRepository
+	identities externalIdentityStore
+	logins     federatedLoginStore
+	users      userStore
+}
+
+// NewFederationService creates a new instance of FederationService.
+func NewFederationService(providers *repository.IdentityProviderRepository, identities *repository.ExternalIdentityRepository, logins *repository.FederatedLoginRepository, users *repository.UserRepository) *FederationService {
+	return &FederationService{
+		providers:  providers,
+		identities: identities,
+		logins:     logins,
+		users:      users,
+	}
+}
+
+// GetProvider returns the enabled identity provider with the given id. LDAP
+// directories are not returned, as users do not log in at them.
+func (s *FederationService) GetProvider(id string) (*models.IdentityProvider, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrIdentityProviderNotFound
+	}
+	provider, err := s.providers.FindById(context.Background(), id)
+	if err != nil || provider.Disabled || provider.Type == models.IDENTITY_PROVIDER_TYPE_LDAP {
+		return nil, ErrIdentityProviderNotFound
+	}
+	return provider, nil
+}
+
+// GetProviders returns the identity providers users can log in with.
+func (s *FederationService) GetProviders() ([]*models.IdentityProvider, error) {
+	providers, err := s.providers.FindEnabled(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*models.IdentityProvider, 0)
+	for _, provider := range providers {
+		if provider.Type != models.IDENTITY_PROVIDER_TYPE_LDAP {
+			result = append(result, provider)
+		}
+	}
+	return result, nil
+}
+
+// GetDirectories returns the enabled LDAP directories, which check the
+// passwords of their users.
+func (s *FederationService) GetDirectories() ([]*models.IdentityProvider, error) {
+	return s.providers.FindEnabledByType(context.Background(), models.IDENTITY_PROVIDER_TYPE_LDAP)
+}
+
+// StartLogin starts a login at the identity provider, and returns it along
+// with the state identifying it. The login must be saved with SaveLogin once
+// the request to the provider is built.
+func (s *FederationService) StartLogin(provider *models.IdentityProvider, returnTo string, lifetime time.Duration) (*models.FederatedLogin, string, error) {
+	return models.NewFederatedLogin(provider, returnTo, lifetime)
+}
+
+// SaveLogin saves the login until the user comes back from the identity provider.
+func (s *FederationService) SaveLogin(login *models.FederatedLogin) error {
+	ctx := context.Background()
+	err := s.logins.DeleteExpired(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	_, err = s.logins.Save(ctx, login)
+	return err
+}
+
+// FinishLogin returns the login of the identity provider with the given
+// state, which can only be used once.
+func (s *FederationService) FinishLogin(provider *models.IdentityProvider, state string) (*models.FederatedLogin, error) {
+	ctx := context.Background()
+	if state == "" {
+		return nil, fmt.Errorf("%w: missing state", ErrFederatedLoginFailed)
+	}
+	login, err := s.logins.FindByState(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	if login == nil || login.IdentityProviderID != provider.ID {
+		return nil, fmt.Errorf("%w: unknown state", ErrFederatedLoginFailed)
+	}
+	consumed, err := s.logins.Consume(ctx, login.ID.String())
+	if err != nil {
+		return nil, err
+	}
+	if !consumed || login.IsExpired() {
+		return nil, fmt.Errorf("%w: the login has expired", ErrFederatedLoginFailed)
+	}
+	return login, nil
+}
+
+// ResolveUser returns the user the identity provider authenticated. Users
+// logging in with the provider for the first time are linked to the existing
+// user with the same verified email, if the provider allows it, or else
+// provisioned. The roles of the provider's role mappings are then granted or
+// revoked according to the user's claims.
+func (s *FederationService) ResolveUser(provider *models.IdentityProvider, profile *models.ExternalProfile) (*models.User, error) {
+	ctx := context.Background()
+	if profile.Subject == "" {
+		return nil, fmt.Errorf("%w: the identity provider did not assert a subject", ErrFederatedLoginFailed)
+	}
+	identity, err := s.identities.FindByProviderAndSubject(ctx, provider.ID.String(), profile.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	var user *models.User
+	if identity != nil && identity.User != nil {
+		// The provider belongs to the realm, and so should the users it
+		// identified, but the user is still looked up within the realm.
+		user, err = s.users.FindById(ctx, identity.UserID.String())
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return nil, fmt.Errorf("%w: the external identity belongs to a user of another realm", ErrFederatedLoginFailed)
+		}
+	} else {
+		if identity == nil {
+			identity = &models.ExternalIdentity{
+				BaseUUIDEntity: models.BaseUUIDEntity{
+					ID: uuid.New(),
+				},
+				IdentityProviderID: provider.ID,
+				Subject:            profile.Subject,
+			}
+		}
+		user, err = s.linkedUser(provider, profile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !user.Enabled || !user.AccountNonLocked || !user.AccountNonExpired {
+		return nil, fmt.Errorf("%w: user account is not active", ErrFederatedLoginFailed)
+	}
+
+	identity.UserID = user.ID
+	identity.Email = profile.Email
+	identity.LastLoginAt = time.Now()
+	_, err = s.identities.Save(ctx, identity)
+	if err != nil {
+		return nil, err
+	}
+	err = s.applyRoleMappings(provider, user, profile)
+	if err != nil {
+		return nil, err
+	}
+	return s.users.FindById(ctx, user.ID.String())
+}
+
+// linkedUser returns the existing user to link the new external identity to,
+// or provisions one.
+func (s *FederationService) linkedUser(provider *models.IdentityProvider, profile *models.ExternalProfile) (*models.User, error) {
+	ctx := context.Background()
+	if profile.Email == "" {
+		return nil, fmt.Errorf("%w: the identity provider did not assert an email", ErrFederatedLoginFailed)
+	}
+	existing, err := s.users.FindByEmail(ctx, profile.Email)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		if provider.LinkByEmail && profile.EmailVerified {
+			return existing, nil
+		}
+		return nil, fmt.Errorf("%w: the email belongs to another user", ErrFederatedLoginFailed)
+	}
+	return s.provisionUser(profile)
+}
+
+// provisionUser creates the user the profile describes. Provisioned users
+// have no password, so they can only log in through an identity provider.
+func (s *FederationService) provisionUser(profile *models.ExternalProfile) (*models.User, error) {
+	ctx := context.Background()
+	base := profile.Username
+	if base == "" {
+		base = strings.SplitN(profile.Email, "@", 2)[0]
+	}
+	username := base
+	for attempt := 1; ; attempt++ {
+		existing, err := s.users.FindByUsername(ctx, username)
+		if err != nil {
+			return nil, err
+		}
+		if existing == nil {
+			break
+		}
+		if attempt == maxUsernameAttempts {
+			return nil, fmt.Errorf("%w: could not find an available username", ErrFederatedLoginFailed)
+		}
+		username = fmt.Sprintf("%s-%d", base, attempt+1)
+	}
+	user := models.NewUser(&models.SignupRequest{
+		Username: username,
+		Email:    profile.Email,
+	})
+	return s.users.Save(ctx, user)
+}
+
+// applyRoleMappings grants the user the roles of the provider's role mappings
+// matching the profile, and revokes those of the other mappings. Roles that
+// no mapping refers to are left alone.
+func (s *FederationService) applyRoleMappings(provider *models.IdentityProvider, user *models.User, profile *models.ExternalProfile) error {
+	if len(provider.RoleMappings) == 0 {
+		return nil
+	}
+	granted := make(map[uuid.UUID]bool)
+	for _, mapping := range provider.RoleMappings {
+		if mapping.Matches(profile) {
+			granted[mapping.RoleID] = true
+		}
+	}
+	var grant, revoke []*models.Role
+	seen := make(map[uuid.UUID]bool)
+	for _, mapping := range provider.RoleMappings {
+		if mapping.Role == nil || seen[mapping.RoleID] {
+			continue
+		}
+		seen[mapping.RoleID] = true
+		if granted[mapping.RoleID] {
+			grant = append(grant, mapping.Role)
+		} else {
+			revoke = append(revoke, mapping.Role)
+		}
+	}
+	ctx := context.Background()
+	if len(revoke) > 0 {
+		err := s.users.RemoveRolesFromUser(ctx, user, revoke)
+		if err != nil {
+			return err
+		}
+	}
+	if len(grant) > 0 {
+		return s.users.AddRolesToUser(ctx, user, grant)
+	}
+	return nil
+}
+
+// GetUserIdentities returns the external identities linked to the user.
+func (s *FederationService) GetUserIdentities(user *models.User) ([]*models.ExternalIdentityDto, error) {
+	identities, err := s.identities.FindByUserId(context.Background(), user.ID.String())
+	if err != nil {
+		return nil, err
+	}
+	return mapper.ExternalIdentitiesToExternalIdentityDtos(identities), nil
+}
+
+// UnlinkUserIdentity removes one of the external identities linked to the user.
+func (s *FederationService) UnlinkUserIdentity(user *models.User, identityId string) error {
+	if _, err := uuid.Parse(identityId); err != nil {
+		return ErrExternalIdentityNotFound
+	}
+	identity, err := s.identities.FindById(context.Background(), identityId)
+	if err != nil || identity.UserID != user.ID {
+		return ErrExternalIdentityNotFound
+	}
+	return s.identities.Delete(context.Background(), identity.ID.String())
+}
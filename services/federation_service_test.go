@@ -0,0 +1,202 @@
+package services
+
+import (
+	"auth-server/models"
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func newTestProvider() *models.IdentityProvider {
+	return &models.IdentityProvider{
+		BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()},
+		Name:           "upstream",
+		Type:           models.IDENTITY_PROVIDER_TYPE_OIDC,
+	}
+}
+
+func TestFinishLogin(t *testing.T) {
+	provider := newTestProvider()
+	tests := []struct {
+		name     string
+		lifetime time.Duration
+		provider *models.IdentityProvider
+		state    func(state string) string
+		valid    bool
+	}{
+		{"valid state", time.Minute, provider, func(state string) string { return state }, true},
+		{"missing state", time.Minute, provider, func(string) string { return "" }, false},
+		{"unknown state", time.Minute, provider, func(string) string { return "unknown" }, false},
+		{"state of another provider", time.Minute, newTestProvider(), func(state string) string { return state }, false},
+		{"expired login", -time.Minute, provider, func(state string) string { return state }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, logins, _, _ := newTestFederationService()
+			login, state, err := service.StartLogin(provider, "/", tt.lifetime)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Saved directly, as SaveLogin would delete the expired login.
+			logins.Save(context.Background(), login)
+
+			finished, err := service.FinishLogin(tt.provider, tt.state(state))
+			if !tt.valid {
+				if !errors.Is(err, ErrFederatedLoginFailed) {
+					t.Fatalf("error = %v, want ErrFederatedLoginFailed", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if finished.ID != login.ID {
+				t.Fatalf("finished login %s, want %s", finished.ID, login.ID)
+			}
+			_, err = service.FinishLogin(tt.provider, tt.state(state))
+			if !errors.Is(err, ErrFederatedLoginFailed) {
+				t.Fatalf("second use error = %v, want ErrFederatedLoginFailed", err)
+			}
+		})
+	}
+}
+
+func TestResolveUser(t *testing.T) {
+	newUser := func(username string, email string) *models.User {
+		return models.NewUser(&models.SignupRequest{Username: username, Email: email})
+	}
+	tests := []struct {
+		name        string
+		linkByEmail bool
+		users       []*models.User
+		profile     models.ExternalProfile
+		username    string
+		linked      bool
+		valid       bool
+	}{
+		{"verified email of an existing user", true, []*models.User{newUser("alice", "alice@example.com")}, models.ExternalProfile{Subject: "1", Email: "alice@example.com", EmailVerified: true}, "alice", true, true},
+		{"unverified email of an existing user", true, []*models.User{newUser("alice", "alice@example.com")}, models.ExternalProfile{Subject: "1", Email: "alice@example.com"}, "", false, false},
+		{"email of an existing user without linking", false, []*models.User{newUser("alice", "alice@example.com")}, models.ExternalProfile{Subject: "1", Email: "alice@example.com", EmailVerified: true}, "", false, false},
+		{"new email", true, nil, models.ExternalProfile{Subject: "1", Email: "bob@example.com", Username: "bobby"}, "bobby", false, true},
+		{"new email without username", true, nil, models.ExternalProfile{Subject: "1", Email: "bob@example.com"}, "bob", false, true},
+		{"new email with a taken username", true, []*models.User{newUser("bob", "other@example.com")}, models.ExternalProfile{Subject: "1", Email: "bob@example.com"}, "bob-2", false, true},
+		{"missing email", true, nil, models.ExternalProfile{Subject: "1"}, "", false, false},
+		{"missing subject", true, nil, models.ExternalProfile{Email: "bob@example.com"}, "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, _, identities, users := newTestFederationService()
+			for _, user := range tt.users {
+				users.Save(context.Background(), user)
+			}
+			provider := newTestProvider()
+			provider.LinkByEmail = tt.linkByEmail
+
+			user, err := service.ResolveUser(provider, &tt.profile)
+			if !tt.valid {
+				if !errors.Is(err, ErrFederatedLoginFailed) {
+					t.Fatalf("error = %v, want ErrFederatedLoginFailed", err)
+				}
+				if len(identities.identities) != 0 {
+					t.Fatal("an external identity was saved")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if user.Username != tt.username {
+				t.Fatalf("username = %q, want %q", user.Username, tt.username)
+			}
+			if linked := len(tt.users) > 0 && user.ID == tt.users[0].ID; linked != tt.linked {
+				t.Fatalf("linked = %v, want %v", linked, tt.linked)
+			}
+
+			// The identity now identifies the user, whatever its email.
+			profile := tt.profile
+			profile.Email = "changed@example.com"
+			again, err := service.ResolveUser(provider, &profile)
+			if err != nil {
+				t.Fatalf("unexpected error on second login: %v", err)
+			}
+			if again.ID != user.ID {
+				t.Fatalf("second login resolved user %s, want %s", again.ID, user.ID)
+			}
+		})
+	}
+}
+
+func TestResolveUserRejectsInactiveUsers(t *testing.T) {
+	service, _, _, users := newTestFederationService()
+	user := models.NewUser(&models.SignupRequest{Username: "alice", Email: "alice@example.com"})
+	user.Enabled = false
+	users.Save(context.Background(), user)
+	provider := newTestProvider()
+	provider.LinkByEmail = true
+
+	_, err := service.ResolveUser(provider, &models.ExternalProfile{Subject: "1", Email: user.Email, EmailVerified: true})
+	if !errors.Is(err, ErrFederatedLoginFailed) {
+		t.Fatalf("error = %v, want ErrFederatedLoginFailed", err)
+	}
+}
+
+func TestApplyRoleMappings(t *testing.T) {
+	newRole := func(name string) *models.Role {
+		return &models.Role{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, Name: name}
+	}
+	admin, developer, unmapped := newRole("admin"), newRole("developer"), newRole("unmapped")
+	mapping := func(value string, role *models.Role) *models.RoleMapping {
+		return &models.RoleMapping{Claim: "groups", Value: value, RoleID: role.ID, Role: role}
+	}
+	provider := newTestProvider()
+	provider.RoleMappings = []*models.RoleMapping{
+		mapping("admins", admin),
+		mapping("developers", developer),
+		mapping("engineers", developer),
+	}
+
+	tests := []struct {
+		name   string
+		groups []string
+		before []*models.Role
+		after  []string
+	}{
+		{"grants matching roles", []string{"admins"}, nil, []string{"admin"}},
+		{"grants roles of any matching mapping", []string{"engineers"}, nil, []string{"developer"}},
+		{"revokes roles no longer matching", []string{"developers"}, []*models.Role{admin}, []string{"developer"}},
+		{"revokes every mapped role", nil, []*models.Role{admin, developer}, []string{}},
+		{"keeps roles that are not mapped", []string{"admins"}, []*models.Role{unmapped, developer}, []string{"admin", "unmapped"}},
+		{"keeps granted roles", []string{"admins", "developers"}, []*models.Role{admin}, []string{"admin", "developer"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, _, _, users := newTestFederationService()
+			user := models.NewUser(&models.SignupRequest{Username: "alice", Email: "alice@example.com"})
+			user.Roles = append([]*models.Role{}, tt.before...)
+			users.Save(context.Background(), user)
+
+			profile := &models.ExternalProfile{Subject: "1", Attributes: map[string][]string{"groups": tt.groups}}
+			err := service.applyRoleMappings(provider, user, profile)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			roles := make([]string, 0)
+			for _, role := range users[user.ID.String()].Roles {
+				roles = append(roles, role.Name)
+			}
+			sort.Strings(roles)
+			if len(roles) != len(tt.after) {
+				t.Fatalf("roles = %v, want %v", roles, tt.after)
+			}
+			for i := range roles {
+				if roles[i] != tt.after[i] {
+					t.Fatalf("roles = %v, want %v", roles, tt.after)
+				}
+			}
+		})
+	}
+}
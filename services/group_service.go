@@ -0,0 +1,171 @@
+package services
+
+import (
+	"auth-server/mapper"
+	"auth-server/models"
+	"auth-server/repository"
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+type GroupService struct {
+	repo *repository.GroupRepository
+}
+
+// NewGroupService creates a new instance of GroupService with the provided GroupRepository.
+func NewGroupService(repo *repository.GroupRepository) *GroupService {
+	return &GroupService{repo: repo}
+}
+
+// GetAll returns all groups.
+func (s *GroupService) GetAll() ([]*models.GroupDto, error) {
+	groups, err := s.repo.FindAll(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return mapper.GroupsToGroupDtos(groups), nil
+}
+
+// GetGroupById returns the group with the provided id, along with its
+// subgroups, members and roles.
+func (s *GroupService) GetGroupById(id string) (*models.Group, error) {
+	groupId, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.FindById(context.Background(), groupId.String())
+}
+
+// CreateGroup creates a new group under the provided parent, or a top-level
+// group if parent is nil. Group names are unique among siblings.
+func (s *GroupService) CreateGroup(data *models.GroupRequest, parent *models.Group) (*models.GroupDto, error) {
+	group := &models.Group{
+		BaseUUIDEntity: models.BaseUUIDEntity{
+			ID: uuid.New(),
+		},
+		Name: data.Name,
+	}
+	if parent != nil {
+		group.ParentID = &parent.ID
+	}
+	err := s.checkSiblingName(group)
+	if err != nil {
+		return nil, err
+	}
+	group, err = s.repo.Save(context.Background(), group)
+	if err != nil {
+		return nil, err
+	}
+	return mapper.GroupToGroupDto(group), nil
+}
+
+// UpdateGroup replaces the name of the group and moves it under the provided
+// parent, or to the top level if parent is nil. A group cannot be moved under itself or
+// under any of its descendants.
+func (s *GroupService) UpdateGroup(group *models.Group, data *models.GroupRequest, parent *models.Group) (*models.GroupDto, error) {
+	group.ParentID = nil
+	if parent != nil {
+		err := s.checkAncestry(group, parent)
+		if err != nil {
+			return nil, err
+		}
+		group.ParentID = &parent.ID
+	}
+	group.Name = data.Name
+	err := s.checkSiblingName(group)
+	if err != nil {
+		return nil, err
+	}
+	group, err = s.repo.Save(context.Background(), group)
+	if err != nil {
+		return nil, err
+	}
+	return mapper.GroupToGroupDto(group), nil
+}
+
+// DeleteGroup deletes the group. Its subgroups are moved up to its parent.
+func (s *GroupService) DeleteGroup(group *models.Group) error {
+	return s.repo.Delete(context.Background(), group.ID.String())
+}
+
+func (s *GroupService) AssignMembersToGroup(group *models.Group, users []*models.User) ([]*models.UserDto, error) {
+	err := s.repo.AssignMembers(context.Background(), group, users)
+	if err != nil {
+		return nil, err
+	}
+	return s.getGroupMembers(group.ID.String())
+}
+
+func (s *GroupService) AddMembersToGroup(group *models.Group, users []*models.User) ([]*models.UserDto, error) {
+	err := s.repo.AddMembers(context.Background(), group, users)
+	if err != nil {
+		return nil, err
+	}
+	return s.getGroupMembers(group.ID.String())
+}
+
+func (s *GroupService) AssignRolesToGroup(group *models.Group, roles []*models.Role) ([]*models.RoleDto, error) {
+	err := s.repo.AssignRoles(context.Background(), group, roles)
+	if err != nil {
+		return nil, err
+	}
+	return s.getGroupRoles(group.ID.String())
+}
+
+func (s *GroupService) AddRolesToGroup(group *models.Group, roles []*models.Role) ([]*models.RoleDto, error) {
+	err := s.repo.AddRoles(context.Background(), group, roles)
+	if err != nil {
+		return nil, err
+	}
+	return s.getGroupRoles(group.ID.String())
+}
+
+func (s *GroupService) getGroupMembers(id string) ([]*models.UserDto, error) {
+	group, err := s.repo.FindById(context.Background(), id)
+	if err != nil {
+		return nil, err
+	}
+	return mapper.UsersToUserDtos(group.Members), nil
+}
+
+func (s *GroupService) getGroupRoles(id string) ([]*models.RoleDto, error) {
+	group, err := s.repo.FindById(context.Background(), id)
+	if err != nil {
+		return nil, err
+	}
+	return mapper.RolesToRoleDtos(group.Roles), nil
+}
+
+// checkSiblingName returns an error if another group with the same parent
+// already has the group's name.
+func (s *GroupService) checkSiblingName(group *models.Group) error {
+	sibling, err := s.repo.FindByParentAndName(context.Background(), group.ParentID, group.Name)
+	if err != nil {
+		return err
+	}
+	if sibling != nil && sibling.ID != group.ID {
+		return errors.New("group with name already exists")
+	}
+	return nil
+}
+
+// checkAncestry walks up from parent to the top level and returns an error if
+// group is found along the way.
+func (s *GroupService) checkAncestry(group *models.Group, parent *models.Group) error {
+	current := parent
+	for {
+		if current.ID == group.ID {
+			return errors.New("groups cannot be nested under themselves")
+		}
+		if current.ParentID == nil {
+			return nil
+		}
+		next, err := s.repo.FindById(context.Background(), current.ParentID.String())
+		if err != nil {
+			return err
+		}
+		current = next
+	}
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"auth-server/models"
+	"auth-server/repository"
+	"auth-server/repository/repositorytest"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestUpdateGroupChecksAncestry(t *testing.T) {
+	newGroup := func(name string, parent *models.Group) *models.Group {
+		group := &models.Group{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, Name: name}
+		if parent != nil {
+			group.ParentID = &parent.ID
+		}
+		return group
+	}
+	// root > child > grandchild, and other at the top level.
+	root := newGroup("root", nil)
+	child := newGroup("child", root)
+	grandchild := newGroup("grandchild", child)
+	other := newGroup("other", nil)
+
+	tests := []struct {
+		name   string
+		group  *models.Group
+		parent *models.Group
+		fail   bool
+		valid  bool
+	}{
+		{"under another top-level group", child, other, false, true},
+		{"under its grandparent", grandchild, root, false, true},
+		{"to the top level", grandchild, nil, false, true},
+		{"under itself", child, child, false, false},
+		{"under its child", child, grandchild, false, false},
+		{"under its grandchild", root, grandchild, false, false},
+		{"ancestor lookup failing", root, grandchild, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := repositorytest.New(t)
+			if tt.fail {
+				fake.Fail(`FROM "groups" WHERE id = '`+child.ID.String()+`'`, errors.New("connection lost"))
+			}
+			for _, group := range []*models.Group{root, child, grandchild, other} {
+				stored := *group
+				fake.Return(`FROM "groups" WHERE id = '`+group.ID.String()+`'`, &stored)
+			}
+			service := NewGroupService(repository.NewGroupRepository(db))
+			group := *tt.group
+
+			_, err := service.UpdateGroup(&group, &models.GroupRequest{Name: group.Name}, tt.parent)
+			saved := false
+			for _, statement := range fake.Statements() {
+				saved = saved || strings.HasPrefix(statement, `UPDATE "groups"`) || strings.HasPrefix(statement, `INSERT INTO "groups"`)
+			}
+			if tt.valid {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !saved {
+					t.Error("the group was not saved")
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("the group was moved")
+			}
+			if saved {
+				t.Error("the group was saved")
+			}
+		})
+	}
+}
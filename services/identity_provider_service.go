@@ -0,0 +1,139 @@
+package services
+
+import (
+	"auth-server/mapper"
+	"auth-server/models"
+	"auth-server/repository"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidIdentityProvider is returned when the configuration of an
+// identity provider is invalid.
+var ErrInvalidIdentityProvider = errors.New("invalid identity provider")
+
+type IdentityProviderService struct {
+	repo     *repository.IdentityProviderRepository
+	roleRepo *repository.RoleRepository
+}
+
+// NewIdentityProviderService creates a new instance of IdentityProviderService.
+// Roles referred to by role mappings are looked up in roleRepo.
+func NewIdentityProviderService(repo *repository.IdentityProviderRepository, roleRepo *repository.RoleRepository) *IdentityProviderService {
+	return &IdentityProviderService{repo: repo, roleRepo: roleRepo}
+}
+
+// GetAll returns all identity providers.
+func (s *IdentityProviderService) GetAll() ([]*models.IdentityProviderDto, error) {
+	providers, err := s.repo.FindAll(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return mapper.IdentityProvidersToIdentityProviderDtos(providers), nil
+}
+
+// GetIdentityProviderById returns the identity provider with the provided id,
+// along with its role mappings.
+func (s *IdentityProviderService) GetIdentityProviderById(id string) (*models.IdentityProvider, error) {
+	providerId, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.FindById(context.Background(), providerId.String())
+}
+
+// CreateIdentityProvider creates an identity provider from the request.
+func (s *IdentityProviderService) CreateIdentityProvider(data *models.IdentityProviderRequest) (*models.IdentityProviderDto, error) {
+	provider := &models.IdentityProvider{
+		BaseUUIDEntity: models.BaseUUIDEntity{
+			ID: uuid.New(),
+		},
+	}
+	return s.save(provider, data)
+}
+
+// UpdateIdentityProvider replaces the configuration of the identity provider
+// with the request. The client secret and the LDAP bind password are kept
+// when the request omits them.
+func (s *IdentityProviderService) UpdateIdentityProvider(provider *models.IdentityProvider, data *models.IdentityProviderRequest) (*models.IdentityProviderDto, error) {
+	return s.save(provider, data)
+}
+
+// DeleteIdentityProvider deletes the identity provider, unlinking its users.
+func (s *IdentityProviderService) DeleteIdentityProvider(provider *models.IdentityProvider) error {
+	return s.repo.Delete(context.Background(), provider.ID.String())
+}
+
+func (s *IdentityProviderService) save(provider *models.IdentityProvider, data *models.IdentityProviderRequest) (*models.IdentityProviderDto, error) {
+	ctx := context.Background()
+	provider.Name = data.Name
+	provider.Type = data.Type
+	provider.Disabled = data.Disabled
+	provider.Issuer = data.Issuer
+	provider.ClientID = data.ClientID
+	if data.ClientSecret != "" {
+		provider.ClientSecret = data.ClientSecret
+	}
+	provider.Scopes = data.Scopes
+	provider.MetadataURL = data.MetadataURL
+	provider.Metadata = data.Metadata
+	provider.EmailClaim = data.EmailClaim
+	provider.LinkByEmail = data.LinkByEmail
+	provider.LDAPURL = data.LDAPURL
+	provider.LDAPStartTLS = data.LDAPStartTLS
+	provider.LDAPRootCAs = data.LDAPRootCAs
+	provider.LDAPBindDN = data.LDAPBindDN
+	if data.LDAPBindPassword != "" {
+		provider.LDAPBindPassword = data.LDAPBindPassword
+	}
+	provider.LDAPUserDNTemplate = data.LDAPUserDNTemplate
+	provider.LDAPBaseDN = data.LDAPBaseDN
+	provider.LDAPUserFilter = data.LDAPUserFilter
+	provider.LDAPGroupBaseDN = data.LDAPGroupBaseDN
+	provider.LDAPGroupFilter = data.LDAPGroupFilter
+
+	provider.RoleMappings = nil
+	for _, mappingRequest := range data.RoleMappings {
+		if _, err := uuid.Parse(mappingRequest.RoleId); err != nil {
+			return nil, fmt.Errorf("%w: invalid role id %q", ErrInvalidIdentityProvider, mappingRequest.RoleId)
+		}
+		role, err := s.roleRepo.FindById(ctx, mappingRequest.RoleId)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unknown role %q", ErrInvalidIdentityProvider, mappingRequest.RoleId)
+		}
+		provider.RoleMappings = append(provider.RoleMappings, &models.RoleMapping{
+			BaseUUIDEntity: models.BaseUUIDEntity{
+				ID: uuid.New(),
+			},
+			Claim:  mappingRequest.Claim,
+			Value:  mappingRequest.Value,
+			RoleID: role.ID,
+			Role:   role,
+		})
+	}
+	err := provider.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIdentityProvider, err)
+	}
+	if provider.Type == models.IDENTITY_PROVIDER_TYPE_SAML && provider.Metadata != "" {
+		if _, err := parseSAMLMetadata([]byte(provider.Metadata)); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidIdentityProvider, err)
+		}
+	}
+
+	existing, err := s.repo.FindByName(ctx, provider.Name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.ID != provider.ID {
+		return nil, fmt.Errorf("%w: name is already taken", ErrInvalidIdentityProvider)
+	}
+	provider, err = s.repo.Save(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+	return mapper.IdentityProviderToIdentityProviderDto(provider), nil
+}
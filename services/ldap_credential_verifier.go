@@ -0,0 +1,275 @@
+package services
+
+import (
+	"auth-server/models"
+	"auth-server/repository"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrDirectoryUnavailable is returned when an LDAP directory cannot be
+// reached, or refuses the server's own credentials.
+var ErrDirectoryUnavailable = errors.New("directory unavailable")
+
+// LDAPCredentialVerifier checks passwords by binding to an LDAP directory as
+// the user. Users are provisioned on their first login, and their email and
+// roles updated on every login, like the users of other identity providers.
+type LDAPCredentialVerifier struct {
+	provider   *models.IdentityProvider
+	federation *FederationService
+	users      userStore
+	timeout    time.Duration
+}
+
+// NewLDAPCredentialVerifier creates a new instance of LDAPCredentialVerifier
+// for the directory. Requests to the directory time out after timeout.
+func NewLDAPCredentialVerifier(provider *models.IdentityProvider, federation *FederationService, users *repository.UserRepository, timeout time.Duration) *LDAPCredentialVerifier {
+	return &LDAPCredentialVerifier{
+		provider:   provider,
+		federation: federation,
+		users:      users,
+		timeout:    timeout,
+	}
+}
+
+func (v *LDAPCredentialVerifier) VerifyCredentials(ctx context.Context, username string, password string) (*models.User, error) {
+	// Directories accept binds without a password as anonymous ones. Disabled
+	// directories are not asked, even by verifiers created before they were
+	// disabled.
+	if username == "" || password == "" || v.provider.Disabled {
+		return nil, ErrInvalidCredentials
+	}
+	_, span := startSpan(ctx, "LDAPCredentialVerifier.VerifyCredentials")
+	defer span.End()
+	span.SetAttributes(attribute.String("ldap.directory", v.provider.Name))
+	conn, err := v.dial()
+	if err != nil {
+		return nil, failSpan(span, fmt.Errorf("%w: %s: %v", ErrDirectoryUnavailable, v.provider.Name, err))
+	}
+	defer conn.Close()
+
+	var entry *ldap.Entry
+	if v.provider.LDAPUserDNTemplate != "" {
+		entry, err = v.bindAsUser(conn, username, password)
+	} else {
+		entry, err = v.searchAndBind(conn, username, password)
+	}
+	if err != nil {
+		return nil, err
+	}
+	groups, err := v.groups(conn, entry)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrDirectoryUnavailable, v.provider.Name, err)
+	}
+
+	profile := v.profile(username, entry, groups)
+	user, err := v.federation.ResolveUser(v.provider, profile)
+	if err != nil {
+		return nil, err
+	}
+	return v.updateEmail(user, profile.Email)
+}
+
+// dial connects to the directory, securing the connection with StartTLS if
+// required.
+func (v *LDAPCredentialVerifier) dial() (*ldap.Conn, error) {
+	ldapURL, err := url.Parse(v.provider.LDAPURL)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		ServerName: ldapURL.Hostname(),
+		MinVersion: tls.VersionTLS12,
+	}
+	if v.provider.LDAPRootCAs != "" {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		tlsConfig.RootCAs.AppendCertsFromPEM([]byte(v.provider.LDAPRootCAs))
+	}
+	conn, err := ldap.DialURL(v.provider.LDAPURL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: v.timeout}),
+		ldap.DialWithTLSConfig(tlsConfig),
+	)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(v.timeout)
+	if v.provider.LDAPStartTLS {
+		err = conn.StartTLS(tlsConfig)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// bindAsUser binds as the DN the template yields for the username, then reads
+// the user's entry with their own credentials: under the base DN with the
+// user filter if one is configured, since templates such as user@domain are
+// not DNs, or else at the bound DN.
+func (v *LDAPCredentialVerifier) bindAsUser(conn *ldap.Conn, username string, password string) (*ldap.Entry, error) {
+	dn := fmt.Sprintf(v.provider.LDAPUserDNTemplate, ldap.EscapeDN(username))
+	err := v.bindUser(conn, dn, password)
+	if err != nil {
+		return nil, err
+	}
+	if v.provider.LDAPBaseDN != "" {
+		return v.searchUser(conn, username)
+	}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		dn, ldap.ScopeBaseObject, ldap.NeverDerefAliases, 1, 0, false,
+		"(objectClass=*)", v.attributes(), nil,
+	))
+	if err != nil || len(result.Entries) != 1 {
+		return nil, fmt.Errorf("%w: %s: cannot read the entry of %s", ErrDirectoryUnavailable, v.provider.Name, dn)
+	}
+	return result.Entries[0], nil
+}
+
+// searchAndBind searches for the user's entry, as the configured bind DN or
+// anonymously, then binds as the entry to check the password.
+func (v *LDAPCredentialVerifier) searchAndBind(conn *ldap.Conn, username string, password string) (*ldap.Entry, error) {
+	err := v.bindService(conn)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := v.searchUser(conn, username)
+	if err != nil {
+		return nil, err
+	}
+	err = v.bindUser(conn, entry.DN, password)
+	if err != nil {
+		return nil, err
+	}
+	// Groups are searched for with the server's credentials, as users may not
+	// be allowed to read them.
+	err = v.bindService(conn)
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (v *LDAPCredentialVerifier) bindService(conn *ldap.Conn) error {
+	var err error
+	if v.provider.LDAPBindDN != "" {
+		err = conn.Bind(v.provider.LDAPBindDN, v.provider.LDAPBindPassword)
+	} else {
+		err = conn.UnauthenticatedBind("")
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrDirectoryUnavailable, v.provider.Name, err)
+	}
+	return nil
+}
+
+func (v *LDAPCredentialVerifier) bindUser(conn *ldap.Conn, dn string, password string) error {
+	err := conn.Bind(dn, password)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return ErrInvalidCredentials
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrDirectoryUnavailable, v.provider.Name, err)
+	}
+	return nil
+}
+
+// searchUser returns the only entry matching the user filter for the
+// username.
+func (v *LDAPCredentialVerifier) searchUser(conn *ldap.Conn, username string) (*ldap.Entry, error) {
+	filter := v.provider.LDAPUserFilter
+	if filter == "" {
+		filter = models.DEFAULT_LDAP_USER_FILTER
+	}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		v.provider.LDAPBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		fmt.Sprintf(filter, ldap.EscapeFilter(username)), v.attributes(), nil,
+	))
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrDirectoryUnavailable, v.provider.Name, err)
+	}
+	if len(result.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	return result.Entries[0], nil
+}
+
+// groups returns the DNs of the groups the user is a member of.
+func (v *LDAPCredentialVerifier) groups(conn *ldap.Conn, entry *ldap.Entry) ([]string, error) {
+	if v.provider.LDAPGroupFilter == "" {
+		return entry.GetAttributeValues("memberOf"), nil
+	}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		v.provider.LDAPGroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		fmt.Sprintf(v.provider.LDAPGroupFilter, ldap.EscapeFilter(entry.DN)), []string{"dn"}, nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]string, 0)
+	for _, group := range result.Entries {
+		groups = append(groups, group.DN)
+	}
+	return groups, nil
+}
+
+// profile describes the user the entry holds. The subject identifying the
+// user is their DN, so users moved to another DN are seen as new users. The
+// attributes of the entry are exposed to role mappings, along with the
+// groups of the user.
+func (v *LDAPCredentialVerifier) profile(username string, entry *ldap.Entry, groups []string) *models.ExternalProfile {
+	attributes := make(map[string][]string)
+	for _, attribute := range entry.Attributes {
+		attributes[attribute.Name] = attribute.Values
+	}
+	attributes[models.LDAP_GROUPS_ATTRIBUTE] = groups
+	return &models.ExternalProfile{
+		Subject:       strings.ToLower(entry.DN),
+		Email:         entry.GetAttributeValue(v.emailAttribute()),
+		EmailVerified: true,
+		Username:      username,
+		Attributes:    attributes,
+	}
+}
+
+func (v *LDAPCredentialVerifier) attributes() []string {
+	return []string{v.emailAttribute(), "memberOf"}
+}
+
+func (v *LDAPCredentialVerifier) emailAttribute() string {
+	if v.provider.EmailClaim == "" {
+		return models.DEFAULT_LDAP_EMAIL_ATTRIBUTE
+	}
+	return v.provider.EmailClaim
+}
+
+// updateEmail keeps the email of the user in line with the directory, unless
+// another user holds the new email.
+func (v *LDAPCredentialVerifier) updateEmail(user *models.User, email string) (*models.User, error) {
+	ctx := context.Background()
+	if email == "" || email == user.Email {
+		return user, nil
+	}
+	existing, err := v.users.FindByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return user, nil
+	}
+	user.Email = email
+	return v.users.Save(ctx, user)
+}
@@ -0,0 +1,382 @@
+package services
+
+import (
+	"auth-server/models"
+	"context"
+	"errors"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/google/uuid"
+)
+
+// ldapEntry is an entry of a testDirectory. Entries with a password can be
+// bound as.
+type ldapEntry struct {
+	dn         string
+	password   string
+	attributes map[string][]string
+}
+
+// testDirectory is an in-process LDAP server answering simple binds and
+// searches with equality or presence filters, which is what
+// LDAPCredentialVerifier sends.
+type testDirectory struct {
+	listener        net.Listener
+	entries         []*ldapEntry
+	serviceDN       string
+	servicePassword string
+
+	mu          sync.Mutex
+	connections int
+}
+
+var simpleFilter = regexp.MustCompile(`^\(([^=()]+)=([^()]*)\)$`)
+
+func newTestDirectory(t *testing.T, entries ...*ldapEntry) *testDirectory {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &testDirectory{
+		listener:        listener,
+		entries:         entries,
+		serviceDN:       "cn=service,dc=example,dc=com",
+		servicePassword: "service-password",
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			d.mu.Lock()
+			d.connections++
+			d.mu.Unlock()
+			go d.serve(conn)
+		}
+	}()
+	return d
+}
+
+func (d *testDirectory) url() string {
+	return "ldap://" + d.listener.Addr().String()
+}
+
+func (d *testDirectory) connectionCount() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.connections
+}
+
+func (d *testDirectory) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := op.Children[1].Data.String()
+			password := op.Children[2].Data.String()
+			conn.Write(ldapMessage(id, ldapResult(ldap.ApplicationBindResponse, d.bind(dn, password))).Bytes())
+		case ldap.ApplicationSearchRequest:
+			for _, response := range d.search(op) {
+				conn.Write(ldapMessage(id, response).Bytes())
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (d *testDirectory) bind(dn string, password string) uint16 {
+	if dn == "" && password == "" {
+		return ldap.LDAPResultSuccess
+	}
+	if dn == d.serviceDN && password == d.servicePassword {
+		return ldap.LDAPResultSuccess
+	}
+	for _, entry := range d.entries {
+		if strings.EqualFold(entry.dn, dn) && entry.password != "" && entry.password == password {
+			return ldap.LDAPResultSuccess
+		}
+	}
+	return ldap.LDAPResultInvalidCredentials
+}
+
+func (d *testDirectory) search(op *ber.Packet) []*ber.Packet {
+	base := op.Children[0].Data.String()
+	scope := op.Children[1].Value.(int64)
+	sizeLimit := int(op.Children[3].Value.(int64))
+	filter, err := ldap.DecompileFilter(op.Children[6])
+	if err != nil {
+		return []*ber.Packet{ldapResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError)}
+	}
+	var responses []*ber.Packet
+	for _, entry := range d.entries {
+		inScope := strings.EqualFold(entry.dn, base)
+		if scope != ldap.ScopeBaseObject {
+			inScope = strings.HasSuffix(strings.ToLower(entry.dn), strings.ToLower(base))
+		}
+		if !inScope || !entry.matches(filter) {
+			continue
+		}
+		if sizeLimit > 0 && len(responses) == sizeLimit {
+			return append(responses, ldapResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultSizeLimitExceeded))
+		}
+		responses = append(responses, entry.packet())
+	}
+	return append(responses, ldapResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+}
+
+func (e *ldapEntry) matches(filter string) bool {
+	match := simpleFilter.FindStringSubmatch(filter)
+	if match == nil {
+		return false
+	}
+	if match[2] == "*" {
+		return true
+	}
+	for _, value := range e.attributes[match[1]] {
+		if strings.EqualFold(value, match[2]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *ldapEntry) packet() *ber.Packet {
+	entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, "Object Name"))
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name, values := range e.attributes {
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+	entry.AppendChild(attributes)
+	return entry
+}
+
+func ldapMessage(id int64, op *ber.Packet) *ber.Packet {
+	message := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	message.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "Message ID"))
+	message.AppendChild(op)
+	return message
+}
+
+func ldapResult(tag ber.Tag, code uint16) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Result Code"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	return result
+}
+
+func newTestLDAPDirectory(t *testing.T) *testDirectory {
+	return newTestDirectory(t,
+		&ldapEntry{
+			dn:       "uid=alice,ou=people,dc=example,dc=com",
+			password: "alice-password",
+			attributes: map[string][]string{
+				"uid":      {"alice"},
+				"mail":     {"alice@example.com"},
+				"memberOf": {"cn=admins,ou=groups,dc=example,dc=com"},
+			},
+		},
+		&ldapEntry{
+			dn:         "uid=twin,ou=people,dc=example,dc=com",
+			password:   "twin-password",
+			attributes: map[string][]string{"uid": {"twin"}},
+		},
+		&ldapEntry{
+			dn:         "uid=twin,ou=contractors,dc=example,dc=com",
+			password:   "twin-password",
+			attributes: map[string][]string{"uid": {"twin"}},
+		},
+	)
+}
+
+func newTestDirectoryProvider(d *testDirectory) *models.IdentityProvider {
+	provider := newTestProvider()
+	provider.Name = "directory"
+	provider.Type = models.IDENTITY_PROVIDER_TYPE_LDAP
+	provider.LDAPURL = d.url()
+	provider.LDAPBindDN = d.serviceDN
+	provider.LDAPBindPassword = d.servicePassword
+	provider.LDAPBaseDN = "dc=example,dc=com"
+	return provider
+}
+
+func newTestLDAPVerifier(provider *models.IdentityProvider) (*LDAPCredentialVerifier, fakeUserStore) {
+	federation, _, _, users := newTestFederationService()
+	return &LDAPCredentialVerifier{provider: provider, federation: federation, users: users, timeout: 2 * time.Second}, users
+}
+
+func TestLDAPCredentialVerifier(t *testing.T) {
+	directory := newTestLDAPDirectory(t)
+	closed := newTestLDAPDirectory(t)
+	closed.listener.Close()
+
+	tests := []struct {
+		name      string
+		provider  func(p *models.IdentityProvider)
+		username  string
+		password  string
+		err       error
+		connected bool
+	}{
+		{"search and bind", func(p *models.IdentityProvider) {}, "alice", "alice-password", nil, true},
+		{"anonymous search and bind", func(p *models.IdentityProvider) { p.LDAPBindDN, p.LDAPBindPassword = "", "" }, "alice", "alice-password", nil, true},
+		{"bind with a DN template", func(p *models.IdentityProvider) {
+			p.LDAPUserDNTemplate = "uid=%s,ou=people,dc=example,dc=com"
+			p.LDAPBaseDN = ""
+		}, "alice", "alice-password", nil, true},
+		{"bind with a DN template and a base DN", func(p *models.IdentityProvider) { p.LDAPUserDNTemplate = "uid=%s,ou=people,dc=example,dc=com" }, "alice", "alice-password", nil, true},
+		{"wrong password", func(p *models.IdentityProvider) {}, "alice", "wrong", ErrInvalidCredentials, true},
+		{"wrong password with a DN template", func(p *models.IdentityProvider) { p.LDAPUserDNTemplate = "uid=%s,ou=people,dc=example,dc=com" }, "alice", "wrong", ErrInvalidCredentials, true},
+		{"unknown user", func(p *models.IdentityProvider) {}, "bob", "bob-password", ErrInvalidCredentials, true},
+		{"ambiguous username", func(p *models.IdentityProvider) {}, "twin", "twin-password", ErrInvalidCredentials, true},
+		{"empty password", func(p *models.IdentityProvider) {}, "alice", "", ErrInvalidCredentials, false},
+		{"wrong service credentials", func(p *models.IdentityProvider) { p.LDAPBindPassword = "wrong" }, "alice", "alice-password", ErrDirectoryUnavailable, true},
+		{"unreachable directory", func(p *models.IdentityProvider) { p.LDAPURL = closed.url() }, "alice", "alice-password", ErrDirectoryUnavailable, false},
+		{"disabled directory", func(p *models.IdentityProvider) { p.Disabled = true }, "alice", "alice-password", ErrInvalidCredentials, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newTestDirectoryProvider(directory)
+			tt.provider(provider)
+			verifier, users := newTestLDAPVerifier(provider)
+			connections := directory.connectionCount()
+
+			user, err := verifier.VerifyCredentials(context.Background(), tt.username, tt.password)
+			if connected := directory.connectionCount() > connections; connected != tt.connected {
+				t.Fatalf("directory contacted = %v, want %v", connected, tt.connected)
+			}
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("error = %v, want %v", err, tt.err)
+				}
+				if len(users) != 0 {
+					t.Fatal("a user was provisioned")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if user.Username != "alice" || user.Email != "alice@example.com" || users[user.ID.String()] == nil {
+				t.Fatalf("unexpected user %+v", user)
+			}
+		})
+	}
+}
+
+func TestLDAPCredentialVerifierMapsGroupsToRoles(t *testing.T) {
+	directory := newTestLDAPDirectory(t)
+	provider := newTestDirectoryProvider(directory)
+	role := &models.Role{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, Name: "admin"}
+	provider.RoleMappings = []*models.RoleMapping{{
+		Claim:  models.LDAP_GROUPS_ATTRIBUTE,
+		Value:  "cn=admins,ou=groups,dc=example,dc=com",
+		RoleID: role.ID,
+		Role:   role,
+	}}
+	verifier, _ := newTestLDAPVerifier(provider)
+
+	user, err := verifier.VerifyCredentials(context.Background(), "alice", "alice-password")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(user.Roles) != 1 || user.Roles[0].ID != role.ID {
+		t.Fatalf("roles = %v, want the admin role", user.Roles)
+	}
+}
+
+// plainHasher stores passwords as they are, to keep tests fast.
+type plainHasher struct{}
+
+func (plainHasher) GenerateFromPassword(password string) (string, error) {
+	return "plain$" + password, nil
+}
+
+func (plainHasher) CompareHashAndPassword(hashedPassword string, password string) error {
+	if hashedPassword != "plain$"+password {
+		return errors.New("passwords do not match")
+	}
+	return nil
+}
+
+func TestChainCredentialVerifierFallsBackToLocalPasswords(t *testing.T) {
+	directory := newTestLDAPDirectory(t)
+	closed := newTestLDAPDirectory(t)
+	closed.listener.Close()
+	passwordHasher := plainHasher{}
+
+	tests := []struct {
+		name      string
+		provider  func(p *models.IdentityProvider)
+		username  string
+		password  string
+		err       error
+		local     bool
+		connected bool
+	}{
+		{"local password", func(p *models.IdentityProvider) {}, "carol", "carol-password", nil, true, false},
+		{"directory password", func(p *models.IdentityProvider) {}, "alice", "alice-password", nil, false, true},
+		{"wrong local password", func(p *models.IdentityProvider) {}, "carol", "wrong", ErrInvalidCredentials, false, true},
+		{"unknown user", func(p *models.IdentityProvider) {}, "bob", "bob-password", ErrInvalidCredentials, false, true},
+		{"local password with the directory unreachable", func(p *models.IdentityProvider) { p.LDAPURL = closed.url() }, "carol", "carol-password", nil, true, false},
+		{"directory password with the directory unreachable", func(p *models.IdentityProvider) { p.LDAPURL = closed.url() }, "alice", "alice-password", ErrDirectoryUnavailable, false, false},
+		{"local password with the directory disabled", func(p *models.IdentityProvider) { p.Disabled = true }, "carol", "carol-password", nil, true, false},
+		{"directory password with the directory disabled", func(p *models.IdentityProvider) { p.Disabled = true }, "alice", "alice-password", ErrInvalidCredentials, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newTestDirectoryProvider(directory)
+			tt.provider(provider)
+			ldapVerifier, users := newTestLDAPVerifier(provider)
+			hash, err := passwordHasher.GenerateFromPassword("carol-password")
+			if err != nil {
+				t.Fatal(err)
+			}
+			carol := models.NewUser(&models.SignupRequest{Username: "carol", Email: "carol@example.com", Password: hash})
+			users.Save(context.Background(), carol)
+			verifier := ChainCredentialVerifier{&LocalCredentialVerifier{users: users, hasher: passwordHasher}, ldapVerifier}
+			connections := directory.connectionCount()
+
+			user, err := verifier.VerifyCredentials(context.Background(), tt.username, tt.password)
+			if connected := directory.connectionCount() > connections; connected != tt.connected {
+				t.Fatalf("directory contacted = %v, want %v", connected, tt.connected)
+			}
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if local := user.ID == carol.ID; local != tt.local {
+				t.Fatalf("local user = %v, want %v", local, tt.local)
+			}
+		})
+	}
+}
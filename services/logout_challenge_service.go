@@ -0,0 +1,100 @@
+package services
+
+import (
+	"auth-server/cache"
+	"auth-server/models"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrInvalidLogoutChallenge is returned when the confirmation of a logout does
+// not carry the challenge issued with the prompt, or carries one that expired
+// or was already used.
+var ErrInvalidLogoutChallenge = errors.New("invalid logout challenge")
+
+const (
+	// logoutChallengeLifetime is how long users have to confirm a logout.
+	logoutChallengeLifetime = 10 * time.Minute
+	// logoutChallengeIdLength is the length of the random id of a challenge.
+	logoutChallengeIdLength = 16
+)
+
+type LogoutChallengeService struct {
+	replayCache *cache.ReplayCache
+	secret      []byte
+}
+
+// NewLogoutChallengeService creates a new instance of LogoutChallengeService.
+// Challenges are signed with secret, so that any instance sharing it can check
+// them, and the ids of the challenges redeemed are remembered in replayCache.
+func NewLogoutChallengeService(replayCache *cache.ReplayCache, secret []byte) *LogoutChallengeService {
+	return &LogoutChallengeService{
+		replayCache: replayCache,
+		secret:      secret,
+	}
+}
+
+// Issue returns the challenge sent with the prompt asking the user of the
+// session to confirm the logout request. The confirmation must carry it back.
+func (s *LogoutChallengeService) Issue(session *models.Session, request *models.LogoutRequest) (string, error) {
+	challenge := make([]byte, logoutChallengeIdLength+8)
+	_, err := rand.Read(challenge[:logoutChallengeIdLength])
+	if err != nil {
+		return "", err
+	}
+	binary.BigEndian.PutUint64(challenge[logoutChallengeIdLength:], uint64(time.Now().Unix()))
+	mac, err := s.challengeMac(challenge, session, request)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(append(challenge, mac...)), nil
+}
+
+// Redeem checks that the challenge was issued for the same session and logout
+// request, less than logoutChallengeLifetime ago, and that it was not
+// redeemed before.
+func (s *LogoutChallengeService) Redeem(challenge string, session *models.Session, request *models.LogoutRequest) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(challenge)
+	if err != nil || len(decoded) != logoutChallengeIdLength+8+sha256.Size {
+		return ErrInvalidLogoutChallenge
+	}
+	signed := decoded[:logoutChallengeIdLength+8]
+	mac, err := s.challengeMac(signed, session, request)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(decoded[logoutChallengeIdLength+8:], mac) {
+		return ErrInvalidLogoutChallenge
+	}
+	issued := time.Unix(int64(binary.BigEndian.Uint64(signed[logoutChallengeIdLength:])), 0)
+	expiry := issued.Add(logoutChallengeLifetime)
+	if time.Now().After(expiry) {
+		return ErrInvalidLogoutChallenge
+	}
+	id := base64.RawURLEncoding.EncodeToString(signed[:logoutChallengeIdLength])
+	if !s.replayCache.Use(id, expiry) {
+		return ErrInvalidLogoutChallenge
+	}
+	return nil
+}
+
+// challengeMac signs the id and issue time of a challenge along with what it
+// is bound to.
+func (s *LogoutChallengeService) challengeMac(challenge []byte, session *models.Session, request *models.LogoutRequest) ([]byte, error) {
+	encodedRequest, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte("logout-challenge:"))
+	mac.Write(challenge)
+	mac.Write([]byte(session.ID.String()))
+	mac.Write(encodedRequest)
+	return mac.Sum(nil), nil
+}
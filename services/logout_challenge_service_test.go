@@ -0,0 +1,73 @@
+package services
+
+import (
+	"auth-server/cache"
+	"auth-server/models"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestLogoutChallengeService(t *testing.T) {
+	service := NewLogoutChallengeService(cache.NewReplayCache(), []byte("test-secret"))
+	session := &models.Session{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}}
+	request := &models.LogoutRequest{ClientId: "client", PostLogoutRedirectURI: "https://app.example.com/", State: "state"}
+
+	// issuedAt crafts a challenge issued at the given time, as Issue would have.
+	issuedAt := func(at time.Time) string {
+		challenge := make([]byte, logoutChallengeIdLength+8)
+		binary.BigEndian.PutUint64(challenge[logoutChallengeIdLength:], uint64(at.Unix()))
+		mac, err := service.challengeMac(challenge, session, request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(append(challenge, mac...))
+	}
+	issue := func() string {
+		challenge, err := service.Issue(session, request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return challenge
+	}
+	otherRequest := *request
+	otherRequest.PostLogoutRedirectURI = "https://evil.example.com/"
+
+	tests := []struct {
+		name      string
+		challenge string
+		session   *models.Session
+		request   *models.LogoutRequest
+		valid     bool
+	}{
+		{"issued for the request", issue(), session, request, true},
+		{"issued nine minutes ago", issuedAt(time.Now().Add(-9 * time.Minute)), session, request, true},
+		{"missing", "", session, request, false},
+		{"garbage", "not a challenge", session, request, false},
+		{"expired", issuedAt(time.Now().Add(-11 * time.Minute)), session, request, false},
+		{"other session", issue(), &models.Session{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}}, request, false},
+		{"other request", issue(), session, &otherRequest, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := service.Redeem(tt.challenge, tt.session, tt.request)
+			if !tt.valid {
+				if !errors.Is(err, ErrInvalidLogoutChallenge) {
+					t.Fatalf("error = %v, want ErrInvalidLogoutChallenge", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			err = service.Redeem(tt.challenge, tt.session, tt.request)
+			if !errors.Is(err, ErrInvalidLogoutChallenge) {
+				t.Fatalf("second redeem error = %v, want ErrInvalidLogoutChallenge", err)
+			}
+		})
+	}
+}
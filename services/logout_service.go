@@ -0,0 +1,71 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type BackChannelLogoutService struct {
+	client   *http.Client
+	attempts int
+	backoff  time.Duration
+}
+
+// NewBackChannelLogoutService creates a new instance of BackChannelLogoutService.
+// Logout tokens are sent with client, and delivery is attempted up to attempts
+// times, waiting backoff before the first retry and twice as long before each
+// of the next ones.
+func NewBackChannelLogoutService(client *http.Client, attempts int, backoff time.Duration) *BackChannelLogoutService {
+	return &BackChannelLogoutService{
+		client:   client,
+		attempts: attempts,
+		backoff:  backoff,
+	}
+}
+
+// Deliver sends the logout token to the back-channel logout URI of a client,
+// as described in OpenID Connect Back-Channel Logout, section 2.5. Delivery is
+// retried when the request fails or the client responds with a server error,
+// but not when the client rejects the token.
+func (s *BackChannelLogoutService) Deliver(uri string, logoutToken string) error {
+	body := url.Values{"logout_token": {logoutToken}}.Encode()
+	delay := s.backoff
+	var err error
+	for attempt := 1; attempt <= s.attempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		var retry bool
+		retry, err = s.post(uri, body)
+		if err == nil || !retry {
+			return err
+		}
+	}
+	return fmt.Errorf("back-channel logout to %s failed after %d attempts: %w", uri, s.attempts, err)
+}
+
+// post sends a single logout request, and returns whether it is worth retrying
+// if it failed.
+func (s *BackChannelLogoutService) post(uri string, body string) (bool, error) {
+	request, err := http.NewRequest(http.MethodPost, uri, strings.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response, err := s.client.Do(request)
+	if err != nil {
+		return true, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= http.StatusInternalServerError {
+		return true, fmt.Errorf("back-channel logout to %s: %s", uri, response.Status)
+	}
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusNoContent {
+		return false, fmt.Errorf("back-channel logout to %s: %s", uri, response.Status)
+	}
+	return false, nil
+}
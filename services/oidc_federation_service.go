@@ -0,0 +1,262 @@
+package services
+
+import (
+	"auth-server/cache"
+	"auth-server/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultFederationScopes are requested from OpenID Connect providers
+// configured without scopes.
+var defaultFederationScopes = []string{"openid", "email", "profile"}
+
+type OIDCFederationService struct {
+	httpClient    *http.Client
+	metadataCache *cache.Cache[*models.OpenIDProviderMetadata]
+	keySetCache   *cache.Cache[*models.JSONWebKeySet]
+}
+
+// NewOIDCFederationService creates a new instance of OIDCFederationService.
+// The configurations discovered from upstream providers are kept in
+// metadataCache, and their key sets in keySetCache.
+func NewOIDCFederationService(httpClient *http.Client, metadataCache *cache.Cache[*models.OpenIDProviderMetadata], keySetCache *cache.Cache[*models.JSONWebKeySet]) *OIDCFederationService {
+	return &OIDCFederationService{
+		httpClient:    httpClient,
+		metadataCache: metadataCache,
+		keySetCache:   keySetCache,
+	}
+}
+
+// AuthenticationRequestURI returns the URI of the provider's authorization
+// endpoint the user is sent to, to log in with the authorization code flow.
+// The request is bound to the login by its state, nonce and PKCE code challenge.
+func (s *OIDCFederationService) AuthenticationRequestURI(provider *models.IdentityProvider, login *models.FederatedLogin, state string, redirectURI string) (string, error) {
+	metadata, err := s.providerMetadata(provider)
+	if err != nil {
+		return "", err
+	}
+	location, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	scopes := []string(provider.Scopes)
+	if len(scopes) == 0 {
+		scopes = defaultFederationScopes
+	}
+	if !provider.Scopes.Contains("openid") && len(provider.Scopes) > 0 {
+		scopes = append([]string{"openid"}, scopes...)
+	}
+	query := location.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", provider.ClientID)
+	query.Set("redirect_uri", redirectURI)
+	query.Set("scope", strings.Join(scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", login.Nonce)
+	query.Set("code_challenge", login.CodeChallenge())
+	query.Set("code_challenge_method", models.CODE_CHALLENGE_METHOD_S256)
+	location.RawQuery = query.Encode()
+	return location.String(), nil
+}
+
+// tokenResponse is the successful or error response of an upstream token endpoint.
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange redeems the authorization code at the provider's token endpoint,
+// validates the ID token it returns, as described in OpenID Connect Core 1.0,
+// section 3.1.3.7, and returns what it asserts about the user.
+func (s *OIDCFederationService) Exchange(provider *models.IdentityProvider, login *models.FederatedLogin, code string, redirectURI string) (*models.ExternalProfile, error) {
+	metadata, err := s.providerMetadata(provider)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	form.Set("code_verifier", login.CodeVerifier)
+	if provider.ClientSecret == "" {
+		form.Set("client_id", provider.ClientID)
+	}
+	request, err := http.NewRequest(http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if provider.ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(provider.ClientID), url.QueryEscape(provider.ClientSecret))
+	}
+	response, err := s.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	var tokens tokenResponse
+	err = json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&tokens)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token response: %w", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token request failed with status %d: %s %s", response.StatusCode, tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return nil, errors.New("the token response has no id_token")
+	}
+
+	token, err := s.verifyIDToken(provider, metadata, tokens.IDToken)
+	if err != nil {
+		return nil, err
+	}
+	if token.ClaimString("nonce") != login.Nonce {
+		return nil, errors.New("the id_token nonce does not match the login")
+	}
+	return idTokenProfile(provider, token), nil
+}
+
+// verifyIDToken checks the signature, issuer, audience and lifetime of the ID
+// token. The provider's keys are fetched again when none of the cached ones
+// verifies the signature, in case they were rotated.
+func (s *OIDCFederationService) verifyIDToken(provider *models.IdentityProvider, metadata *models.OpenIDProviderMetadata, idToken string) (*models.SignedToken, error) {
+	token, err := models.ParseSignedToken(idToken)
+	if err != nil {
+		return nil, err
+	}
+	keySet, cached := s.keySetCache.Get(metadata.JwksURI)
+	if !cached {
+		keySet, err = s.fetchKeySet(metadata.JwksURI)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = verifyWithKeySet(token, keySet)
+	if err != nil && cached {
+		keySet, err = s.fetchKeySet(metadata.JwksURI)
+		if err != nil {
+			return nil, err
+		}
+		err = verifyWithKeySet(token, keySet)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if token.ClaimString("iss") != metadata.Issuer {
+		return nil, errors.New("the id_token was not issued by the provider")
+	}
+	audiences := token.Audiences()
+	if !hasAudience(audiences, []string{provider.ClientID}) {
+		return nil, errors.New("the id_token is not intended for this server")
+	}
+	if azp := token.ClaimString("azp"); (len(audiences) > 1 || azp != "") && azp != provider.ClientID {
+		return nil, errors.New("the id_token was issued to another party")
+	}
+	exp, ok := token.ClaimTime("exp")
+	if !ok || time.Now().After(time.Unix(exp, 0).Add(assertionLeeway)) {
+		return nil, errors.New("the id_token has expired")
+	}
+	if token.ClaimString("sub") == "" {
+		return nil, errors.New("the id_token has no subject")
+	}
+	return token, nil
+}
+
+// providerMetadata returns the configuration the provider publishes at its
+// discovery endpoint. Its issuer must be the one the provider was configured
+// with.
+func (s *OIDCFederationService) providerMetadata(provider *models.IdentityProvider) (*models.OpenIDProviderMetadata, error) {
+	issuer := strings.TrimSuffix(provider.Issuer, "/")
+	if metadata, ok := s.metadataCache.Get(issuer); ok {
+		return metadata, nil
+	}
+	var metadata models.OpenIDProviderMetadata
+	err := s.getJSON(issuer+"/.well-known/openid-configuration", &metadata)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(metadata.Issuer, "/") != issuer {
+		return nil, errors.New("the discovered issuer does not match the configured one")
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JwksURI == "" {
+		return nil, errors.New("the provider configuration is incomplete")
+	}
+	s.metadataCache.Set(issuer, &metadata)
+	return &metadata, nil
+}
+
+func (s *OIDCFederationService) fetchKeySet(jwksURI string) (*models.JSONWebKeySet, error) {
+	var keySet models.JSONWebKeySet
+	err := s.getJSON(jwksURI, &keySet)
+	if err != nil {
+		return nil, err
+	}
+	s.keySetCache.Set(jwksURI, &keySet)
+	return &keySet, nil
+}
+
+func (s *OIDCFederationService) getJSON(uri string, target interface{}) error {
+	response, err := s.httpClient.Get(uri)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching %s returned status %d", uri, response.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(target)
+}
+
+// idTokenProfile returns what the ID token asserts about the user. The email
+// is read from the provider's email claim, "email" by default.
+func idTokenProfile(provider *models.IdentityProvider, token *models.SignedToken) *models.ExternalProfile {
+	emailClaim := provider.EmailClaim
+	if emailClaim == "" {
+		emailClaim = "email"
+	}
+	attributes := make(map[string][]string)
+	for name, value := range token.Claims {
+		if values := claimStrings(value); len(values) > 0 {
+			attributes[name] = values
+		}
+	}
+	verified := attributes["email_verified"]
+	return &models.ExternalProfile{
+		Subject:       token.ClaimString("sub"),
+		Email:         token.ClaimString(emailClaim),
+		EmailVerified: len(verified) == 1 && verified[0] == "true",
+		Username:      token.ClaimString("preferred_username"),
+		Attributes:    attributes,
+	}
+}
+
+// claimStrings returns the claim value as a list of strings. Objects are left out.
+func claimStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case bool:
+		return []string{strconv.FormatBool(v)}
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			values = append(values, claimStrings(item)...)
+		}
+		return values
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"auth-server/cache"
+	"auth-server/models"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testProvider is an OpenID Connect provider answering token requests with
+// the ID token idToken returns.
+type testProvider struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	metadata models.OpenIDProviderMetadata
+	idToken  func(issuer string) string
+	requests map[string]int
+}
+
+func newTestOIDCProvider(t *testing.T) *testProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testProvider{key: key, requests: map[string]int{}}
+	p.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.requests[r.URL.Path]++
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(p.metadata)
+		case "/jwks":
+			json.NewEncoder(w).Encode(models.JSONWebKeySet{Keys: []*models.JSONWebKey{rsaJWK("key", &p.key.PublicKey)}})
+		case "/token":
+			clientId, secret, ok := r.BasicAuth()
+			if !ok || clientId != "client" || secret != "secret" || r.FormValue("code") != "code" {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(tokenResponse{Error: "invalid_grant"})
+				return
+			}
+			json.NewEncoder(w).Encode(tokenResponse{AccessToken: "access", IDToken: p.idToken(p.server.URL)})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(p.server.Close)
+	p.metadata = models.OpenIDProviderMetadata{
+		Issuer:                p.server.URL,
+		AuthorizationEndpoint: p.server.URL + "/authorize",
+		TokenEndpoint:         p.server.URL + "/token",
+		JwksURI:               p.server.URL + "/jwks",
+	}
+	return p
+}
+
+func (p *testProvider) identityProvider() *models.IdentityProvider {
+	provider := newTestProvider()
+	provider.Issuer = p.server.URL
+	provider.ClientID = "client"
+	provider.ClientSecret = "secret"
+	return provider
+}
+
+func newTestOIDCFederationService(p *testProvider) *OIDCFederationService {
+	return NewOIDCFederationService(p.server.Client(), cache.NewCache[*models.OpenIDProviderMetadata](time.Hour), cache.NewCache[*models.JSONWebKeySet](time.Hour))
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) *models.JSONWebKey {
+	return &models.JSONWebKey{
+		Kty: "RSA",
+		Kid: kid,
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+// signRS256 returns the claims signed with the key as a compact JWS.
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	encode := func(value interface{}) string {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(encoded)
+	}
+	message := encode(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid}) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(message))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return message + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestProviderMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata func(m *models.OpenIDProviderMetadata)
+		valid    bool
+	}{
+		{"valid", func(m *models.OpenIDProviderMetadata) {}, true},
+		{"issuer with a trailing slash", func(m *models.OpenIDProviderMetadata) { m.Issuer += "/" }, true},
+		{"other issuer", func(m *models.OpenIDProviderMetadata) { m.Issuer = "https://evil.example.com" }, false},
+		{"missing authorization endpoint", func(m *models.OpenIDProviderMetadata) { m.AuthorizationEndpoint = "" }, false},
+		{"missing token endpoint", func(m *models.OpenIDProviderMetadata) { m.TokenEndpoint = "" }, false},
+		{"missing jwks_uri", func(m *models.OpenIDProviderMetadata) { m.JwksURI = "" }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestOIDCProvider(t)
+			tt.metadata(&p.metadata)
+			service := newTestOIDCFederationService(p)
+
+			metadata, err := service.providerMetadata(p.identityProvider())
+			if !tt.valid {
+				if err == nil {
+					t.Fatal("expected the configuration to be rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if metadata.TokenEndpoint != p.metadata.TokenEndpoint {
+				t.Fatalf("token endpoint = %q, want %q", metadata.TokenEndpoint, p.metadata.TokenEndpoint)
+			}
+			_, err = service.providerMetadata(p.identityProvider())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if n := p.requests["/.well-known/openid-configuration"]; n != 1 {
+				t.Fatalf("configuration fetched %d times, want once", n)
+			}
+		})
+	}
+}
+
+func TestProviderMetadataUnavailable(t *testing.T) {
+	p := newTestOIDCProvider(t)
+	provider := p.identityProvider()
+	provider.Issuer = p.server.URL + "/missing"
+	_, err := newTestOIDCFederationService(p).providerMetadata(provider)
+	if err == nil {
+		t.Fatal("expected the missing configuration to be an error")
+	}
+}
+
+func TestExchange(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	login := &models.FederatedLogin{Nonce: "nonce", CodeVerifier: "verifier"}
+	tests := []struct {
+		name   string
+		code   string
+		key    *rsa.PrivateKey
+		claims func(issuer string, claims map[string]interface{})
+		valid  bool
+	}{
+		{"valid", "code", nil, func(string, map[string]interface{}) {}, true},
+		{"audience list with azp", "code", nil, func(_ string, c map[string]interface{}) {
+			c["aud"] = []string{"client", "other"}
+			c["azp"] = "client"
+		}, true},
+		{"rejected code", "wrong", nil, func(string, map[string]interface{}) {}, false},
+		{"signed with another key", "code", otherKey, func(string, map[string]interface{}) {}, false},
+		{"other issuer", "code", nil, func(_ string, c map[string]interface{}) { c["iss"] = "https://evil.example.com" }, false},
+		{"other audience", "code", nil, func(_ string, c map[string]interface{}) { c["aud"] = "other" }, false},
+		{"audience list without azp", "code", nil, func(_ string, c map[string]interface{}) { c["aud"] = []string{"client", "other"} }, false},
+		{"issued to another party", "code", nil, func(_ string, c map[string]interface{}) { c["azp"] = "other" }, false},
+		{"expired", "code", nil, func(_ string, c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, false},
+		{"missing exp", "code", nil, func(_ string, c map[string]interface{}) { delete(c, "exp") }, false},
+		{"missing subject", "code", nil, func(_ string, c map[string]interface{}) { delete(c, "sub") }, false},
+		{"other nonce", "code", nil, func(_ string, c map[string]interface{}) { c["nonce"] = "other" }, false},
+		{"missing nonce", "code", nil, func(_ string, c map[string]interface{}) { delete(c, "nonce") }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestOIDCProvider(t)
+			key := tt.key
+			if key == nil {
+				key = p.key
+			}
+			p.idToken = func(issuer string) string {
+				claims := map[string]interface{}{
+					"iss":            issuer,
+					"sub":            "subject",
+					"aud":            "client",
+					"exp":            time.Now().Add(time.Minute).Unix(),
+					"nonce":          "nonce",
+					"email":          "alice@example.com",
+					"email_verified": true,
+				}
+				tt.claims(issuer, claims)
+				return signRS256(t, key, "key", claims)
+			}
+
+			profile, err := newTestOIDCFederationService(p).Exchange(p.identityProvider(), login, tt.code, "https://auth.example.com/callback")
+			if !tt.valid {
+				if err == nil {
+					t.Fatal("expected the ID token to be rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if profile.Subject != "subject" || profile.Email != "alice@example.com" || !profile.EmailVerified {
+				t.Fatalf("unexpected profile %+v", profile)
+			}
+		})
+	}
+}
+
+func TestExchangeRefetchesRotatedKeys(t *testing.T) {
+	p := newTestOIDCProvider(t)
+	p.idToken = func(issuer string) string {
+		return signRS256(t, p.key, "key", map[string]interface{}{
+			"iss": issuer, "sub": "subject", "aud": "client", "nonce": "nonce",
+			"exp": time.Now().Add(time.Minute).Unix(),
+		})
+	}
+	service := newTestOIDCFederationService(p)
+	staleKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.keySetCache.Set(p.metadata.JwksURI, &models.JSONWebKeySet{Keys: []*models.JSONWebKey{rsaJWK("key", &staleKey.PublicKey)}})
+
+	_, err = service.Exchange(p.identityProvider(), &models.FederatedLogin{Nonce: "nonce"}, "code", "https://auth.example.com/callback")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := p.requests["/jwks"]; n != 1 {
+		t.Fatalf("keys fetched %d times, want once", n)
+	}
+}
+
+func TestAuthenticationRequestURI(t *testing.T) {
+	p := newTestOIDCProvider(t)
+	provider := p.identityProvider()
+	login, state, err := models.NewFederatedLogin(provider, "/", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri, err := newTestOIDCFederationService(p).AuthenticationRequestURI(provider, login, state, "https://auth.example.com/callback")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, parameter := range []string{"state=" + state, "nonce=" + login.Nonce, "code_challenge=" + login.CodeChallenge(), "code_challenge_method=S256", "client_id=client"} {
+		if !strings.Contains(uri, parameter) {
+			t.Fatalf("%s does not carry %s", uri, parameter)
+		}
+	}
+}
@@ -5,8 +5,6 @@ import (
 	"auth-server/models"
 	"auth-server/repository"
 	"context"
-
-	"github.com/google/uuid"
 )
 
 type Permissionservice struct {
@@ -25,16 +23,17 @@ func (s *Permissionservice) GetAll() ([]*models.PermissionDto, error) {
 	return mapper.PermissionsToPermissionDtos(permissions), nil
 }
 
-func (s *Permissionservice) CreatePermission(permission *models.PermissionRequest) (*models.PermissionDto, error) {
-	roleId, err := uuid.Parse(permission.RoleID)
-	if err != nil {
-		return nil, err
-	}
+func (s *Permissionservice) GetPermissionById(id string) (*models.Permission, error) {
+	return s.repo.FindById(context.Background(), id)
+}
+
+// CreatePermission creates a new permission granted by the provided roles.
+func (s *Permissionservice) CreatePermission(permission *models.PermissionRequest, roles []*models.Role) (*models.PermissionDto, error) {
 	permissionModel := &models.Permission{
-		Name:   permission.Name,
-		RoleID: roleId,
+		Name:  permission.Name,
+		Roles: roles,
 	}
-	permissionModel, err = s.repo.Save(context.Background(), permissionModel)
+	permissionModel, err := s.repo.Save(context.Background(), permissionModel)
 	if err != nil {
 		return nil, err
 	}
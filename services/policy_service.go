@@ -0,0 +1,120 @@
+package services
+
+import (
+	"auth-server/mapper"
+	"auth-server/models"
+	"auth-server/repository"
+	"context"
+
+	"github.com/google/uuid"
+)
+
+type PolicyService struct {
+	repo *repository.PolicyRepository
+}
+
+// NewPolicyService creates a new instance of PolicyService with the provided PolicyRepository.
+func NewPolicyService(repo *repository.PolicyRepository) *PolicyService {
+	return &PolicyService{repo: repo}
+}
+
+func (s *PolicyService) GetAll() ([]*models.PolicyDto, error) {
+	policies, err := s.repo.FindAll(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return mapper.PoliciesToPolicyDtos(policies), nil
+}
+
+func (s *PolicyService) GetPolicyById(id string) (*models.Policy, error) {
+	policyId, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.FindById(context.Background(), policyId.String())
+}
+
+// CreatePolicy creates a new policy for the provided application.
+func (s *PolicyService) CreatePolicy(data *models.PolicyRequest, app *models.ApplicationDto) (*models.PolicyDto, error) {
+	appId, err := uuid.Parse(app.ID)
+	if err != nil {
+		return nil, err
+	}
+	policy := &models.Policy{
+		BaseUUIDEntity: models.BaseUUIDEntity{
+			ID: uuid.New(),
+		},
+		Name:          data.Name,
+		Description:   data.Description,
+		ApplicationID: appId,
+		Effect:        data.Effect,
+		Resource:      data.Resource,
+		Action:        data.Action,
+		Conditions:    data.Conditions,
+	}
+	err = policy.Validate()
+	if err != nil {
+		return nil, err
+	}
+	policy, err = s.repo.Save(context.Background(), policy)
+	if err != nil {
+		return nil, err
+	}
+	return mapper.PolicyToPolicyDto(policy), nil
+}
+
+func (s *PolicyService) DeletePolicy(policy *models.Policy) error {
+	return s.repo.Delete(context.Background(), policy.ID.String())
+}
+
+// Decide evaluates whether the subject may perform the action on the resource.
+// Policies of the subject's application are evaluated first, and any matching
+// deny policy overrides everything else. Otherwise, the request is allowed by
+// the first matching allow policy, or by a permission of the subject granting
+// the action on the resource. Requests matching no rule are denied, and so are
+// the requests of inactive users.
+func (s *PolicyService) Decide(subject *models.AuthorizationSubject, resource string, action string, requestContext map[string]interface{}) (*models.AuthorizationDecision, error) {
+	if subject.Inactive {
+		decision := newDecision(false, "account", "", "inactive-account")
+		decision.Reason = "user account is not active"
+		return decision, nil
+	}
+	policies, err := s.repo.FindByApplicationId(context.Background(), subject.ApplicationID)
+	if err != nil {
+		return nil, err
+	}
+	attributes := models.NewAuthorizationAttributes(subject, resource, action, requestContext)
+
+	for _, policy := range policies {
+		if policy.Effect == models.POLICY_EFFECT_DENY && policy.Matches(attributes) {
+			return newDecision(false, "policy", policy.ID.String(), policy.Name), nil
+		}
+	}
+	for _, policy := range policies {
+		if policy.Effect == models.POLICY_EFFECT_ALLOW && policy.Matches(attributes) {
+			return newDecision(true, "policy", policy.ID.String(), policy.Name), nil
+		}
+	}
+	for _, permission := range subject.Permissions {
+		if models.PermissionGrants(permission, resource, action) {
+			return newDecision(true, "permission", "", permission), nil
+		}
+	}
+	return newDecision(false, "default", "", "deny-by-default"), nil
+}
+
+func newDecision(allowed bool, ruleType string, id string, name string) *models.AuthorizationDecision {
+	decision := models.POLICY_EFFECT_DENY
+	if allowed {
+		decision = models.POLICY_EFFECT_ALLOW
+	}
+	return &models.AuthorizationDecision{
+		Decision: decision,
+		Allowed:  allowed,
+		Rule: &models.AuthorizationRule{
+			Type: ruleType,
+			ID:   id,
+			Name: name,
+		},
+	}
+}
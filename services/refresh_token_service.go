@@ -0,0 +1,79 @@
+package services
+
+import (
+	"auth-server/models"
+	"auth-server/repository"
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned when a refresh token is unknown,
+	// expired, revoked, or used by another client.
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrInvalidScope is returned when a refresh request asks for scopes the
+	// refresh token was not issued with.
+	ErrInvalidScope = errors.New("the requested scope exceeds the scope granted")
+)
+
+type RefreshTokenService struct {
+	repo *repository.RefreshTokenRepository
+}
+
+// NewRefreshTokenService creates a new instance of RefreshTokenService with the provided RefreshTokenRepository.
+func NewRefreshTokenService(repo *repository.RefreshTokenRepository) *RefreshTokenService {
+	return &RefreshTokenService{repo: repo}
+}
+
+// IssueToken issues a refresh token to the client on behalf of the user, for
+// the application and scope. It returns the token, which is not stored in clear.
+func (s *RefreshTokenService) IssueToken(client *models.Client, applicationId uuid.UUID, userId uuid.UUID, scope string) (string, error) {
+	refreshToken, token, err := models.NewRefreshToken(client.ID, applicationId, userId, scope, client.RefreshTokenTTL())
+	if err != nil {
+		return "", err
+	}
+	_, err = s.repo.Save(context.Background(), refreshToken)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Rotate redeems the refresh token on behalf of the client and replaces it by
+// a new one with the same scope. The requested scope, if any, must be covered
+// by the scope of the token. It returns the redeemed token, along with the one
+// replacing it.
+func (s *RefreshTokenService) Rotate(token string, client *models.Client, scope string) (*models.RefreshToken, string, error) {
+	ctx := context.Background()
+	refreshToken, err := s.repo.FindByToken(ctx, token)
+	if err != nil {
+		return nil, "", err
+	}
+	if refreshToken == nil || refreshToken.ClientID != client.ID || !refreshToken.IsActive() {
+		return nil, "", ErrInvalidRefreshToken
+	}
+	granted := strings.Fields(refreshToken.Scope)
+	for _, requested := range strings.Fields(scope) {
+		if !models.StringList(granted).Contains(requested) {
+			return nil, "", ErrInvalidScope
+		}
+	}
+
+	replacement, replacementToken, err := models.NewRefreshToken(
+		client.ID, refreshToken.ApplicationID, refreshToken.UserID, refreshToken.Scope, client.RefreshTokenTTL(),
+	)
+	if err != nil {
+		return nil, "", err
+	}
+	rotated, err := s.repo.Rotate(ctx, refreshToken, replacement)
+	if err != nil {
+		return nil, "", err
+	}
+	if !rotated {
+		return nil, "", ErrInvalidRefreshToken
+	}
+	return refreshToken, replacementToken, nil
+}
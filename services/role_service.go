@@ -5,18 +5,39 @@ import (
 	"auth-server/models"
 	"auth-server/repository"
 	"context"
+	"errors"
 
 	"github.com/google/uuid"
 )
 
+// roleStore is the part of RoleRepository that RoleService uses.
+type roleStore interface {
+	FindAll(ctx context.Context) ([]*models.Role, error)
+	FindById(ctx context.Context, id string) (*models.Role, error)
+	FindByIds(ctx context.Context, ids []uuid.UUID) ([]*models.Role, error)
+	Save(ctx context.Context, entity interface{}) (*models.Role, error)
+	AddComposites(ctx context.Context, role *models.Role, composites []*models.Role) error
+	AssignComposites(ctx context.Context, role *models.Role, composites []*models.Role) error
+	AddPermissions(ctx context.Context, role *models.Role, permissions []*models.Permission) error
+	AssignPermissions(ctx context.Context, role *models.Role, permissions []*models.Permission) error
+}
+
 type RoleService struct {
-	repo *repository.RoleRepository
+	repo   roleStore
+	events EventPublisher
 }
 
 func NewRoleService(repo *repository.RoleRepository) *RoleService {
 	return &RoleService{repo: repo}
 }
 
+// WithEvents makes the service publish the creation of roles and the changes
+// of their composites and permissions with events.
+func (s *RoleService) WithEvents(events EventPublisher) *RoleService {
+	s.events = events
+	return s
+}
+
 func (s *RoleService) GetAll() ([]*models.RoleDto, error) {
 	roles, err := s.repo.FindAll(context.Background())
 	if err != nil {
@@ -65,5 +86,154 @@ func (s *RoleService) CreateRole(role *models.RoleRequest, app *models.Applicati
 	if err != nil {
 		return nil, err
 	}
+	publish(s.events, models.WEBHOOK_EVENT_ROLE_CREATED, mapper.RoleToRoleEvent(roleModel))
 	return mapper.RoleToRoleDto(roleModel), nil
 }
+
+// GetEffectiveRoles returns the given roles together with every role they
+// include, directly or through other composite roles, restricted to the
+// roles belonging to the application.
+func (s *RoleService) GetEffectiveRoles(roles []*models.Role, applicationId string) ([]*models.Role, error) {
+	appId, err := uuid.Parse(applicationId)
+	if err != nil {
+		return nil, err
+	}
+	expanded, err := s.expandRoles(roles)
+	if err != nil {
+		return nil, err
+	}
+	effective := make([]*models.Role, 0)
+	for _, role := range expanded {
+		if role.ApplicationID == appId {
+			effective = append(effective, role)
+		}
+	}
+	return effective, nil
+}
+
+// GetEffectivePermissions returns the permissions a user holding the given
+// roles has in the application, including the ones inherited through
+// composite roles.
+func (s *RoleService) GetEffectivePermissions(roles []*models.Role, applicationId string) ([]*models.PermissionDto, error) {
+	roles, err := s.GetEffectiveRoles(roles, applicationId)
+	if err != nil {
+		return nil, err
+	}
+	return mapper.PermissionsToPermissionDtos(models.CollectPermissions(roles)), nil
+}
+
+// AssignCompositesToRole replaces the roles included by the role.
+func (s *RoleService) AssignCompositesToRole(role *models.Role, composites []*models.Role) (*models.RoleDto, error) {
+	err := s.checkCompositeCycles(role, composites)
+	if err != nil {
+		return nil, err
+	}
+	err = s.repo.AssignComposites(context.Background(), role, composites)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := s.roleUpdated(role.ID.String())
+	if err != nil {
+		return nil, err
+	}
+	return mapper.RoleToRoleDto(updated), nil
+}
+
+// AddCompositesToRole adds the composites to the roles included by the role.
+func (s *RoleService) AddCompositesToRole(role *models.Role, composites []*models.Role) (*models.RoleDto, error) {
+	err := s.checkCompositeCycles(role, composites)
+	if err != nil {
+		return nil, err
+	}
+	err = s.repo.AddComposites(context.Background(), role, composites)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := s.roleUpdated(role.ID.String())
+	if err != nil {
+		return nil, err
+	}
+	return mapper.RoleToRoleDto(updated), nil
+}
+
+func (s *RoleService) AssignPermissionsToRole(role *models.Role, permissions []*models.Permission) ([]*models.PermissionDto, error) {
+	err := s.repo.AssignPermissions(context.Background(), role, permissions)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := s.roleUpdated(role.ID.String())
+	if err != nil {
+		return nil, err
+	}
+	return mapper.PermissionsToPermissionDtos(updated.Permissions), nil
+}
+
+func (s *RoleService) AddPermissionsToRole(role *models.Role, permissions []*models.Permission) ([]*models.PermissionDto, error) {
+	err := s.repo.AddPermissions(context.Background(), role, permissions)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := s.roleUpdated(role.ID.String())
+	if err != nil {
+		return nil, err
+	}
+	return mapper.PermissionsToPermissionDtos(updated.Permissions), nil
+}
+
+// roleUpdated returns the role as stored after an update, and publishes the
+// update.
+func (s *RoleService) roleUpdated(id string) (*models.Role, error) {
+	role, err := s.repo.FindById(context.Background(), id)
+	if err != nil {
+		return nil, err
+	}
+	publish(s.events, models.WEBHOOK_EVENT_ROLE_UPDATED, mapper.RoleToRoleEvent(role))
+	return role, nil
+}
+
+// checkCompositeCycles returns an error if including any of the composites
+// in the role would make the role include itself.
+func (s *RoleService) checkCompositeCycles(role *models.Role, composites []*models.Role) error {
+	expanded, err := s.expandRoles(composites)
+	if err != nil {
+		return err
+	}
+	for _, composite := range expanded {
+		if composite.ID == role.ID {
+			return errors.New("composite roles cannot include themselves")
+		}
+	}
+	return nil
+}
+
+// expandRoles walks the composite roles graph breadth-first and returns
+// every role reachable from the given ones, each one exactly once, with
+// their permissions loaded.
+func (s *RoleService) expandRoles(roles []*models.Role) ([]*models.Role, error) {
+	expanded := make([]*models.Role, 0)
+	seen := make(map[uuid.UUID]bool)
+	var frontier []uuid.UUID
+	for _, role := range roles {
+		if !seen[role.ID] {
+			seen[role.ID] = true
+			frontier = append(frontier, role.ID)
+		}
+	}
+	for len(frontier) > 0 {
+		loaded, err := s.repo.FindByIds(context.Background(), frontier)
+		if err != nil {
+			return nil, err
+		}
+		frontier = nil
+		for _, role := range loaded {
+			expanded = append(expanded, role)
+			for _, composite := range role.Composites {
+				if !seen[composite.ID] {
+					seen[composite.ID] = true
+					frontier = append(frontier, composite.ID)
+				}
+			}
+		}
+	}
+	return expanded, nil
+}
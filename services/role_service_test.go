@@ -0,0 +1,146 @@
+package services
+
+import (
+	"auth-server/models"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// newRoleGraph returns roles of the application, where admin includes editor
+// and auditor, both of which include viewer, and viewer includes a role of
+// another application.
+func newRoleGraph(appId uuid.UUID) (fakeRoleStore, map[string]*models.Role) {
+	var permissionId uint
+	newRole := func(name string, appId uuid.UUID, permissions ...string) *models.Role {
+		role := &models.Role{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, Name: name, ApplicationID: appId}
+		for _, permission := range permissions {
+			permissionId++
+			role.Permissions = append(role.Permissions, &models.Permission{Model: gorm.Model{ID: permissionId}, Name: permission})
+		}
+		return role
+	}
+	roles := map[string]*models.Role{
+		"admin":   newRole("admin", appId, "users:delete"),
+		"editor":  newRole("editor", appId, "documents:write"),
+		"auditor": newRole("auditor", appId, "logs:read"),
+		"viewer":  newRole("viewer", appId, "documents:read"),
+		"other":   newRole("other", uuid.New(), "other:read"),
+		"guest":   newRole("guest", appId),
+	}
+	roles["admin"].Composites = []*models.Role{roles["editor"], roles["auditor"]}
+	roles["editor"].Composites = []*models.Role{roles["viewer"]}
+	roles["auditor"].Composites = []*models.Role{roles["viewer"]}
+	roles["viewer"].Composites = []*models.Role{roles["other"]}
+	store := fakeRoleStore{}
+	for _, role := range roles {
+		store[role.ID] = role
+	}
+	return store, roles
+}
+
+func roleNames(roles []*models.Role) []string {
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestExpandRoles(t *testing.T) {
+	appId := uuid.New()
+	store, roles := newRoleGraph(appId)
+	service := &RoleService{repo: store}
+
+	tests := []struct {
+		name  string
+		roles []string
+		want  []string
+	}{
+		{"role without composites", []string{"guest"}, []string{"guest"}},
+		{"nested composites are included once", []string{"admin"}, []string{"admin", "auditor", "editor", "other", "viewer"}},
+		{"overlapping roles", []string{"editor", "viewer", "editor"}, []string{"editor", "other", "viewer"}},
+		{"no roles", nil, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var given []*models.Role
+			for _, name := range tt.roles {
+				given = append(given, roles[name])
+			}
+			expanded, err := service.expandRoles(given)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := roleNames(expanded); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expanded = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetEffectivePermissions(t *testing.T) {
+	appId := uuid.New()
+	store, roles := newRoleGraph(appId)
+	service := &RoleService{repo: store}
+
+	permissions, err := service.GetEffectivePermissions([]*models.Role{roles["editor"]}, appId.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, permission := range permissions {
+		names = append(names, permission.Name)
+	}
+	sort.Strings(names)
+	// The role of the other application is included, but not its permissions.
+	want := []string{"documents:read", "documents:write"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("permissions = %v, want %v", names, want)
+	}
+}
+
+func TestCheckCompositeCycles(t *testing.T) {
+	tests := []struct {
+		name       string
+		role       string
+		composites []string
+		valid      bool
+	}{
+		{"role without composites", "guest", []string{"viewer"}, true},
+		{"role already included elsewhere", "admin", []string{"viewer"}, true},
+		{"role including itself", "viewer", []string{"viewer"}, false},
+		{"role included by the composite", "viewer", []string{"editor"}, false},
+		{"role included deeper in the composite", "viewer", []string{"guest", "admin"}, false},
+		{"role of another application included by the role", "other", []string{"admin"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, roles := newRoleGraph(uuid.New())
+			service := &RoleService{repo: store}
+			var composites []*models.Role
+			for _, name := range tt.composites {
+				composites = append(composites, roles[name])
+			}
+			before := roleNames(roles[tt.role].Composites)
+
+			_, err := service.AddCompositesToRole(roles[tt.role], composites)
+			if tt.valid && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.valid {
+				return
+			}
+			if err == nil {
+				t.Fatal("the cycle was not detected")
+			}
+			if after := roleNames(roles[tt.role].Composites); !reflect.DeepEqual(after, before) {
+				t.Errorf("composites = %v, want %v", after, before)
+			}
+		})
+	}
+}
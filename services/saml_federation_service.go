@@ -0,0 +1,213 @@
+package services
+
+import (
+	"auth-server/cache"
+	"auth-server/models"
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/crewjam/saml"
+)
+
+// samlEmailAttributes are the attributes the email is read from when the
+// identity provider is configured without an email claim.
+var samlEmailAttributes = []string{"email", "mail", "urn:oid:0.9.2342.19200300.100.1.3"}
+
+// samlUsernameAttributes are the attributes the username is read from.
+var samlUsernameAttributes = []string{"username", "uid", "urn:oid:0.9.2342.19200300.100.1.1"}
+
+type SAMLFederationService struct {
+	httpClient    *http.Client
+	metadataCache *cache.Cache[*saml.EntityDescriptor]
+	key           *rsa.PrivateKey
+	certificate   *x509.Certificate
+}
+
+// NewSAMLFederationService creates a new instance of SAMLFederationService.
+// The metadata fetched from identity providers is kept in metadataCache. The
+// key and certificate, if any, are published in the service provider metadata
+// for identity providers to encrypt assertions with.
+func NewSAMLFederationService(httpClient *http.Client, metadataCache *cache.Cache[*saml.EntityDescriptor], key *rsa.PrivateKey, certificate *x509.Certificate) *SAMLFederationService {
+	return &SAMLFederationService{
+		httpClient:    httpClient,
+		metadataCache: metadataCache,
+		key:           key,
+		certificate:   certificate,
+	}
+}
+
+// ServiceProvider returns the service provider the server acts as towards the
+// identity provider. Its entity id is the URI of its metadata.
+func (s *SAMLFederationService) ServiceProvider(provider *models.IdentityProvider, metadataURI string, acsURI string) (*saml.ServiceProvider, error) {
+	idpMetadata, err := s.identityProviderMetadata(provider)
+	if err != nil {
+		return nil, err
+	}
+	metadataURL, err := url.Parse(metadataURI)
+	if err != nil {
+		return nil, err
+	}
+	acsURL, err := url.Parse(acsURI)
+	if err != nil {
+		return nil, err
+	}
+	sp := &saml.ServiceProvider{
+		EntityID:          metadataURI,
+		MetadataURL:       *metadataURL,
+		AcsURL:            *acsURL,
+		IDPMetadata:       idpMetadata,
+		AuthnNameIDFormat: saml.PersistentNameIDFormat,
+		HTTPClient:        s.httpClient,
+	}
+	if s.key != nil && s.certificate != nil {
+		sp.Key = s.key
+		sp.Certificate = s.certificate
+	}
+	return sp, nil
+}
+
+// AuthenticationRequestURI returns the URI of the identity provider's single
+// sign-on service the user is sent to, carrying an authentication request
+// with the HTTP-Redirect binding. The login remembers the request id, which
+// the response must refer to.
+func (s *SAMLFederationService) AuthenticationRequestURI(sp *saml.ServiceProvider, login *models.FederatedLogin, state string) (string, error) {
+	location := sp.GetSSOBindingLocation(saml.HTTPRedirectBinding)
+	if location == "" {
+		return "", errors.New("the identity provider does not support the HTTP-Redirect binding")
+	}
+	request, err := sp.MakeAuthenticationRequest(location, saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return "", err
+	}
+	redirect, err := request.Redirect(state, sp)
+	if err != nil {
+		return "", err
+	}
+	login.RequestID = request.ID
+	return redirect.String(), nil
+}
+
+// ParseResponse validates the response the identity provider posted to the
+// assertion consumer service in reply to the login's request, and returns
+// what its assertion says about the user.
+func (s *SAMLFederationService) ParseResponse(provider *models.IdentityProvider, sp *saml.ServiceProvider, login *models.FederatedLogin, r *http.Request) (*models.ExternalProfile, error) {
+	assertion, err := sp.ParseResponse(r, []string{login.RequestID})
+	if err != nil {
+		var invalid *saml.InvalidResponseError
+		if errors.As(err, &invalid) && invalid.PrivateErr != nil {
+			return nil, fmt.Errorf("invalid SAML response: %w", invalid.PrivateErr)
+		}
+		return nil, err
+	}
+	if assertion.Subject == nil || assertion.Subject.NameID == nil || assertion.Subject.NameID.Value == "" {
+		return nil, errors.New("the assertion has no subject")
+	}
+	return assertionProfile(provider, assertion), nil
+}
+
+// identityProviderMetadata returns the metadata of the identity provider,
+// either configured inline or fetched from its metadata URL.
+func (s *SAMLFederationService) identityProviderMetadata(provider *models.IdentityProvider) (*saml.EntityDescriptor, error) {
+	if provider.Metadata != "" {
+		return parseSAMLMetadata([]byte(provider.Metadata))
+	}
+	if metadata, ok := s.metadataCache.Get(provider.MetadataURL); ok {
+		return metadata, nil
+	}
+	response, err := s.httpClient.Get(provider.MetadataURL)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching metadata_url returned status %d", response.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := parseSAMLMetadata(data)
+	if err != nil {
+		return nil, err
+	}
+	s.metadataCache.Set(provider.MetadataURL, metadata)
+	return metadata, nil
+}
+
+// parseSAMLMetadata parses the metadata of an identity provider. Metadata
+// documents describing several entities are searched for the first one
+// holding an identity provider descriptor.
+func parseSAMLMetadata(data []byte) (*saml.EntityDescriptor, error) {
+	var entity saml.EntityDescriptor
+	err := xml.Unmarshal(data, &entity)
+	if err == nil {
+		if len(entity.IDPSSODescriptors) == 0 {
+			return nil, errors.New("the metadata does not describe an identity provider")
+		}
+		return &entity, nil
+	}
+	var entities saml.EntitiesDescriptor
+	if xml.NewDecoder(bytes.NewReader(data)).Decode(&entities) != nil {
+		return nil, fmt.Errorf("invalid SAML metadata: %w", err)
+	}
+	for i, candidate := range entities.EntityDescriptors {
+		if len(candidate.IDPSSODescriptors) > 0 {
+			return &entities.EntityDescriptors[i], nil
+		}
+	}
+	return nil, errors.New("the metadata does not describe an identity provider")
+}
+
+// assertionProfile returns what the assertion says about the user. Attributes
+// are available under both their name and friendly name. SAML has no notion
+// of a verified email: the email an identity provider asserts is trusted.
+func assertionProfile(provider *models.IdentityProvider, assertion *saml.Assertion) *models.ExternalProfile {
+	attributes := make(map[string][]string)
+	for _, statement := range assertion.AttributeStatements {
+		for _, attribute := range statement.Attributes {
+			var values []string
+			for _, value := range attribute.Values {
+				values = append(values, value.Value)
+			}
+			attributes[attribute.Name] = append(attributes[attribute.Name], values...)
+			if attribute.FriendlyName != "" && attribute.FriendlyName != attribute.Name {
+				attributes[attribute.FriendlyName] = append(attributes[attribute.FriendlyName], values...)
+			}
+		}
+	}
+	emailAttributes := samlEmailAttributes
+	if provider.EmailClaim != "" {
+		emailAttributes = []string{provider.EmailClaim}
+	}
+	nameID := assertion.Subject.NameID
+	profile := &models.ExternalProfile{
+		Subject:       nameID.Value,
+		Email:         firstAttribute(attributes, emailAttributes),
+		EmailVerified: true,
+		Username:      firstAttribute(attributes, samlUsernameAttributes),
+		Attributes:    attributes,
+	}
+	if profile.Email == "" && nameID.Format == string(saml.EmailAddressNameIDFormat) {
+		profile.Email = nameID.Value
+	}
+	return profile
+}
+
+func firstAttribute(attributes map[string][]string, names []string) string {
+	for _, name := range names {
+		for _, value := range attributes[name] {
+			if value = strings.TrimSpace(value); value != "" {
+				return value
+			}
+		}
+	}
+	return ""
+}
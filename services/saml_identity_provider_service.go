@@ -0,0 +1,259 @@
+package services
+
+import (
+	"auth-server/models"
+	"auth-server/repository"
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/crewjam/saml"
+)
+
+// SAML_SIGNATURE_METHOD is the algorithm assertions and responses are signed
+// with. The library defaults to RSA-SHA1, which service providers increasingly
+// reject.
+const SAML_SIGNATURE_METHOD string = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+
+// samlNameIDFormats maps the name identifier formats service providers are
+// configured with to their SAML identifiers.
+var samlNameIDFormats = map[string]saml.NameIDFormat{
+	models.SAML_NAMEID_FORMAT_PERSISTENT:  saml.PersistentNameIDFormat,
+	models.SAML_NAMEID_FORMAT_TRANSIENT:   saml.TransientNameIDFormat,
+	models.SAML_NAMEID_FORMAT_EMAIL:       saml.EmailAddressNameIDFormat,
+	models.SAML_NAMEID_FORMAT_UNSPECIFIED: saml.UnspecifiedNameIDFormat,
+}
+
+// ErrSAMLServiceProviderNotFound is returned when an authentication request
+// comes from a service provider that is not registered, or is disabled.
+var ErrSAMLServiceProviderNotFound = errors.New("SAML service provider not found")
+
+type SAMLIdentityProviderService struct {
+	repo        *repository.SAMLServiceProviderRepository
+	userRepo    *repository.UserRepository
+	roleRepo    *repository.RoleRepository
+	key         *rsa.PrivateKey
+	certificate *x509.Certificate
+}
+
+// NewSAMLIdentityProviderService creates a new instance of
+// SAMLIdentityProviderService. Assertions are signed with the key, and
+// service providers verify them with the certificate published in the
+// identity provider metadata.
+func NewSAMLIdentityProviderService(repo *repository.SAMLServiceProviderRepository, userRepo *repository.UserRepository, roleRepo *repository.RoleRepository, key *rsa.PrivateKey, certificate *x509.Certificate) *SAMLIdentityProviderService {
+	return &SAMLIdentityProviderService{
+		repo:        repo,
+		userRepo:    userRepo,
+		roleRepo:    roleRepo,
+		key:         key,
+		certificate: certificate,
+	}
+}
+
+// IdentityProvider returns the identity provider the server acts as towards
+// the registered service providers. Its entity id is the URI of its metadata.
+func (s *SAMLIdentityProviderService) IdentityProvider(metadataURI string, ssoURI string) (*saml.IdentityProvider, error) {
+	if s.key == nil || s.certificate == nil {
+		return nil, errors.New("no SAML key pair is configured")
+	}
+	metadataURL, err := url.Parse(metadataURI)
+	if err != nil {
+		return nil, err
+	}
+	ssoURL, err := url.Parse(ssoURI)
+	if err != nil {
+		return nil, err
+	}
+	return &saml.IdentityProvider{
+		Key:                     s.key,
+		Certificate:             s.certificate,
+		MetadataURL:             *metadataURL,
+		SSOURL:                  *ssoURL,
+		ServiceProviderProvider: s,
+		SignatureMethod:         SAML_SIGNATURE_METHOD,
+	}, nil
+}
+
+// Metadata returns the metadata of the identity provider, listing every name
+// identifier format service providers can be configured with.
+func (s *SAMLIdentityProviderService) Metadata(idp *saml.IdentityProvider) *saml.EntityDescriptor {
+	metadata := idp.Metadata()
+	metadata.IDPSSODescriptors[0].NameIDFormats = []saml.NameIDFormat{
+		saml.PersistentNameIDFormat,
+		saml.TransientNameIDFormat,
+		saml.EmailAddressNameIDFormat,
+		saml.UnspecifiedNameIDFormat,
+	}
+	return metadata
+}
+
+// GetServiceProvider implements saml.ServiceProviderProvider. It returns the
+// metadata of the enabled service provider with the entity id.
+func (s *SAMLIdentityProviderService) GetServiceProvider(r *http.Request, serviceProviderID string) (*saml.EntityDescriptor, error) {
+	provider, err := s.GetServiceProviderByEntityId(serviceProviderID)
+	if errors.Is(err, ErrSAMLServiceProviderNotFound) {
+		return nil, os.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseSAMLServiceProviderMetadata([]byte(provider.Metadata))
+}
+
+// GetServiceProviderByEntityId returns the enabled service provider with the
+// entity id.
+func (s *SAMLIdentityProviderService) GetServiceProviderByEntityId(entityId string) (*models.SAMLServiceProvider, error) {
+	provider, err := s.repo.FindByEntityId(context.Background(), entityId)
+	if err != nil {
+		return nil, err
+	}
+	if provider == nil || provider.Disabled {
+		return nil, ErrSAMLServiceProviderNotFound
+	}
+	return provider, nil
+}
+
+// MakeAssertion builds the assertion answering the validated authentication
+// request, about the user logged in with the session. Its attributes are the
+// ones the service provider's attribute mappings release.
+func (s *SAMLIdentityProviderService) MakeAssertion(req *saml.IdpAuthnRequest, provider *models.SAMLServiceProvider, user *models.User, session *models.Session) error {
+	nameID, err := s.nameID(provider, user)
+	if err != nil {
+		return err
+	}
+	attributes, err := s.attributes(provider, user)
+	if err != nil {
+		return err
+	}
+	samlSession := &saml.Session{
+		ID:           session.ID.String(),
+		CreateTime:   session.AuthTime,
+		ExpireTime:   session.ExpiresAt,
+		Index:        session.ID.String(),
+		NameID:       nameID,
+		NameIDFormat: string(samlNameIDFormats[provider.NameIDFormat]),
+	}
+	err = saml.DefaultAssertionMaker{}.MakeAssertion(req, samlSession)
+	if err != nil {
+		return err
+	}
+	// The default assertion maker releases attributes of its own, based on
+	// the attributes the service provider's metadata requests.
+	req.Assertion.AttributeStatements = nil
+	if len(attributes) > 0 {
+		req.Assertion.AttributeStatements = []saml.AttributeStatement{{Attributes: attributes}}
+	}
+	return nil
+}
+
+// nameID returns the name the subject of the assertion goes by.
+func (s *SAMLIdentityProviderService) nameID(provider *models.SAMLServiceProvider, user *models.User) (string, error) {
+	switch provider.NameIDFormat {
+	case models.SAML_NAMEID_FORMAT_TRANSIENT:
+		return models.NewSAMLTransientNameID()
+	case models.SAML_NAMEID_FORMAT_EMAIL:
+		if user.Email == "" {
+			return "", errors.New("the user has no email to name them with")
+		}
+		return user.Email, nil
+	case models.SAML_NAMEID_FORMAT_UNSPECIFIED:
+		return user.Username, nil
+	default:
+		return user.ID.String(), nil
+	}
+}
+
+// attributes returns the attributes released to the service provider about
+// the user. Attributes without values are left out.
+func (s *SAMLIdentityProviderService) attributes(provider *models.SAMLServiceProvider, user *models.User) ([]saml.Attribute, error) {
+	var roles []*models.Role
+	var groups []*models.Group
+	var err error
+	for _, mapping := range provider.AttributeMappings {
+		switch mapping.Source {
+		case models.SAML_ATTRIBUTE_SOURCE_ROLES, models.SAML_ATTRIBUTE_SOURCE_PERMISSIONS:
+			if roles == nil {
+				roles, err = s.effectiveRoles(provider, user)
+			}
+		case models.SAML_ATTRIBUTE_SOURCE_GROUPS:
+			if groups == nil {
+				groups, err = s.userRepo.GetUserGroups(context.Background(), user)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	attributes := make([]saml.Attribute, 0)
+	for _, mapping := range provider.AttributeMappings {
+		var values []string
+		switch mapping.Source {
+		case models.SAML_ATTRIBUTE_SOURCE_ID:
+			values = []string{user.ID.String()}
+		case models.SAML_ATTRIBUTE_SOURCE_USERNAME:
+			values = []string{user.Username}
+		case models.SAML_ATTRIBUTE_SOURCE_EMAIL:
+			values = []string{user.Email}
+		case models.SAML_ATTRIBUTE_SOURCE_ROLES:
+			for _, role := range roles {
+				values = append(values, role.Name)
+			}
+		case models.SAML_ATTRIBUTE_SOURCE_PERMISSIONS:
+			for _, permission := range models.CollectPermissions(roles) {
+				values = append(values, permission.Name)
+			}
+		case models.SAML_ATTRIBUTE_SOURCE_GROUPS:
+			for _, group := range groups {
+				values = append(values, group.Name)
+			}
+		}
+		if attribute, ok := samlAttribute(mapping, values); ok {
+			attributes = append(attributes, attribute)
+		}
+	}
+	return attributes, nil
+}
+
+// effectiveRoles returns the roles the user holds, including the ones
+// inherited through groups and composite roles, restricted to the service
+// provider's application if it has one.
+func (s *SAMLIdentityProviderService) effectiveRoles(provider *models.SAMLServiceProvider, user *models.User) ([]*models.Role, error) {
+	roles, err := s.userRepo.GetEffectiveRoles(context.Background(), user)
+	if err != nil {
+		return nil, err
+	}
+	roleService := NewRoleService(s.roleRepo)
+	if provider.ApplicationID != nil {
+		return roleService.GetEffectiveRoles(roles, provider.ApplicationID.String())
+	}
+	return roleService.expandRoles(roles)
+}
+
+// samlAttribute builds the attribute of the mapping holding the values, sorted
+// and without duplicates. Attributes named by a URI use the uri name format,
+// and the others the basic one.
+func samlAttribute(mapping *models.SAMLAttributeMapping, values []string) (saml.Attribute, bool) {
+	sort.Strings(values)
+	attribute := saml.Attribute{
+		Name:         mapping.Name,
+		FriendlyName: mapping.FriendlyName,
+		NameFormat:   "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
+	}
+	if strings.HasPrefix(mapping.Name, "urn:") {
+		attribute.NameFormat = "urn:oasis:names:tc:SAML:2.0:attrname-format:uri"
+	}
+	for i, value := range values {
+		if value == "" || (i > 0 && value == values[i-1]) {
+			continue
+		}
+		attribute.Values = append(attribute.Values, saml.AttributeValue{Type: "xs:string", Value: value})
+	}
+	return attribute, len(attribute.Values) > 0
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"auth-server/mapper"
+	"auth-server/models"
+	"auth-server/repository"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/crewjam/saml"
+	"github.com/google/uuid"
+)
+
+// ErrInvalidSAMLServiceProvider is returned when the configuration of a SAML
+// service provider is invalid.
+var ErrInvalidSAMLServiceProvider = errors.New("invalid SAML service provider")
+
+type SAMLServiceProviderService struct {
+	repo       *repository.SAMLServiceProviderRepository
+	appRepo    *repository.ApplicationRepository
+	httpClient *http.Client
+}
+
+// NewSAMLServiceProviderService creates a new instance of
+// SAMLServiceProviderService. Metadata configured with a URL is fetched with
+// httpClient.
+func NewSAMLServiceProviderService(repo *repository.SAMLServiceProviderRepository, appRepo *repository.ApplicationRepository, httpClient *http.Client) *SAMLServiceProviderService {
+	return &SAMLServiceProviderService{repo: repo, appRepo: appRepo, httpClient: httpClient}
+}
+
+// GetAll returns all service providers.
+func (s *SAMLServiceProviderService) GetAll() ([]*models.SAMLServiceProviderDto, error) {
+	providers, err := s.repo.FindAll(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return mapper.SAMLServiceProvidersToSAMLServiceProviderDtos(providers), nil
+}
+
+// GetServiceProviderById returns the service provider with the provided id.
+func (s *SAMLServiceProviderService) GetServiceProviderById(id string) (*models.SAMLServiceProvider, error) {
+	providerId, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.FindById(context.Background(), providerId.String())
+}
+
+// CreateServiceProvider registers a service provider by importing its metadata.
+func (s *SAMLServiceProviderService) CreateServiceProvider(data *models.SAMLServiceProviderRequest) (*models.SAMLServiceProviderDto, error) {
+	provider := &models.SAMLServiceProvider{
+		BaseUUIDEntity: models.BaseUUIDEntity{
+			ID: uuid.New(),
+		},
+	}
+	return s.save(provider, data)
+}
+
+// UpdateServiceProvider replaces the configuration of the service provider
+// with the request. The metadata is imported again, so updating a service
+// provider configured with a metadata URL refreshes it.
+func (s *SAMLServiceProviderService) UpdateServiceProvider(provider *models.SAMLServiceProvider, data *models.SAMLServiceProviderRequest) (*models.SAMLServiceProviderDto, error) {
+	return s.save(provider, data)
+}
+
+// DeleteServiceProvider deletes the service provider.
+func (s *SAMLServiceProviderService) DeleteServiceProvider(provider *models.SAMLServiceProvider) error {
+	return s.repo.Delete(context.Background(), provider.ID.String())
+}
+
+func (s *SAMLServiceProviderService) save(provider *models.SAMLServiceProvider, data *models.SAMLServiceProviderRequest) (*models.SAMLServiceProviderDto, error) {
+	ctx := context.Background()
+	provider.Name = data.Name
+	provider.Disabled = data.Disabled
+	provider.MetadataURL = data.MetadataURL
+	provider.Metadata = data.Metadata
+	provider.NameIDFormat = data.NameIDFormat
+	provider.AttributeMappings = data.AttributeMappings
+	if provider.NameIDFormat == "" {
+		provider.NameIDFormat = models.SAML_NAMEID_FORMAT_PERSISTENT
+	}
+	if len(provider.AttributeMappings) == 0 {
+		provider.AttributeMappings = models.DefaultSAMLAttributeMappings()
+	}
+	provider.ApplicationID = nil
+	provider.Application = nil
+	if data.ApplicationId != "" {
+		if _, err := uuid.Parse(data.ApplicationId); err != nil {
+			return nil, fmt.Errorf("%w: invalid application id %q", ErrInvalidSAMLServiceProvider, data.ApplicationId)
+		}
+		app, err := s.appRepo.FindById(ctx, data.ApplicationId)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unknown application %q", ErrInvalidSAMLServiceProvider, data.ApplicationId)
+		}
+		provider.ApplicationID = &app.ID
+	}
+	err := provider.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSAMLServiceProvider, err)
+	}
+
+	if provider.Metadata == "" {
+		metadata, err := s.fetchMetadata(provider.MetadataURL)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSAMLServiceProvider, err)
+		}
+		provider.Metadata = string(metadata)
+	}
+	entity, err := parseSAMLServiceProviderMetadata([]byte(provider.Metadata))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSAMLServiceProvider, err)
+	}
+	if entity.EntityID == "" {
+		return nil, fmt.Errorf("%w: the metadata has no entity id", ErrInvalidSAMLServiceProvider)
+	}
+	provider.EntityID = entity.EntityID
+
+	existing, err := s.repo.FindByName(ctx, provider.Name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.ID != provider.ID {
+		return nil, fmt.Errorf("%w: name is already taken", ErrInvalidSAMLServiceProvider)
+	}
+	existing, err = s.repo.FindByEntityId(ctx, provider.EntityID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.ID != provider.ID {
+		return nil, fmt.Errorf("%w: entity id %q is already registered", ErrInvalidSAMLServiceProvider, provider.EntityID)
+	}
+	provider, err = s.repo.Save(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+	return mapper.SAMLServiceProviderToSAMLServiceProviderDto(provider), nil
+}
+
+// fetchMetadata downloads the metadata of a service provider.
+func (s *SAMLServiceProviderService) fetchMetadata(metadataURL string) ([]byte, error) {
+	response, err := s.httpClient.Get(metadataURL)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching metadata_url returned status %d", response.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(response.Body, 1<<20))
+}
+
+// parseSAMLServiceProviderMetadata parses the metadata of a service provider.
+// Metadata documents describing several entities are searched for the first
+// one holding a service provider descriptor.
+func parseSAMLServiceProviderMetadata(data []byte) (*saml.EntityDescriptor, error) {
+	var entity saml.EntityDescriptor
+	err := xml.Unmarshal(data, &entity)
+	if err == nil {
+		if len(entity.SPSSODescriptors) == 0 {
+			return nil, errors.New("the metadata does not describe a service provider")
+		}
+		return &entity, nil
+	}
+	var entities saml.EntitiesDescriptor
+	if xml.NewDecoder(bytes.NewReader(data)).Decode(&entities) != nil {
+		return nil, fmt.Errorf("invalid SAML metadata: %w", err)
+	}
+	for i, candidate := range entities.EntityDescriptors {
+		if len(candidate.SPSSODescriptors) > 0 {
+			return &entities.EntityDescriptors[i], nil
+		}
+	}
+	return nil, errors.New("the metadata does not describe a service provider")
+}
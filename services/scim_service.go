@@ -0,0 +1,651 @@
+package services
+
+import (
+	"auth-server/hasher"
+	"auth-server/mapper"
+	"auth-server/models"
+	"auth-server/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Errors returned by SCIMService, each matching one of the error types of
+// RFC 7644, section 3.12.
+var (
+	ErrSCIMResourceNotFound = errors.New("resource not found")
+	ErrSCIMInvalidFilter    = errors.New("invalid filter")
+	ErrSCIMInvalidPath      = errors.New("invalid path")
+	ErrSCIMInvalidValue     = errors.New("invalid value")
+	ErrSCIMMutability       = errors.New("attribute is read-only")
+	ErrSCIMUniqueness       = errors.New("uniqueness constraint violated")
+)
+
+type SCIMService struct {
+	userRepo  *repository.UserRepository
+	groupRepo *repository.GroupRepository
+	roleRepo  *repository.RoleRepository
+	hasher    hasher.Hasher
+	baseURI   string
+	events    EventPublisher
+}
+
+// NewSCIMService creates a new instance of SCIMService. Passwords are hashed
+// with hasher. baseURI is the URI of the SCIM endpoints, resource locations
+// are relative to.
+func NewSCIMService(userRepo *repository.UserRepository, groupRepo *repository.GroupRepository, roleRepo *repository.RoleRepository, hasher hasher.Hasher, baseURI string) *SCIMService {
+	return &SCIMService{
+		userRepo:  userRepo,
+		groupRepo: groupRepo,
+		roleRepo:  roleRepo,
+		hasher:    hasher,
+		baseURI:   baseURI,
+	}
+}
+
+// WithEvents makes the service publish the provisioning, update, deactivation
+// and deprovisioning of users with events.
+func (s *SCIMService) WithEvents(events EventPublisher) *SCIMService {
+	s.events = events
+	return s
+}
+
+// ListUsers returns the page of the users matching the filter starting at the
+// 1-based startIndex, holding at most count users.
+func (s *SCIMService) ListUsers(filter string, startIndex int, count int) (*models.SCIMListResponse, error) {
+	parsed, err := models.ParseSCIMFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSCIMInvalidFilter, err)
+	}
+	users, total, err := s.userRepo.FindByFilter(context.Background(), parsed, startIndex-1, count)
+	if errors.Is(err, repository.ErrUnsupportedFilter) {
+		return nil, fmt.Errorf("%w: %v", ErrSCIMInvalidFilter, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return listResponse(total, startIndex, len(users), mapper.UsersToSCIMUsers(users, s.baseURI)), nil
+}
+
+// GetUser returns the user with the provided id, along with their groups.
+func (s *SCIMService) GetUser(id string) (*models.User, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrSCIMResourceNotFound
+	}
+	ctx := context.Background()
+	user, err := s.userRepo.FindById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrSCIMResourceNotFound
+	}
+	user.Groups, err = s.userRepo.GetUserGroups(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// UserResource returns the SCIM representation of the user.
+func (s *SCIMService) UserResource(user *models.User) *models.SCIMUser {
+	return mapper.UserToSCIMUser(user, s.baseURI)
+}
+
+// CreateUser provisions a user from the resource. Users are active unless the
+// resource says otherwise. Users provisioned without a password cannot log in
+// with one until it is set.
+func (s *SCIMService) CreateUser(resource *models.SCIMUser) (*models.User, error) {
+	user := models.NewUser(&models.SignupRequest{})
+	err := s.applyUser(user, resource)
+	if err != nil {
+		return nil, err
+	}
+	user, err = s.saveUser(user, resource.Roles)
+	if err != nil {
+		return nil, err
+	}
+	publish(s.events, models.WEBHOOK_EVENT_USER_CREATED, mapper.UserToUserDto(user))
+	return user, nil
+}
+
+// ReplaceUser replaces the attributes of the user with the ones of the
+// resource. The roles assigned to the user are left unchanged when the
+// resource omits them.
+func (s *SCIMService) ReplaceUser(user *models.User, resource *models.SCIMUser) (*models.User, error) {
+	if resource.ID != "" && resource.ID != user.ID.String() {
+		return nil, fmt.Errorf("%w: id does not match the user being replaced", ErrSCIMMutability)
+	}
+	wasEnabled := user.Enabled
+	err := s.applyUser(user, resource)
+	if err != nil {
+		return nil, err
+	}
+	return s.updateUser(user, resource.Roles, wasEnabled)
+}
+
+// PatchUser applies the operations of the request to the user. Attributes the
+// server does not store are ignored, as they are when creating or replacing
+// a user.
+func (s *SCIMService) PatchUser(user *models.User, request *models.SCIMPatchRequest) (*models.User, error) {
+	wasEnabled := user.Enabled
+	roles := make([]*models.SCIMMultiValue, 0)
+	for _, role := range user.Roles {
+		roles = append(roles, &models.SCIMMultiValue{Value: role.ID.String()})
+	}
+	for _, operation := range request.Operations {
+		op := strings.ToLower(operation.Op)
+		if op != models.SCIM_PATCH_OP_ADD && op != models.SCIM_PATCH_OP_REMOVE && op != models.SCIM_PATCH_OP_REPLACE {
+			return nil, fmt.Errorf("%w: unknown operation %q", ErrSCIMInvalidValue, operation.Op)
+		}
+		attributes, err := patchAttributes(operation, models.SCIM_SCHEMA_USER)
+		if err != nil {
+			return nil, err
+		}
+		for _, attribute := range attributes {
+			err = s.patchUserAttribute(user, &roles, op, attribute)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return s.updateUser(user, roles, wasEnabled)
+}
+
+// DeleteUser deprovisions the user.
+func (s *SCIMService) DeleteUser(user *models.User) error {
+	err := s.userRepo.Delete(context.Background(), user.ID.String())
+	if err != nil {
+		return err
+	}
+	publish(s.events, models.WEBHOOK_EVENT_USER_DELETED, mapper.UserToUserDto(user))
+	return nil
+}
+
+// ListGroups returns the page of the groups matching the filter starting at
+// the 1-based startIndex, holding at most count groups.
+func (s *SCIMService) ListGroups(filter string, startIndex int, count int) (*models.SCIMListResponse, error) {
+	parsed, err := models.ParseSCIMFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSCIMInvalidFilter, err)
+	}
+	groups, total, err := s.groupRepo.FindByFilter(context.Background(), parsed, startIndex-1, count)
+	if errors.Is(err, repository.ErrUnsupportedFilter) {
+		return nil, fmt.Errorf("%w: %v", ErrSCIMInvalidFilter, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return listResponse(total, startIndex, len(groups), mapper.GroupsToSCIMGroups(groups, s.baseURI)), nil
+}
+
+// GetGroup returns the group with the provided id, along with its members.
+func (s *SCIMService) GetGroup(id string) (*models.Group, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrSCIMResourceNotFound
+	}
+	group, err := s.groupRepo.FindById(context.Background(), id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSCIMResourceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// GroupResource returns the SCIM representation of the group.
+func (s *SCIMService) GroupResource(group *models.Group) *models.SCIMGroup {
+	return mapper.GroupToSCIMGroup(group, s.baseURI)
+}
+
+// CreateGroup creates a top-level group from the resource, along with its
+// members.
+func (s *SCIMService) CreateGroup(resource *models.SCIMGroup) (*models.Group, error) {
+	group := &models.Group{
+		BaseUUIDEntity: models.BaseUUIDEntity{
+			ID: uuid.New(),
+		},
+	}
+	return s.saveGroup(group, resource.DisplayName, resource.Members)
+}
+
+// ReplaceGroup replaces the name and the members of the group with the ones
+// of the resource.
+func (s *SCIMService) ReplaceGroup(group *models.Group, resource *models.SCIMGroup) (*models.Group, error) {
+	if resource.ID != "" && resource.ID != group.ID.String() {
+		return nil, fmt.Errorf("%w: id does not match the group being replaced", ErrSCIMMutability)
+	}
+	members := resource.Members
+	if members == nil {
+		members = make([]*models.SCIMMultiValue, 0)
+	}
+	return s.saveGroup(group, resource.DisplayName, members)
+}
+
+// PatchGroup applies the operations of the request to the group.
+func (s *SCIMService) PatchGroup(group *models.Group, request *models.SCIMPatchRequest) (*models.Group, error) {
+	name := group.Name
+	members := make(map[string]bool)
+	for _, member := range group.Members {
+		members[member.ID.String()] = true
+	}
+	for _, operation := range request.Operations {
+		op := strings.ToLower(operation.Op)
+		if op != models.SCIM_PATCH_OP_ADD && op != models.SCIM_PATCH_OP_REMOVE && op != models.SCIM_PATCH_OP_REPLACE {
+			return nil, fmt.Errorf("%w: unknown operation %q", ErrSCIMInvalidValue, operation.Op)
+		}
+		attributes, err := patchAttributes(operation, models.SCIM_SCHEMA_GROUP)
+		if err != nil {
+			return nil, err
+		}
+		for _, attribute := range attributes {
+			switch attribute.name {
+			case "displayname":
+				if op == models.SCIM_PATCH_OP_REMOVE {
+					return nil, fmt.Errorf("%w: displayName is required", ErrSCIMInvalidValue)
+				}
+				err = json.Unmarshal(attribute.value, &name)
+			case "members":
+				err = patchReferences(members, op, attribute)
+			case "id", "meta":
+				err = fmt.Errorf("%w: %s", ErrSCIMMutability, attribute.name)
+			}
+			if err != nil {
+				return nil, scimValueError(err)
+			}
+		}
+	}
+
+	memberValues := make([]*models.SCIMMultiValue, 0)
+	for id := range members {
+		memberValues = append(memberValues, &models.SCIMMultiValue{Value: id})
+	}
+	return s.saveGroup(group, name, memberValues)
+}
+
+// DeleteGroup deletes the group. Its members are kept.
+func (s *SCIMService) DeleteGroup(group *models.Group) error {
+	return s.groupRepo.Delete(context.Background(), group.ID.String())
+}
+
+// applyUser sets the attributes of the user to the ones of the resource.
+func (s *SCIMService) applyUser(user *models.User, resource *models.SCIMUser) error {
+	user.Username = resource.UserName
+	user.Email = primaryValue(resource.Emails)
+	user.Enabled = resource.Active == nil || *resource.Active
+	if resource.Password != "" {
+		return s.setPassword(user, resource.Password)
+	}
+	return nil
+}
+
+// patchUserAttribute applies an operation to an attribute of the user. The
+// roles are collected, to be assigned once every operation is applied.
+func (s *SCIMService) patchUserAttribute(user *models.User, roles *[]*models.SCIMMultiValue, op string, attribute *patchAttribute) error {
+	remove := op == models.SCIM_PATCH_OP_REMOVE
+	var err error
+	switch attribute.name {
+	case "username":
+		if remove {
+			return fmt.Errorf("%w: userName is required", ErrSCIMInvalidValue)
+		}
+		err = json.Unmarshal(attribute.value, &user.Username)
+	case "active":
+		if remove {
+			user.Enabled = true
+			return nil
+		}
+		user.Enabled, err = scimBool(attribute.value)
+	case "emails":
+		if remove {
+			return fmt.Errorf("%w: a user requires an email", ErrSCIMInvalidValue)
+		}
+		if attribute.subAttribute == "value" {
+			err = json.Unmarshal(attribute.value, &user.Email)
+			break
+		}
+		var emails []*models.SCIMMultiValue
+		err = json.Unmarshal(attribute.value, &emails)
+		if err == nil && len(emails) > 0 {
+			user.Email = primaryValue(emails)
+		}
+	case "password":
+		var password string
+		if remove {
+			return fmt.Errorf("%w: the password cannot be removed", ErrSCIMInvalidValue)
+		}
+		err = json.Unmarshal(attribute.value, &password)
+		if err == nil {
+			err = s.setPassword(user, password)
+		}
+	case "roles":
+		values := make(map[string]bool)
+		for _, role := range *roles {
+			values[role.Value] = true
+		}
+		err = patchReferences(values, op, attribute)
+		*roles = make([]*models.SCIMMultiValue, 0)
+		for id := range values {
+			*roles = append(*roles, &models.SCIMMultiValue{Value: id})
+		}
+	case "id", "groups", "meta":
+		return fmt.Errorf("%w: %s", ErrSCIMMutability, attribute.name)
+	}
+	if err != nil {
+		return scimValueError(err)
+	}
+	return nil
+}
+
+// saveUser validates and saves the user, then assigns them the roles, unless
+// roles is nil.
+func (s *SCIMService) saveUser(user *models.User, roles []*models.SCIMMultiValue) (*models.User, error) {
+	ctx := context.Background()
+	if user.Username == "" {
+		return nil, fmt.Errorf("%w: userName is required", ErrSCIMInvalidValue)
+	}
+	if user.Email == "" {
+		return nil, fmt.Errorf("%w: a user requires an email", ErrSCIMInvalidValue)
+	}
+	existing, err := s.userRepo.FindByUsername(ctx, user.Username)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.ID != user.ID {
+		return nil, fmt.Errorf("%w: userName %q is already taken", ErrSCIMUniqueness, user.Username)
+	}
+	existing, err = s.userRepo.FindByEmail(ctx, user.Email)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.ID != user.ID {
+		return nil, fmt.Errorf("%w: email %q is already taken", ErrSCIMUniqueness, user.Email)
+	}
+
+	var assigned []*models.Role
+	if roles != nil {
+		assigned = make([]*models.Role, 0)
+		for _, value := range roles {
+			if _, err := uuid.Parse(value.Value); err != nil {
+				return nil, fmt.Errorf("%w: unknown role %q", ErrSCIMInvalidValue, value.Value)
+			}
+			role, err := s.roleRepo.FindById(ctx, value.Value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: unknown role %q", ErrSCIMInvalidValue, value.Value)
+			}
+			assigned = append(assigned, role)
+		}
+	}
+
+	user.Roles = nil
+	user.Groups = nil
+	_, err = s.userRepo.Save(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if assigned != nil {
+		err = s.userRepo.AssignRolesToUser(ctx, user, assigned)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s.GetUser(user.ID.String())
+}
+
+// saveGroup renames the group and saves it, then replaces its members, unless
+// members is nil. Group names are unique among siblings.
+func (s *SCIMService) saveGroup(group *models.Group, name string, members []*models.SCIMMultiValue) (*models.Group, error) {
+	ctx := context.Background()
+	if name == "" {
+		return nil, fmt.Errorf("%w: displayName is required", ErrSCIMInvalidValue)
+	}
+	existing, err := s.groupRepo.FindByParentAndName(ctx, group.ParentID, name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.ID != group.ID {
+		return nil, fmt.Errorf("%w: displayName %q is already taken", ErrSCIMUniqueness, name)
+	}
+
+	var users []*models.User
+	if members != nil {
+		users = make([]*models.User, 0)
+		for _, member := range members {
+			user, err := s.GetUser(member.Value)
+			if errors.Is(err, ErrSCIMResourceNotFound) {
+				return nil, fmt.Errorf("%w: unknown member %q", ErrSCIMInvalidValue, member.Value)
+			}
+			if err != nil {
+				return nil, err
+			}
+			users = append(users, user)
+		}
+	}
+
+	group.Name = name
+	_, err = s.groupRepo.Save(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	if users != nil {
+		err = s.groupRepo.AssignMembers(ctx, group, users)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s.GetGroup(group.ID.String())
+}
+
+// updateUser saves the changes made to the user, and publishes them, along
+// with the deactivation of the user if they were enabled before.
+func (s *SCIMService) updateUser(user *models.User, roles []*models.SCIMMultiValue, wasEnabled bool) (*models.User, error) {
+	user, err := s.saveUser(user, roles)
+	if err != nil {
+		return nil, err
+	}
+	dto := mapper.UserToUserDto(user)
+	publish(s.events, models.WEBHOOK_EVENT_USER_UPDATED, dto)
+	if wasEnabled && !user.Enabled {
+		publish(s.events, models.WEBHOOK_EVENT_USER_DISABLED, dto)
+	}
+	return user, nil
+}
+
+func (s *SCIMService) setPassword(user *models.User, password string) error {
+	hashed, err := s.hasher.GenerateFromPassword(password)
+	if err != nil {
+		return err
+	}
+	user.Password = hashed
+	return nil
+}
+
+// patchAttribute is an attribute a PATCH operation applies to. For
+// multi-valued attributes, filter selects the values the operation applies
+// to, such as `members[value eq "2819c223"]`.
+type patchAttribute struct {
+	name         string
+	filter       models.SCIMFilter
+	subAttribute string
+	value        json.RawMessage
+}
+
+// patchAttributes returns the attributes the operation applies to: the one
+// its path names, or the ones its value holds when it has no path. Attribute
+// names may be prefixed with the URI of the resource's schema.
+func patchAttributes(operation *models.SCIMPatchOperation, schema string) ([]*patchAttribute, error) {
+	if operation.Path != "" {
+		attribute, err := parsePatchPath(operation.Path, schema)
+		if err != nil {
+			return nil, err
+		}
+		attribute.value = operation.Value
+		return []*patchAttribute{attribute}, nil
+	}
+	var values map[string]json.RawMessage
+	err := json.Unmarshal(operation.Value, &values)
+	if err != nil {
+		return nil, fmt.Errorf("%w: operations without a path require an object value", ErrSCIMInvalidValue)
+	}
+	attributes := make([]*patchAttribute, 0)
+	for path, value := range values {
+		attribute, err := parsePatchPath(path, schema)
+		if err != nil {
+			return nil, err
+		}
+		attribute.value = value
+		attributes = append(attributes, attribute)
+	}
+	return attributes, nil
+}
+
+// parsePatchPath parses a path such as `emails[type eq "work"].value`.
+func parsePatchPath(path string, schema string) (*patchAttribute, error) {
+	if len(path) > len(schema)+1 && strings.EqualFold(path[:len(schema)+1], schema+":") {
+		path = path[len(schema)+1:]
+	}
+	attribute := &patchAttribute{}
+	if start := strings.Index(path, "["); start >= 0 {
+		end := strings.LastIndex(path, "]")
+		if end < start {
+			return nil, fmt.Errorf("%w: %q", ErrSCIMInvalidPath, path)
+		}
+		filter, err := models.ParseSCIMFilter(path[start+1 : end])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSCIMInvalidPath, err)
+		}
+		attribute.filter = filter
+		path = path[:start] + path[end+1:]
+	}
+	name, subAttribute, _ := strings.Cut(strings.ToLower(path), ".")
+	if name == "" {
+		return nil, fmt.Errorf("%w: %q", ErrSCIMInvalidPath, path)
+	}
+	attribute.name = name
+	attribute.subAttribute = subAttribute
+	return attribute, nil
+}
+
+// patchReferences applies an operation to a multi-valued attribute holding
+// references to other resources, such as the members of a group, given as the
+// set of their ids. Values are selected either by a filter on their value, or
+// by the value of the operation.
+func patchReferences(ids map[string]bool, op string, attribute *patchAttribute) error {
+	var values []*models.SCIMMultiValue
+	if len(attribute.value) > 0 && string(attribute.value) != "null" {
+		err := json.Unmarshal(attribute.value, &values)
+		if err != nil {
+			return err
+		}
+	}
+	switch op {
+	case models.SCIM_PATCH_OP_ADD:
+		for _, value := range values {
+			ids[value.Value] = true
+		}
+	case models.SCIM_PATCH_OP_REPLACE:
+		for id := range ids {
+			delete(ids, id)
+		}
+		for _, value := range values {
+			ids[value.Value] = true
+		}
+	case models.SCIM_PATCH_OP_REMOVE:
+		if attribute.filter != nil {
+			selected, err := filteredValues(attribute.filter)
+			if err != nil {
+				return err
+			}
+			for _, id := range selected {
+				delete(ids, id)
+			}
+			return nil
+		}
+		if len(values) == 0 {
+			for id := range ids {
+				delete(ids, id)
+			}
+		}
+		for _, value := range values {
+			delete(ids, value.Value)
+		}
+	}
+	return nil
+}
+
+// filteredValues returns the values a value filter such as
+// `value eq "2819c223" or value eq "902c246b"` selects.
+func filteredValues(filter models.SCIMFilter) ([]string, error) {
+	var values []string
+	for _, term := range filter {
+		for _, comparison := range term {
+			value, ok := comparison.Value.(string)
+			if comparison.Attribute != "value" || comparison.Operator != models.SCIM_FILTER_EQ || !ok || len(term) > 1 {
+				return nil, fmt.Errorf("%w: values can only be selected by value", ErrSCIMInvalidPath)
+			}
+			values = append(values, value)
+		}
+	}
+	return values, nil
+}
+
+// primaryValue returns the primary value of a multi-valued attribute, or its
+// first value if none is primary.
+func primaryValue(values []*models.SCIMMultiValue) string {
+	for _, value := range values {
+		if value.Primary {
+			return value.Value
+		}
+	}
+	if len(values) > 0 {
+		return values[0].Value
+	}
+	return ""
+}
+
+// scimBool decodes a boolean, which some clients send as a string.
+func scimBool(value json.RawMessage) (bool, error) {
+	var result bool
+	if json.Unmarshal(value, &result) == nil {
+		return result, nil
+	}
+	var text string
+	err := json.Unmarshal(value, &text)
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(text) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("%q is not a boolean", text)
+}
+
+// scimValueError wraps errors decoding the value of an operation into
+// ErrSCIMInvalidValue, leaving the service's own errors untouched.
+func scimValueError(err error) error {
+	for _, known := range []error{ErrSCIMInvalidPath, ErrSCIMInvalidValue, ErrSCIMMutability} {
+		if errors.Is(err, known) {
+			return err
+		}
+	}
+	return fmt.Errorf("%w: %v", ErrSCIMInvalidValue, err)
+}
+
+func listResponse(total int64, startIndex int, itemsPerPage int, resources interface{}) *models.SCIMListResponse {
+	return &models.SCIMListResponse{
+		Schemas:      []string{models.SCIM_MESSAGE_LIST_RESPONSE},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: itemsPerPage,
+		Resources:    resources,
+	}
+}
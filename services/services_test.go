@@ -0,0 +1,215 @@
+package services
+
+import (
+	"auth-server/models"
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// fakeLoginStore keeps federated logins in memory, by id.
+type fakeLoginStore map[string]*models.FederatedLogin
+
+func (f fakeLoginStore) FindByState(ctx context.Context, state string) (*models.FederatedLogin, error) {
+	for _, login := range f {
+		if login.StateHash == models.HashFederationState(state) {
+			return login, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f fakeLoginStore) Save(ctx context.Context, entity interface{}) (*models.FederatedLogin, error) {
+	login := entity.(*models.FederatedLogin)
+	f[login.ID.String()] = login
+	return login, nil
+}
+
+func (f fakeLoginStore) Consume(ctx context.Context, id string) (bool, error) {
+	_, ok := f[id]
+	delete(f, id)
+	return ok, nil
+}
+
+func (f fakeLoginStore) DeleteExpired(ctx context.Context, before time.Time) error {
+	for id, login := range f {
+		if login.ExpiresAt.Before(before) {
+			delete(f, id)
+		}
+	}
+	return nil
+}
+
+// fakeIdentityStore keeps external identities in memory, by id, and loads
+// their users from users like the repository preloads them.
+type fakeIdentityStore struct {
+	identities map[string]*models.ExternalIdentity
+	users      fakeUserStore
+}
+
+func (f *fakeIdentityStore) FindById(ctx context.Context, id string) (*models.ExternalIdentity, error) {
+	return f.identities[id], nil
+}
+
+func (f *fakeIdentityStore) FindByProviderAndSubject(ctx context.Context, providerId string, subject string) (*models.ExternalIdentity, error) {
+	for _, identity := range f.identities {
+		if identity.IdentityProviderID.String() == providerId && identity.Subject == subject {
+			identity.User = f.users[identity.UserID.String()]
+			return identity, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeIdentityStore) FindByUserId(ctx context.Context, userId string) ([]*models.ExternalIdentity, error) {
+	var identities []*models.ExternalIdentity
+	for _, identity := range f.identities {
+		if identity.UserID.String() == userId {
+			identities = append(identities, identity)
+		}
+	}
+	return identities, nil
+}
+
+func (f *fakeIdentityStore) Save(ctx context.Context, entity interface{}) (*models.ExternalIdentity, error) {
+	identity := entity.(*models.ExternalIdentity)
+	f.identities[identity.ID.String()] = identity
+	return identity, nil
+}
+
+func (f *fakeIdentityStore) Delete(ctx context.Context, id string) error {
+	delete(f.identities, id)
+	return nil
+}
+
+// fakeUserStore keeps users in memory, by id.
+type fakeUserStore map[string]*models.User
+
+func (f fakeUserStore) FindById(ctx context.Context, id string) (*models.User, error) {
+	return f[id], nil
+}
+
+func (f fakeUserStore) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	for _, user := range f {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f fakeUserStore) FindByUsername(ctx context.Context, username string) (*models.User, error) {
+	for _, user := range f {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f fakeUserStore) Save(ctx context.Context, entity interface{}) (*models.User, error) {
+	user := entity.(*models.User)
+	f[user.ID.String()] = user
+	return user, nil
+}
+
+func (f fakeUserStore) AddRolesToUser(ctx context.Context, user *models.User, roles []*models.Role) error {
+	stored := f[user.ID.String()]
+	for _, role := range roles {
+		if !hasRole(stored, role) {
+			stored.Roles = append(stored.Roles, role)
+		}
+	}
+	return nil
+}
+
+func (f fakeUserStore) RemoveRolesFromUser(ctx context.Context, user *models.User, roles []*models.Role) error {
+	stored := f[user.ID.String()]
+	kept := make([]*models.Role, 0)
+	for _, role := range stored.Roles {
+		removed := false
+		for _, r := range roles {
+			removed = removed || r.ID == role.ID
+		}
+		if !removed {
+			kept = append(kept, role)
+		}
+	}
+	stored.Roles = kept
+	return nil
+}
+
+func hasRole(user *models.User, role *models.Role) bool {
+	for _, r := range user.Roles {
+		if r.ID == role.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// newTestFederationService returns a FederationService keeping its logins,
+// identities and users in memory.
+func newTestFederationService() (*FederationService, fakeLoginStore, *fakeIdentityStore, fakeUserStore) {
+	logins := fakeLoginStore{}
+	users := fakeUserStore{}
+	identities := &fakeIdentityStore{identities: map[string]*models.ExternalIdentity{}, users: users}
+	return &FederationService{identities: identities, logins: logins, users: users}, logins, identities, users
+}
+
+// fakeRoleStore keeps roles in memory, by id. Composites are stored as
+// references to roles, which FindByIds loads like the repository preloads them.
+type fakeRoleStore map[uuid.UUID]*models.Role
+
+func (f fakeRoleStore) FindAll(ctx context.Context) ([]*models.Role, error) {
+	roles := make([]*models.Role, 0, len(f))
+	for _, role := range f {
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+func (f fakeRoleStore) FindById(ctx context.Context, id string) (*models.Role, error) {
+	roleId, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	return f[roleId], nil
+}
+
+func (f fakeRoleStore) FindByIds(ctx context.Context, ids []uuid.UUID) ([]*models.Role, error) {
+	roles := make([]*models.Role, 0, len(ids))
+	for _, id := range ids {
+		if role, ok := f[id]; ok {
+			roles = append(roles, role)
+		}
+	}
+	return roles, nil
+}
+
+func (f fakeRoleStore) Save(ctx context.Context, entity interface{}) (*models.Role, error) {
+	role := entity.(*models.Role)
+	f[role.ID] = role
+	return role, nil
+}
+
+func (f fakeRoleStore) AddComposites(ctx context.Context, role *models.Role, composites []*models.Role) error {
+	f[role.ID].Composites = append(f[role.ID].Composites, composites...)
+	return nil
+}
+
+func (f fakeRoleStore) AssignComposites(ctx context.Context, role *models.Role, composites []*models.Role) error {
+	f[role.ID].Composites = composites
+	return nil
+}
+
+func (f fakeRoleStore) AddPermissions(ctx context.Context, role *models.Role, permissions []*models.Permission) error {
+	f[role.ID].Permissions = append(f[role.ID].Permissions, permissions...)
+	return nil
+}
+
+func (f fakeRoleStore) AssignPermissions(ctx context.Context, role *models.Role, permissions []*models.Permission) error {
+	f[role.ID].Permissions = permissions
+	return nil
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"auth-server/mapper"
+	"auth-server/models"
+	"auth-server/repository"
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrSessionNotFound is returned when terminating a session that does not
+// exist, or belongs to another user.
+var ErrSessionNotFound = errors.New("session not found")
+
+type SessionService struct {
+	repo        *repository.SessionRepository
+	idleTimeout time.Duration
+	maxAge      time.Duration
+}
+
+// NewSessionService creates a new instance of SessionService. Sessions end
+// once they have been idle for idleTimeout, and maxAge after they started.
+func NewSessionService(repo *repository.SessionRepository, idleTimeout time.Duration, maxAge time.Duration) *SessionService {
+	return &SessionService{
+		repo:        repo,
+		idleTimeout: idleTimeout,
+		maxAge:      maxAge,
+	}
+}
+
+// CreateSession starts a session for the user, who just authenticated with the
+// given methods from the browser described by ipAddress and userAgent. It
+// returns the session along with the value of its cookie.
+func (s *SessionService) CreateSession(user *models.User, ipAddress string, userAgent string, authMethods []string) (*models.Session, string, error) {
+	ctx := context.Background()
+	err := s.repo.DeleteExpired(ctx, time.Now().Add(-s.idleTimeout))
+	if err != nil {
+		return nil, "", err
+	}
+	session, token, err := models.NewSession(user.ID, ipAddress, userAgent, authMethods, s.maxAge)
+	if err != nil {
+		return nil, "", err
+	}
+	session, err = s.repo.Save(ctx, session)
+	if err != nil {
+		return nil, "", err
+	}
+	session.User = user
+	return session, token, nil
+}
+
+// GetSession returns the active session whose cookie holds the token, or nil
+// if there is none, and records that it was used.
+func (s *SessionService) GetSession(token string) (*models.Session, error) {
+	ctx := context.Background()
+	session, err := s.repo.FindByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil || session.User == nil || !session.IsActive(s.idleTimeout) {
+		return nil, nil
+	}
+	session.LastSeenAt = time.Now()
+	err = s.repo.Touch(ctx, session.ID.String(), session.LastSeenAt)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// GetSessions returns the active sessions of the user.
+func (s *SessionService) GetSessions(user *models.User) ([]*models.SessionDto, error) {
+	sessions, err := s.repo.FindByUserId(context.Background(), user.ID.String())
+	if err != nil {
+		return nil, err
+	}
+	var active []*models.Session
+	for _, session := range sessions {
+		if session.IsActive(s.idleTimeout) {
+			active = append(active, session)
+		}
+	}
+	return mapper.SessionsToSessionDtos(active), nil
+}
+
+// AddClient records that the user authorized the client during the session.
+func (s *SessionService) AddClient(session *models.Session, client *models.Client) error {
+	clientId := client.ID.String()
+	if session.ClientIDs.Contains(clientId) {
+		return nil
+	}
+	session.ClientIDs = append(session.ClientIDs, clientId)
+	_, err := s.repo.Save(context.Background(), session)
+	return err
+}
+
+// TerminateSession ends the session with the given id, and returns it so that
+// the clients that took part in it can be notified.
+func (s *SessionService) TerminateSession(sessionId string) (*models.Session, error) {
+	session, err := s.repo.FindById(context.Background(), sessionId)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, ErrSessionNotFound
+	}
+	return session, s.repo.Delete(context.Background(), session.ID.String())
+}
+
+// TerminateUserSession ends one of the user's sessions, and returns it.
+func (s *SessionService) TerminateUserSession(user *models.User, sessionId string) (*models.Session, error) {
+	session, err := s.repo.FindById(context.Background(), sessionId)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil || session.UserID != user.ID {
+		return nil, ErrSessionNotFound
+	}
+	return session, s.repo.Delete(context.Background(), session.ID.String())
+}
+
+// TerminateSessions ends every session of the user, and returns the ones
+// that had not expired yet.
+func (s *SessionService) TerminateSessions(user *models.User) ([]*models.Session, error) {
+	ctx := context.Background()
+	sessions, err := s.repo.FindByUserId(ctx, user.ID.String())
+	if err != nil {
+		return nil, err
+	}
+	return sessions, s.repo.DeleteByUserId(ctx, user.ID.String())
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"auth-server/models"
+	"auth-server/repository"
+	"auth-server/repository/repositorytest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestGetSessionTimeouts(t *testing.T) {
+	const idleTimeout = 30 * time.Minute
+	const maxAge = 8 * time.Hour
+	user := &models.User{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, Username: "alice"}
+
+	tests := []struct {
+		name       string
+		lastSeenAt time.Duration
+		expiresAt  time.Duration
+		noUser     bool
+		active     bool
+	}{
+		{"recently used", -time.Minute, time.Hour, false, true},
+		{"almost idle for too long", -idleTimeout + time.Minute, time.Hour, false, true},
+		{"idle for too long", -idleTimeout - time.Minute, time.Hour, false, false},
+		{"past its maximum age", -time.Minute, -time.Second, false, false},
+		{"user deleted", -time.Minute, time.Hour, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := repositorytest.New(t)
+			now := time.Now()
+			session := &models.Session{
+				BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()},
+				TokenHash:      models.HashSessionToken("token"),
+				UserID:         user.ID,
+				AuthTime:       now.Add(-maxAge + tt.expiresAt),
+				LastSeenAt:     now.Add(tt.lastSeenAt),
+				ExpiresAt:      now.Add(tt.expiresAt),
+			}
+			fake.Return(`FROM "sessions" WHERE token_hash = '`+session.TokenHash+`'`, session)
+			if !tt.noUser {
+				fake.Return(`FROM "users" WHERE "users"."id" = '`+user.ID.String()+`'`, user)
+			}
+			service := NewSessionService(repository.NewSessionRepository(db), idleTimeout, maxAge)
+
+			found, err := service.GetSession("token")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (found != nil) != tt.active {
+				t.Fatalf("session = %+v, want active %v", found, tt.active)
+			}
+			touched := false
+			for _, statement := range fake.Statements() {
+				touched = touched || strings.HasPrefix(statement, `UPDATE "sessions" SET "last_seen_at"`)
+			}
+			// Only active sessions are extended by being used.
+			if touched != tt.active {
+				t.Errorf("last use recorded = %v, want %v", touched, tt.active)
+			}
+			if tt.active && !found.LastSeenAt.After(now) {
+				t.Errorf("last seen at %v, before the request", found.LastSeenAt)
+			}
+		})
+	}
+}
+
+func TestCreateSessionTimeouts(t *testing.T) {
+	const idleTimeout = 30 * time.Minute
+	const maxAge = 8 * time.Hour
+	db, fake := repositorytest.New(t)
+	service := NewSessionService(repository.NewSessionRepository(db), idleTimeout, maxAge)
+	user := &models.User{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, Username: "alice"}
+
+	before := time.Now()
+	session, token, err := service.CreateSession(user, "127.0.0.1", "test", []string{"pwd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := time.Now()
+	if token == "" || session.TokenHash != models.HashSessionToken(token) {
+		t.Errorf("token = %q, hash = %q", token, session.TokenHash)
+	}
+	// The session ends maxAge after it started, however it is used.
+	if session.ExpiresAt.Before(before.Add(maxAge)) || session.ExpiresAt.After(after.Add(maxAge)) {
+		t.Errorf("session expires at %v, want %v from now", session.ExpiresAt, maxAge)
+	}
+
+	// Sessions past either timeout are removed beforehand.
+	statements := fake.Statements()
+	deleted := regexp.MustCompile(`^DELETE FROM "sessions" WHERE expires_at < '([^']+)' OR last_seen_at < '([^']+)'`).FindStringSubmatch(statements[0])
+	if deleted == nil {
+		t.Fatalf("expired sessions are not removed: %v", statements)
+	}
+	idleSince, err := time.ParseInLocation("2006-01-02 15:04:05.999", deleted[2], time.Local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idleSince.Before(before.Add(-idleTimeout).Truncate(time.Millisecond)) || idleSince.After(after.Add(-idleTimeout)) {
+		t.Errorf("sessions idle since %v are removed, want %v ago", idleSince, idleTimeout)
+	}
+}
+
+func TestGetSessionsLeavesOutIdleSessions(t *testing.T) {
+	const idleTimeout = 30 * time.Minute
+	db, fake := repositorytest.New(t)
+	user := &models.User{BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()}, Username: "alice"}
+	now := time.Now()
+	newSession := func(lastSeenAt time.Duration) *models.Session {
+		return &models.Session{
+			BaseUUIDEntity: models.BaseUUIDEntity{ID: uuid.New()},
+			UserID:         user.ID,
+			LastSeenAt:     now.Add(lastSeenAt),
+			ExpiresAt:      now.Add(time.Hour),
+		}
+	}
+	active := newSession(-time.Minute)
+	fake.Return(`FROM "sessions" WHERE user_id = '`+user.ID.String()+`'`, active, newSession(-time.Hour))
+	service := NewSessionService(repository.NewSessionRepository(db), idleTimeout, 8*time.Hour)
+
+	sessions, err := service.GetSessions(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != active.ID.String() {
+		t.Errorf("sessions = %+v, want only %s", sessions, active.ID)
+	}
+}
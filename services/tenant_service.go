@@ -0,0 +1,121 @@
+package services
+
+import (
+	"auth-server/mapper"
+	"auth-server/models"
+	"auth-server/repository"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvalidTenant is returned when the settings of a tenant are invalid.
+	ErrInvalidTenant = errors.New("invalid tenant")
+	// ErrTenantConflict is returned when a tenant clashes with another one,
+	// or cannot be deleted because it still holds data.
+	ErrTenantConflict = errors.New("tenant conflict")
+)
+
+type TenantService struct {
+	repo *repository.TenantRepository
+}
+
+func NewTenantService(repo *repository.TenantRepository) *TenantService {
+	return &TenantService{repo: repo}
+}
+
+// GetAll returns all tenants.
+func (s *TenantService) GetAll() ([]*models.TenantDto, error) {
+	tenants, err := s.repo.FindAll(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return mapper.TenantsToTenantDtos(tenants), nil
+}
+
+// GetTenantById returns the tenant with the provided id.
+func (s *TenantService) GetTenantById(id string) (*models.Tenant, error) {
+	tenantId, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.FindById(context.Background(), tenantId.String())
+}
+
+// CreateTenant creates a tenant, along with the secret its tokens are signed
+// with.
+func (s *TenantService) CreateTenant(data *models.TenantRequest) (*models.TenantDto, error) {
+	secret, err := models.NewTenantSigningSecret()
+	if err != nil {
+		return nil, err
+	}
+	tenant := &models.Tenant{
+		BaseUUIDEntity: models.BaseUUIDEntity{
+			ID: uuid.New(),
+		},
+		SigningSecret: secret,
+	}
+	return s.save(tenant, data)
+}
+
+// UpdateTenant replaces the settings of the tenant with the request. The
+// default tenant cannot be renamed or disabled.
+func (s *TenantService) UpdateTenant(tenant *models.Tenant, data *models.TenantRequest) (*models.TenantDto, error) {
+	if tenant.IsDefault() && (data.Name != tenant.Name || data.Disabled) {
+		return nil, fmt.Errorf("%w: the default tenant cannot be renamed or disabled", ErrInvalidTenant)
+	}
+	return s.save(tenant, data)
+}
+
+// DeleteTenant deletes the tenant. Only tenants holding no users, clients,
+// applications or roles can be deleted, and the default tenant cannot be.
+func (s *TenantService) DeleteTenant(tenant *models.Tenant) error {
+	ctx := context.Background()
+	if tenant.IsDefault() {
+		return fmt.Errorf("%w: the default tenant cannot be deleted", ErrTenantConflict)
+	}
+	empty, err := s.repo.IsEmpty(ctx, tenant.ID.String())
+	if err != nil {
+		return err
+	}
+	if !empty {
+		return fmt.Errorf("%w: the tenant still holds users, clients, applications, roles or webhooks", ErrTenantConflict)
+	}
+	return s.repo.Delete(ctx, tenant.ID.String())
+}
+
+func (s *TenantService) save(tenant *models.Tenant, data *models.TenantRequest) (*models.TenantDto, error) {
+	ctx := context.Background()
+	tenant.Name = data.Name
+	tenant.DisplayName = data.DisplayName
+	tenant.Host = data.Host
+	tenant.Disabled = data.Disabled
+	err := tenant.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTenant, err)
+	}
+	existing, err := s.repo.FindByName(ctx, tenant.Name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.ID != tenant.ID {
+		return nil, fmt.Errorf("%w: tenant with name already exists", ErrTenantConflict)
+	}
+	if tenant.Host != "" {
+		existing, err = s.repo.FindByHost(ctx, tenant.Host)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil && existing.ID != tenant.ID {
+			return nil, fmt.Errorf("%w: tenant with host already exists", ErrTenantConflict)
+		}
+	}
+	tenant, err = s.repo.Save(ctx, tenant)
+	if err != nil {
+		return nil, err
+	}
+	return mapper.TenantToTenantDto(tenant), nil
+}
@@ -0,0 +1,33 @@
+package services
+
+import (
+	"auth-server/hasher"
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("auth-server/services")
+
+// startSpan starts a span of the trace carried by ctx, named after the service
+// method it covers.
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name)
+}
+
+// failSpan marks the span as failed with the error, and returns the error.
+func failSpan(span trace.Span, err error) error {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	return err
+}
+
+// compareHashAndPassword compares the password with its hash in a span of its
+// own, since hashing takes most of the time spent authenticating.
+func compareHashAndPassword(ctx context.Context, h hasher.Hasher, hashedPassword string, password string) error {
+	_, span := startSpan(ctx, "Hasher.CompareHashAndPassword")
+	defer span.End()
+	return h.CompareHashAndPassword(hashedPassword, password)
+}
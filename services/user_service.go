@@ -9,7 +9,8 @@ import (
 )
 
 type UserService struct {
-	repo *repository.UserRepository
+	repo   *repository.UserRepository
+	events EventPublisher
 }
 
 // NewUserService creates a new instance of UserService with the provided UserRepository.
@@ -17,6 +18,13 @@ func NewUserService(repo *repository.UserRepository) *UserService {
 	return &UserService{repo: repo}
 }
 
+// WithEvents makes the service publish the creation of users and the changes
+// of their roles with events.
+func (s *UserService) WithEvents(events EventPublisher) *UserService {
+	s.events = events
+	return s
+}
+
 // CreateUser creates a new user with the provided user details.
 func (s *UserService) CreateUser(data *models.SignupRequest) (*models.UserDto, error) {
 	_user, err := s.repo.FindByEmail(context.Background(), data.Email)
@@ -42,7 +50,9 @@ func (s *UserService) CreateUser(data *models.SignupRequest) (*models.UserDto, e
 		return nil, err
 	}
 
-	return mapper.UserToUserDto(result), nil
+	dto := mapper.UserToUserDto(result)
+	publish(s.events, models.WEBHOOK_EVENT_USER_CREATED, dto)
+	return dto, nil
 }
 
 // GetAll returns all users.
@@ -67,26 +77,38 @@ func (s *UserService) GetByEmail(email string) (*models.User, error) {
 	return s.repo.FindByEmail(context.Background(), email)
 }
 
+// GetUserRoles returns the roles of the user, whether assigned directly or
+// through the groups the user belongs to.
 func (s *UserService) GetUserRoles(user *models.User) ([]*models.RoleDto, error) {
-	roles, err := s.repo.GetUserRoles(context.Background(), user)
+	roles, err := s.GetEffectiveRoles(user)
 	if err != nil {
 		return nil, err
 	}
 	return mapper.RolesToRoleDtos(roles), nil
 }
 
-func (s *UserService) AssignRolesToUser(user *models.User, roles []*models.Role) (*models.UserDto, error) {
-	err := s.repo.AssignRolesToUser(context.Background(), user, roles)
+// GetEffectiveRoles returns the roles assigned to the user directly, along with
+// the roles assigned to the user's groups and their ancestors.
+func (s *UserService) GetEffectiveRoles(user *models.User) ([]*models.Role, error) {
+	return s.repo.GetEffectiveRoles(context.Background(), user)
+}
+
+// GetUserGroups returns the groups the user is a direct member of.
+func (s *UserService) GetUserGroups(user *models.User) ([]*models.GroupDto, error) {
+	groups, err := s.repo.GetUserGroups(context.Background(), user)
 	if err != nil {
 		return nil, err
 	}
+	return mapper.GroupsToGroupDtos(groups), nil
+}
 
-	user, err = s.repo.FindById(context.Background(), user.ID.String())
+func (s *UserService) AssignRolesToUser(user *models.User, roles []*models.Role) (*models.UserDto, error) {
+	err := s.repo.AssignRolesToUser(context.Background(), user, roles)
 	if err != nil {
 		return nil, err
 	}
 
-	return mapper.UserToUserDto(user), nil
+	return s.rolesChanged(user)
 }
 
 func (s *UserService) AddRolesToUser(user *models.User, roles []*models.Role) (*models.UserDto, error) {
@@ -95,10 +117,18 @@ func (s *UserService) AddRolesToUser(user *models.User, roles []*models.Role) (*
 		return nil, err
 	}
 
-	user, err = s.repo.FindById(context.Background(), user.ID.String())
+	return s.rolesChanged(user)
+}
+
+// rolesChanged returns the user as stored after a change of their roles, and
+// publishes the change.
+func (s *UserService) rolesChanged(user *models.User) (*models.UserDto, error) {
+	user, err := s.repo.FindById(context.Background(), user.ID.String())
 	if err != nil {
 		return nil, err
 	}
 
-	return mapper.UserToUserDto(user), nil
+	dto := mapper.UserToUserDto(user)
+	publish(s.events, models.WEBHOOK_EVENT_USER_ROLES_CHANGED, dto)
+	return dto, nil
 }
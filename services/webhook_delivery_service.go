@@ -0,0 +1,122 @@
+package services
+
+import (
+	"auth-server/models"
+	"auth-server/repository"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type WebhookDeliveryService struct {
+	repo       *repository.WebhookDeliveryRepository
+	client     *http.Client
+	attempts   int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+// NewWebhookDeliveryService creates a new instance of WebhookDeliveryService.
+// Events are posted with client, and each delivery is attempted up to
+// attempts times, waiting backoff before the first retry and twice as long
+// before each of the next ones, up to maxBackoff.
+func NewWebhookDeliveryService(repo *repository.WebhookDeliveryRepository, client *http.Client, attempts int, backoff time.Duration, maxBackoff time.Duration) *WebhookDeliveryService {
+	return &WebhookDeliveryService{
+		repo:       repo,
+		client:     client,
+		attempts:   attempts,
+		backoff:    backoff,
+		maxBackoff: maxBackoff,
+	}
+}
+
+// DeliverDue attempts up to batch deliveries whose next attempt is due,
+// concurrently, and returns how many it attempted. The deliveries are claimed
+// for the lease, which must outlast an attempt.
+func (s *WebhookDeliveryService) DeliverDue(batch int, lease time.Duration) (int, error) {
+	ctx := context.Background()
+	deliveries, err := s.repo.ClaimDue(ctx, time.Now(), lease, batch)
+	if err != nil {
+		return 0, err
+	}
+	errs := make([]error, len(deliveries))
+	var wg sync.WaitGroup
+	for i, delivery := range deliveries {
+		wg.Add(1)
+		go func(i int, delivery *models.WebhookDelivery) {
+			defer wg.Done()
+			s.attempt(delivery)
+			_, errs[i] = s.repo.Save(ctx, delivery)
+		}(i, delivery)
+	}
+	wg.Wait()
+	return len(deliveries), errors.Join(errs...)
+}
+
+// attempt sends the delivery once, and records the outcome: the delivery
+// either succeeded, is scheduled to be retried, or failed for good.
+func (s *WebhookDeliveryService) attempt(delivery *models.WebhookDelivery) {
+	now := time.Now()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	status, err := s.post(delivery, now)
+	delivery.ResponseStatus = status
+	switch {
+	case err == nil:
+		delivery.Status = models.WEBHOOK_DELIVERY_DELIVERED
+		delivery.LastError = ""
+	case delivery.Attempts >= s.attempts:
+		delivery.Status = models.WEBHOOK_DELIVERY_FAILED
+		delivery.LastError = err.Error()
+	default:
+		delivery.NextAttemptAt = now.Add(s.retryDelay(delivery.Attempts))
+		delivery.LastError = err.Error()
+	}
+}
+
+// retryDelay returns how long to wait before the next attempt of a delivery
+// that failed the given number of times.
+func (s *WebhookDeliveryService) retryDelay(attempts int) time.Duration {
+	delay := s.backoff
+	for i := 1; i < attempts && delay < s.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > s.maxBackoff {
+		return s.maxBackoff
+	}
+	return delay
+}
+
+// post sends the event of the delivery to its webhook, signed with the
+// webhook's secret, and returns the status the webhook responded with. Any
+// status other than 2xx is a failure.
+func (s *WebhookDeliveryService) post(delivery *models.WebhookDelivery, now time.Time) (int, error) {
+	webhook := delivery.Webhook
+	if webhook == nil || webhook.Disabled {
+		return 0, errors.New("the webhook is disabled")
+	}
+	payload := []byte(delivery.Payload)
+	request, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(models.WEBHOOK_HEADER_EVENT_ID, delivery.EventID)
+	request.Header.Set(models.WEBHOOK_HEADER_EVENT, delivery.EventType)
+	request.Header.Set(models.WEBHOOK_HEADER_TIMESTAMP, strconv.FormatInt(now.Unix(), 10))
+	request.Header.Set(models.WEBHOOK_HEADER_SIGNATURE, webhook.Sign(now, payload))
+	response, err := s.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
+		return response.StatusCode, fmt.Errorf("webhook %s responded with %s", webhook.URL, response.Status)
+	}
+	return response.StatusCode, nil
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"auth-server/models"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testReceiver is a webhook receiver responding to each request with the
+// next of its statuses, and recording the requests it received.
+type testReceiver struct {
+	server   *httptest.Server
+	statuses []int
+	requests []*http.Request
+	bodies   []string
+}
+
+func newTestReceiver(t *testing.T, statuses ...int) *testReceiver {
+	receiver := &testReceiver{statuses: statuses}
+	receiver.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		receiver.bodies = append(receiver.bodies, string(body))
+		status := receiver.statuses[len(receiver.requests)%len(receiver.statuses)]
+		receiver.requests = append(receiver.requests, r)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(receiver.server.Close)
+	return receiver
+}
+
+func newTestDelivery(url string) *models.WebhookDelivery {
+	return &models.WebhookDelivery{
+		Webhook:   &models.Webhook{URL: url, Secret: "webhook-secret"},
+		EventID:   "event",
+		EventType: models.WEBHOOK_EVENT_USER_CREATED,
+		Payload:   `{"id":"event","type":"user.created"}`,
+		Status:    models.WEBHOOK_DELIVERY_PENDING,
+	}
+}
+
+func TestWebhookDeliverySignsRequests(t *testing.T) {
+	receiver := newTestReceiver(t, http.StatusOK)
+	service := &WebhookDeliveryService{client: receiver.server.Client(), attempts: 3, backoff: time.Second, maxBackoff: time.Minute}
+	delivery := newTestDelivery(receiver.server.URL)
+
+	before := time.Now().Unix()
+	service.attempt(delivery)
+	if len(receiver.requests) != 1 {
+		t.Fatalf("received %d requests, want 1", len(receiver.requests))
+	}
+	request := receiver.requests[0]
+	tests := []struct {
+		header string
+		value  string
+	}{
+		{"Content-Type", "application/json"},
+		{models.WEBHOOK_HEADER_EVENT_ID, "event"},
+		{models.WEBHOOK_HEADER_EVENT, models.WEBHOOK_EVENT_USER_CREATED},
+	}
+	for _, tt := range tests {
+		if value := request.Header.Get(tt.header); value != tt.value {
+			t.Errorf("%s = %q, want %q", tt.header, value, tt.value)
+		}
+	}
+	timestamp := request.Header.Get(models.WEBHOOK_HEADER_TIMESTAMP)
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || sent < before || sent > time.Now().Unix() {
+		t.Fatalf("%s = %q, want the time of the attempt", models.WEBHOOK_HEADER_TIMESTAMP, timestamp)
+	}
+	if receiver.bodies[0] != delivery.Payload {
+		t.Fatalf("body = %q, want %q", receiver.bodies[0], delivery.Payload)
+	}
+	mac := hmac.New(sha256.New, []byte("webhook-secret"))
+	mac.Write([]byte(timestamp + "." + delivery.Payload))
+	if signature := request.Header.Get(models.WEBHOOK_HEADER_SIGNATURE); signature != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+		t.Fatalf("%s = %q does not sign the timestamp and payload", models.WEBHOOK_HEADER_SIGNATURE, signature)
+	}
+	if delivery.Status != models.WEBHOOK_DELIVERY_DELIVERED || delivery.ResponseStatus != http.StatusOK {
+		t.Fatalf("status = %s (%d), want delivered", delivery.Status, delivery.ResponseStatus)
+	}
+}
+
+func TestWebhookDeliveryRetryDelay(t *testing.T) {
+	service := &WebhookDeliveryService{backoff: time.Second, maxBackoff: 10 * time.Second}
+	tests := []struct {
+		attempts int
+		delay    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{50, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.attempts), func(t *testing.T) {
+			if delay := service.retryDelay(tt.attempts); delay != tt.delay {
+				t.Fatalf("retryDelay(%d) = %s, want %s", tt.attempts, delay, tt.delay)
+			}
+		})
+	}
+}
+
+func TestWebhookDeliveryAttempts(t *testing.T) {
+	type outcome struct {
+		status         string
+		responseStatus int
+		retryIn        time.Duration
+		failed         bool
+	}
+	tests := []struct {
+		name     string
+		statuses []int
+		disabled bool
+		outcomes []outcome
+	}{
+		{"delivered at once", []int{http.StatusNoContent}, false, []outcome{
+			{models.WEBHOOK_DELIVERY_DELIVERED, http.StatusNoContent, 0, false},
+		}},
+		{"delivered on retry", []int{http.StatusServiceUnavailable, http.StatusOK}, false, []outcome{
+			{models.WEBHOOK_DELIVERY_PENDING, http.StatusServiceUnavailable, time.Second, true},
+			{models.WEBHOOK_DELIVERY_DELIVERED, http.StatusOK, 0, false},
+		}},
+		{"failed after every attempt", []int{http.StatusInternalServerError}, false, []outcome{
+			{models.WEBHOOK_DELIVERY_PENDING, http.StatusInternalServerError, time.Second, true},
+			{models.WEBHOOK_DELIVERY_PENDING, http.StatusInternalServerError, 2 * time.Second, true},
+			{models.WEBHOOK_DELIVERY_FAILED, http.StatusInternalServerError, 0, true},
+		}},
+		{"client errors are retried", []int{http.StatusBadRequest, http.StatusAccepted}, false, []outcome{
+			{models.WEBHOOK_DELIVERY_PENDING, http.StatusBadRequest, time.Second, true},
+			{models.WEBHOOK_DELIVERY_DELIVERED, http.StatusAccepted, 0, false},
+		}},
+		{"disabled webhook", []int{http.StatusOK}, true, []outcome{
+			{models.WEBHOOK_DELIVERY_PENDING, 0, time.Second, true},
+			{models.WEBHOOK_DELIVERY_PENDING, 0, 2 * time.Second, true},
+			{models.WEBHOOK_DELIVERY_FAILED, 0, 0, true},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver := newTestReceiver(t, tt.statuses...)
+			service := &WebhookDeliveryService{client: receiver.server.Client(), attempts: 3, backoff: time.Second, maxBackoff: time.Minute}
+			delivery := newTestDelivery(receiver.server.URL)
+			delivery.Webhook.Disabled = tt.disabled
+
+			for i, want := range tt.outcomes {
+				before := time.Now()
+				service.attempt(delivery)
+				if delivery.Attempts != i+1 {
+					t.Fatalf("attempts = %d, want %d", delivery.Attempts, i+1)
+				}
+				if delivery.Status != want.status || delivery.ResponseStatus != want.responseStatus {
+					t.Fatalf("attempt %d: status = %s (%d), want %s (%d)", i+1, delivery.Status, delivery.ResponseStatus, want.status, want.responseStatus)
+				}
+				if (delivery.LastError != "") != want.failed {
+					t.Fatalf("attempt %d: last error = %q", i+1, delivery.LastError)
+				}
+				if want.retryIn > 0 {
+					retryIn := delivery.NextAttemptAt.Sub(*delivery.LastAttemptAt)
+					if retryIn != want.retryIn || delivery.LastAttemptAt.Before(before) {
+						t.Fatalf("attempt %d: retried in %s, want %s", i+1, retryIn, want.retryIn)
+					}
+				}
+			}
+			if tt.disabled && len(receiver.requests) != 0 {
+				t.Fatalf("the disabled webhook received %d requests", len(receiver.requests))
+			}
+		})
+	}
+}
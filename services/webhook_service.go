@@ -0,0 +1,192 @@
+package services
+
+import (
+	"auth-server/mapper"
+	"auth-server/models"
+	"auth-server/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidWebhook is returned when the settings of a webhook are invalid.
+var ErrInvalidWebhook = errors.New("invalid webhook")
+
+// EventPublisher publishes identity events, such as the creation of a user,
+// to the webhooks subscribed to them.
+type EventPublisher interface {
+	Publish(eventType string, data interface{})
+}
+
+// publish publishes the event with the publisher, unless there is none.
+func publish(events EventPublisher, eventType string, data interface{}) {
+	if events != nil {
+		events.Publish(eventType, data)
+	}
+}
+
+type WebhookService struct {
+	repo       *repository.WebhookRepository
+	deliveries *repository.WebhookDeliveryRepository
+}
+
+// NewWebhookService creates a new instance of WebhookService.
+func NewWebhookService(repo *repository.WebhookRepository, deliveries *repository.WebhookDeliveryRepository) *WebhookService {
+	return &WebhookService{repo: repo, deliveries: deliveries}
+}
+
+// GetAll returns all webhooks.
+func (s *WebhookService) GetAll() ([]*models.WebhookDto, error) {
+	webhooks, err := s.repo.FindAll(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return mapper.WebhooksToWebhookDtos(webhooks), nil
+}
+
+// GetWebhookById returns the webhook with the provided id.
+func (s *WebhookService) GetWebhookById(id string) (*models.Webhook, error) {
+	webhookId, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.FindById(context.Background(), webhookId.String())
+}
+
+// CreateWebhook creates a webhook from the request. A secret is generated
+// unless the request holds one; either way, it is only returned here.
+func (s *WebhookService) CreateWebhook(data *models.WebhookRequest) (*models.WebhookDto, error) {
+	webhook := &models.Webhook{
+		BaseUUIDEntity: models.BaseUUIDEntity{
+			ID: uuid.New(),
+		},
+	}
+	if data.Secret == "" {
+		secret, err := models.NewWebhookSecret()
+		if err != nil {
+			return nil, err
+		}
+		data.Secret = secret
+	}
+	result, err := s.save(webhook, data)
+	if err != nil {
+		return nil, err
+	}
+	result.Secret = webhook.Secret
+	return result, nil
+}
+
+// UpdateWebhook replaces the settings of the webhook with the request. The
+// secret is kept when the request omits it.
+func (s *WebhookService) UpdateWebhook(webhook *models.Webhook, data *models.WebhookRequest) (*models.WebhookDto, error) {
+	return s.save(webhook, data)
+}
+
+// DeleteWebhook deletes the webhook, dropping the deliveries still pending.
+func (s *WebhookService) DeleteWebhook(webhook *models.Webhook) error {
+	return s.repo.Delete(context.Background(), webhook.ID.String())
+}
+
+// GetDeliveries returns a page of the deliveries of the webhook, most recent
+// first.
+func (s *WebhookService) GetDeliveries(webhook *models.Webhook, offset int, limit int) (*models.WebhookDeliveryPage, error) {
+	deliveries, total, err := s.deliveries.FindByWebhook(context.Background(), webhook.ID, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &models.WebhookDeliveryPage{
+		Total:      total,
+		Offset:     offset,
+		Limit:      limit,
+		Deliveries: mapper.WebhookDeliveriesToWebhookDeliveryDtos(deliveries),
+	}, nil
+}
+
+func (s *WebhookService) save(webhook *models.Webhook, data *models.WebhookRequest) (*models.WebhookDto, error) {
+	webhook.Name = data.Name
+	webhook.URL = data.URL
+	webhook.Events = data.Events
+	webhook.Disabled = data.Disabled
+	if data.Secret != "" {
+		webhook.Secret = data.Secret
+	}
+	err := webhook.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+	webhook, err = s.repo.Save(context.Background(), webhook)
+	if err != nil {
+		return nil, err
+	}
+	return mapper.WebhookToWebhookDto(webhook), nil
+}
+
+// WebhookDispatcher publishes the events of a realm by queuing a delivery to
+// every webhook subscribed to them. Deliveries are sent in the background by
+// WebhookDeliveryService.
+type WebhookDispatcher struct {
+	webhooks   *repository.WebhookRepository
+	deliveries *repository.WebhookDeliveryRepository
+	realm      string
+	onError    func(error)
+}
+
+// NewWebhookDispatcher creates a new instance of WebhookDispatcher publishing
+// the events of the named realm. Events that cannot be queued are reported to
+// onError: by then, the change they report has already been made, and is not
+// undone.
+func NewWebhookDispatcher(webhooks *repository.WebhookRepository, deliveries *repository.WebhookDeliveryRepository, realm string, onError func(error)) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		webhooks:   webhooks,
+		deliveries: deliveries,
+		realm:      realm,
+		onError:    onError,
+	}
+}
+
+// Publish queues a delivery of the event to every enabled webhook subscribed
+// to its type.
+func (d *WebhookDispatcher) Publish(eventType string, data interface{}) {
+	err := d.publish(eventType, data)
+	if err != nil && d.onError != nil {
+		d.onError(fmt.Errorf("publishing %s event: %w", eventType, err))
+	}
+}
+
+func (d *WebhookDispatcher) publish(eventType string, data interface{}) error {
+	ctx := context.Background()
+	webhooks, err := d.webhooks.FindSubscribed(ctx, eventType)
+	if err != nil || len(webhooks) == 0 {
+		return err
+	}
+	now := time.Now()
+	event := &models.WebhookEvent{
+		ID:      uuid.New().String(),
+		Type:    eventType,
+		Realm:   d.realm,
+		Created: now.UTC().Format(time.RFC3339),
+		Data:    data,
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	for _, webhook := range webhooks {
+		_, err = d.deliveries.Save(ctx, &models.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			EventID:       event.ID,
+			EventType:     eventType,
+			Payload:       string(payload),
+			Status:        models.WEBHOOK_DELIVERY_PENDING,
+			NextAttemptAt: now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}